@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/beads"
+	"github.com/bryantinsley/machinator/backend/internal/events"
+	"github.com/bryantinsley/machinator/backend/internal/scheduler"
+	"github.com/bryantinsley/machinator/backend/internal/tracker"
+)
+
+// autoscaleInterval is how often the autoscaler resizes the agent pool.
+const autoscaleInterval = 10 * time.Second
+
+// autoscaler adds agents while claimable tasks outnumber idle ones and
+// removes agents left idle, within cfg.Autoscale's bounds. Added agents go
+// through setupWatcher like any other; removed ones leave their worktree
+// for it to reuse.
+func (o *orchestrator) autoscaler() {
+	as := o.cfg.Autoscale
+	for {
+		time.Sleep(autoscaleInterval)
+
+		// Tasks held back don't count as demand, so a paused run scales down
+		backlog := 0
+		if !o.st.AssignmentIsPaused() && o.st.Hold() == "" {
+			n, err := o.claimable()
+			if err != nil {
+				o.logger.Log("autoscale", fmt.Sprintf("[yellow]Load tasks: %v[-]", err))
+				continue
+			}
+			backlog = n
+		}
+
+		agents := o.st.AgentsSnapshot()
+		pending := 0
+		var idle []scheduler.Idle
+		for _, a := range agents {
+			switch {
+			case a.State == "pending":
+				pending++
+			case a.State == "ready" && a.AssignRequest == "":
+				idle = append(idle, scheduler.Idle{ID: a.ID, Since: a.ReadySince})
+			}
+		}
+
+		add, remove := scheduler.Autoscale(len(agents), pending, backlog, idle, as.MinAgents, as.MaxAgents, as.IdleAfter.Duration(), time.Now())
+		for range add {
+			a := o.st.AddAgent()
+			o.logger.Log("autoscale", fmt.Sprintf("Added agent %d for %d ready tasks", a.ID, backlog))
+		}
+		for _, id := range remove {
+			if !o.st.RemoveAgent(id) {
+				continue // Given a task since the snapshot
+			}
+			msg := fmt.Sprintf("idle for %s", as.IdleAfter.Duration())
+			o.logger.Log("autoscale", fmt.Sprintf("Removed agent %d, %s", id, msg))
+			o.bus.Publish(events.New(events.AgentRemoved, id, "", msg))
+		}
+	}
+}
+
+// claimable counts the ready tasks the assigner could claim now.
+func (o *orchestrator) claimable() (int, error) {
+	tasks, err := tracker.LoadTasks(o.projCfg, o.repoDir)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, t := range beads.ReadyTasks(tasks) {
+		if !o.st.IsTaskBarred(t.ID) && !o.st.IsTaskAssigned(t.ID) && !o.st.InCooldown(t.ID) {
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/events"
+)
+
+// runBudget bounds how much work a run does: --max-tasks, --max-duration,
+// --max-tokens and --batch. A zero limit is no limit.
+type runBudget struct {
+	maxTasks    int64
+	maxDuration time.Duration
+	maxTokens   int64
+	batch       int64
+}
+
+// enabled reports whether any limit is set.
+func (b runBudget) enabled() bool {
+	return b.maxTasks > 0 || b.maxDuration > 0 || b.maxTokens > 0 || b.batch > 0
+}
+
+// used returns which of the task, token and batch limits a run that has
+// completed tasks tasks with tokens tokens, and started batched, has
+// reached, or "".
+func (b runBudget) used(tasks, tokens, batched int64) string {
+	switch {
+	case b.maxTasks > 0 && tasks >= b.maxTasks:
+		return fmt.Sprintf("run budget: %d tasks completed", tasks)
+	case b.maxTokens > 0 && tokens >= b.maxTokens:
+		return fmt.Sprintf("run budget: %d tokens used", tokens)
+	case b.batch > 0 && batched >= b.batch:
+		return fmt.Sprintf("batch: %d tasks started", batched)
+	}
+	return ""
+}
+
+// budgetCheckInterval is how often budgetWatcher checks the run's budget.
+const budgetCheckInterval = time.Second
+
+// budgetWatcher ends the run once its budget is spent, closing done. At
+// the task or token limit no new tasks are assigned and the run ends when
+// the running ones finish; at the time limit it ends at once, and
+// shutdown stops the agents (their tasks are picked up again next run).
+// A batch also ends early once nothing is running and no task is left to
+// claim.
+func (o *orchestrator) budgetWatcher(b runBudget, done chan<- struct{}) {
+	started := time.Now()
+	spent := ""
+	for {
+		time.Sleep(budgetCheckInterval)
+		if b.maxDuration > 0 && time.Since(started) >= b.maxDuration {
+			o.logger.Log("main", fmt.Sprintf("[yellow]Run budget: %s elapsed, stopping[-]", b.maxDuration))
+			close(done)
+			return
+		}
+		idle := len(o.st.AssignedAgents()) == 0
+		if spent == "" {
+			spent = b.used(o.metrics.Counts()[events.TaskCompleted], o.st.Tokens(), o.st.Batched())
+			if spent == "" && b.batch > 0 && idle {
+				if n, err := o.claimable(); err == nil && n == 0 {
+					o.logger.Log("main", fmt.Sprintf("[yellow]Batch: no tasks left after %d, stopping[-]", o.st.Batched()))
+					close(done)
+					return
+				}
+			}
+			if spent == "" {
+				continue
+			}
+			o.st.SetSpent(spent)
+			o.logger.Log("main", fmt.Sprintf("[yellow]%s, finishing running tasks[-]", spent))
+		}
+		if idle {
+			o.logger.Log("main", fmt.Sprintf("[yellow]%s, stopping[-]", spent))
+			close(done)
+			return
+		}
+	}
+}
+
+// batchResults collects how each task of a --batch run ended, for the
+// summary printed when it exits.
+type batchResults struct {
+	mu      sync.Mutex
+	started time.Time
+	outcome map[string]string // Latest outcome by task; retries overwrite
+	agents  map[string]int
+}
+
+func newBatchResults() *batchResults {
+	return &batchResults{started: time.Now(), outcome: make(map[string]string), agents: make(map[string]int)}
+}
+
+// record is a bus subscriber noting the outcome of each task run.
+func (r *batchResults) record(e events.Event) {
+	outcome := ""
+	switch e.Type {
+	case events.TaskAssigned:
+		outcome = "not finished"
+	case events.TaskCompleted:
+		outcome = "completed"
+	case events.TaskFailed:
+		outcome = "failed: " + e.Message
+	case events.TaskTimedOut:
+		outcome = "timed out: " + e.Message
+	case events.TaskAbandoned:
+		outcome = "abandoned: " + e.Message
+	default:
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.outcome[e.TaskID] = outcome
+	r.agents[e.TaskID] = e.AgentID
+}
+
+// failed reports whether any task didn't complete.
+func (r *batchResults) failed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, outcome := range r.outcome {
+		if outcome != "completed" {
+			return true
+		}
+	}
+	return false
+}
+
+// print writes the summary: each task with how it ended, then the totals.
+func (r *batchResults) print(w io.Writer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ids := make([]string, 0, len(r.outcome))
+	for id := range r.outcome {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	completed := 0
+	fmt.Fprintf(w, "Batch of %d tasks in %s:\n", len(ids), time.Since(r.started).Round(time.Second))
+	for _, id := range ids {
+		if r.outcome[id] == "completed" {
+			completed++
+		}
+		fmt.Fprintf(w, "  %-12s agent %-3d %s\n", id, r.agents[id], r.outcome[id])
+	}
+	fmt.Fprintf(w, "%d completed, %d not\n", completed, len(ids)-completed)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/events"
+)
+
+func TestRunBudgetUsed(t *testing.T) {
+	tests := []struct {
+		name                   string
+		b                      runBudget
+		tasks, tokens, batched int64
+		want                   string // Substring; "" for within budget
+	}{
+		{"no limits", runBudget{}, 100, 1e9, 100, ""},
+		{"under every limit", runBudget{maxTasks: 5, maxTokens: 1000, batch: 3}, 4, 999, 2, ""},
+		{"task limit", runBudget{maxTasks: 5}, 5, 0, 0, "5 tasks completed"},
+		{"past the task limit", runBudget{maxTasks: 5}, 6, 0, 0, "6 tasks completed"},
+		{"token limit", runBudget{maxTokens: 1000}, 0, 1000, 0, "1000 tokens used"},
+		{"batch started", runBudget{batch: 3}, 0, 0, 3, "batch: 3 tasks started"},
+		{"tasks before tokens", runBudget{maxTasks: 1, maxTokens: 1}, 1, 1, 0, "tasks completed"},
+		{"duration isn't checked here", runBudget{maxDuration: time.Nanosecond}, 100, 100, 100, ""},
+	}
+	for _, tt := range tests {
+		got := tt.b.used(tt.tasks, tt.tokens, tt.batched)
+		if tt.want == "" && got != "" || !strings.Contains(got, tt.want) {
+			t.Errorf("%s: used = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBatchResults(t *testing.T) {
+	r := newBatchResults()
+	for _, e := range []events.Event{
+		events.New(events.AgentReady, 1, "", ""), // Not a task's outcome
+		events.New(events.TaskAssigned, 1, "t-1", ""),
+		events.New(events.TaskFailed, 1, "t-1", "exit 1"),
+		events.New(events.TaskAssigned, 2, "t-1", ""),
+		events.New(events.TaskCompleted, 2, "t-1", ""), // The retry's outcome wins
+		events.New(events.TaskAssigned, 1, "t-2", ""),
+		events.New(events.TaskCompleted, 1, "t-2", ""),
+	} {
+		r.record(e)
+	}
+	if r.failed() {
+		t.Errorf("failed with every task completed: %v", r.outcome)
+	}
+
+	tests := []struct {
+		e    events.Event
+		want string
+	}{
+		{events.New(events.TaskAssigned, 3, "t-3", ""), "not finished"},
+		{events.New(events.TaskTimedOut, 3, "t-3", "idle timeout"), "timed out: idle timeout"},
+		{events.New(events.TaskAbandoned, 3, "t-3", "3 attempts"), "abandoned: 3 attempts"},
+	}
+	for _, tt := range tests {
+		r.record(tt.e)
+		if got := r.outcome["t-3"]; got != tt.want {
+			t.Errorf("after %s: outcome %q, want %q", tt.e.Type, got, tt.want)
+		}
+		if !r.failed() {
+			t.Errorf("after %s: not failed", tt.e.Type)
+		}
+	}
+
+	var b strings.Builder
+	r.print(&b)
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 5 || !strings.HasPrefix(lines[0], "Batch of 3 tasks in ") {
+		t.Fatalf("summary:\n%s", b.String())
+	}
+	for i, want := range []string{
+		"  t-1          agent 2   completed",
+		"  t-2          agent 1   completed",
+		"  t-3          agent 3   abandoned: 3 attempts",
+		"2 completed, 1 not",
+	} {
+		if lines[i+1] != want {
+			t.Errorf("summary line %d = %q, want %q", i+2, lines[i+1], want)
+		}
+	}
+}
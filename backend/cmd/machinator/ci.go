@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/beads"
+	"github.com/bryantinsley/machinator/backend/internal/config"
+	"github.com/bryantinsley/machinator/backend/internal/forge"
+	"github.com/bryantinsley/machinator/backend/internal/project"
+	"github.com/bryantinsley/machinator/backend/internal/rundb"
+	"github.com/bryantinsley/machinator/backend/internal/setup"
+	"github.com/bryantinsley/machinator/backend/internal/state"
+	"github.com/bryantinsley/machinator/backend/internal/tools"
+)
+
+// Bounds of a --ci-github run that sets none of its own. A GitHub job is
+// cancelled after 6h, so it stops well before to leave time to report.
+const (
+	ciDefaultBatch    = 5
+	ciDefaultDuration = 5*time.Hour + 30*time.Minute
+)
+
+// githubCI is the GitHub Actions job machinator runs in, as its
+// environment describes it.
+type githubCI struct {
+	server      string // e.g. https://github.com
+	repo        string // Clone URL
+	branch      string // Pull requests are opened into it
+	apiURL      string
+	token       string
+	stepSummary string // File the job summary is appended to; "" outside a job step
+}
+
+// githubCIFromEnv reads the job from the variables Actions sets. The token
+// isn't one of them: the workflow passes secrets.GITHUB_TOKEN (or a token
+// that may open pull requests) as GITHUB_TOKEN.
+func githubCIFromEnv() (githubCI, error) {
+	if os.Getenv("GITHUB_ACTIONS") != "true" {
+		return githubCI{}, errors.New("not in a GitHub Actions job (GITHUB_ACTIONS isn't true)")
+	}
+	g := githubCI{
+		server:      strings.TrimSuffix(os.Getenv("GITHUB_SERVER_URL"), "/"),
+		branch:      os.Getenv("GITHUB_BASE_REF"), // Set for pull_request events
+		apiURL:      os.Getenv("GITHUB_API_URL"),
+		token:       os.Getenv("GITHUB_TOKEN"),
+		stepSummary: os.Getenv("GITHUB_STEP_SUMMARY"),
+	}
+	if g.server == "" {
+		g.server = "https://github.com"
+	}
+	if g.branch == "" {
+		g.branch = os.Getenv("GITHUB_REF_NAME")
+	}
+	repo := os.Getenv("GITHUB_REPOSITORY")
+	switch {
+	case repo == "":
+		return g, errors.New("GITHUB_REPOSITORY isn't set")
+	case g.branch == "":
+		return g, errors.New("neither GITHUB_BASE_REF nor GITHUB_REF_NAME is set")
+	case g.token == "":
+		return g, errors.New("GITHUB_TOKEN isn't set; pass it from the workflow, e.g. env: GITHUB_TOKEN: ${{ secrets.GITHUB_TOKEN }}")
+	}
+	g.repo = g.server + "/" + repo + ".git"
+	if g.apiURL == "https://api.github.com" {
+		g.apiURL = "" // The forge's default
+	}
+	return g, nil
+}
+
+// ciGitHubEnv sets this process up to work on the job's repo and returns
+// the project to run and the job summary file. Git authenticates with the
+// job's token and commits as the Actions bot, and the project tracking the
+// repo (created if there's none) opens a pull request per completed task.
+// Tasks already completed on a task branch of an earlier run are barred as
+// in review. Exits if it can't be set up.
+func ciGitHubEnv(projectID string) (string, string) {
+	g, err := githubCIFromEnv()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --ci-github: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Like actions/checkout: an auth header for the server. It's given to
+	// machinator's own git only; agents, hooks and check commands get
+	// neither it nor the token
+	auth := base64.StdEncoding.EncodeToString([]byte("x-access-token:" + g.token))
+	tools.AddGitConfig("http."+g.server+"/.extraheader", "AUTHORIZATION: basic "+auth)
+	for name, value := range map[string]string{
+		"GIT_AUTHOR_NAME":     "github-actions[bot]",
+		"GIT_AUTHOR_EMAIL":    "41898282+github-actions[bot]@users.noreply.github.com",
+		"GIT_COMMITTER_NAME":  "github-actions[bot]",
+		"GIT_COMMITTER_EMAIL": "41898282+github-actions[bot]@users.noreply.github.com",
+	} {
+		if os.Getenv(name) == "" {
+			os.Setenv(name, value)
+		}
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	projectID, projCfg, err := g.project(cfg.MachinatorDir, projectID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: --ci-github: %v\n", err)
+		os.Exit(1)
+	}
+
+	s := setup.New(cfg.MachinatorDir)
+	if err := s.EnsureDirectories(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating directories: %v\n", err)
+		os.Exit(1)
+	}
+	ctx, cancel := setupContext(cfg)
+	defer cancel()
+	id, _ := strconv.Atoi(projectID)
+	repoDir, err := s.CloneRepo(ctx, id, projCfg.Repo, projCfg.Branch, projCfg.Clone)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error cloning repo: %v\n", err)
+		os.Exit(1)
+	}
+	if err := barInReview(cfg.MachinatorDir, repoDir); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "GitHub Actions run of %s (%s), project %s\n", projCfg.Repo, projCfg.Branch, projectID)
+	return projectID, g.stepSummary
+}
+
+// project returns the project tracking the job's repo: projectID if set,
+// else the one whose repo is the job's, else a new one. A new project
+// opens pull requests; an existing one must already.
+func (g githubCI) project(machinatorDir, projectID string) (string, *project.Config, error) {
+	_, want, _ := forge.ParseRemote(g.repo)
+	if projectID == "" {
+		entries, _ := os.ReadDir(filepath.Join(machinatorDir, "projects"))
+		next := 1
+		for _, e := range entries {
+			n, err := strconv.Atoi(e.Name())
+			if err != nil || !e.IsDir() {
+				continue
+			}
+			next = max(next, n+1)
+			if projCfg, err := project.Load(machinatorDir, e.Name()); err == nil {
+				if _, path, _ := forge.ParseRemote(projCfg.Repo); path == want {
+					projectID = e.Name()
+					break
+				}
+			}
+		}
+		if projectID == "" {
+			projectID = strconv.Itoa(next)
+		}
+	}
+
+	if _, err := os.Stat(project.ConfigPath(machinatorDir, projectID)); err == nil {
+		projCfg, err := project.Load(machinatorDir, projectID)
+		if err != nil {
+			return "", nil, err
+		}
+		if projCfg.Merge.Mode != project.MergePullRequest {
+			return "", nil, fmt.Errorf("project %s has merge.mode %q; set it to %q to run in Actions", projectID, projCfg.Merge.Mode, project.MergePullRequest)
+		}
+		return projectID, projCfg, nil
+	}
+
+	projCfg := &project.Config{
+		Repo:             g.repo,
+		Branch:           g.branch,
+		Forge:            forge.GitHub,
+		ForgeAPIURL:      g.apiURL,
+		SimpleModelName:  project.DefaultSimpleModel,
+		ComplexModelName: project.DefaultComplexModel,
+		Merge:            project.MergeConfig{Mode: project.MergePullRequest},
+	}
+	if err := project.Save(machinatorDir, projectID, projCfg); err != nil {
+		return "", nil, fmt.Errorf("save project: %w", err)
+	}
+	// Load for the defaults Save leaves out
+	projCfg, err := project.Load(machinatorDir, projectID)
+	return projectID, projCfg, err
+}
+
+// barInReview bars the tasks closed on their own task branch on origin:
+// an earlier run completed them and opened a pull request that hasn't
+// merged yet, so the branch still has them open.
+func barInReview(machinatorDir, repoDir string) error {
+	out, err := tools.Command(tools.Git, "-C", repoDir, "for-each-ref", "--format=%(refname:short)", "refs/remotes/origin/"+project.TaskBranch("")).Output()
+	if err != nil {
+		return fmt.Errorf("list task branches: %w", err)
+	}
+	refs := strings.Fields(string(out))
+	if len(refs) == 0 {
+		return nil
+	}
+
+	st, err := state.Load(machinatorDir)
+	if err != nil {
+		return fmt.Errorf("load state: %w", err)
+	}
+	defer st.Close()
+	for _, ref := range refs {
+		branch := strings.TrimPrefix(ref, "origin/")
+		taskID := strings.TrimPrefix(branch, project.TaskBranch(""))
+		if st.IsTaskBarred(taskID) {
+			continue
+		}
+		data, err := tools.Command(tools.Git, "-C", repoDir, "show", ref+":.beads/issues.jsonl").Output()
+		if err != nil {
+			continue // No beads on the branch
+		}
+		tasks, err := beads.ReadTasks(bytes.NewReader(data))
+		if err != nil {
+			continue
+		}
+		for _, t := range tasks {
+			if t.ID == taskID && t.Status == "closed" {
+				st.BarTaskAndSave(taskID, "in review on "+branch)
+			}
+		}
+	}
+	return nil
+}
+
+// appendJobSummary adds a run's summary to the job's summary page, as
+// markdown.
+func appendJobSummary(path string, s runSummary) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## machinator\n\n")
+	fmt.Fprintf(&b, "%d tasks attempted: %d completed, %d failed, in %s", s.TasksAttempted, s.TasksCompleted, s.TasksFailed, time.Duration(s.DurationSeconds)*time.Second)
+	if s.Tokens > 0 {
+		fmt.Fprintf(&b, ", %d tokens", s.Tokens)
+	}
+	fmt.Fprintf(&b, ". Seed `%s`.\n\n", s.Seed)
+	if len(s.Tasks) > 0 {
+		b.WriteString("| Task | Outcome | Runs | Time | Pull request |\n|---|---|---|---|---|\n")
+		for _, t := range s.Tasks {
+			outcome := t.Outcome
+			if last := t.Runs[len(t.Runs)-1]; t.Outcome != rundb.OutcomeCompleted && last.Message != "" {
+				outcome += ": " + strings.ReplaceAll(last.Message, "|", `\|`)
+			}
+			fmt.Fprintf(&b, "| %s | %s | %d | %s | %s |\n", t.ID, outcome, len(t.Runs), time.Duration(t.DurationSeconds)*time.Second, t.PullRequest)
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.WriteString(b.String())
+	return err
+}
@@ -0,0 +1,760 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/bryantinsley/machinator/backend/internal/agent"
+	"github.com/bryantinsley/machinator/backend/internal/beads"
+	"github.com/bryantinsley/machinator/backend/internal/config"
+	"github.com/bryantinsley/machinator/backend/internal/mock"
+	"github.com/bryantinsley/machinator/backend/internal/state"
+)
+
+// rootCmd builds the machinator command tree. Commands parse their flags
+// here and leave the work to the *Cmd functions.
+func rootCmd() *cobra.Command {
+	root := &cobra.Command{
+		Use:   "machinator",
+		Short: "Autonomous agent orchestration system",
+		Long: `machinator - Autonomous Agent Orchestration System
+
+Environment:
+  MACHINATOR_DIR      Base directory (default: ~/.machinator)
+  MACHINATOR_PROFILE  Profile to take the base directory from
+  Run 'machinator env' for the full list.`,
+		SilenceUsage: true,
+	}
+	var sets []string
+	var profile string
+	root.PersistentFlags().StringArrayVar(&sets, "set", nil, "override a config.json field, e.g. --set timeouts.idle=5m (repeatable; applied over files and environment)")
+	root.PersistentFlags().StringVarP(&profile, "profile", "P", "", "use this profile's MACHINATOR_DIR (see machinator profile)")
+	root.RegisterFlagCompletionFunc("profile", completeProfiles)
+	root.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		if err := config.UseProfile(profile); err != nil {
+			return err
+		}
+		return config.SetOverrides(sets)
+	}
+	root.AddCommand(
+		runCommand(),
+		daemonCommand(),
+		ctlCommand(),
+		triggerCommand(),
+		statusCommand(),
+		setupCommand(),
+		projectCommand(),
+		profileCommand(),
+		&cobra.Command{
+			Use:   "quota",
+			Short: "Dump quota for all accounts",
+			Args:  cobra.NoArgs,
+			Run:   func(cmd *cobra.Command, args []string) { quotaCmd() },
+		},
+		selectTaskCommand(),
+		forgeCommand(),
+		graphCommand(),
+		replayCommand(),
+		pinsCommand(),
+		indexCommand(),
+		&cobra.Command{
+			Use:   "menubar",
+			Short: "Print status for an xbar/SwiftBar plugin",
+			Args:  cobra.NoArgs,
+			Run:   func(cmd *cobra.Command, args []string) { menubarCmd() },
+		},
+		taskCommand(),
+		pruneBranchesCommand(),
+		orphansCommand(),
+		gcCommand(),
+		duCommand(),
+		&cobra.Command{
+			Use:   "env",
+			Short: "Show supported environment variables and their values",
+			Args:  cobra.NoArgs,
+			Run:   func(cmd *cobra.Command, args []string) { envCmd() },
+		},
+		flagsCommand(),
+		configCommand(),
+		doctorCommand(),
+		// The mock tools behind run --mock, not for people
+		&cobra.Command{
+			Use:                mock.GeminiCommand,
+			Hidden:             true,
+			DisableFlagParsing: true,
+			Run: func(cmd *cobra.Command, args []string) {
+				os.Exit(mock.Gemini(args, os.Stdout, os.Stderr))
+			},
+		},
+		&cobra.Command{
+			Use:                beads.NativeCommand,
+			Hidden:             true,
+			DisableFlagParsing: true,
+			Run: func(cmd *cobra.Command, args []string) {
+				os.Exit(beads.Native(".", args, os.Stdout, os.Stderr))
+			},
+		},
+		// How bootstrap/ scripts build their directive, not for people
+		directiveCommand(),
+		// How sandboxed agents are started, not for people
+		&cobra.Command{
+			Use:                agent.SandboxExecCommand + " SOCKET -- COMMAND [ARGS...]",
+			Hidden:             true,
+			DisableFlagParsing: true,
+			Run: func(cmd *cobra.Command, args []string) {
+				code, err := agent.SandboxExec(args)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				}
+				os.Exit(code)
+			},
+		},
+	)
+	return root
+}
+
+// projectFlag adds --project, completed with the IDs of existing projects.
+// An empty default picks the only project there is.
+func projectFlag(cmd *cobra.Command, projectID *string, def string) {
+	usage := "project ID"
+	if def == "" {
+		usage += " (default: the only project)"
+	}
+	cmd.Flags().StringVar(projectID, "project", def, usage)
+	cmd.RegisterFlagCompletionFunc("project", completeProjects)
+}
+
+// seedFlagVar adds --seed.
+func seedFlagVar(cmd *cobra.Command, value *string) {
+	cmd.Flags().StringVar(value, "seed", "", "seed for randomized decisions, to reproduce a run (default: random)")
+}
+
+// completeProjects completes project IDs from MACHINATOR_DIR/projects.
+func completeProjects(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	entries, _ := os.ReadDir(filepath.Join(config.Dir(), "projects"))
+	var ids []string
+	for _, e := range entries {
+		if e.IsDir() && strings.HasPrefix(e.Name(), toComplete) {
+			ids = append(ids, e.Name())
+		}
+	}
+	return ids, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeProfiles completes profile names from the registry.
+func completeProfiles(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	profiles, err := config.LoadProfiles()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	var names []string
+	for _, name := range profiles.Names() {
+		if strings.HasPrefix(name, toComplete) {
+			names = append(names, name)
+		}
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeBarred completes the IDs of barred tasks.
+func completeBarred(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	st, err := state.Load(config.Dir())
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	defer st.Close()
+	var ids []string
+	for _, id := range st.BarredTasksSnapshot() {
+		if strings.HasPrefix(id, toComplete) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, cobra.ShellCompDirectiveNoFileComp
+}
+
+func runCommand() *cobra.Command {
+	var projectID, apiListen, seedValue, maxDuration, summaryPath string
+	var headless, dry, showDirective, noQuotaCheck, useMock, ciGitHub bool
+	var budget runBudget
+	cmd := &cobra.Command{
+		Use:   "run",
+		Short: "Run the orchestrator",
+		Long: `Run the orchestrator with the TUI, or without it with --headless.
+
+With --dry-run nothing is launched: it prints what each agent would be
+given (--show-directive for the full directive).
+
+With --mock it runs a demo project in MACHINATOR_DIR/mock, made fresh each
+time, with a mock gemini and bd in place of the real ones: no accounts,
+quota or repository needed, and nothing outside that directory touched.
+
+--max-tasks, --max-tokens and --max-duration bound the run, e.g. for a
+scheduled CI job. Once the tasks or tokens are used up no new tasks start
+and the run exits when the running ones finish; at --max-duration it exits
+right away, and tasks it stops are picked up by the next run.
+
+--batch N starts at most N tasks, spread across the agents, and exits once
+they've finished (or sooner when no task is left), printing how each one
+ended. It exits non-zero if any didn't complete, e.g. for a nightly cron
+job.
+
+Headless and --batch runs write what they did to MACHINATOR_DIR/run-summary.json
+as they exit (tasks attempted, completed and failed, each run's duration and
+tokens, task branches created), or to --summary-path.
+
+--ci-github runs as a step of a GitHub Actions job: it works on the job's
+repository and branch (from GITHUB_REPOSITORY and GITHUB_REF_NAME, or
+GITHUB_BASE_REF), authenticating with GITHUB_TOKEN, which the workflow must
+pass. Each completed task is pushed to its own branch with a pull request
+opened for it, and the summary is added to the job's page. It's headless,
+and bounded by --batch 5 and --max-duration 5h30m unless told otherwise.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if useMock {
+				if projectID != "" {
+					fmt.Fprintln(os.Stderr, "Error: --mock runs its own project; drop --project")
+					os.Exit(1)
+				}
+				projectID = mockEnv()
+			}
+			var jobSummary string
+			if ciGitHub {
+				if useMock {
+					fmt.Fprintln(os.Stderr, "Error: --ci-github and --mock can't be combined")
+					os.Exit(1)
+				}
+				projectID, jobSummary = ciGitHubEnv(projectID)
+				headless = true
+			}
+			if dry {
+				dryRun(projectID, showDirective, noQuotaCheck, seedFlag(seedValue))
+				return
+			}
+			if maxDuration != "" {
+				d, err := time.ParseDuration(maxDuration)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Invalid --max-duration: %v\n", err)
+					os.Exit(1)
+				}
+				budget.maxDuration = d
+			}
+			if ciGitHub {
+				if budget.batch == 0 && budget.maxTasks == 0 {
+					budget.batch = ciDefaultBatch
+				}
+				if budget.maxDuration == 0 {
+					budget.maxDuration = ciDefaultDuration
+				}
+			}
+			runCmd(projectID, headless, apiListen, seedFlag(seedValue), budget, summaryPath, jobSummary)
+		},
+	}
+	projectFlag(cmd, &projectID, "")
+	seedFlagVar(cmd, &seedValue)
+	cmd.Flags().BoolVar(&headless, "headless", false, "run without the TUI until interrupted")
+	cmd.Flags().StringVar(&apiListen, "api", "", "serve the HTTP control API on this address (default: from config)")
+	cmd.Flags().BoolVar(&dry, "dry-run", false, "print what would launch instead of running")
+	cmd.Flags().BoolVar(&showDirective, "show-directive", false, "with --dry-run, print each directive in full")
+	cmd.Flags().BoolVar(&noQuotaCheck, "no-quota-check", false, "with --dry-run, assume full quota")
+	cmd.Flags().BoolVar(&useMock, "mock", false, "run a demo project with a mock gemini and bd")
+	cmd.Flags().Int64Var(&budget.maxTasks, "max-tasks", 0, "exit once this many tasks are completed (default: no limit)")
+	cmd.Flags().Int64Var(&budget.maxTokens, "max-tokens", 0, "exit once runs have used this many tokens (default: no limit)")
+	cmd.Flags().StringVar(&maxDuration, "max-duration", "", "exit after this long, e.g. 2h (default: no limit)")
+	cmd.Flags().StringVar(&summaryPath, "summary-path", "", "write the run summary JSON here (default: MACHINATOR_DIR/run-summary.json for headless and --batch runs)")
+	cmd.Flags().BoolVar(&ciGitHub, "ci-github", false, "run as a GitHub Actions step, opening a pull request per completed task")
+	cmd.Flags().Int64Var(&budget.batch, "batch", 0, "start at most this many tasks, then exit with a summary once they finish")
+	return cmd
+}
+
+func daemonCommand() *cobra.Command {
+	var projectID, seedValue string
+	var detach bool
+	cmd := &cobra.Command{
+		Use:   "daemon",
+		Short: "Run the orchestrator in the background",
+		Long:  "Run the orchestrator without a UI, controlled over a unix socket with 'machinator ctl'.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			daemonCmd(projectID, detach, seedFlag(seedValue))
+		},
+	}
+	projectFlag(cmd, &projectID, "")
+	seedFlagVar(cmd, &seedValue)
+	cmd.Flags().BoolVar(&detach, "detach", false, "start in a new session, logging to logs/daemon.log, and return")
+	return cmd
+}
+
+func ctlCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ctl",
+		Short: "Control a running daemon",
+	}
+	for _, sub := range []struct{ name, short string }{
+		{"status", "Show assignment state and agents"},
+		{"pause", "Pause task assignment"},
+		{"resume", "Resume task assignment"},
+		{"add-agent", "Add an agent"},
+	} {
+		cmd.AddCommand(&cobra.Command{
+			Use:   sub.name,
+			Short: sub.short,
+			Args:  cobra.NoArgs,
+			Run:   func(cmd *cobra.Command, args []string) { ctlCmd(sub.name, "", false) },
+		})
+	}
+
+	var source string
+	var follow bool
+	logs := &cobra.Command{
+		Use:   "logs",
+		Short: "Print the daemon's log",
+		Args:  cobra.NoArgs,
+		Run:   func(cmd *cobra.Command, args []string) { ctlCmd("logs", source, follow) },
+	}
+	logs.Flags().StringVar(&source, "source", "main", "log source, e.g. main, assign or agent-1")
+	logs.Flags().BoolVarP(&follow, "follow", "f", false, "keep printing new lines")
+	cmd.AddCommand(logs)
+	return cmd
+}
+
+func triggerCommand() *cobra.Command {
+	var addr, token string
+	cmd := &cobra.Command{
+		Use:   "trigger",
+		Short: "Wake a running orchestrator's assigner to look for new tasks",
+		Long: `Refresh a running orchestrator's tasks and wake its assigner, instead of
+waiting for its next poll. Talks to the daemon's socket if there is one,
+else to the HTTP API at --api (default api.listen) with an admin token.`,
+		Args: cobra.NoArgs,
+		Run:  func(cmd *cobra.Command, args []string) { triggerCmd(addr, token) },
+	}
+	cmd.Flags().StringVar(&addr, "api", "", "HTTP API address, e.g. 127.0.0.1:8420 (default api.listen)")
+	cmd.Flags().StringVar(&token, "token", os.Getenv("MACHINATOR_API_TOKEN"), "admin API token (default $MACHINATOR_API_TOKEN)")
+	return cmd
+}
+
+func setupCommand() *cobra.Command {
+	var projectID, repoURL, branch string
+	var buildGemini bool
+	cmd := &cobra.Command{
+		Use:   "setup",
+		Short: "Setup project (clone repo, build gemini CLI)",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			setupCmd(projectID, repoURL, branch, buildGemini)
+		},
+	}
+	projectFlag(cmd, &projectID, "1")
+	cmd.Flags().StringVar(&repoURL, "repo", "", "clone or update this repo for the project")
+	cmd.Flags().StringVar(&branch, "branch", "main", "branch to clone")
+	cmd.Flags().BoolVar(&buildGemini, "build-gemini", false, "build the gemini CLI")
+	return cmd
+}
+
+func projectCommand() *cobra.Command {
+	var projectID, repo, branch string
+	var create, edit, scaffold bool
+	cmd := &cobra.Command{
+		Use:   "project",
+		Short: "List/create/show project configs",
+		Long: `List projects, or show the one given with --project.
+
+--create writes a new project config for --repo; --edit opens one in
+$EDITOR, from a documented template if it doesn't exist yet.
+
+--scaffold (with --create, or for an existing project) adds a .machinator/
+directory to the project's clone: directive.tmpl, verify.sh and
+sandbox.json, to edit and commit so they're versioned with the code.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if (create || edit || scaffold) && projectID == "" {
+				projectID = "1"
+			}
+			if create || !scaffold {
+				projectCmd(projectID, create, edit, repo, branch)
+			}
+			if scaffold {
+				scaffoldCmd(projectID)
+			}
+		},
+	}
+	cmd.Flags().StringVar(&projectID, "project", "", "project ID (default: list all, or 1 with --create/--edit/--scaffold)")
+	cmd.RegisterFlagCompletionFunc("project", completeProjects)
+	cmd.Flags().BoolVar(&create, "create", false, "create a project for --repo")
+	cmd.Flags().BoolVar(&edit, "edit", false, "edit the project's config in $EDITOR")
+	cmd.Flags().BoolVar(&scaffold, "scaffold", false, "add .machinator/ templates to the project's repo")
+	cmd.Flags().StringVar(&repo, "repo", "", "with --create, the repo URL")
+	cmd.Flags().StringVar(&branch, "branch", "main", "with --create, the branch to track")
+	return cmd
+}
+
+func profileCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "profile",
+		Short: "Manage named MACHINATOR_DIRs",
+		Long: `Profiles name separate machinator homes, e.g. "work" and "personal",
+each with its own config, accounts, projects and state. Pick one with
+--profile/-P or MACHINATOR_PROFILE; the registry is kept in
+` + config.ProfilesPath() + `.`,
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List profiles, marking the active one",
+		Args:  cobra.NoArgs,
+		Run:   func(cmd *cobra.Command, args []string) { profileListCmd() },
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "add NAME DIR",
+		Short: "Add or change a profile",
+		Args:  cobra.ExactArgs(2),
+		Run:   func(cmd *cobra.Command, args []string) { profileAddCmd(args[0], args[1]) },
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:               "remove NAME",
+		Short:             "Remove a profile (its directory is kept)",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeProfiles,
+		Run:               func(cmd *cobra.Command, args []string) { profileRemoveCmd(args[0]) },
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:               "default [NAME]",
+		Short:             "Use a profile when none is given (no NAME: back to ~/.machinator)",
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completeProfiles,
+		Run: func(cmd *cobra.Command, args []string) {
+			name := ""
+			if len(args) > 0 {
+				name = args[0]
+			}
+			profileDefaultCmd(name)
+		},
+	})
+	return cmd
+}
+
+func selectTaskCommand() *cobra.Command {
+	var projectID, seedValue string
+	var noQuotaCheck bool
+	cmd := &cobra.Command{
+		Use:   "select-task",
+		Short: "Show what task would be selected",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			selectTaskCmd(projectID, noQuotaCheck, seedFlag(seedValue))
+		},
+	}
+	projectFlag(cmd, &projectID, "")
+	seedFlagVar(cmd, &seedValue)
+	cmd.Flags().BoolVar(&noQuotaCheck, "no-quota-check", false, "assume full quota")
+	return cmd
+}
+
+func forgeCommand() *cobra.Command {
+	var projectID string
+	cmd := &cobra.Command{
+		Use:   "forge",
+		Short: "Show the project's code host and CI status",
+		Args:  cobra.NoArgs,
+		Run:   func(cmd *cobra.Command, args []string) { forgeCmd(projectID) },
+	}
+	projectFlag(cmd, &projectID, "1")
+	return cmd
+}
+
+func graphCommand() *cobra.Command {
+	var projectID string
+	var dot bool
+	cmd := &cobra.Command{
+		Use:   "graph",
+		Short: "Show tasks blocking the most work",
+		Args:  cobra.NoArgs,
+		Run:   func(cmd *cobra.Command, args []string) { graphCmd(projectID, dot) },
+	}
+	projectFlag(cmd, &projectID, "")
+	cmd.Flags().BoolVar(&dot, "dot", false, "print the whole graph for Graphviz")
+	return cmd
+}
+
+func replayCommand() *cobra.Command {
+	var speed float64
+	var instant bool
+	cmd := &cobra.Command{
+		Use:   "replay TASK",
+		Short: "Play back a task's recorded agent events",
+		Args:  cobra.ExactArgs(1),
+		Run:   func(cmd *cobra.Command, args []string) { replayCmd(args[0], speed, instant) },
+	}
+	cmd.Flags().Float64Var(&speed, "speed", 1, "playback speed")
+	cmd.Flags().BoolVar(&instant, "instant", false, "print every event without pausing")
+	return cmd
+}
+
+func directiveCommand() *cobra.Command {
+	var agentName, taskContext string
+	cmd := &cobra.Command{
+		Use:    "directive TASK",
+		Short:  "Print the built-in directive for a task in the current repo",
+		Hidden: true,
+		Args:   cobra.ExactArgs(1),
+		Run:    func(cmd *cobra.Command, args []string) { directiveCmd(args[0], agentName, taskContext) },
+	}
+	cmd.Flags().StringVar(&agentName, "agent", "Machinator Agent", "agent name")
+	cmd.Flags().StringVar(&taskContext, "context", "", "task description")
+	return cmd
+}
+
+func pinsCommand() *cobra.Command {
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:   "pins",
+		Short: "List events pinned in the TUI",
+		Args:  cobra.NoArgs,
+		Run:   func(cmd *cobra.Command, args []string) { pinsCmd(asJSON) },
+	}
+	cmd.Flags().BoolVar(&asJSON, "json", false, "print JSON")
+	return cmd
+}
+
+func statusCommand() *cobra.Command {
+	var projectID string
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show agents, running tasks, quota and ready tasks",
+		Long: `Show agents, running tasks and how long they've run, the last quota
+reading and the tasks ready to assign, from the persisted state. Works
+whether or not machinator is running.`,
+		Args: cobra.NoArgs,
+		Run:  func(cmd *cobra.Command, args []string) { statusCmd(projectID, asJSON) },
+	}
+	projectFlag(cmd, &projectID, "")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "print JSON")
+	return cmd
+}
+
+func configCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Show or check configuration",
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "schema",
+		Short: "Print the documented config.json schema",
+		Args:  cobra.NoArgs,
+		Run:   func(cmd *cobra.Command, args []string) { fmt.Print(config.Template()) },
+	})
+	var projectID string
+	validate := &cobra.Command{
+		Use:   "validate",
+		Short: "Check config.json, environment, --set and project configs",
+		Long: `Check configuration the way run loads it: config.json, environment
+variables, --set overrides, and each project's config with its "settings"
+applied over the global config. Prints every error and warning; exits 1
+on errors.`,
+		Args: cobra.NoArgs,
+		Run:  func(cmd *cobra.Command, args []string) { configValidateCmd(projectID) },
+	}
+	validate.Flags().StringVar(&projectID, "project", "", "check only this project (default: all)")
+	validate.RegisterFlagCompletionFunc("project", completeProjects)
+	cmd.AddCommand(validate)
+	return cmd
+}
+
+func doctorCommand() *cobra.Command {
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check tools, the gemini wrapper, accounts and disk space",
+		Long: `Check that node, npm, git and bd are installed, that the gemini wrapper
+runs, that every account is signed in and that MACHINATOR_DIR has the
+free space safeguards.min_free_disk_mb asks for. Exits 1 if any check
+fails.`,
+		Args: cobra.NoArgs,
+		Run:  func(cmd *cobra.Command, args []string) { doctorCmd(asJSON) },
+	}
+	cmd.Flags().BoolVar(&asJSON, "json", false, "print JSON")
+	return cmd
+}
+
+func indexCommand() *cobra.Command {
+	var projectID, query string
+	cmd := &cobra.Command{
+		Use:   "index",
+		Short: "Update the code index for context_index",
+		Args:  cobra.NoArgs,
+		Run:   func(cmd *cobra.Command, args []string) { indexCmd(projectID, query) },
+	}
+	projectFlag(cmd, &projectID, "1")
+	cmd.Flags().StringVar(&query, "query", "", "show the code a task with this text would be given")
+	return cmd
+}
+
+func taskCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "task",
+		Short: "Bar, unbar or split tasks",
+	}
+
+	var reason string
+	bar := &cobra.Command{
+		Use:   "bar ID",
+		Short: "Keep a task from being assigned",
+		Args:  cobra.ExactArgs(1),
+		Run:   func(cmd *cobra.Command, args []string) { barCmd("bar", args[0], reason) },
+	}
+	bar.Flags().StringVar(&reason, "reason", "", "why, shown with the barred tasks")
+
+	unbar := &cobra.Command{
+		Use:               "unbar ID",
+		Short:             "Let a barred task be assigned again",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeBarred,
+		Run:               func(cmd *cobra.Command, args []string) { barCmd("unbar", args[0], "") },
+	}
+
+	barred := &cobra.Command{
+		Use:   "barred",
+		Short: "List barred tasks and why",
+		Args:  cobra.NoArgs,
+		Run:   func(cmd *cobra.Command, args []string) { barredCmd() },
+	}
+
+	var projectID string
+	var files []string
+	split := &cobra.Command{
+		Use:   "split ID",
+		Short: "Keep part of a task's failed attempt",
+		Long: `Commit the changes a task's last failed attempt made to --files under a
+new, closed task, and unbar the task with a note of what is done. Without
+--files, list what the attempt changed.`,
+		Args: cobra.ExactArgs(1),
+		Run:  func(cmd *cobra.Command, args []string) { splitCmd(projectID, args[0], files) },
+	}
+	projectFlag(split, &projectID, "1")
+	split.Flags().StringSliceVar(&files, "files", nil, "files whose changes to keep, comma-separated")
+
+	cmd.AddCommand(bar, unbar, barred, split)
+	return cmd
+}
+
+func pruneBranchesCommand() *cobra.Command {
+	var projectID, olderThan string
+	var dry bool
+	cmd := &cobra.Command{
+		Use:   "prune-branches",
+		Short: "Delete merged task branches of closed tasks from origin",
+		Args:  cobra.NoArgs,
+		Run:   func(cmd *cobra.Command, args []string) { pruneBranchesCmd(projectID, olderThan, dry) },
+	}
+	projectFlag(cmd, &projectID, "1")
+	cmd.Flags().StringVar(&olderThan, "older-than", "", "prune branches untouched this long (default: merge.prune_after)")
+	cmd.Flags().BoolVar(&dry, "dry-run", false, "list the branches instead of deleting them")
+	return cmd
+}
+
+func gcCommand() *cobra.Command {
+	var projectID, olderThan string
+	var dry bool
+	cmd := &cobra.Command{
+		Use:   "gc",
+		Short: "Remove worktrees, scratch space and task branches finished work left behind",
+		Long: `Remove what finished work leaves behind in a project and report the disk
+space reclaimed:
+
+  - worktrees of agents that no longer exist
+  - scratch space of tasks that are closed or gone
+  - task branches, in the clone and on origin, of tasks that are closed or
+    gone and untouched for --older-than, whether merged or abandoned
+
+Tasks assigned to an agent are left alone.`,
+		Args: cobra.NoArgs,
+		Run:  func(cmd *cobra.Command, args []string) { gcCmd(projectID, olderThan, dry) },
+	}
+	projectFlag(cmd, &projectID, "1")
+	cmd.Flags().StringVar(&olderThan, "older-than", "", "delete task branches untouched this long (default 168h)")
+	cmd.Flags().BoolVar(&dry, "dry-run", false, "list what would be removed instead of removing it")
+	return cmd
+}
+
+func duCommand() *cobra.Command {
+	var projectID string
+	cmd := &cobra.Command{
+		Use:   "du",
+		Short: "Show the disk space projects take",
+		Long: `Show the disk space each project takes, broken down into its clone,
+extra repos, each agent's worktree, scratch space and checkpoints, then
+the logs, transcripts and gemini build all projects share.`,
+		Args: cobra.NoArgs,
+		Run:  func(cmd *cobra.Command, args []string) { duCmd(projectID) },
+	}
+	cmd.Flags().StringVar(&projectID, "project", "", "show only this project (default: all)")
+	cmd.RegisterFlagCompletionFunc("project", completeProjects)
+	return cmd
+}
+
+func orphansCommand() *cobra.Command {
+	var projectID string
+	var kill bool
+	cmd := &cobra.Command{
+		Use:   "orphans",
+		Short: "List (or --kill) agents and git locks left by a run that didn't shut down",
+		Long: `List the agents a run that didn't shut down cleanly left running, with
+everything they started, and the git locks left in the project's clones.
+
+With --kill they're stopped and the locks removed, except one under two
+minutes old or where git is still running. The next run does the
+same after showing what it found, so this is for cleaning up without
+starting one.`,
+		Args: cobra.NoArgs,
+		Run:  func(cmd *cobra.Command, args []string) { orphansCmd(projectID, kill) },
+	}
+	projectFlag(cmd, &projectID, "1")
+	cmd.Flags().BoolVar(&kill, "kill", false, "stop them and remove the locks")
+	return cmd
+}
+
+func flagsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "flags",
+		Short: "List/enable/disable experimental feature flags",
+		Args:  cobra.NoArgs,
+		Run:   func(cmd *cobra.Command, args []string) { flagsListCmd() },
+	}
+	completeFlags := func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		var names []string
+		for _, f := range config.Flags {
+			if len(args) == 0 && strings.HasPrefix(f.Name, toComplete) {
+				names = append(names, f.Name)
+			}
+		}
+		return names, cobra.ShellCompDirectiveNoFileComp
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List feature flags and whether they're on",
+		Args:  cobra.NoArgs,
+		Run:   func(cmd *cobra.Command, args []string) { flagsListCmd() },
+	})
+	for _, enable := range []bool{true, false} {
+		name := "disable"
+		if enable {
+			name = "enable"
+		}
+		cmd.AddCommand(&cobra.Command{
+			Use:               name + " NAME",
+			Short:             strings.ToUpper(name[:1]) + name[1:] + " a feature flag",
+			Args:              cobra.ExactArgs(1),
+			ValidArgsFunction: completeFlags,
+			Run:               func(cmd *cobra.Command, args []string) { flagsSetCmd(args[0], enable) },
+		})
+	}
+	return cmd
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bryantinsley/machinator/backend/internal/config"
+	"github.com/bryantinsley/machinator/backend/internal/project"
+)
+
+// configValidateCmd checks config.json, the environment, --set and each
+// project's config (or just projectID's) the way run loads them, prints
+// every problem and exits 1 on errors.
+func configValidateCmd(projectID string) {
+	failed := false
+	report := func(source string, warnings []config.Issue, err error) {
+		for _, w := range warnings {
+			fmt.Printf("warning: %s\n", w)
+		}
+		if err == nil {
+			return
+		}
+		failed = true
+		if se, ok := err.(*config.SchemaError); ok {
+			for _, issue := range se.Issues {
+				fmt.Printf("error: %s\n", issue)
+			}
+			return
+		}
+		fmt.Printf("error: %s: %v\n", source, err)
+	}
+
+	for _, v := range config.EnvVars {
+		if value, ok := v.Value(); ok {
+			report(v.Name, nil, v.Check(value))
+		}
+	}
+
+	cfg, err := config.Load()
+	globalOK := err == nil
+	if err != nil {
+		report(config.ConfigPath(), nil, err)
+	} else {
+		report(config.ConfigPath(), cfg.Warnings, nil)
+	}
+
+	var ids []string
+	if projectID != "" {
+		ids = []string{projectID}
+	} else {
+		entries, _ := os.ReadDir(filepath.Join(config.Dir(), "projects"))
+		for _, e := range entries {
+			if e.IsDir() {
+				ids = append(ids, e.Name())
+			}
+		}
+	}
+	for _, id := range ids {
+		path := project.ConfigPath(config.Dir(), id)
+		projCfg, err := project.Load(config.Dir(), id)
+		if err != nil {
+			report(path, nil, err)
+			continue
+		}
+		report(path, projCfg.Warnings, nil)
+		if !globalOK {
+			continue
+		}
+
+		// The project's "settings" over the global config. Issues from
+		// config.json were reported above.
+		projected, err := config.LoadFor(path)
+		if err != nil {
+			report(path, nil, err)
+			continue
+		}
+		var own []config.Issue
+		for _, w := range projected.Warnings {
+			if w.File == path {
+				own = append(own, w)
+			}
+		}
+		report(path, own, nil)
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+	fmt.Printf("Config OK (%d projects checked)\n", len(ids))
+}
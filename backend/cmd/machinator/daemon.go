@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/api"
+	"github.com/bryantinsley/machinator/backend/internal/config"
+	"github.com/bryantinsley/machinator/backend/internal/seed"
+	"github.com/bryantinsley/machinator/backend/internal/state"
+)
+
+// daemonCmd runs the orchestrator without a UI, controlled over a unix socket.
+func daemonCmd(projectID string, detach bool, runSeed seed.Seed) {
+	if detach {
+		detachDaemon()
+		return
+	}
+
+	o := startOrchestrator(projectID, false, false, runSeed)
+	defer o.logger.Close()
+	defer o.reportCrash()
+
+	socketPath := api.SocketPath(o.cfg.MachinatorDir)
+	srv := o.newAPIServer(o.cfg.API.Listen)
+	go func() {
+		if err := srv.ServeUnix(socketPath); err != nil {
+			o.logger.Log("main", fmt.Sprintf("[red]Socket error: %v[-]", err))
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}()
+
+	// The TCP API can run alongside the socket
+	if o.cfg.API.Listen != "" {
+		go o.serveAPI(srv, o.cfg.API.Listen)
+	}
+
+	o.logger.Log("main", fmt.Sprintf("Daemon started (pid %d), socket %s", os.Getpid(), socketPath))
+	waitForSignal()
+	o.logger.Log("main", "Daemon shutting down...")
+	os.Remove(socketPath)
+	o.shutdown()
+}
+
+// detachDaemon re-executes the daemon in a new session with output going to
+// logs/daemon.log, then returns.
+func detachDaemon() {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+
+	logsDir := filepath.Join(cfg.MachinatorDir, "logs")
+	if err := os.MkdirAll(logsDir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating logs dir: %v\n", err)
+		os.Exit(1)
+	}
+	out, err := os.OpenFile(filepath.Join(logsDir, "daemon.log"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening daemon log: %v\n", err)
+		os.Exit(1)
+	}
+	defer out.Close()
+
+	var args []string
+	for _, arg := range os.Args[1:] {
+		if arg != "--detach" && arg != "--detach=true" {
+			args = append(args, arg)
+		}
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error locating executable: %v\n", err)
+		os.Exit(1)
+	}
+	cmd := exec.Command(exe, args...)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error starting daemon: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Daemon started (pid %d)\n", cmd.Process.Pid)
+}
+
+// ctlCmd sends a command to a running daemon. source and follow are the
+// logs command's.
+func ctlCmd(sub, source string, follow bool) {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	client := api.NewClient(api.SocketPath(cfg.MachinatorDir))
+
+	switch sub {
+	case "status":
+		err = ctlStatus(client)
+	case "pause":
+		err = client.Post("/api/pause-assignment", nil)
+		if err == nil {
+			fmt.Println("Assignment paused")
+		}
+	case "resume":
+		err = client.Post("/api/resume-assignment", nil)
+		if err == nil {
+			fmt.Println("Assignment resumed")
+		}
+	case "add-agent":
+		var resp struct {
+			ID int `json:"id"`
+		}
+		err = client.Post("/api/agents", &resp)
+		if err == nil {
+			fmt.Printf("Added agent %d\n", resp.ID)
+		}
+	case "logs":
+		path := "/api/logs?source=" + url.QueryEscape(source)
+		if follow {
+			path += "&follow=true"
+		}
+		err = client.Stream(path, os.Stdout)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown ctl command: %s\n", sub)
+		os.Exit(1)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		if strings.Contains(err.Error(), "connect:") {
+			fmt.Fprintln(os.Stderr, "Is the daemon running? Start it with: machinator daemon --detach")
+		}
+		os.Exit(1)
+	}
+}
+
+// triggerCmd wakes the assigner of the daemon, or failing that of the
+// orchestrator serving the HTTP API at addr.
+func triggerCmd(addr, token string) {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	if addr == "" {
+		err = api.NewClient(api.SocketPath(cfg.MachinatorDir)).Post("/api/trigger", nil)
+		if err != nil && strings.Contains(err.Error(), "connect:") {
+			addr = cfg.API.Listen // No daemon; try the API
+		}
+	}
+	if addr != "" {
+		err = api.NewHTTPClient(addr, token).Post("/api/trigger", nil)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		if strings.Contains(err.Error(), "connect:") {
+			fmt.Fprintln(os.Stderr, "Is machinator running? Start it with: machinator daemon --detach, or run with api.listen set")
+		}
+		os.Exit(1)
+	}
+	fmt.Println("Assigner woken")
+}
+
+func ctlStatus(client *api.Client) error {
+	var agents []state.Agent
+	if err := client.Get("/api/agents", &agents); err != nil {
+		return err
+	}
+	var cfg struct {
+		AssignmentPaused bool `json:"assignment_paused"`
+		LaunchesPaused   bool `json:"launches_paused"`
+	}
+	if err := client.Get("/api/config", &cfg); err != nil {
+		return err
+	}
+
+	status := "running"
+	if cfg.AssignmentPaused {
+		status = "paused"
+	}
+	if cfg.LaunchesPaused {
+		status += " (launches paused)"
+	}
+	fmt.Printf("Assignment: %s\n", status)
+	fmt.Printf("Agents (%d):\n", len(agents))
+	for _, a := range agents {
+		line := fmt.Sprintf("  %d: %s", a.ID, a.State)
+		if a.TaskID != "" {
+			line += " " + a.TaskID
+		}
+		if a.State == "assigned" && !a.StartedAt.IsZero() {
+			line += fmt.Sprintf(" (%s)", time.Since(a.StartedAt).Round(time.Second))
+		}
+		fmt.Println(line)
+	}
+	return nil
+}
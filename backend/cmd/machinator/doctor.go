@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/config"
+	"github.com/bryantinsley/machinator/backend/internal/quota"
+	"github.com/bryantinsley/machinator/backend/internal/safeguard"
+	"github.com/bryantinsley/machinator/backend/internal/tools"
+)
+
+// minNodeMajor is the oldest Node.js gemini-cli runs on.
+const minNodeMajor = 20
+
+// doctorTimeout bounds each command doctor runs, so a hung tool fails its
+// check instead of the whole report.
+const doctorTimeout = 30 * time.Second
+
+// doctorCheck is one line of the doctor report.
+type doctorCheck struct {
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Version string `json:"version,omitempty"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// doctorReport is what machinator doctor --json prints.
+type doctorReport struct {
+	OK     bool          `json:"ok"`
+	Checks []doctorCheck `json:"checks"`
+}
+
+// doctorCmd checks that everything agents need is in place and exits
+// non-zero if anything isn't.
+func doctorCmd(asJSON bool) {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+
+	report := doctorReport{OK: true}
+	report.Checks = append(report.Checks, checkNode())
+	report.Checks = append(report.Checks, checkTool("npm"))
+	report.Checks = append(report.Checks, checkVersion(tools.Git, tools.MinGit, "agent worktrees"))
+	report.Checks = append(report.Checks, checkBd())
+	report.Checks = append(report.Checks, checkGemini(cfg.MachinatorDir))
+	report.Checks = append(report.Checks, checkAccounts(cfg.MachinatorDir)...)
+	report.Checks = append(report.Checks, checkDisk(cfg))
+	for _, c := range report.Checks {
+		report.OK = report.OK && c.OK
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+	} else {
+		for _, c := range report.Checks {
+			status := "ok  "
+			if !c.OK {
+				status = "FAIL"
+			}
+			fmt.Printf("%s  %-20s %s\n", status, c.Name, strings.TrimSpace(c.Version+"  "+c.Detail))
+		}
+	}
+	if !report.OK {
+		os.Exit(1)
+	}
+}
+
+// toolVersion runs a command and returns the first line of its output.
+func toolVersion(name string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	first, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	if err != nil {
+		if first != "" {
+			return "", fmt.Errorf("%w: %s", err, first)
+		}
+		return "", err
+	}
+	return first, nil
+}
+
+// checkTool checks that a tool is on PATH and reports its version.
+func checkTool(name string) doctorCheck {
+	c := doctorCheck{Name: name}
+	if _, err := exec.LookPath(name); err != nil {
+		c.Detail = "not found in PATH"
+		return c
+	}
+	version, err := toolVersion(name, "--version")
+	if err != nil {
+		c.Detail = err.Error()
+		return c
+	}
+	c.OK, c.Version = true, version
+	return c
+}
+
+// checkVersion checks that a tool machinator runs is on PATH and at least
+// min, which feature needs.
+func checkVersion(t tools.Tool, min tools.Version, feature string) doctorCheck {
+	c := checkTool(t.Path())
+	c.Name = t.Name()
+	if !c.OK {
+		return c
+	}
+	if err := tools.Require(t, min, feature); err != nil {
+		c.OK, c.Detail = false, err.Error()
+	}
+	return c
+}
+
+// checkBd checks for bd, which is optional: without it, runs give agents
+// machinator's native bd.
+func checkBd() doctorCheck {
+	c := checkVersion(tools.Bd, tools.MinBd, "--sandbox")
+	if !c.OK && c.Detail == "not found in PATH" {
+		c.OK, c.Detail = true, "not found in PATH; machinator's native bd will be used"
+	}
+	return c
+}
+
+// checkNode checks for Node.js new enough for gemini-cli.
+func checkNode() doctorCheck {
+	c := checkTool("node")
+	if !c.OK {
+		return c
+	}
+	major, err := strconv.Atoi(strings.SplitN(strings.TrimPrefix(c.Version, "v"), ".", 2)[0])
+	if err != nil {
+		c.OK, c.Detail = false, "can't parse version"
+	} else if major < minNodeMajor {
+		c.OK, c.Detail = false, fmt.Sprintf("gemini-cli needs Node.js %d or newer", minNodeMajor)
+	}
+	return c
+}
+
+// checkGemini checks that the gemini wrapper runs.
+func checkGemini(machinatorDir string) doctorCheck {
+	c := doctorCheck{Name: "gemini"}
+	geminiPath := filepath.Join(machinatorDir, "gemini")
+	if _, err := os.Stat(geminiPath); err != nil {
+		c.Detail = "not installed (machinator setup --build-gemini)"
+		return c
+	}
+	version, err := toolVersion(geminiPath, "--version")
+	if err != nil {
+		c.Detail = fmt.Sprintf("wrapper fails: %v", err)
+		return c
+	}
+	c.OK, c.Version = true, version
+	return c
+}
+
+// checkAccounts checks that each account is signed in, by fetching its
+// quota.
+func checkAccounts(machinatorDir string) []doctorCheck {
+	dirs, err := quota.New(machinatorDir).AccountDirs()
+	if err != nil {
+		return []doctorCheck{{Name: "accounts", Detail: err.Error()}}
+	}
+	if len(dirs) == 0 {
+		return []doctorCheck{{Name: "accounts", Detail: "none under " + filepath.Join(machinatorDir, "accounts")}}
+	}
+	var checks []doctorCheck
+	for _, dir := range dirs {
+		c := doctorCheck{Name: "account " + filepath.Base(dir)}
+		ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+		models, err := quota.FetchAccount(ctx, machinatorDir, dir)
+		cancel()
+		if err != nil {
+			c.Detail = fmt.Sprintf("can't fetch quota, not signed in? %v", err)
+		} else {
+			c.OK, c.Detail = true, fmt.Sprintf("signed in, quota for %d models", len(models))
+		}
+		checks = append(checks, c)
+	}
+	return checks
+}
+
+// checkDisk checks the free space under MACHINATOR_DIR against the
+// safeguard minimum.
+func checkDisk(cfg *config.Config) doctorCheck {
+	c := doctorCheck{Name: "disk"}
+	free, err := safeguard.FreeDisk(cfg.MachinatorDir)
+	if err != nil {
+		c.Detail = fmt.Sprintf("check free disk: %v", err)
+		return c
+	}
+	c.Detail = fmt.Sprintf("%d MB free under %s", free>>20, cfg.MachinatorDir)
+	minimum := cfg.Safeguards.MinFreeDiskMB
+	c.OK = minimum == 0 || free >= uint64(minimum)<<20
+	if !c.OK {
+		c.Detail += fmt.Sprintf(" (minimum %d MB)", minimum)
+	}
+	return c
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bryantinsley/machinator/backend/internal/agent"
+	"github.com/bryantinsley/machinator/backend/internal/beads"
+	"github.com/bryantinsley/machinator/backend/internal/config"
+	"github.com/bryantinsley/machinator/backend/internal/directive"
+	"github.com/bryantinsley/machinator/backend/internal/project"
+	"github.com/bryantinsley/machinator/backend/internal/quota"
+	"github.com/bryantinsley/machinator/backend/internal/scheduler"
+	"github.com/bryantinsley/machinator/backend/internal/seed"
+	"github.com/bryantinsley/machinator/backend/internal/setup"
+	"github.com/bryantinsley/machinator/backend/internal/state"
+	"github.com/bryantinsley/machinator/backend/internal/tracker"
+)
+
+// dryRun runs one assigner pass against the current state and prints what
+// each ready agent would execute, without assigning or launching anything.
+func dryRun(projectID string, showDirective, noQuotaCheck bool, runSeed seed.Seed) {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	if projectID == "" {
+		projectID = "1"
+	}
+	projCfg, err := project.Load(cfg.MachinatorDir, projectID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading project: %v\n", err)
+		os.Exit(1)
+	}
+	repoDir := project.RepoDir(cfg.MachinatorDir, projectID)
+
+	st, err := state.Load(cfg.MachinatorDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading state: %v\n", err)
+		os.Exit(1)
+	}
+	defer st.Close()
+
+	ctx, stop := interruptContext()
+	defer stop()
+	q := quota.New(cfg.MachinatorDir)
+	if noQuotaCheck {
+		// Assume full quota on a single placeholder account
+		q.Accounts = []quota.AccountQuota{{
+			Name:    "fake",
+			HomeDir: filepath.Join(cfg.MachinatorDir, "accounts", "fake"),
+			Models: map[string]float64{
+				projCfg.SimpleModelName:  1.0,
+				projCfg.ComplexModelName: 1.0,
+			},
+		}}
+		fmt.Println("(Skipping quota check, assuming full quota)")
+	} else if err := q.Refresh(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "Error refreshing quota: %v\n", err)
+		os.Exit(1)
+	}
+
+	tasks, err := tracker.LoadTasks(projCfg, repoDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading tasks: %v\n", err)
+		os.Exit(1)
+	}
+	readyTasks := beads.ReadyTasks(tasks)
+
+	fmt.Printf("DRY RUN - project %s, %d ready task(s), %d account(s), seed %s\n", projectID, len(readyTasks), len(q.Accounts), runSeed)
+	if st.AssignmentIsPaused() {
+		fmt.Println("Note: assignment is paused; the assigner would not run")
+	}
+	if st.LaunchesArePaused() {
+		fmt.Println("Note: launches are paused; assigned agents would wait")
+	}
+
+	// Agents that would exist after startup
+	agents := st.AgentsSnapshot()
+	if len(agents) == 0 {
+		for i := 1; i <= cfg.DefaultAgentCount; i++ {
+			agents = append(agents, state.Agent{ID: i, State: "pending"})
+		}
+	}
+
+	id, _ := strconv.Atoi(projectID)
+	s := setup.New(cfg.MachinatorDir)
+	rng := runSeed.Stream("assign")
+	running := st.ModelCounts()
+
+	for _, a := range agents {
+		fmt.Printf("\nAgent %d (%s)\n", a.ID, a.State)
+		switch {
+		case a.State == "assigned":
+			fmt.Printf("  busy with %s\n", a.TaskID)
+			continue
+		case a.MarkedForRemoval:
+			fmt.Println("  marked for removal, skipped")
+			continue
+		}
+
+		aq := q.For(projectID, a.ID)
+		simpleQ := aq.TotalFor(projCfg.SimpleModelName)
+		complexQ := aq.TotalFor(projCfg.ComplexModelName)
+		if scheduler.AtModelLimit(projCfg, running, projCfg.SimpleModelName) {
+			simpleQ = 0
+		}
+		if scheduler.AtModelLimit(projCfg, running, projCfg.ComplexModelName) {
+			complexQ = 0
+		}
+		task := scheduler.Select(readyTasks, simpleQ, complexQ, st, rng)
+		if task == nil {
+			fmt.Println("  no assignable task")
+			continue
+		}
+		assigned := scheduler.Model(projCfg, task, simpleQ, complexQ)
+		running[assigned]++
+		readyTasks = scheduler.Remove(readyTasks, task.ID)
+		fmt.Printf("  task:      %s (%s)\n", task.ID, task.Title)
+		if a.State == "pending" {
+			fmt.Println("  (agent needs setup first: clone + worktree)")
+		}
+
+		model, account, reason, err := agent.SelectModelAndAccount(aq, projCfg, task, assigned)
+		if err != nil {
+			fmt.Printf("  would fail: %v\n", err)
+			continue
+		}
+		fmt.Printf("  model:     %s\n", model)
+		fmt.Printf("  account:   %s (%.0f%% left; %s)\n", account.Name, account.Models[model]*100, reason)
+
+		worktreeDir := project.AgentDir(cfg.MachinatorDir, projectID, a.ID)
+		contextDir := worktreeDir
+		if _, err := os.Stat(worktreeDir); err != nil {
+			contextDir = repoDir // Worktree not created yet
+		}
+		scratchDir := project.ScratchDir(cfg.MachinatorDir, projectID, task.ID)
+		data := directiveData(st, projCfg, task, a.ID, project.Dir(cfg.MachinatorDir, projectID), contextDir, scratchDir)
+		if projCfg.ResumeMode == project.ResumeCheckpoint {
+			if diff, err := s.LoadCheckpoint(id, task.ID); err == nil && diff != "" {
+				fmt.Printf("  resume:    checkpoint %s\n", s.CheckpointPath(id, task.ID))
+				data.PreviousChanges = diff
+				data.PreviousReason = "timed out"
+			}
+		}
+		if err := addFailureContext(&data, s, id, task.ID); err != nil {
+			fmt.Printf("  warning:   %v\n", err)
+		} else if data.FailureReason != "" {
+			fmt.Printf("  retry:     previous attempt failed (%s)\n", data.FailureReason)
+		}
+		tmpl, tmplSource, err := directive.LoadTemplate(contextDir, project.Dir(cfg.MachinatorDir, projectID))
+		if err != nil {
+			fmt.Printf("  would fail: %v\n", err)
+			continue
+		}
+		fmt.Printf("  template:  %s\n", tmplSource)
+		prompt, err := directive.Build(tmpl, data)
+		if err != nil {
+			fmt.Printf("  would fail: build directive: %v\n", err)
+			continue
+		}
+
+		cmd := agent.Command(agent.LaunchOptions{
+			MachinatorDir: cfg.MachinatorDir,
+			AgentID:       a.ID,
+			WorktreeDir:   worktreeDir,
+			Model:         model,
+			Account:       account,
+			Directive:     prompt,
+			ScratchDir:    scratchDir,
+			Scope:         projCfg.Scope,
+			DockerImage:   projCfg.Docker.Image,
+		})
+		args := append([]string{}, cmd.Args[:len(cmd.Args)-1]...)
+		args = append(args, fmt.Sprintf("<directive: %d bytes>", len(prompt)))
+		fmt.Printf("  dir:       %s\n", cmd.Dir)
+		fmt.Printf("  command:   %s\n", strings.Join(args, " "))
+		fmt.Printf("  env:       HOME=%s MACHINATOR_SCRATCH_DIR=%s\n", account.HomeDir, scratchDir)
+		fmt.Printf("  log:       %s\n", agent.LogPath(cfg.MachinatorDir, a.ID))
+
+		if showDirective {
+			fmt.Println("  directive:")
+			for _, line := range strings.Split(prompt, "\n") {
+				fmt.Println("    | " + line)
+			}
+		}
+	}
+
+	if len(readyTasks) > 0 {
+		fmt.Printf("\n%d ready task(s) left unassigned\n", len(readyTasks))
+	}
+	fmt.Println("\nNothing was assigned or launched.")
+}
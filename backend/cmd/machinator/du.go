@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/bryantinsley/machinator/backend/internal/config"
+	"github.com/bryantinsley/machinator/backend/internal/project"
+	"github.com/bryantinsley/machinator/backend/internal/setup"
+	"github.com/bryantinsley/machinator/backend/internal/transcript"
+)
+
+// duCmd prints the disk space projectID's directory takes by part, or every
+// project's if projectID is empty, then the space shared by all projects.
+func duCmd(projectID string) {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+
+	var ids []string
+	if projectID != "" {
+		ids = []string{projectID}
+	} else {
+		entries, _ := os.ReadDir(filepath.Join(cfg.MachinatorDir, "projects"))
+		for _, e := range entries {
+			if e.IsDir() {
+				ids = append(ids, e.Name())
+			}
+		}
+	}
+
+	line := func(what string, size int64) { fmt.Printf("  %-20s %10s\n", what, setup.FormatSize(size)) }
+	var total int64
+	for _, id := range ids {
+		u, err := setup.MeasureProject(project.Dir(cfg.MachinatorDir, id))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error measuring project %s: %v\n", id, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Project %s\n", id)
+		line("repo", u.Repo)
+		if u.ExtraRepos > 0 {
+			line("extra repos", u.ExtraRepos)
+		}
+		agents := make([]int, 0, len(u.Worktrees))
+		for agentID := range u.Worktrees {
+			agents = append(agents, agentID)
+		}
+		sort.Ints(agents)
+		for _, agentID := range agents {
+			line(fmt.Sprintf("worktree (agent %d)", agentID), u.Worktrees[agentID])
+		}
+		line("scratch", u.Scratch)
+		line("checkpoints", u.Checkpoints)
+		if u.Other > 0 {
+			line("other", u.Other)
+		}
+		line("total", u.Total())
+		fmt.Println()
+		total += u.Total()
+	}
+
+	fmt.Println("Shared")
+	for _, part := range []struct{ what, path string }{
+		{"logs", filepath.Join(cfg.MachinatorDir, "logs")},
+		{"transcripts", transcript.Dir(cfg.MachinatorDir)},
+		{"gemini build", filepath.Join(cfg.MachinatorDir, "resources")},
+	} {
+		size, err := setup.DirSize(part.path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error measuring %s: %v\n", part.path, err)
+			os.Exit(1)
+		}
+		line(part.what, size)
+		total += size
+	}
+	fmt.Println()
+	fmt.Printf("Total %s\n", setup.FormatSize(total))
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/agent"
+	"github.com/bryantinsley/machinator/backend/internal/beads"
+	"github.com/bryantinsley/machinator/backend/internal/config"
+	"github.com/bryantinsley/machinator/backend/internal/project"
+	"github.com/bryantinsley/machinator/backend/internal/quota"
+	"github.com/bryantinsley/machinator/backend/internal/state"
+	"github.com/bryantinsley/machinator/backend/internal/tracker"
+	"github.com/bryantinsley/machinator/backend/internal/tui"
+)
+
+// estimator tags open tasks that have no CHALLENGE tag, one at a time, and
+// writes the tag back to the task backend with the reason for it. The
+// project's complexity rules are applied first; a task none of them makes
+// complex is left to the simple model to judge when estimate_complexity is
+// on, and tagged simple otherwise. Each task is tried once per run; one that
+// can't be estimated is left to the default (simple) routing.
+func estimator(st *state.State, q *quota.Quota, cfg *config.Config, projCfg *project.Config, projectID, repoDir string, logger tui.Logger) {
+	tried := make(map[string]bool)
+	for {
+		time.Sleep(cfg.Intervals.Assigner.Duration())
+		if st.AssignmentIsPaused() {
+			continue // Don't spend quota while paused
+		}
+
+		tasks, err := tracker.LoadTasks(projCfg, repoDir)
+		if err != nil {
+			continue // The assigner reports load errors
+		}
+		var task *beads.Task
+		for _, t := range tasks {
+			if t.Status != "closed" && t.Status != "in_progress" && !beads.Tagged(t) && !tried[t.ID] {
+				task = t
+				break
+			}
+		}
+		if task == nil {
+			continue
+		}
+		tried[task.ID] = true
+
+		tag, reason := agent.Classify(projCfg.Complexity, task)
+		switch {
+		case tag != "":
+		case projCfg.EstimateComplexity:
+			model, account, _, err := agent.SelectModelAndAccount(q.For(projectID, 0), projCfg, task, projCfg.SimpleModelName)
+			if err != nil {
+				tried[task.ID] = false // Try again when there's quota
+				continue
+			}
+			if tag, err = agent.Estimate(cfg.MachinatorDir, model, account, task); err != nil {
+				logger.Log("estimate", fmt.Sprintf("[yellow]%s: %v[-]", task.ID, err))
+				continue
+			}
+			reason = "estimated by " + model
+		default:
+			tag, reason = beads.SimpleTag, "no complexity rule matched"
+		}
+		note := fmt.Sprintf("%s (%s)", tag, reason)
+		if err := tracker.Tag(projCfg, repoDir, task, note); err != nil {
+			logger.Log("estimate", fmt.Sprintf("[red]%s: write %s: %v[-]", task.ID, tag, err))
+			continue
+		}
+		logger.Log("estimate", fmt.Sprintf("%s: %s, %s (%s)", task.ID, tag, reason, task.Title))
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bryantinsley/machinator/backend/internal/beads"
+	"github.com/bryantinsley/machinator/backend/internal/config"
+	"github.com/bryantinsley/machinator/backend/internal/forge"
+	"github.com/bryantinsley/machinator/backend/internal/project"
+	"github.com/bryantinsley/machinator/backend/internal/setup"
+	"github.com/bryantinsley/machinator/backend/internal/tools"
+)
+
+// projectForge returns the forge hosting a project's repo.
+func projectForge(projCfg *project.Config) (forge.Forge, error) {
+	return forge.New(forge.Options{
+		Kind:    projCfg.Forge,
+		Remote:  projCfg.Repo,
+		BaseURL: projCfg.ForgeAPIURL,
+	})
+}
+
+// openPullRequest pushes a completed task's branch and opens a pull
+// request from it into the project's branch.
+func openPullRequest(projCfg *project.Config, task *beads.Task, worktreeDir, taskBranch string, agentID int) (*forge.PullRequest, error) {
+	f, err := projectForge(projCfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := setup.PushTaskBranch(worktreeDir, taskBranch); err != nil {
+		return nil, err
+	}
+	body := fmt.Sprintf("%s\n\n---\nCompleted by %s for task %s.", strings.TrimSpace(task.Description), config.AgentName(agentID), task.ID)
+	return f.CreatePR(forge.PR{
+		Title: fmt.Sprintf("%s: %s", task.ID, task.Title),
+		Body:  body,
+		Head:  taskBranch,
+		Base:  projCfg.Branch,
+	})
+}
+
+// forgeCmd shows which forge a project uses and the CI status of its
+// branch, to check the forge settings and token before relying on them.
+func forgeCmd(projectID string) {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	projCfg, err := project.Load(cfg.MachinatorDir, projectID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading project: %v\n", err)
+		os.Exit(1)
+	}
+	f, err := projectForge(projCfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	source := "detected from repo URL"
+	if projCfg.Forge != "" {
+		source = "from project config"
+	}
+	fmt.Printf("Forge:  %s (%s)\n", f.Kind(), source)
+	fmt.Printf("Repo:   %s\n", projCfg.Repo)
+	tokenVar := forge.EnvToken(f.Kind())
+	if os.Getenv(tokenVar) == "" {
+		fmt.Printf("Token:  %s not set (only public repos will work)\n", tokenVar)
+	} else {
+		fmt.Printf("Token:  %s\n", tokenVar)
+	}
+
+	repoDir := project.RepoDir(cfg.MachinatorDir, projectID)
+	out, err := tools.Command(tools.Git, "-C", repoDir, "rev-parse", "origin/"+projCfg.Branch).Output()
+	if err != nil {
+		fmt.Printf("CI:     unknown (no clone of origin/%s yet)\n", projCfg.Branch)
+		return
+	}
+	sha := strings.TrimSpace(string(out))
+	status, err := f.CIStatus(sha)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading CI status: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("CI:     %s (%s @ %.8s)\n", status, projCfg.Branch, sha)
+}
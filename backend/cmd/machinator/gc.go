@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/beads"
+	"github.com/bryantinsley/machinator/backend/internal/config"
+	"github.com/bryantinsley/machinator/backend/internal/project"
+	"github.com/bryantinsley/machinator/backend/internal/setup"
+	"github.com/bryantinsley/machinator/backend/internal/state"
+	"github.com/bryantinsley/machinator/backend/internal/tracker"
+)
+
+// gcDefaultAge is how long a finished task's branch is kept by default.
+const gcDefaultAge = 7 * 24 * time.Hour
+
+// gcCollector decides what gc may remove: work for tasks that are finished
+// (closed, or gone from the tracker) and not assigned to an agent.
+type gcCollector struct {
+	tasks    map[string]*beads.Task
+	assigned map[string]bool
+	age      time.Duration
+}
+
+// finished reports whether taskID's work is no longer wanted, and why.
+func (c *gcCollector) finished(taskID string) (string, bool) {
+	if c.assigned[taskID] {
+		return "", false
+	}
+	t, ok := c.tasks[taskID]
+	switch {
+	case !ok:
+		return "task gone", true
+	case t.Status == "closed":
+		return "task closed", true
+	}
+	return "", false
+}
+
+// branch reports whether a task branch last committed to at lastCommit may
+// be deleted, and why.
+func (c *gcCollector) branch(name string, lastCommit time.Time) (string, bool) {
+	taskID := strings.TrimPrefix(name, project.TaskBranch(""))
+	why, ok := c.finished(taskID)
+	if !ok {
+		return "", false
+	}
+	last := lastCommit
+	if t := c.tasks[taskID]; t != nil && t.ClosedAt != nil && t.ClosedAt.After(last) {
+		last = *t.ClosedAt
+	}
+	if time.Since(last) <= c.age {
+		return "", false
+	}
+	return why, true
+}
+
+// gcCmd removes what finished work leaves behind in a project: worktrees of
+// agents that no longer exist, scratch space of finished tasks, and task
+// branches (local and on origin) of finished tasks untouched for longer than
+// olderThan, merged or not. It reports the disk space reclaimed.
+func gcCmd(projectID, olderThan string, dryRun bool) {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	projCfg, err := project.Load(cfg.MachinatorDir, projectID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading project: %v\n", err)
+		os.Exit(1)
+	}
+	age := gcDefaultAge
+	if olderThan != "" {
+		if age, err = time.ParseDuration(olderThan); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid --older-than: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	st, err := state.Load(cfg.MachinatorDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading state: %v\n", err)
+		os.Exit(1)
+	}
+	defer st.Close()
+
+	repoDir := project.RepoDir(cfg.MachinatorDir, projectID)
+	tasks, err := tracker.LoadTasks(projCfg, repoDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading tasks: %v\n", err)
+		os.Exit(1)
+	}
+	c := &gcCollector{tasks: make(map[string]*beads.Task), assigned: make(map[string]bool), age: age}
+	for _, t := range tasks {
+		c.tasks[t.ID] = t
+	}
+	agents := make(map[string]bool)
+	for _, a := range st.AgentsSnapshot() {
+		agents[strconv.Itoa(a.ID)] = true
+		if a.TaskID != "" {
+			c.assigned[a.TaskID] = true
+		}
+	}
+
+	verb := func(did, would string) string {
+		if dryRun {
+			return would
+		}
+		return did
+	}
+	var reclaimed int64
+	failed := false
+	removeDir := func(what, dir string, remove func() error) {
+		size, _ := setup.DirSize(dir)
+		if !dryRun {
+			if err := remove(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error removing %s: %v\n", what, err)
+				failed = true
+				return
+			}
+		}
+		reclaimed += size
+		fmt.Printf("%s %s (%s)\n", verb("removed", "would remove"), what, setup.FormatSize(size))
+	}
+
+	// Worktrees of agents that are gone
+	agentsDir := filepath.Join(project.Dir(cfg.MachinatorDir, projectID), "agents")
+	entries, _ := os.ReadDir(agentsDir)
+	for _, e := range entries {
+		if e.IsDir() && !agents[e.Name()] {
+			dir := filepath.Join(agentsDir, e.Name())
+			removeDir("worktree of deleted agent-"+e.Name(), dir, func() error { return setup.RemoveWorktree(repoDir, dir) })
+		}
+	}
+	if !dryRun {
+		for _, dir := range projectRepos(cfg, projCfg, projectID) {
+			setup.PruneWorktrees(dir) // Extra repos' worktrees went with the agents'
+		}
+	}
+
+	// Scratch space of finished tasks
+	scratchDir := filepath.Join(project.Dir(cfg.MachinatorDir, projectID), "scratch")
+	entries, _ = os.ReadDir(scratchDir)
+	for _, e := range entries {
+		if why, ok := c.finished(e.Name()); ok && e.IsDir() {
+			dir := filepath.Join(scratchDir, e.Name())
+			removeDir(fmt.Sprintf("scratch space of %s (%s)", e.Name(), why), dir, func() error { return os.RemoveAll(dir) })
+		}
+	}
+
+	// Task branches, once their commits can go from the clone too
+	gitSize, _ := setup.DirSize(filepath.Join(repoDir, ".git"))
+	deleted := 0
+	local, err := setup.LocalTaskBranches(repoDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	for _, b := range local {
+		why, ok := c.branch(b.Name, b.LastCommit)
+		if !ok || b.CheckedOut {
+			continue
+		}
+		if !dryRun {
+			if err := setup.DeleteLocalBranch(repoDir, b.Name); err != nil {
+				fmt.Fprintf(os.Stderr, "Error deleting %s: %v\n", b.Name, err)
+				failed = true
+				continue
+			}
+		}
+		deleted++
+		fmt.Printf("%s %s (%s)\n", verb("deleted", "would delete"), b.Name, why)
+	}
+	remote, err := setup.RemoteTaskBranches(repoDir, projCfg.Branch)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	for _, b := range remote {
+		why, ok := c.branch(b.Name, b.LastCommit)
+		if !ok {
+			continue
+		}
+		if b.Merged {
+			why = "merged, " + why
+		} else {
+			why = "abandoned, " + why
+		}
+		if !dryRun {
+			if err := setup.DeleteRemoteBranch(repoDir, b.Name); err != nil {
+				fmt.Fprintf(os.Stderr, "Error deleting origin/%s: %v\n", b.Name, err)
+				failed = true
+				continue
+			}
+		}
+		deleted++
+		fmt.Printf("%s origin/%s (%s, last commit %s)\n", verb("deleted", "would delete"), b.Name, why, b.LastCommit.Format("2006-01-02"))
+	}
+	if deleted > 0 && !dryRun {
+		if err := setup.GC(repoDir); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			failed = true
+		} else if after, err := setup.DirSize(filepath.Join(repoDir, ".git")); err == nil && after < gitSize {
+			reclaimed += gitSize - after
+		}
+	}
+
+	if dryRun {
+		fmt.Printf("Would reclaim %s, and more once git gc drops deleted branches' commits\n", setup.FormatSize(reclaimed))
+	} else {
+		fmt.Printf("Reclaimed %s\n", setup.FormatSize(reclaimed))
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/bryantinsley/machinator/backend/internal/beads"
+	"github.com/bryantinsley/machinator/backend/internal/config"
+)
+
+// graphCmd prints the beads dependency graph: the tasks holding up the most
+// work, or with --dot the whole graph in Graphviz format
+// (machinator graph --dot | dot -Tsvg > beads.svg).
+func graphCmd(projectID string, dot bool) {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	repoDir, err := resolveProjectRepo(cfg.MachinatorDir, projectID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	tasks, err := beads.LoadTasks(repoDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading tasks: %v\n", err)
+		os.Exit(1)
+	}
+
+	if dot {
+		fmt.Print(beads.Dot(tasks))
+		return
+	}
+
+	bottlenecks := beads.Bottlenecks(tasks)
+	if len(bottlenecks) == 0 {
+		fmt.Println("No open task is blocking other work")
+		return
+	}
+	closed := beads.ClosedIDs(tasks)
+	counts := beads.Downstream(tasks)
+	fmt.Println("Closing these tasks unblocks the most work:")
+	for _, t := range bottlenecks {
+		fmt.Printf("  %-4d %s (%s) %s\n", counts[t.ID], t.ID, beads.GraphStatus(t, closed), t.Title)
+	}
+}
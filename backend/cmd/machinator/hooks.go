@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/procgroup"
+	"github.com/bryantinsley/machinator/backend/internal/tools"
+)
+
+// hookOutputLimit caps how much of a hook's output goes into the
+// transcript. The end is kept, where failures are reported.
+const hookOutputLimit = 64 << 10
+
+// hookEvent is one run of a project hook, as recorded in the task's
+// transcript alongside the agent's stream-json events.
+type hookEvent struct {
+	Type      string `json:"type"` // Always "hook"
+	Timestamp string `json:"timestamp"`
+	Hook      string `json:"hook"` // "pre_task", "post_task", "on_failure" or "test_gate"
+	Command   string `json:"command"`
+	Status    string `json:"status"` // "success" or "error"
+	ExitCode  int    `json:"exit_code"`
+	Duration  string `json:"duration"`
+	Output    string `json:"output"`
+}
+
+// runHook runs a hook's shell command in dir, with env added to the
+// environment, killing it and what it started when ctx is done. It returns
+// the run to record, or nil for an empty command, and an error if the
+// command failed or ran past timeout.
+func runHook(ctx context.Context, name, command, dir string, env []string, timeout time.Duration) (*hookEvent, error) {
+	if command == "" {
+		return nil, nil
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	cmd := procgroup.Command(ctx, "sh", "-c", command)
+	cmd.Dir = dir
+	cmd.Env = append(tools.Environ(), env...)
+	cmd.WaitDelay = time.Second // Don't wait on background children holding the output open
+
+	start := time.Now()
+	out, err := cmd.CombinedOutput()
+	if len(out) > hookOutputLimit {
+		out = out[len(out)-hookOutputLimit:]
+	}
+	ev := &hookEvent{
+		Type:      "hook",
+		Timestamp: start.UTC().Format(time.RFC3339Nano),
+		Hook:      name,
+		Command:   command,
+		Status:    "success",
+		Duration:  time.Since(start).Round(time.Millisecond).String(),
+		Output:    string(out),
+	}
+	if err != nil {
+		ev.Status = "error"
+		ev.ExitCode = -1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			ev.ExitCode = exitErr.ExitCode()
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("timed out after %s", timeout)
+		}
+		return ev, err
+	}
+	return ev, nil
+}
+
+// lastLines returns up to n of the last non-empty lines of s.
+func lastLines(s string, n int) []string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	if len(lines) == 1 && lines[0] == "" {
+		return nil
+	}
+	return lines
+}
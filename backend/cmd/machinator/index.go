@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/bryantinsley/machinator/backend/internal/codeindex"
+	"github.com/bryantinsley/machinator/backend/internal/config"
+	"github.com/bryantinsley/machinator/backend/internal/project"
+)
+
+// indexCmd updates a project's code index from its clone, so the first
+// agents don't wait for a large repo to be indexed, and optionally shows
+// what a task with the given text would be given.
+func indexCmd(projectID, query string) {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	projCfg, err := project.Load(cfg.MachinatorDir, projectID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading project: %v\n", err)
+		os.Exit(1)
+	}
+	repoDir := project.RepoDir(cfg.MachinatorDir, projectID)
+	path := codeindex.Path(project.Dir(cfg.MachinatorDir, projectID))
+	ix, changed, err := codeindex.Update(path, repoDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error indexing %s: %v\n", repoDir, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Index:  %s\n", path)
+	fmt.Printf("Files:  %d (%d updated)\n", len(ix.Blobs), changed)
+	fmt.Printf("Chunks: %d\n", len(ix.Chunks))
+	if !projCfg.ContextIndex {
+		fmt.Println("Note:   context_index is off in the project config, so agents don't use it")
+	}
+
+	if query == "" {
+		return
+	}
+	fmt.Println()
+	for _, m := range ix.Search(query, 10) {
+		fmt.Printf("%.3f  %s:%d-%d\n", m.Score, m.Path, m.Start, m.End)
+	}
+}
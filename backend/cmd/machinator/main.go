@@ -1,70 +1,122 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math/rand"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"regexp"
+	"runtime/debug"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
+	"github.com/bryantinsley/machinator/backend/internal/agent"
+	"github.com/bryantinsley/machinator/backend/internal/api"
 	"github.com/bryantinsley/machinator/backend/internal/beads"
+	"github.com/bryantinsley/machinator/backend/internal/chaos"
+	"github.com/bryantinsley/machinator/backend/internal/codeindex"
 	"github.com/bryantinsley/machinator/backend/internal/config"
+	"github.com/bryantinsley/machinator/backend/internal/decisions"
+	"github.com/bryantinsley/machinator/backend/internal/directive"
+	"github.com/bryantinsley/machinator/backend/internal/events"
+	"github.com/bryantinsley/machinator/backend/internal/flaky"
+	"github.com/bryantinsley/machinator/backend/internal/notify"
 	"github.com/bryantinsley/machinator/backend/internal/project"
 	"github.com/bryantinsley/machinator/backend/internal/quota"
+	"github.com/bryantinsley/machinator/backend/internal/rundb"
+	"github.com/bryantinsley/machinator/backend/internal/safeguard"
+	"github.com/bryantinsley/machinator/backend/internal/scheduler"
+	"github.com/bryantinsley/machinator/backend/internal/seed"
 	"github.com/bryantinsley/machinator/backend/internal/setup"
 	"github.com/bryantinsley/machinator/backend/internal/state"
+	"github.com/bryantinsley/machinator/backend/internal/tools"
+	"github.com/bryantinsley/machinator/backend/internal/tracker"
+	"github.com/bryantinsley/machinator/backend/internal/transcript"
 	"github.com/bryantinsley/machinator/backend/internal/tui"
 )
 
-func usage() {
-	fmt.Println(`machinator - Autonomous Agent Orchestration System
-
-Usage:
-  machinator <command> [options]
+func main() {
+	if err := rootCmd().Execute(); err != nil {
+		os.Exit(1)
+	}
+}
 
-Commands:
-  run            Run the orchestrator
-  setup          Setup project (clone repo, build gemini CLI)
-  project        List/create/show project configs
-  quota          Dump quota for all accounts
-  select-task    Show what task would be selected
-  help           Show this help
+func envCmd() {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VARIABLE\tTYPE\tVALUE\tDESCRIPTION")
+	for _, v := range config.EnvVars {
+		value, set := v.Value()
+		switch {
+		case !set && v.Default != "":
+			value = v.Default + " (default)"
+		case !set:
+			value = "(from config)"
+		default:
+			if err := v.Check(value); err != nil {
+				value += " (INVALID)"
+			} else if v.Type == "secret" {
+				value = "(set)"
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", v.Name, v.Type, value, v.Description)
+	}
+	w.Flush()
 
-Environment:
-  MACHINATOR_DIR   Base directory (default: ~/.machinator)
-`)
+	// Show what the overrides resolve to after config is applied
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\nError loading config: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println()
+	fmt.Println("Resolved:")
+	fmt.Printf("  machinator dir: %s\n", cfg.MachinatorDir)
+	fmt.Printf("  idle timeout:   %s\n", cfg.Timeouts.Idle.Duration())
+	fmt.Printf("  max runtime:    %s\n", cfg.Timeouts.MaxRuntime.Duration())
+	fmt.Printf("  agent name:     %s\n", config.AgentName(1))
 }
 
-func main() {
-	if len(os.Args) < 2 {
-		usage()
+// flagsListCmd lists the experimental feature flags and whether they're on.
+func flagsListCmd() {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
 		os.Exit(1)
 	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FLAG\tSTATE\tDESCRIPTION")
+	for _, f := range config.Flags {
+		state := "off"
+		if cfg.FeatureEnabled(f.Name) {
+			state = "on"
+		}
+		if _, set := cfg.Features[f.Name]; !set {
+			state += " (default)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", f.Name, state, f.Description)
+	}
+	w.Flush()
+}
 
-	cmd := os.Args[1]
-
-	switch cmd {
-	case "quota":
-		quotaCmd()
-	case "select-task":
-		selectTaskCmd()
-	case "setup":
-		setupCmd()
-	case "project":
-		projectCmd()
-	case "run":
-		runCmd()
-	case "help", "-h", "--help":
-		usage()
-	default:
-		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", cmd)
-		usage()
+// flagsSetCmd turns a feature flag on or off in the global config.
+func flagsSetCmd(name string, enable bool) {
+	if err := config.SetFeature(name, enable); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
+	verb := "disabled"
+	if enable {
+		verb = "enabled"
+	}
+	fmt.Printf("%s %s (restart machinator to apply)\n", name, verb)
 }
 
 func quotaCmd() {
@@ -74,8 +126,10 @@ func quotaCmd() {
 		os.Exit(1)
 	}
 
+	ctx, stop := interruptContext()
+	defer stop()
 	q := quota.New(cfg.MachinatorDir)
-	if err := q.Refresh(); err != nil {
+	if err := q.Refresh(ctx); err != nil {
 		fmt.Fprintf(os.Stderr, "Error refreshing quota: %v\n", err)
 		os.Exit(1)
 	}
@@ -90,26 +144,27 @@ func quotaCmd() {
 	}
 }
 
-func setupCmd() {
-	// Parse flags
-	projectID := ""
-	repoURL := ""
-	branch := "main"
-	buildGemini := false
-
-	for i := 2; i < len(os.Args); i++ {
-		arg := os.Args[i]
-		if strings.HasPrefix(arg, "--project=") {
-			projectID = strings.TrimPrefix(arg, "--project=")
-		} else if strings.HasPrefix(arg, "--repo=") {
-			repoURL = strings.TrimPrefix(arg, "--repo=")
-		} else if strings.HasPrefix(arg, "--branch=") {
-			branch = strings.TrimPrefix(arg, "--branch=")
-		} else if arg == "--build-gemini" {
-			buildGemini = true
-		}
+// directiveCmd prints the built-in directive for a task in the repo in the
+// current directory, for bootstrap/orchestrator_with_quota.sh.
+func directiveCmd(taskID, agentName, taskContext string) {
+	if taskContext == "" {
+		taskContext = "No description"
+	}
+	prompt, err := directive.Build("", directive.Data{
+		AgentName:      agentName,
+		TaskID:         taskID,
+		TaskContext:    taskContext,
+		ProjectContext: directive.ProjectContext("."),
+		WorktreeDir:    ".",
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
 	}
+	fmt.Print(prompt)
+}
 
+func setupCmd(projectID, repoURL, branch string, buildGemini bool) {
 	cfg, err := config.Load()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
@@ -117,6 +172,8 @@ func setupCmd() {
 	}
 
 	s := setup.New(cfg.MachinatorDir)
+	ctx, cancel := setupContext(cfg)
+	defer cancel()
 
 	// Ensure base directories exist
 	fmt.Println("Creating directories...")
@@ -128,7 +185,7 @@ func setupCmd() {
 	// Build gemini CLI if requested
 	if buildGemini {
 		fmt.Println("Building gemini CLI...")
-		if err := s.BuildGeminiCLI(); err != nil {
+		if err := s.BuildGeminiCLI(ctx); err != nil {
 			fmt.Fprintf(os.Stderr, "Error building gemini CLI: %v\n", err)
 			os.Exit(1)
 		}
@@ -142,7 +199,7 @@ func setupCmd() {
 		fmt.Printf("Setting up project %s...\n", projectID)
 
 		id, _ := strconv.Atoi(projectID)
-		repoDir, err := s.CloneRepo(id, repoURL, branch)
+		repoDir, err := s.CloneRepo(ctx, id, repoURL, branch, project.CloneConfig{})
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error cloning repo: %v\n", err)
 			os.Exit(1)
@@ -153,29 +210,7 @@ func setupCmd() {
 	fmt.Println("Setup complete!")
 }
 
-func projectCmd() {
-	// Parse flags
-	projectID := ""
-	create := false
-	edit := false
-	repo := ""
-	branch := "main"
-
-	for i := 2; i < len(os.Args); i++ {
-		arg := os.Args[i]
-		if strings.HasPrefix(arg, "--project=") {
-			projectID = strings.TrimPrefix(arg, "--project=")
-		} else if arg == "--create" {
-			create = true
-		} else if arg == "--edit" {
-			edit = true
-		} else if strings.HasPrefix(arg, "--repo=") {
-			repo = strings.TrimPrefix(arg, "--repo=")
-		} else if strings.HasPrefix(arg, "--branch=") {
-			branch = strings.TrimPrefix(arg, "--branch=")
-		}
-	}
-
+func projectCmd(projectID string, create, edit bool, repo, branch string) {
 	cfg, err := config.Load()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
@@ -195,8 +230,8 @@ func projectCmd() {
 		projCfg := &project.Config{
 			Repo:             repo,
 			Branch:           branch,
-			SimpleModelName:  "gemini-3-flash-preview",
-			ComplexModelName: "gemini-3-pro-preview",
+			SimpleModelName:  project.DefaultSimpleModel,
+			ComplexModelName: project.DefaultComplexModel,
 		}
 
 		if err := project.Save(cfg.MachinatorDir, projectID, projCfg); err != nil {
@@ -219,12 +254,7 @@ func projectCmd() {
 			os.Exit(1)
 		}
 
-		editor := os.Getenv("EDITOR")
-		if editor == "" {
-			editor = "vim"
-		}
-
-		cmd := exec.Command(editor, configPath)
+		cmd := exec.Command(config.Editor(), configPath)
 		cmd.Stdin = os.Stdin
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
@@ -271,19 +301,49 @@ func projectCmd() {
 	}
 }
 
-func selectTaskCmd() {
-	// Parse flags
-	noQuotaCheck := false
-	projectID := ""
-	for i := 2; i < len(os.Args); i++ {
-		arg := os.Args[i]
-		if arg == "--no-quota-check" {
-			noQuotaCheck = true
-		} else if strings.HasPrefix(arg, "--project=") {
-			projectID = strings.TrimPrefix(arg, "--project=")
-		}
+// scaffoldCmd adds the .machinator/ templates to a project's clone,
+// cloning it first if needed. Committing them is left to the user.
+func scaffoldCmd(projectID string) {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	projCfg, err := project.Load(cfg.MachinatorDir, projectID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading project: %v\n", err)
+		os.Exit(1)
+	}
+
+	ctx, cancel := setupContext(cfg)
+	defer cancel()
+	id, _ := strconv.Atoi(projectID)
+	repoDir, err := setup.New(cfg.MachinatorDir).CloneRepo(ctx, id, projCfg.Repo, projCfg.Branch, projCfg.Clone)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error cloning repo: %v\n", err)
+		os.Exit(1)
+	}
+
+	testCommand := projCfg.TestCommand
+	if testCommand == "" {
+		testCommand = directive.DetectTestCommand(repoDir)
+	}
+	written, err := project.Scaffold(repoDir, directive.DefaultTemplate(), testCommand)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
 	}
+	if len(written) == 0 {
+		fmt.Printf("%s already has every %s file\n", repoDir, project.RepoConfigDir)
+		return
+	}
+	for _, path := range written {
+		fmt.Printf("Wrote %s\n", filepath.Join(repoDir, path))
+	}
+	fmt.Printf("Edit them, then commit and push %s/ to %s so agents use them\n", project.RepoConfigDir, projCfg.Branch)
+}
 
+func selectTaskCmd(projectID string, noQuotaCheck bool, runSeed seed.Seed) {
 	cfg, err := config.Load()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
@@ -296,6 +356,11 @@ func selectTaskCmd() {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
+	projCfg, err := project.Load(cfg.MachinatorDir, filepath.Base(filepath.Dir(repoDir)))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading project: %v\n", err)
+		os.Exit(1)
+	}
 
 	// Load quota (or fake it)
 	q := quota.New(cfg.MachinatorDir)
@@ -305,14 +370,16 @@ func selectTaskCmd() {
 			{
 				Name: "fake",
 				Models: map[string]float64{
-					"gemini-3-flash-preview": 1.0,
-					"gemini-3-pro-preview":   1.0,
+					projCfg.SimpleModelName:  1.0,
+					projCfg.ComplexModelName: 1.0,
 				},
 			},
 		}
 		fmt.Println("(Skipping quota check, assuming full quota)")
 	} else {
-		if err := q.Refresh(); err != nil {
+		ctx, stop := interruptContext()
+		defer stop()
+		if err := q.Refresh(ctx); err != nil {
 			fmt.Fprintf(os.Stderr, "Error refreshing quota: %v\n", err)
 			os.Exit(1)
 		}
@@ -343,61 +410,204 @@ func selectTaskCmd() {
 		}
 	}
 
-	// Show ready tasks with weights
-	fmt.Println("\nReady tasks with weights:")
-	simpleQuota := q.TotalFor("gemini-3-flash-preview")
-	complexQuota := q.TotalFor("gemini-3-pro-preview")
+	// Show ready tasks with weights, most urgent first
+	fmt.Println("\nReady tasks with priorities and weights (only the most urgent tier is drawn from):")
+	simpleQuota := q.TotalFor(projCfg.SimpleModelName)
+	complexQuota := q.TotalFor(projCfg.ComplexModelName)
 
 	for _, task := range ready {
-		var weight float64
-		var model string
+		model := "simple"
 		if task.IsComplex {
 			model = "complex"
-			if complexQuota > 0 {
-				weight = 5.0
+		} else if simpleQuota <= 0 && complexQuota > 0 {
+			model = "simple→complex" // Upgrade
+		}
+		fmt.Printf("  %s (%s) P%d weight=%.1f\n", task.ID, model, task.Urgency, scheduler.Weight(task, simpleQuota, complexQuota))
+	}
+
+	st, err := state.Load(cfg.MachinatorDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading state: %v\n", err)
+		os.Exit(1)
+	}
+	defer st.Close()
+	if task := scheduler.Select(ready, simpleQuota, complexQuota, st, runSeed.Stream("assign")); task != nil {
+		fmt.Printf("\nWould select %s (seed %s)\n", task.ID, runSeed)
+	} else {
+		fmt.Println("\nNo selectable task (all barred, assigned, or out of quota)")
+	}
+}
+
+func runCmd(projectID string, headless bool, apiListen string, runSeed seed.Seed, budget runBudget, summaryPath, jobSummary string) {
+	started := time.Now()
+	o := startOrchestrator(projectID, headless, !headless, runSeed)
+	defer o.logger.Close()
+	defer o.reportCrash()
+
+	// HTTP control API (flag overrides config)
+	if apiListen == "" {
+		apiListen = o.cfg.API.Listen
+	}
+	if apiListen != "" {
+		go o.serveAPI(o.newAPIServer(apiListen), apiListen)
+	}
+
+	// Closed once the run's budget is spent; never without one
+	spent := make(chan struct{})
+	if budget.enabled() {
+		o.goSafe(func() { o.budgetWatcher(budget, spent) })
+	}
+	var batch *batchResults
+	if budget.batch > 0 {
+		o.st.SetBatch(budget.batch)
+		batch = newBatchResults()
+		o.bus.Subscribe("batch", batch.record)
+	}
+
+	if headless {
+		// Headless mode: wait for signal
+		o.logger.Log("main", "Running in headless mode (Ctrl+C to stop)")
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+		select {
+		case <-sig:
+		case <-spent:
+		}
+		o.logger.Log("main", "Shutting down...")
+	} else {
+		// TUI mode: the terminal may be in the background, so also notify the desktop
+		if err := o.notifier.AddDesktop(o.cfg.DesktopNotifications); err != nil {
+			o.logger.Log("notify", fmt.Sprintf("[red]%v[-]", err))
+		}
+		projectConfigPath := project.ConfigPath(o.cfg.MachinatorDir, o.projectID)
+		ui := tui.New(o.st, o.q, o.repoDir, o.cfg, o.projCfg, projectConfigPath)
+		o.bus.Subscribe("tui", ui.HandleEvent)
+		go func() {
+			<-spent
+			ui.Stop()
+		}()
+		if err := ui.Run(); err != nil {
+			fmt.Fprintf(os.Stderr, "TUI error: %v\n", err)
+		}
+	}
+
+	// Headless and batch runs leave a summary for CI to publish
+	if summaryPath == "" && (headless || batch != nil) {
+		summaryPath = runSummaryPath(o.cfg.MachinatorDir)
+	}
+	if summaryPath != "" || jobSummary != "" {
+		o.stopAgents() // So no run is still changing
+		sum, err := o.summarize(started)
+		if err != nil {
+			o.logger.Log("main", fmt.Sprintf("[red]Run summary: %v[-]", err))
+		}
+		if err == nil && summaryPath != "" {
+			if err := writeRunSummary(summaryPath, sum); err != nil {
+				o.logger.Log("main", fmt.Sprintf("[red]Write run summary: %v[-]", err))
+			} else {
+				o.logger.Log("main", fmt.Sprintf("Run summary written to %s", summaryPath))
 			}
-		} else {
-			model = "simple"
-			if simpleQuota > 0 {
-				weight = 1.0
-			} else if complexQuota > 0 {
-				weight = 1.0 // Upgrade to complex
-				model = "simple→complex"
+		}
+		if err == nil && jobSummary != "" {
+			if err := appendJobSummary(jobSummary, sum); err != nil {
+				o.logger.Log("main", fmt.Sprintf("[red]Write job summary: %v[-]", err))
 			}
 		}
-		fmt.Printf("  %s (%s) weight=%.1f\n", task.ID, model, weight)
 	}
-}
+	o.shutdown()
 
-func runCmd() {
-	// Parse flags
-	projectID := ""
-	headless := false
-	for i := 2; i < len(os.Args); i++ {
-		arg := os.Args[i]
-		if strings.HasPrefix(arg, "--project=") {
-			projectID = strings.TrimPrefix(arg, "--project=")
-		} else if arg == "--headless" {
-			headless = true
+	if batch != nil {
+		o.bus.Flush(time.Second)
+		batch.print(os.Stdout)
+		if batch.failed() {
+			o.logger.Close()
+			os.Exit(1)
 		}
 	}
+}
 
-	cfg, err := config.Load()
+// seedFlag parses a --seed value, or makes a new seed if it's empty.
+// Exits on a bad value.
+func seedFlag(value string) seed.Seed {
+	if value == "" {
+		return seed.New()
+	}
+	s, err := seed.Parse(value)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
+	return s
+}
+
+// orchestrator bundles everything the watchers share for one project run.
+type orchestrator struct {
+	cfg       *config.Config
+	projCfg   *project.Config
+	projectID string
+	repoDir   string
+	st        *state.State
+	q         *quota.Quota
+	logger    *tui.FileLogger
+	notifier  *notify.Dispatcher
+	bus       *events.Bus
+	metrics   *events.Counter // Events so far, by type
+	seed      seed.Seed
+	sessionID int64 // Row in the run manifest
+
+	// ctx is done once shutdown starts, stopping every subprocess the
+	// watchers started
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// nativeBdShim puts a bd that runs beads.Native first on PATH when there's
+// no bd, so agents can still close their tasks. Reports whether it did.
+func nativeBdShim(machinatorDir string) (bool, error) {
+	if tools.Installed(tools.Bd) {
+		return false, nil
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return false, err
+	}
+	bin := filepath.Join(machinatorDir, "bin")
+	if err := os.MkdirAll(bin, 0755); err != nil {
+		return false, err
+	}
+	script := fmt.Sprintf("#!/bin/sh\nexec %q %s \"$@\"\n", self, beads.NativeCommand)
+	if err := os.WriteFile(filepath.Join(bin, "bd"), []byte(script), 0755); err != nil {
+		return false, err
+	}
+	os.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return true, nil
+}
 
+// startOrchestrator loads config and state for a project and starts all
+// watchers. Every randomized decision is drawn from runSeed, which is
+// recorded in the run manifest. After an unclean shutdown, interactive
+// runs show what will be reconciled and wait for a confirm first. Exits the
+// process on configuration errors.
+func startOrchestrator(projectID string, console, interactive bool, runSeed seed.Seed) *orchestrator {
 	// Resolve project
 	if projectID == "" {
 		projectID = "1" // Default to project 1
 	}
+	cfg, err := config.LoadFor(project.ConfigPath(config.Dir(), projectID))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
 	projCfg, err := project.Load(cfg.MachinatorDir, projectID)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error loading project: %v\n", err)
 		os.Exit(1)
 	}
 	repoDir := project.RepoDir(cfg.MachinatorDir, projectID)
+	warnings := append(append([]config.Issue{}, cfg.Warnings...), projCfg.Warnings...)
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+	}
 
 	st, err := state.Load(cfg.MachinatorDir)
 	if err != nil {
@@ -405,6 +615,87 @@ func runCmd() {
 		os.Exit(1)
 	}
 
+	// Create file logger (always writes to files)
+	logsDir := filepath.Join(cfg.MachinatorDir, "logs")
+	logger, err := tui.NewFileLogger(logsDir, console, cfg.Logs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating logger: %v\n", err)
+		os.Exit(1)
+	}
+	for _, w := range warnings {
+		logger.Log("main", fmt.Sprintf("[yellow]Config warning: %s[-]", w))
+	}
+	logger.Log("main", fmt.Sprintf("Seed %s (reproduce with --seed=%s)", runSeed, runSeed))
+	if err := tools.Require(tools.Git, tools.MinGit, "agent worktrees"); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if tools.Installed(tools.Bd) {
+		if err := tools.Require(tools.Bd, tools.MinBd, "--sandbox"); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v; upgrade bd, or take it off PATH to use machinator's native bd\n", err)
+			os.Exit(1)
+		}
+	}
+	if shimmed, err := nativeBdShim(cfg.MachinatorDir); err != nil {
+		logger.Log("main", fmt.Sprintf("[yellow]bd isn't installed and the native one couldn't be put on PATH: %v[-]", err))
+	} else if shimmed {
+		logger.Log("main", "bd isn't installed; agents get machinator's native bd")
+	}
+
+	// Event sinks (webhooks)
+	notifier, err := notify.NewDispatcher(cfg.Webhooks, logger, runSeed)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error configuring webhooks: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Everything that happens goes out on the bus, to whoever subscribes
+	bus := events.NewBus(func(name string, e events.Event) {
+		logger.Log("events", fmt.Sprintf("[red]%s fell behind, dropped %s[-]", name, e.Type))
+	})
+	bus.Subscribe("notify", notifier.Emit)
+	bus.Subscribe("event log", events.Appender(events.LogPath(cfg.MachinatorDir), func(err error) {
+		logger.Log("events", fmt.Sprintf("[red]%v[-]", err))
+	}))
+	metrics := events.NewCounter()
+	bus.Subscribe("metrics", metrics.Count)
+
+	// A lock or session left open means the last run didn't shut down cleanly
+	lockPID, err := acquireLock(cfg.MachinatorDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	rec, err := detectRecovery(st, cfg, projCfg, projectID, lockPID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error checking for an unclean shutdown: %v\n", err)
+		releaseLock(cfg.MachinatorDir)
+		os.Exit(1)
+	}
+	if rec.unclean() {
+		if interactive && !tui.ConfirmRecovery(rec.String()) {
+			releaseLock(cfg.MachinatorDir)
+			os.Exit(0)
+		}
+		for _, line := range strings.Split(rec.String(), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				logger.Log("main", "[yellow]Recovery: "+line+"[-]")
+			}
+		}
+		rec.reconcile(cfg, projCfg, projectID, logger)
+	}
+
+	// Runs still open in the database were interrupted by the last exit
+	if err := st.DB().AbandonOpenRuns(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error updating run history: %v\n", err)
+		os.Exit(1)
+	}
+	sessionID, err := st.DB().StartSession(projectID, int64(runSeed), strings.Join(os.Args[1:], " "))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error updating run history: %v\n", err)
+		os.Exit(1)
+	}
+
 	q := quota.New(cfg.MachinatorDir)
 
 	// Ensure we have at least one agent
@@ -415,55 +706,270 @@ func runCmd() {
 		st.Save()
 	}
 
-	// Create file logger (always writes to files)
-	logsDir := filepath.Join(cfg.MachinatorDir, "logs")
-	logger, err := tui.NewFileLogger(logsDir, headless)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error creating logger: %v\n", err)
+	// Start watchers (quota will be fetched in background)
+	ctx, cancel := context.WithCancel(context.Background())
+	o := &orchestrator{
+		cfg:       cfg,
+		projCfg:   projCfg,
+		projectID: projectID,
+		repoDir:   repoDir,
+		st:        st,
+		q:         q,
+		logger:    logger,
+		notifier:  notifier,
+		bus:       bus,
+		metrics:   metrics,
+		seed:      runSeed,
+		sessionID: sessionID,
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+	if enabled, err := chaos.EnableFromEnv(runSeed.Derive("chaos")); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
+	} else if enabled {
+		logger.Log("main", "[fuchsia]Chaos mode enabled ("+os.Getenv("MACHINATOR_CHAOS")+")[-]")
+		agent.Gemini = chaosRunner{Runner: agent.Gemini, logger: logger}
+		o.goSafe(o.chaosMonitor)
 	}
-	defer logger.Close()
 
-	// Start watchers (quota will be fetched in background)
-	go quotaWatcher(q, cfg, logger)
-	go setupWatcher(st, cfg, projCfg, projectID, logger)
-	go assigner(st, q, cfg, projCfg, repoDir, logger)
+	o.goSafe(func() { quotaWatcher(ctx, q, st.DB(), cfg, logger, bus) })
+	o.goSafe(func() { setupWatcher(ctx, st, cfg, projCfg, projectID, logger, bus) })
+	rng := runSeed.Stream("assign")
+	o.goSafe(func() { assigner(st, q, cfg, projCfg, projectID, repoDir, rng, logger, bus) })
+	o.goSafe(func() { agentWatcher(ctx, st, q, cfg, projCfg, projectID, repoDir, logger, bus) })
+	if projCfg.EstimateComplexity || projCfg.Complexity.Enabled() {
+		o.goSafe(func() { estimator(st, q, cfg, projCfg, projectID, repoDir, logger) })
+	}
+	if projCfg.Merge.PruneAfter > 0 {
+		o.goSafe(func() { branchPruner(projCfg, repoDir, logger) })
+	}
+	if cfg.FeatureEnabled("autoscaler") {
+		o.goSafe(o.autoscaler)
+	}
+	o.goSafe(o.statusWriter)
+	o.goSafe(o.configWatcher)
+	if cfg.PreventSleep {
+		o.goSafe(o.sleepInhibitor)
+	}
+	return o
+}
 
-	if headless {
-		// Headless mode: wait for signal
-		logger.Log("main", "Running in headless mode (Ctrl+C to stop)")
-		sig := make(chan os.Signal, 1)
-		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
-		<-sig
-		logger.Log("main", "Shutting down...")
-	} else {
-		// TUI mode
-		projectConfigPath := project.ConfigPath(cfg.MachinatorDir, projectID)
-		ui := tui.New(st, q, repoDir, cfg, projCfg, projectConfigPath)
-		go func() {
-			// Feed file logger to TUI
-			// TUI will display its own view
-		}()
-		if err := ui.Run(); err != nil {
-			fmt.Fprintf(os.Stderr, "TUI error: %v\n", err)
+// sleepInhibitor keeps the machine awake while agents are running, letting
+// it sleep again once the run is paused or idle.
+func (o *orchestrator) sleepInhibitor() {
+	var inhibitor safeguard.Inhibitor
+	failed := false // Already logged that inhibiting failed
+	for {
+		active := !o.st.AssignmentIsPaused() && len(o.st.AssignedAgents()) > 0
+		switch {
+		case active && !inhibitor.Held():
+			if err := inhibitor.Hold(); err != nil {
+				if !failed {
+					o.logger.Log("main", fmt.Sprintf("[yellow]Can't keep the machine awake: %v[-]", err))
+					failed = true
+				}
+			} else {
+				o.logger.Log("main", "Keeping the machine awake while agents run")
+				failed = false
+			}
+		case !active && inhibitor.Held():
+			inhibitor.Release()
+			o.logger.Log("main", "Letting the machine sleep, no agents running")
+		}
+		time.Sleep(sleepCheckInterval)
+	}
+}
+
+// sleepCheckInterval is how often sleepInhibitor checks for running agents.
+const sleepCheckInterval = 5 * time.Second
+
+// chaosMonitor checks run invariants while chaos mode is on and logs any
+// violation, so a chaos run fails loudly if tasks are lost or closed twice.
+func (o *orchestrator) chaosMonitor() {
+	reported := make(map[string]bool)
+	for {
+		time.Sleep(5 * time.Second)
+		violations, err := chaos.Check(o.st, o.st.DB())
+		if err != nil {
+			o.logger.Log("chaos", fmt.Sprintf("[red]Check failed: %v[-]", err))
+			continue
+		}
+		for _, v := range violations {
+			if !reported[v] {
+				reported[v] = true
+				o.logger.Log("chaos", fmt.Sprintf("[red]INVARIANT VIOLATED: %s[-]", v))
+			}
+		}
+	}
+}
+
+// chaosRunner launches agents whose exits chaos may lose.
+type chaosRunner struct {
+	agent.Runner
+	logger tui.Logger
+}
+
+func (r chaosRunner) Launch(ctx context.Context, opts agent.LaunchOptions) (agent.Run, error) {
+	run, err := r.Runner.Launch(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	c := &chaosRun{Run: run, done: make(chan error, 1), killed: make(chan struct{})}
+	go func() {
+		err := <-run.Done()
+		if chaos.LoseExit() {
+			// Reported once killed, so the watcher's kill-then-wait still returns
+			r.logger.Log(fmt.Sprintf("agent-%d", opts.AgentID), fmt.Sprintf("[fuchsia]chaos: losing pid %d's exit[-]", run.PID()))
+			<-c.killed
+		}
+		c.done <- err
+	}()
+	return c, nil
+}
+
+// chaosRun is a run whose exit may go unreported until it's killed.
+type chaosRun struct {
+	agent.Run
+	done   chan error
+	killed chan struct{}
+	kill   sync.Once
+}
+
+func (c *chaosRun) Done() <-chan error { return c.done }
+
+func (c *chaosRun) Kill() error {
+	c.kill.Do(func() { close(c.killed) })
+	return c.Run.Kill()
+}
+
+// goSafe runs fn in a goroutine that reports a crash before the panic
+// takes down the process.
+func (o *orchestrator) goSafe(fn func()) {
+	go func() {
+		defer o.reportCrash()
+		fn()
+	}()
+}
+
+// reportCrash must be deferred. On panic it logs, sends an
+// orchestrator_crashed event, waits briefly for delivery, and re-panics.
+func (o *orchestrator) reportCrash() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	msg := fmt.Sprintf("panic: %v", r)
+	o.logger.Log("main", fmt.Sprintf("[red]%s[-]\n%s", msg, debug.Stack()))
+	o.bus.Publish(events.New(events.OrchestratorCrashed, 0, "", msg))
+	o.bus.Flush(5 * time.Second)
+	o.notifier.Flush(10 * time.Second)
+	o.st.Save()
+	panic(r)
+}
+
+// shutdown stops the agents and any clone or build under way, records a
+// clean exit in the run manifest and saves state. Runs it cut short are
+// left open, as an unclean exit leaves them.
+func (o *orchestrator) shutdown() {
+	o.stopAgents()
+	if err := o.st.DB().EndSession(o.sessionID); err != nil {
+		o.logger.Log("main", fmt.Sprintf("[red]%v[-]", err))
+	}
+	o.st.Save()
+	o.st.Close()
+	releaseLock(o.cfg.MachinatorDir)
+}
+
+// stopAgents cancels o.ctx, killing every agent's process group, and waits
+// up to orphanStopTimeout for them to be gone.
+func (o *orchestrator) stopAgents() {
+	o.cancel()
+	deadline := time.Now().Add(orphanStopTimeout)
+	for _, a := range o.st.AgentsSnapshot() {
+		for a.PID != 0 && processRunning(a.PID, "") && time.Now().Before(deadline) {
+			time.Sleep(50 * time.Millisecond)
 		}
 	}
+}
+
+// newAPIServer creates the control API server, to serve on listen if it's
+// set. Exits on bad token config, or on no tokens for a listen address
+// that isn't loopback.
+func (o *orchestrator) newAPIServer(listen string) *api.Server {
+	srv, err := api.New(o.st, o.q, o.repoDir, o.cfg, o.projCfg)
+	if err == nil && listen != "" {
+		err = srv.CheckListen(listen)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error configuring API: %v\n", err)
+		os.Exit(1)
+	}
+	srv.SetMetrics(o.metrics)
+	return srv
+}
+
+// serveAPI serves the control API over TCP, logging when it stops.
+func (o *orchestrator) serveAPI(srv *api.Server, addr string) {
+	if srv.Open() {
+		o.logger.Log("api", "[yellow]No API tokens configured, API is unauthenticated (loopback only)[-]")
+	}
+	o.logger.Log("api", fmt.Sprintf("Listening on %s", addr))
+	if err := srv.ListenAndServe(addr); err != nil {
+		o.logger.Log("api", fmt.Sprintf("[red]Server error: %v[-]", err))
+	}
+}
 
-	st.Save()
+// waitForSignal blocks until SIGINT or SIGTERM.
+func waitForSignal() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	<-sig
 }
 
-func quotaWatcher(q *quota.Quota, cfg *config.Config, logger tui.Logger) {
+func quotaWatcher(ctx context.Context, q *quota.Quota, db *rundb.DB, cfg *config.Config, logger tui.Logger, bus *events.Bus) {
+	exhausted := false
 	for {
-		if err := q.Refresh(); err != nil {
+		if err := q.Refresh(ctx); err != nil {
 			logger.Log("quota", fmt.Sprintf("Refresh error: %v", err))
+			bus.Publish(events.New(events.QuotaRefreshFailed, 0, "", err.Error()))
 		} else {
 			logger.Log("quota", fmt.Sprintf("Refreshed: %d accounts", len(q.Accounts)))
+
+			// Keep a ledger of quota readings for usage history
+			readings := make(map[string]map[string]float64)
+			for _, acc := range q.Accounts {
+				readings[acc.Name] = acc.Models
+			}
+			if err := db.RecordQuota(q.UpdatedAt, readings); err != nil {
+				logger.Log("quota", fmt.Sprintf("Record quota: %v", err))
+			}
+
+			// Only notify on the transition into exhaustion
+			nowExhausted := len(q.Accounts) > 0 && quotaExhausted(q)
+			if nowExhausted && !exhausted {
+				bus.Publish(events.New(events.QuotaExhausted, 0, "",
+					fmt.Sprintf("No quota left on any of %d accounts", len(q.Accounts))))
+			}
+			exhausted = nowExhausted
 		}
 		time.Sleep(cfg.Intervals.QuotaRefresh.Duration())
 	}
 }
 
-func setupWatcher(st *state.State, cfg *config.Config, projCfg *project.Config, projectID string, logger tui.Logger) {
+// quotaExhausted reports whether every model on every account is at zero.
+func quotaExhausted(q *quota.Quota) bool {
+	for _, acc := range q.Accounts {
+		for _, remaining := range acc.Models {
+			if remaining > 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func setupWatcher(ctx context.Context, st *state.State, cfg *config.Config, projCfg *project.Config, projectID string, logger tui.Logger, bus *events.Bus) {
 	s := setup.New(cfg.MachinatorDir)
 
 	for {
@@ -477,19 +983,41 @@ func setupWatcher(st *state.State, cfg *config.Config, projCfg *project.Config,
 				// Clone repo first
 				logger.Log("setup", fmt.Sprintf("Cloning repo for project %s...", projectID))
 				id, _ := strconv.Atoi(projectID)
-				_, err := s.CloneRepo(id, projCfg.Repo, projCfg.Branch)
+				cloneCtx, cancel := withSetupTimeout(ctx, cfg)
+				_, err := s.CloneRepo(cloneCtx, id, projCfg.Repo, projCfg.Branch, projCfg.Clone)
+				cancel()
 				if err != nil {
 					logger.Log("setup", fmt.Sprintf("[red]Clone failed: %v[-]", err))
+					bus.Publish(events.New(events.SetupFailed, agent.ID, "", fmt.Sprintf("clone failed: %v", err)))
 					time.Sleep(10 * time.Second)
 					continue
 				}
 			}
 
-			// Create worktree for agent
+			// Create worktree for agent, or take over a spare one
 			id, _ := strconv.Atoi(projectID)
-			agentDir, err := s.CreateWorktree(id, agent.ID, projCfg.Branch)
+			agents := make(map[int]bool)
+			for _, a := range st.AgentsSnapshot() {
+				agents[a.ID] = true
+			}
+			agentDir, err := s.CreateWorktree(id, agent.ID, projCfg.Branch, setup.WorktreeOptions{
+				Sparse: projCfg.Clone.Sparse,
+				Keep:   projCfg.Worktrees.Keep,
+				Spare:  s.SpareWorktrees(id, agents),
+			})
 			if err != nil {
 				logger.Log("setup", fmt.Sprintf("[red]Worktree failed: %v[-]", err))
+				bus.Publish(events.New(events.SetupFailed, agent.ID, "", fmt.Sprintf("worktree failed: %v", err)))
+				time.Sleep(10 * time.Second)
+				continue
+			}
+
+			reposCtx, cancel := withSetupTimeout(ctx, cfg)
+			err = setupRepos(reposCtx, s, projCfg, id, agentDir)
+			cancel()
+			if err != nil {
+				logger.Log("setup", fmt.Sprintf("[red]Repo worktree failed: %v[-]", err))
+				bus.Publish(events.New(events.SetupFailed, agent.ID, "", fmt.Sprintf("repo worktree failed: %v", err)))
 				time.Sleep(10 * time.Second)
 				continue
 			}
@@ -499,107 +1027,1184 @@ func setupWatcher(st *state.State, cfg *config.Config, projCfg *project.Config,
 			// Mark as ready
 			st.SetAgentReady(agent.ID)
 			logger.Log("setup", fmt.Sprintf("[green]Agent %d ready[-]", agent.ID))
+			bus.Publish(events.New(events.AgentReady, agent.ID, "", ""))
 		}
 
 		time.Sleep(2 * time.Second)
 	}
 }
 
-func assigner(st *state.State, q *quota.Quota, cfg *config.Config, projCfg *project.Config, repoDir string, logger tui.Logger) {
-	for {
-		if st.AssignmentPaused {
-			time.Sleep(cfg.Intervals.Assigner.Duration())
-			continue
-		}
+// interruptContext is the context for commands run from the command line
+// in a process group of their own, out of reach of the terminal's Ctrl+C,
+// so SIGINT and SIGTERM cancel it instead.
+func interruptContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+}
 
-		readyAgents := st.ReadyAgents()
-		if len(readyAgents) == 0 {
-			time.Sleep(cfg.Intervals.Assigner.Duration())
-			continue
+// setupContext is the interruptContext for a clone, fetch or gemini build
+// run from the command line, bounded by timeouts.setup.
+func setupContext(cfg *config.Config) (context.Context, context.CancelFunc) {
+	ctx, stop := interruptContext()
+	ctx, cancel := withSetupTimeout(ctx, cfg)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
+
+// withSetupTimeout bounds a clone, fetch or gemini build by timeouts.setup.
+func withSetupTimeout(ctx context.Context, cfg *config.Config) (context.Context, context.CancelFunc) {
+	if timeout := cfg.LiveTimeouts().Setup.Duration(); timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// setupRepos checks out the project's extra repos in an agent's worktree,
+// cloning any that aren't yet.
+func setupRepos(ctx context.Context, s *setup.Setup, projCfg *project.Config, projectID int, agentDir string) error {
+	for _, r := range projCfg.Repos {
+		repoDir, err := s.CloneExtraRepo(ctx, projectID, r.Name, r.Repo, r.Branch, r.Clone)
+		if err != nil {
+			return fmt.Errorf("%s: %w", r.Name, err)
+		}
+		if _, err := setup.AddRepoWorktree(repoDir, agentDir, r.Name, r.Branch, r.Clone.Sparse); err != nil {
+			return fmt.Errorf("%s: %w", r.Name, err)
+		}
+	}
+	return nil
+}
+
+func assigner(st *state.State, q *quota.Quota, cfg *config.Config, projCfg *project.Config, projectID, repoDir string, rng *rand.Rand, logger tui.Logger, bus *events.Bus) {
+	worked := false  // Assigned something since the queue last drained
+	stalled := false // Reported a stall that hasn't cleared yet
+	var staleChecked time.Time
+	stale := "" // Why tasks aren't being assigned from a stale clone
+	var safeguardChecked time.Time
+	held := "" // Why the safeguards hold back tasks
+	for {
+		// Manual assignments from the TUI go through even while paused
+		for agentID, taskID := range st.TakeAssignRequests() {
+			task := findTask(projCfg, repoDir, taskID)
+			if task == nil {
+				logger.Log("assign", fmt.Sprintf("[red]Agent %d: task %s not found[-]", agentID, taskID))
+				continue
+			}
+			logger.Log("assign", fmt.Sprintf("[green]Agent %d: ASSIGNED[-] %s (%s) by hand", agentID, task.ID, task.Title))
+			st.AssignTask(agentID, task.ID, "")
+			worked = true
+			bus.Publish(events.New(events.TaskAssigned, agentID, task.ID, task.Title+" (manual)"))
+		}
+
+		if st.AssignmentIsPaused() {
+			st.Sleep(cfg.Intervals.Assigner.Duration())
+			continue
+		}
+
+		readyAgents := st.ReadyAgents()
+		if len(readyAgents) == 0 {
+			st.Sleep(cfg.Intervals.Assigner.Duration())
+			continue
+		}
+
+		// Don't start work the disk or battery can't see through
+		if time.Since(safeguardChecked) >= safeguardCheckInterval {
+			safeguardChecked = time.Now()
+			msg := safeguard.Check(cfg.MachinatorDir, cfg.Safeguards.MinFreeDiskMB, cfg.Safeguards.MinBattery)
+			if msg != "" && msg != held {
+				logger.Log("assign", fmt.Sprintf("[red]Not assigning tasks: %s[-]", msg))
+				bus.Publish(events.New(events.LowResources, 0, "", msg))
+			} else if msg == "" && held != "" {
+				logger.Log("assign", "[green]Safeguards clear, assigning tasks again[-]")
+			}
+			held = msg
+			st.SetHold(msg)
+		}
+		if st.Hold() != "" {
+			st.Sleep(cfg.Intervals.Assigner.Duration())
+			continue
+		}
+
+		// Don't hand out work against a clone that's fallen too far behind
+		if projCfg.Staleness.Enabled() && time.Since(staleChecked) >= staleCheckInterval {
+			staleChecked = time.Now()
+			msg := checkStaleness(projCfg, repoDir, logger)
+			if msg != "" && msg != stale {
+				logger.Log("assign", fmt.Sprintf("[red]Not assigning tasks: %s[-]", msg))
+				bus.Publish(events.New(events.StaleClone, 0, "", msg))
+			} else if msg == "" && stale != "" {
+				logger.Log("assign", "[green]Clone synced, assigning tasks again[-]")
+			}
+			stale = msg
+		}
+		if stale != "" {
+			st.Sleep(cfg.Intervals.Assigner.Duration())
+			continue
 		}
 
 		// Load tasks
-		tasks, err := beads.LoadTasks(repoDir)
+		chaos.Delay()
+		tasks, err := tracker.LoadTasks(projCfg, repoDir)
 		if err != nil {
 			logger.Log("assign", fmt.Sprintf("Error loading tasks: %v", err))
-			time.Sleep(cfg.Intervals.Assigner.Duration())
+			st.Sleep(cfg.Intervals.Assigner.Duration())
 			continue
 		}
 
 		readyTasks := beads.ReadyTasks(tasks)
 		if len(readyTasks) == 0 {
-			time.Sleep(cfg.Intervals.Assigner.Duration())
+			idle := len(st.AssignedAgents()) == 0
+			switch {
+			case idle && beads.Stalled(tasks):
+				// Nothing running will free the open work: say why, once
+				if !stalled {
+					reportStall(tasks, logger, bus)
+					stalled, worked = true, false
+				}
+			case worked && idle:
+				logger.Log("assign", "[green]All ready tasks done[-]")
+				bus.Publish(events.New(events.AllTasksDone, 0, "", ""))
+				worked = false
+			}
+			st.Sleep(cfg.Intervals.Assigner.Duration())
 			continue
 		}
+		stalled = false
 
-		// Get quota info for model selection
-		simpleQuota := q.TotalFor(projCfg.SimpleModelName)
-		complexQuota := q.TotalFor(projCfg.ComplexModelName)
-
+		running := st.ModelCounts()
 		for _, agent := range readyAgents {
+			// Quota of the accounts this agent may use, for model selection
+			aq := q.For(projectID, agent.ID)
+			simpleModel, complexModel := projCfg.Models()
+			simpleQ := aq.TotalFor(simpleModel)
+			complexQ := aq.TotalFor(complexModel)
+
+			// A model at its concurrency limit counts as out of quota
+			if scheduler.AtModelLimit(projCfg, running, simpleModel) {
+				simpleQ = 0
+			}
+			if scheduler.AtModelLimit(projCfg, running, complexModel) {
+				complexQ = 0
+			}
+
 			// Find a task to assign (weighted selection)
-			task := selectTask(readyTasks, simpleQuota, complexQuota, st)
+			task := scheduler.Select(readyTasks, simpleQ, complexQ, st, rng)
 			if task == nil {
-				break
+				continue // Another agent may have accounts this one can't use
 			}
 
-			// Determine model
-			model := projCfg.SimpleModelName
-			if task.IsComplex {
-				model = projCfg.ComplexModelName
-			} else if simpleQuota <= 0 && complexQuota > 0 {
-				model = projCfg.ComplexModelName // Upgrade
+			// A --batch run starts no more than its tasks
+			if !st.TakeBatchSlot() {
+				break
 			}
 
+			model := scheduler.Model(projCfg, task, simpleQ, complexQ)
+
 			logger.Log("assign", fmt.Sprintf("[green]Agent %d: ASSIGNED[-] %s (%s) → %s",
 				agent.ID, task.ID, task.Title, model))
 
 			// Update agent state (auto-saves)
-			st.AssignTask(agent.ID, task.ID)
+			st.AssignTask(agent.ID, task.ID, model)
+			running[model]++
+			worked = true
+			bus.Publish(events.New(events.TaskAssigned, agent.ID, task.ID, fmt.Sprintf("%s → %s", task.Title, model)))
 
 			// Remove task from ready list (for this iteration)
-			readyTasks = removeTask(readyTasks, task.ID)
+			readyTasks = scheduler.Remove(readyTasks, task.ID)
 		}
 
-		time.Sleep(cfg.Intervals.Assigner.Duration())
+		st.Sleep(cfg.Intervals.Assigner.Duration())
 	}
 }
 
-func selectTask(tasks []*beads.Task, simpleQuota, complexQuota float64, st *state.State) *beads.Task {
-	for _, task := range tasks {
-		// Skip barred tasks
-		if st.IsTaskBarred(task.ID) {
-			continue
+// keepUncommitted saves the changes an agent left uncommitted before its
+// worktree is reset, unless they're minor enough for the project to throw
+// away. Returns where they were saved, or "".
+func keepUncommitted(s *setup.Setup, projCfg *project.Config, taskID, worktreeDir string) (string, error) {
+	diff, err := setup.WorktreeDiff(worktreeDir, projCfg.IgnoreChanges)
+	if err != nil || len(diff) == 0 {
+		return "", err
+	}
+	if projCfg.Uncommitted.Minor(setup.DiffSize(diff)) {
+		return "", nil
+	}
+	return s.SaveDiscarded(taskID, diff)
+}
+
+// safeguardCheckInterval is how often the assigner checks free disk and
+// battery.
+const safeguardCheckInterval = 30 * time.Second
+
+// staleCheckInterval is how often the assigner fetches to see how far the
+// project clone is behind.
+const staleCheckInterval = time.Minute
+
+// checkStaleness compares the project clone with origin/<branch> and, past
+// the configured limits, syncs it or returns why tasks shouldn't be
+// assigned from it. A failed fetch is logged and doesn't block.
+func checkStaleness(projCfg *project.Config, repoDir string, logger tui.Logger) string {
+	behind, err := setup.BehindRemote(repoDir, projCfg.Branch)
+	if err != nil {
+		logger.Log("assign", fmt.Sprintf("[yellow]Check clone staleness: %v[-]", err))
+		return ""
+	}
+	if !projCfg.Staleness.Exceeded(behind.Commits, behind.Age) {
+		return ""
+	}
+	desc := fmt.Sprintf("%d commit(s) behind origin/%s, the oldest missed %s ago",
+		behind.Commits, projCfg.Branch, behind.Age.Round(time.Minute))
+	if projCfg.Staleness.Action == project.StaleBlock {
+		return fmt.Sprintf("clone is %s; sync it with git -C %s pull --ff-only", desc, repoDir)
+	}
+	if err := setup.SyncRepo(repoDir, projCfg.Branch); err != nil {
+		return fmt.Sprintf("clone is %s and syncing failed: %v", desc, err)
+	}
+	logger.Log("assign", fmt.Sprintf("[yellow]Synced clone, it was %s[-]", desc))
+	return ""
+}
+
+// reportStall logs why open tasks can't become ready and emits Stalled.
+func reportStall(tasks []*beads.Task, logger tui.Logger, bus *events.Bus) {
+	open := 0
+	for _, t := range tasks {
+		if t.Status != "closed" {
+			open++
 		}
+	}
+	problems := beads.Diagnose(tasks, nil)
+	logger.Log("assign", fmt.Sprintf("[yellow]Stalled: %d open tasks, none ready[-] (W in the TUI for details)", open))
+	for _, p := range problems {
+		line := "  " + p.Detail
+		if p.Fix != "" {
+			line += " [gray]→ " + p.Fix + "[-]"
+		}
+		logger.Log("assign", line)
+	}
 
-		// Skip tasks already assigned to another agent
-		if st.IsTaskAssigned(task.ID) {
-			continue
+	msg := fmt.Sprintf("%d open tasks, none ready", open)
+	if len(problems) > 0 {
+		msg += ": " + problems[0].Detail
+	}
+	bus.Publish(events.New(events.Stalled, 0, "", msg))
+}
+
+func agentWatcher(ctx context.Context, st *state.State, q *quota.Quota, cfg *config.Config, projCfg *project.Config, projectID, repoDir string, logger tui.Logger, bus *events.Bus) {
+	var mu sync.Mutex
+	watching := make(map[int]bool) // Agents with a running watchAgent
+
+	for {
+		for _, a := range st.AssignedAgents() {
+			mu.Lock()
+			if watching[a.ID] {
+				mu.Unlock()
+				continue
+			}
+			watching[a.ID] = true
+			mu.Unlock()
+
+			go func(agentID int, taskID string) {
+				watchAgent(ctx, st, q, cfg, projCfg, projectID, repoDir, agentID, taskID, logger, bus)
+				mu.Lock()
+				delete(watching, agentID)
+				mu.Unlock()
+			}(a.ID, a.TaskID)
 		}
 
-		// Check quota
-		if task.IsComplex && complexQuota <= 0 {
+		time.Sleep(cfg.Intervals.AgentWatch.Duration())
+	}
+}
+
+// watchAgent runs one assigned task to completion, failure, or timeout and
+// then returns the agent to the ready pool. Once ctx is done it kills the
+// agent and returns, leaving the run open.
+func watchAgent(ctx context.Context, st *state.State, q *quota.Quota, cfg *config.Config, projCfg *project.Config, projectID, repoDir string, agentID int, taskID string, logger tui.Logger, bus *events.Bus) {
+	source := fmt.Sprintf("agent-%d", agentID)
+	s := setup.New(cfg.MachinatorDir)
+	id, _ := strconv.Atoi(projectID)
+	worktreeDir := project.AgentDir(cfg.MachinatorDir, projectID, agentID)
+	scratchDir := project.ScratchDir(cfg.MachinatorDir, projectID, taskID)
+
+	// With merging on, the task is worked on its own branch and merged once complete
+	pushBranch := projCfg.Branch
+	if projCfg.Merge.Mode != "" {
+		pushBranch = project.TaskBranch(taskID)
+	}
+
+	// Issue tracker to report progress to, if tasks don't come from beads
+	tr, err := tracker.For(projCfg)
+	if err != nil {
+		logger.Log(source, fmt.Sprintf("[red]Tracker: %v[-]", err))
+	}
+	if tr != nil {
+		tr = tracker.InBranch(tr, worktreeDir, pushBranch) // Task files are updated on the agent's branch
+	}
+
+	// Record the outcome of the run once it has started
+	var runID int64
+	finish := func(outcome, msg string) {
+		if runID == 0 {
+			return
+		}
+		tokens := agent.Tokens(cfg.MachinatorDir, agentID)
+		if err := st.DB().FinishRun(runID, outcome, msg, tokens); err != nil {
+			logger.Log(source, fmt.Sprintf("[yellow]Record run: %v[-]", err))
+		}
+		if tokens > 0 {
+			st.AddTokens(tokens)
+			logger.Log(source, fmt.Sprintf("Run used %d tokens", tokens))
+		}
+	}
+
+	// Bar the task once it has used up its attempts
+	giveUp := func() {
+		maxAttempts := cfg.TaskAttempts()
+		if runID == 0 || maxAttempts == 0 {
+			return
+		}
+		attempts, err := st.DB().FailedAttempts(taskID)
+		if err != nil {
+			logger.Log(source, fmt.Sprintf("[yellow]Count attempts: %v[-]", err))
+			return
+		}
+		if scheduler.GiveUp(attempts, maxAttempts) {
+			st.BarTaskAndSave(taskID, fmt.Sprintf("gave up after %d failed attempts", attempts))
+			os.RemoveAll(scratchDir)
+			// Finished pieces of the last attempt can still be kept
+			msg := fmt.Sprintf("gave up after %d failed attempts, task barred (machinator task split %s keeps part of it)", attempts, taskID)
+			logger.Log(source, fmt.Sprintf("[red]%s: %s[-]", taskID, msg))
+			bus.Publish(events.New(events.TaskAbandoned, agentID, taskID, msg))
+		}
+	}
+
+	// Keep what the attempt did so the retry's directive can show it
+	var testOutput string // Set by a failed test gate
+	recordFailure := func(reason string) {
+		if runID == 0 {
+			return
+		}
+		f := setup.Failure{
+			Time:   time.Now(),
+			Reason: reason,
+			Events: agent.TailLog(cfg.MachinatorDir, agentID, failureContextEvents),
+		}
+		if diff, err := setup.WorktreeDiff(worktreeDir, projCfg.IgnoreChanges); err == nil {
+			f.Diff = string(diff)
+		}
+		f.TestOutput = testOutput
+		if err := setup.SaveSnapshot(worktreeDir, taskID); err != nil {
+			logger.Log(source, fmt.Sprintf("[yellow]Save attempt snapshot: %v[-]", err))
+		}
+		if err := s.SaveFailure(id, taskID, f); err != nil {
+			logger.Log(source, fmt.Sprintf("[yellow]Record failure: %v[-]", err))
+		}
+	}
+
+	// Put a tracker issue back in the queue once its run has ended without completing
+	release := func() {
+		if tr == nil || runID == 0 {
+			return
+		}
+		if err := tr.Release(taskID); err != nil {
+			logger.Log(source, fmt.Sprintf("[yellow]%s: %v[-]", tr.Name(), err))
+		}
+	}
+
+	// Run one of the project's hooks in the worktree, keeping its output in
+	// the transcript. prepared is set once the worktree is ready for them.
+	var prepared bool
+	var taskTitle string
+	hookEnv := func(name string) []string {
+		return []string{
+			"MACHINATOR_HOOK=" + name,
+			"MACHINATOR_TASK_ID=" + taskID,
+			"MACHINATOR_TASK_TITLE=" + taskTitle,
+			"MACHINATOR_AGENT_ID=" + strconv.Itoa(agentID),
+			"MACHINATOR_PROJECT_ID=" + projectID,
+			"MACHINATOR_BRANCH=" + pushBranch,
+			"MACHINATOR_SCRATCH_DIR=" + scratchDir,
+		}
+	}
+	record := func(ev *hookEvent) {
+		if err := transcript.Append(cfg.MachinatorDir, taskID, agentID, runID, ev); err != nil {
+			logger.Log(source, fmt.Sprintf("[yellow]Transcript: %v[-]", err))
+		}
+	}
+	hook := func(name, command, failure string) error {
+		env := hookEnv(name)
+		if failure != "" {
+			env = append(env, "MACHINATOR_FAILURE_REASON="+failure)
+		}
+		ev, err := runHook(ctx, name, command, worktreeDir, env, projCfg.Hooks.Timeout.Duration())
+		if ev == nil {
+			return nil
+		}
+		record(ev)
+		if err != nil {
+			for _, line := range lastLines(ev.Output, 5) {
+				logger.Log(source, fmt.Sprintf("[yellow]  %s[-]", line))
+			}
+			return fmt.Errorf("%s hook: %w", name, err)
+		}
+		logger.Log(source, fmt.Sprintf("%s hook passed (%s)", name, ev.Duration))
+		return nil
+	}
+
+	// Run the tests on a task the agent has closed, keeping the end of
+	// their output for the retry if they fail
+	testGate := func() error {
+		workDir := filepath.Join(worktreeDir, projCfg.Scope)
+		command := projCfg.TestCommand
+		if command == "" {
+			command = directive.DetectTestCommand(workDir)
+		}
+		if command == "" {
+			logger.Log(source, "[yellow]Test gate: no test command found, skipped[-]")
+			return nil
+		}
+		run := func() (*hookEvent, error) {
+			ev, err := runHook(ctx, "test_gate", command, workDir, hookEnv("test_gate"), projCfg.TestGate.Timeout.Duration())
+			record(ev)
+			return ev, err
+		}
+		logger.Log(source, fmt.Sprintf("Test gate: %s", command))
+		ev, err := run()
+		if err == nil {
+			logger.Log(source, fmt.Sprintf("[green]Tests passed (%s)[-]", ev.Duration))
+			return nil
+		}
+
+		// Rerun until the results disagree, to tell flaky tests from real failures
+		runs := []flaky.Run{{Failed: flaky.FailedTests(ev.Output)}}
+		reruns := projCfg.TestGate.Reruns
+		for i := 1; i <= reruns && !runs[len(runs)-1].Passed; i++ {
+			logger.Log(source, fmt.Sprintf("[yellow]Tests failed, rerunning (%d/%d)[-]", i, reruns))
+			rerun, rerr := run()
+			runs = append(runs, flaky.Run{Passed: rerr == nil, Failed: flaky.FailedTests(rerun.Output)})
+		}
+		failing, flakyTests, ok := flaky.Compare(runs)
+		if ok && len(flakyTests) == 0 {
+			flakyTests = []string{command} // Came and went without naming a test
+		}
+		if len(runs) > 1 {
+			for _, name := range flakyTests {
+				id, err := fileFlakyTest(projCfg, repoDir, taskID, taskTitle, name, command, len(runs), ev.Output)
+				if err != nil {
+					logger.Log(source, fmt.Sprintf("[yellow]File flaky test %s: %v[-]", name, err))
+				} else {
+					logger.Log(source, fmt.Sprintf("[yellow]Flaky test %s: %s[-]", name, id))
+				}
+			}
+		}
+		if ok {
+			logger.Log(source, fmt.Sprintf("[yellow]Tests passed apart from flaky ones, accepting %s[-]", taskID))
+			return nil
+		}
+
+		testOutput = strings.Join(lastLines(ev.Output, testGateOutputLines), "\n")
+		if len(failing) > 0 {
+			return fmt.Errorf("tests failed (%s): %s", command, strings.Join(failing, ", "))
+		}
+		return fmt.Errorf("tests failed (%s): %w", command, err)
+	}
+
+	fail := func(msg string) {
+		logger.Log(source, fmt.Sprintf("[red]%s[-]", msg))
+		bus.Publish(events.New(events.TaskFailed, agentID, taskID, msg))
+		if prepared {
+			if err := hook("on_failure", projCfg.Hooks.OnFailure, msg); err != nil {
+				logger.Log(source, fmt.Sprintf("[yellow]%v[-]", err))
+			}
+		}
+		recordFailure(msg)
+		finish(rundb.OutcomeFailed, msg)
+		release()
+		giveUp()
+		st.CompleteTask(agentID)
+	}
+
+	// Assigned agents wait here while launches are paused
+	for st.LaunchesArePaused() {
+		time.Sleep(cfg.Intervals.Assigner.Duration())
+	}
+
+	task := findTask(projCfg, repoDir, taskID)
+	if task == nil {
+		fail(fmt.Sprintf("Task %s not found", taskID))
+		return
+	}
+	taskTitle = task.Title
+
+	var assigned string
+	if a := st.GetAgent(agentID); a != nil {
+		assigned = a.Model
+	}
+	model, account, reason, err := agent.SelectModelAndAccount(q.For(projectID, agentID), projCfg, task, assigned)
+	if err != nil {
+		fail(fmt.Sprintf("No account for %s: %v", taskID, err))
+		return
+	}
+	logger.Log(source, fmt.Sprintf("Account %s for %s: %s", account.Name, taskID, reason))
+	st.SetAgentModel(agentID, model)
+
+	// Start from a clean worktree, optionally restoring an interrupted attempt
+	resetWorktree := func() error {
+		if err := s.ResetWorktree(worktreeDir, projCfg.Branch, projCfg.Worktrees.Keep); err != nil {
+			return err
+		}
+		for _, r := range projCfg.Repos {
+			dir := filepath.Join(worktreeDir, project.ReposDir, r.Name)
+			if _, err := os.Stat(dir); err != nil {
+				reposCtx, cancel := withSetupTimeout(ctx, cfg)
+				err := setupRepos(reposCtx, s, projCfg, id, worktreeDir) // Added since the agent was set up
+				cancel()
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			if err := s.ResetWorktree(dir, r.Branch, projCfg.Worktrees.Keep); err != nil {
+				return fmt.Errorf("%s: %w", r.Name, err)
+			}
+		}
+		if pushBranch != projCfg.Branch {
+			return setup.StartTaskBranch(worktreeDir, pushBranch)
+		}
+		return nil
+	}
+	if err := resetWorktree(); err != nil {
+		fail(fmt.Sprintf("Reset worktree: %v", err))
+		return
+	}
+
+	// Scratch space survives retries (downloads stay useful) until the task is done
+	if err := os.MkdirAll(scratchDir, 0755); err != nil {
+		fail(fmt.Sprintf("Create scratch dir: %v", err))
+		return
+	}
+	prepared = true
+
+	data := directiveData(st, projCfg, task, agentID, project.Dir(cfg.MachinatorDir, projectID), worktreeDir, scratchDir)
+	if data.DoneFile != "" {
+		os.Remove(data.DoneFile) // Left by an attempt that didn't complete
+	}
+	if projCfg.ResumeMode == project.ResumeCheckpoint {
+		diff, err := s.LoadCheckpoint(id, task.ID)
+		if err != nil {
+			logger.Log(source, fmt.Sprintf("[yellow]Load checkpoint: %v[-]", err))
+		} else if diff != "" {
+			if err := s.RestoreCheckpoint(id, task.ID, worktreeDir); err != nil {
+				if resetErr := resetWorktree(); resetErr != nil {
+					fail(fmt.Sprintf("Restore checkpoint: %v; reset worktree: %v", err, resetErr))
+					return
+				}
+				logger.Log(source, fmt.Sprintf("[yellow]Restore checkpoint failed, starting clean: %v[-]", err))
+			} else {
+				logger.Log(source, fmt.Sprintf("Resumed %s from checkpoint", task.ID))
+				data.PreviousChanges = diff
+				data.PreviousReason = "timed out"
+			}
+		}
+	}
+	if err := addFailureContext(&data, s, id, task.ID); err != nil {
+		logger.Log(source, fmt.Sprintf("[yellow]Load failure context: %v[-]", err))
+	}
+	// Show what the last attempt tried against the branch it starts over from
+	if data.FailureReason != "" && data.PreviousChanges == "" {
+		stat, diff, err := setup.SnapshotDiff(worktreeDir, task.ID, projCfg.IgnoreChanges)
+		if err != nil {
+			logger.Log(source, fmt.Sprintf("[yellow]Diff previous attempt: %v[-]", err))
+		} else if stat != "" {
+			summary := stat[strings.LastIndex(stat, "\n")+1:]
+			logger.Log(source, fmt.Sprintf("Previous attempt at %s: %s", task.ID, strings.TrimSpace(summary)))
+			data.AttemptStat = stat
+			data.AttemptChanges = diff
+		}
+	}
+
+	tmpl, tmplSource, err := directive.LoadTemplate(worktreeDir, project.Dir(cfg.MachinatorDir, projectID))
+	if err != nil {
+		fail(fmt.Sprintf("Load directive template: %v", err))
+		return
+	}
+	// Remote agents run on the project's host, in mirrors of their directories
+	var remote *agent.Remote
+	shown := data
+	if projCfg.Remote.Host != "" {
+		if remote, err = agent.DialRemote(projCfg.Remote, cfg.MachinatorDir); err != nil {
+			fail(fmt.Sprintf("Remote: %v", err))
+			return
+		}
+		shown.WorktreeDir = remote.Path(data.WorktreeDir)
+		shown.ScratchDir = remote.Path(data.ScratchDir)
+		if data.DoneFile != "" {
+			shown.DoneFile = remote.Path(data.DoneFile)
+		}
+	}
+	prompt, err := directive.Build(tmpl, shown)
+	if err != nil {
+		fail(fmt.Sprintf("Build directive (%s): %v", tmplSource, err))
+		return
+	}
+
+	// Hosts the repo's committed sandbox profile lets agents reach
+	sandbox, sandboxWarnings, err := project.LoadSandboxProfile(worktreeDir)
+	if err != nil {
+		fail(fmt.Sprintf("Sandbox profile: %v", err))
+		return
+	}
+	for _, w := range sandboxWarnings {
+		logger.Log(source, fmt.Sprintf("[yellow]Warning: %s[-]", w))
+	}
+
+	// The run starts with its pre_task hook, so a failing one uses up attempts
+	startRun := func() {
+		if runID, err = st.DB().StartRun(task.ID, agentID, model, account.Name); err != nil {
+			logger.Log(source, fmt.Sprintf("[yellow]Record run: %v[-]", err))
+		}
+	}
+	if projCfg.Hooks.PreTask != "" {
+		startRun()
+		if err := hook("pre_task", projCfg.Hooks.PreTask, ""); err != nil {
+			fail(fmt.Sprintf("%s %v", task.ID, err))
+			return
+		}
+	}
+
+	proc, err := agent.Gemini.Launch(ctx, agent.LaunchOptions{
+		MachinatorDir: cfg.MachinatorDir,
+		AgentID:       agentID,
+		WorktreeDir:   worktreeDir,
+		Model:         model,
+		Account:       account,
+		Directive:     prompt,
+		ScratchDir:    scratchDir,
+		Scope:         projCfg.Scope,
+		DockerImage:   projCfg.Docker.Image,
+		Remote:        remote,
+		Hosts:         sandbox.Hosts,
+	})
+	if err != nil {
+		fail(fmt.Sprintf("Launch: %v", err))
+		return
+	}
+	st.SetAgentPID(agentID, proc.PID())
+	if runID == 0 {
+		startRun()
+	}
+	logger.Log(source, fmt.Sprintf("Started %s on %s (%s, pid %d)", task.ID, model, account.Name, proc.PID()))
+	if tr != nil {
+		if err := tr.Start(task.ID); err != nil {
+			logger.Log(source, fmt.Sprintf("[yellow]%s: %v[-]", tr.Name(), err))
+		}
+	}
+
+	logPath := agent.LogPath(cfg.MachinatorDir, agentID)
+	rec, err := transcript.NewRecorder(cfg.MachinatorDir, task.ID, logPath, agentID, runID)
+	if err != nil {
+		logger.Log(source, fmt.Sprintf("[yellow]Transcript: %v[-]", err))
+	} else {
+		defer rec.Close()
+	}
+	var lastSize int64
+
+	ticker := time.NewTicker(cfg.Intervals.AgentWatch.Duration())
+	defer ticker.Stop()
+
+	// Push task changes the agent left uncommitted before the worktree is reset
+	syncBeads := func() {
+		msg := fmt.Sprintf("bd sync: %s (agent %d)", task.ID, agentID)
+		if pushed, err := beads.SyncWorktree(worktreeDir, pushBranch, msg); err != nil {
+			logger.Log(source, fmt.Sprintf("[red]Sync beads: %v[-]", err))
+		} else if pushed {
+			logger.Log(source, "Pushed uncommitted task changes")
+		}
+	}
+
+	for {
+		select {
+		case exitErr := <-proc.Done():
+			if ctx.Err() != nil {
+				return // Shutting down
+			}
+			syncBeads()
+			leftover, err := setup.UncommittedFiles(worktreeDir, projCfg.IgnoreChanges)
+			if err != nil {
+				logger.Log(source, fmt.Sprintf("[yellow]Check uncommitted changes: %v[-]", err))
+			}
+			kept := ""
+			if len(leftover) > 0 {
+				if kept, err = keepUncommitted(s, projCfg, task.ID, worktreeDir); err != nil {
+					logger.Log(source, fmt.Sprintf("[red]Save uncommitted changes: %v[-]", err))
+				}
+			}
+			closed := taskClosed(worktreeDir, task.ID)
+			if tr != nil {
+				_, err := os.Stat(data.DoneFile)
+				closed = err == nil
+			}
+			if closed && projCfg.TestGate.Enabled {
+				if err := testGate(); err != nil {
+					// Only a close pushed straight to the branch needs undoing
+					if tr == nil && pushBranch == projCfg.Branch {
+						if rerr := beads.Reopen(repoDir, projCfg.Branch, task.ID); rerr != nil {
+							logger.Log(source, fmt.Sprintf("[red]Reopen %s: %v[-]", task.ID, rerr))
+						}
+					}
+					fail(fmt.Sprintf("%s %v", task.ID, err))
+					return
+				}
+			}
+			completed := closed
+			if tr != nil {
+				completed = trackerDone(tr, data.DoneFile, task.ID, agentID, logger)
+			}
+			if completed {
+				if err := hook("post_task", projCfg.Hooks.PostTask, ""); err != nil {
+					if pushBranch != projCfg.Branch {
+						fail(fmt.Sprintf("%s %v", task.ID, err))
+						return
+					}
+					// Without a task branch the agent has already pushed its work
+					logger.Log(source, fmt.Sprintf("[red]%s %v (already pushed)[-]", task.ID, err))
+				}
+			}
+			review := "" // The pull request opened for the task branch
+			if completed && projCfg.Merge.Mode == project.MergePullRequest {
+				pr, err := openPullRequest(projCfg, task, worktreeDir, pushBranch, agentID)
+				if err != nil {
+					fail(fmt.Sprintf("Open pull request for %s: %v", pushBranch, err))
+					return
+				}
+				// Still open on the branch until the pull request merges
+				review = pr.URL
+				st.BarTaskAndSave(task.ID, "in review: "+pr.URL)
+				logger.Log(source, fmt.Sprintf("Opened %s for %s", pr.URL, pushBranch))
+			} else if completed && pushBranch != projCfg.Branch {
+				mergeOnce := func() error {
+					return setup.MergeTaskBranch(ctx, worktreeDir, projCfg.Branch, pushBranch, setup.MergeOptions{
+						Squash:  projCfg.Merge.Mode == project.MergeSquash,
+						Message: fmt.Sprintf("%s: %s", task.ID, task.Title),
+						Command: projCfg.Merge.Command,
+						Timeout: cfg.LiveTimeouts().MaxRuntime.Duration(),
+						Scope:   projCfg.Scope,
+					})
+				}
+				merge := mergeOnce
+				if cfg.FeatureEnabled("merge_queue") {
+					merge = func() error {
+						return merges.Run(mergeOnce, func(ahead int) {
+							logger.Log(source, fmt.Sprintf("Merge of %s queued behind %d", pushBranch, ahead))
+						})
+					}
+				}
+				err := merge()
+				var mergeErr *setup.MergeError
+				if errors.As(err, &mergeErr) && mergeErr.Conflict && projCfg.Merge.ResolveConflicts {
+					// Out of the queue while the agent works, then back in
+					if resolveConflict(ctx, st, cfg, projCfg, task, pushBranch, worktreeDir, agentID, model, account, logger, source) {
+						err = merge()
+					}
+				}
+				switch {
+				case errors.As(err, &mergeErr):
+					// Left for a person to merge; barred so it isn't redone meanwhile
+					reason, _, _ := strings.Cut(mergeErr.Reason, "\n")
+					resolving := false
+					if mergeErr.Conflict {
+						// Conflicts become a task of their own, for an agent or a person
+						id, err := tracker.Create(projCfg, repoDir, conflictTask(projCfg, task, pushBranch, mergeErr))
+						if err != nil {
+							logger.Log(source, fmt.Sprintf("[yellow]Add conflict task: %v[-]", err))
+						}
+						if id != "" {
+							reason += ", resolving in " + id
+							resolving = true
+						}
+					}
+					st.BarTaskAndSave(task.ID, "needs human: "+reason)
+					logger.Log(source, fmt.Sprintf("[red]%s needs human: %s[-]", task.ID, reason))
+					bus.Publish(events.New(events.MergeFailed, agentID, task.ID, mergeErr.Reason))
+					finish(rundb.OutcomeFailed, "needs human: "+reason)
+					if !resolving {
+						release() // Otherwise the work is done, only its merge isn't
+					}
+					st.CompleteTask(agentID)
+					return
+				case err != nil:
+					fail(fmt.Sprintf("Merge %s: %v", pushBranch, err))
+					return
+				}
+				logger.Log(source, fmt.Sprintf("Merged %s into %s", pushBranch, projCfg.Branch))
+			}
+			if completed {
+				if kept != "" {
+					logger.Log(source, fmt.Sprintf("[yellow]%s left %d uncommitted file(s), saved to %s: %s[-]",
+						task.ID, len(leftover), kept, strings.Join(leftover, ", ")))
+				} else if len(leftover) > 0 {
+					logger.Log(source, fmt.Sprintf("[yellow]%s left %d uncommitted file(s), discarding: %s[-]",
+						task.ID, len(leftover), strings.Join(leftover, ", ")))
+				}
+				logger.Log(source, fmt.Sprintf("[green]Completed %s[-]", task.ID))
+				recordDecisions(cfg.MachinatorDir, projectID, task.ID, runID, rec, logger, source)
+				bus.Publish(events.New(events.TaskCompleted, agentID, task.ID, task.Title))
+				s.RemoveCheckpoint(id, task.ID)
+				s.RemoveFailure(id, task.ID)
+				setup.RemoveSnapshot(worktreeDir, task.ID)
+				os.RemoveAll(scratchDir)
+				finish(rundb.OutcomeCompleted, review)
+				st.CompleteTask(agentID)
+				return
+			}
+			reason := "exited without closing task"
+			if exitErr != nil {
+				reason = fmt.Sprintf("exited: %v", exitErr)
+			}
+			if kept != "" {
+				reason += fmt.Sprintf(" (%d uncommitted file(s), saved to %s)", len(leftover), kept)
+			} else if len(leftover) > 0 {
+				reason += fmt.Sprintf(" (%d uncommitted file(s))", len(leftover))
+			}
+			fail(fmt.Sprintf("%s %s", task.ID, reason))
+			return
+		case <-ticker.C:
+		}
+
+		if chaos.KillAgent() {
+			logger.Log(source, fmt.Sprintf("[fuchsia]chaos: killing pid %d[-]", proc.PID()))
+			proc.Kill()
 			continue
 		}
-		if !task.IsComplex && simpleQuota <= 0 && complexQuota <= 0 {
+
+		// Log growth counts as activity
+		chaos.DelayEvents()
+		if info, err := os.Stat(logPath); err == nil && info.Size() > lastSize {
+			lastSize = info.Size()
+			st.UpdateActivity(agentID)
+			if rec != nil {
+				if err := rec.Poll(); err != nil {
+					logger.Log(source, fmt.Sprintf("[yellow]Transcript: %v[-]", err))
+				}
+			}
+		}
+
+		a := st.GetAgent(agentID)
+		if a == nil {
+			proc.Kill()
+			return
+		}
+
+		if req := st.TakeStopRequest(agentID); req != "" {
+			proc.Kill()
+			<-proc.Done()
+			syncBeads()
+			switch req {
+			case state.StopRestart:
+				// Still assigned, so agentWatcher launches it again from a clean worktree
+				logger.Log(source, fmt.Sprintf("[yellow]Restarting %s[-]", task.ID))
+				finish(rundb.OutcomeStopped, "restarted from TUI")
+				st.AssignTask(agentID, task.ID, model)
+			case state.StopReassign:
+				logger.Log(source, fmt.Sprintf("[yellow]Released %s for reassignment[-]", task.ID))
+				finish(rundb.OutcomeStopped, "reassigned from TUI")
+				release()
+				st.CompleteTask(agentID)
+			default:
+				// Cool down first so the assigner can't pick it straight back up
+				cooldown := cfg.LiveTimeouts().KillCooldown.Duration()
+				st.CoolDown(task.ID, cooldown)
+				fail(fmt.Sprintf("%s killed from TUI (cooldown %s)", task.ID, cooldown))
+			}
+			return
+		}
+
+		timeouts := cfg.LiveTimeouts()
+		reason := scheduler.TimedOut(time.Now(), a.StartedAt, a.LastActivity, timeouts.Idle.Duration(), timeouts.MaxRuntime.Duration())
+		if reason == "" {
 			continue
 		}
 
-		// For now, just return the first available task
-		// TODO: weighted random selection
-		return task
+		proc.Kill()
+		<-proc.Done()
+		syncBeads()
+		if err := hook("on_failure", projCfg.Hooks.OnFailure, reason); err != nil {
+			logger.Log(source, fmt.Sprintf("[yellow]%v[-]", err))
+		}
+
+		// Keep the interrupted work so a retry can resume from it
+		msg := reason
+		if saved, err := s.SaveCheckpoint(id, task.ID, worktreeDir, projCfg.IgnoreChanges); err != nil {
+			logger.Log(source, fmt.Sprintf("[red]Checkpoint failed: %v[-]", err))
+		} else if saved {
+			msg += ", checkpoint saved"
+		}
+		logger.Log(source, fmt.Sprintf("[yellow]Killed %s: %s[-]", task.ID, msg))
+		bus.Publish(events.New(events.TaskTimedOut, agentID, task.ID, msg))
+		recordFailure(reason)
+		finish(rundb.OutcomeTimedOut, msg)
+		release()
+		giveUp()
+		st.CompleteTask(agentID)
+		return
+	}
+}
+
+// relevantCode returns the indexed code most relevant to a task, updating
+// the project's index from the worktree first. Empty unless context_index
+// is on.
+func relevantCode(projCfg *project.Config, projectDir, worktreeDir string, task *beads.Task) string {
+	if !projCfg.ContextIndex {
+		return ""
+	}
+	ix, _, err := codeindex.Update(codeindex.Path(projectDir), worktreeDir)
+	if err != nil {
+		return "" // Directives work without it
+	}
+	text := strings.Join([]string{task.Title, task.Description, task.Design, task.AcceptanceCriteria}, "\n")
+	return ix.Snippets(worktreeDir, text, codeindex.Budget)
+}
+
+// recordDecisions adds the decisions a completed run stated to the
+// project's decisions file, for later directives.
+func recordDecisions(machinatorDir, projectID, taskID string, runID int64, rec *transcript.Recorder, logger tui.Logger, source string) {
+	if rec == nil || runID == 0 {
+		return // Nothing recorded to read them from
+	}
+	if err := rec.Poll(); err != nil {
+		logger.Log(source, fmt.Sprintf("[yellow]Transcript: %v[-]", err))
+	}
+	entries, err := transcript.Load(machinatorDir, taskID)
+	if err != nil {
+		logger.Log(source, fmt.Sprintf("[yellow]Read decisions: %v[-]", err))
+		return
+	}
+	added, err := decisions.Append(decisions.Path(project.Dir(machinatorDir, projectID)), taskID, decisions.Extract(entries, runID), time.Now())
+	if err != nil {
+		logger.Log(source, fmt.Sprintf("[yellow]Record decisions: %v[-]", err))
+	} else if added > 0 {
+		logger.Log(source, fmt.Sprintf("Recorded %d decision(s) from %s", added, taskID))
+	}
+}
+
+// resolveConflict has an agent resolve the conflicts between a completed
+// task's branch and the branch, in its worktree, and pushes the result to
+// the task branch. Reports whether it did; the worktree is left clean
+// either way.
+func resolveConflict(ctx context.Context, st *state.State, cfg *config.Config, projCfg *project.Config, task *beads.Task, taskBranch, worktreeDir string, agentID int, model string, account quota.AccountQuota, logger tui.Logger, source string) bool {
+	conflict, err := setup.StartConflictMerge(worktreeDir, projCfg.Branch, taskBranch)
+	if err != nil {
+		logger.Log(source, fmt.Sprintf("[yellow]Start conflict merge: %v[-]", err))
+		return false
+	}
+	var files []string // None if origin/<branch> merged cleanly this time
+	if conflict != nil {
+		files = conflict.Files
+		prompt, err := directive.BuildConflict(directive.ConflictData{
+			AgentName:   config.AgentName(agentID),
+			TaskID:      task.ID,
+			TaskTitle:   task.Title,
+			Branch:      projCfg.Branch,
+			TaskBranch:  taskBranch,
+			Files:       conflict.Files,
+			Hunks:       conflict.Hunks,
+			WorktreeDir: worktreeDir,
+			TestCommand: projCfg.TestCommand,
+		})
+		if err != nil {
+			logger.Log(source, fmt.Sprintf("[yellow]Build conflict directive: %v[-]", err))
+			setup.FinishConflictMerge(worktreeDir, projCfg.Branch, taskBranch, conflict.Files) // Abandons it
+			return false
+		}
+		var hosts []string
+		if sandbox, _, err := project.LoadSandboxProfile(worktreeDir); err == nil {
+			hosts = sandbox.Hosts
+		}
+		proc, err := agent.Gemini.Launch(ctx, agent.LaunchOptions{
+			MachinatorDir: cfg.MachinatorDir,
+			AgentID:       agentID,
+			WorktreeDir:   worktreeDir,
+			Model:         model,
+			Account:       account,
+			Directive:     prompt,
+			DockerImage:   projCfg.Docker.Image,
+			Hosts:         hosts,
+		})
+		if err != nil {
+			logger.Log(source, fmt.Sprintf("[yellow]Launch conflict resolution: %v[-]", err))
+			setup.FinishConflictMerge(worktreeDir, projCfg.Branch, taskBranch, conflict.Files)
+			return false
+		}
+		st.SetAgentPID(agentID, proc.PID())
+		logger.Log(source, fmt.Sprintf("Resolving %s's conflicts in %s", task.ID, strings.Join(conflict.Files, ", ")))
+		select {
+		case <-proc.Done():
+		case <-time.After(cfg.LiveTimeouts().MaxRuntime.Duration()):
+			proc.Kill()
+			<-proc.Done()
+			logger.Log(source, fmt.Sprintf("[yellow]Conflict resolution for %s timed out[-]", task.ID))
+		}
+	}
+
+	if err := setup.FinishConflictMerge(worktreeDir, projCfg.Branch, taskBranch, files); err != nil {
+		logger.Log(source, fmt.Sprintf("[yellow]Conflicts in %s not resolved: %v[-]", taskBranch, err))
+		return false
+	}
+	logger.Log(source, fmt.Sprintf("[green]Resolved %s's merge conflicts[-]", task.ID))
+	return true
+}
+
+// conflictTask is a task to resolve a completed task's merge conflicts: it
+// merges the task's branch into its own and carries the conflicting hunks.
+func conflictTask(projCfg *project.Config, task *beads.Task, taskBranch string, e *setup.MergeError) *beads.Task {
+	var desc strings.Builder
+	fmt.Fprintf(&desc, "%s (%q) is done on branch %s, but it conflicts with %s in %s, so it couldn't be merged.\n\n",
+		task.ID, task.Title, taskBranch, projCfg.Branch, strings.Join(e.Files, ", "))
+	fmt.Fprintf(&desc, "Merge it into your branch with `git fetch origin && git merge origin/%s`, resolve the conflicts keeping what both sides meant, run the tests and commit. Don't redo %s's work: it is done once this merges.\n\n", taskBranch, task.ID)
+	fmt.Fprintf(&desc, "Conflicting hunks:\n\n```diff\n%s\n```", strings.TrimRight(e.Hunks, "\n"))
+	return &beads.Task{
+		Title:       "Resolve merge conflict for " + task.ID,
+		Description: desc.String(),
+		IsComplex:   true,
+	}
+}
+
+// merges serializes merging completed task branches across agents.
+var merges setup.MergeQueue
+
+// failureContextEvents is how many output events of a failed attempt are
+// shown to the retry.
+const failureContextEvents = 20
+
+// addFailureContext adds the task's last failed attempt, if any, to a retry
+// directive. Changes already restored from a checkpoint aren't repeated.
+func addFailureContext(data *directive.Data, s *setup.Setup, projectID int, taskID string) error {
+	f, err := s.LoadFailure(projectID, taskID)
+	if err != nil || f == nil {
+		return err
+	}
+	data.FailureReason = f.Reason
+	data.FailureEvents = f.Events
+	data.TestOutput = f.TestOutput
+	if data.PreviousChanges == "" {
+		data.DiscardedChanges = f.Diff
+	}
+	return nil
+}
+
+// directiveData collects the directive fields shared by real and dry runs.
+func directiveData(st *state.State, projCfg *project.Config, task *beads.Task, agentID int, projectDir, worktreeDir, scratchDir string) directive.Data {
+	workDir := filepath.Join(worktreeDir, projCfg.Scope) // Where the agent runs
+	data := directive.Data{
+		AgentName:      config.AgentName(agentID),
+		TaskID:         task.ID,
+		TaskContext:    directive.TaskContext(task),
+		ProjectContext: directive.ProjectContext(workDir),
+		Decisions:      decisions.Recent(decisions.Path(projectDir), decisions.Budget),
+		RelevantCode:   relevantCode(projCfg, projectDir, workDir, task),
+		WorktreeDir:    workDir,
+		ScratchDir:     scratchDir,
+		TestCommand:    projCfg.TestCommand,
+		Scope:          projCfg.Scope,
+		TaskRepo:       taskRepo(projCfg, task),
+	}
+	if data.ProjectContext == "" && projCfg.Scope != "" {
+		data.ProjectContext = directive.ProjectContext(worktreeDir)
+	}
+	for _, r := range projCfg.Repos {
+		dir, _ := filepath.Rel(workDir, filepath.Join(worktreeDir, project.ReposDir, r.Name))
+		data.Repos = append(data.Repos, directive.Repo{
+			Name:        r.Name,
+			Dir:         dir,
+			Branch:      r.Branch,
+			Description: r.Description,
+		})
+	}
+	if tr, _ := tracker.For(projCfg); tr != nil {
+		data.Tracker = tr.Name()
+		data.DoneFile = filepath.Join(scratchDir, doneFileName)
+	}
+
+	runs, _ := st.DB().TaskRuns(task.ID)
+	for _, r := range runs {
+		if r.Outcome == rundb.OutcomeFailed || r.Outcome == rundb.OutcomeTimedOut {
+			data.FailedAttempts = append(data.FailedAttempts, directive.Attempt{
+				Time:    r.StartedAt,
+				Model:   r.Model,
+				Outcome: r.Outcome,
+				Message: r.Message,
+			})
+		}
+	}
+	return data
+}
+
+// repoTag names the extra repo a task belongs to, e.g. "REPO:web".
+var repoTag = regexp.MustCompile(`REPO:([A-Za-z0-9_][A-Za-z0-9._-]*)`)
+
+// taskRepo returns the extra repo a task is tagged with (REPO:<name> in its
+// description or a repo:<name> label), or "" for the project's own repo.
+func taskRepo(projCfg *project.Config, task *beads.Task) string {
+	names := []string{}
+	if m := repoTag.FindStringSubmatch(task.Description); m != nil {
+		names = append(names, m[1])
+	}
+	for _, l := range task.Labels {
+		if name, ok := strings.CutPrefix(l, "repo:"); ok {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		if projCfg.ExtraRepo(name) != nil {
+			return name
+		}
+	}
+	return ""
+}
+
+// findTask loads the project's tasks and returns the one with the given ID.
+func findTask(projCfg *project.Config, repoDir, taskID string) *beads.Task {
+	chaos.Delay()
+	tasks, err := tracker.LoadTasks(projCfg, repoDir)
+	if err != nil {
+		return nil
+	}
+	for _, t := range tasks {
+		if t.ID == taskID {
+			return t
+		}
 	}
 	return nil
 }
 
-func removeTask(tasks []*beads.Task, id string) []*beads.Task {
-	var result []*beads.Task
+// taskClosed reports whether the agent closed the bead in its worktree.
+func taskClosed(worktreeDir, taskID string) bool {
+	tasks, err := beads.LoadTasks(worktreeDir)
+	if err != nil {
+		return false
+	}
 	for _, t := range tasks {
-		if t.ID != id {
-			result = append(result, t)
+		if t.ID == taskID {
+			return t.Status == "closed"
 		}
 	}
-	return result
+	return false
+}
+
+// doneFileName is what an agent working a tracker issue writes to its
+// scratch dir, holding its summary, when the issue is complete.
+const doneFileName = "DONE"
+
+// trackerDone reports whether the agent marked a tracker issue complete and,
+// if so, closes it in the tracker with the agent's summary as a comment.
+func trackerDone(tr tracker.Tracker, doneFile, taskID string, agentID int, logger tui.Logger) bool {
+	summary, err := os.ReadFile(doneFile)
+	if err != nil {
+		return false
+	}
+	comment := fmt.Sprintf("Completed by %s:\n\n%s", config.AgentName(agentID), strings.TrimSpace(string(summary)))
+	if err := tr.Finish(taskID, comment); err != nil {
+		logger.Log(fmt.Sprintf("agent-%d", agentID), fmt.Sprintf("[red]%s: close %s: %v[-]", tr.Name(), taskID, err))
+	}
+	return true
 }
 
 func resolveProjectRepo(machinatorDir, projectID string) (string, error) {
@@ -636,14 +2241,14 @@ func resolveProjectRepo(machinatorDir, projectID string) (string, error) {
 
 	// Auto-select if only one project
 	if len(projects) == 1 {
-		fmt.Printf("(Using project %s)\n", projects[0])
+		fmt.Fprintf(os.Stderr, "(Using project %s)\n", projects[0])
 		return filepath.Join(projectsDir, projects[0], "repo"), nil
 	}
 
 	// Ask user to choose
-	fmt.Println("Available projects:")
+	fmt.Fprintln(os.Stderr, "Available projects:")
 	for _, p := range projects {
-		fmt.Printf("  %s\n", p)
+		fmt.Fprintf(os.Stderr, "  %s\n", p)
 	}
 	return "", fmt.Errorf("multiple projects found, use --project=<id> to specify")
 }
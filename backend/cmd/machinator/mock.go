@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bryantinsley/machinator/backend/internal/config"
+	"github.com/bryantinsley/machinator/backend/internal/mock"
+	"github.com/bryantinsley/machinator/backend/internal/project"
+)
+
+// mockEnv switches this process to a fresh mock MACHINATOR_DIR, next to
+// the real one's data but apart from it, with the mock gemini and bd, and
+// returns the project to run. Exits if it can't be made.
+func mockEnv() string {
+	dir := filepath.Join(config.Dir(), "mock")
+	if data, err := os.ReadFile(lockPath(dir)); err == nil {
+		if pid, _ := strconv.Atoi(strings.TrimSpace(string(data))); pid != 0 && processRunning(pid, "machinator") {
+			fmt.Fprintf(os.Stderr, "Error: a mock run is already running (pid %d)\n", pid)
+			os.Exit(1)
+		}
+	}
+	// Agents run in worktrees, so the scenario is found by absolute path,
+	// and checked now rather than by every agent
+	if path := os.Getenv(mock.ScenarioEnv); path != "" {
+		abs, err := filepath.Abs(path)
+		if err == nil {
+			_, err = mock.LoadScenario(abs)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading %s: %v\n", mock.ScenarioEnv, err)
+			os.Exit(1)
+		}
+		os.Setenv(mock.ScenarioEnv, abs)
+	}
+	self, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		fmt.Fprintf(os.Stderr, "Error clearing %s: %v\n", dir, err)
+		os.Exit(1)
+	}
+	if err := mock.Fixture(dir, self); err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating mock fixture: %v\n", err)
+		os.Exit(1)
+	}
+
+	os.Setenv("MACHINATOR_DIR", dir)
+	os.Setenv("PATH", filepath.Join(dir, "bin")+string(os.PathListSeparator)+os.Getenv("PATH"))
+	os.Setenv("MACHINATOR_DUMMY_TOOLS", "1") // Lets MACHINATOR_CHAOS run against the mock
+	go mock.Daemon(project.RepoDir(dir, mock.ProjectID), mock.FixtureBranch)
+	fmt.Fprintf(os.Stderr, "Mock run in %s (mock gemini and bd, demo project)\n", dir)
+	return mock.ProjectID
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/bryantinsley/machinator/backend/internal/config"
+	"github.com/bryantinsley/machinator/backend/internal/rundb"
+	"github.com/bryantinsley/machinator/backend/internal/state"
+)
+
+// pinsCmd prints the events bookmarked in the TUI, as text or as JSON for
+// attaching to a run report.
+func pinsCmd(asJSON bool) {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	st, err := state.Load(cfg.MachinatorDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading state: %v\n", err)
+		os.Exit(1)
+	}
+	defer st.Close()
+
+	pins, err := st.DB().Pins()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if pins == nil {
+			pins = []rundb.Pin{}
+		}
+		enc.Encode(pins)
+		return
+	}
+	if len(pins) == 0 {
+		fmt.Println("No pinned events (press m on an event in the TUI replay to pin it)")
+		return
+	}
+	for _, p := range pins {
+		fmt.Printf("%s  %s #%d (agent %d, run %d)\n  %s\n",
+			p.EventTime.Local().Format("2006-01-02 15:04:05"), p.TaskID, p.EventNum, p.AgentID, p.RunID, p.Text)
+	}
+}
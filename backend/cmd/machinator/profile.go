@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bryantinsley/machinator/backend/internal/config"
+)
+
+// loadProfiles loads the profile registry, exiting on errors.
+func loadProfiles() *config.Profiles {
+	profiles, err := config.LoadProfiles()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading profiles: %v\n", err)
+		os.Exit(1)
+	}
+	return profiles
+}
+
+// saveProfiles saves the profile registry, exiting on errors.
+func saveProfiles(profiles *config.Profiles) {
+	if err := profiles.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error saving profiles: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func profileListCmd() {
+	profiles := loadProfiles()
+	if len(profiles.Profiles) == 0 {
+		fmt.Printf("No profiles in %s; using %s\n", config.ProfilesPath(), config.Dir())
+		return
+	}
+	active := config.ActiveProfile()
+	for _, name := range profiles.Names() {
+		mark := " "
+		if name == active {
+			mark = "*"
+		}
+		note := ""
+		if name == profiles.Default {
+			note = " (default)"
+		}
+		dir, _ := profiles.Dir(name)
+		fmt.Printf("%s %-12s %s%s\n", mark, name, dir, note)
+	}
+	if active == "" {
+		fmt.Printf("No profile active; using %s\n", config.Dir())
+	}
+}
+
+func profileAddCmd(name, dir string) {
+	if strings.ContainsAny(name, "/ \t") {
+		fmt.Fprintf(os.Stderr, "Error: profile names can't contain spaces or slashes\n")
+		os.Exit(1)
+	}
+	// Kept as given when it's under home, so the registry moves with it
+	if !strings.HasPrefix(dir, "~") {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		dir = abs
+	}
+	profiles := loadProfiles()
+	profiles.Profiles[name] = config.Profile{Dir: dir}
+	saveProfiles(profiles)
+	fmt.Printf("Profile %s: %s\n", name, dir)
+}
+
+func profileRemoveCmd(name string) {
+	profiles := loadProfiles()
+	if _, ok := profiles.Profiles[name]; !ok {
+		fmt.Fprintf(os.Stderr, "Error: no profile %q\n", name)
+		os.Exit(1)
+	}
+	delete(profiles.Profiles, name)
+	if profiles.Default == name {
+		profiles.Default = ""
+	}
+	saveProfiles(profiles)
+	fmt.Printf("Removed profile %s\n", name)
+}
+
+func profileDefaultCmd(name string) {
+	profiles := loadProfiles()
+	if name != "" {
+		if _, err := profiles.Dir(name); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	profiles.Default = name
+	saveProfiles(profiles)
+	if name == "" {
+		fmt.Println("No default profile")
+	} else {
+		fmt.Printf("Default profile: %s\n", name)
+	}
+}
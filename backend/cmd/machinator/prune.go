@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/config"
+	"github.com/bryantinsley/machinator/backend/internal/project"
+	"github.com/bryantinsley/machinator/backend/internal/setup"
+	"github.com/bryantinsley/machinator/backend/internal/tracker"
+	"github.com/bryantinsley/machinator/backend/internal/tui"
+)
+
+// pruneInterval is how often a running orchestrator prunes task branches.
+const pruneInterval = time.Hour
+
+// prunableBranches lists the project's task branches on origin whose task
+// is closed and that have been merged and untouched (branch and task) for
+// longer than age.
+func prunableBranches(projCfg *project.Config, repoDir string, age time.Duration) ([]setup.RemoteTaskBranch, error) {
+	merged, err := setup.MergedTaskBranches(repoDir, projCfg.Branch)
+	if err != nil || len(merged) == 0 {
+		return nil, err
+	}
+	tasks, err := tracker.LoadTasks(projCfg, repoDir)
+	if err != nil {
+		return nil, fmt.Errorf("load tasks: %w", err)
+	}
+
+	var prunable []setup.RemoteTaskBranch
+	for _, b := range merged {
+		for _, t := range tasks {
+			if project.TaskBranch(t.ID) != b.Name || t.Status != "closed" {
+				continue
+			}
+			last := b.LastCommit
+			if t.ClosedAt != nil && t.ClosedAt.After(last) {
+				last = *t.ClosedAt
+			}
+			if time.Since(last) > age {
+				prunable = append(prunable, b)
+			}
+		}
+	}
+	return prunable, nil
+}
+
+// branchPruner deletes prunable task branches from origin every
+// pruneInterval while the orchestrator runs.
+func branchPruner(projCfg *project.Config, repoDir string, logger tui.Logger) {
+	for {
+		branches, err := prunableBranches(projCfg, repoDir, projCfg.Merge.PruneAfter.Duration())
+		if err != nil {
+			logger.Log("prune", fmt.Sprintf("[yellow]Find task branches to prune: %v[-]", err))
+		}
+		for _, b := range branches {
+			if err := setup.DeleteRemoteBranch(repoDir, b.Name); err != nil {
+				logger.Log("prune", fmt.Sprintf("[yellow]Delete %s: %v[-]", b.Name, err))
+				continue
+			}
+			logger.Log("prune", fmt.Sprintf("Deleted merged branch %s (last commit %s)", b.Name, b.LastCommit.Format("2006-01-02")))
+		}
+		time.Sleep(pruneInterval)
+	}
+}
+
+// pruneBranchesCmd deletes (or with --dry-run lists) the task branches on
+// origin that merge.prune_after would prune. --older-than overrides the
+// configured age, so it also works for projects that don't prune.
+func pruneBranchesCmd(projectID, olderThan string, dryRun bool) {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	projCfg, err := project.Load(cfg.MachinatorDir, projectID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading project: %v\n", err)
+		os.Exit(1)
+	}
+	age := projCfg.Merge.PruneAfter.Duration()
+	if olderThan != "" {
+		if age, err = time.ParseDuration(olderThan); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid --older-than: %v\n", err)
+			os.Exit(1)
+		}
+	} else if age == 0 {
+		fmt.Fprintln(os.Stderr, "merge.prune_after isn't set for this project; pass --older-than=DURATION (e.g. 168h)")
+		os.Exit(1)
+	}
+
+	repoDir := project.RepoDir(cfg.MachinatorDir, projectID)
+	branches, err := prunableBranches(projCfg, repoDir, age)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(branches) == 0 {
+		fmt.Printf("No merged task branches older than %s\n", age)
+		return
+	}
+	for _, b := range branches {
+		if dryRun {
+			fmt.Printf("would delete  %s  (last commit %s)\n", b.Name, b.LastCommit.Format("2006-01-02"))
+			continue
+		}
+		if err := setup.DeleteRemoteBranch(repoDir, b.Name); err != nil {
+			fmt.Fprintf(os.Stderr, "Error deleting %s: %v\n", b.Name, err)
+			os.Exit(1)
+		}
+		fmt.Printf("deleted  %s  (last commit %s)\n", b.Name, b.LastCommit.Format("2006-01-02"))
+	}
+}
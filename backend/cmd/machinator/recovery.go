@@ -0,0 +1,389 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/agent"
+	"github.com/bryantinsley/machinator/backend/internal/config"
+	"github.com/bryantinsley/machinator/backend/internal/project"
+	"github.com/bryantinsley/machinator/backend/internal/rundb"
+	"github.com/bryantinsley/machinator/backend/internal/setup"
+	"github.com/bryantinsley/machinator/backend/internal/state"
+	"github.com/bryantinsley/machinator/backend/internal/tui"
+)
+
+// interruptedReason is recorded as the failure of a task whose run was
+// cut short by an unclean shutdown.
+const interruptedReason = "interrupted: machinator didn't shut down cleanly"
+
+// orphanStopTimeout is how long a leftover gemini gets to exit before it's
+// killed.
+const orphanStopTimeout = 5 * time.Second
+
+// staleLockAge is how old a git lock must be before recovery removes it; a
+// newer one may belong to a git that's just started.
+const staleLockAge = 2 * time.Minute
+
+// lockPath is the file holding the running orchestrator's pid. Left behind,
+// the last run didn't shut down cleanly.
+func lockPath(machinatorDir string) string {
+	return filepath.Join(machinatorDir, "machinator.lock")
+}
+
+// acquireLock takes the orchestrator lock, returning the pid in a lock left
+// behind by a run that's gone (0 if there was none). Fails if another
+// orchestrator is still running.
+func acquireLock(machinatorDir string) (int, error) {
+	stale := 0
+	if data, err := os.ReadFile(lockPath(machinatorDir)); err == nil {
+		pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+		if pid != 0 && pid != os.Getpid() && processRunning(pid, "machinator") {
+			return 0, fmt.Errorf("machinator is already running (pid %d)", pid)
+		}
+		stale = pid
+	}
+	if err := os.WriteFile(lockPath(machinatorDir), []byte(strconv.Itoa(os.Getpid())+"\n"), 0644); err != nil {
+		return 0, fmt.Errorf("write lock: %w", err)
+	}
+	return stale, nil
+}
+
+// releaseLock removes the orchestrator lock on a clean exit.
+func releaseLock(machinatorDir string) {
+	os.Remove(lockPath(machinatorDir))
+}
+
+// processRunning reports whether pid is alive and its command line mentions
+// name, so a pid reused by another program doesn't count.
+func processRunning(pid int, name string) bool {
+	if err := syscall.Kill(pid, 0); err != nil && !errors.Is(err, syscall.EPERM) {
+		return false
+	}
+	out, err := exec.Command("ps", "-p", strconv.Itoa(pid), "-o", "command=").Output()
+	return err == nil && strings.Contains(string(out), name)
+}
+
+// processGroup returns the processes in the group led by pgid, if one of
+// them mentions name. A gemini's group holds everything it started.
+func processGroup(pgid int, name string) []int {
+	out, err := exec.Command("ps", "-A", "-o", "pgid=,pid=,command=").Output()
+	if err != nil {
+		return nil
+	}
+	var pids []int
+	ours := false
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[0] != strconv.Itoa(pgid) {
+			continue
+		}
+		pid, _ := strconv.Atoi(fields[1])
+		pids = append(pids, pid)
+		ours = ours || strings.Contains(line, name)
+	}
+	if !ours {
+		return nil
+	}
+	return pids
+}
+
+// orphan is an agent's gemini still running from the last run.
+type orphan struct {
+	agentID int
+	pid     int // Leader of its process group, as recorded in state
+	procs   int // Processes left, counting what it started
+}
+
+// running reports whether anything of the orphan is left. Agents started
+// before they had process groups of their own are found by pid alone.
+func (o orphan) running() bool {
+	return len(processGroup(o.pid, "")) > 0 || processRunning(o.pid, "gemini")
+}
+
+// signal sends sig to the orphan's process group, and to the orphan itself
+// should it not lead one.
+func (o orphan) signal(sig syscall.Signal) error {
+	groupErr := syscall.Kill(-o.pid, sig)
+	if err := syscall.Kill(o.pid, sig); err != nil && groupErr != nil {
+		return err
+	}
+	return nil
+}
+
+// recovery is what an unclean shutdown left behind.
+type recovery struct {
+	lockPID     int            // Pid in a stale lock, 0 if none
+	session     *rundb.Session // Last session, if it never ended
+	orphans     []orphan
+	locks       []string       // Git locks left by a git killed mid-command
+	interrupted []rundb.Run    // Runs still open
+	dirty       map[int]int    // Uncommitted files by agent
+	assigned    map[int]string // Task by agent, relaunched once watchers start
+}
+
+// detectRecovery looks for evidence that the last run didn't shut down
+// cleanly. Call it before the run manifest is updated for this run.
+func detectRecovery(st *state.State, cfg *config.Config, projCfg *project.Config, projectID string, lockPID int) (*recovery, error) {
+	r := &recovery{lockPID: lockPID, dirty: make(map[int]int), assigned: make(map[int]string)}
+
+	sessions, err := st.DB().Sessions(1)
+	if err != nil {
+		return nil, err
+	}
+	if len(sessions) > 0 && sessions[0].EndedAt.IsZero() {
+		r.session = &sessions[0]
+	}
+	if r.interrupted, err = st.DB().OpenRuns(); err != nil {
+		return nil, err
+	}
+
+	for _, a := range st.AgentsSnapshot() {
+		if a.State == "assigned" {
+			r.assigned[a.ID] = a.TaskID
+		}
+		if a.PID != 0 {
+			if procs := processGroup(a.PID, "gemini"); len(procs) > 0 {
+				r.orphans = append(r.orphans, orphan{agentID: a.ID, pid: a.PID, procs: len(procs)})
+			} else if processRunning(a.PID, "gemini") {
+				r.orphans = append(r.orphans, orphan{agentID: a.ID, pid: a.PID, procs: 1})
+			}
+		}
+		files, err := setup.UncommittedFiles(project.AgentDir(cfg.MachinatorDir, projectID, a.ID), projCfg.IgnoreChanges)
+		if err == nil && len(files) > 0 {
+			r.dirty[a.ID] = len(files)
+		}
+	}
+
+	// Whoever held them is gone or about to be, with the lock ours
+	for _, repoDir := range projectRepos(cfg, projCfg, projectID) {
+		locks, err := setup.StaleGitLocks(repoDir)
+		if err == nil {
+			r.locks = append(r.locks, locks...)
+		}
+	}
+	return r, nil
+}
+
+// projectRepos are the clones of a project's repos that exist: its own and
+// its extra repos.
+func projectRepos(cfg *config.Config, projCfg *project.Config, projectID string) []string {
+	repos := []string{project.RepoDir(cfg.MachinatorDir, projectID)}
+	for _, r := range projCfg.Repos {
+		repos = append(repos, filepath.Join(filepath.Dir(repos[0]), "repos", r.Name))
+	}
+	var existing []string
+	for _, dir := range repos {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			existing = append(existing, dir)
+		}
+	}
+	return existing
+}
+
+// unclean reports whether the last run ended without shutting down: it
+// left its lock or session open, agents it started are still running, or
+// git was killed holding a lock.
+// Open runs and dirty worktrees alone are what a clean exit with agents
+// working leaves too.
+func (r *recovery) unclean() bool {
+	return r.lockPID != 0 || r.session != nil || len(r.orphans) > 0 || len(r.locks) > 0
+}
+
+// String summarizes what was found and what reconcile will do about it.
+func (r *recovery) String() string {
+	var b strings.Builder
+	b.WriteString("The last run didn't shut down cleanly.\n\nFound:\n")
+	if r.session != nil {
+		fmt.Fprintf(&b, "  Session started %s never ended\n", r.session.StartedAt.Format(time.DateTime))
+	}
+	if r.lockPID != 0 {
+		fmt.Fprintf(&b, "  Stale lock left by pid %d\n", r.lockPID)
+	}
+	for _, o := range r.orphans {
+		fmt.Fprintf(&b, "  agent-%d's gemini still running (pid %d, %d processes)\n", o.agentID, o.pid, o.procs)
+	}
+	for _, lock := range r.locks {
+		fmt.Fprintf(&b, "  Stale git lock %s\n", lock)
+	}
+	for _, run := range r.interrupted {
+		fmt.Fprintf(&b, "  %s in progress on agent-%d since %s\n", run.TaskID, run.AgentID, run.StartedAt.Format(time.DateTime))
+	}
+	for _, id := range slices.Sorted(maps.Keys(r.dirty)) {
+		fmt.Fprintf(&b, "  agent-%d's worktree has %d uncommitted files\n", id, r.dirty[id])
+	}
+
+	b.WriteString("\nWill:\n")
+	for _, o := range r.orphans {
+		fmt.Fprintf(&b, "  Stop pid %d and what it started\n", o.pid)
+	}
+	if len(r.locks) > 0 {
+		b.WriteString("  Remove the git locks nothing holds and prune missing worktrees\n")
+	}
+	for _, run := range r.interrupted {
+		if r.assigned[run.AgentID] != run.TaskID {
+			fmt.Fprintf(&b, "  Record %s's run as failed\n", run.TaskID)
+			continue
+		}
+		action := "relaunch it"
+		if r.dirty[run.AgentID] > 0 {
+			action = "keep its changes for the retry's directive and relaunch it from a reset worktree"
+		}
+		fmt.Fprintf(&b, "  Record %s's run as failed, %s\n", run.TaskID, action)
+	}
+	for _, id := range slices.Sorted(maps.Keys(r.dirty)) {
+		if _, ok := r.assigned[id]; !ok {
+			fmt.Fprintf(&b, "  Reset agent-%d's worktree when it's next assigned\n", id)
+		}
+	}
+	b.WriteString("  Take the lock and start a new session\n")
+	return b.String()
+}
+
+// reconcile stops orphaned agents and keeps what interrupted runs did so
+// their retries can show it. Open runs are closed afterwards along with
+// the rest of the run manifest.
+func (r *recovery) reconcile(cfg *config.Config, projCfg *project.Config, projectID string, logger tui.Logger) {
+	r.stopOrphans(logger)
+	r.removeLocks(cfg, projCfg, projectID, logger)
+
+	s := setup.New(cfg.MachinatorDir)
+	id, _ := strconv.Atoi(projectID)
+	for _, run := range r.interrupted {
+		if r.assigned[run.AgentID] != run.TaskID {
+			continue
+		}
+		worktreeDir := project.AgentDir(cfg.MachinatorDir, projectID, run.AgentID)
+		f := setup.Failure{
+			Time:   time.Now(),
+			Reason: interruptedReason,
+			Events: agent.TailLog(cfg.MachinatorDir, run.AgentID, failureContextEvents),
+		}
+		if r.dirty[run.AgentID] > 0 {
+			if diff, err := setup.WorktreeDiff(worktreeDir, projCfg.IgnoreChanges); err == nil {
+				f.Diff = string(diff)
+			}
+			if err := setup.SaveSnapshot(worktreeDir, run.TaskID); err != nil {
+				logger.Log("main", fmt.Sprintf("[yellow]Save attempt snapshot: %v[-]", err))
+			}
+		}
+		if err := s.SaveFailure(id, run.TaskID, f); err != nil {
+			logger.Log("main", fmt.Sprintf("[yellow]Record failure: %v[-]", err))
+		}
+	}
+}
+
+// stopOrphans stops leftover agents, each with everything it started.
+func (r *recovery) stopOrphans(logger tui.Logger) {
+	for _, o := range r.orphans {
+		if err := o.signal(syscall.SIGTERM); err != nil {
+			logger.Log("main", fmt.Sprintf("[yellow]Stop pid %d: %v[-]", o.pid, err))
+			continue
+		}
+		// It mustn't still be writing once its worktree is reset
+		deadline := time.Now().Add(orphanStopTimeout)
+		for o.running() && time.Now().Before(deadline) {
+			time.Sleep(100 * time.Millisecond)
+		}
+		if o.running() {
+			o.signal(syscall.SIGKILL)
+		}
+		logger.Log("main", fmt.Sprintf("Stopped agent-%d's leftover gemini (pid %d)", o.agentID, o.pid))
+	}
+}
+
+// removeLocks removes the git locks left behind and prunes worktrees whose
+// directories are gone. Call it once the orphans are stopped. A lock newer
+// than staleLockAge, or where git is still running, is kept.
+func (r *recovery) removeLocks(cfg *config.Config, projCfg *project.Config, projectID string, logger tui.Logger) {
+	for _, lock := range r.locks {
+		if err := setup.RemoveGitLock(lock, staleLockAge); err != nil {
+			if errors.Is(err, setup.ErrLockInUse) {
+				logger.Log("main", fmt.Sprintf("[yellow]Kept %v[-]", err))
+			} else {
+				logger.Log("main", fmt.Sprintf("[yellow]Remove git lock: %v[-]", err))
+			}
+			continue
+		}
+		logger.Log("main", fmt.Sprintf("Removed stale git lock %s", lock))
+	}
+	for _, repoDir := range projectRepos(cfg, projCfg, projectID) {
+		if err := setup.PruneWorktrees(repoDir); err != nil {
+			logger.Log("main", fmt.Sprintf("[yellow]%v[-]", err))
+		}
+	}
+}
+
+// orphansCmd lists the agents a run that didn't shut down cleanly left
+// running and the git locks it left behind, and with kill stops them and
+// removes the locks, without starting a run. A running orchestrator is
+// left alone.
+func orphansCmd(projectID string, kill bool) {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	projCfg, err := project.Load(cfg.MachinatorDir, projectID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading project: %v\n", err)
+		os.Exit(1)
+	}
+	st, err := state.Load(cfg.MachinatorDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading state: %v\n", err)
+		os.Exit(1)
+	}
+	defer st.Close()
+
+	// Holding the lock keeps a run from starting agents meanwhile
+	lockPID, err := acquireLock(cfg.MachinatorDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v (it stops its own agents when it exits)\n", err)
+		os.Exit(1)
+	}
+	defer func() {
+		if lockPID != 0 && !kill {
+			os.WriteFile(lockPath(cfg.MachinatorDir), []byte(strconv.Itoa(lockPID)+"\n"), 0644) // Still evidence for the next run
+		} else {
+			releaseLock(cfg.MachinatorDir)
+		}
+	}()
+	rec, err := detectRecovery(st, cfg, projCfg, projectID, lockPID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(rec.orphans) == 0 && len(rec.locks) == 0 {
+		fmt.Println("No leftover agents or git locks")
+		return
+	}
+	for _, o := range rec.orphans {
+		fmt.Printf("agent-%d's gemini still running (pid %d, %d processes)\n", o.agentID, o.pid, o.procs)
+	}
+	for _, lock := range rec.locks {
+		fmt.Printf("stale git lock %s\n", lock)
+	}
+	if !kill {
+		fmt.Println("\nmachinator orphans --kill stops them and removes the locks; so does the next run")
+		return
+	}
+
+	logger, err := tui.NewFileLogger(filepath.Join(cfg.MachinatorDir, "logs"), true, cfg.Logs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating logger: %v\n", err)
+		os.Exit(1)
+	}
+	defer logger.Close()
+	rec.stopOrphans(logger)
+	rec.removeLocks(cfg, projCfg, projectID, logger)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/rundb"
+)
+
+func TestRecoveryUnclean(t *testing.T) {
+	tests := []struct {
+		name string
+		r    recovery
+		want bool
+	}{
+		{"clean", recovery{}, false},
+		{"stale lock", recovery{lockPID: 42}, true},
+		{"session never ended", recovery{session: &rundb.Session{}}, true},
+		{"orphan", recovery{orphans: []orphan{{agentID: 1, pid: 42}}}, true},
+		{"git lock", recovery{locks: []string{"/repo/.git/index.lock"}}, true},
+		// What a clean exit with agents working leaves too
+		{"open runs and dirty worktrees", recovery{interrupted: []rundb.Run{{TaskID: "t-1"}}, dirty: map[int]int{1: 3}}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.r.unclean(); got != tt.want {
+			t.Errorf("%s: unclean = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRecoveryPlan(t *testing.T) {
+	started := time.Date(2026, 1, 2, 3, 4, 5, 0, time.Local)
+	r := &recovery{
+		lockPID: 99,
+		session: &rundb.Session{StartedAt: started},
+		orphans: []orphan{{agentID: 1, pid: 1001, procs: 3}},
+		locks:   []string{"/repo/.git/index.lock"},
+		interrupted: []rundb.Run{
+			{TaskID: "t-1", AgentID: 1, StartedAt: started},
+			{TaskID: "t-2", AgentID: 2, StartedAt: started},
+			{TaskID: "t-old", AgentID: 3, StartedAt: started},
+		},
+		dirty:    map[int]int{1: 2, 4: 1},
+		assigned: map[int]string{1: "t-1", 2: "t-2", 3: "t-new"},
+	}
+	got := r.String()
+	found, plan, ok := strings.Cut(got, "\nWill:\n")
+	if !ok {
+		t.Fatalf("no plan:\n%s", got)
+	}
+	for _, want := range []string{
+		"Session started 2026-01-02 03:04:05 never ended",
+		"Stale lock left by pid 99",
+		"agent-1's gemini still running (pid 1001, 3 processes)",
+		"Stale git lock /repo/.git/index.lock",
+		"t-1 in progress on agent-1",
+		"agent-4's worktree has 1 uncommitted files",
+	} {
+		if !strings.Contains(found, want) {
+			t.Errorf("found missing %q:\n%s", want, found)
+		}
+	}
+	// In the order reconcile does them
+	want := strings.Join([]string{
+		"  Stop pid 1001 and what it started",
+		"  Remove the git locks nothing holds and prune missing worktrees",
+		"  Record t-1's run as failed, keep its changes for the retry's directive and relaunch it from a reset worktree",
+		"  Record t-2's run as failed, relaunch it",
+		"  Record t-old's run as failed", // Its agent has moved on to another task
+		"  Reset agent-4's worktree when it's next assigned",
+		"  Take the lock and start a new session",
+	}, "\n") + "\n"
+	if plan != want {
+		t.Errorf("plan:\n%s\nwant:\n%s", plan, want)
+	}
+}
+
+func TestAcquireLock(t *testing.T) {
+	dir := t.TempDir()
+	if stale, err := acquireLock(dir); err != nil || stale != 0 {
+		t.Fatalf("no lock: stale = %d, err = %v", stale, err)
+	}
+	releaseLock(dir)
+
+	// A pid that's gone, or reused by another program, is stale
+	gone := exec.Command("true")
+	if err := gone.Run(); err != nil {
+		t.Fatal(err)
+	}
+	other := exec.Command("sleep", "30")
+	if err := other.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer other.Process.Kill()
+	for _, pid := range []int{gone.Process.Pid, other.Process.Pid} {
+		os.WriteFile(lockPath(dir), []byte(strconv.Itoa(pid)+"\n"), 0644)
+		if stale, err := acquireLock(dir); err != nil || stale != pid {
+			t.Errorf("lock of pid %d: stale = %d, err = %v; want it stale", pid, stale, err)
+		}
+		if data, _ := os.ReadFile(lockPath(dir)); strings.TrimSpace(string(data)) != strconv.Itoa(os.Getpid()) {
+			t.Errorf("lock holds %q after taking it, want our pid", data)
+		}
+	}
+
+	// A machinator still running keeps it
+	live := exec.Command("sh", "-c", "sleep 30; : machinator")
+	if err := live.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer live.Process.Kill()
+	os.WriteFile(lockPath(dir), []byte(strconv.Itoa(live.Process.Pid)+"\n"), 0644)
+	if _, err := acquireLock(dir); err == nil || !strings.Contains(err.Error(), "already running") {
+		t.Errorf("lock of a running machinator: err = %v, want already running", err)
+	}
+	if data, _ := os.ReadFile(lockPath(dir)); strings.TrimSpace(string(data)) != strconv.Itoa(live.Process.Pid) {
+		t.Errorf("lock holds %q, want the running pid left alone", data)
+	}
+}
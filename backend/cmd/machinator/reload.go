@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/config"
+	"github.com/bryantinsley/machinator/backend/internal/project"
+)
+
+// configWatchInterval is how often the config files are checked for edits.
+const configWatchInterval = 2 * time.Second
+
+// Top-level fields whose changes are applied mid-run. The rest take a
+// restart.
+var (
+	liveConfigFields  = []string{"timeouts", "max_task_attempts"}
+	liveProjectFields = []string{"simple_model_name", "complex_model_name", "settings"}
+)
+
+// configWatcher reloads config.json and the project's config when either
+// is edited, applies the changes that are safe mid-run (timeouts, the kill
+// cooldown among them, attempts, models) and logs what changed and what
+// waits for a restart.
+func (o *orchestrator) configWatcher() {
+	projectPath := project.ConfigPath(o.cfg.MachinatorDir, o.projectID)
+	paths := []string{config.ConfigPath(), projectPath}
+	modTimes := func() []time.Time {
+		times := make([]time.Time, len(paths))
+		for i, path := range paths {
+			if info, err := os.Stat(path); err == nil {
+				times[i] = info.ModTime()
+			}
+		}
+		return times
+	}
+
+	last := modTimes()
+	for {
+		time.Sleep(configWatchInterval)
+		current := modTimes()
+		if slices.Equal(current, last) {
+			continue
+		}
+		last = current
+
+		cfg, err := config.LoadFor(projectPath)
+		if err != nil {
+			o.logger.Log("config", fmt.Sprintf("[red]Config not reloaded: %v[-]", err))
+			continue
+		}
+		projCfg, err := project.Load(o.cfg.MachinatorDir, o.projectID)
+		if err != nil {
+			o.logger.Log("config", fmt.Sprintf("[red]Config not reloaded: %v[-]", err))
+			continue
+		}
+
+		restart := append(changedFields(o.cfg, cfg, liveConfigFields), changedFields(o.projCfg, projCfg, liveProjectFields)...)
+		changes := applyLive(o.cfg, cfg, o.projCfg, projCfg)
+		if len(changes) > 0 {
+			o.logger.Log("config", "[green]Reloaded: "+strings.Join(changes, ", ")+"[-]")
+		}
+		if len(restart) > 0 {
+			o.logger.Log("config", "[yellow]Changed, takes a restart: "+strings.Join(restart, ", ")+"[-]")
+		}
+	}
+}
+
+// applyLive copies the settings that can change mid-run from a reloaded
+// config into the running one, describing each change.
+func applyLive(cfg, next *config.Config, projCfg, nextProj *project.Config) []string {
+	return append(cfg.ApplyLive(next), projCfg.ApplyLive(nextProj)...)
+}
+
+// changedFields returns the top-level JSON fields that differ between two
+// configs, leaving out live ones.
+func changedFields(old, next any, live []string) []string {
+	fields := func(v any) map[string]json.RawMessage {
+		data, _ := json.Marshal(v)
+		var m map[string]json.RawMessage
+		json.Unmarshal(data, &m)
+		return m
+	}
+	a, b := fields(old), fields(next)
+	keys := make(map[string]bool)
+	for key := range a {
+		keys[key] = true
+	}
+	for key := range b {
+		keys[key] = true
+	}
+	var changed []string
+	for _, key := range slices.Sorted(maps.Keys(keys)) {
+		if !slices.Contains(live, key) && string(a[key]) != string(b[key]) {
+			changed = append(changed, key)
+		}
+	}
+	return changed
+}
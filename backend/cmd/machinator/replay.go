@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/config"
+	"github.com/bryantinsley/machinator/backend/internal/transcript"
+)
+
+// replayMaxGap caps the pause between events during playback.
+const replayMaxGap = 2 * time.Second
+
+// replayCmd plays back a task's transcript, pausing between events in
+// proportion to the real gaps.
+func replayCmd(taskID string, speed float64, instant bool) {
+	if speed <= 0 {
+		fmt.Fprintf(os.Stderr, "Error: invalid speed %v\n", speed)
+		os.Exit(1)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	entries, err := transcript.Load(cfg.MachinatorDir, taskID)
+	if os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "No transcript for %s\n", taskID)
+		os.Exit(1)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	offsets := transcript.PlaybackOffsets(entries, speed, replayMaxGap)
+	start := time.Now()
+	var runStart time.Time
+	for i, e := range entries {
+		if i == 0 || e.Run != entries[i-1].Run {
+			runStart = e.Time
+			fmt.Printf("\n=== Run %d, agent %d, %s ===\n", e.Run, e.Agent, e.Time.Local().Format("2006-01-02 15:04:05"))
+		}
+		if !instant {
+			time.Sleep(time.Until(start.Add(offsets[i])))
+		}
+		fmt.Printf("[+%s] %s\n", formatElapsed(e.Time.Sub(runStart)), transcript.Summary(e))
+	}
+}
+
+// formatElapsed formats a duration as mm:ss, or h:mm:ss past an hour.
+func formatElapsed(d time.Duration) string {
+	d = d.Round(time.Second)
+	h, m, s := int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%02d:%02d", m, s)
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/beads"
+	"github.com/bryantinsley/machinator/backend/internal/config"
+	"github.com/bryantinsley/machinator/backend/internal/project"
+	"github.com/bryantinsley/machinator/backend/internal/state"
+	"github.com/bryantinsley/machinator/backend/internal/tracker"
+)
+
+// statusQuotaWindow is how far back status looks for the last quota
+// reading.
+const statusQuotaWindow = 24 * time.Hour
+
+// statusReport is what machinator status --json prints.
+type statusReport struct {
+	ProjectID      string             `json:"project_id"`
+	Running        bool               `json:"running"` // An orchestrator updated status.json recently
+	Paused         bool               `json:"paused"`
+	LaunchesPaused bool               `json:"launches_paused"`
+	Held           string             `json:"held,omitempty"`
+	Agents         []statusAgent      `json:"agents"`
+	Quota          map[string]float64 `json:"quota"` // model -> average percent left across accounts
+	QuotaAt        *time.Time         `json:"quota_at,omitempty"`
+	Ready          []statusTask       `json:"ready"` // Assignable now, most urgent first
+	ReadyError     string             `json:"ready_error,omitempty"`
+}
+
+type statusAgent struct {
+	ID             int        `json:"id"`
+	State          string     `json:"state"`
+	TaskID         string     `json:"task_id,omitempty"`
+	Model          string     `json:"model,omitempty"`
+	PID            int        `json:"pid,omitempty"`
+	StartedAt      *time.Time `json:"started_at,omitempty"`
+	ElapsedSeconds int64      `json:"elapsed_seconds,omitempty"`
+}
+
+type statusTask struct {
+	ID      string `json:"id"`
+	Title   string `json:"title"`
+	Urgency int    `json:"urgency"`
+	Complex bool   `json:"complex"`
+}
+
+// statusCmd prints agents, running tasks, quota and ready tasks from the
+// persisted state, whether or not an orchestrator is running.
+func statusCmd(projectID string, asJSON bool) {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	// Default to the project an orchestrator is running
+	var live statusFile
+	if data, err := os.ReadFile(filepath.Join(cfg.MachinatorDir, statusFileName)); err != nil ||
+		json.Unmarshal(data, &live) != nil || time.Since(live.UpdatedAt) > statusFileStale {
+		live = statusFile{}
+	}
+	if projectID == "" {
+		projectID = live.ProjectID
+	}
+	repoDir, err := resolveProjectRepo(cfg.MachinatorDir, projectID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	projectID = filepath.Base(filepath.Dir(repoDir))
+	projCfg, err := project.Load(cfg.MachinatorDir, projectID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading project: %v\n", err)
+		os.Exit(1)
+	}
+	st, err := state.Load(cfg.MachinatorDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading state: %v\n", err)
+		os.Exit(1)
+	}
+	defer st.Close()
+
+	r := statusReport{
+		ProjectID:      projectID,
+		Paused:         st.AssignmentIsPaused(),
+		LaunchesPaused: st.LaunchesArePaused(),
+		Agents:         []statusAgent{},
+		Quota:          make(map[string]float64),
+		Ready:          []statusTask{},
+	}
+	if live.ProjectID == projectID {
+		r.Running = true
+		r.Held = live.Held
+	}
+
+	now := time.Now()
+	for _, a := range st.AgentsSnapshot() {
+		sa := statusAgent{ID: a.ID, State: a.State, TaskID: a.TaskID, Model: a.Model, PID: a.PID}
+		if a.State == "assigned" && !a.StartedAt.IsZero() {
+			started := a.StartedAt
+			sa.StartedAt = &started
+			sa.ElapsedSeconds = int64(now.Sub(started).Seconds())
+		}
+		r.Agents = append(r.Agents, sa)
+	}
+
+	// The quota watcher's last reading of each account
+	samples, err := st.DB().QuotaHistory(now.Add(-statusQuotaWindow))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading quota history: %v\n", err)
+		os.Exit(1)
+	}
+	if len(samples) > 0 {
+		at := samples[len(samples)-1].Time
+		r.QuotaAt = &at
+		latest := make(map[[2]string]float64) // account, model
+		for _, s := range samples {
+			latest[[2]string{s.Account, s.Model}] = s.Remaining
+		}
+		totals, counts := make(map[string]float64), make(map[string]int)
+		for key, remaining := range latest {
+			totals[key[1]] += remaining
+			counts[key[1]]++
+		}
+		for model, total := range totals {
+			r.Quota[model] = total / float64(counts[model]) * 100
+		}
+	}
+
+	if tasks, err := tracker.LoadTasks(projCfg, repoDir); err != nil {
+		r.ReadyError = err.Error()
+	} else {
+		for _, t := range beads.ReadyTasks(tasks) {
+			if st.IsTaskBarred(t.ID) || st.IsTaskAssigned(t.ID) {
+				continue
+			}
+			r.Ready = append(r.Ready, statusTask{ID: t.ID, Title: t.Title, Urgency: t.Urgency, Complex: t.IsComplex})
+		}
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(r)
+		return
+	}
+	printStatus(r)
+}
+
+// printStatus prints a status report for people.
+func printStatus(r statusReport) {
+	line := fmt.Sprintf("Project %s: ", r.ProjectID)
+	if r.Running {
+		line += "running"
+	} else {
+		line += "not running"
+	}
+	if r.Paused {
+		line += ", assignment paused"
+	}
+	if r.LaunchesPaused {
+		line += ", launches paused"
+	}
+	fmt.Println(line)
+	if r.Held != "" {
+		fmt.Printf("New tasks held: %s\n", r.Held)
+	}
+
+	fmt.Println("\nAgents:")
+	if len(r.Agents) == 0 {
+		fmt.Println("  none")
+	}
+	for _, a := range r.Agents {
+		fmt.Printf("  agent-%-3d %-9s", a.ID, a.State)
+		if a.TaskID != "" {
+			fmt.Printf(" %s", a.TaskID)
+			if a.Model != "" {
+				fmt.Printf(" (%s)", a.Model)
+			}
+			if a.StartedAt != nil {
+				fmt.Printf(" for %s", (time.Duration(a.ElapsedSeconds) * time.Second).String())
+			}
+		}
+		fmt.Println()
+	}
+
+	if r.QuotaAt != nil {
+		fmt.Printf("\nQuota (as of %s):\n", r.QuotaAt.Local().Format("2006-01-02 15:04:05"))
+		models := make([]string, 0, len(r.Quota))
+		for model := range r.Quota {
+			models = append(models, model)
+		}
+		slices.Sort(models)
+		for _, model := range models {
+			fmt.Printf("  %-24s %3.0f%%\n", model, r.Quota[model])
+		}
+	} else {
+		fmt.Println("\nQuota: no recent reading")
+	}
+
+	if r.ReadyError != "" {
+		fmt.Printf("\nReady tasks: %s\n", r.ReadyError)
+		return
+	}
+	fmt.Printf("\nReady tasks (%d):\n", len(r.Ready))
+	for _, t := range r.Ready {
+		kind := ""
+		if t.Complex {
+			kind = " [complex]"
+		}
+		fmt.Printf("  %s P%d %s%s\n", t.ID, t.Urgency, clip(t.Title, 70), kind)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/config"
+)
+
+const (
+	statusFileName     = "status.json"
+	statusFileInterval = 5 * time.Second
+	statusFileStale    = 1 * time.Minute // Older than this, the orchestrator is assumed gone
+)
+
+// statusFile is a glanceable summary written to $MACHINATOR_DIR/status.json
+// for menubar and tray tools.
+type statusFile struct {
+	UpdatedAt     time.Time          `json:"updated_at"`
+	ProjectID     string             `json:"project_id"`
+	AgentsRunning int                `json:"agents_running"`
+	AgentsTotal   int                `json:"agents_total"`
+	Paused        bool               `json:"paused"`
+	Held          string             `json:"held,omitempty"`    // Why new tasks are held back (low disk or battery)
+	Merging       int                `json:"merging,omitempty"` // Task branches being merged or waiting to be
+	Quota         map[string]float64 `json:"quota"`             // model -> average percent left across accounts
+	LastFailure   *statusFailure     `json:"last_failure,omitempty"`
+}
+
+type statusFailure struct {
+	At      time.Time `json:"at"`
+	TaskID  string    `json:"task_id"`
+	AgentID int       `json:"agent_id"`
+	Message string    `json:"message"`
+}
+
+// statusWriter rewrites status.json every few seconds, and logs state the
+// run database failed to take since the last time.
+func (o *orchestrator) statusWriter() {
+	path := filepath.Join(o.cfg.MachinatorDir, statusFileName)
+	for {
+		if err := writeStatusFile(path, o.status()); err != nil {
+			o.logger.Log("main", fmt.Sprintf("[red]Write status file: %v[-]", err))
+		}
+		if err := o.st.TakeSaveError(); err != nil {
+			o.logger.Log("main", fmt.Sprintf("[red]%v[-]", err))
+		}
+		time.Sleep(statusFileInterval)
+	}
+}
+
+// status gathers the current summary.
+func (o *orchestrator) status() statusFile {
+	s := statusFile{
+		UpdatedAt: time.Now(),
+		ProjectID: o.projectID,
+		Paused:    o.st.AssignmentIsPaused(),
+		Held:      o.st.Hold(),
+		Merging:   merges.Len(),
+		Quota:     make(map[string]float64),
+	}
+	for _, a := range o.st.AgentsSnapshot() {
+		s.AgentsTotal++
+		if a.PID != 0 {
+			s.AgentsRunning++
+		}
+	}
+
+	accounts := o.q.Accounts
+	simple, complex := o.projCfg.Models()
+	for _, model := range []string{simple, complex} {
+		if len(accounts) == 0 {
+			break
+		}
+		total := 0.0
+		for _, acc := range accounts {
+			total += acc.Models[model]
+		}
+		s.Quota[model] = total / float64(len(accounts)) * 100
+	}
+
+	if run, ok, err := o.st.DB().LastFailure(); err == nil && ok {
+		s.LastFailure = &statusFailure{At: run.EndedAt, TaskID: run.TaskID, AgentID: run.AgentID, Message: run.Message}
+	}
+	return s
+}
+
+// writeStatusFile replaces the file atomically so readers never see half of it.
+func writeStatusFile(path string, s statusFile) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// menubarCmd prints status.json in the xbar/SwiftBar plugin format: a title
+// line, then "---" and the dropdown lines. A plugin script only needs to
+// exec `machinator menubar`.
+func menubarCmd() {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Println("⚙ ?")
+		fmt.Println("---")
+		fmt.Printf("Error loading config: %v\n", err)
+		return
+	}
+
+	var s statusFile
+	data, err := os.ReadFile(filepath.Join(cfg.MachinatorDir, statusFileName))
+	if err == nil {
+		err = json.Unmarshal(data, &s)
+	}
+	if err != nil || time.Since(s.UpdatedAt) > statusFileStale {
+		fmt.Println("⚙ off")
+		fmt.Println("---")
+		fmt.Println("machinator is not running")
+		return
+	}
+
+	title := fmt.Sprintf("⚙ %d/%d", s.AgentsRunning, s.AgentsTotal)
+	if s.Paused {
+		title += " paused"
+	}
+	fmt.Println(title)
+	fmt.Println("---")
+	fmt.Printf("Project %s: %d of %d agents running\n", s.ProjectID, s.AgentsRunning, s.AgentsTotal)
+
+	models := make([]string, 0, len(s.Quota))
+	for model := range s.Quota {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	for _, model := range models {
+		fmt.Printf("%s: %.0f%% quota left\n", model, s.Quota[model])
+	}
+
+	if f := s.LastFailure; f != nil {
+		// The pipe starts xbar parameters, so keep it out of the message
+		msg := strings.ReplaceAll(clip(f.Message, 60), "|", "/")
+		fmt.Printf("Last failure: %s (agent %d) %s ago | color=red\n", f.TaskID, f.AgentID, time.Since(f.At).Round(time.Minute))
+		fmt.Printf("--%s\n", msg)
+	} else {
+		fmt.Println("No failures")
+	}
+}
+
+// clip cuts s to at most n characters.
+func clip(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-1]) + "…"
+	}
+	return s
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/project"
+	"github.com/bryantinsley/machinator/backend/internal/rundb"
+)
+
+const runSummaryFileName = "run-summary.json"
+
+// runSummary is what a run did, written when a headless or --batch run
+// exits for CI pipelines to publish.
+type runSummary struct {
+	ProjectID       string        `json:"project_id"`
+	Seed            string        `json:"seed"`
+	StartedAt       time.Time     `json:"started_at"`
+	EndedAt         time.Time     `json:"ended_at"`
+	DurationSeconds int64         `json:"duration_seconds"`
+	TasksAttempted  int           `json:"tasks_attempted"`
+	TasksCompleted  int           `json:"tasks_completed"`
+	TasksFailed     int           `json:"tasks_failed"` // Failed or timed out on their last run
+	Tokens          int64         `json:"tokens"`
+	Branches        []string      `json:"branches"` // Task branches with completed work, when merging is on
+	Tasks           []summaryTask `json:"tasks"`    // In the order first attempted
+}
+
+type summaryTask struct {
+	ID              string       `json:"id"`
+	Outcome         string       `json:"outcome"` // Of the last run; "unfinished" if the run ended during it
+	DurationSeconds int64        `json:"duration_seconds"`
+	Tokens          int64        `json:"tokens"`
+	Branch          string       `json:"branch,omitempty"`
+	PullRequest     string       `json:"pull_request,omitempty"` // With merge.mode pull_request
+	Runs            []summaryRun `json:"runs"`
+}
+
+type summaryRun struct {
+	AgentID         int       `json:"agent_id"`
+	Model           string    `json:"model,omitempty"`
+	StartedAt       time.Time `json:"started_at"`
+	DurationSeconds int64     `json:"duration_seconds"`
+	Outcome         string    `json:"outcome"`
+	Message         string    `json:"message,omitempty"`
+	Tokens          int64     `json:"tokens"`
+}
+
+// runSummaryPath is where the summary goes without --summary-path.
+func runSummaryPath(machinatorDir string) string {
+	return filepath.Join(machinatorDir, runSummaryFileName)
+}
+
+// summarize gathers what the runs started since started did. Call it once
+// the agents are stopped, so no run is still changing.
+func (o *orchestrator) summarize(started time.Time) (runSummary, error) {
+	now := time.Now()
+	s := runSummary{
+		ProjectID:       o.projectID,
+		Seed:            o.seed.String(),
+		StartedAt:       started,
+		EndedAt:         now,
+		DurationSeconds: int64(now.Sub(started).Seconds()),
+		Branches:        []string{},
+		Tasks:           []summaryTask{},
+	}
+	runs, err := o.st.DB().RunsSince(started)
+	if err != nil {
+		return s, err
+	}
+
+	byID := make(map[string]*summaryTask)
+	var order []string
+	for _, r := range runs {
+		t := byID[r.TaskID]
+		if t == nil {
+			t = &summaryTask{ID: r.TaskID}
+			byID[r.TaskID] = t
+			order = append(order, r.TaskID)
+		}
+		ended, outcome := r.EndedAt, r.Outcome
+		if ended.IsZero() {
+			ended, outcome = now, "unfinished"
+		}
+		secs := int64(ended.Sub(r.StartedAt).Seconds())
+		t.Runs = append(t.Runs, summaryRun{
+			AgentID:         r.AgentID,
+			Model:           r.Model,
+			StartedAt:       r.StartedAt,
+			DurationSeconds: secs,
+			Outcome:         outcome,
+			Message:         r.Message,
+			Tokens:          r.Tokens,
+		})
+		t.Outcome = outcome
+		t.DurationSeconds += secs
+		t.Tokens += r.Tokens
+		s.Tokens += r.Tokens
+	}
+
+	for _, id := range order {
+		t := byID[id]
+		s.TasksAttempted++
+		switch t.Outcome {
+		case rundb.OutcomeCompleted:
+			s.TasksCompleted++
+			if o.projCfg.Merge.Mode != "" {
+				t.Branch = project.TaskBranch(id)
+				s.Branches = append(s.Branches, t.Branch)
+			}
+			if o.projCfg.Merge.Mode == project.MergePullRequest {
+				t.PullRequest = t.Runs[len(t.Runs)-1].Message
+			}
+		case rundb.OutcomeFailed, rundb.OutcomeTimedOut:
+			s.TasksFailed++
+		}
+		s.Tasks = append(s.Tasks, *t)
+	}
+	return s, nil
+}
+
+// writeRunSummary writes a run's summary to path as JSON.
+func writeRunSummary(path string, s runSummary) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
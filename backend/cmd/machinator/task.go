@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/bryantinsley/machinator/backend/internal/api"
+	"github.com/bryantinsley/machinator/backend/internal/beads"
+	"github.com/bryantinsley/machinator/backend/internal/config"
+	"github.com/bryantinsley/machinator/backend/internal/project"
+	"github.com/bryantinsley/machinator/backend/internal/setup"
+	"github.com/bryantinsley/machinator/backend/internal/state"
+	"github.com/bryantinsley/machinator/backend/internal/tracker"
+)
+
+// barCmd bars or unbars a task ("bar" or "unbar"). Barred tasks are never
+// assigned. A running daemon is asked over its socket so its in-memory
+// state stays current; otherwise the state database is edited directly.
+func barCmd(sub, taskID, reason string) {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	if err := changeBar(cfg, sub, taskID, reason); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if sub == "bar" {
+		fmt.Printf("Barred %s\n", taskID)
+	} else {
+		fmt.Printf("Unbarred %s\n", taskID)
+	}
+}
+
+// changeBar bars or unbars a task ("bar" or "unbar"), through the daemon if
+// one is running.
+func changeBar(cfg *config.Config, sub, taskID, reason string) error {
+	client := api.NewClient(api.SocketPath(cfg.MachinatorDir))
+	path := "/api/tasks/" + url.PathEscape(taskID) + "/bar"
+	var err error
+	if sub == "bar" {
+		err = client.Post(path+"?reason="+url.QueryEscape(reason), nil)
+	} else {
+		err = client.Delete(path, nil)
+	}
+	if err != nil && strings.Contains(err.Error(), "connect:") {
+		// No daemon; edit the saved state
+		err = editBars(cfg, sub, taskID, reason)
+	}
+	return err
+}
+
+// editBars bars or unbars a task in the state database.
+func editBars(cfg *config.Config, sub, taskID, reason string) error {
+	st, err := state.Load(cfg.MachinatorDir)
+	if err != nil {
+		return fmt.Errorf("load state: %w", err)
+	}
+	defer st.Close()
+
+	if sub == "bar" {
+		st.BarTaskAndSave(taskID, reason)
+		return nil
+	}
+	if !st.IsTaskBarred(taskID) {
+		return fmt.Errorf("%s is not barred", taskID)
+	}
+	st.UnbarTask(taskID)
+	return nil
+}
+
+// barredCmd lists barred tasks and why they were barred.
+func barredCmd() {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	st, err := state.Load(cfg.MachinatorDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading state: %v\n", err)
+		os.Exit(1)
+	}
+	defer st.Close()
+
+	barred := st.BarredTasksSnapshot()
+	if len(barred) == 0 {
+		fmt.Println("No barred tasks")
+		return
+	}
+	for _, id := range barred {
+		if reason := st.BarReason(id); reason != "" {
+			fmt.Printf("%s  %s\n", id, reason)
+		} else {
+			fmt.Println(id)
+		}
+	}
+}
+
+// splitCmd keeps part of a task's last failed attempt: the changes it made
+// to the files given with --files are committed to the branch under a new,
+// closed task, and the task is unbarred with a note of what is done.
+// Without --files it lists what the attempt changed.
+func splitCmd(projectID, taskID string, files []string) {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	projCfg, err := project.Load(cfg.MachinatorDir, projectID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading project: %v\n", err)
+		os.Exit(1)
+	}
+	repoDir := project.RepoDir(cfg.MachinatorDir, projectID)
+	task := findTask(projCfg, repoDir, taskID)
+	if task == nil {
+		fmt.Fprintf(os.Stderr, "Task %s not found\n", taskID)
+		os.Exit(1)
+	}
+
+	changed, stat, err := setup.SnapshotFiles(repoDir, projCfg.Branch, taskID, projCfg.IgnoreChanges)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(changed) == 0 {
+		fmt.Printf("%s has no saved attempt with changes %s lacks\n", taskID, projCfg.Branch)
+		return
+	}
+	if len(files) == 0 {
+		fmt.Printf("The last failed attempt at %s changed:\n%s\n\n", taskID, stat)
+		fmt.Printf("Commit the finished ones with: machinator task split %s --files=%s\n", taskID, strings.Join(changed, ","))
+		return
+	}
+	for _, f := range files {
+		if !slices.Contains(changed, f) {
+			fmt.Fprintf(os.Stderr, "The attempt didn't change %s (it changed %s)\n", f, strings.Join(changed, ", "))
+			os.Exit(1)
+		}
+	}
+
+	message := fmt.Sprintf("Part of %s: %s\n\nKept from a failed attempt: %s", taskID, task.Title, strings.Join(files, ", "))
+	ctx, stop := interruptContext()
+	defer stop()
+	commit, err := setup.CommitSnapshotFiles(ctx, repoDir, projCfg.Branch, taskID, files, message, projCfg.Merge.Command)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Committed %s to %s as %s\n", strings.Join(files, ", "), projCfg.Branch, commit)
+
+	part, err := tracker.Create(projCfg, repoDir, &beads.Task{
+		Title:       "Part of " + task.Title,
+		Description: fmt.Sprintf("Changes to %s kept from a failed attempt at %s, committed as %s.", strings.Join(files, ", "), taskID, commit),
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error adding a task for the part: %v\n", err)
+		os.Exit(1)
+	}
+	if err := tracker.Close(projCfg, repoDir, part, "Committed as "+commit); err != nil {
+		fmt.Fprintf(os.Stderr, "Error closing %s: %v\n", part, err)
+		os.Exit(1)
+	}
+	note := fmt.Sprintf("Partly done in %s (%s: %s); what remains is this task.", part, commit, strings.Join(files, ", "))
+	if err := tracker.Tag(projCfg, repoDir, task, note); err != nil {
+		fmt.Fprintf(os.Stderr, "Error adding a note to %s: %v\n", taskID, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Added %s for the part, closed\n", part)
+
+	if st, err := state.Load(cfg.MachinatorDir); err == nil {
+		barred := st.IsTaskBarred(taskID)
+		st.Close()
+		if barred {
+			if err := changeBar(cfg, "unbar", taskID, ""); err != nil {
+				fmt.Fprintf(os.Stderr, "Error unbarring %s: %v\n", taskID, err)
+				os.Exit(1)
+			}
+		}
+	}
+	fmt.Printf("Reopened %s for the rest\n", taskID)
+}
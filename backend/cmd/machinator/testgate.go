@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bryantinsley/machinator/backend/internal/beads"
+	"github.com/bryantinsley/machinator/backend/internal/project"
+	"github.com/bryantinsley/machinator/backend/internal/tracker"
+)
+
+// testGateOutputLines is how much of a failed test gate's output the
+// retry's directive shows.
+const testGateOutputLines = 80
+
+// fileFlakyTest adds a task to fix a flaky test the test gate found while
+// checking a task, unless one is already open. Returns its ID.
+func fileFlakyTest(projCfg *project.Config, repoDir, taskID, taskTitle, name, command string, runs int, output string) (string, error) {
+	title := "Flaky test: " + name
+	tasks, err := tracker.LoadTasks(projCfg, repoDir)
+	if err != nil {
+		return "", err
+	}
+	for _, t := range tasks {
+		if t.Title == title && t.Status != "closed" {
+			return t.ID, nil
+		}
+	}
+
+	var desc strings.Builder
+	fmt.Fprintf(&desc, "%s gave different results across %d runs of `%s` on the same code, while checking %s (%q).\n\n", name, runs, command, taskID, taskTitle)
+	fmt.Fprintf(&desc, "Find what makes it nondeterministic (timing, ordering, shared state, the network) and make it pass reliably. Don't skip or delete it.\n\n")
+	fmt.Fprintf(&desc, "End of a failing run's output:\n\n```\n%s\n```", strings.Join(lastLines(output, 40), "\n"))
+	return tracker.Create(projCfg, repoDir, &beads.Task{
+		Title:       title,
+		Description: desc.String(),
+	})
+}
@@ -0,0 +1,311 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bryantinsley/machinator/backend/internal/beads"
+	"github.com/bryantinsley/machinator/backend/internal/procgroup"
+	"github.com/bryantinsley/machinator/backend/internal/project"
+	"github.com/bryantinsley/machinator/backend/internal/quota"
+	"github.com/bryantinsley/machinator/backend/internal/tools"
+)
+
+// LaunchOptions describes a single gemini invocation.
+type LaunchOptions struct {
+	MachinatorDir string
+	AgentID       int
+	WorktreeDir   string
+	Model         string
+	Account       quota.AccountQuota
+	Directive     string
+	ScratchDir    string   // Exported as MACHINATOR_SCRATCH_DIR and TMPDIR
+	Scope         string   // Directory of the worktree gemini runs in, and may write
+	DockerImage   string   // Run gemini in a container of this image instead of on the host
+	Remote        *Remote  // Run gemini on this host instead, the worktree mirrored there and back
+	Hosts         []string // Hosts a bubblewrap sandbox lets gemini reach besides GeminiHosts
+}
+
+// Runner starts gemini runs.
+type Runner interface {
+	Launch(ctx context.Context, opts LaunchOptions) (Run, error)
+}
+
+// Run is a gemini run that has started.
+type Run interface {
+	PID() int
+	// Done receives the exit error (nil on success) when the run ends.
+	Done() <-chan error
+	// Kill ends the run.
+	Kill() error
+}
+
+// Gemini starts every agent's runs: the gemini binary, or in tests a fake
+// such as an agenttest.Runner.
+var Gemini Runner = Exec{}
+
+// Exec is the Runner that runs the gemini binary, with Launch.
+type Exec struct{}
+
+func (Exec) Launch(ctx context.Context, opts LaunchOptions) (Run, error) {
+	p, err := Launch(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Process is a running gemini invocation.
+type Process struct {
+	cmd       *exec.Cmd
+	logFile   *os.File
+	done      chan error
+	container string // Worktree of the agent whose container it runs in, if any
+	remote    *Remote
+	worktree  string
+}
+
+// LogPath returns the gemini output log for an agent.
+func LogPath(machinatorDir string, agentID int) string {
+	return filepath.Join(machinatorDir, "logs", fmt.Sprintf("agent-%d-gemini.log", agentID))
+}
+
+// Tokens returns how many tokens an agent's last run used, from the stats
+// gemini reports in its result event. 0 if it reported none.
+func Tokens(machinatorDir string, agentID int) int64 {
+	data, err := os.ReadFile(LogPath(machinatorDir, agentID))
+	if err != nil {
+		return 0
+	}
+	var total int64
+	for _, line := range strings.Split(string(data), "\n") {
+		var e struct {
+			Type  string `json:"type"`
+			Stats struct {
+				TotalTokens int64 `json:"total_tokens"`
+			} `json:"stats"`
+		}
+		if json.Unmarshal([]byte(line), &e) == nil && e.Type == "result" {
+			total += e.Stats.TotalTokens
+		}
+	}
+	return total
+}
+
+// maxEventLine caps each line returned by TailLog.
+const maxEventLine = 500
+
+// TailLog returns the last n non-empty lines of an agent's output log (one
+// stream-json event per line), each cut to a readable length.
+func TailLog(machinatorDir string, agentID, n int) []string {
+	data, err := os.ReadFile(LogPath(machinatorDir, agentID))
+	if err != nil {
+		return nil
+	}
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	for i, line := range lines {
+		if len(line) > maxEventLine {
+			lines[i] = line[:maxEventLine] + "..."
+		}
+	}
+	return lines
+}
+
+// geminiArgs are gemini's arguments for a run in the worktree at
+// worktreeDir (as gemini sees it).
+func geminiArgs(opts LaunchOptions, worktreeDir string) []string {
+	args := []string{
+		"--yolo",
+		"--model", opts.Model,
+		"--output-format", "stream-json",
+	}
+	// The sandbox lets gemini write to its working directory; scoped, task
+	// updates still need .beads at the worktree's root
+	if opts.Scope != "" {
+		args = append(args, "--include-directories", filepath.Join(worktreeDir, ".beads"))
+	}
+	return append(args, opts.Directive)
+}
+
+// commitEnv attributes commits to an agent.
+func commitEnv(agentID int) []string {
+	return []string{
+		fmt.Sprintf("GIT_AUTHOR_NAME=Machinator Agent: %d", agentID),
+		fmt.Sprintf("GIT_AUTHOR_EMAIL=agent-%d@machinator.local", agentID),
+		fmt.Sprintf("GIT_COMMITTER_NAME=Machinator Agent: %d", agentID),
+		fmt.Sprintf("GIT_COMMITTER_EMAIL=agent-%d@machinator.local", agentID),
+	}
+}
+
+// Command builds the gemini command without starting it.
+func Command(opts LaunchOptions) *exec.Cmd {
+	if opts.Remote != nil {
+		return opts.Remote.command(opts)
+	}
+	geminiPath := filepath.Join(opts.MachinatorDir, "gemini")
+	args := geminiArgs(opts, opts.WorktreeDir)
+
+	// Linux has no seatbelt, so gemini runs under bubblewrap when it's there
+	var cmd *exec.Cmd
+	if opts.DockerImage != "" {
+		cmd = dockerCommand(geminiPath, args, opts)
+	} else if bwrap := Bubblewrap(); bwrap != "" {
+		cmd = bubblewrapCommand(bwrap, geminiPath, args, opts)
+	} else {
+		cmd = exec.Command(geminiPath, append([]string{"--sandbox"}, args...)...)
+	}
+	cmd.Dir = filepath.Join(opts.WorktreeDir, opts.Scope)
+
+	// Account isolation
+	cmd.Env = append(tools.Environ(),
+		"HOME="+opts.Account.HomeDir,
+		"GEMINI_CLI_HOME="+opts.Account.HomeDir,
+		"GEMINI_FORCE_FILE_STORAGE=true",
+	)
+
+	// Temp files go to the task's scratch space, not the worktree
+	if opts.ScratchDir != "" {
+		cmd.Env = append(cmd.Env,
+			"MACHINATOR_SCRATCH_DIR="+opts.ScratchDir,
+			"TMPDIR="+opts.ScratchDir,
+		)
+	}
+
+	// Attribute commits to this agent
+	cmd.Env = append(cmd.Env, commitEnv(opts.AgentID)...)
+
+	return cmd
+}
+
+// Launch starts gemini with output redirected to the agent's log file. It
+// runs in a process group of its own, killed (as Kill does) when ctx is
+// done.
+func Launch(ctx context.Context, opts LaunchOptions) (*Process, error) {
+	logPath := LogPath(opts.MachinatorDir, opts.AgentID)
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		return nil, fmt.Errorf("create logs dir: %w", err)
+	}
+	logFile, err := os.Create(logPath)
+	if err != nil {
+		return nil, fmt.Errorf("create log file: %w", err)
+	}
+
+	cmd := Command(opts)
+	procgroup.Set(cmd)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+
+	// The sandbox's only way out, open while gemini runs
+	var proxy io.Closer = io.NopCloser(nil)
+	if opts.Remote != nil {
+		if err := opts.Remote.provision(opts); err != nil {
+			logFile.Close()
+			return nil, fmt.Errorf("mirror to %s: %w", opts.Remote.Host, err)
+		}
+	} else if opts.DockerImage != "" {
+		if err := removeContainer(opts.WorktreeDir); err != nil {
+			logFile.Close()
+			return nil, err
+		}
+	} else if Bubblewrap() != "" {
+		if proxy, err = serveProxy(ProxySocket(opts.MachinatorDir, opts.AgentID), append(slices.Clone(GeminiHosts), opts.Hosts...)); err != nil {
+			logFile.Close()
+			return nil, err
+		}
+	}
+
+	if err := cmd.Start(); err != nil {
+		proxy.Close()
+		logFile.Close()
+		return nil, fmt.Errorf("start gemini: %w", err)
+	}
+
+	p := &Process{
+		cmd:      cmd,
+		logFile:  logFile,
+		done:     make(chan error, 1),
+		remote:   opts.Remote,
+		worktree: opts.WorktreeDir,
+	}
+	if opts.DockerImage != "" {
+		p.container = opts.WorktreeDir
+	}
+	stop := context.AfterFunc(ctx, func() { p.Kill() })
+	go func() {
+		err := cmd.Wait()
+		stop()
+		proxy.Close()
+		logFile.Close()
+		// What the agent did only counts once it's back
+		if opts.Remote != nil {
+			if rerr := opts.Remote.retrieve(opts); rerr != nil && err == nil {
+				err = fmt.Errorf("mirror back from %s: %w", opts.Remote.Host, rerr)
+			}
+		}
+		p.done <- err
+	}()
+	return p, nil
+}
+
+// PID returns the process ID.
+func (p *Process) PID() int {
+	return p.cmd.Process.Pid
+}
+
+// Done receives the exit error (nil on success) when the process exits.
+func (p *Process) Done() <-chan error {
+	return p.done
+}
+
+// Kill terminates the process and everything it started, and its container
+// or remote gemini if it has one: killing docker run or ssh leaves them
+// running.
+func (p *Process) Kill() error {
+	if p.container != "" {
+		removeContainer(p.container)
+	}
+	if p.remote != nil {
+		p.remote.kill(p.worktree)
+	}
+	return procgroup.Kill(p.cmd)
+}
+
+// SelectModelAndAccount picks the model and an account for it using the
+// project's account rotation, and says why that account. Simple tasks upgrade to the complex model when simple quota is gone.
+// A model chosen by the assigner (to respect model_limits) is used as is.
+func SelectModelAndAccount(q *quota.Quota, projCfg *project.Config, task *beads.Task, model string) (string, quota.AccountQuota, string, error) {
+	simpleModel, complexModel := projCfg.Models()
+
+	candidates := []string{simpleModel, complexModel}
+	switch {
+	case model != "":
+		candidates = []string{model}
+	case task.IsComplex:
+		// Complex tasks require complex model - no fallback
+		candidates = []string{complexModel}
+	}
+
+	for _, model := range candidates {
+		acc, reason, err := q.Pick(model, projCfg.AccountRotation)
+		if err != nil {
+			continue
+		}
+		return model, acc, reason, nil
+	}
+	return "", quota.AccountQuota{}, "", fmt.Errorf("no quota available for %v", candidates)
+}
@@ -0,0 +1,42 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTokens(t *testing.T) {
+	tests := []struct {
+		name string
+		log  string
+		want int64
+	}{
+		{"result", `{"type":"message","content":"hi"}
+{"type":"result","status":"success","stats":{"total_tokens":12000}}
+`, 12000},
+		{"results add up", `{"type":"result","stats":{"total_tokens":100}}
+{"type":"result","stats":{"total_tokens":250}}
+`, 350},
+		{"no stats", `{"type":"result","status":"error"}
+`, 0},
+		{"only other events", `{"type":"tool_use","stats":{"total_tokens":99}}
+`, 0},
+		{"malformed lines skipped", `{"type":"result","stats":{"total_tok
+not json
+{"type":"result","stats":{"total_tokens":7}}`, 7},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		os.MkdirAll(filepath.Join(dir, "logs"), 0755)
+		if err := os.WriteFile(LogPath(dir, 1), []byte(tt.log), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if got := Tokens(dir, 1); got != tt.want {
+			t.Errorf("%s: Tokens = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+	if got := Tokens(t.TempDir(), 1); got != 0 {
+		t.Errorf("no log: Tokens = %d, want 0", got)
+	}
+}
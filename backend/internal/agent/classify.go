@@ -0,0 +1,38 @@
+package agent
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/bryantinsley/machinator/backend/internal/beads"
+	"github.com/bryantinsley/machinator/backend/internal/project"
+)
+
+// fileMention matches a file named in a task, with or without a directory:
+// tui.go, internal/tui/tui.go, src/app.tsx.
+var fileMention = regexp.MustCompile(`[\w./-]*\w\.(?:go|py|rb|rs|java|kt|swift|c|cc|cpp|h|hpp|cs|js|jsx|ts|tsx|vue|css|scss|html|sql|proto|sh|md|yaml|yml|json|toml)\b`)
+
+// Classify applies a project's complexity rules to a task. It returns
+// beads.ComplexTag and why when a rule matches, or "" when none does.
+func Classify(rules project.ComplexityConfig, task *beads.Task) (string, string) {
+	for _, label := range task.Labels {
+		if slices.Contains(rules.Labels, label) {
+			return beads.ComplexTag, fmt.Sprintf("label %s", label)
+		}
+	}
+	if n := len(strings.TrimSpace(task.Description)); rules.DescriptionLength > 0 && n >= rules.DescriptionLength {
+		return beads.ComplexTag, fmt.Sprintf("description is %d characters", n)
+	}
+	if rules.FileCount > 0 {
+		files := make(map[string]bool)
+		for _, f := range fileMention.FindAllString(strings.Join([]string{task.Title, task.Description, task.Design, task.AcceptanceCriteria}, "\n"), -1) {
+			files[strings.TrimPrefix(f, "./")] = true
+		}
+		if len(files) >= rules.FileCount {
+			return beads.ComplexTag, fmt.Sprintf("mentions %d files", len(files))
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,37 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bryantinsley/machinator/backend/internal/beads"
+	"github.com/bryantinsley/machinator/backend/internal/project"
+)
+
+func TestClassify(t *testing.T) {
+	rules := project.ComplexityConfig{DescriptionLength: 200, FileCount: 3, Labels: []string{"refactor"}}
+	tests := []struct {
+		name   string
+		task   beads.Task
+		tag    string
+		reason string
+	}{
+		{"no rule", beads.Task{Title: "Fix typo in README.md"}, "", ""},
+		{"label", beads.Task{Title: "Split server", Labels: []string{"api", "refactor"}}, beads.ComplexTag, "label refactor"},
+		{"long description", beads.Task{Title: "Rework", Description: strings.Repeat("x", 250)}, beads.ComplexTag, "description is 250 characters"},
+		{"files", beads.Task{Title: "Move config", Description: "Touches internal/config/flags.go, ./main.go and docs/setup.md; see e.g. main.go"}, beads.ComplexTag, "mentions 3 files"},
+		{"few files", beads.Task{Title: "Fix flags.go", Description: "Version 1.2 of flags.go, e.g. here"}, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tag, reason := Classify(rules, &tt.task)
+			if tag != tt.tag || reason != tt.reason {
+				t.Errorf("Classify() = %q, %q, want %q, %q", tag, reason, tt.tag, tt.reason)
+			}
+		})
+	}
+
+	if tag, _ := Classify(project.ComplexityConfig{}, &beads.Task{Labels: []string{"refactor"}, Description: strings.Repeat("x", 5000)}); tag != "" {
+		t.Errorf("no rules: got %q, want no tag", tag)
+	}
+}
@@ -0,0 +1,66 @@
+package agent
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// dockerEnv are the variables passed from gemini's environment into its
+// container (docker run -e NAME takes the value from docker's own).
+var dockerEnv = []string{
+	"HOME", "GEMINI_CLI_HOME", "GEMINI_FORCE_FILE_STORAGE",
+	"MACHINATOR_SCRATCH_DIR", "TMPDIR",
+	"GIT_AUTHOR_NAME", "GIT_AUTHOR_EMAIL", "GIT_COMMITTER_NAME", "GIT_COMMITTER_EMAIL",
+}
+
+// ContainerName returns the name of the container an agent's gemini runs
+// in, unique to its worktree so agents of different projects don't clash.
+func ContainerName(worktreeDir string) string {
+	sum := sha256.Sum256([]byte(worktreeDir))
+	return fmt.Sprintf("machinator-%s-%x", filepath.Base(worktreeDir), sum[:4])
+}
+
+// dockerCommand runs gemini in a container of opts.DockerImage, as the
+// user machinator runs as, with writableDirs mounted at the same paths (the
+// git directories' hooks and config read-only) and gemini itself mounted
+// read-only. The image provides the rest: node for
+// gemini, git, bd and the project's toolchain.
+func dockerCommand(geminiPath string, args []string, opts LaunchOptions) *exec.Cmd {
+	dockerArgs := []string{"run", "--rm", "--init",
+		"--name", ContainerName(opts.WorktreeDir),
+		"--user", fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()),
+		"--workdir", filepath.Join(opts.WorktreeDir, opts.Scope),
+	}
+	resources := filepath.Join(opts.MachinatorDir, "resources")
+	for _, dir := range []string{geminiPath, resources} {
+		dockerArgs = append(dockerArgs, "--volume", dir+":"+dir+":ro")
+	}
+	writable, readOnly := writableDirs(opts)
+	for _, dir := range writable {
+		dockerArgs = append(dockerArgs, "--volume", dir+":"+dir)
+	}
+	for _, path := range readOnly {
+		if _, err := os.Stat(path); err == nil {
+			dockerArgs = append(dockerArgs, "--volume", path+":"+path+":ro")
+		}
+	}
+	for _, name := range dockerEnv {
+		dockerArgs = append(dockerArgs, "--env", name)
+	}
+	dockerArgs = append(dockerArgs, opts.DockerImage, geminiPath)
+	return exec.Command("docker", append(dockerArgs, args...)...)
+}
+
+// removeContainer stops and removes an agent's container, if it has one
+// (left running by a killed or crashed run).
+func removeContainer(worktreeDir string) error {
+	out, err := exec.Command("docker", "rm", "--force", ContainerName(worktreeDir)).CombinedOutput()
+	if err != nil && !strings.Contains(string(out), "No such container") {
+		return fmt.Errorf("docker rm: %w\nOutput: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
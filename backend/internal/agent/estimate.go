@@ -0,0 +1,69 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/beads"
+	"github.com/bryantinsley/machinator/backend/internal/procgroup"
+	"github.com/bryantinsley/machinator/backend/internal/quota"
+	"github.com/bryantinsley/machinator/backend/internal/tools"
+)
+
+// estimateTimeout bounds one estimation call.
+const estimateTimeout = 2 * time.Minute
+
+// estimatePrompt asks for a complexity tag; the task follows it.
+const estimatePrompt = `Decide how hard this software task is, so it can be routed to a model.
+Do not use any tools. Answer with exactly one of these tags and nothing else:
+CHALLENGE:simple  - a junior developer could do it in minutes: routine code, boilerplate, small fixes, docs
+CHALLENGE:complex - a senior developer needs to think: architecture, refactoring, tricky logic, concurrency bugs, planning
+
+`
+
+var challengeTag = regexp.MustCompile(`CHALLENGE:(simple|complex)`)
+
+// Estimate asks model, on account, whether a task is simple or complex and
+// returns the tag to give it (beads.SimpleTag or beads.ComplexTag).
+func Estimate(machinatorDir, model string, account quota.AccountQuota, task *beads.Task) (string, error) {
+	dir, err := os.MkdirTemp("", "machinator-estimate-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), estimateTimeout)
+	defer cancel()
+
+	prompt := fmt.Sprintf("%sTitle: %s\n\nDescription:\n%s\n", estimatePrompt, task.Title, task.Description)
+	cmd := procgroup.Command(ctx, filepath.Join(machinatorDir, "gemini"), "--model", model, prompt)
+	cmd.Dir = dir // Nothing to read or change
+	cmd.Env = append(tools.Environ(),
+		"HOME="+account.HomeDir,
+		"GEMINI_CLI_HOME="+account.HomeDir,
+		"GEMINI_FORCE_FILE_STORAGE=true",
+	)
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("gemini: %w", err)
+	}
+
+	// The answer is the last tag given
+	tags := challengeTag.FindAllString(string(out), -1)
+	if len(tags) == 0 {
+		return "", fmt.Errorf("no CHALLENGE tag in answer %q", clip(strings.TrimSpace(string(out)), 80))
+	}
+	return tags[len(tags)-1], nil
+}
+
+func clip(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
@@ -0,0 +1,194 @@
+package agent
+
+import (
+	"fmt"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bryantinsley/machinator/backend/internal/project"
+	"github.com/bryantinsley/machinator/backend/internal/tools"
+)
+
+// sshOptions keep ssh from prompting: a host that needs a password or an
+// unknown host key fails instead of hanging an agent.
+var sshOptions = []string{"-o", "BatchMode=yes"}
+
+// Remote is a host agents run gemini on over SSH, with the parts of
+// MACHINATOR_DIR a run needs mirrored under Dir.
+type Remote struct {
+	Host          string
+	Dir           string // Absolute path on Host
+	Gemini        string
+	MachinatorDir string // Local MACHINATOR_DIR
+}
+
+// DialRemote connects to cfg's host and creates its directory there.
+func DialRemote(cfg project.RemoteConfig, machinatorDir string) (*Remote, error) {
+	r := &Remote{Host: cfg.Host, Gemini: cfg.Gemini, MachinatorDir: machinatorDir}
+	// Relative to the remote home, where ssh starts
+	out, err := r.ssh(fmt.Sprintf("mkdir -p %s && cd %s && pwd", shellQuote(cfg.Dir), shellQuote(cfg.Dir))).Output()
+	if err != nil {
+		return nil, fmt.Errorf("ssh %s: %w", cfg.Host, commandError(err))
+	}
+	r.Dir = strings.TrimSpace(string(out))
+	return r, nil
+}
+
+// Path returns where a local path under MACHINATOR_DIR is mirrored on the
+// host.
+func (r *Remote) Path(local string) string {
+	rel, err := filepath.Rel(r.MachinatorDir, local)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		rel = filepath.Join("external", local) // An account home outside it
+	}
+	return path.Join(r.Dir, filepath.ToSlash(rel))
+}
+
+// ssh returns a command running script on the host.
+func (r *Remote) ssh(script string) *exec.Cmd {
+	return exec.Command("ssh", append(append([]string{}, sshOptions...), r.Host, script)...)
+}
+
+// rsync copies the contents of directory src to dst, one of them on the
+// host ("host:path"), with extra rsync flags.
+func (r *Remote) rsync(src, dst string, flags ...string) error {
+	args := append([]string{"-a", "-e", "ssh " + strings.Join(sshOptions, " ")}, flags...)
+	out, err := exec.Command("rsync", append(args, src+"/", dst+"/")...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("rsync %s: %w\nOutput: %s", src, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// git runs git in a local directory, its ssh kept from prompting too.
+func (r *Remote) git(dir string, args ...string) (string, error) {
+	cmd := tools.Command(tools.Git, append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(cmd.Environ(), "GIT_SSH_COMMAND=ssh "+strings.Join(sshOptions, " "))
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w\nOutput: %s", args[0], err, strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// pidFile is where the host keeps the pid of an agent's gemini.
+func (r *Remote) pidFile(worktreeDir string) string {
+	return r.Path(worktreeDir) + ".pid"
+}
+
+// provision mirrors what a run needs to the host: the worktree's commits
+// (pushed to a repo of its own there) and its files, uncommitted changes
+// included, the task's scratch space and the account.
+func (r *Remote) provision(opts LaunchOptions) error {
+	wt := r.Path(opts.WorktreeDir)
+	dirs := []string{r.Path(opts.Account.HomeDir)}
+	if opts.ScratchDir != "" {
+		dirs = append(dirs, r.Path(opts.ScratchDir))
+	}
+	script := "git init -q " + shellQuote(wt)
+	for _, dir := range dirs {
+		script += " && mkdir -p " + shellQuote(dir)
+	}
+	if out, err := r.ssh(script).CombinedOutput(); err != nil {
+		return fmt.Errorf("ssh %s: %w\nOutput: %s", r.Host, err, strings.TrimSpace(string(out)))
+	}
+
+	branch, err := r.git(opts.WorktreeDir, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return err
+	}
+	if _, err := r.git(opts.WorktreeDir, "push", "-q", "--force", r.Host+":"+wt, "HEAD:refs/machinator/head"); err != nil {
+		return err
+	}
+	checkout := "--detach"
+	if branch != "HEAD" {
+		checkout = "-B " + shellQuote(branch)
+	}
+	if out, err := r.ssh(fmt.Sprintf("git -C %s checkout -q -f %s refs/machinator/head", shellQuote(wt), checkout)).CombinedOutput(); err != nil {
+		return fmt.Errorf("checkout on %s: %w\nOutput: %s", r.Host, err, strings.TrimSpace(string(out)))
+	}
+
+	if err := r.rsync(opts.WorktreeDir, r.Host+":"+wt, "--delete", "--exclude=/.git"); err != nil {
+		return err
+	}
+	if opts.ScratchDir != "" {
+		if err := r.rsync(opts.ScratchDir, r.Host+":"+r.Path(opts.ScratchDir), "--delete"); err != nil {
+			return err
+		}
+	}
+	// Other agents may share the account, keep the freshest credentials
+	return r.rsync(opts.Account.HomeDir, r.Host+":"+r.Path(opts.Account.HomeDir), "--update")
+}
+
+// retrieve mirrors a finished run back: the commits the agent made, the
+// worktree's files, the scratch space and the account's refreshed
+// credentials.
+func (r *Remote) retrieve(opts LaunchOptions) error {
+	wt := r.Path(opts.WorktreeDir)
+	if _, err := r.git(opts.WorktreeDir, "fetch", "-q", r.Host+":"+wt, "HEAD"); err != nil {
+		return err
+	}
+	if _, err := r.git(opts.WorktreeDir, "reset", "-q", "--hard", "FETCH_HEAD"); err != nil {
+		return err
+	}
+	if err := r.rsync(r.Host+":"+wt, opts.WorktreeDir, "--delete", "--exclude=/.git"); err != nil {
+		return err
+	}
+	if opts.ScratchDir != "" {
+		if err := r.rsync(r.Host+":"+r.Path(opts.ScratchDir), opts.ScratchDir, "--delete"); err != nil {
+			return err
+		}
+	}
+	return r.rsync(r.Host+":"+r.Path(opts.Account.HomeDir), opts.Account.HomeDir, "--update")
+}
+
+// command runs gemini on the host in the worktree's mirror, its output
+// streamed back over the connection. Nothing sandboxes it there: the host
+// is the sandbox.
+func (r *Remote) command(opts LaunchOptions) *exec.Cmd {
+	wt := r.Path(opts.WorktreeDir)
+	home := r.Path(opts.Account.HomeDir)
+	env := []string{"HOME=" + home, "GEMINI_CLI_HOME=" + home, "GEMINI_FORCE_FILE_STORAGE=true"}
+	if opts.ScratchDir != "" {
+		scratch := r.Path(opts.ScratchDir)
+		env = append(env, "MACHINATOR_SCRATCH_DIR="+scratch, "TMPDIR="+scratch)
+	}
+	env = append(env, commitEnv(opts.AgentID)...)
+
+	words := []string{"exec", "env"}
+	for _, kv := range env {
+		words = append(words, shellQuote(kv))
+	}
+	words = append(words, shellQuote(r.Gemini))
+	for _, arg := range geminiArgs(opts, wt) {
+		words = append(words, shellQuote(arg))
+	}
+	// The pid lets Kill stop gemini: ssh going away doesn't
+	script := fmt.Sprintf("echo $$ > %s && cd %s && %s",
+		shellQuote(r.pidFile(opts.WorktreeDir)), shellQuote(path.Join(wt, opts.Scope)), strings.Join(words, " "))
+	return r.ssh(script)
+}
+
+// kill stops an agent's gemini on the host, if it's running.
+func (r *Remote) kill(worktreeDir string) error {
+	pidFile := shellQuote(r.pidFile(worktreeDir))
+	if out, err := r.ssh(fmt.Sprintf("test -f %s && kill $(cat %s) 2>/dev/null; rm -f %s", pidFile, pidFile, pidFile)).CombinedOutput(); err != nil {
+		return fmt.Errorf("ssh %s: %w\nOutput: %s", r.Host, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// commandError adds a failed command's stderr to its error.
+func commandError(err error) error {
+	if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return err
+}
@@ -0,0 +1,68 @@
+package agent
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/bryantinsley/machinator/backend/internal/quota"
+)
+
+func TestRemotePath(t *testing.T) {
+	r := &Remote{Host: "buildbox", Dir: "/home/me/.machinator-remote", MachinatorDir: "/Users/me/.machinator"}
+	for local, want := range map[string]string{
+		"/Users/me/.machinator/projects/1/agents/2": "/home/me/.machinator-remote/projects/1/agents/2",
+		"/Users/me/.machinator":                     "/home/me/.machinator-remote",
+		"/Users/me/gemini-home":                     "/home/me/.machinator-remote/external/Users/me/gemini-home",
+	} {
+		if got := r.Path(local); got != want {
+			t.Errorf("Path(%q) = %q, want %q", local, got, want)
+		}
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	for _, s := range []string{"plain", "it's", "$HOME `x` \"y\"", ""} {
+		out, err := exec.Command("sh", "-c", "printf %s "+shellQuote(s)).Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != s {
+			t.Errorf("sh printed %q for shellQuote(%q)", out, s)
+		}
+	}
+}
+
+func TestRemoteCommand(t *testing.T) {
+	r := &Remote{Host: "buildbox", Dir: "/srv/m", Gemini: "gemini", MachinatorDir: "/local/m"}
+	cmd := Command(LaunchOptions{
+		MachinatorDir: "/local/m",
+		AgentID:       3,
+		WorktreeDir:   "/local/m/projects/1/agents/3",
+		Model:         "gemini-3-pro-preview",
+		Account:       quota.AccountQuota{Name: "a", HomeDir: "/local/m/accounts/a"},
+		Directive:     "Fix the agent's bug",
+		ScratchDir:    "/local/m/projects/1/scratch/t-1",
+		Scope:         "svc",
+		Remote:        r,
+	})
+	if cmd.Args[0] != "ssh" || cmd.Args[len(cmd.Args)-2] != "buildbox" {
+		t.Fatalf("Command = %q, want ssh to buildbox", cmd.Args)
+	}
+	script := cmd.Args[len(cmd.Args)-1]
+	for _, want := range []string{
+		"echo $$ > '/srv/m/projects/1/agents/3.pid'",
+		"cd '/srv/m/projects/1/agents/3/svc'",
+		"'HOME=/srv/m/accounts/a'",
+		"'TMPDIR=/srv/m/projects/1/scratch/t-1'",
+		"'--include-directories' '/srv/m/projects/1/agents/3/.beads'",
+		`'Fix the agent'\''s bug'`,
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("script %q lacks %q", script, want)
+		}
+	}
+	if strings.Contains(script, "/local/m") {
+		t.Errorf("script %q uses local paths", script)
+	}
+}
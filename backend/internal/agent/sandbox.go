@@ -0,0 +1,231 @@
+package agent
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/bryantinsley/machinator/backend/internal/tools"
+)
+
+// GeminiHosts are the hosts a sandboxed agent may connect to: the Gemini
+// API (through an API key or Code Assist) and Google sign-in. They're
+// exact, not ".googleapis.com", which would let an agent upload anywhere
+// on Google Cloud Storage.
+var GeminiHosts = []string{
+	"generativelanguage.googleapis.com",
+	"cloudcode-pa.googleapis.com",
+	"oauth2.googleapis.com",
+	"accounts.google.com",
+}
+
+// gitReadOnly are the paths in a clone's git directory a sandboxed agent
+// mustn't write though the rest is writable: machinator's own git reads
+// config and runs hooks there, outside the sandbox.
+var gitReadOnly = []string{"config", "hooks", "info"}
+
+// SandboxExecCommand is the machinator subcommand that runs gemini inside
+// bubblewrap, relaying its proxy connections out of the sandbox.
+const SandboxExecCommand = "sandbox-exec"
+
+// Bubblewrap returns the bwrap binary agents are sandboxed with on Linux,
+// or "" where gemini's own --sandbox (seatbelt on macOS) is used instead.
+func Bubblewrap() string {
+	if runtime.GOOS != "linux" {
+		return ""
+	}
+	path, _ := exec.LookPath("bwrap")
+	return path
+}
+
+// ProxySocket returns where an agent's sandbox reaches the network proxy.
+func ProxySocket(machinatorDir string, agentID int) string {
+	return filepath.Join(machinatorDir, "logs", fmt.Sprintf("agent-%d-proxy.sock", agentID))
+}
+
+// writableDirs are the directories a sandboxed agent may write: its
+// worktree (just the scope and .beads for scoped projects), the git
+// directories behind it, its scratch space and its account. readOnly are
+// the paths within them (gitReadOnly in each git directory) to mount
+// read-only over them.
+func writableDirs(opts LaunchOptions) (dirs, readOnly []string) {
+	writable := []string{filepath.Join(opts.WorktreeDir, opts.Scope)}
+	if opts.Scope != "" {
+		writable = append(writable, filepath.Join(opts.WorktreeDir, ".beads"))
+	}
+	repos, _ := filepath.Glob(filepath.Join(opts.WorktreeDir, ".repos", "*"))
+	for _, dir := range append([]string{opts.WorktreeDir}, repos...) {
+		// Commits are written to the clone the worktree belongs to
+		if out, err := tools.Command(tools.Git, "-C", dir, "rev-parse", "--path-format=absolute", "--git-common-dir").Output(); err == nil {
+			gitDir := strings.TrimSpace(string(out))
+			writable = append(writable, gitDir)
+			for _, name := range gitReadOnly {
+				path := filepath.Join(gitDir, name)
+				// A directory missing would be one the agent could create
+				if name != "config" {
+					os.MkdirAll(path, 0755)
+				}
+				readOnly = append(readOnly, path)
+			}
+		}
+	}
+	for _, dir := range append(writable, opts.ScratchDir, opts.Account.HomeDir) {
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs, readOnly
+}
+
+// bubblewrapCommand runs gemini in a bubblewrap sandbox: the filesystem is
+// read-only except for writableDirs, and the only network is the proxy on
+// ProxySocket. Later binds win, so the read-only paths go last.
+func bubblewrapCommand(bwrap, geminiPath string, args []string, opts LaunchOptions) *exec.Cmd {
+	socket := ProxySocket(opts.MachinatorDir, opts.AgentID)
+	bwrapArgs := []string{
+		"--die-with-parent", "--new-session", "--unshare-all",
+		"--ro-bind", "/", "/",
+		"--dev", "/dev", "--proc", "/proc", "--tmpfs", "/tmp",
+	}
+	writable, readOnly := writableDirs(opts)
+	for _, dir := range writable {
+		bwrapArgs = append(bwrapArgs, "--bind-try", dir, dir)
+	}
+	for _, path := range readOnly {
+		bwrapArgs = append(bwrapArgs, "--ro-bind-try", path, path)
+	}
+	self, err := os.Executable()
+	if err != nil {
+		self = "machinator"
+	}
+	bwrapArgs = append(bwrapArgs, "--bind", socket, socket,
+		"--", self, SandboxExecCommand, socket, "--", geminiPath)
+	return exec.Command(bwrap, append(bwrapArgs, args...)...)
+}
+
+// allowedHost reports whether host (without port) matches hosts.
+func allowedHost(host string, hosts []string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, h := range hosts {
+		if host == h || strings.HasPrefix(h, ".") && strings.HasSuffix(host, h) {
+			return true
+		}
+	}
+	return false
+}
+
+// serveProxy listens on socket for HTTPS proxy (CONNECT) requests and
+// tunnels those to hosts, refusing the rest, until closed.
+func serveProxy(socket string, hosts []string) (io.Closer, error) {
+	os.Remove(socket) // Left by an earlier run
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("listen on proxy socket: %w", err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go proxyConn(conn, hosts)
+		}
+	}()
+	return ln, nil
+}
+
+// proxyConn serves one CONNECT request.
+func proxyConn(conn net.Conn, hosts []string) {
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	req, err := http.ReadRequest(br)
+	if err != nil {
+		return
+	}
+	host, _, err := net.SplitHostPort(req.Host)
+	if req.Method != http.MethodConnect || err != nil || !allowedHost(host, hosts) {
+		fmt.Fprintf(conn, "HTTP/1.1 403 Forbidden\r\nContent-Length: 0\r\nConnection: close\r\n\r\n")
+		return
+	}
+	upstream, err := net.Dial("tcp", req.Host)
+	if err != nil {
+		fmt.Fprintf(conn, "HTTP/1.1 502 Bad Gateway\r\nContent-Length: 0\r\nConnection: close\r\n\r\n")
+		return
+	}
+	defer upstream.Close()
+	fmt.Fprintf(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+	pipe(upstream, br, conn)
+}
+
+// pipe copies between a and b (reading b through br) until both are done.
+func pipe(a net.Conn, br io.Reader, b net.Conn) {
+	done := make(chan struct{})
+	go func() {
+		io.Copy(a, br)
+		if c, ok := a.(interface{ CloseWrite() error }); ok {
+			c.CloseWrite()
+		}
+		close(done)
+	}()
+	io.Copy(b, a)
+	if c, ok := b.(interface{ CloseWrite() error }); ok {
+		c.CloseWrite()
+	}
+	<-done
+}
+
+// SandboxExec runs inside the sandbox, as `machinator sandbox-exec SOCKET
+// -- COMMAND...`: it relays a loopback port to the proxy on SOCKET, runs
+// the command with HTTPS_PROXY pointing at it, and returns its exit code.
+func SandboxExec(args []string) (int, error) {
+	if len(args) < 3 || args[1] != "--" {
+		return 2, fmt.Errorf("usage: machinator %s SOCKET -- COMMAND [ARGS...]", SandboxExecCommand)
+	}
+	socket, command := args[0], args[2:]
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 1, fmt.Errorf("listen for proxy: %w", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				upstream, err := net.Dial("unix", socket)
+				if err != nil {
+					return
+				}
+				defer upstream.Close()
+				pipe(upstream, conn, conn)
+			}()
+		}
+	}()
+
+	proxy := "http://" + ln.Addr().String()
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = append(tools.Environ(),
+		"HTTPS_PROXY="+proxy, "https_proxy="+proxy,
+		"HTTP_PROXY="+proxy, "http_proxy="+proxy,
+		"NO_PROXY=", "no_proxy=",
+	)
+	if err := cmd.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return exitErr.ExitCode(), nil
+		}
+		return 1, err
+	}
+	return 0, nil
+}
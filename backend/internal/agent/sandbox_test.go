@@ -0,0 +1,161 @@
+package agent
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAllowedHost(t *testing.T) {
+	for host, want := range map[string]bool{
+		"generativelanguage.googleapis.com":  true,
+		"GENERATIVELANGUAGE.GOOGLEAPIS.COM.": true,
+		"cloudcode-pa.googleapis.com":        true,
+		"accounts.google.com":                true,
+		"storage.googleapis.com":             false,
+		"googleapis.com":                     false,
+		"evilgoogleapis.com":                 false,
+		"example.com":                        false,
+	} {
+		if got := allowedHost(host, GeminiHosts); got != want {
+			t.Errorf("allowedHost(%q) = %v, want %v", host, got, want)
+		}
+	}
+}
+
+func TestProxy(t *testing.T) {
+	// An upstream that echoes a line back
+	up, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer up.Close()
+	go func() {
+		for {
+			conn, err := up.Accept()
+			if err != nil {
+				return
+			}
+			line, _ := bufio.NewReader(conn).ReadString('\n')
+			io.WriteString(conn, line)
+			conn.Close()
+		}
+	}()
+
+	dir, err := os.MkdirTemp("", "proxy") // Short enough for a socket path
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "p.sock")
+	proxy, err := serveProxy(socket, []string{"127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proxy.Close()
+
+	connect := func(host string) (net.Conn, *bufio.Reader, int) {
+		conn, err := net.Dial("unix", socket)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", host, host)
+		br := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn, br, resp.StatusCode
+	}
+
+	if conn, _, code := connect("example.com:443"); code != http.StatusForbidden {
+		t.Errorf("CONNECT to a host not allowed: %d, want 403", code)
+	} else {
+		conn.Close()
+	}
+	conn, br, code := connect(up.Addr().String())
+	defer conn.Close()
+	if code != http.StatusOK {
+		t.Fatalf("CONNECT to an allowed host: %d, want 200", code)
+	}
+	io.WriteString(conn, "hello\n")
+	if line, _ := br.ReadString('\n'); strings.TrimSpace(line) != "hello" {
+		t.Errorf("tunnelled reply = %q, want hello", line)
+	}
+}
+
+func TestDockerCommand(t *testing.T) {
+	opts := LaunchOptions{
+		MachinatorDir: "/m",
+		AgentID:       2,
+		WorktreeDir:   "/m/projects/1/agents/2",
+		Directive:     "do it",
+		ScratchDir:    "/m/projects/1/scratch/t-1",
+		Scope:         "svc",
+		DockerImage:   "toolchain:1",
+	}
+	opts.Account.HomeDir = "/m/accounts/a"
+	cmd := Command(opts)
+	got := strings.Join(cmd.Args, " ")
+	for _, want := range []string{
+		"docker run --rm --init --name " + ContainerName(opts.WorktreeDir),
+		"--workdir /m/projects/1/agents/2/svc",
+		"--volume /m/gemini:/m/gemini:ro",
+		"--volume /m/projects/1/agents/2/svc:/m/projects/1/agents/2/svc ",
+		"--volume /m/projects/1/agents/2/.beads:/m/projects/1/agents/2/.beads ",
+		"--volume /m/accounts/a:/m/accounts/a ",
+		"--env HOME ",
+		"toolchain:1 /m/gemini --yolo",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("command missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "--sandbox") {
+		t.Errorf("container runs gemini's own sandbox too:\n%s", got)
+	}
+	if ContainerName("/a/projects/1/agents/2") == ContainerName("/a/projects/2/agents/2") {
+		t.Error("agents of different projects share a container name")
+	}
+}
+
+func TestSandboxKeepsGitConfigReadOnly(t *testing.T) {
+	root := t.TempDir()
+	repo, wt := filepath.Join(root, "repo"), filepath.Join(root, "wt")
+	for _, args := range [][]string{
+		{"init", "-q", repo},
+		{"-C", repo, "-c", "user.name=t", "-c", "user.email=t@t", "commit", "-q", "--allow-empty", "-m", "init"},
+		{"-C", repo, "worktree", "add", "-q", "--detach", wt},
+	} {
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	os.RemoveAll(filepath.Join(repo, ".git", "info")) // Made for the sandbox if missing
+	gitDir, _ := filepath.EvalSymlinks(filepath.Join(repo, ".git"))
+	opts := LaunchOptions{MachinatorDir: "/m", AgentID: 1, WorktreeDir: wt}
+
+	bwrap := strings.Join(bubblewrapCommand("bwrap", "/m/gemini", nil, opts).Args, " ")
+	writable := strings.Index(bwrap, "--bind-try "+gitDir+" "+gitDir+" ")
+	if writable < 0 {
+		t.Fatalf("git directory not writable:\n%s", bwrap)
+	}
+	for _, name := range []string{"config", "hooks", "info"} {
+		path := filepath.Join(gitDir, name)
+		if i := strings.Index(bwrap, "--ro-bind-try "+path+" "+path+" "); i < writable {
+			t.Errorf("%s not bound read-only over the git directory:\n%s", name, bwrap)
+		}
+		opts.DockerImage = "toolchain:1"
+		if docker := strings.Join(dockerCommand("/m/gemini", nil, opts).Args, " "); !strings.Contains(docker, "--volume "+path+":"+path+":ro") {
+			t.Errorf("%s not mounted read-only in the container:\n%s", name, docker)
+		}
+		opts.DockerImage = ""
+	}
+}
@@ -0,0 +1,189 @@
+// Package agenttest plays scripted gemini runs in process, through the
+// agent.Runner agents are launched with. Set agent.Gemini to a Runner and
+// the orchestrator's handling of runs (timeouts, retries, failures) can be
+// tested with go test alone: no gemini binary, wrapper scripts or PATH.
+package agenttest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/agent"
+	"github.com/bryantinsley/machinator/backend/internal/beads"
+)
+
+// ErrKilled is what a run's Done reports when it was killed, as a killed
+// gemini's exit error would.
+var ErrKilled = errors.New("signal: killed")
+
+// Step is one thing a scripted run does, after waiting After.
+type Step struct {
+	After time.Duration
+	// Event is written to the agent's log as a line of stream-json.
+	Event map[string]any
+	// Do acts as gemini would, e.g. closes the task in the worktree. An
+	// error ends the run with it.
+	Do func(opts agent.LaunchOptions) error
+}
+
+// Script is a scripted run: its steps in order, then its exit.
+type Script struct {
+	Steps []Step
+	Exit  error // What Done reports; nil is success
+	Hang  bool  // After the steps, wait to be killed rather than exit
+}
+
+// Runner is an agent.Runner that plays scripts instead of running gemini.
+type Runner struct {
+	// Script picks each run's script; n counts the runs launched before,
+	// so a retry can be told apart from the first attempt.
+	Script func(opts agent.LaunchOptions, n int) Script
+
+	mu       sync.Mutex
+	launches []agent.LaunchOptions
+}
+
+// pidBase numbers fake runs well above real process IDs.
+const pidBase = 1 << 22
+
+// Launch starts playing the run's script, truncating the agent's log as
+// agent.Launch does. The run is killed when ctx is done.
+func (r *Runner) Launch(ctx context.Context, opts agent.LaunchOptions) (agent.Run, error) {
+	logPath := agent.LogPath(opts.MachinatorDir, opts.AgentID)
+	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
+		return nil, fmt.Errorf("create logs dir: %w", err)
+	}
+	log, err := os.Create(logPath)
+	if err != nil {
+		return nil, fmt.Errorf("create log file: %w", err)
+	}
+
+	r.mu.Lock()
+	n := len(r.launches)
+	r.launches = append(r.launches, opts)
+	r.mu.Unlock()
+	script := r.Script(opts, n)
+
+	p := &run{pid: pidBase + n, done: make(chan error, 1), killed: make(chan struct{})}
+	stop := context.AfterFunc(ctx, func() { p.Kill() })
+	go func() {
+		err := p.play(script, opts, log)
+		stop()
+		log.Close()
+		p.done <- err
+	}()
+	return p, nil
+}
+
+// Launches returns the options of every run launched so far, in order.
+func (r *Runner) Launches() []agent.LaunchOptions {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]agent.LaunchOptions(nil), r.launches...)
+}
+
+// run is a script being played.
+type run struct {
+	pid    int
+	done   chan error
+	killed chan struct{}
+	kill   sync.Once
+}
+
+func (p *run) PID() int           { return p.pid }
+func (p *run) Done() <-chan error { return p.done }
+func (p *run) Kill() error        { p.kill.Do(func() { close(p.killed) }); return nil }
+
+// play runs a script's steps and returns the run's exit error.
+func (p *run) play(s Script, opts agent.LaunchOptions, log io.Writer) error {
+	for _, step := range s.Steps {
+		if step.After > 0 {
+			select {
+			case <-time.After(step.After):
+			case <-p.killed:
+				return ErrKilled
+			}
+		}
+		select {
+		case <-p.killed:
+			return ErrKilled
+		default:
+		}
+		if step.Event != nil {
+			line, err := json.Marshal(step.Event)
+			if err != nil {
+				return err
+			}
+			if _, err := log.Write(append(line, '\n')); err != nil {
+				return err
+			}
+		}
+		if step.Do != nil {
+			if err := step.Do(opts); err != nil {
+				return err
+			}
+		}
+	}
+	if s.Hang {
+		<-p.killed
+		return ErrKilled
+	}
+	return s.Exit
+}
+
+// Message is a step writing an assistant message.
+func Message(content string) Step {
+	return Step{Event: map[string]any{"type": "message", "role": "assistant", "content": content}}
+}
+
+// Result is a step writing the run's result event, with the tokens it
+// used (see agent.Tokens).
+func Result(status string, tokens int64) Step {
+	return Step{Event: map[string]any{"type": "result", "status": status, "stats": map[string]int64{"total_tokens": tokens}}}
+}
+
+// CloseTask is a step closing a task in the agent's worktree, as an agent
+// does when it's done. Pushing the change is left to the orchestrator's
+// sync of uncommitted task changes.
+func CloseTask(taskID string) Step {
+	return Step{Do: func(opts agent.LaunchOptions) error {
+		var stderr strings.Builder
+		if beads.Native(opts.WorktreeDir, []string{"close", taskID, "--reason", "Done (agenttest)"}, io.Discard, &stderr) != 0 {
+			return fmt.Errorf("close %s: %s", taskID, strings.TrimSpace(stderr.String()))
+		}
+		return nil
+	}}
+}
+
+// Completes is a run that closes taskID and exits successfully, having
+// used tokens.
+func Completes(taskID string, tokens int64) Script {
+	return Script{Steps: []Step{
+		Message("Working on " + taskID),
+		CloseTask(taskID),
+		Result("success", tokens),
+	}}
+}
+
+// Fails is a run that exits with err without closing its task, as gemini
+// does on a fatal error.
+func Fails(err error) Script {
+	return Script{Steps: []Step{
+		{Event: map[string]any{"type": "error", "message": err.Error()}},
+		Result("error", 0),
+	}, Exit: err}
+}
+
+// Hangs is a run that writes a message and then goes quiet until it's
+// killed, for idle and max-runtime timeouts.
+func Hangs() Script {
+	return Script{Steps: []Step{Message("Thinking...")}, Hang: true}
+}
@@ -0,0 +1,119 @@
+package agenttest
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/agent"
+	"github.com/bryantinsley/machinator/backend/internal/beads"
+)
+
+// worktree makes a worktree holding one open task, t-1.
+func worktree(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, ".beads"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, beads.JSONLPath), []byte(`{"id":"t-1","title":"Task","status":"open"}`+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func wait(t *testing.T, run agent.Run) error {
+	t.Helper()
+	select {
+	case err := <-run.Done():
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("run didn't end")
+		return nil
+	}
+}
+
+func TestRetryAfterFailureCompletes(t *testing.T) {
+	defer func(r agent.Runner) { agent.Gemini = r }(agent.Gemini)
+	fatal := errors.New("exit status 1")
+	r := &Runner{Script: func(opts agent.LaunchOptions, n int) Script {
+		if n == 0 {
+			return Fails(fatal)
+		}
+		return Completes("t-1", 1500)
+	}}
+	agent.Gemini = r
+
+	opts := agent.LaunchOptions{MachinatorDir: t.TempDir(), AgentID: 1, WorktreeDir: worktree(t)}
+	first, err := agent.Gemini.Launch(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wait(t, first); err != fatal {
+		t.Errorf("first run ended with %v, want %v", err, fatal)
+	}
+	second, err := agent.Gemini.Launch(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wait(t, second); err != nil {
+		t.Errorf("second run ended with %v", err)
+	}
+	if first.PID() == second.PID() {
+		t.Errorf("both runs have pid %d", first.PID())
+	}
+
+	tasks, err := beads.LoadTasks(opts.WorktreeDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tasks[0].Status != "closed" {
+		t.Errorf("t-1 is %s, want closed", tasks[0].Status)
+	}
+	// The log is the second run's alone
+	if got := agent.Tokens(opts.MachinatorDir, opts.AgentID); got != 1500 {
+		t.Errorf("Tokens = %d, want 1500", got)
+	}
+	if n := len(r.Launches()); n != 2 {
+		t.Errorf("%d launches, want 2", n)
+	}
+}
+
+func TestHangingRunEndsWhenKilled(t *testing.T) {
+	r := &Runner{Script: func(agent.LaunchOptions, int) Script { return Hangs() }}
+	opts := agent.LaunchOptions{MachinatorDir: t.TempDir(), AgentID: 2}
+
+	run, err := r.Launch(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-run.Done():
+		t.Fatalf("hanging run ended by itself: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	run.Kill()
+	if err := wait(t, run); err != ErrKilled {
+		t.Errorf("killed run ended with %v, want %v", err, ErrKilled)
+	}
+	if lines := agent.TailLog(opts.MachinatorDir, opts.AgentID, 10); len(lines) != 1 {
+		t.Errorf("log = %q, want its one message", lines)
+	}
+
+	// Also killed when its context is done, between steps
+	ctx, cancel := context.WithCancel(context.Background())
+	slow := &Runner{Script: func(agent.LaunchOptions, int) Script {
+		return Script{Steps: []Step{{After: time.Hour, Event: map[string]any{"type": "message"}}}}
+	}}
+	run, err = slow.Launch(ctx, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if err := wait(t, run); err != ErrKilled {
+		t.Errorf("cancelled run ended with %v, want %v", err, ErrKilled)
+	}
+}
@@ -0,0 +1,304 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/beads"
+	"github.com/bryantinsley/machinator/backend/internal/config"
+	"github.com/bryantinsley/machinator/backend/internal/events"
+	"github.com/bryantinsley/machinator/backend/internal/project"
+	"github.com/bryantinsley/machinator/backend/internal/quota"
+	"github.com/bryantinsley/machinator/backend/internal/state"
+	"github.com/bryantinsley/machinator/backend/internal/tracker"
+)
+
+// Server serves the HTTP control API (see planning/api.md).
+type Server struct {
+	state   *state.State
+	quota   *quota.Quota
+	repoDir string
+	cfg     *config.Config
+	projCfg *project.Config
+	metrics *events.Counter // Set by SetMetrics
+
+	issueMu sync.Mutex // Serializes adding tasks for GitHub issues
+
+	auth *authenticator
+	mux  *http.ServeMux
+}
+
+// New creates an API server. Returns an error if the token config is invalid.
+func New(st *state.State, q *quota.Quota, repoDir string, cfg *config.Config, projCfg *project.Config) (*Server, error) {
+	auth, err := newAuthenticator(cfg.API.Tokens)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		state:   st,
+		quota:   q,
+		repoDir: repoDir,
+		cfg:     cfg,
+		projCfg: projCfg,
+		auth:    auth,
+		mux:     http.NewServeMux(),
+	}
+	s.routes()
+	return s, nil
+}
+
+// SetMetrics has GET /metrics report the events counted by c.
+func (s *Server) SetMetrics(c *events.Counter) {
+	s.metrics = c
+}
+
+// Open reports whether the API is running without authentication.
+func (s *Server) Open() bool {
+	return s.auth.open()
+}
+
+// Handler returns the HTTP handler for the API.
+func (s *Server) Handler() http.Handler {
+	return s.mux
+}
+
+// CheckListen returns an error if the API mustn't be served on addr: with
+// no tokens configured every caller is admin, so only loopback addresses
+// are allowed.
+func (s *Server) CheckListen(addr string) error {
+	if !s.auth.open() {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("api.listen %q: %w", addr, err)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("api.listen %q: no API tokens configured, so the API would make every caller admin; listen on localhost or add api.tokens", addr)
+	}
+	return nil
+}
+
+// ListenAndServe serves the API on addr until it fails. It refuses an
+// address CheckListen rejects.
+func (s *Server) ListenAndServe(addr string) error {
+	if err := s.CheckListen(addr); err != nil {
+		return err
+	}
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           s.mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return srv.ListenAndServe()
+}
+
+// ServeUnix serves the API on a unix socket. The socket is created with
+// owner-only permissions and callers on it are trusted as admin.
+func (s *Server) ServeUnix(path string) error {
+	// Remove a stale socket left by a previous run
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return fmt.Errorf("daemon already listening on %s", path)
+	}
+	os.Remove(path)
+
+	l, err := listenPrivate(path)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+
+	srv := &http.Server{
+		Handler:           s.mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			return context.WithValue(ctx, trustedKey{}, true)
+		},
+	}
+	return srv.Serve(l)
+}
+
+// listenPrivate listens on a unix socket at path that nobody else can ever
+// connect to. It is bound in a new 0700 directory beside path, made 0600
+// there, and only then moved into place, since it's created with the
+// umask's permissions.
+func listenPrivate(path string) (net.Listener, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".sock-")
+	if err != nil {
+		return nil, fmt.Errorf("listen %s: %w", path, err)
+	}
+	defer os.RemoveAll(dir)
+
+	bound := filepath.Join(dir, "s")
+	l, err := net.Listen("unix", bound)
+	if err != nil {
+		return nil, fmt.Errorf("listen %s: %w", path, err)
+	}
+	// Closing would unlink the bound name, which won't exist; ServeUnix
+	// removes the socket instead
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := os.Chmod(bound, 0600); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("chmod socket: %w", err)
+	}
+	if err := os.Rename(bound, path); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("listen %s: %w", path, err)
+	}
+	return l, nil
+}
+
+func (s *Server) routes() {
+	viewer := func(pattern string, h http.HandlerFunc) {
+		s.mux.HandleFunc(pattern, s.auth.require(RoleViewer, h))
+	}
+	admin := func(pattern string, h http.HandlerFunc) {
+		s.mux.HandleFunc(pattern, s.auth.require(RoleAdmin, h))
+	}
+
+	// Read-only
+	viewer("GET /api/agents", s.handleListAgents)
+	viewer("GET /api/tasks", s.handleListTasks)
+	viewer("GET /api/quota", s.handleGetQuota)
+	viewer("GET /api/config", s.handleGetConfig)
+	viewer("GET /api/project", s.handleGetProject)
+	viewer("GET /api/logs", s.handleLogs)
+	viewer("GET /metrics", s.handleMetrics)
+
+	// Control
+	admin("POST /api/pause-assignment", s.handleSetAssignmentPaused(true))
+	admin("POST /api/resume-assignment", s.handleSetAssignmentPaused(false))
+	admin("POST /api/pause-launches", s.handleSetLaunchesPaused(true))
+	admin("POST /api/resume-launches", s.handleSetLaunchesPaused(false))
+	admin("POST /api/agents", s.handleAddAgent)
+	admin("POST /api/quota/refresh", s.handleRefreshQuota)
+	admin("POST /api/tasks/{id}/bar", s.handleBarTask)
+	admin("DELETE /api/tasks/{id}/bar", s.handleUnbarTask)
+	admin("POST /api/trigger", s.handleTrigger)
+
+	// Signed by GitHub rather than carrying a token
+	if s.cfg.API.WebhookSecret != "" {
+		s.mux.HandleFunc("POST /webhooks/github", s.handleGitHubWebhook)
+	}
+}
+
+func (s *Server) handleListAgents(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.state.AgentsSnapshot())
+}
+
+// taskResponse is a task with orchestrator-derived fields.
+type taskResponse struct {
+	*beads.Task
+	IsComplex bool   `json:"is_complex"`
+	Barred    bool   `json:"barred"`
+	BarReason string `json:"bar_reason,omitempty"`
+}
+
+func (s *Server) handleListTasks(w http.ResponseWriter, r *http.Request) {
+	tasks, err := tracker.LoadTasks(s.projCfg, s.repoDir)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("load tasks: %v", err))
+		return
+	}
+
+	resp := make([]taskResponse, 0, len(tasks))
+	for _, t := range tasks {
+		resp = append(resp, taskResponse{
+			Task:      t,
+			IsComplex: t.IsComplex,
+			Barred:    s.state.IsTaskBarred(t.ID),
+			BarReason: s.state.BarReason(t.ID),
+		})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleGetQuota(w http.ResponseWriter, r *http.Request) {
+	type account struct {
+		Name   string             `json:"name"`
+		Models map[string]float64 `json:"models"`
+		quota.Pins
+	}
+	resp := struct {
+		UpdatedAt time.Time `json:"updated_at"`
+		Accounts  []account `json:"accounts"`
+	}{
+		UpdatedAt: s.quota.UpdatedAt,
+		Accounts:  []account{},
+	}
+	for _, acc := range s.quota.Accounts {
+		resp.Accounts = append(resp.Accounts, account{Name: acc.Name, Models: acc.Models, Pins: acc.Pins})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleGetConfig(w http.ResponseWriter, r *http.Request) {
+	timeouts := s.cfg.LiveTimeouts()
+	writeJSON(w, http.StatusOK, map[string]any{
+		"agents_count":      len(s.state.AgentsSnapshot()),
+		"idle_timeout":      timeouts.Idle.Duration().String(),
+		"max_runtime":       timeouts.MaxRuntime.Duration().String(),
+		"assignment_paused": s.state.AssignmentIsPaused(),
+		"launches_paused":   s.state.LaunchesArePaused(),
+	})
+}
+
+func (s *Server) handleGetProject(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.projCfg)
+}
+
+func (s *Server) handleSetAssignmentPaused(paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.state.SetPaused(paused)
+		writeJSON(w, http.StatusOK, map[string]bool{"assignment_paused": paused})
+	}
+}
+
+func (s *Server) handleSetLaunchesPaused(paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.state.SetLaunchesPaused(paused)
+		writeJSON(w, http.StatusOK, map[string]bool{"launches_paused": paused})
+	}
+}
+
+func (s *Server) handleAddAgent(w http.ResponseWriter, r *http.Request) {
+	agent := s.state.AddAgent()
+	writeJSON(w, http.StatusCreated, map[string]any{"id": agent.ID, "state": agent.State})
+}
+
+func (s *Server) handleRefreshQuota(w http.ResponseWriter, r *http.Request) {
+	if err := s.quota.Refresh(r.Context()); err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("refresh quota: %v", err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleBarTask(w http.ResponseWriter, r *http.Request) {
+	s.state.BarTaskAndSave(r.PathValue("id"), r.URL.Query().Get("reason"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleUnbarTask(w http.ResponseWriter, r *http.Request) {
+	s.state.UnbarTask(r.PathValue("id"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
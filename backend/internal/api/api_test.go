@@ -0,0 +1,61 @@
+package api
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListenPrivate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "machinator.sock")
+	l, err := listenPrivate(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSocket == 0 || info.Mode().Perm() != 0600 {
+		t.Errorf("socket mode = %v, want a 0600 socket", info.Mode())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("left behind in the socket's directory: %v", entries)
+	}
+
+	go func() {
+		if c, err := l.Accept(); err == nil {
+			c.Close()
+		}
+	}()
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("dial the moved socket: %v", err)
+	}
+	conn.Close()
+}
+
+func TestCheckListen(t *testing.T) {
+	open := &Server{auth: &authenticator{}}
+	for addr, ok := range map[string]bool{
+		"127.0.0.1:8420": true,
+		"[::1]:8420":     true,
+		"localhost:8420": true,
+		"0.0.0.0:8420":   false,
+		":8420":          false,
+		"10.0.0.5:8420":  false,
+		"dash.lan:8420":  false,
+	} {
+		if err := open.CheckListen(addr); (err == nil) != ok {
+			t.Errorf("no tokens, CheckListen(%q) = %v, want ok %v", addr, err, ok)
+		}
+	}
+	authed := &Server{auth: &authenticator{tokens: []tokenRole{{token: []byte("t"), role: RoleViewer}}}}
+	if err := authed.CheckListen("0.0.0.0:8420"); err != nil {
+		t.Errorf("with tokens, CheckListen(0.0.0.0) = %v", err)
+	}
+}
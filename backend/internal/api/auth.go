@@ -0,0 +1,120 @@
+package api
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/bryantinsley/machinator/backend/internal/config"
+)
+
+// Role is the access level granted to an API token.
+type Role int
+
+const (
+	RoleNone   Role = iota // Unknown or missing token
+	RoleViewer             // Read-only access
+	RoleAdmin              // Read and control access
+)
+
+// String returns the config name of the role.
+func (r Role) String() string {
+	switch r {
+	case RoleViewer:
+		return "viewer"
+	case RoleAdmin:
+		return "admin"
+	default:
+		return "none"
+	}
+}
+
+// ParseRole converts a config role name to a Role.
+func ParseRole(name string) (Role, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "viewer":
+		return RoleViewer, nil
+	case "admin":
+		return RoleAdmin, nil
+	default:
+		return RoleNone, fmt.Errorf("unknown role %q (want \"admin\" or \"viewer\")", name)
+	}
+}
+
+// tokenRole pairs a bearer token with its role.
+type tokenRole struct {
+	token []byte
+	role  Role
+}
+
+// authenticator resolves bearer tokens to roles.
+type authenticator struct {
+	tokens []tokenRole
+}
+
+// newAuthenticator builds an authenticator from config, rejecting bad entries.
+func newAuthenticator(tokens []config.APIToken) (*authenticator, error) {
+	a := &authenticator{}
+	for i, t := range tokens {
+		if t.Token == "" {
+			return nil, fmt.Errorf("api.tokens[%d]: empty token", i)
+		}
+		role, err := ParseRole(t.Role)
+		if err != nil {
+			return nil, fmt.Errorf("api.tokens[%d]: %w", i, err)
+		}
+		a.tokens = append(a.tokens, tokenRole{token: []byte(t.Token), role: role})
+	}
+	return a, nil
+}
+
+// open reports whether no tokens are configured (auth disabled).
+func (a *authenticator) open() bool {
+	return len(a.tokens) == 0
+}
+
+// trustedKey marks requests arriving on the owner-only unix socket.
+type trustedKey struct{}
+
+// roleFor returns the role for the request's bearer token.
+func (a *authenticator) roleFor(r *http.Request) Role {
+	if a.open() {
+		return RoleAdmin
+	}
+	if trusted, _ := r.Context().Value(trustedKey{}).(bool); trusted {
+		return RoleAdmin
+	}
+
+	header := r.Header.Get("Authorization")
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok || token == "" {
+		return RoleNone
+	}
+
+	// Check every token so timing doesn't reveal which one matched
+	role := RoleNone
+	for _, t := range a.tokens {
+		if subtle.ConstantTimeCompare(t.token, []byte(token)) == 1 && t.role > role {
+			role = t.role
+		}
+	}
+	return role
+}
+
+// require wraps a handler so it only runs for callers with at least the given role.
+func (a *authenticator) require(min Role, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		role := a.roleFor(r)
+		if role == RoleNone {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="machinator"`)
+			writeError(w, http.StatusUnauthorized, "missing or invalid token")
+			return
+		}
+		if role < min {
+			writeError(w, http.StatusForbidden, fmt.Sprintf("%s role required", min))
+			return
+		}
+		h(w, r)
+	}
+}
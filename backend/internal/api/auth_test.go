@@ -0,0 +1,56 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bryantinsley/machinator/backend/internal/config"
+)
+
+func TestRequireEnforcesRoles(t *testing.T) {
+	auth, err := newAuthenticator([]config.APIToken{
+		{Token: "admin-token", Role: "admin"},
+		{Token: "viewer-token", Role: "viewer"},
+	})
+	if err != nil {
+		t.Fatalf("newAuthenticator: %v", err)
+	}
+
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+
+	tests := []struct {
+		name  string
+		min   Role
+		token string
+		want  int
+	}{
+		{"viewer reads", RoleViewer, "viewer-token", http.StatusOK},
+		{"admin reads", RoleViewer, "admin-token", http.StatusOK},
+		{"viewer controls", RoleAdmin, "viewer-token", http.StatusForbidden},
+		{"admin controls", RoleAdmin, "admin-token", http.StatusOK},
+		{"no token", RoleViewer, "", http.StatusUnauthorized},
+		{"bad token", RoleViewer, "nope", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/agents", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			auth.require(tt.min, ok)(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewAuthenticatorRejectsUnknownRole(t *testing.T) {
+	_, err := newAuthenticator([]config.APIToken{{Token: "x", Role: "superuser"}})
+	if err == nil {
+		t.Fatal("expected error for unknown role")
+	}
+}
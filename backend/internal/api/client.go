@@ -0,0 +1,119 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// SocketPath returns the daemon's unix socket path.
+func SocketPath(machinatorDir string) string {
+	return filepath.Join(machinatorDir, "machinator.sock")
+}
+
+// Client talks to a daemon over its unix socket, or to an API served
+// over TCP.
+type Client struct {
+	http  *http.Client
+	base  string
+	token string // Bearer token; the socket needs none
+}
+
+// NewClient creates a client for the daemon socket at path.
+func NewClient(path string) *Client {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	}
+	return &Client{http: &http.Client{Transport: transport}, base: "http://machinator"}
+}
+
+// NewHTTPClient creates a client for the API served at addr, a host:port
+// or URL, sending token if it isn't empty.
+func NewHTTPClient(addr, token string) *Client {
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	return &Client{http: &http.Client{}, base: strings.TrimSuffix(addr, "/"), token: token}
+}
+
+// do sends a request without a body.
+func (c *Client) do(method, path string) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.base+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return c.http.Do(req)
+}
+
+// Get fetches an API path and decodes the JSON response into v.
+func (c *Client) Get(path string, v any) error {
+	resp, err := c.do(http.MethodGet, path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return decodeResponse(resp, v)
+}
+
+// Post calls an API path and decodes the JSON response (if any) into v.
+func (c *Client) Post(path string, v any) error {
+	resp, err := c.do(http.MethodPost, path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return decodeResponse(resp, v)
+}
+
+// Delete calls an API path with DELETE and decodes the JSON response (if
+// any) into v.
+func (c *Client) Delete(path string, v any) error {
+	resp, err := c.do(http.MethodDelete, path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return decodeResponse(resp, v)
+}
+
+// Stream copies a streaming response (e.g. /api/logs?follow=true) to w.
+func (c *Client) Stream(path string, w io.Writer) error {
+	resp, err := c.do(http.MethodGet, path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return decodeResponse(resp, nil)
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+func decodeResponse(resp *http.Response, v any) error {
+	if resp.StatusCode >= 300 {
+		var e struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&e)
+		if e.Error == "" {
+			e.Error = resp.Status
+		}
+		return fmt.Errorf("%s", e.Error)
+	}
+	if v == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// handleLogs streams a log file from $MACHINATOR_DIR/logs.
+// Query: source=<name> (default "main"), follow=true to keep streaming.
+func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
+	source := r.URL.Query().Get("source")
+	if source == "" {
+		source = "main"
+	}
+	if strings.ContainsAny(source, `/\`) || strings.HasPrefix(source, ".") {
+		writeError(w, http.StatusBadRequest, "invalid log source")
+		return
+	}
+
+	path := filepath.Join(s.cfg.MachinatorDir, "logs", source+".log")
+	f, err := os.Open(path)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "no log for "+source)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if _, err := io.Copy(w, f); err != nil {
+		return
+	}
+	if r.URL.Query().Get("follow") != "true" {
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if flusher != nil {
+			flusher.Flush()
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := io.Copy(w, f); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/bryantinsley/machinator/backend/internal/events"
+)
+
+// handleMetrics reports counts in the Prometheus text format: events by
+// type, and agents by state.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	fmt.Fprintln(w, "# HELP machinator_events_total Orchestrator events since start, by type.")
+	fmt.Fprintln(w, "# TYPE machinator_events_total counter")
+	if s.metrics != nil {
+		counts := s.metrics.Counts()
+		types := make([]events.Type, 0, len(counts))
+		for t := range counts {
+			types = append(types, t)
+		}
+		slices.Sort(types)
+		for _, t := range types {
+			fmt.Fprintf(w, "machinator_events_total{type=%q} %d\n", t, counts[t])
+		}
+	}
+
+	states := make(map[string]int)
+	for _, a := range s.state.AgentsSnapshot() {
+		states[a.State]++
+	}
+	fmt.Fprintln(w, "# HELP machinator_agents Agents, by state.")
+	fmt.Fprintln(w, "# TYPE machinator_agents gauge")
+	for _, st := range []string{"pending", "ready", "assigned"} {
+		fmt.Fprintf(w, "machinator_agents{state=%q} %d\n", st, states[st])
+	}
+}
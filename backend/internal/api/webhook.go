@@ -0,0 +1,161 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/bryantinsley/machinator/backend/internal/beads"
+	"github.com/bryantinsley/machinator/backend/internal/tracker"
+)
+
+// ReadyLabel is the GitHub issue label that makes an issue a task.
+const ReadyLabel = "agent-ready"
+
+// maxWebhookBody caps a webhook delivery; GitHub's are at most 25MB, but
+// the events handled here are far smaller.
+const maxWebhookBody = 1 << 20
+
+// handleTrigger has the assigner look for new tasks now: the project's
+// tasks are refreshed (beads pulled, tracker cache dropped) and the
+// assigner woken.
+func (s *Server) handleTrigger(w http.ResponseWriter, r *http.Request) {
+	if err := s.trigger(); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]bool{"woken": true})
+}
+
+// trigger refreshes the project's tasks and wakes the assigner.
+func (s *Server) trigger() error {
+	if err := tracker.Refresh(s.projCfg, s.repoDir); err != nil {
+		return fmt.Errorf("refresh tasks: %w", err)
+	}
+	s.state.Wake()
+	return nil
+}
+
+// githubEvent holds the parts of push and issues deliveries used here.
+type githubEvent struct {
+	Ref    string `json:"ref"` // push
+	Action string `json:"action"`
+	Label  struct {
+		Name string `json:"name"`
+	} `json:"label"`
+	Issue struct {
+		Number  int    `json:"number"`
+		Title   string `json:"title"`
+		Body    string `json:"body"`
+		HTMLURL string `json:"html_url"`
+	} `json:"issue"`
+}
+
+// handleGitHubWebhook takes GitHub webhook deliveries signed with
+// api.webhook_secret. A push to the project's branch triggers the
+// assigner; an issue labeled ReadyLabel is added as a task first.
+// Other events are acknowledged and ignored.
+func (s *Server) handleGitHubWebhook(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("read body: %v", err))
+		return
+	}
+	if !validSignature(s.cfg.API.WebhookSecret, body, r.Header.Get("X-Hub-Signature-256")) {
+		writeError(w, http.StatusUnauthorized, "bad or missing X-Hub-Signature-256")
+		return
+	}
+	var e githubEvent
+	if err := json.Unmarshal(body, &e); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("decode event: %v", err))
+		return
+	}
+
+	switch event := r.Header.Get("X-GitHub-Event"); {
+	case event == "push" && e.Ref == "refs/heads/"+s.projCfg.Branch:
+		if err := s.trigger(); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusAccepted, map[string]bool{"woken": true})
+	case event == "issues" && e.Action == "labeled" && e.Label.Name == ReadyLabel:
+		id, err := s.addIssueTask(e)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		s.state.Wake()
+		writeJSON(w, http.StatusAccepted, map[string]any{"woken": true, "task_id": id})
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// addIssueTask adds a GitHub issue as a task, unless a task already links
+// to it. Returns the task's ID. Deliveries are handled one at a time, so a
+// redelivery can't add the issue twice.
+func (s *Server) addIssueTask(e githubEvent) (string, error) {
+	s.issueMu.Lock()
+	defer s.issueMu.Unlock()
+	if err := tracker.Refresh(s.projCfg, s.repoDir); err != nil {
+		return "", fmt.Errorf("refresh tasks: %w", err)
+	}
+	tasks, err := tracker.LoadTasks(s.projCfg, s.repoDir)
+	if err != nil {
+		return "", fmt.Errorf("load tasks: %w", err)
+	}
+	if id := issueTask(tasks, e); id != "" {
+		return id, nil
+	}
+	desc := strings.TrimSpace(e.Issue.Body + "\n\n" + issueLine(e))
+	id, err := tracker.Create(s.projCfg, s.repoDir, &beads.Task{Title: e.Issue.Title, Description: desc})
+	if err != nil {
+		return "", fmt.Errorf("add task for issue #%d: %w", e.Issue.Number, err)
+	}
+	return id, nil
+}
+
+// issueLine is the line of a task's description that links it to the
+// issue it was added for.
+func issueLine(e githubEvent) string {
+	return fmt.Sprintf("From GitHub issue #%d: %s", e.Issue.Number, e.Issue.HTMLURL)
+}
+
+// issueTask returns the ID of the task added for the event's issue, or ""
+// if there's none. The whole link line must match: issue 1's URL is a
+// prefix of issue 12's.
+func issueTask(tasks []*beads.Task, e githubEvent) string {
+	if e.Issue.HTMLURL == "" {
+		return ""
+	}
+	want := issueLine(e)
+	for _, t := range tasks {
+		for _, line := range strings.Split(t.Description, "\n") {
+			if strings.TrimSpace(line) == want {
+				return t.ID
+			}
+		}
+	}
+	return ""
+}
+
+// validSignature checks a delivery's X-Hub-Signature-256 header against
+// the HMAC-SHA256 of its body with secret.
+func validSignature(secret string, body []byte, header string) bool {
+	sig, ok := strings.CutPrefix(header, "sha256=")
+	if !ok || secret == "" {
+		return false
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bryantinsley/machinator/backend/internal/beads"
+	"github.com/bryantinsley/machinator/backend/internal/config"
+	"github.com/bryantinsley/machinator/backend/internal/project"
+)
+
+func sign(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestValidSignature(t *testing.T) {
+	body := `{"zen":"Keep it logically awesome."}`
+	tests := []struct {
+		name   string
+		secret string
+		header string
+		want   bool
+	}{
+		{"good", "s3cret", sign("s3cret", body), true},
+		{"other secret", "s3cret", sign("other", body), false},
+		{"missing", "s3cret", "", false},
+		{"sha1", "s3cret", "sha1=" + strings.TrimPrefix(sign("s3cret", body), "sha256="), false},
+		{"not hex", "s3cret", "sha256=zz", false},
+		{"no secret", "", sign("", body), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validSignature(tt.secret, []byte(body), tt.header); got != tt.want {
+				t.Errorf("validSignature = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGitHubWebhookIgnoresOtherEvents(t *testing.T) {
+	s := &Server{
+		cfg:     &config.Config{API: config.APIConfig{WebhookSecret: "s3cret"}},
+		projCfg: &project.Config{Branch: "main"},
+	}
+	tests := []struct {
+		name      string
+		event     string
+		body      string
+		signature string
+		want      int
+	}{
+		{"unsigned", "push", `{"ref":"refs/heads/main"}`, "", http.StatusUnauthorized},
+		{"ping", "ping", `{"zen":"Design for failure."}`, "s3cret", http.StatusNoContent},
+		{"push to another branch", "push", `{"ref":"refs/heads/feature"}`, "s3cret", http.StatusNoContent},
+		{"other label", "issues", `{"action":"labeled","label":{"name":"bug"}}`, "s3cret", http.StatusNoContent},
+		{"unlabeled", "issues", `{"action":"unlabeled","label":{"name":"agent-ready"}}`, "s3cret", http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/webhooks/github", strings.NewReader(tt.body))
+			req.Header.Set("X-GitHub-Event", tt.event)
+			if tt.signature != "" {
+				req.Header.Set("X-Hub-Signature-256", sign(tt.signature, tt.body))
+			}
+			rec := httptest.NewRecorder()
+			s.handleGitHubWebhook(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestIssueTaskMatchesWholeLink(t *testing.T) {
+	issue := func(n int) githubEvent {
+		var e githubEvent
+		e.Issue.Number = n
+		e.Issue.HTMLURL = fmt.Sprintf("https://github.com/o/r/issues/%d", n)
+		return e
+	}
+	tasks := []*beads.Task{
+		{ID: "t-12", Description: "Body\n\n" + issueLine(issue(12))},
+		{ID: "t-100", Description: issueLine(issue(100)) + "\n"},
+	}
+	for n, want := range map[int]string{12: "t-12", 100: "t-100", 1: "", 10: "", 120: ""} {
+		if got := issueTask(tasks, issue(n)); got != want {
+			t.Errorf("issue #%d: task %q, want %q", n, got, want)
+		}
+	}
+}
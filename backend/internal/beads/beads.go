@@ -4,9 +4,15 @@ import (
 	"bufio"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -71,7 +77,29 @@ type Task struct {
 	Comments  []Comment `json:"comments,omitempty"`
 
 	// Derived fields (not in JSON)
-	IsComplex bool // Derived from CHALLENGE tag in description
+	IsComplex bool `json:"-"` // Derived from CHALLENGE tag in description
+	Urgency   int  `json:"-"` // Priority, or the PRIORITY tag in description; lower is more urgent
+}
+
+// priorityTag overrides a task's priority from its description, e.g.
+// "PRIORITY:0" or "PRIORITY:P1".
+var priorityTag = regexp.MustCompile(`PRIORITY:\s*[Pp]?(\d+)`)
+
+// Derive fills in the fields derived from a task's description. Tasks that
+// don't come from LoadTasks must be passed through it.
+func Derive(t *Task) {
+	t.IsComplex = strings.Contains(t.Description, "CHALLENGE:complex")
+	t.Urgency = urgency(t)
+}
+
+// urgency returns the task's priority, overridden by a PRIORITY tag.
+func urgency(t *Task) int {
+	if m := priorityTag.FindStringSubmatch(t.Description); m != nil {
+		if p, err := strconv.Atoi(m[1]); err == nil {
+			return p
+		}
+	}
+	return t.Priority
 }
 
 // Comment represents a comment on an issue.
@@ -82,7 +110,21 @@ type Comment struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
-// LoadTasks loads tasks from the beads JSONL file.
+// loadedFile is an issues.jsonl as LoadTasks last parsed it.
+type loadedFile struct {
+	info  os.FileInfo
+	tasks []*Task
+}
+
+var (
+	loadedMu sync.Mutex
+	loaded   = make(map[string]loadedFile) // By path
+)
+
+// LoadTasks loads tasks from the beads JSONL file. The file is only parsed
+// again once it has changed: it is replaced (as bd and git do), or its size
+// or modification time differ. Each call returns its own copies of the
+// tasks, so callers may change them.
 func LoadTasks(repoDir string) ([]*Task, error) {
 	jsonlPath := filepath.Join(repoDir, ".beads", "issues.jsonl")
 
@@ -91,9 +133,47 @@ func LoadTasks(repoDir string) ([]*Task, error) {
 		return nil, fmt.Errorf("open issues.jsonl: %w", err)
 	}
 	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("stat issues.jsonl: %w", err)
+	}
+
+	loadedMu.Lock()
+	prev, ok := loaded[jsonlPath]
+	loadedMu.Unlock()
+	if ok && os.SameFile(prev.info, info) && prev.info.Size() == info.Size() && prev.info.ModTime().Equal(info.ModTime()) {
+		return copyTasks(prev.tasks), nil
+	}
 
+	tasks, err := ReadTasks(file)
+	if err != nil {
+		return nil, err
+	}
+	loadedMu.Lock()
+	loaded[jsonlPath] = loadedFile{info: info, tasks: tasks}
+	loadedMu.Unlock()
+	return copyTasks(tasks), nil
+}
+
+// copyTasks copies tasks and their lists, leaving the originals as they
+// are whatever is done to the copies.
+func copyTasks(tasks []*Task) []*Task {
+	out := make([]*Task, len(tasks))
+	for i, t := range tasks {
+		c := *t
+		c.Labels = slices.Clone(t.Labels)
+		c.BlockedBy = slices.Clone(t.BlockedBy)
+		c.Comments = slices.Clone(t.Comments)
+		out[i] = &c
+	}
+	return out
+}
+
+// ReadTasks reads tasks in the beads JSONL format, e.g. issues.jsonl as
+// another branch has it.
+func ReadTasks(r io.Reader) ([]*Task, error) {
 	var tasks []*Task
-	scanner := bufio.NewScanner(file)
+	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
 		line := scanner.Text()
 		if strings.TrimSpace(line) == "" {
@@ -105,8 +185,7 @@ func LoadTasks(repoDir string) ([]*Task, error) {
 			continue // Skip malformed lines
 		}
 
-		// Derive complexity from description
-		task.IsComplex = strings.Contains(task.Description, "CHALLENGE:complex")
+		Derive(&task)
 
 		tasks = append(tasks, &task)
 	}
@@ -118,7 +197,8 @@ func LoadTasks(repoDir string) ([]*Task, error) {
 	return tasks, nil
 }
 
-// ReadyTasks returns tasks that are ready for assignment.
+// ReadyTasks returns tasks that are ready for assignment, most urgent
+// first and oldest first within the same urgency.
 func ReadyTasks(tasks []*Task) []*Task {
 	var ready []*Task
 
@@ -149,5 +229,11 @@ func ReadyTasks(tasks []*Task) []*Task {
 		}
 	}
 
+	sort.SliceStable(ready, func(i, j int) bool {
+		if ready[i].Urgency != ready[j].Urgency {
+			return ready[i].Urgency < ready[j].Urgency
+		}
+		return ready[i].CreatedAt.Before(ready[j].CreatedAt)
+	})
 	return ready
 }
@@ -0,0 +1,85 @@
+package beads
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadyTasksOrderByUrgencyThenAge(t *testing.T) {
+	repo := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(repo, ".beads"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	lines := `{"id":"t-1","status":"open","priority":2,"created_at":"2025-01-01T00:00:00Z"}
+{"id":"t-2","status":"open","priority":1,"created_at":"2025-01-03T00:00:00Z"}
+{"id":"t-3","status":"open","priority":1,"created_at":"2025-01-02T00:00:00Z"}
+{"id":"t-4","status":"open","priority":3,"description":"Hotfix. PRIORITY:P0","created_at":"2025-01-04T00:00:00Z"}
+{"id":"t-5","status":"closed","priority":0,"created_at":"2025-01-01T00:00:00Z"}
+`
+	if err := os.WriteFile(filepath.Join(repo, ".beads", "issues.jsonl"), []byte(lines), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tasks, err := LoadTasks(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ready := ReadyTasks(tasks)
+
+	want := []string{"t-4", "t-3", "t-2", "t-1"}
+	if len(ready) != len(want) {
+		t.Fatalf("got %d ready tasks, want %d", len(ready), len(want))
+	}
+	for i, id := range want {
+		if ready[i].ID != id {
+			t.Errorf("ready[%d] = %s, want %s", i, ready[i].ID, id)
+		}
+	}
+	if ready[0].Urgency != 0 || ready[0].Priority != 3 {
+		t.Errorf("t-4 urgency/priority = %d/%d, want 0/3", ready[0].Urgency, ready[0].Priority)
+	}
+}
+
+func TestLoadTasksReparsesOnlyChangedFiles(t *testing.T) {
+	repo := t.TempDir()
+	dir := filepath.Join(repo, ".beads")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "issues.jsonl")
+	if err := os.WriteFile(path, []byte(`{"id":"t-1","title":"First","status":"open","blocked_by":["t-0"]}`+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tasks, err := LoadTasks(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Changes to what's returned don't reach the cache
+	tasks[0].Status = "closed"
+	tasks[0].BlockedBy[0] = "t-9"
+	again, err := LoadTasks(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again[0].Status != "open" || again[0].BlockedBy[0] != "t-0" {
+		t.Errorf("cached task = %s blocked by %v, want open blocked by [t-0]", again[0].Status, again[0].BlockedBy)
+	}
+
+	// Replaced by renaming, as bd does
+	tmp := filepath.Join(dir, "issues.jsonl.tmp")
+	if err := os.WriteFile(tmp, []byte(`{"id":"t-1","title":"Other","status":"open"}`+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+	again, err = LoadTasks(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again[0].Title != "Other" {
+		t.Errorf("title after the file changed = %q, want Other", again[0].Title)
+	}
+}
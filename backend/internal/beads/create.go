@@ -0,0 +1,108 @@
+package beads
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Complexity tags route a task to the simple or complex model (see Derive).
+const (
+	SimpleTag  = "CHALLENGE:simple"
+	ComplexTag = "CHALLENGE:complex"
+)
+
+// Tagged reports whether a task's complexity has been decided: it has a
+// CHALLENGE tag, or its tracker marked it complex.
+func Tagged(t *Task) bool {
+	return t.IsComplex || strings.Contains(t.Description, "CHALLENGE:")
+}
+
+// WithTag returns a description with tag added at the end, unless it is
+// already there.
+func WithTag(description, tag string) string {
+	if strings.Contains(description, tag) {
+		return description
+	}
+	return strings.TrimSpace(description + "\n\n" + tag)
+}
+
+// DescribeComplex returns a task's description, tagged for the complex model
+// if the task is complex.
+func DescribeComplex(t *Task) string {
+	if !t.IsComplex {
+		return t.Description
+	}
+	return WithTag(t.Description, ComplexTag)
+}
+
+// Create adds a task with bd (or Native) in a clone on branch and pushes it. Only the
+// title, description, complexity and BlockedBy are used. Returns the new
+// task's ID.
+func Create(repoDir, branch string, t *Task) (string, error) {
+	if err := Pull(repoDir, branch); err != nil {
+		return "", err
+	}
+
+	args := []string{"--no-daemon", "create", t.Title,
+		"--description", DescribeComplex(t),
+		"--type", "task",
+		"--json"}
+	if len(t.BlockedBy) > 0 {
+		args = append(args, "--deps", strings.Join(t.BlockedBy, ","))
+	}
+	out, err := runBd(repoDir, args...)
+	if err != nil {
+		return "", fmt.Errorf("bd create: %w", err)
+	}
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(out, &created); err != nil || created.ID == "" {
+		return "", fmt.Errorf("bd create: unexpected output %q", strings.TrimSpace(string(out)))
+	}
+
+	if _, err := SyncFile(repoDir, branch, JSONLPath, "Add "+created.ID+": "+t.Title); err != nil {
+		return created.ID, fmt.Errorf("created %s but couldn't push it: %w", created.ID, err)
+	}
+	return created.ID, nil
+}
+
+// SetDescription replaces a task's description with bd in a clone on branch
+// and pushes the change.
+func SetDescription(repoDir, branch, taskID, description string) error {
+	if err := Pull(repoDir, branch); err != nil {
+		return err
+	}
+	if _, err := runBd(repoDir, "--no-daemon", "update", taskID, "--description", description); err != nil {
+		return fmt.Errorf("bd update: %w", err)
+	}
+	_, err := SyncFile(repoDir, branch, JSONLPath, "Update "+taskID)
+	return err
+}
+
+// Reopen reopens a closed task with bd in a clone on branch and pushes the
+// change.
+func Reopen(repoDir, branch, taskID string) error {
+	if err := Pull(repoDir, branch); err != nil {
+		return err
+	}
+	if _, err := runBd(repoDir, "--no-daemon", "update", taskID, "--status", "open"); err != nil {
+		return fmt.Errorf("bd update: %w", err)
+	}
+	_, err := SyncFile(repoDir, branch, JSONLPath, "Reopen "+taskID)
+	return err
+}
+
+// Close closes a task with bd in a clone on branch, giving reason, and
+// pushes the change.
+func Close(repoDir, branch, taskID, reason string) error {
+	if err := Pull(repoDir, branch); err != nil {
+		return err
+	}
+	if _, err := runBd(repoDir, "--no-daemon", "close", taskID, "--reason", reason); err != nil {
+		return fmt.Errorf("bd close: %w", err)
+	}
+	_, err := SyncFile(repoDir, branch, JSONLPath, "Close "+taskID)
+	return err
+}
@@ -0,0 +1,143 @@
+package beads
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Dependents maps each task ID to the tasks that list it in BlockedBy.
+func Dependents(tasks []*Task) map[string][]*Task {
+	deps := make(map[string][]*Task)
+	for _, t := range tasks {
+		for _, blocker := range t.BlockedBy {
+			deps[blocker] = append(deps[blocker], t)
+		}
+	}
+	return deps
+}
+
+// Downstream counts, for each task, the unclosed tasks that wait on it
+// directly or through other tasks. Closing a task with a high count frees
+// the most work.
+func Downstream(tasks []*Task) map[string]int {
+	deps := Dependents(tasks)
+	counts := make(map[string]int, len(tasks))
+	for _, t := range tasks {
+		seen := map[string]bool{t.ID: true} // Cycles don't count the task itself
+		var walk func(id string)
+		walk = func(id string) {
+			for _, d := range deps[id] {
+				if seen[d.ID] {
+					continue
+				}
+				seen[d.ID] = true
+				if d.Status != "closed" {
+					counts[t.ID]++
+				}
+				walk(d.ID)
+			}
+		}
+		walk(t.ID)
+	}
+	return counts
+}
+
+// Bottlenecks returns unclosed tasks that other work waits on, the most
+// downstream work first.
+func Bottlenecks(tasks []*Task) []*Task {
+	counts := Downstream(tasks)
+	var out []*Task
+	for _, t := range tasks {
+		if t.Status != "closed" && counts[t.ID] > 0 {
+			out = append(out, t)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return counts[out[i].ID] > counts[out[j].ID]
+	})
+	return out
+}
+
+// GraphStatus is a task's state in the dependency graph: "closed",
+// "in_progress", "blocked" (waiting on an unclosed task) or "ready".
+func GraphStatus(t *Task, closed map[string]bool) string {
+	switch t.Status {
+	case "closed", "in_progress":
+		return t.Status
+	}
+	for _, blocker := range t.BlockedBy {
+		if !closed[blocker] {
+			return "blocked"
+		}
+	}
+	return "ready"
+}
+
+// ClosedIDs returns the set of closed task IDs.
+func ClosedIDs(tasks []*Task) map[string]bool {
+	closed := make(map[string]bool)
+	for _, t := range tasks {
+		if t.Status == "closed" {
+			closed[t.ID] = true
+		}
+	}
+	return closed
+}
+
+// dotColors fills graph nodes by GraphStatus.
+var dotColors = map[string]string{
+	"closed":      "gray85",
+	"in_progress": "lightblue",
+	"blocked":     "khaki",
+	"ready":       "palegreen",
+}
+
+// Dot renders the dependency graph in Graphviz format. Edges point from a
+// blocker to the task waiting on it; tasks holding up other work are drawn
+// with a heavier border and their downstream count.
+func Dot(tasks []*Task) string {
+	closed := ClosedIDs(tasks)
+	counts := Downstream(tasks)
+
+	var sb strings.Builder
+	sb.WriteString("digraph beads {\n")
+	sb.WriteString("  rankdir=LR;\n")
+	sb.WriteString("  node [shape=box, style=filled, fontname=\"Helvetica\"];\n")
+	for _, t := range tasks {
+		status := GraphStatus(t, closed)
+		label := t.ID + "\\n" + dotEscape(clipTitle(t.Title, 40))
+		attrs := fmt.Sprintf("fillcolor=%s", dotColors[status])
+		if n := counts[t.ID]; n > 0 && status != "closed" {
+			label += fmt.Sprintf("\\nunblocks %d", n)
+			attrs += fmt.Sprintf(", penwidth=%d", min(1+n, 5))
+		}
+		fmt.Fprintf(&sb, "  %q [label=\"%s\", %s];\n", t.ID, label, attrs)
+	}
+	known := make(map[string]bool, len(tasks))
+	for _, t := range tasks {
+		known[t.ID] = true
+	}
+	for _, t := range tasks {
+		for _, blocker := range t.BlockedBy {
+			if known[blocker] {
+				fmt.Fprintf(&sb, "  %q -> %q;\n", blocker, t.ID)
+			}
+		}
+	}
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// dotEscape escapes s for a quoted DOT string.
+func dotEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
+// clipTitle cuts s to at most n characters.
+func clipTitle(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-1]) + "…"
+	}
+	return s
+}
@@ -0,0 +1,96 @@
+package beads
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDownstreamCountsTransitiveOpenWork(t *testing.T) {
+	tasks := []*Task{
+		{ID: "a", Status: "open"},
+		{ID: "b", Status: "open", BlockedBy: []string{"a"}},
+		{ID: "c", Status: "open", BlockedBy: []string{"b"}},
+		{ID: "d", Status: "closed", BlockedBy: []string{"a"}},
+		{ID: "e", Status: "open", BlockedBy: []string{"a", "b"}},
+		// A cycle must not loop or count the task itself
+		{ID: "x", Status: "open", BlockedBy: []string{"y"}},
+		{ID: "y", Status: "open", BlockedBy: []string{"x"}},
+	}
+
+	counts := Downstream(tasks)
+	want := map[string]int{"a": 3, "b": 2, "c": 0, "d": 0, "e": 0, "x": 1, "y": 1}
+	for id, n := range want {
+		if counts[id] != n {
+			t.Errorf("Downstream[%s] = %d, want %d", id, counts[id], n)
+		}
+	}
+
+	if got := Bottlenecks(tasks); len(got) == 0 || got[0].ID != "a" {
+		t.Errorf("Bottlenecks()[0] = %v, want a first", got)
+	}
+}
+
+func TestDotMarksStatusAndEdges(t *testing.T) {
+	tasks := []*Task{
+		{ID: "a", Title: `Say "hi"`, Status: "closed"},
+		{ID: "b", Status: "open", BlockedBy: []string{"a"}},
+		{ID: "c", Status: "open", BlockedBy: []string{"b", "gone"}},
+	}
+	dot := Dot(tasks)
+
+	for _, want := range []string{
+		`"a" [label="a\nSay \"hi\"", fillcolor=gray85]`,
+		`"b" [label="b\n\nunblocks 1", fillcolor=palegreen, penwidth=2]`,
+		`fillcolor=khaki`,
+		`"a" -> "b";`,
+		`"b" -> "c";`,
+	} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("Dot() missing %s\n%s", want, dot)
+		}
+	}
+	if strings.Contains(dot, `"gone"`) {
+		t.Errorf("Dot() drew an edge from an unknown task:\n%s", dot)
+	}
+}
+
+func TestDiagnoseFindsWhyNothingIsReady(t *testing.T) {
+	tasks := []*Task{
+		{ID: "x", Status: "open", BlockedBy: []string{"y"}},
+		{ID: "y", Status: "open", BlockedBy: []string{"x"}},
+		{ID: "z", Status: "open", BlockedBy: []string{"x"}},
+		{ID: "ghost", Status: "open", BlockedBy: []string{"gone"}},
+		{ID: "done", Status: "closed"},
+		{ID: "stuck", Status: "blocked", BlockedBy: []string{"done"}},
+		{ID: "left", Status: "in_progress"},
+		{ID: "busy", Status: "in_progress"},
+		{ID: "after", Status: "open", BlockedBy: []string{"busy", "left", "stuck"}},
+	}
+	if !Stalled(tasks) {
+		t.Fatal("Stalled() = false with no ready task")
+	}
+
+	byKind := make(map[string]Problem)
+	for _, p := range Diagnose(tasks, map[string]bool{"busy": true}) {
+		byKind[p.Kind] = p
+	}
+	if p := byKind[ProblemCycle]; len(p.TaskIDs) != 2 || p.Holds != 2 || p.Fix != "bd dep remove y x" {
+		t.Errorf("cycle = %+v", p)
+	}
+	if p := byKind[ProblemMissing]; p.Fix != "bd dep remove ghost gone" {
+		t.Errorf("missing = %+v", p)
+	}
+	if p := byKind[ProblemStatus]; p.TaskIDs[0] != "stuck" || p.Fix != "bd update stuck --status=open" {
+		t.Errorf("status = %+v", p)
+	}
+	if p := byKind[ProblemStranded]; p.TaskIDs[0] != "left" {
+		t.Errorf("stranded = %+v", p)
+	}
+	if p := byKind[ProblemWaiting]; p.TaskIDs[0] != "busy" || p.Fix != "" {
+		t.Errorf("waiting = %+v", p)
+	}
+
+	if Stalled([]*Task{{ID: "a", Status: "closed"}}) {
+		t.Error("Stalled() = true with every task closed")
+	}
+}
@@ -0,0 +1,332 @@
+package beads
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/tools"
+)
+
+// NativeCommand is the hidden machinator command that runs Native, for a
+// bd wrapper script where bd isn't installed.
+const NativeCommand = "native-bd"
+
+// boolFlags are the bd flags that take no value.
+var boolFlags = map[string]bool{"json": true, "no-daemon": true, "sandbox": true}
+
+// parseArgs splits bd arguments into positional arguments and flags
+// ("--name value" or "--name=value").
+func parseArgs(args []string) ([]string, map[string]string) {
+	var positional []string
+	flags := make(map[string]string)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "--") {
+			positional = append(positional, arg)
+			continue
+		}
+		name, value, ok := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+		if !ok && !boolFlags[name] && i+1 < len(args) {
+			i++
+			value = args[i]
+		}
+		flags[name] = value
+	}
+	return positional, flags
+}
+
+// Native runs bd's commands with args against the issues.jsonl in dir or
+// above, and returns the exit code. It reads and writes the file directly,
+// with no database or daemon: create, update, close, ready, list and show,
+// enough for agents and the orchestrator.
+func Native(dir string, args []string, stdout, stderr io.Writer) int {
+	positional, flags := parseArgs(args)
+	if _, ok := flags["version"]; ok || len(positional) > 0 && positional[0] == "version" {
+		// What it supports, agents' --sandbox included, is what MinBd has
+		fmt.Fprintf(stdout, "bd version %s (machinator native)\n", tools.MinBd)
+		return 0
+	}
+	if len(positional) == 0 {
+		fmt.Fprintln(stderr, "bd: no command")
+		return 1
+	}
+	if err := native(dir, positional[0], positional[1:], flags, stdout); err != nil {
+		fmt.Fprintf(stderr, "bd: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func native(dir, command string, args []string, flags map[string]string, stdout io.Writer) error {
+	_, asJSON := flags["json"]
+	switch command {
+	case "sync", "init":
+		return nil
+	case "ready", "list", "show":
+		path, err := issuesPath(dir)
+		if err != nil {
+			return err
+		}
+		tasks, err := LoadTasks(filepath.Dir(filepath.Dir(path)))
+		if err != nil {
+			return err
+		}
+		var shown []*Task
+		switch command {
+		case "ready":
+			shown = ReadyTasks(tasks)
+		case "list":
+			shown = tasks
+		case "show":
+			for _, t := range tasks {
+				if len(args) > 0 && t.ID == args[0] {
+					shown = append(shown, t)
+				}
+			}
+			if len(shown) == 0 {
+				return fmt.Errorf("show: no issue %q", strings.Join(args, " "))
+			}
+		}
+		if asJSON {
+			return json.NewEncoder(stdout).Encode(shown)
+		}
+		for _, t := range shown {
+			fmt.Fprintf(stdout, "%s [P%d] [%s] %s\n", t.ID, t.Priority, t.Status, t.Title)
+		}
+		return nil
+	}
+
+	path, err := issuesPath(dir)
+	if err != nil {
+		return err
+	}
+	// Held from reading to writing, so concurrent changes aren't lost
+	unlock, err := lockDir(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	issues, err := readIssues(path)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+
+	switch command {
+	case "create":
+		if len(args) == 0 {
+			return fmt.Errorf("create: no title")
+		}
+		id := nextID(issues)
+		issue := map[string]any{
+			"id":          id,
+			"title":       strings.Join(args, " "),
+			"description": flags["description"],
+			"status":      "open",
+			"priority":    2,
+			"issue_type":  "task",
+			"created_at":  now,
+			"updated_at":  now,
+		}
+		if p, err := strconv.Atoi(strings.TrimPrefix(flags["priority"], "P")); err == nil {
+			issue["priority"] = p
+		}
+		if t := flags["type"]; t != "" {
+			issue["issue_type"] = t
+		}
+		if deps := flags["deps"]; deps != "" {
+			issue["blocked_by"] = strings.Split(deps, ",")
+		}
+		issues = append(issues, issue)
+		if err := writeIssues(path, issues); err != nil {
+			return err
+		}
+		if asJSON {
+			return json.NewEncoder(stdout).Encode(map[string]string{"id": id})
+		}
+		fmt.Fprintf(stdout, "Created issue: %s\n", id)
+		return nil
+
+	case "update", "close":
+		if len(args) == 0 {
+			return fmt.Errorf("%s: no issue ID", command)
+		}
+		for _, id := range args {
+			issue := findIssue(issues, id)
+			if issue == nil {
+				return fmt.Errorf("%s: no issue %q", command, id)
+			}
+			issue["updated_at"] = now
+			if command == "close" {
+				issue["status"] = "closed"
+				issue["closed_at"] = now
+				if reason := flags["reason"]; reason != "" {
+					issue["close_reason"] = reason
+				}
+				fmt.Fprintf(stdout, "Closed %s\n", id)
+				continue
+			}
+			for _, field := range []string{"status", "title", "description", "notes", "assignee"} {
+				if value, ok := flags[field]; ok {
+					issue[field] = value
+				}
+			}
+			if p, err := strconv.Atoi(strings.TrimPrefix(flags["priority"], "P")); err == nil {
+				issue["priority"] = p
+			}
+			fmt.Fprintf(stdout, "Updated %s\n", id)
+		}
+		return writeIssues(path, issues)
+	}
+	return fmt.Errorf("unsupported command %q", command)
+}
+
+// runBd runs bd with args in repoDir, or Native if bd isn't installed, and
+// returns what it printed.
+func runBd(repoDir string, args ...string) ([]byte, error) {
+	if !tools.Installed(tools.Bd) {
+		var stdout, stderr bytes.Buffer
+		if Native(repoDir, args, &stdout, &stderr) != 0 {
+			return nil, errors.New(strings.TrimSpace(stderr.String()))
+		}
+		return stdout.Bytes(), nil
+	}
+	cmd := tools.Command(tools.Bd, args...)
+	cmd.Dir = repoDir
+	out, err := cmd.Output()
+	if ee, ok := err.(*exec.ExitError); ok {
+		return out, fmt.Errorf("%w\nOutput: %s", err, strings.TrimSpace(string(ee.Stderr)))
+	}
+	return out, err
+}
+
+// issuesPath finds .beads/issues.jsonl in dir or above.
+func issuesPath(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		path := filepath.Join(dir, JSONLPath)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("no %s here or above", JSONLPath)
+		}
+		dir = parent
+	}
+}
+
+// lockDir takes an exclusive flock on a directory (.beads), waiting for
+// whoever holds it, and returns the function that releases it.
+func lockDir(dir string) (func(), error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, fmt.Errorf("lock %s: %w", dir, err)
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("lock %s: %w", dir, err)
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+// readIssues reads issues.jsonl as raw objects, so fields Task doesn't
+// have survive a rewrite.
+func readIssues(path string) ([]map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var issues []map[string]any
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 16<<20)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.UseNumber()
+		var issue map[string]any
+		if err := dec.Decode(&issue); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		issues = append(issues, issue)
+	}
+	return issues, scanner.Err()
+}
+
+// writeIssues writes issues back, one per line. The file is replaced by
+// renaming a temporary file of its own over it, as bd does, so readers
+// never see half of it. Call it with the directory locked (lockDir).
+func writeIssues(path string, issues []map[string]any) error {
+	var buf bytes.Buffer
+	for _, issue := range issues {
+		line, err := json.Marshal(issue)
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // Gone once renamed
+	_, err = tmp.Write(buf.Bytes())
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func findIssue(issues []map[string]any, id string) map[string]any {
+	for _, issue := range issues {
+		if issue["id"] == id {
+			return issue
+		}
+	}
+	return nil
+}
+
+// nextID numbers a new issue after the highest "<prefix>-N" there is. bd's
+// own hash IDs (e.g. "proj-8rn") give the prefix but no number.
+func nextID(issues []map[string]any) string {
+	prefix, highest := "bd", 0
+	for _, issue := range issues {
+		id, _ := issue["id"].(string)
+		i := strings.LastIndex(id, "-")
+		if i < 0 {
+			continue
+		}
+		prefix = id[:i]
+		if num, err := strconv.Atoi(id[i+1:]); err == nil && num > highest {
+			highest = num
+		}
+	}
+	return fmt.Sprintf("%s-%d", prefix, highest+1)
+}
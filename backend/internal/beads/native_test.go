@@ -0,0 +1,159 @@
+package beads
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bryantinsley/machinator/backend/internal/tools"
+)
+
+func TestNativeCreateUpdateClose(t *testing.T) {
+	repo := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(repo, ".beads"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	lines := `{"id":"demo-1","title":"One","status":"open","priority":1,"custom":{"kept":true}}
+{"id":"demo-2","title":"Two","status":"open","priority":2}
+{"id":"demo-7","title":"Seven","status":"open","priority":2}
+`
+	if err := os.WriteFile(filepath.Join(repo, JSONLPath), []byte(lines), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Run from a subdirectory, as agents may
+	sub := filepath.Join(repo, "src")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(args ...string) string {
+		t.Helper()
+		var stdout, stderr bytes.Buffer
+		if code := Native(sub, args, &stdout, &stderr); code != 0 {
+			t.Fatalf("bd %v: exit %d: %s", args, code, stderr.String())
+		}
+		return stdout.String()
+	}
+	if out := run("--no-daemon", "create", "Write docs", "--description", "All of them", "--deps", "demo-7", "--json"); !strings.Contains(out, `"id":"demo-8"`) {
+		t.Errorf("create printed %q", out)
+	}
+	run("--no-daemon", "close", "demo-1", "--reason", "done")
+	run("update", "demo-2", "--status=blocked")
+
+	tasks, err := LoadTasks(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byID := make(map[string]*Task)
+	for _, task := range tasks {
+		byID[task.ID] = task
+	}
+	if d := byID["demo-8"]; d == nil || d.Description != "All of them" || len(d.BlockedBy) != 1 || d.Status != "open" {
+		t.Errorf("created task = %+v", d)
+	}
+	if c := byID["demo-1"]; c.Status != "closed" || c.CloseReason != "done" || c.ClosedAt == nil {
+		t.Errorf("closed task = %+v", c)
+	}
+	if byID["demo-2"].Status != "blocked" {
+		t.Errorf("demo-2 status = %s", byID["demo-2"].Status)
+	}
+	if data, _ := os.ReadFile(filepath.Join(repo, JSONLPath)); !strings.Contains(string(data), `"custom":{"kept":true}`) {
+		t.Error("a field Task doesn't have was lost in the rewrite")
+	}
+	if out := run("ready"); !strings.Contains(out, "demo-7") || strings.Contains(out, "demo-8") {
+		t.Errorf("ready = %q, want demo-7 but not demo-8, which it blocks", out)
+	}
+
+	if code := Native(sub, []string{"close", "nope"}, &bytes.Buffer{}, &bytes.Buffer{}); code == 0 {
+		t.Error("closed a task that doesn't exist")
+	}
+}
+
+func TestNativeConcurrentCreates(t *testing.T) {
+	repo := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(repo, ".beads"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, JSONLPath), []byte(`{"id":"demo-1","title":"One","status":"open"}`+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 20
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var stderr bytes.Buffer
+			if code := Native(repo, []string{"create", fmt.Sprintf("Task %d", i)}, &bytes.Buffer{}, &stderr); code != 0 {
+				t.Errorf("create %d: %s", i, stderr.String())
+			}
+		}()
+	}
+	wg.Wait()
+
+	tasks, err := LoadTasks(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make(map[string]bool)
+	for _, task := range tasks {
+		ids[task.ID] = true
+	}
+	if len(tasks) != n+1 || len(ids) != n+1 {
+		t.Errorf("%d tasks with %d IDs after %d concurrent creates, want %d of each", len(tasks), len(ids), n, n+1)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(repo, ".beads")); len(entries) != 1 {
+		t.Errorf(".beads holds %d entries, want only issues.jsonl", len(entries))
+	}
+}
+
+func TestNextIDFollowsPrefix(t *testing.T) {
+	tests := []struct {
+		ids  []string
+		want string
+	}{
+		{nil, "bd-1"},
+		{[]string{"demo-2", "demo-10"}, "demo-11"},
+		{[]string{"my-app-3"}, "my-app-4"},
+		{[]string{"machinator-8rn"}, "machinator-1"},
+	}
+	for _, tt := range tests {
+		var issues []map[string]any
+		for _, id := range tt.ids {
+			issues = append(issues, map[string]any{"id": id})
+		}
+		if got := nextID(issues); got != tt.want {
+			t.Errorf("nextID(%v) = %s, want %s", tt.ids, got, tt.want)
+		}
+	}
+}
+
+func TestRunBdPrefersInstalledBd(t *testing.T) {
+	repo := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(repo, ".beads"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, JSONLPath), []byte(`{"id":"demo-1","title":"One","status":"open"}`+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func(bd tools.Tool) { tools.Bd = bd }(tools.Bd)
+
+	fake := filepath.Join(t.TempDir(), "bd")
+	if err := os.WriteFile(fake, []byte("#!/bin/sh\necho \"fake $*\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	tools.Bd = tools.At("bd", fake)
+	if out, err := runBd(repo, "close", "demo-1"); err != nil || strings.TrimSpace(string(out)) != "fake close demo-1" {
+		t.Errorf("with bd installed: %q, %v", out, err)
+	}
+
+	tools.Bd = tools.At("bd", filepath.Join(t.TempDir(), "bd"))
+	if out, err := runBd(repo, "close", "demo-1"); err != nil || !strings.Contains(string(out), "Closed demo-1") {
+		t.Errorf("without bd: %q, %v", out, err)
+	}
+}
@@ -0,0 +1,196 @@
+package beads
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Problem kinds found by Diagnose.
+const (
+	ProblemCycle    = "cycle"    // Tasks block each other in a loop
+	ProblemMissing  = "missing"  // Blocked by a task that doesn't exist
+	ProblemStatus   = "status"   // Not open even though all its blockers are closed
+	ProblemStranded = "stranded" // In progress, but no agent is working on it
+	ProblemWaiting  = "waiting"  // Waiting on work an agent is doing; not a fault
+)
+
+// Problem is one reason open work can't become ready.
+type Problem struct {
+	Kind    string
+	TaskIDs []string // The task at fault first; for a cycle, the loop in order
+	Detail  string
+	Fix     string // Suggested command, if any
+	Holds   int    // Unclosed tasks waiting on the problem
+}
+
+// Stalled reports whether unclosed tasks remain but none is ready.
+func Stalled(tasks []*Task) bool {
+	if len(ReadyTasks(tasks)) > 0 {
+		return false
+	}
+	for _, t := range tasks {
+		if t.Status != "closed" {
+			return true
+		}
+	}
+	return false
+}
+
+// Diagnose explains why no task is ready. working holds the IDs of tasks
+// agents are running. Faults come first, those holding up the most work
+// leading; tasks that are merely waiting on an agent come last.
+func Diagnose(tasks []*Task, working map[string]bool) []Problem {
+	byID := make(map[string]*Task, len(tasks))
+	for _, t := range tasks {
+		byID[t.ID] = t
+	}
+	closed := ClosedIDs(tasks)
+	counts := Downstream(tasks)
+
+	var problems []Problem
+	for _, cycle := range cycles(tasks, byID) {
+		// Breaking any edge frees the loop; suggest the one closing it
+		first, last := cycle[0], cycle[len(cycle)-1]
+		holds := 0
+		for _, id := range cycle {
+			holds = max(holds, counts[id])
+		}
+		problems = append(problems, Problem{
+			Kind:    ProblemCycle,
+			TaskIDs: cycle,
+			Detail:  "blocked on each other: " + strings.Join(cycle, " → ") + " → " + first,
+			Fix:     fmt.Sprintf("bd dep remove %s %s", first, last),
+			Holds:   holds,
+		})
+	}
+
+	var waiting []Problem
+	for _, t := range tasks {
+		if t.Status == "closed" {
+			continue
+		}
+		for _, blocker := range t.BlockedBy {
+			if _, ok := byID[blocker]; !ok {
+				problems = append(problems, Problem{
+					Kind:    ProblemMissing,
+					TaskIDs: []string{t.ID, blocker},
+					Detail:  fmt.Sprintf("%s is blocked by %s, which doesn't exist", t.ID, blocker),
+					Fix:     fmt.Sprintf("bd dep remove %s %s", t.ID, blocker),
+					Holds:   counts[t.ID] + 1,
+				})
+			}
+		}
+
+		switch {
+		case t.Status == "in_progress" && working[t.ID]:
+			if counts[t.ID] > 0 {
+				waiting = append(waiting, Problem{
+					Kind:    ProblemWaiting,
+					TaskIDs: []string{t.ID},
+					Detail:  fmt.Sprintf("%s is being worked on", t.ID),
+					Holds:   counts[t.ID],
+				})
+			}
+		case t.Status == "in_progress":
+			problems = append(problems, Problem{
+				Kind:    ProblemStranded,
+				TaskIDs: []string{t.ID},
+				Detail:  fmt.Sprintf("%s is in progress, but no agent is working on it", t.ID),
+				Fix:     fmt.Sprintf("bd update %s --status=open", t.ID),
+				Holds:   counts[t.ID],
+			})
+		case t.Status != "open" && allClosed(t.BlockedBy, closed):
+			detail := fmt.Sprintf("%s is %s, but nothing blocks it", t.ID, t.Status)
+			if len(t.BlockedBy) > 0 {
+				detail = fmt.Sprintf("%s is %s, but its blockers are all closed", t.ID, t.Status)
+			}
+			problems = append(problems, Problem{
+				Kind:    ProblemStatus,
+				TaskIDs: []string{t.ID},
+				Detail:  detail,
+				Fix:     fmt.Sprintf("bd update %s --status=open", t.ID),
+				Holds:   counts[t.ID],
+			})
+		}
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Holds > problems[j].Holds })
+	sort.SliceStable(waiting, func(i, j int) bool { return waiting[i].Holds > waiting[j].Holds })
+	return append(problems, waiting...)
+}
+
+// allClosed reports whether every ID is in closed.
+func allClosed(ids []string, closed map[string]bool) bool {
+	for _, id := range ids {
+		if !closed[id] {
+			return false
+		}
+	}
+	return true
+}
+
+// cycles returns each loop of BlockedBy edges among unclosed tasks once,
+// as task IDs in blocking order (each blocked by the one before it).
+func cycles(tasks []*Task, byID map[string]*Task) [][]string {
+	const (
+		unvisited = iota
+		onPath
+		done
+	)
+	mark := make(map[string]int)
+	var path []string
+	var found [][]string
+	inCycle := make(map[string]bool)
+
+	var visit func(t *Task)
+	visit = func(t *Task) {
+		mark[t.ID] = onPath
+		path = append(path, t.ID)
+		for _, id := range t.BlockedBy {
+			b := byID[id]
+			if b == nil || b.Status == "closed" {
+				continue
+			}
+			switch mark[id] {
+			case unvisited:
+				visit(b)
+			case onPath:
+				// path from id to t is a loop; report it in blocking order
+				start := len(path) - 1
+				for path[start] != id {
+					start--
+				}
+				loop := append([]string(nil), path[start:]...)
+				if anyIn(loop, inCycle) {
+					continue // Shares tasks with a reported loop; fix that one first
+				}
+				for i, j := 0, len(loop)-1; i < j; i, j = i+1, j-1 {
+					loop[i], loop[j] = loop[j], loop[i]
+				}
+				for _, l := range loop {
+					inCycle[l] = true
+				}
+				found = append(found, loop)
+			}
+		}
+		path = path[:len(path)-1]
+		mark[t.ID] = done
+	}
+
+	for _, t := range tasks {
+		if t.Status != "closed" && mark[t.ID] == unvisited {
+			visit(t)
+		}
+	}
+	return found
+}
+
+func anyIn(ids []string, set map[string]bool) bool {
+	for _, id := range ids {
+		if set[id] {
+			return true
+		}
+	}
+	return false
+}
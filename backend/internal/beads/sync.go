@@ -0,0 +1,85 @@
+package beads
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bryantinsley/machinator/backend/internal/tools"
+)
+
+// JSONLPath is the task file, relative to the repo root. It is the only
+// beads file that belongs in git; the database next to it is a local cache.
+const JSONLPath = ".beads/issues.jsonl"
+
+// DBPatterns match the beads database files (git glob patterns). They must
+// never be committed.
+var DBPatterns = []string{".beads/*.db", ".beads/*.db-*"}
+
+// SyncWorktree commits and pushes task changes an agent left uncommitted in
+// its worktree (closing, blocking or creating tasks), so they aren't lost
+// when the worktree is reset. Only issues.jsonl is committed. Returns
+// whether anything was pushed.
+func SyncWorktree(worktreeDir, branch, message string) (bool, error) {
+	return SyncFile(worktreeDir, branch, JSONLPath, message)
+}
+
+// SyncFile commits one file's changes in a worktree and pushes them to
+// branch, rebasing once if the push is rejected. Returns whether anything
+// was pushed.
+func SyncFile(worktreeDir, branch, path, message string) (bool, error) {
+	git := func(args ...string) (string, error) {
+		out, err := tools.Command(tools.Git, append([]string{"-C", worktreeDir}, args...)...).CombinedOutput()
+		if err != nil {
+			return string(out), fmt.Errorf("git %s: %w\nOutput: %s", args[0], err, strings.TrimSpace(string(out)))
+		}
+		return string(out), nil
+	}
+
+	status, err := git("status", "--porcelain", "--", path)
+	if err != nil {
+		return false, err
+	}
+	if strings.TrimSpace(status) == "" {
+		return false, nil
+	}
+
+	if _, err := git("add", "--", path); err != nil {
+		return false, err
+	}
+	// Commit just the file, whatever else is staged
+	if _, err := git("-c", "user.name=Machinator", "-c", "user.email=machinator@machinator.local",
+		"commit", "-q", "-m", message, "--", path); err != nil {
+		return false, err
+	}
+
+	// Retry once on top of whatever was pushed meanwhile
+	if _, err := git("push", "-q", "origin", "HEAD:"+branch); err == nil {
+		return true, nil
+	}
+	if _, err := git("fetch", "-q", "origin"); err != nil {
+		return false, err
+	}
+	if _, err := git("rebase", "-q", "origin/"+branch); err != nil {
+		git("rebase", "--abort")
+		return false, err
+	}
+	if _, err := git("push", "-q", "origin", "HEAD:"+branch); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Pull fast-forwards a clone to the remote branch before tasks are added to
+// it, so they're written on top of what agents have pushed.
+func Pull(repoDir, branch string) error {
+	for _, args := range [][]string{
+		{"fetch", "-q", "origin"},
+		{"merge", "-q", "--ff-only", "origin/" + branch},
+	} {
+		out, err := tools.Command(tools.Git, append([]string{"-C", repoDir}, args...)...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("git %s: %w\nOutput: %s", args[0], err, strings.TrimSpace(string(out)))
+		}
+	}
+	return nil
+}
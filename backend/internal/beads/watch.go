@@ -0,0 +1,70 @@
+package beads
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchSettle is how long a watcher waits after a change for more before
+// reporting it: bd rewrites its files in several steps.
+const watchSettle = 100 * time.Millisecond
+
+// Watcher reports changes to a repo's .beads JSONL files.
+type Watcher struct {
+	w    *fsnotify.Watcher
+	done chan struct{}
+}
+
+// Watch calls changed whenever a .beads/*.jsonl file in repoDir is written,
+// created, renamed or removed, once per burst of changes. The directory is
+// watched rather than the files, since bd replaces them by renaming.
+func Watch(repoDir string, changed func()) (*Watcher, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("create watcher: %w", err)
+	}
+	if err := w.Add(filepath.Join(repoDir, ".beads")); err != nil {
+		w.Close()
+		return nil, fmt.Errorf("watch .beads: %w", err)
+	}
+	bw := &Watcher{w: w, done: make(chan struct{})}
+	go bw.run(changed)
+	return bw, nil
+}
+
+func (bw *Watcher) run(changed func()) {
+	defer close(bw.done)
+	settle := time.NewTimer(0)
+	<-settle.C
+	for {
+		select {
+		case e, ok := <-bw.w.Events:
+			if !ok {
+				settle.Stop()
+				return
+			}
+			if filepath.Ext(e.Name) == ".jsonl" && e.Op&^fsnotify.Chmod != 0 {
+				settle.Reset(watchSettle)
+			}
+		case _, ok := <-bw.w.Errors:
+			if !ok {
+				settle.Stop()
+				return
+			}
+			// Dropped events (queue overflow); a change may have been missed
+			settle.Reset(watchSettle)
+		case <-settle.C:
+			changed()
+		}
+	}
+}
+
+// Close stops watching and waits for a running changed call to return.
+func (bw *Watcher) Close() error {
+	err := bw.w.Close()
+	<-bw.done
+	return err
+}
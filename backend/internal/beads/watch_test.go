@@ -0,0 +1,59 @@
+package beads
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchReportsJSONLChanges(t *testing.T) {
+	repoDir := t.TempDir()
+	dir := filepath.Join(repoDir, ".beads")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	changed := make(chan struct{}, 10)
+	w, err := Watch(repoDir, func() { changed <- struct{}{} })
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	defer w.Close()
+
+	// Not a JSONL file: ignored
+	if err := os.WriteFile(filepath.Join(dir, "beads.db"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changed:
+		t.Fatal("changed called for beads.db")
+	case <-time.After(3 * watchSettle):
+	}
+
+	// Written the way bd does, through a rename, in several steps
+	tmp := filepath.Join(dir, "issues.jsonl.tmp")
+	for i := 0; i < 3; i++ {
+		if err := os.WriteFile(tmp, []byte(`{"id":"t-1","title":"Task","status":"open"}`+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, filepath.Join(dir, "issues.jsonl")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case <-changed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("changed not called after issues.jsonl was replaced")
+	}
+	select {
+	case <-changed:
+		t.Fatal("changed called more than once for one burst")
+	case <-time.After(3 * watchSettle):
+	}
+}
+
+func TestWatchNeedsBeadsDir(t *testing.T) {
+	if _, err := Watch(t.TempDir(), func() {}); err == nil {
+		t.Fatal("expected an error without a .beads directory")
+	}
+}
@@ -0,0 +1,187 @@
+// Package chaos injects faults into a running orchestrator to check that it
+// recovers: agent processes are killed at random, task loading and agents'
+// events are delayed, quota responses corrupted, agent exits lost and
+// events dropped. It only runs against dummy tools.
+package chaos
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config sets fault rates. Rates are probabilities per check.
+type Config struct {
+	Seed          int64         // 0 means use the run seed
+	KillRate      float64       // Per agent-watch tick
+	DelayMax      time.Duration // Upper bound on task-load delay
+	DropRate      float64       // Per emitted event
+	EventDelayMax time.Duration // Upper bound on delay reading an agent's new events
+	QuotaRate     float64       // Per quota fetch, output truncated
+	LoseRate      float64       // Per agent exit, not reported until killed
+}
+
+// ParseConfig parses a MACHINATOR_CHAOS value like
+// "kill=0.01,delay=2s,drop=0.1,events=1s,quota=0.2,lose=0.05,seed=42".
+// Missing keys leave that fault off.
+func ParseConfig(s string) (Config, error) {
+	var cfg Config
+	for _, part := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return cfg, fmt.Errorf("chaos: expected key=value, got %q", part)
+		}
+		var err error
+		switch key {
+		case "kill":
+			cfg.KillRate, err = parseRate(value)
+		case "drop":
+			cfg.DropRate, err = parseRate(value)
+		case "delay":
+			cfg.DelayMax, err = time.ParseDuration(value)
+		case "events":
+			cfg.EventDelayMax, err = time.ParseDuration(value)
+		case "quota":
+			cfg.QuotaRate, err = parseRate(value)
+		case "lose":
+			cfg.LoseRate, err = parseRate(value)
+		case "seed":
+			cfg.Seed, err = strconv.ParseInt(value, 10, 64)
+		default:
+			err = fmt.Errorf("unknown key")
+		}
+		if err != nil {
+			return cfg, fmt.Errorf("chaos: %s: %v", key, err)
+		}
+	}
+	return cfg, nil
+}
+
+func parseRate(s string) (float64, error) {
+	r, err := strconv.ParseFloat(s, 64)
+	if err != nil || r < 0 || r > 1 {
+		return 0, fmt.Errorf("rate must be between 0 and 1")
+	}
+	return r, nil
+}
+
+var (
+	mu     sync.Mutex
+	active *Config
+	rng    *rand.Rand
+)
+
+// EnableFromEnv turns chaos on if MACHINATOR_CHAOS is set. Refuses unless
+// MACHINATOR_DUMMY_TOOLS=1 says gemini and bd are test doubles. Faults are
+// drawn from runSeed unless the spec sets its own seed.
+func EnableFromEnv(runSeed int64) (bool, error) {
+	spec := os.Getenv("MACHINATOR_CHAOS")
+	if spec == "" {
+		return false, nil
+	}
+	if os.Getenv("MACHINATOR_DUMMY_TOOLS") != "1" {
+		return false, fmt.Errorf("MACHINATOR_CHAOS requires MACHINATOR_DUMMY_TOOLS=1 (never run chaos against real agents)")
+	}
+	cfg, err := ParseConfig(spec)
+	if err != nil {
+		return false, err
+	}
+	if cfg.Seed == 0 {
+		cfg.Seed = runSeed
+	}
+	Enable(cfg)
+	return true, nil
+}
+
+// Enable turns on fault injection.
+func Enable(cfg Config) {
+	mu.Lock()
+	defer mu.Unlock()
+	active = &cfg
+	rng = rand.New(rand.NewSource(cfg.Seed))
+}
+
+// Disable turns off fault injection.
+func Disable() {
+	mu.Lock()
+	defer mu.Unlock()
+	active = nil
+}
+
+// Enabled reports whether chaos is on.
+func Enabled() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return active != nil
+}
+
+// roll returns true with probability p.
+func roll(p float64) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return active != nil && p > 0 && rng.Float64() < p
+}
+
+// rate returns one of the active config's rates, or 0 when chaos is off.
+func rate(which func(*Config) float64) float64 {
+	mu.Lock()
+	defer mu.Unlock()
+	if active == nil {
+		return 0
+	}
+	return which(active)
+}
+
+// KillAgent reports whether an agent process should be killed now.
+func KillAgent() bool {
+	return roll(rate(func(c *Config) float64 { return c.KillRate }))
+}
+
+// DropEvent reports whether an event should be dropped.
+func DropEvent() bool {
+	return roll(rate(func(c *Config) float64 { return c.DropRate }))
+}
+
+// LoseExit reports whether an agent's exit should be kept from the
+// orchestrator, which then has to notice it some other way (a timeout).
+func LoseExit() bool {
+	return roll(rate(func(c *Config) float64 { return c.LoseRate }))
+}
+
+// CorruptQuota returns quota output cut short at a random point, at the
+// configured rate, and otherwise out unchanged.
+func CorruptQuota(out []byte) []byte {
+	if !roll(rate(func(c *Config) float64 { return c.QuotaRate })) {
+		return out
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	return out[:rng.Intn(len(out)+1)]
+}
+
+// Delay sleeps for a random time up to the configured maximum.
+func Delay() {
+	sleepUpTo(func(c *Config) time.Duration { return c.DelayMax })
+}
+
+// DelayEvents sleeps for a random time up to the configured maximum before
+// an agent's new events are read.
+func DelayEvents() {
+	sleepUpTo(func(c *Config) time.Duration { return c.EventDelayMax })
+}
+
+// sleepUpTo sleeps for a random time up to one of the active config's
+// maximums.
+func sleepUpTo(which func(*Config) time.Duration) {
+	mu.Lock()
+	var d time.Duration
+	if active != nil && which(active) > 0 {
+		d = time.Duration(rng.Int63n(int64(which(active))))
+	}
+	mu.Unlock()
+	time.Sleep(d)
+}
@@ -0,0 +1,92 @@
+package chaos
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/rundb"
+	"github.com/bryantinsley/machinator/backend/internal/state"
+)
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := ParseConfig("kill=0.05, delay=2s,drop=0.5,events=1s,quota=0.2,lose=0.1,seed=7")
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	want := Config{Seed: 7, KillRate: 0.05, DelayMax: 2 * time.Second, DropRate: 0.5, EventDelayMax: time.Second, QuotaRate: 0.2, LoseRate: 0.1}
+	if cfg != want {
+		t.Errorf("cfg = %+v, want %+v", cfg, want)
+	}
+
+	for _, bad := range []string{"kill=2", "delay=soon", "explode=1", "kill", "lose=-1", "events=1"} {
+		if _, err := ParseConfig(bad); err == nil {
+			t.Errorf("ParseConfig(%q) accepted", bad)
+		}
+	}
+}
+
+func TestEnableFromEnvRequiresDummyTools(t *testing.T) {
+	t.Setenv("MACHINATOR_CHAOS", "kill=0.1")
+	t.Setenv("MACHINATOR_DUMMY_TOOLS", "")
+	if _, err := EnableFromEnv(1); err == nil {
+		t.Fatal("chaos enabled without dummy tools")
+	}
+	if Enabled() {
+		t.Fatal("Enabled() after refusal")
+	}
+}
+
+func TestCorruptQuota(t *testing.T) {
+	defer Disable()
+	out := []byte(`{"buckets": [{"modelId": "m", "remainingFraction": 0.5}]}`)
+
+	Enable(Config{Seed: 1})
+	if got := CorruptQuota(out); string(got) != string(out) {
+		t.Errorf("corrupted with quota rate 0: %s", got)
+	}
+	Enable(Config{Seed: 1, QuotaRate: 1})
+	for i := 0; i < 20; i++ {
+		if got := CorruptQuota(out); !strings.HasPrefix(string(out), string(got)) {
+			t.Fatalf("CorruptQuota = %s, want a prefix of the output", got)
+		}
+	}
+	Disable()
+	if LoseExit() || string(CorruptQuota(out)) != string(out) {
+		t.Error("faults injected while disabled")
+	}
+}
+
+func TestCheckFindsViolations(t *testing.T) {
+	st, err := state.Load(t.TempDir())
+	if err != nil {
+		t.Fatalf("state.Load: %v", err)
+	}
+	defer st.Close()
+	db := st.DB()
+
+	a1, a2 := st.AddAgent(), st.AddAgent()
+	st.AssignTask(a1.ID, "t-1", "")
+	st.AssignTask(a2.ID, "t-1", "")
+	db.StartRun("t-1", a1.ID, "m", "acc")
+	db.StartRun("t-1", a2.ID, "m", "acc")
+
+	// Agent 2 moved on without closing its run
+	st.CompleteTask(a2.ID)
+
+	for i := 0; i < 2; i++ {
+		id, _ := db.StartRun("t-2", a1.ID, "m", "acc")
+		db.FinishRun(id, rundb.OutcomeCompleted, "", 0)
+	}
+
+	violations, err := Check(st, db)
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	got := strings.Join(violations, "\n")
+	for _, want := range []string{"lost task: run 2 of t-1", "double claim: t-1", "double close: t-2 completed 2 times"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("violations missing %q:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package chaos
+
+import (
+	"fmt"
+
+	"github.com/bryantinsley/machinator/backend/internal/rundb"
+	"github.com/bryantinsley/machinator/backend/internal/state"
+)
+
+// Check verifies the invariants chaos must not break and returns a
+// description of each violation:
+//   - a task is never run by two agents at once
+//   - a task is never completed twice
+//   - every open run belongs to an agent still assigned that task
+func Check(st *state.State, db *rundb.DB) ([]string, error) {
+	var violations []string
+
+	open, err := db.OpenRuns()
+	if err != nil {
+		return nil, err
+	}
+	owners := make(map[string][]int)
+	for _, r := range open {
+		owners[r.TaskID] = append(owners[r.TaskID], r.AgentID)
+
+		a := st.GetAgent(r.AgentID)
+		if a == nil || a.State != "assigned" || a.TaskID != r.TaskID {
+			violations = append(violations, fmt.Sprintf("lost task: run %d of %s is open but agent %d no longer owns it", r.ID, r.TaskID, r.AgentID))
+		}
+	}
+	for task, agents := range owners {
+		if len(agents) > 1 {
+			violations = append(violations, fmt.Sprintf("double claim: %s is running on agents %v", task, agents))
+		}
+	}
+
+	completed, err := db.CompletedRuns()
+	if err != nil {
+		return nil, err
+	}
+	closes := make(map[string]int)
+	for _, r := range completed {
+		closes[r.TaskID]++
+	}
+	for task, n := range closes {
+		if n > 1 {
+			violations = append(violations, fmt.Sprintf("double close: %s completed %d times", task, n))
+		}
+	}
+
+	return violations, nil
+}
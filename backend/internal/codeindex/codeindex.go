@@ -0,0 +1,320 @@
+// Package codeindex finds the code most relevant to a task, so directives
+// can show it up front. A repo's tracked files are split into chunks and
+// each chunk is embedded as a hashed bag of the words in its identifiers
+// (no model or network needed). The index is kept locally and updated
+// incrementally using git's blob hashes. A task's text is embedded the same
+// way and chunks are ranked by TF-IDF cosine similarity.
+package codeindex
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/bryantinsley/machinator/backend/internal/tools"
+)
+
+const (
+	// Budget caps the code included in a directive, in bytes.
+	Budget = 8000
+
+	// maxSnippets is the most chunks included in a directive.
+	maxSnippets = 5
+
+	dims        = 1 << 16 // Hash buckets words are embedded into
+	chunkLines  = 60      // Lines per chunk
+	maxFileSize = 256 << 10
+)
+
+// Chunk is an embedded range of lines of one file.
+type Chunk struct {
+	Path  string
+	Start int // First line, from 1
+	End   int // Last line
+	Terms map[uint32]float32
+}
+
+// Index is the embedded chunks of a repo.
+type Index struct {
+	Blobs  map[string]string // Indexed path -> git blob hash
+	Chunks []Chunk
+}
+
+// Match is a chunk found by Search.
+type Match struct {
+	Chunk
+	Score float64 // Cosine similarity, 0 to 1
+}
+
+// Path returns a project's index file.
+func Path(projectDir string) string {
+	return filepath.Join(projectDir, "codeindex.gob")
+}
+
+// mu serializes updates, which agents starting together would race on.
+var mu sync.Mutex
+
+// Update brings the index at path up to date with the files tracked in
+// dir, a clone or worktree, embedding only files that changed since the
+// last update. Returns the index and how many files were (re)embedded.
+func Update(path, dir string) (*Index, int, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	ix, err := Load(path)
+	if err != nil {
+		ix = &Index{} // Unreadable (e.g. an older format): rebuild it
+	}
+	blobs, err := trackedFiles(dir)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var chunks []Chunk
+	for _, c := range ix.Chunks {
+		if blobs[c.Path] == ix.Blobs[c.Path] {
+			chunks = append(chunks, c)
+		}
+	}
+	changed := 0
+	for p, blob := range blobs {
+		if ix.Blobs[p] == blob {
+			continue
+		}
+		changed++
+		data, err := os.ReadFile(filepath.Join(dir, p))
+		if err != nil || len(data) > maxFileSize || bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0 {
+			continue // Gone, too big or binary: kept in Blobs so it isn't retried
+		}
+		chunks = append(chunks, split(p, string(data))...)
+	}
+	if changed == 0 && len(blobs) == len(ix.Blobs) {
+		return ix, 0, nil
+	}
+
+	sort.Slice(chunks, func(i, j int) bool {
+		if chunks[i].Path != chunks[j].Path {
+			return chunks[i].Path < chunks[j].Path
+		}
+		return chunks[i].Start < chunks[j].Start
+	})
+	ix = &Index{Blobs: blobs, Chunks: chunks}
+	return ix, changed, ix.save(path)
+}
+
+// Load reads an index. A missing file is an empty index.
+func Load(path string) (*Index, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return &Index{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var ix Index
+	if err := gob.NewDecoder(f).Decode(&ix); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &ix, nil
+}
+
+func (ix *Index) save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(ix); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// trackedFiles lists the regular files git tracks in dir with their blob
+// hashes.
+func trackedFiles(dir string) (map[string]string, error) {
+	out, err := tools.Command(tools.Git, "-C", dir, "ls-files", "-s").Output()
+	if err != nil {
+		return nil, fmt.Errorf("git ls-files: %w", err)
+	}
+	files := make(map[string]string)
+	for _, line := range strings.Split(string(out), "\n") {
+		// <mode> <blob> <stage>\t<path>
+		meta, p, ok := strings.Cut(line, "\t")
+		fields := strings.Fields(meta)
+		if !ok || len(fields) != 3 || !strings.HasPrefix(fields[0], "100") {
+			continue // Symlinks and submodules
+		}
+		files[p] = fields[1]
+	}
+	return files, nil
+}
+
+// split cuts a file into chunks and embeds them. The path's words count in
+// every chunk, so a file named after the topic ranks well.
+func split(path, text string) []Chunk {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	pathWords := words(path)
+	var chunks []Chunk
+	for start := 0; start < len(lines); start += chunkLines {
+		end := min(start+chunkLines, len(lines))
+		body := strings.Join(lines[start:end], "\n")
+		if strings.TrimSpace(body) == "" {
+			continue
+		}
+		chunks = append(chunks, Chunk{
+			Path:  path,
+			Start: start + 1,
+			End:   end,
+			Terms: embed(append(words(body), pathWords...)),
+		})
+	}
+	return chunks
+}
+
+// embed hashes words into buckets weighted 1+log(count).
+func embed(ws []string) map[uint32]float32 {
+	counts := make(map[uint32]int)
+	for _, w := range ws {
+		h := fnv.New32a()
+		h.Write([]byte(w))
+		counts[h.Sum32()%dims]++
+	}
+	terms := make(map[uint32]float32, len(counts))
+	for b, n := range counts {
+		terms[b] = float32(1 + math.Log(float64(n)))
+	}
+	return terms
+}
+
+// words splits text into lowercase words, breaking identifiers at
+// underscores and case changes: "parseHTTPRequest" is parse, http, request.
+// Short words and keywords shared by most code are dropped.
+func words(text string) []string {
+	var ws []string
+	var cur []rune
+	flush := func() {
+		if w := strings.ToLower(string(cur)); len(cur) >= 3 && !stopWords[w] {
+			ws = append(ws, w)
+		}
+		cur = cur[:0]
+	}
+	runes := []rune(text)
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			flush()
+			continue
+		}
+		if len(cur) > 0 && unicode.IsUpper(r) {
+			prev := cur[len(cur)-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || (unicode.IsUpper(prev) && nextLower) {
+				flush()
+			}
+		}
+		cur = append(cur, r)
+	}
+	flush()
+	return ws
+}
+
+var stopWords = map[string]bool{
+	"the": true, "and": true, "for": true, "with": true, "this": true, "that": true,
+	"from": true, "are": true, "not": true, "but": true, "you": true, "all": true,
+	"func": true, "return": true, "var": true, "const": true, "nil": true, "err": true,
+	"true": true, "false": true, "int": true, "string": true, "def": true, "self": true,
+	"function": true, "let": true, "new": true, "null": true, "none": true, "import": true,
+}
+
+// Search returns up to n chunks most similar to text, best first. Chunks
+// with nothing in common with it are left out.
+func (ix *Index) Search(text string, n int) []Match {
+	if len(ix.Chunks) == 0 {
+		return nil
+	}
+	df := make(map[uint32]int)
+	for _, c := range ix.Chunks {
+		for b := range c.Terms {
+			df[b]++
+		}
+	}
+	idf := func(b uint32) float64 {
+		return math.Log(float64(len(ix.Chunks)+1)/float64(df[b]+1)) + 1
+	}
+
+	query := embed(words(text))
+	var qNorm float64
+	for b, w := range query {
+		qNorm += math.Pow(float64(w)*idf(b), 2)
+	}
+	if qNorm == 0 {
+		return nil
+	}
+
+	var matches []Match
+	for _, c := range ix.Chunks {
+		var dot, cNorm float64
+		for b, w := range c.Terms {
+			cw := float64(w) * idf(b)
+			cNorm += cw * cw
+			if qw, ok := query[b]; ok {
+				dot += float64(qw) * idf(b) * cw
+			}
+		}
+		if dot > 0 {
+			matches = append(matches, Match{Chunk: c, Score: dot / math.Sqrt(qNorm*cNorm)})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	if len(matches) > n {
+		matches = matches[:n]
+	}
+	return matches
+}
+
+// Snippets returns the code most relevant to text, read from dir, as
+// fenced blocks headed by path and line range, within budget bytes.
+func (ix *Index) Snippets(dir, text string, budget int) string {
+	var sb strings.Builder
+	for _, m := range ix.Search(text, maxSnippets) {
+		data, err := os.ReadFile(filepath.Join(dir, m.Path))
+		if err != nil {
+			continue
+		}
+		lines := strings.Split(string(data), "\n")
+		if m.Start > len(lines) {
+			continue
+		}
+		lines = lines[m.Start-1 : min(m.End, len(lines))]
+
+		// Cut a snippet that doesn't fit down to the lines that do
+		head := fmt.Sprintf("%s:%d-%d\n```\n", m.Path, m.Start, m.Start+len(lines)-1)
+		room := budget - sb.Len() - len(head) - len("```\n\n")
+		var body strings.Builder
+		for _, l := range lines {
+			if body.Len()+len(l)+1 > room {
+				break
+			}
+			body.WriteString(l + "\n")
+		}
+		code := strings.TrimRight(body.String(), "\n")
+		if code == "" {
+			break
+		}
+		shown := strings.Count(code, "\n") + 1
+		fmt.Fprintf(&sb, "%s:%d-%d\n```\n%s\n```\n\n", m.Path, m.Start, m.Start+shown-1, code)
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
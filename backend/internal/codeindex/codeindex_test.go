@@ -0,0 +1,73 @@
+package codeindex
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWords(t *testing.T) {
+	got := words("func parseHTTPRequest(r *http.Request) error { return nil } // snake_case_name")
+	want := []string{"parse", "http", "request", "http", "request", "error", "snake", "case", "name"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("words() = %q, want %q", got, want)
+	}
+}
+
+func TestUpdateSearch(t *testing.T) {
+	dir := t.TempDir()
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=t", "-c", "user.email=t@t"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	write := func(name, content string) {
+		os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755)
+		os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+	}
+	git("init", "-q")
+	write("quota/refresh.go", "package quota\n\n// refreshQuota polls each account's remaining quota.\nfunc refreshQuota(accounts []Account) {}\n")
+	write("tui/render.go", "package tui\n\n// renderPanel draws the agents panel.\nfunc renderPanel(screen Screen) {}\n")
+	write("logo.png", "\x89PNG\x00\x00binary")
+	git("add", "-A")
+	git("commit", "-qm", "init")
+
+	path := filepath.Join(t.TempDir(), "codeindex.gob")
+	ix, changed, err := Update(path, dir)
+	if err != nil || changed != 3 {
+		t.Fatalf("Update() = %d, %v; want 3 files", changed, err)
+	}
+	if len(ix.Chunks) != 2 {
+		t.Errorf("%d chunks, want one per text file", len(ix.Chunks))
+	}
+
+	matches := ix.Search("Quota refresh skips accounts", 5)
+	if len(matches) == 0 || matches[0].Path != "quota/refresh.go" {
+		t.Fatalf("Search() = %+v, want quota/refresh.go first", matches)
+	}
+	if got := ix.Snippets(dir, "draw the agents panel", Budget); !strings.HasPrefix(got, "tui/render.go:1-4\n```\npackage tui") {
+		t.Errorf("Snippets() =\n%s", got)
+	}
+	if got := ix.Snippets(dir, "draw the agents panel", 40); got != "tui/render.go:1-1\n```\npackage tui\n```" {
+		t.Errorf("Snippets() over budget =\n%s", got)
+	}
+
+	// Only changed files are embedded again
+	if _, changed, _ := Update(path, dir); changed != 0 {
+		t.Errorf("unchanged repo: %d files embedded", changed)
+	}
+	write("tui/render.go", "package tui\n\n// renderQuota draws quota bars.\n")
+	git("commit", "-qam", "change")
+	git("rm", "-q", "quota/refresh.go")
+	ix, changed, err = Update(path, dir)
+	if err != nil || changed != 1 {
+		t.Fatalf("Update() after change = %d, %v; want 1 file", changed, err)
+	}
+	if len(ix.Chunks) != 1 || ix.Chunks[0].Path != "tui/render.go" {
+		t.Errorf("chunks after change: %+v", ix.Chunks)
+	}
+}
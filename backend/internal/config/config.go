@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 )
 
@@ -12,14 +13,15 @@ import (
 type Config struct {
 	MachinatorDir string `json:"-"`
 
+	// Warnings lists non-fatal problems found while loading (e.g. unknown fields).
+	Warnings []Issue `json:"-"`
+
 	// DefaultAgentCount is the number of agents created on first run
 	// (before any agents exist in state). You can add more with + in the TUI.
 	DefaultAgentCount int `json:"default_agent_count"`
 
-	Timeouts struct {
-		Idle       Duration `json:"idle"`
-		MaxRuntime Duration `json:"max_runtime"`
-	} `json:"timeouts"`
+	// Timeouts may change mid-run (ApplyLive); read them with LiveTimeouts.
+	Timeouts TimeoutsConfig `json:"timeouts"`
 
 	Intervals struct {
 		Assigner     Duration `json:"assigner"`
@@ -27,8 +29,194 @@ type Config struct {
 		AgentWatch   Duration `json:"agent_watch"`
 	} `json:"intervals"`
 
+	// MaxTaskAttempts is how many failed or timed-out runs a task gets before
+	// it is barred and a task_abandoned event is sent. 0 retries forever.
+	// It may change mid-run (ApplyLive); read it with TaskAttempts.
+	MaxTaskAttempts int `json:"max_task_attempts"`
+
 	// HideCommitAuthors is a list of author names/emails to hide from commit log
 	HideCommitAuthors []string `json:"hide_commit_authors"`
+
+	// API configures the HTTP control API (disabled when Listen is empty).
+	API APIConfig `json:"api"`
+
+	// DesktopNotifications shows native notifications while the TUI runs.
+	DesktopNotifications DesktopConfig `json:"desktop_notifications"`
+
+	// Features turns experimental subsystems on or off (see Flags).
+	Features map[string]bool `json:"features"`
+
+	// Webhooks lists sinks that receive orchestrator events (generic JSON, Slack, or Discord).
+	Webhooks []WebhookConfig `json:"webhooks"`
+
+	// Safeguards holds back new tasks while the machine is short of disk
+	// or battery.
+	Safeguards SafeguardsConfig `json:"safeguards"`
+
+	// Autoscale grows and shrinks the agent pool with the backlog of ready
+	// tasks while the autoscaler feature flag is on.
+	Autoscale AutoscaleConfig `json:"autoscale"`
+
+	// PreventSleep keeps the machine awake while agents are running and
+	// assignment isn't paused (caffeinate on macOS, systemd-inhibit on
+	// Linux).
+	PreventSleep bool `json:"prevent_sleep"`
+
+	// Logs sizes the log files and how much of them the TUI holds at once.
+	Logs LogsConfig `json:"logs"`
+}
+
+// TimeoutsConfig bounds agents' runs and setup.
+type TimeoutsConfig struct {
+	Idle       Duration `json:"idle"`
+	MaxRuntime Duration `json:"max_runtime"`
+
+	// KillCooldown keeps a task killed from the TUI from being picked
+	// again right away.
+	KillCooldown Duration `json:"kill_cooldown"`
+
+	// Setup bounds each clone or fetch of a project's repos, and a
+	// gemini build with its npm install. 0 means no limit.
+	Setup Duration `json:"setup"`
+}
+
+// liveMu guards the settings ApplyLive changes while other goroutines run
+// with the config.
+var liveMu sync.RWMutex
+
+// LiveTimeouts returns the timeouts as they are now.
+func (c *Config) LiveTimeouts() TimeoutsConfig {
+	liveMu.RLock()
+	defer liveMu.RUnlock()
+	return c.Timeouts
+}
+
+// TaskAttempts returns MaxTaskAttempts as it is now.
+func (c *Config) TaskAttempts() int {
+	liveMu.RLock()
+	defer liveMu.RUnlock()
+	return c.MaxTaskAttempts
+}
+
+// ApplyLive copies the settings that can change mid-run, the timeouts and
+// max_task_attempts, from a reloaded config, describing each change.
+func (c *Config) ApplyLive(next *Config) []string {
+	liveMu.Lock()
+	defer liveMu.Unlock()
+	var changes []string
+	LiveSet(&changes, "timeouts.idle", (*time.Duration)(&c.Timeouts.Idle), next.Timeouts.Idle.Duration())
+	LiveSet(&changes, "timeouts.max_runtime", (*time.Duration)(&c.Timeouts.MaxRuntime), next.Timeouts.MaxRuntime.Duration())
+	LiveSet(&changes, "timeouts.kill_cooldown", (*time.Duration)(&c.Timeouts.KillCooldown), next.Timeouts.KillCooldown.Duration())
+	LiveSet(&changes, "timeouts.setup", (*time.Duration)(&c.Timeouts.Setup), next.Timeouts.Setup.Duration())
+	LiveSet(&changes, "max_task_attempts", &c.MaxTaskAttempts, next.MaxTaskAttempts)
+	return changes
+}
+
+// LiveSet sets *cur to next, noting the change if there is one. The
+// caller holds the lock guarding cur.
+func LiveSet[T comparable](changes *[]string, name string, cur *T, next T) {
+	if *cur == next {
+		return
+	}
+	*changes = append(*changes, fmt.Sprintf("%s %v → %v", name, *cur, next))
+	*cur = next
+}
+
+// Log overflow policies: what rotating a full log does with the generation
+// before it.
+const (
+	LogOverflowDrop    = "drop"
+	LogOverflowArchive = "archive"
+)
+
+// LogsConfig controls log history. The log files are the record of a run;
+// log views only hold a window of them, paged in from the files as they're
+// scrolled back.
+type LogsConfig struct {
+	// PageLines is how many lines a log view shows at first and pages in
+	// each time it's scrolled past the top (default 500).
+	PageLines int `json:"page_lines"`
+
+	// MaxFileMB is the size a log file is rotated to <source>.log.1 at
+	// (default 32).
+	MaxFileMB int `json:"max_file_mb"`
+
+	// Overflow is LogOverflowDrop (default), which keeps two generations
+	// of each log, or LogOverflowArchive, which keeps every generation as
+	// <source>.log.<time>.
+	Overflow string `json:"overflow"`
+}
+
+// SafeguardsConfig sets the limits below which no new tasks are started.
+// Running agents are left to finish.
+type SafeguardsConfig struct {
+	// MinFreeDiskMB is the free space needed under MACHINATOR_DIR
+	// (default 2048, 0 = don't check).
+	MinFreeDiskMB int `json:"min_free_disk_mb"`
+
+	// MinBattery is the charge, in percent, needed while running on
+	// battery (default 20, 0 = don't check).
+	MinBattery int `json:"min_battery"`
+}
+
+// AutoscaleConfig sizes the agent pool by demand. Without the autoscaler
+// flag the pool is what default_agent_count and + in the TUI make it.
+type AutoscaleConfig struct {
+	// MinAgents are kept however long they sit idle (default 1).
+	MinAgents int `json:"min_agents"`
+
+	// MaxAgents is the most agents a backlog gets (default 10).
+	MaxAgents int `json:"max_agents"`
+
+	// IdleAfter is how long an agent may go without a task before it's
+	// removed (default 10m). Its worktree stays for the next agent added.
+	IdleAfter Duration `json:"idle_after"`
+}
+
+// WebhookConfig describes one event sink.
+type WebhookConfig struct {
+	URL string `json:"url" schema:"required"`
+
+	// Format is the payload shape: "json" (the raw event), "slack", or
+	// "discord". Empty picks slack/discord from the URL host, else json.
+	Format string `json:"format"`
+
+	// Events selects what is delivered: "all", "failures", "completions",
+	// or specific event types like "task_assigned" (an unknown one is an
+	// error). Empty means "all".
+	Events []string `json:"events"`
+
+	// MaxAttempts is how many times delivery is tried before dropping (default 5).
+	MaxAttempts int `json:"max_attempts"`
+}
+
+// DesktopConfig controls native desktop notifications.
+type DesktopConfig struct {
+	Enabled bool `json:"enabled"`
+
+	// Events uses the same filter names as webhooks. Empty means failures,
+	// quota exhaustion, all_tasks_done and stalled.
+	Events []string `json:"events"`
+}
+
+// APIConfig holds settings for the HTTP control API.
+type APIConfig struct {
+	// Listen is the address to serve on, e.g. "127.0.0.1:8420".
+	Listen string `json:"listen"`
+
+	// Tokens grants roles to bearer tokens. If empty, the API is unauthenticated
+	// and only served on loopback addresses.
+	Tokens []APIToken `json:"tokens"`
+
+	// WebhookSecret is the secret GitHub signs webhook deliveries with.
+	// POST /webhooks/github is only served when it's set.
+	WebhookSecret string `json:"webhook_secret,omitempty"`
+}
+
+// APIToken maps a bearer token to a role ("admin" or "viewer").
+type APIToken struct {
+	Token string `json:"token"`
+	Role  string `json:"role"`
 }
 
 // Duration is a time.Duration that can be unmarshaled from JSON strings like "10m", "1s"
@@ -57,8 +245,17 @@ func (d Duration) Duration() time.Duration {
 	return time.Duration(d)
 }
 
-// Load loads configuration from MACHINATOR_DIR/config.json.
+// Load loads configuration from MACHINATOR_DIR/config.json, with
+// environment variables and --set overrides applied.
 func Load() (*Config, error) {
+	return LoadFor("")
+}
+
+// LoadFor loads configuration for a project. Layers apply in order, each
+// over the ones before: defaults, MACHINATOR_DIR/config.json, the
+// "settings" of the project's config file at projectConfig (skipped if
+// empty or missing), environment variables, then --set overrides.
+func LoadFor(projectConfig string) (*Config, error) {
 	dir := getMachinatorDir()
 
 	cfg := &Config{
@@ -67,36 +264,106 @@ func Load() (*Config, error) {
 
 	// Set defaults
 	cfg.DefaultAgentCount = 3
+	cfg.MaxTaskAttempts = 3
+	cfg.DesktopNotifications.Enabled = true
 	cfg.Timeouts.Idle = Duration(10 * time.Minute)
 	cfg.Timeouts.MaxRuntime = Duration(30 * time.Minute)
+	cfg.Timeouts.KillCooldown = Duration(10 * time.Minute)
+	cfg.Timeouts.Setup = Duration(30 * time.Minute)
 	cfg.Intervals.Assigner = Duration(1 * time.Second)
 	cfg.Intervals.QuotaRefresh = Duration(60 * time.Second)
 	cfg.Intervals.AgentWatch = Duration(100 * time.Millisecond)
+	cfg.Safeguards.MinFreeDiskMB = 2048
+	cfg.Safeguards.MinBattery = 20
+	cfg.Autoscale.MinAgents = 1
+	cfg.Autoscale.MaxAgents = 10
+	cfg.Autoscale.IdleAfter = Duration(10 * time.Minute)
+	cfg.Logs.PageLines = 500
+	cfg.Logs.MaxFileMB = 32
+	cfg.Logs.Overflow = LogOverflowDrop
 
 	// Load from file if exists
 	configPath := filepath.Join(dir, "config.json")
 	data, err := os.ReadFile(configPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			// No config file, use defaults
-			return cfg, nil
-		}
+	if err != nil && !os.IsNotExist(err) {
 		return nil, fmt.Errorf("read config: %w", err)
 	}
+	if err == nil {
+		warnings, err := Decode(configPath, data, cfg)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Warnings = append(warnings, cfg.flagWarnings(configPath)...)
+	}
 
-	// Strip JSONC comments
-	data = StripJSONComments(data)
+	if projectConfig != "" {
+		if err := cfg.applyProject(projectConfig); err != nil {
+			return nil, err
+		}
+	}
 
-	if err := json.Unmarshal(data, cfg); err != nil {
-		return nil, fmt.Errorf("parse config: %w", err)
+	// Environment overrides
+	if err := envDuration("MACHINATOR_IDLE_TIMEOUT", &cfg.Timeouts.Idle); err != nil {
+		return nil, err
+	}
+	if err := envDuration("MACHINATOR_MAX_TASK_RUNTIME", &cfg.Timeouts.MaxRuntime); err != nil {
+		return nil, err
 	}
 
+	if err := cfg.applyOverrides(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validate(configPath); err != nil {
+		return nil, err
+	}
 	return cfg, nil
 }
 
+// validate checks values the schema can't: ranges and enumerations.
+func (cfg *Config) validate(configPath string) error {
+	if cfg.MaxTaskAttempts < 0 {
+		return &SchemaError{Issues: []Issue{{File: configPath, Field: "max_task_attempts", Message: "must not be negative"}}}
+	}
+	if cfg.Timeouts.Setup < 0 {
+		return &SchemaError{Issues: []Issue{{File: configPath, Field: "timeouts.setup", Message: "must not be negative"}}}
+	}
+	if cfg.DefaultAgentCount < 0 {
+		return &SchemaError{Issues: []Issue{{File: configPath, Field: "default_agent_count", Message: "must not be negative"}}}
+	}
+	if cfg.Safeguards.MinFreeDiskMB < 0 {
+		return &SchemaError{Issues: []Issue{{File: configPath, Field: "safeguards.min_free_disk_mb", Message: "must not be negative"}}}
+	}
+	if cfg.Safeguards.MinBattery < 0 || cfg.Safeguards.MinBattery > 100 {
+		return &SchemaError{Issues: []Issue{{File: configPath, Field: "safeguards.min_battery", Message: "must be between 0 and 100"}}}
+	}
+	if cfg.Autoscale.MinAgents < 0 {
+		return &SchemaError{Issues: []Issue{{File: configPath, Field: "autoscale.min_agents", Message: "must not be negative"}}}
+	}
+	if cfg.Autoscale.MaxAgents < cfg.Autoscale.MinAgents {
+		return &SchemaError{Issues: []Issue{{File: configPath, Field: "autoscale.max_agents", Message: "must be at least autoscale.min_agents"}}}
+	}
+	if cfg.Autoscale.IdleAfter <= 0 {
+		return &SchemaError{Issues: []Issue{{File: configPath, Field: "autoscale.idle_after", Message: "must be positive"}}}
+	}
+	if cfg.Logs.PageLines <= 0 {
+		return &SchemaError{Issues: []Issue{{File: configPath, Field: "logs.page_lines", Message: "must be positive"}}}
+	}
+	if cfg.Logs.MaxFileMB <= 0 {
+		return &SchemaError{Issues: []Issue{{File: configPath, Field: "logs.max_file_mb", Message: "must be positive"}}}
+	}
+	if cfg.Logs.Overflow != LogOverflowDrop && cfg.Logs.Overflow != LogOverflowArchive {
+		return &SchemaError{Issues: []Issue{{File: configPath, Field: "logs.overflow", Message: fmt.Sprintf("must be %q or %q", LogOverflowDrop, LogOverflowArchive)}}}
+	}
+	return nil
+}
+
 // Template returns a documented config template.
 func Template() string {
-	return `{
+	return `// machinator config. Settings apply in order, each over the ones before:
+// built-in defaults, this file, a project's "settings", environment
+// variables (machinator env), then --set field=value. Check the result with
+// machinator config validate.
+{
   // Number of agents created on first run (before any agents exist).
   // You can add more at runtime with + in the TUI.
   "default_agent_count": 3,
@@ -104,7 +371,11 @@ func Template() string {
   // Timeout settings (use Go duration strings like "10m", "1h")
   "timeouts": {
     "idle": "10m",
-    "max_runtime": "30m"
+    "max_runtime": "30m",
+    // How long a task killed from the TUI waits before it can be reassigned
+    "kill_cooldown": "10m",
+    // Longest a clone, fetch or gemini build may take ("0" for no limit)
+    "setup": "30m"
   },
 
   // Refresh intervals
@@ -114,14 +385,94 @@ func Template() string {
     "agent_watch": "100ms"
   },
 
+  // Failed or timed-out runs before a task is barred (0 = retry forever)
+  "max_task_attempts": 3,
+
   // Hide commits by these authors from the TUI Commits section.
   // Matches if author name or email contains any of these strings.
   // Example: ["github-actions", "dependabot"]
-  "hide_commit_authors": []
+  "hide_commit_authors": [],
+
+  // HTTP control API (disabled when "listen" is empty).
+  // Roles: "viewer" can read state; "admin" can also pause, add agents, bar tasks.
+  // With no tokens configured the API is unauthenticated, and only served on localhost.
+  "api": {
+    "listen": "",
+    "tokens": [
+      // {"token": "change-me", "role": "admin"},
+      // {"token": "dashboard", "role": "viewer"}
+    ],
+    // Set to serve POST /webhooks/github for a GitHub webhook with this
+    // secret: pushes to the project's branch and issues labeled
+    // "agent-ready" (added as tasks) wake the assigner at once.
+    "webhook_secret": ""
+  },
+
+  // Native notifications (osascript/notify-send) while the TUI is running.
+  // Default events: task_failed, task_abandoned, merge_failed,
+  // setup_failed, quota_exhausted, all_tasks_done, stalled,
+  // orchestrator_crashed.
+  "desktop_notifications": {
+    "enabled": true,
+    "events": []
+  },
+
+  // Webhook sinks for orchestrator events (POST, retried with backoff).
+  // "events" filters delivery: "all", "failures", "completions", or event
+  // types such as "task_completed", "task_abandoned", "quota_exhausted",
+  // "orchestrator_crashed".
+  // "format" is "json", "slack", or "discord"; Slack and Discord incoming
+  // webhook URLs are detected automatically.
+  "webhooks": [
+    // {"url": "https://hooks.slack.com/services/T000/B000/XXXX", "events": ["completions", "task_abandoned", "quota_exhausted", "orchestrator_crashed"]},
+    // {"url": "https://discord.com/api/webhooks/123/abc", "events": ["failures"]},
+    // {"url": "https://analytics.example.com/ingest", "events": ["all"], "max_attempts": 10}
+  ],
+
+  // Stop starting new tasks (running ones finish) while free disk under
+  // MACHINATOR_DIR or, on battery, charge is below these. 0 turns a check off.
+  "safeguards": {
+    "min_free_disk_mb": 2048,
+    "min_battery": 20
+  },
+
+  // Add agents (up to max_agents) while ready tasks outnumber idle agents,
+  // and remove agents that have gone idle_after without a task (down to
+  // min_agents). Removed agents' worktrees are reused by agents added
+  // later, dependencies and all.
+  "autoscale": {
+    "enabled": false,
+    "min_agents": 1,
+    "max_agents": 10,
+    "idle_after": "10m"
+  },
+
+  // Keep the machine from sleeping while agents are running (caffeinate on
+  // macOS, systemd-inhibit on Linux). Released while paused or idle.
+  "prevent_sleep": false,
+
+  // Log files under logs/ are rotated to <source>.log.1 at max_file_mb.
+  // "overflow": "drop" keeps just that previous generation; "archive" keeps
+  // every generation as <source>.log.<time>. Log views in the TUI show
+  // page_lines lines and page in as many more when scrolled past the top.
+  "logs": {
+    "page_lines": 500,
+    "max_file_mb": 32,
+    "overflow": "drop"
+  },
+
+  // Experimental subsystems, off unless enabled here.
+  // See 'machinator flags list'; toggle with 'machinator flags enable NAME'.
+  "features": {}
 }
 `
 }
 
+// Dir returns MACHINATOR_DIR, without loading the config.
+func Dir() string {
+	return getMachinatorDir()
+}
+
 // ConfigPath returns the path to the global config file.
 func ConfigPath() string {
 	return filepath.Join(getMachinatorDir(), "config.json")
@@ -144,9 +495,12 @@ func EnsureTemplate() (string, error) {
 	return configPath, nil
 }
 
+// getMachinatorDir is the one place MACHINATOR_DIR is resolved. A leading
+// "~/" is expanded as for profiles, since the variable is often set from a
+// file or service definition where no shell expands it.
 func getMachinatorDir() string {
 	if dir := os.Getenv("MACHINATOR_DIR"); dir != "" {
-		return dir
+		return expandHome(dir)
 	}
 	home, _ := os.UserHomeDir()
 	return filepath.Join(home, ".machinator")
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// EnvVar describes an environment variable machinator reads.
+type EnvVar struct {
+	Name        string
+	Type        string // "path", "duration", "string", "secret", or "command"
+	Default     string // Shown when unset; empty if the default comes from config
+	Description string
+}
+
+// EnvVars is the registry of every supported environment variable.
+// Anything read with os.Getenv should be listed here.
+var EnvVars = []EnvVar{
+	{
+		Name:        "MACHINATOR_DIR",
+		Type:        "path",
+		Default:     "~/.machinator",
+		Description: "Base directory for config, state, accounts, projects, and logs",
+	},
+	{
+		Name:        "MACHINATOR_PROFILE",
+		Type:        "string",
+		Description: "Profile whose directory is MACHINATOR_DIR, from the registry machinator profile manages (--profile/-P overrides)",
+	},
+	{
+		Name:        "MACHINATOR_IDLE_TIMEOUT",
+		Type:        "duration",
+		Description: "Overrides timeouts.idle from config.json",
+	},
+	{
+		Name:        "MACHINATOR_MAX_TASK_RUNTIME",
+		Type:        "duration",
+		Description: "Overrides timeouts.max_runtime from config.json",
+	},
+	{
+		Name:        "BD_AGENT_NAME",
+		Type:        "string",
+		Default:     "Machinator Agent",
+		Description: "Base agent name used in directives; the agent number is appended",
+	},
+	{
+		Name:        "MACHINATOR_CHAOS",
+		Type:        "string",
+		Description: "Chaos mode faults, e.g. \"kill=0.01,delay=2s,drop=0.1\" (needs MACHINATOR_DUMMY_TOOLS=1); seed defaults to the run seed",
+	},
+	{
+		Name:        "MACHINATOR_DUMMY_TOOLS",
+		Type:        "string",
+		Description: "Set to 1 when gemini and bd are test doubles; required for chaos mode",
+	},
+	{
+		Name:        "GITHUB_TOKEN",
+		Type:        "secret",
+		Description: "API token for projects hosted on GitHub",
+	},
+	{
+		Name:        "GITLAB_TOKEN",
+		Type:        "secret",
+		Description: "API token for projects hosted on GitLab",
+	},
+	{
+		Name:        "BITBUCKET_TOKEN",
+		Type:        "secret",
+		Description: "API token (Bearer) for projects hosted on Bitbucket Cloud",
+	},
+	{
+		Name:        "JIRA_TOKEN",
+		Type:        "secret",
+		Description: "API token for projects whose tracker is Jira",
+	},
+	{
+		Name:        "LINEAR_API_KEY",
+		Type:        "secret",
+		Description: "API key for projects whose tracker is Linear",
+	},
+	{
+		Name:        "EDITOR",
+		Type:        "command",
+		Default:     "vim",
+		Description: "Editor opened by `machinator project edit`",
+	},
+}
+
+// LookupEnvVar returns the registry entry for name.
+func LookupEnvVar(name string) (EnvVar, bool) {
+	for _, v := range EnvVars {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return EnvVar{}, false
+}
+
+// Value returns the variable's value and whether it is set (non-empty).
+func (v EnvVar) Value() (string, bool) {
+	s := os.Getenv(v.Name)
+	return s, s != ""
+}
+
+// Check validates a value against the variable's type.
+func (v EnvVar) Check(s string) error {
+	switch v.Type {
+	case "duration":
+		if _, err := time.ParseDuration(s); err != nil {
+			return fmt.Errorf("%s: invalid duration %q (use Go durations like \"10m\")", v.Name, s)
+		}
+	case "path", "command", "string", "secret":
+		if strings.TrimSpace(s) == "" {
+			return fmt.Errorf("%s: empty value", v.Name)
+		}
+	}
+	return nil
+}
+
+// envString returns a registered variable's value, or its default when unset.
+func envString(name string) string {
+	v, _ := LookupEnvVar(name)
+	if s, ok := v.Value(); ok {
+		return s
+	}
+	return v.Default
+}
+
+// envDuration applies a duration override to d if the variable is set.
+func envDuration(name string, d *Duration) error {
+	v, _ := LookupEnvVar(name)
+	s, ok := v.Value()
+	if !ok {
+		return nil
+	}
+	if err := v.Check(s); err != nil {
+		return err
+	}
+	dur, _ := time.ParseDuration(s)
+	*d = Duration(dur)
+	return nil
+}
+
+// AgentName returns the display name for an agent (BD_AGENT_NAME + number).
+func AgentName(agentID int) string {
+	return fmt.Sprintf("%s %d", envString("BD_AGENT_NAME"), agentID)
+}
+
+// Editor returns the editor command (EDITOR, default vim).
+func Editor() string {
+	return envString("EDITOR")
+}
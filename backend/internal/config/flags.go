@@ -0,0 +1,202 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Flag is a feature flag gating an experimental subsystem.
+type Flag struct {
+	Name        string
+	Description string
+	Default     bool
+}
+
+// Flags is the registry of known feature flags. Experimental code should
+// check cfg.FeatureEnabled(name) and ship disabled until it is ready; a
+// flag goes in the registry with the check that reads it.
+var Flags = []Flag{
+	// Checked where an agent merges its task branch (watchAgent)
+	{Name: "merge_queue", Description: "Serialize agent branch merges through a queue"},
+	// Checked when the orchestrator starts
+	{Name: "autoscaler", Description: "Add and remove agents based on ready work (see autoscale)"},
+}
+
+// LookupFlag returns the registry entry for name.
+func LookupFlag(name string) (Flag, bool) {
+	for _, f := range Flags {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Flag{}, false
+}
+
+// FeatureEnabled reports whether a feature flag is on, falling back to the
+// flag's default when config doesn't mention it.
+func (c *Config) FeatureEnabled(name string) bool {
+	if on, ok := c.Features[name]; ok {
+		return on
+	}
+	f, _ := LookupFlag(name)
+	return f.Default
+}
+
+// flagWarnings reports flags in config that aren't in the registry.
+func (c *Config) flagWarnings(file string) []Issue {
+	var names []string
+	for name := range c.Features {
+		if _, ok := LookupFlag(name); !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var issues []Issue
+	for _, name := range names {
+		issues = append(issues, Issue{File: file, Field: "features." + name, Message: "unknown feature flag (ignored)"})
+	}
+	return issues
+}
+
+// SetFeature turns a flag on or off in config.json, editing the file in
+// place so comments and formatting are kept.
+func SetFeature(name string, on bool) error {
+	if _, ok := LookupFlag(name); !ok {
+		return fmt.Errorf("unknown feature flag %q", name)
+	}
+
+	path, err := EnsureTemplate()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config: %w", err)
+	}
+
+	updated, err := setObjectMember(data, "features", name, fmt.Sprintf("%t", on))
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if err := os.WriteFile(path, updated, 0644); err != nil {
+		return fmt.Errorf("write config: %w", err)
+	}
+	return nil
+}
+
+// span locates a JSON value in the source by byte offsets [start, end).
+type span struct {
+	start, end int64
+}
+
+// members maps the keys of a JSON object to their value spans. Also returns
+// the object's own span and the end of its last member value (or -1).
+func members(data []byte, dec *json.Decoder) (map[string]span, span, int64, error) {
+	obj := span{start: nextTokenOffset(data, dec.InputOffset())}
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, obj, -1, fmt.Errorf("expected object at offset %d", obj.start)
+	}
+
+	found := make(map[string]span)
+	last := int64(-1)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, obj, -1, err
+		}
+		key, _ := tok.(string)
+		start := nextTokenOffset(data, dec.InputOffset())
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, obj, -1, err
+		}
+		last = dec.InputOffset()
+		found[key] = span{start: start, end: last}
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, obj, -1, err
+	}
+	obj.end = dec.InputOffset()
+	return found, obj, last, nil
+}
+
+// setObjectMember sets data[object][key] = value, where object is a
+// top-level key, creating the object or key if needed.
+func setObjectMember(data []byte, object, key, value string) ([]byte, error) {
+	clean := StripJSONComments(data)
+
+	top, topSpan, topLast, err := members(clean, json.NewDecoder(bytes.NewReader(clean)))
+	if err != nil {
+		return nil, fmt.Errorf("parse config: %w", err)
+	}
+
+	keyJSON, _ := json.Marshal(key)
+	objJSON, _ := json.Marshal(object)
+
+	sp, ok := top[object]
+	if !ok {
+		// Add the whole object after the last top-level member
+		obj := fmt.Sprintf("%s: {\n    %s: %s\n  }", objJSON, keyJSON, value)
+		if topLast >= 0 {
+			return splice(data, topLast, topLast, ",\n  "+obj), nil
+		}
+		return splice(data, topSpan.start+1, topSpan.end-1, "\n  "+obj+"\n"), nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(clean[sp.start:sp.end]))
+	inner, innerSpan, innerLast, err := members(clean[sp.start:sp.end], dec)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", object, err)
+	}
+	if v, ok := inner[key]; ok {
+		return splice(data, sp.start+v.start, sp.start+v.end, value), nil
+	}
+
+	entry := fmt.Sprintf("%s: %s", keyJSON, value)
+	if innerLast >= 0 {
+		return splice(data, sp.start+innerLast, sp.start+innerLast, ",\n    "+entry), nil
+	}
+	// Empty object: replace its contents, dropping any comments inside
+	return splice(data, sp.start+innerSpan.start+1, sp.start+innerSpan.end-1, "\n    "+entry+"\n  "), nil
+}
+
+// SetMember sets a top-level key of a JSON config file to value (JSON),
+// editing in place so comments and formatting are kept, and adding the key
+// if it is missing.
+func SetMember(data []byte, key, value string) ([]byte, error) {
+	clean := StripJSONComments(data)
+	top, topSpan, topLast, err := members(clean, json.NewDecoder(bytes.NewReader(clean)))
+	if err != nil {
+		return nil, fmt.Errorf("parse config: %w", err)
+	}
+	if sp, ok := top[key]; ok {
+		return splice(data, sp.start, sp.end, value), nil
+	}
+
+	keyJSON, _ := json.Marshal(key)
+	entry := fmt.Sprintf("%s: %s", keyJSON, value)
+	if topLast >= 0 {
+		return splice(data, topLast, topLast, ",\n  "+entry), nil
+	}
+	return splice(data, topSpan.start+1, topSpan.end-1, "\n  "+entry+"\n"), nil
+}
+
+// splice replaces data[start:end] with s.
+func splice(data []byte, start, end int64, s string) []byte {
+	out := make([]byte, 0, len(data)+len(s))
+	out = append(out, data[:start]...)
+	out = append(out, s...)
+	return append(out, data[end:]...)
+}
+
+// nextTokenOffset skips whitespace and separators from off.
+func nextTokenOffset(data []byte, off int64) int64 {
+	for off < int64(len(data)) && bytes.IndexByte([]byte(" \t\r\n,:"), data[off]) >= 0 {
+		off++
+	}
+	return off
+}
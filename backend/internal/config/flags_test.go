@@ -0,0 +1,92 @@
+package config
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestSetObjectMember(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want map[string]bool
+	}{
+		{
+			name: "adds object",
+			in:   "{\n  // agents\n  \"default_agent_count\": 3\n}\n",
+			want: map[string]bool{"merge_queue": true},
+		},
+		{
+			name: "empty top level",
+			in:   "{}",
+			want: map[string]bool{"merge_queue": true},
+		},
+		{
+			name: "fills empty object",
+			in:   "{\n  // flags\n  \"features\": {}\n}\n",
+			want: map[string]bool{"merge_queue": true},
+		},
+		{
+			name: "adds key",
+			in:   "{\"features\": {\"autoscaler\": false}}",
+			want: map[string]bool{"autoscaler": false, "merge_queue": true},
+		},
+		{
+			name: "replaces value",
+			in:   "{\"features\": {\"merge_queue\": false, // off for now\n \"autoscaler\": true}}",
+			want: map[string]bool{"autoscaler": true, "merge_queue": true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := setObjectMember([]byte(tt.in), "features", "merge_queue", "true")
+			if err != nil {
+				t.Fatalf("setObjectMember: %v", err)
+			}
+
+			var got struct {
+				Features map[string]bool `json:"features"`
+			}
+			if err := json.Unmarshal(StripJSONComments(out), &got); err != nil {
+				t.Fatalf("result is not valid JSON: %v\n%s", err, out)
+			}
+			if len(got.Features) != len(tt.want) {
+				t.Fatalf("features = %v, want %v\n%s", got.Features, tt.want, out)
+			}
+			for k, v := range tt.want {
+				if got.Features[k] != v {
+					t.Errorf("features[%s] = %v, want %v\n%s", k, got.Features[k], v, out)
+				}
+			}
+			// Comments survive the edit
+			for _, line := range strings.Split(tt.in, "\n") {
+				if i := strings.Index(line, "//"); i >= 0 && !strings.Contains(string(out), line[i:]) {
+					t.Errorf("lost comment %q\n%s", line[i:], out)
+				}
+			}
+		})
+	}
+}
+
+func TestSetMember(t *testing.T) {
+	in := "{\n  // Model for simple tasks\n  \"simple_model_name\": \"a\",\n  \"branch\": \"main\"\n}\n"
+	out, err := SetMember([]byte(in), "simple_model_name", `"b"`)
+	if err == nil {
+		out, err = SetMember(out, "complex_model_name", `"c"`)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "// Model for simple tasks") {
+		t.Errorf("SetMember dropped a comment:\n%s", out)
+	}
+	var got map[string]string
+	if err := json.Unmarshal(StripJSONComments(out), &got); err != nil {
+		t.Fatalf("result is not valid JSON: %v\n%s", err, out)
+	}
+	if got["simple_model_name"] != "b" || got["complex_model_name"] != "c" || got["branch"] != "main" {
+		t.Errorf("SetMember = %v", got)
+	}
+}
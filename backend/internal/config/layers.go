@@ -0,0 +1,89 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// overrides are the "field=value" settings from --set, applied over every
+// other layer.
+var overrides []string
+
+// SetOverrides sets the "field=value" pairs (e.g. "timeouts.idle=5m") that
+// Load applies last, as given to --set. A value that isn't valid JSON is
+// taken as a string.
+func SetOverrides(settings []string) error {
+	for _, s := range settings {
+		if key, _, ok := strings.Cut(s, "="); !ok || key == "" {
+			return fmt.Errorf("--set %q: want field=value, e.g. timeouts.idle=5m", s)
+		}
+	}
+	overrides = settings
+	return nil
+}
+
+// applyProject layers the "settings" object of a project's config file
+// over cfg. The rest of the file is the project's own config and isn't
+// checked here.
+func (cfg *Config) applyProject(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read project config: %w", err)
+	}
+
+	layer := struct {
+		Settings *Config `json:"settings"`
+	}{Settings: cfg}
+	warnings, err := Decode(path, data, &layer)
+	if err != nil {
+		return err
+	}
+	for _, w := range warnings {
+		if strings.HasPrefix(w.Field, "settings.") {
+			cfg.Warnings = append(cfg.Warnings, w)
+		}
+	}
+	return nil
+}
+
+// applyOverrides layers the --set overrides over cfg. Unlike in a file, an
+// unknown field is an error: it's a typo on the command line.
+func (cfg *Config) applyOverrides() error {
+	for _, s := range overrides {
+		key, value, _ := strings.Cut(s, "=")
+		source := "--set " + key
+		warnings, err := Decode(source, overrideJSON(key, value), cfg)
+		if se, ok := err.(*SchemaError); ok {
+			for i := range se.Issues {
+				se.Issues[i].Line, se.Issues[i].Col = 0, 0 // Positions in the generated JSON mean nothing
+			}
+			return se
+		} else if err != nil {
+			return err
+		}
+		if len(warnings) > 0 {
+			return &SchemaError{Issues: []Issue{{File: source, Field: warnings[0].Field, Message: "unknown field"}}}
+		}
+	}
+	return nil
+}
+
+// overrideJSON builds the config object that sets the dotted field key to
+// value.
+func overrideJSON(key, value string) []byte {
+	raw := []byte(value)
+	if !json.Valid(raw) {
+		raw, _ = json.Marshal(value)
+	}
+	parts := strings.Split(key, ".")
+	for i := len(parts) - 1; i >= 0; i-- {
+		name, _ := json.Marshal(parts[i])
+		raw = []byte("{" + string(name) + ":" + string(raw) + "}")
+	}
+	return raw
+}
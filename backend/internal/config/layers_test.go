@@ -0,0 +1,85 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadForLayersInOrder(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("MACHINATOR_DIR", dir)
+	t.Setenv("MACHINATOR_IDLE_TIMEOUT", "")
+	t.Setenv("MACHINATOR_MAX_TASK_RUNTIME", "40m")
+	t.Cleanup(func() { overrides = nil })
+
+	global := `{
+  "timeouts": {"idle": "20m", "max_runtime": "1h", "kill_cooldown": "1m"},
+  "max_task_attempts": 5,
+  "default_agent_count": 2
+}`
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(global), 0644); err != nil {
+		t.Fatal(err)
+	}
+	projectPath := filepath.Join(dir, "project.json")
+	project := `{
+  "repo": "git@example.com:r.git",
+  // Not a config field, but the project's own
+  "merge": {"mode": "pr"},
+  "settings": {"timeouts": {"idle": "15m", "max_runtime": "2h"}, "max_task_attempts": 7}
+}`
+	if err := os.WriteFile(projectPath, []byte(project), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetOverrides([]string{"max_task_attempts=9", "prevent_sleep=true"}); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadFor(projectPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checks := []struct {
+		field     string
+		got, want any
+	}{
+		{"default_agent_count (global)", cfg.DefaultAgentCount, 2},
+		{"kill_cooldown (global)", cfg.Timeouts.KillCooldown.Duration(), time.Minute},
+		{"idle (project over global)", cfg.Timeouts.Idle.Duration(), 15 * time.Minute},
+		{"max_runtime (env over project)", cfg.Timeouts.MaxRuntime.Duration(), 40 * time.Minute},
+		{"max_task_attempts (--set over project)", cfg.MaxTaskAttempts, 9},
+		{"prevent_sleep (--set)", cfg.PreventSleep, true},
+	}
+	for _, c := range checks {
+		if c.got != c.want {
+			t.Errorf("%s = %v, want %v", c.field, c.got, c.want)
+		}
+	}
+	if len(cfg.Warnings) != 0 {
+		t.Errorf("unexpected warnings: %v", cfg.Warnings)
+	}
+}
+
+func TestOverridesAreChecked(t *testing.T) {
+	t.Setenv("MACHINATOR_DIR", t.TempDir())
+	t.Cleanup(func() { overrides = nil })
+
+	if err := SetOverrides([]string{"timeouts.idle"}); err == nil {
+		t.Error("override without a value accepted")
+	}
+	for setting, want := range map[string]string{
+		"timeouts.idle=soon":         "--set timeouts.idle: timeouts.idle: invalid duration",
+		"timeouts.idel=5m":           "--set timeouts.idel: timeouts.idel: unknown field",
+		"safeguards.min_battery=150": "must be between 0 and 100",
+	} {
+		if err := SetOverrides([]string{setting}); err != nil {
+			t.Fatal(err)
+		}
+		_, err := Load()
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("--set %s: got %v, want %q", setting, err, want)
+		}
+	}
+}
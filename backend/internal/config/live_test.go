@@ -0,0 +1,55 @@
+package config
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestApplyLiveWhileReading(t *testing.T) {
+	cfg := &Config{MaxTaskAttempts: 3}
+	cfg.Timeouts.Idle = Duration(10 * time.Minute)
+
+	// Readers on other goroutines, as the assigner and agent watchers are;
+	// go test -race fails if ApplyLive writes under them unguarded
+	stop := make(chan struct{})
+	var wg, started sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		started.Add(1)
+		go func() {
+			defer wg.Done()
+			started.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if idle := cfg.LiveTimeouts().Idle; idle != Duration(10*time.Minute) && idle != Duration(20*time.Minute) {
+					t.Errorf("idle timeout %v", idle.Duration())
+				}
+				cfg.TaskAttempts()
+			}
+		}()
+	}
+
+	started.Wait()
+	next := &Config{MaxTaskAttempts: 5}
+	for i := 0; i < 1000; i++ {
+		next.Timeouts.Idle = Duration(time.Duration(10+10*(i%2)) * time.Minute)
+		cfg.ApplyLive(next)
+	}
+	close(stop)
+	wg.Wait()
+
+	next.Timeouts.KillCooldown = Duration(time.Minute)
+	changes := cfg.ApplyLive(next)
+	if len(changes) != 1 || !strings.HasPrefix(changes[0], "timeouts.kill_cooldown 0s → 1m0s") {
+		t.Errorf("changes = %q", changes)
+	}
+	if cfg.TaskAttempts() != 5 {
+		t.Errorf("TaskAttempts() = %d, want 5", cfg.TaskAttempts())
+	}
+}
@@ -0,0 +1,142 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Profile is a named MACHINATOR_DIR.
+type Profile struct {
+	Dir string `json:"dir" schema:"required"` // "~/" is the home directory
+}
+
+// Profiles is the profile registry, ProfilesPath.
+type Profiles struct {
+	// Default is used when neither --profile nor MACHINATOR_PROFILE nor
+	// MACHINATOR_DIR says otherwise. Empty means ~/.machinator.
+	Default  string             `json:"default,omitempty"`
+	Profiles map[string]Profile `json:"profiles"`
+}
+
+// ProfilesPath is the profile registry,
+// $XDG_CONFIG_HOME/machinator/profiles.json (~/.config by default). It
+// lives outside every MACHINATOR_DIR since it chooses between them.
+func ProfilesPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, _ := os.UserHomeDir()
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "machinator", "profiles.json")
+}
+
+// LoadProfiles reads the profile registry. A missing file is an empty
+// registry.
+func LoadProfiles() (*Profiles, error) {
+	p := &Profiles{Profiles: make(map[string]Profile)}
+	path := ProfilesPath()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read profiles: %w", err)
+	}
+	if _, err := Decode(path, data, p); err != nil {
+		return nil, err
+	}
+	if p.Profiles == nil {
+		p.Profiles = make(map[string]Profile)
+	}
+	if p.Default != "" {
+		if _, ok := p.Profiles[p.Default]; !ok {
+			return nil, &SchemaError{Issues: []Issue{{File: path, Field: "default", Message: fmt.Sprintf("no profile %q", p.Default)}}}
+		}
+	}
+	return p, nil
+}
+
+// Save writes the registry.
+func (p *Profiles) Save() error {
+	path := ProfilesPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create config dir: %w", err)
+	}
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// Names returns the profile names, sorted.
+func (p *Profiles) Names() []string {
+	names := make([]string, 0, len(p.Profiles))
+	for name := range p.Profiles {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Dir returns a profile's MACHINATOR_DIR.
+func (p *Profiles) Dir(name string) (string, error) {
+	profile, ok := p.Profiles[name]
+	if !ok {
+		if len(p.Profiles) == 0 {
+			return "", fmt.Errorf("no profile %q: none in %s (add one with machinator profile add)", name, ProfilesPath())
+		}
+		return "", fmt.Errorf("no profile %q (have %s)", name, strings.Join(p.Names(), ", "))
+	}
+	return expandHome(profile.Dir), nil
+}
+
+// UseProfile points this process, and the processes it starts, at a
+// profile's MACHINATOR_DIR by setting MACHINATOR_DIR and
+// MACHINATOR_PROFILE. name comes from --profile; when it's empty,
+// MACHINATOR_PROFILE is used, then the registry's default unless
+// MACHINATOR_DIR is set.
+func UseProfile(name string) error {
+	if name == "" {
+		name = os.Getenv("MACHINATOR_PROFILE")
+	}
+	if name == "" && os.Getenv("MACHINATOR_DIR") != "" {
+		return nil
+	}
+	profiles, err := LoadProfiles()
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		name = profiles.Default
+	}
+	if name == "" {
+		return nil
+	}
+	dir, err := profiles.Dir(name)
+	if err != nil {
+		return err
+	}
+	os.Setenv("MACHINATOR_DIR", dir)
+	os.Setenv("MACHINATOR_PROFILE", name)
+	return nil
+}
+
+// ActiveProfile returns the profile in use, or "" if MACHINATOR_DIR wasn't
+// chosen by profile.
+func ActiveProfile() string {
+	return os.Getenv("MACHINATOR_PROFILE")
+}
+
+// expandHome expands a leading "~/".
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, _ := os.UserHomeDir()
+		return filepath.Join(home, strings.TrimPrefix(path, "~"))
+	}
+	return path
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUseProfile(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("MACHINATOR_DIR", "")
+	t.Setenv("MACHINATOR_PROFILE", "")
+
+	profiles := &Profiles{Default: "work", Profiles: map[string]Profile{
+		"work":     {Dir: "~/machinator-work"},
+		"personal": {Dir: "/srv/machinator"},
+	}}
+	if err := profiles.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(home, ".config", "machinator", "profiles.json"); ProfilesPath() != want {
+		t.Fatalf("ProfilesPath() = %s, want %s", ProfilesPath(), want)
+	}
+
+	use := func(flag, wantDir, wantProfile string) {
+		t.Helper()
+		if err := UseProfile(flag); err != nil {
+			t.Fatal(err)
+		}
+		if Dir() != wantDir || ActiveProfile() != wantProfile {
+			t.Errorf("UseProfile(%q): dir %s, profile %q; want %s, %q", flag, Dir(), ActiveProfile(), wantDir, wantProfile)
+		}
+	}
+	use("", filepath.Join(home, "machinator-work"), "work") // Registry default
+	use("personal", "/srv/machinator", "personal")          // --profile
+	use("", "/srv/machinator", "personal")                  // Inherited from the parent process
+
+	// An explicit MACHINATOR_DIR beats the registry's default
+	os.Setenv("MACHINATOR_PROFILE", "")
+	os.Setenv("MACHINATOR_DIR", "/tmp/elsewhere")
+	use("", "/tmp/elsewhere", "")
+	os.Setenv("MACHINATOR_DIR", "~/.machinator")
+	use("", filepath.Join(home, ".machinator"), "") // Unexpanded, e.g. from a unit file
+
+	if err := UseProfile("play"); err == nil || !strings.Contains(err.Error(), "have personal, work") {
+		t.Errorf("unknown profile: got %v", err)
+	}
+}
@@ -0,0 +1,351 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Issue is a problem found while checking a config file against its schema.
+type Issue struct {
+	File    string
+	Line    int
+	Col     int
+	Field   string // Dotted path, e.g. "timeouts.idle"
+	Message string
+}
+
+func (i Issue) String() string {
+	loc := i.File
+	if i.Line > 0 {
+		loc = fmt.Sprintf("%s:%d:%d", i.File, i.Line, i.Col)
+	}
+	if i.Field == "" {
+		return fmt.Sprintf("%s: %s", loc, i.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", loc, i.Field, i.Message)
+}
+
+// SchemaError lists every error found in a config file.
+type SchemaError struct {
+	Issues []Issue
+}
+
+func (e *SchemaError) Error() string {
+	lines := make([]string, len(e.Issues))
+	for i, issue := range e.Issues {
+		lines[i] = issue.String()
+	}
+	return "invalid config:\n  " + strings.Join(lines, "\n  ")
+}
+
+// Decode checks JSONC data against the fields of v (a pointer to a struct),
+// then unmarshals it into v. The schema comes from the struct itself:
+//   - json tags name the fields; keys with no matching field are warnings
+//   - fields tagged `schema:"required"` must be present and non-empty
+//   - values must match the field type, and Duration strings must parse
+//
+// Errors are returned together as a *SchemaError; warnings are returned
+// even when decoding succeeds.
+func Decode(file string, data []byte, v any) ([]Issue, error) {
+	data = StripJSONComments(data)
+
+	c := &checker{file: file, data: data, dec: json.NewDecoder(bytes.NewReader(data))}
+	c.dec.UseNumber()
+	c.value(reflect.TypeOf(v).Elem(), "")
+	if len(c.errors) == 0 {
+		if _, err := c.dec.Token(); err != io.EOF {
+			c.errorAt(c.dec.InputOffset(), "", "unexpected data after end of config")
+		}
+	}
+	if len(c.errors) > 0 {
+		return c.warnings, &SchemaError{Issues: c.errors}
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return c.warnings, &SchemaError{Issues: []Issue{{File: file, Message: err.Error()}}}
+	}
+	return c.warnings, nil
+}
+
+// checker walks the JSON token stream alongside the target type.
+type checker struct {
+	file     string
+	data     []byte
+	dec      *json.Decoder
+	warnings []Issue
+	errors   []Issue
+	broken   bool // Syntax error, stop walking
+}
+
+var durationType = reflect.TypeOf(Duration(0))
+
+// position converts a byte offset to a 1-based line and column.
+func (c *checker) position(off int64) (int, int) {
+	if off > int64(len(c.data)) {
+		off = int64(len(c.data))
+	}
+	before := c.data[:off]
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := int(off) - bytes.LastIndexByte(before, '\n')
+	return line, col
+}
+
+// tokenStart returns the offset of the next token, skipping whitespace and separators.
+func (c *checker) tokenStart() int64 {
+	off := c.dec.InputOffset()
+	for off < int64(len(c.data)) && strings.IndexByte(" \t\r\n,:", c.data[off]) >= 0 {
+		off++
+	}
+	return off
+}
+
+func (c *checker) issue(off int64, field, msg string) Issue {
+	line, col := c.position(off)
+	return Issue{File: c.file, Line: line, Col: col, Field: field, Message: msg}
+}
+
+func (c *checker) errorAt(off int64, field, msg string) {
+	c.errors = append(c.errors, c.issue(off, field, msg))
+}
+
+// token reads the next token, recording syntax errors with their position.
+func (c *checker) token() (json.Token, int64, bool) {
+	if c.broken {
+		return nil, 0, false
+	}
+	start := c.tokenStart()
+	tok, err := c.dec.Token()
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		msg := err.Error()
+		if se, ok := err.(*json.SyntaxError); ok {
+			start = se.Offset - 1 // Offset is just past the bad byte
+			msg = "syntax error: " + se.Error()
+		}
+		c.errorAt(start, "", msg)
+		c.broken = true
+		return nil, start, false
+	}
+	return tok, start, true
+}
+
+// value checks one JSON value against type t.
+func (c *checker) value(t reflect.Type, path string) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	tok, start, ok := c.token()
+	if !ok {
+		return
+	}
+	if tok == nil {
+		return // null is accepted anywhere and leaves the default
+	}
+
+	if t == durationType {
+		switch v := tok.(type) {
+		case string:
+			if _, err := time.ParseDuration(v); err != nil {
+				c.errorAt(start, path, fmt.Sprintf("invalid duration %q (use Go durations like \"30s\", \"10m\", \"1h\")", v))
+			}
+		case json.Number:
+			if _, err := v.Int64(); err != nil {
+				c.errorAt(start, path, fmt.Sprintf("invalid duration %s", v))
+			}
+		default:
+			c.mismatch(tok, start, path, "duration string")
+		}
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if tok != json.Delim('{') {
+			c.mismatch(tok, start, path, "object")
+			return
+		}
+		c.object(t, path, start)
+	case reflect.Map:
+		if tok != json.Delim('{') {
+			c.mismatch(tok, start, path, "object")
+			return
+		}
+		for c.dec.More() {
+			key, _, ok := c.token()
+			if !ok {
+				return
+			}
+			c.value(t.Elem(), join(path, key.(string)))
+		}
+		c.token() // '}'
+	case reflect.Slice, reflect.Array:
+		if tok != json.Delim('[') {
+			c.mismatch(tok, start, path, "array")
+			return
+		}
+		for i := 0; c.dec.More(); i++ {
+			c.value(t.Elem(), fmt.Sprintf("%s[%d]", path, i))
+		}
+		c.token() // ']'
+	case reflect.String:
+		if _, ok := tok.(string); !ok {
+			c.mismatch(tok, start, path, "string")
+		}
+	case reflect.Bool:
+		if _, ok := tok.(bool); !ok {
+			c.mismatch(tok, start, path, "true or false")
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, ok := tok.(json.Number)
+		if !ok {
+			c.mismatch(tok, start, path, "integer")
+		} else if _, err := n.Int64(); err != nil {
+			c.errorAt(start, path, fmt.Sprintf("expected integer, got %s", n))
+		}
+	case reflect.Float32, reflect.Float64:
+		if _, ok := tok.(json.Number); !ok {
+			c.mismatch(tok, start, path, "number")
+		}
+	case reflect.Interface:
+		c.skip(tok)
+	}
+}
+
+// object checks the members of a JSON object against struct type t.
+func (c *checker) object(t reflect.Type, path string, start int64) {
+	seen := make(map[string]bool)
+	for c.dec.More() {
+		keyTok, keyStart, ok := c.token()
+		if !ok {
+			return
+		}
+		key := keyTok.(string)
+
+		field, ok := fieldByKey(t, key)
+		if !ok {
+			c.warnings = append(c.warnings, c.issue(keyStart, join(path, key), "unknown field (ignored)"))
+			next, _, ok := c.token()
+			if !ok {
+				return
+			}
+			c.skip(next)
+			continue
+		}
+		seen[field.Name] = true
+
+		fieldStart := c.tokenStart()
+		c.value(field.Type, join(path, key))
+		if required(field) && !c.broken && c.emptyAt(fieldStart) {
+			c.errorAt(fieldStart, join(path, key), "required field is empty")
+		}
+	}
+	c.token() // '}'
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if required(f) && !seen[f.Name] {
+			c.errorAt(start, join(path, jsonName(f)), "required field is missing")
+		}
+	}
+}
+
+// emptyAt reports whether the value starting at off is "", null, or [].
+func (c *checker) emptyAt(off int64) bool {
+	rest := c.data[off:]
+	for _, empty := range []string{`""`, "null", "[]"} {
+		if bytes.HasPrefix(rest, []byte(empty)) {
+			return true
+		}
+	}
+	return false
+}
+
+// skip consumes the rest of a value whose first token has been read.
+func (c *checker) skip(tok json.Token) {
+	if tok != json.Delim('{') && tok != json.Delim('[') {
+		return
+	}
+	for depth := 1; depth > 0; {
+		t, _, ok := c.token()
+		if !ok {
+			return
+		}
+		switch t {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+	}
+}
+
+func (c *checker) mismatch(tok json.Token, start int64, path, want string) {
+	got := "null"
+	switch v := tok.(type) {
+	case json.Delim:
+		if v == '{' {
+			got = "object"
+		} else {
+			got = "array"
+		}
+		c.skip(tok)
+	case string:
+		got = fmt.Sprintf("string %q", v)
+	case json.Number:
+		got = "number " + v.String()
+	case bool:
+		got = fmt.Sprintf("%t", v)
+	}
+	c.errorAt(start, path, fmt.Sprintf("expected %s, got %s", want, got))
+}
+
+// fieldByKey finds the exported field a JSON key decodes into, matching
+// encoding/json's case-insensitive fallback.
+func fieldByKey(t reflect.Type, key string) (reflect.StructField, bool) {
+	var fold *reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := jsonName(f)
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if name == key {
+			return f, true
+		}
+		if fold == nil && strings.EqualFold(name, key) {
+			fold = &f
+		}
+	}
+	if fold != nil {
+		return *fold, true
+	}
+	return reflect.StructField{}, false
+}
+
+func jsonName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
+
+func required(f reflect.StructField) bool {
+	return f.Tag.Get("schema") == "required"
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type testSchema struct {
+	Repo   string   `json:"repo" schema:"required"`
+	Count  int      `json:"count"`
+	Idle   Duration `json:"idle"`
+	Nested struct {
+		Enabled bool `json:"enabled"`
+	} `json:"nested"`
+	Names []string `json:"names"`
+}
+
+func TestDecodeReportsFieldAndLine(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{
+			name: "bad duration",
+			data: "{\n  \"repo\": \"r\",\n  // comment\n  \"idle\": \"10 minutes\"\n}",
+			want: "c.json:4:11: idle: invalid duration",
+		},
+		{
+			name: "wrong type",
+			data: "{\n  \"repo\": \"r\",\n  \"count\": \"three\"\n}",
+			want: `c.json:3:12: count: expected integer, got string "three"`,
+		},
+		{
+			name: "nested wrong type",
+			data: "{\"repo\": \"r\", \"nested\": {\"enabled\": 1}}",
+			want: "c.json:1:37: nested.enabled: expected true or false, got number 1",
+		},
+		{
+			name: "array element",
+			data: "{\"repo\": \"r\", \"names\": [\"a\", 2]}",
+			want: "names[1]: expected string, got number 2",
+		},
+		{
+			name: "required missing",
+			data: "{\n  \"count\": 1\n}",
+			want: "c.json:1:1: repo: required field is missing",
+		},
+		{
+			name: "required empty",
+			data: "{\"repo\": \"\"}",
+			want: "c.json:1:10: repo: required field is empty",
+		},
+		{
+			name: "syntax error",
+			data: "{\n  \"repo\": \"r\",\n  \"count\": 1,,\n}",
+			want: "c.json:3:14: syntax error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v testSchema
+			_, err := Decode("c.json", []byte(tt.data), &v)
+			var se *SchemaError
+			if !errors.As(err, &se) {
+				t.Fatalf("Decode error = %v, want *SchemaError", err)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %q, want it to contain %q", err.Error(), tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeWarnsOnUnknownFields(t *testing.T) {
+	data := "{\n  \"repo\": \"r\",\n  \"idle\": \"5m\",\n  \"colour\": {\"a\": [1, 2]}\n}"
+
+	var v testSchema
+	warnings, err := Decode("c.json", []byte(data), &v)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if len(warnings) != 1 || warnings[0].String() != "c.json:4:3: colour: unknown field (ignored)" {
+		t.Errorf("warnings = %v", warnings)
+	}
+	if v.Repo != "r" || v.Idle.Duration().Minutes() != 5 {
+		t.Errorf("decoded = %+v", v)
+	}
+}
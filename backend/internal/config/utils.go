@@ -1,8 +1,10 @@
 package config
 
-// StripJSONComments removes // comments from JSONC
+// StripJSONComments blanks out // comments from JSONC. Comments are replaced
+// with spaces so byte offsets, lines, and columns match the original file.
 func StripJSONComments(data []byte) []byte {
-	var result []byte
+	result := make([]byte, len(data))
+	copy(result, data)
 	inString := false
 	i := 0
 	for i < len(data) {
@@ -11,11 +13,11 @@ func StripJSONComments(data []byte) []byte {
 		}
 		if !inString && i+1 < len(data) && data[i] == '/' && data[i+1] == '/' {
 			for i < len(data) && data[i] != '\n' {
+				result[i] = ' '
 				i++
 			}
 			continue
 		}
-		result = append(result, data[i])
 		i++
 	}
 	return result
@@ -0,0 +1,151 @@
+// Package decisions keeps a project's decisions.md: the key decisions agents
+// state while working ("DECISION: use zerolog because ..."), collected from
+// completed runs and shown to later agents so hundreds of tasks stay
+// consistent. The file is plain Markdown and may be edited by hand.
+package decisions
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/transcript"
+)
+
+const (
+	// Budget caps the decisions included in a directive, in bytes. The
+	// newest are kept.
+	Budget = 4000
+
+	// maxDecision cuts a single decision to a readable length.
+	maxDecision = 300
+)
+
+// header starts a new decisions file.
+const header = `# Decisions
+
+Key decisions agents made while working on this project, oldest first.
+Later agents are shown the newest of them. Edit or remove entries freely.
+
+`
+
+// decisionLine matches a decision stated in an agent's message.
+var decisionLine = regexp.MustCompile(`(?m)^[\s*>_-]*DECISION:\**\s*(.+)$`)
+
+// Path returns a project's decisions file.
+func Path(projectDir string) string {
+	return filepath.Join(projectDir, "decisions.md")
+}
+
+// Extract returns the decisions a run stated in its messages, in order.
+func Extract(entries []transcript.Entry, runID int64) []string {
+	// Messages may be streamed in pieces; join them before looking
+	var text strings.Builder
+	for _, e := range entries {
+		if e.Run != runID {
+			continue
+		}
+		var v struct {
+			Type    string `json:"type"`
+			Role    string `json:"role"`
+			Content string `json:"content"`
+		}
+		if json.Unmarshal(e.Event, &v) != nil || v.Type != "message" || v.Role != "assistant" {
+			continue
+		}
+		text.WriteString(v.Content)
+	}
+
+	var found []string
+	for _, m := range decisionLine.FindAllStringSubmatch(text.String(), -1) {
+		d := strings.TrimSpace(strings.Trim(m[1], "*_` "))
+		if len(d) > maxDecision {
+			d = d[:maxDecision] + "..."
+		}
+		if d != "" {
+			found = append(found, d)
+		}
+	}
+	return found
+}
+
+// Append adds a task's decisions to the file, skipping any it already
+// records. Returns how many were added.
+func Append(path, taskID string, decisions []string, at time.Time) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+	known := make(map[string]bool)
+	for _, e := range entries(string(data)) {
+		if _, d, ok := strings.Cut(e, ": "); ok {
+			known[d] = true
+		}
+	}
+
+	var add strings.Builder
+	if len(data) == 0 {
+		add.WriteString(header)
+	} else if !strings.HasSuffix(string(data), "\n") {
+		add.WriteString("\n")
+	}
+	added := 0
+	for _, d := range decisions {
+		if known[d] {
+			continue
+		}
+		known[d] = true
+		fmt.Fprintf(&add, "- %s %s: %s\n", at.Format("2006-01-02"), taskID, d)
+		added++
+	}
+	if added == 0 {
+		return 0, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := f.WriteString(add.String()); err != nil {
+		f.Close()
+		return 0, err
+	}
+	return added, f.Close()
+}
+
+// Recent returns the newest decisions in the file that fit in budget bytes,
+// oldest first, one "- " line each. Empty if there are none.
+func Recent(path string, budget int) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	all := entries(string(data))
+	size, first := 0, len(all)
+	for first > 0 && size+len(all[first-1])+3 <= budget {
+		first--
+		size += len(all[first]) + 3 // "- " and newline
+	}
+	if first == len(all) {
+		return ""
+	}
+	return "- " + strings.Join(all[first:], "\n- ")
+}
+
+// entries returns the list items of a decisions file, without the "- ".
+func entries(text string) []string {
+	var items []string
+	for _, line := range strings.Split(text, "\n") {
+		if item, ok := strings.CutPrefix(strings.TrimSpace(line), "- "); ok && strings.TrimSpace(item) != "" {
+			items = append(items, strings.TrimSpace(item))
+		}
+	}
+	return items
+}
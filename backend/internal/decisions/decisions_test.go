@@ -0,0 +1,60 @@
+package decisions
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/transcript"
+)
+
+func TestExtract(t *testing.T) {
+	event := func(run int64, typ, role, content string) transcript.Entry {
+		data, _ := json.Marshal(map[string]string{"type": typ, "role": role, "content": content})
+		return transcript.Entry{Run: run, Event: data}
+	}
+	entries := []transcript.Entry{
+		event(1, "message", "assistant", "DECISION: from an earlier run"),
+		event(2, "message", "user", "DECISION: from the directive"),
+		event(2, "message", "assistant", "Looking at logging.\n**DECISION:** use zerolog for"),
+		event(2, "message", "assistant", " logging because it doesn't allocate\nDone."),
+		event(2, "tool_use", "", "DECISION: in a tool call"),
+		event(2, "message", "assistant", "\n- DECISION: keep config in JSONC\n"),
+	}
+	got := Extract(entries, 2)
+	want := []string{"use zerolog for logging because it doesn't allocate", "keep config in JSONC"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Extract() = %q, want %q", got, want)
+	}
+}
+
+func TestAppendRecent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "decisions.md")
+	if got := Recent(path, Budget); got != "" {
+		t.Errorf("no file: Recent() = %q", got)
+	}
+
+	day := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	if n, err := Append(path, "bd-1", []string{"use zerolog", "keep config in JSONC"}, day); err != nil || n != 2 {
+		t.Fatalf("Append() = %d, %v", n, err)
+	}
+	if n, err := Append(path, "bd-2", []string{"use zerolog", "name tests after files"}, day.AddDate(0, 0, 1)); err != nil || n != 1 {
+		t.Fatalf("Append() again = %d, %v; want only the new decision", n, err)
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.HasPrefix(string(data), "# Decisions") || !strings.HasSuffix(string(data), "- 2026-03-02 bd-2: name tests after files\n") {
+		t.Errorf("file:\n%s", data)
+	}
+
+	want := "- 2026-03-01 bd-1: use zerolog\n- 2026-03-01 bd-1: keep config in JSONC\n- 2026-03-02 bd-2: name tests after files"
+	if got := Recent(path, Budget); got != want {
+		t.Errorf("Recent() =\n%s\nwant\n%s", got, want)
+	}
+	if got, want := Recent(path, 90), "- 2026-03-01 bd-1: keep config in JSONC\n- 2026-03-02 bd-2: name tests after files"; got != want {
+		t.Errorf("Recent(90) =\n%s\nwant the newest that fit:\n%s", got, want)
+	}
+}
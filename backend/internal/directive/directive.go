@@ -0,0 +1,291 @@
+package directive
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/beads"
+	"github.com/bryantinsley/machinator/backend/internal/tools"
+)
+
+//go:embed directive.tmpl
+var defaultTemplate string
+
+//go:embed conflict.tmpl
+var conflictTemplate string
+
+const (
+	// projectContextLines is how much of AGENTS.md is included.
+	projectContextLines = 100
+
+	// maxPreviousChanges caps the restored diff so the directive stays small.
+	maxPreviousChanges = 20000
+)
+
+// Data holds the values available to the directive template.
+type Data struct {
+	AgentName      string
+	TaskID         string
+	TaskContext    string
+	ProjectContext string
+	Decisions      string // Recent decisions from earlier tasks, one "- " line each
+	RelevantCode   string // Code snippets found for the task by the context index
+
+	// Set when the project is a directory of a shared repository (monorepo)
+	Scope string // e.g. "services/payments"
+
+	// Set when the project spans more than one repository
+	Repos    []Repo // Extra repos checked out in the worktree
+	TaskRepo string // Name of the one the task belongs to; "" for the worktree's own
+
+	// Set when resuming from a checkpoint
+	PreviousChanges string
+	PreviousReason  string
+
+	// Set when retrying after a failed attempt
+	FailureReason    string
+	FailureEvents    []string // Last output events of the failed attempt
+	TestOutput       string   // End of the test gate's output, when it failed the attempt
+	DiscardedChanges string   // Uncommitted work thrown away by the reset
+	AttemptStat      string   // diff --stat of AttemptChanges
+	AttemptChanges   string   // What the attempt ended with that the fresh branch lacks
+
+	// Backing data for template functions
+	ScratchDir     string    // Per-task space for temp files and downloads
+	WorktreeDir    string    // For gitLog
+	TestCommand    string    // Configured test command; detected if empty
+	FailedAttempts []Attempt // Earlier failed runs of this task, oldest first
+
+	// Set when the task comes from an issue tracker rather than beads
+	Tracker  string // Tracker name, e.g. "Jira"
+	DoneFile string // Where the agent writes its completion summary
+}
+
+// Repo is an extra repository checked out inside the agent's worktree.
+type Repo struct {
+	Name        string
+	Dir         string // Relative to the worktree
+	Branch      string // Where its changes are pushed
+	Description string
+}
+
+// Attempt is an earlier failed run of the task.
+type Attempt struct {
+	Time    time.Time
+	Model   string
+	Outcome string
+	Message string
+}
+
+// TemplateFile is where a project's own directive template lives, both in
+// the repo (under .machinator/) and in the project directory.
+const TemplateFile = "directive.tmpl"
+
+// DefaultTemplate returns the built-in directive template, a starting point
+// for a project's own.
+func DefaultTemplate() string {
+	return defaultTemplate
+}
+
+// LoadTemplate finds the directive template for an agent. A template
+// committed to the repo at .machinator/directive.tmpl wins, then
+// projects/N/directive.tmpl, then the built-in default. Returns the
+// template text and where it came from.
+func LoadTemplate(worktreeDir, projectDir string) (string, string, error) {
+	candidates := []string{
+		filepath.Join(worktreeDir, ".machinator", TemplateFile),
+		filepath.Join(projectDir, TemplateFile),
+	}
+	for _, path := range candidates {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			return string(data), path, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", "", fmt.Errorf("read template: %w", err)
+		}
+	}
+	return defaultTemplate, "built-in", nil
+}
+
+// Build renders the directive for a task. An empty tmpl uses the built-in
+// default.
+//
+// Besides the Data fields, templates can call:
+//
+//	{{gitLog 10}}        last N commits in the worktree (oneline)
+//	{{testCommand}}      how to run the tests (configured or detected)
+//	{{failedAttempts}}   earlier failed runs of this task, one per line
+func Build(tmpl string, data Data) (string, error) {
+	if tmpl == "" {
+		tmpl = defaultTemplate
+	}
+
+	funcs := template.FuncMap{
+		"gitLog": func(n int) string {
+			return gitLog(data.WorktreeDir, n)
+		},
+		"testCommand": func() string {
+			if data.TestCommand != "" {
+				return data.TestCommand
+			}
+			return DetectTestCommand(data.WorktreeDir)
+		},
+		"failedAttempts": func() string {
+			return formatAttempts(data.FailedAttempts)
+		},
+	}
+
+	t, err := template.New("directive").Funcs(funcs).Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("parse template: %w", err)
+	}
+
+	data.PreviousChanges = truncateDiff(data.PreviousChanges)
+	data.DiscardedChanges = truncateDiff(data.DiscardedChanges)
+	data.AttemptChanges = truncateDiff(data.AttemptChanges)
+
+	var sb strings.Builder
+	if err := t.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("render template: %w", err)
+	}
+	return sb.String(), nil
+}
+
+func truncateDiff(diff string) string {
+	if len(diff) > maxPreviousChanges {
+		return diff[:maxPreviousChanges] + "\n... (diff truncated)"
+	}
+	return diff
+}
+
+// ConflictData holds the values for a conflict resolution directive.
+type ConflictData struct {
+	AgentName   string
+	TaskID      string
+	TaskTitle   string
+	Branch      string   // Being merged into TaskBranch
+	TaskBranch  string   // Checked out, mid-merge
+	Files       []string // Conflicting files
+	Hunks       string   // Their conflicting hunks
+	WorktreeDir string   // For detecting the test command
+	TestCommand string   // Configured test command; detected if empty
+}
+
+// BuildConflict renders the directive for an agent resolving a task
+// branch's merge conflicts.
+func BuildConflict(data ConflictData) (string, error) {
+	funcs := template.FuncMap{
+		"join": strings.Join,
+		"testCommand": func() string {
+			if data.TestCommand != "" {
+				return data.TestCommand
+			}
+			return DetectTestCommand(data.WorktreeDir)
+		},
+	}
+	t, err := template.New("conflict").Funcs(funcs).Parse(conflictTemplate)
+	if err != nil {
+		return "", fmt.Errorf("parse template: %w", err)
+	}
+	data.Hunks = truncateDiff(data.Hunks)
+
+	var sb strings.Builder
+	if err := t.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("render template: %w", err)
+	}
+	return sb.String(), nil
+}
+
+// gitLog returns the last n commits in dir, or "" if git fails.
+func gitLog(dir string, n int) string {
+	if dir == "" || n <= 0 {
+		return ""
+	}
+	out, err := tools.Command(tools.Git, "-C", dir, "log", "--oneline", "--no-decorate", fmt.Sprintf("-%d", n)).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimRight(string(out), "\n")
+}
+
+// testCommands maps marker files to the usual test command for that ecosystem.
+var testCommands = []struct{ file, command string }{
+	{".machinator/verify.sh", "./.machinator/verify.sh"}, // The project's own, versioned with it
+	{"MODULE.bazel", "bazel test //..."},
+	{"go.mod", "go test ./..."},
+	{"Cargo.toml", "cargo test"},
+	{"package.json", "npm test"},
+	{"pyproject.toml", "pytest"},
+	{"Makefile", "make test"},
+}
+
+// DetectTestCommand guesses the test command from files in the repo root.
+func DetectTestCommand(dir string) string {
+	if dir == "" {
+		return ""
+	}
+	for _, tc := range testCommands {
+		if _, err := os.Stat(filepath.Join(dir, tc.file)); err == nil {
+			return tc.command
+		}
+	}
+	return ""
+}
+
+func formatAttempts(attempts []Attempt) string {
+	var lines []string
+	for i, a := range attempts {
+		line := fmt.Sprintf("%d. %s on %s: %s", i+1, a.Time.Format("2006-01-02 15:04"), a.Model, a.Outcome)
+		if a.Message != "" {
+			line += " - " + a.Message
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// TaskContext formats a task for inclusion in a directive.
+func TaskContext(task *beads.Task) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "ID: %s\n", task.ID)
+	fmt.Fprintf(&sb, "Title: %s\n", task.Title)
+	fmt.Fprintf(&sb, "Priority: %d\n", task.Priority)
+	if task.IssueType != "" {
+		fmt.Fprintf(&sb, "Type: %s\n", task.IssueType)
+	}
+	if len(task.Labels) > 0 {
+		fmt.Fprintf(&sb, "Labels: %s\n", strings.Join(task.Labels, ", "))
+	}
+
+	sections := []struct{ name, body string }{
+		{"Description", task.Description},
+		{"Design", task.Design},
+		{"Acceptance Criteria", task.AcceptanceCriteria},
+		{"Notes", task.Notes},
+	}
+	for _, s := range sections {
+		if s.body != "" {
+			fmt.Fprintf(&sb, "\n%s:\n%s\n", s.name, s.body)
+		}
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// ProjectContext returns the head of AGENTS.md in the worktree, if present.
+func ProjectContext(worktreeDir string) string {
+	data, err := os.ReadFile(filepath.Join(worktreeDir, "AGENTS.md"))
+	if err != nil {
+		return ""
+	}
+	lines := strings.Split(string(data), "\n")
+	if len(lines) > projectContextLines {
+		lines = lines[:projectContextLines]
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n")
+}
@@ -0,0 +1,162 @@
+package directive
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadTemplatePrecedence(t *testing.T) {
+	worktree, projectDir := t.TempDir(), t.TempDir()
+
+	_, source, err := LoadTemplate(worktree, projectDir)
+	if err != nil || source != "built-in" {
+		t.Fatalf("no overrides: source = %q, err = %v", source, err)
+	}
+
+	projectTmpl := filepath.Join(projectDir, TemplateFile)
+	os.WriteFile(projectTmpl, []byte("project"), 0644)
+	if text, source, _ := LoadTemplate(worktree, projectDir); text != "project" || source != projectTmpl {
+		t.Errorf("project override: got %q from %q", text, source)
+	}
+
+	repoTmpl := filepath.Join(worktree, ".machinator", TemplateFile)
+	os.MkdirAll(filepath.Dir(repoTmpl), 0755)
+	os.WriteFile(repoTmpl, []byte("repo"), 0644)
+	if text, source, _ := LoadTemplate(worktree, projectDir); text != "repo" || source != repoTmpl {
+		t.Errorf("repo override: got %q from %q", text, source)
+	}
+}
+
+func TestBuildTemplateFunctions(t *testing.T) {
+	worktree := t.TempDir()
+	os.WriteFile(filepath.Join(worktree, "package.json"), []byte("{}"), 0644)
+
+	data := Data{
+		TaskID:      "t-1",
+		WorktreeDir: worktree,
+		FailedAttempts: []Attempt{
+			{Time: time.Date(2026, 1, 2, 3, 4, 0, 0, time.UTC), Model: "flash", Outcome: "timed_out", Message: "idle timeout (10m0s)"},
+		},
+	}
+
+	got, err := Build("{{.TaskID}}|{{testCommand}}|{{failedAttempts}}|{{gitLog 5}}", data)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	want := "t-1|npm test|1. 2026-01-02 03:04 on flash: timed_out - idle timeout (10m0s)|"
+	if got != want {
+		t.Errorf("Build = %q, want %q", got, want)
+	}
+
+	data.TestCommand = "make check"
+	if got, _ := Build("{{testCommand}}", data); got != "make check" {
+		t.Errorf("configured test command: got %q", got)
+	}
+}
+
+func TestBuildDefaultTemplate(t *testing.T) {
+	got, err := Build("", Data{AgentName: "Agent 1", TaskID: "t-9", TaskContext: "ID: t-9"})
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if !strings.Contains(got, "You are Agent 1") || !strings.Contains(got, "Beads Task: t-9") {
+		t.Errorf("default template not rendered:\n%s", got)
+	}
+}
+
+func TestBuildFailureContext(t *testing.T) {
+	data := Data{AgentName: "Agent 1", TaskID: "t-9", TaskContext: "ID: t-9"}
+	if got, _ := Build("", data); strings.Contains(got, "PREVIOUS ATTEMPT FAILED") {
+		t.Errorf("first attempt has failure section:\n%s", got)
+	}
+
+	data.FailureReason = "exited without closing task"
+	data.FailureEvents = []string{`{"type":"tool_use"}`, `{"type":"result"}`}
+	data.DiscardedChanges = "+broken line"
+	data.TestOutput = "--- FAIL: TestParse"
+	data.TestCommand = "go test ./..."
+	got, err := Build("", data)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	for _, want := range []string{"PREVIOUS ATTEMPT FAILED", "exited without closing task", `{"type":"result"}`, "+broken line", "tests (go test ./...) failed", "--- FAIL: TestParse"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("retry directive missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestBuildAttemptChanges(t *testing.T) {
+	data := Data{AgentName: "Agent 1", TaskID: "t-9", TaskContext: "ID: t-9", FailureReason: "tests failed"}
+	data.DiscardedChanges = "+uncommitted only"
+	data.AttemptStat = " main.go | 2 +-"
+	data.AttemptChanges = "+committed and uncommitted"
+	got, err := Build("", data)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if !strings.Contains(got, " main.go | 2 +-") || !strings.Contains(got, "+committed and uncommitted") {
+		t.Errorf("retry directive missing the attempt's changes:\n%s", got)
+	}
+	if strings.Contains(got, "+uncommitted only") {
+		t.Errorf("discarded changes repeated alongside the attempt's:\n%s", got)
+	}
+}
+
+func TestBuildRepos(t *testing.T) {
+	data := Data{AgentName: "Agent 1", TaskID: "t-9", TaskContext: "ID: t-9"}
+	if got, _ := Build("", data); strings.Contains(got, "REPOSITORIES") {
+		t.Errorf("single-repo project has a repositories section:\n%s", got)
+	}
+
+	data.Repos = []Repo{{Name: "web", Dir: ".repos/web", Branch: "main", Description: "React frontend"}}
+	data.TaskRepo = "web"
+	got, err := Build("", data)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	for _, want := range []string{"- web: .repos/web (branch main) - React frontend", "This task belongs to the web repository"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("directive missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestBuildScope(t *testing.T) {
+	data := Data{AgentName: "Agent 1", TaskID: "t-9", TaskContext: "ID: t-9"}
+	if got, _ := Build("", data); strings.Contains(got, "=== SCOPE ===") {
+		t.Errorf("whole-repo project has a scope section:\n%s", got)
+	}
+	data.Scope = "services/payments"
+	got, err := Build("", data)
+	if err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+	if !strings.Contains(got, "the services/payments directory") {
+		t.Errorf("directive missing the scope:\n%s", got)
+	}
+}
+
+func TestBuildConflict(t *testing.T) {
+	got, err := BuildConflict(ConflictData{
+		AgentName:   "Agent 1",
+		TaskID:      "t-9",
+		TaskTitle:   "Add login",
+		Branch:      "main",
+		TaskBranch:  "machinator/t-9",
+		Files:       []string{"a.go", "b.go"},
+		Hunks:       "+<<<<<<< HEAD",
+		TestCommand: "make test",
+	})
+	if err != nil {
+		t.Fatalf("BuildConflict: %v", err)
+	}
+	for _, want := range []string{"machinator/t-9", "conflicts in: a.go, b.go", "`make test`", "+<<<<<<< HEAD"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("conflict directive missing %q:\n%s", want, got)
+		}
+	}
+}
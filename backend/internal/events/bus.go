@@ -0,0 +1,156 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// busQueueSize is how many events a subscriber may fall behind by before
+// new ones are dropped for it.
+const busQueueSize = 256
+
+// Bus carries the orchestrator's events to whoever subscribes: the TUI,
+// the event log, webhooks and desktop notifications, metrics. Publishers
+// don't know the consumers, so adding one is a Subscribe call. Each
+// subscriber has its own queue and goroutine, so a slow one holds up
+// neither the others nor the publisher.
+type Bus struct {
+	mu     sync.RWMutex
+	subs   []*subscriber
+	onDrop func(subscriber string, e Event)
+}
+
+type subscriber struct {
+	name    string
+	handle  func(Event)
+	queue   chan Event
+	pending atomic.Int64 // Queued or being handled
+}
+
+// NewBus creates a bus. onDrop, if set, is told about events dropped for a
+// subscriber whose queue is full.
+func NewBus(onDrop func(subscriber string, e Event)) *Bus {
+	return &Bus{onDrop: onDrop}
+}
+
+// Subscribe calls handle with every event published from now on, in
+// order, from a goroutine of its own. name identifies the subscriber in
+// drop reports.
+func (b *Bus) Subscribe(name string, handle func(Event)) {
+	s := &subscriber{name: name, handle: handle, queue: make(chan Event, busQueueSize)}
+	go func() {
+		for e := range s.queue {
+			s.handle(e)
+			s.pending.Add(-1)
+		}
+	}()
+	b.mu.Lock()
+	b.subs = append(b.subs, s)
+	b.mu.Unlock()
+}
+
+// Publish queues an event for every subscriber. Never blocks.
+func (b *Bus) Publish(e Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, s := range b.subs {
+		s.pending.Add(1)
+		select {
+		case s.queue <- e:
+		default:
+			s.pending.Add(-1)
+			if b.onDrop != nil {
+				b.onDrop(s.name, e)
+			}
+		}
+	}
+}
+
+// Flush waits up to timeout for every published event to be handled.
+// Reports whether they were.
+func (b *Bus) Flush(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		idle := true
+		b.mu.RLock()
+		for _, s := range b.subs {
+			if s.pending.Load() > 0 {
+				idle = false
+			}
+		}
+		b.mu.RUnlock()
+		if idle {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// LogPath is the event log, one JSON event per line.
+func LogPath(machinatorDir string) string {
+	return filepath.Join(machinatorDir, "logs", "events.jsonl")
+}
+
+// Appender returns a subscriber that appends events to the JSONL file at
+// path. Write errors go to onError.
+func Appender(path string, onError func(error)) func(Event) {
+	return func(e Event) {
+		if err := appendEvent(path, e); err != nil && onError != nil {
+			onError(fmt.Errorf("event log: %w", err))
+		}
+	}
+}
+
+func appendEvent(path string, e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// Counter counts events by type, for metrics.
+type Counter struct {
+	mu     sync.Mutex
+	counts map[Type]int64
+}
+
+// NewCounter creates an empty counter.
+func NewCounter() *Counter {
+	return &Counter{counts: make(map[Type]int64)}
+}
+
+// Count is a subscriber that counts e.
+func (c *Counter) Count(e Event) {
+	c.mu.Lock()
+	c.counts[e.Type]++
+	c.mu.Unlock()
+}
+
+// Counts returns a copy of the counts so far.
+func (c *Counter) Counts() map[Type]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counts := make(map[Type]int64, len(c.counts))
+	for t, n := range c.counts {
+		counts[t] = n
+	}
+	return counts
+}
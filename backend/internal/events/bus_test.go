@@ -0,0 +1,96 @@
+package events
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBusDeliversToEverySubscriber(t *testing.T) {
+	bus := NewBus(nil)
+	var mu sync.Mutex
+	got := make(map[string][]Type)
+	for _, name := range []string{"tui", "webhooks"} {
+		bus.Subscribe(name, func(e Event) {
+			mu.Lock()
+			got[name] = append(got[name], e.Type)
+			mu.Unlock()
+		})
+	}
+	counter := NewCounter()
+	bus.Subscribe("metrics", counter.Count)
+
+	bus.Publish(New(TaskAssigned, 1, "t-1", ""))
+	bus.Publish(New(TaskCompleted, 1, "t-1", ""))
+	bus.Publish(New(TaskCompleted, 2, "t-2", ""))
+	if !bus.Flush(time.Second) {
+		t.Fatal("Flush timed out")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, name := range []string{"tui", "webhooks"} {
+		if len(got[name]) != 3 || got[name][0] != TaskAssigned || got[name][2] != TaskCompleted {
+			t.Errorf("%s got %v", name, got[name])
+		}
+	}
+	if n := counter.Counts()[TaskCompleted]; n != 2 {
+		t.Errorf("counted %d task_completed, want 2", n)
+	}
+}
+
+func TestBusDropsForSlowSubscriber(t *testing.T) {
+	var dropped []string
+	var mu sync.Mutex
+	bus := NewBus(func(name string, e Event) {
+		mu.Lock()
+		dropped = append(dropped, name)
+		mu.Unlock()
+	})
+	release := make(chan struct{})
+	bus.Subscribe("stuck", func(Event) { <-release })
+	var fast atomic.Int64
+	bus.Subscribe("fast", func(Event) { fast.Add(1) })
+
+	// Keeping up with the fast subscriber while the stuck one's queue fills
+	total := busQueueSize + 5
+	for i := 1; i <= total; i++ {
+		bus.Publish(New(AgentReady, 1, "", ""))
+		for deadline := time.Now().Add(time.Second); fast.Load() < int64(i) && time.Now().Before(deadline); {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	close(release)
+	if !bus.Flush(time.Second) {
+		t.Fatal("Flush timed out")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if fast.Load() != int64(total) {
+		t.Errorf("fast subscriber got %d events, want %d", fast.Load(), total)
+	}
+	if len(dropped) == 0 || slices.ContainsFunc(dropped, func(name string) bool { return name != "stuck" }) {
+		t.Errorf("dropped for %v, want only the stuck subscriber", dropped)
+	}
+}
+
+func TestAppender(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "events.jsonl")
+	write := Appender(path, func(err error) { t.Error(err) })
+	write(New(TaskFailed, 3, "t-9", "exited"))
+	write(New(Stalled, 0, "", ""))
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"type":"task_failed"`) || !strings.Contains(lines[0], `"task_id":"t-9"`) {
+		t.Errorf("event log:\n%s", data)
+	}
+}
@@ -0,0 +1,70 @@
+package events
+
+import "time"
+
+// Type identifies what happened.
+type Type string
+
+const (
+	AgentReady   Type = "agent_ready"   // Setup finished, agent can take work
+	SetupFailed  Type = "setup_failed"  // Clone or worktree creation failed
+	TaskAssigned Type = "task_assigned" // Assigner gave a task to an agent
+	AgentRemoved Type = "agent_removed" // Autoscaling removed an idle agent
+
+	TaskCompleted Type = "task_completed" // Agent finished a task
+	TaskFailed    Type = "task_failed"    // Agent exited without finishing
+	TaskTimedOut  Type = "task_timed_out" // Agent killed for idle/max runtime
+	TaskAbandoned Type = "task_abandoned" // Task failed max_task_attempts times and was barred
+	MergeFailed   Type = "merge_failed"   // Completed task's branch needs merging by hand
+	AllTasksDone  Type = "all_tasks_done" // No ready tasks left and every agent is idle
+	Stalled       Type = "stalled"        // Open tasks remain but none can become ready
+	StaleClone    Type = "stale_clone"    // Project clone too far behind its remote to assign tasks
+	LowResources  Type = "low_resources"  // Free disk or battery below its safeguard, tasks held back
+
+	QuotaRefreshFailed Type = "quota_refresh_failed" // Quota fetch errored
+	QuotaExhausted     Type = "quota_exhausted"      // No quota left on any account
+
+	OrchestratorCrashed Type = "orchestrator_crashed" // Unrecovered panic, process is exiting
+)
+
+// Types are all the event types, in the order above.
+var Types = []Type{
+	AgentReady, SetupFailed, TaskAssigned, AgentRemoved,
+	TaskCompleted, TaskFailed, TaskTimedOut, TaskAbandoned, MergeFailed, AllTasksDone, Stalled, StaleClone, LowResources,
+	QuotaRefreshFailed, QuotaExhausted,
+	OrchestratorCrashed,
+}
+
+// Event is a single orchestrator occurrence delivered to subscribers.
+type Event struct {
+	Type    Type      `json:"type"`
+	Time    time.Time `json:"time"`
+	AgentID int       `json:"agent_id,omitempty"`
+	TaskID  string    `json:"task_id,omitempty"`
+	Message string    `json:"message,omitempty"`
+}
+
+// New creates an event stamped with the current time.
+func New(typ Type, agentID int, taskID, message string) Event {
+	return Event{
+		Type:    typ,
+		Time:    time.Now(),
+		AgentID: agentID,
+		TaskID:  taskID,
+		Message: message,
+	}
+}
+
+// IsFailure reports whether the event signals something went wrong.
+func (e Event) IsFailure() bool {
+	switch e.Type {
+	case SetupFailed, TaskFailed, TaskTimedOut, TaskAbandoned, MergeFailed, StaleClone, LowResources, QuotaRefreshFailed, QuotaExhausted, OrchestratorCrashed:
+		return true
+	}
+	return false
+}
+
+// IsCompletion reports whether the event signals finished work.
+func (e Event) IsCompletion() bool {
+	return e.Type == TaskCompleted || e.Type == AllTasksDone
+}
@@ -0,0 +1,68 @@
+// Package flaky tells flaky tests from failing ones by comparing runs of a
+// test command on the same code. Failed tests are recognized by name in the
+// output of go test, pytest, cargo test and jest/vitest.
+package flaky
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Run is one run of a test command.
+type Run struct {
+	Passed bool
+	Failed []string // Failed tests found in its output
+}
+
+// failPatterns find failed tests' names in test output.
+var failPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?m)^\s*--- FAIL: (\S+)`),                  // go test
+	regexp.MustCompile(`(?m)^FAILED (\S+::\S+)`),                   // pytest
+	regexp.MustCompile(`(?m)^test (\S+) \.\.\. FAILED\s*$`),        // cargo test
+	regexp.MustCompile(`(?m)^\s*[✕×] (.+?)(?: \(\d+ ?m?s\))?\s*$`), // jest, vitest
+}
+
+// FailedTests returns the names of the tests output reports failed, sorted.
+func FailedTests(output string) []string {
+	var names []string
+	for _, re := range failPatterns {
+		for _, m := range re.FindAllStringSubmatch(output, -1) {
+			names = append(names, strings.TrimSpace(m[1]))
+		}
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+// Compare sorts the tests that failed across runs of the same code into
+// those failing every run and flaky ones, which failed in some. ok reports
+// whether the code passes after all: some run passed, or every failure was
+// flaky. Runs that disagree without naming tests are ok with no flaky names.
+func Compare(runs []Run) (failing, flaky []string, ok bool) {
+	if len(runs) == 0 {
+		return nil, nil, true
+	}
+	counts := make(map[string]int)
+	passed, named := false, true
+	for _, r := range runs {
+		if r.Passed {
+			passed = true
+		} else if len(r.Failed) == 0 {
+			named = false // A failure we can't attribute to a test
+		}
+		for _, name := range r.Failed {
+			counts[name]++
+		}
+	}
+	for name, n := range counts {
+		if n == len(runs) {
+			failing = append(failing, name)
+		} else {
+			flaky = append(flaky, name)
+		}
+	}
+	slices.Sort(failing)
+	slices.Sort(flaky)
+	return failing, flaky, passed || (named && len(failing) == 0)
+}
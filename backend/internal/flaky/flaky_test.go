@@ -0,0 +1,46 @@
+package flaky
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFailedTests(t *testing.T) {
+	output := `=== RUN   TestParse
+--- FAIL: TestParse (0.00s)
+    --- FAIL: TestParse/empty (0.00s)
+FAIL
+FAILED tests/test_api.py::test_login - AssertionError
+test net::tests::retries ... FAILED
+test net::tests::connects ... ok
+  ✕ renders the header (12 ms)
+  ✓ renders the footer
+`
+	want := []string{"TestParse", "TestParse/empty", "net::tests::retries", "renders the header", "tests/test_api.py::test_login"}
+	if got := FailedTests(output); !slices.Equal(got, want) {
+		t.Errorf("FailedTests = %q, want %q", got, want)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name           string
+		runs           []Run
+		failing, flaky []string
+		ok             bool
+	}{
+		{"consistent", []Run{{Failed: []string{"A"}}, {Failed: []string{"A"}}}, []string{"A"}, nil, false},
+		{"passed on rerun", []Run{{Failed: []string{"A", "B"}}, {Passed: true}}, nil, []string{"A", "B"}, true},
+		{"different tests each run", []Run{{Failed: []string{"A"}}, {Failed: []string{"B"}}}, nil, []string{"A", "B"}, true},
+		{"one real failure", []Run{{Failed: []string{"A", "B"}}, {Failed: []string{"A"}}}, []string{"A"}, []string{"B"}, false},
+		{"unnamed failures", []Run{{}, {}}, nil, nil, false},
+		{"unnamed, then passed", []Run{{}, {Passed: true}}, nil, nil, true},
+		{"unnamed and named", []Run{{}, {Failed: []string{"A"}}}, nil, []string{"A"}, false},
+	}
+	for _, tt := range tests {
+		failing, flaky, ok := Compare(tt.runs)
+		if !slices.Equal(failing, tt.failing) || !slices.Equal(flaky, tt.flaky) || ok != tt.ok {
+			t.Errorf("%s: Compare = %q, %q, %v; want %q, %q, %v", tt.name, failing, flaky, ok, tt.failing, tt.flaky, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+// Package forge talks to the code host behind a project's remote: opening
+// pull/merge requests, reading CI status and commenting. GitHub, GitLab and
+// Bitbucket Cloud are supported.
+package forge
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Forge kinds.
+const (
+	GitHub    = "github"
+	GitLab    = "gitlab"
+	Bitbucket = "bitbucket"
+)
+
+// CI states, normalized across forges.
+const (
+	StatusNone    = "none" // No CI has reported on the commit
+	StatusPending = "pending"
+	StatusSuccess = "success"
+	StatusFailure = "failure"
+)
+
+// Forge is one code host's API for a single repository.
+type Forge interface {
+	// CreatePR opens a pull (or merge) request from head into base.
+	CreatePR(pr PR) (*PullRequest, error)
+	// CIStatus returns the combined CI state of a commit.
+	CIStatus(sha string) (string, error)
+	// Comment adds a comment to a pull request.
+	Comment(number int, body string) error
+	// Kind returns GitHub, GitLab or Bitbucket.
+	Kind() string
+}
+
+// PR describes a pull request to open.
+type PR struct {
+	Title string
+	Body  string
+	Head  string // Source branch
+	Base  string // Target branch
+}
+
+// PullRequest is an opened pull request.
+type PullRequest struct {
+	Number int    `json:"number"` // GitLab's iid, Bitbucket's id
+	URL    string `json:"url"`
+}
+
+// Options selects and configures a forge.
+type Options struct {
+	Kind    string // Empty detects from the remote host
+	Remote  string // Repo URL, e.g. git@gitlab.com:group/repo.git
+	BaseURL string // API base; empty uses the public host's
+	Token   string // Empty reads EnvToken(kind)
+}
+
+// New returns the forge for a repository.
+func New(opts Options) (Forge, error) {
+	host, path, err := ParseRemote(opts.Remote)
+	if err != nil {
+		return nil, err
+	}
+	kind := strings.ToLower(opts.Kind)
+	if kind == "" {
+		if kind = Detect(host); kind == "" {
+			return nil, fmt.Errorf("can't tell which forge hosts %s; set forge in the project config", host)
+		}
+	}
+
+	if opts.Token == "" {
+		opts.Token = os.Getenv(EnvToken(kind))
+	}
+
+	c := &client{base: strings.TrimSuffix(opts.BaseURL, "/"), token: opts.Token, http: &http.Client{Timeout: 30 * time.Second}}
+	switch kind {
+	case GitHub:
+		if c.base == "" {
+			c.base = "https://api.github.com"
+			if host != "github.com" {
+				c.base = "https://" + host + "/api/v3" // GitHub Enterprise
+			}
+		}
+		return &github{client: c, repo: path}, nil
+	case GitLab:
+		if c.base == "" {
+			c.base = "https://" + host + "/api/v4"
+		}
+		c.setHeader = func(h http.Header, token string) { h.Set("PRIVATE-TOKEN", token) }
+		return &gitlab{client: c, project: url.PathEscape(path)}, nil
+	case Bitbucket:
+		if c.base == "" {
+			c.base = "https://api.bitbucket.org/2.0"
+		}
+		return &bitbucket{client: c, repo: path}, nil
+	default:
+		return nil, fmt.Errorf("unknown forge %q (want %q, %q, or %q)", opts.Kind, GitHub, GitLab, Bitbucket)
+	}
+}
+
+// Detect guesses the forge from a remote's host, or returns "".
+func Detect(host string) string {
+	host = strings.ToLower(host)
+	switch {
+	case host == "github.com" || strings.HasPrefix(host, "github."):
+		return GitHub
+	case host == "gitlab.com" || strings.HasPrefix(host, "gitlab."):
+		return GitLab
+	case host == "bitbucket.org":
+		return Bitbucket
+	}
+	return ""
+}
+
+// ParseRemote splits a git remote into host and repository path
+// ("owner/repo", or "group/subgroup/repo" on GitLab). Accepts https, ssh://
+// and scp-style (git@host:owner/repo) URLs.
+func ParseRemote(remote string) (host, path string, err error) {
+	switch {
+	case strings.Contains(remote, "://"):
+		u, err := url.Parse(remote)
+		if err != nil {
+			return "", "", fmt.Errorf("bad remote %q: %w", remote, err)
+		}
+		host, path = u.Hostname(), u.Path
+	case strings.Contains(remote, ":"):
+		at := strings.LastIndex(remote[:strings.Index(remote, ":")], "@")
+		host, path, _ = strings.Cut(remote[at+1:], ":")
+	}
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	if host == "" || !strings.Contains(path, "/") {
+		return "", "", fmt.Errorf("bad remote %q: want host and owner/repo", remote)
+	}
+	return host, path, nil
+}
+
+// EnvToken returns the token environment variable for a forge kind.
+func EnvToken(kind string) string {
+	switch kind {
+	case GitLab:
+		return "GITLAB_TOKEN"
+	case Bitbucket:
+		return "BITBUCKET_TOKEN"
+	default:
+		return "GITHUB_TOKEN"
+	}
+}
+
+// client sends JSON requests to a forge API.
+type client struct {
+	base      string
+	token     string
+	http      *http.Client
+	setHeader func(h http.Header, token string) // Auth header; Bearer when nil
+}
+
+// do sends in as JSON (if not nil) and decodes the response into out (if not nil).
+func (c *client) do(method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.base+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		if c.setHeader != nil {
+			c.setHeader(req.Header, c.token)
+		} else {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
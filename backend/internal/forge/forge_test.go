@@ -0,0 +1,166 @@
+package forge
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseRemote(t *testing.T) {
+	tests := []struct {
+		remote, host, path string
+	}{
+		{"https://github.com/user/repo", "github.com", "user/repo"},
+		{"https://github.com/user/repo.git", "github.com", "user/repo"},
+		{"git@github.com:user/repo.git", "github.com", "user/repo"},
+		{"ssh://git@gitlab.com/group/sub/repo.git", "gitlab.com", "group/sub/repo"},
+		{"git@bitbucket.org:team/repo", "bitbucket.org", "team/repo"},
+	}
+	for _, tt := range tests {
+		host, path, err := ParseRemote(tt.remote)
+		if err != nil || host != tt.host || path != tt.path {
+			t.Errorf("ParseRemote(%q) = %q, %q, %v; want %q, %q", tt.remote, host, path, err, tt.host, tt.path)
+		}
+	}
+
+	for _, bad := range []string{"", "/local/repo", "https://github.com/justuser"} {
+		if _, _, err := ParseRemote(bad); err == nil {
+			t.Errorf("ParseRemote(%q) accepted a bad remote", bad)
+		}
+	}
+}
+
+func TestNewSelectsForge(t *testing.T) {
+	tests := []struct {
+		kind, remote, want string
+	}{
+		{"", "git@github.com:user/repo.git", GitHub},
+		{"", "https://gitlab.com/group/repo", GitLab},
+		{"", "git@bitbucket.org:team/repo.git", Bitbucket},
+		{"GitLab", "https://git.example.com/group/repo", GitLab},
+	}
+	for _, tt := range tests {
+		f, err := New(Options{Kind: tt.kind, Remote: tt.remote})
+		if err != nil || f.Kind() != tt.want {
+			t.Errorf("New(%q, %q) = %v, %v; want %s", tt.kind, tt.remote, f, err, tt.want)
+		}
+	}
+
+	if _, err := New(Options{Remote: "https://git.example.com/group/repo"}); err == nil {
+		t.Error("New detected a forge for an unknown host")
+	}
+	if _, err := New(Options{Kind: "gitea", Remote: "https://git.example.com/group/repo"}); err == nil {
+		t.Error("New accepted an unknown forge kind")
+	}
+}
+
+// recorded is one request seen by the fake forge server.
+type recorded struct {
+	method, uri, auth string
+	body              map[string]any
+}
+
+// fakeForge answers every request with the response for its path and
+// records what was sent.
+func fakeForge(t *testing.T, responses map[string]string) (*httptest.Server, *[]recorded) {
+	var reqs []recorded
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := recorded{method: r.Method, uri: r.RequestURI, auth: r.Header.Get("Authorization") + r.Header.Get("PRIVATE-TOKEN")}
+		json.NewDecoder(r.Body).Decode(&rec.body)
+		reqs = append(reqs, rec)
+		resp, ok := responses[r.URL.EscapedPath()]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(resp))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &reqs
+}
+
+func TestGitHub(t *testing.T) {
+	srv, reqs := fakeForge(t, map[string]string{
+		"/repos/user/repo/pulls":              `{"number": 7, "html_url": "https://github.com/user/repo/pull/7"}`,
+		"/repos/user/repo/commits/abc/status": `{"state": "failure", "total_count": 2}`,
+		"/repos/user/repo/issues/7/comments":  `{}`,
+	})
+	f, err := New(Options{Remote: "git@github.com:user/repo.git", BaseURL: srv.URL, Token: "tok"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pr, err := f.CreatePR(PR{Title: "T", Body: "B", Head: "agent-1", Base: "main"})
+	if err != nil || pr.Number != 7 || pr.URL != "https://github.com/user/repo/pull/7" {
+		t.Fatalf("CreatePR = %+v, %v", pr, err)
+	}
+	if got := (*reqs)[0]; got.auth != "Bearer tok" || got.body["head"] != "agent-1" || got.body["base"] != "main" {
+		t.Errorf("CreatePR sent %+v", got)
+	}
+	if status, err := f.CIStatus("abc"); err != nil || status != StatusFailure {
+		t.Errorf("CIStatus = %q, %v; want %q", status, err, StatusFailure)
+	}
+	if err := f.Comment(7, "done"); err != nil || (*reqs)[2].body["body"] != "done" {
+		t.Errorf("Comment = %v, sent %+v", err, (*reqs)[2])
+	}
+}
+
+func TestGitLab(t *testing.T) {
+	srv, reqs := fakeForge(t, map[string]string{
+		"/projects/group%2Fsub%2Frepo/merge_requests":         `{"iid": 3, "web_url": "https://gitlab.com/group/sub/repo/-/merge_requests/3"}`,
+		"/projects/group%2Fsub%2Frepo/pipelines":              `[{"status": "running"}]`,
+		"/projects/group%2Fsub%2Frepo/merge_requests/3/notes": `{}`,
+	})
+	f, err := New(Options{Remote: "https://gitlab.com/group/sub/repo.git", BaseURL: srv.URL, Token: "tok"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pr, err := f.CreatePR(PR{Title: "T", Body: "B", Head: "agent-1", Base: "main"})
+	if err != nil || pr.Number != 3 {
+		t.Fatalf("CreatePR = %+v, %v", pr, err)
+	}
+	if got := (*reqs)[0]; got.auth != "tok" || got.body["source_branch"] != "agent-1" || got.body["target_branch"] != "main" {
+		t.Errorf("CreatePR sent %+v", got)
+	}
+	if status, err := f.CIStatus("abc"); err != nil || status != StatusPending {
+		t.Errorf("CIStatus = %q, %v; want %q", status, err, StatusPending)
+	}
+	if got := (*reqs)[1].uri; got != "/projects/group%2Fsub%2Frepo/pipelines?per_page=1&sha=abc" {
+		t.Errorf("CIStatus requested %s", got)
+	}
+	if err := f.Comment(3, "done"); err != nil {
+		t.Errorf("Comment = %v", err)
+	}
+}
+
+func TestBitbucket(t *testing.T) {
+	srv, reqs := fakeForge(t, map[string]string{
+		"/repositories/team/repo/pullrequests":            `{"id": 9, "links": {"html": {"href": "https://bitbucket.org/team/repo/pull-requests/9"}}}`,
+		"/repositories/team/repo/commit/abc/statuses":     `{"values": [{"state": "SUCCESSFUL"}, {"state": "SUCCESSFUL"}]}`,
+		"/repositories/team/repo/pullrequests/9/comments": `{}`,
+	})
+	f, err := New(Options{Remote: "git@bitbucket.org:team/repo.git", BaseURL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pr, err := f.CreatePR(PR{Title: "T", Head: "agent-1", Base: "main"})
+	if err != nil || pr.Number != 9 || pr.URL != "https://bitbucket.org/team/repo/pull-requests/9" {
+		t.Fatalf("CreatePR = %+v, %v", pr, err)
+	}
+	source, _ := (*reqs)[0].body["source"].(map[string]any)
+	if branch, _ := source["branch"].(map[string]any); branch["name"] != "agent-1" {
+		t.Errorf("CreatePR sent %+v", (*reqs)[0].body)
+	}
+	if status, err := f.CIStatus("abc"); err != nil || status != StatusSuccess {
+		t.Errorf("CIStatus = %q, %v; want %q", status, err, StatusSuccess)
+	}
+	if err := f.Comment(9, "done"); err != nil {
+		t.Errorf("Comment = %v", err)
+	}
+	if _, err := f.CIStatus("missing"); err == nil {
+		t.Error("CIStatus ignored an error response")
+	}
+}
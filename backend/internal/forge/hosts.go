@@ -0,0 +1,175 @@
+package forge
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// github implements Forge for GitHub and GitHub Enterprise.
+type github struct {
+	*client
+	repo string // owner/repo
+}
+
+func (g *github) Kind() string { return GitHub }
+
+func (g *github) CreatePR(pr PR) (*PullRequest, error) {
+	var resp struct {
+		Number  int    `json:"number"`
+		HTMLURL string `json:"html_url"`
+	}
+	err := g.do(http.MethodPost, "/repos/"+g.repo+"/pulls", map[string]string{
+		"title": pr.Title,
+		"body":  pr.Body,
+		"head":  pr.Head,
+		"base":  pr.Base,
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return &PullRequest{Number: resp.Number, URL: resp.HTMLURL}, nil
+}
+
+func (g *github) CIStatus(sha string) (string, error) {
+	var resp struct {
+		State      string `json:"state"`
+		TotalCount int    `json:"total_count"`
+	}
+	if err := g.do(http.MethodGet, "/repos/"+g.repo+"/commits/"+url.PathEscape(sha)+"/status", nil, &resp); err != nil {
+		return "", err
+	}
+	if resp.TotalCount == 0 {
+		return StatusNone, nil
+	}
+	switch resp.State {
+	case "success":
+		return StatusSuccess, nil
+	case "failure", "error":
+		return StatusFailure, nil
+	default:
+		return StatusPending, nil
+	}
+}
+
+func (g *github) Comment(number int, body string) error {
+	return g.do(http.MethodPost, fmt.Sprintf("/repos/%s/issues/%d/comments", g.repo, number), map[string]string{"body": body}, nil)
+}
+
+// gitlab implements Forge for gitlab.com and self-hosted GitLab.
+type gitlab struct {
+	*client
+	project string // URL-escaped group/repo path
+}
+
+func (g *gitlab) Kind() string { return GitLab }
+
+func (g *gitlab) CreatePR(pr PR) (*PullRequest, error) {
+	var resp struct {
+		IID    int    `json:"iid"`
+		WebURL string `json:"web_url"`
+	}
+	err := g.do(http.MethodPost, "/projects/"+g.project+"/merge_requests", map[string]string{
+		"title":         pr.Title,
+		"description":   pr.Body,
+		"source_branch": pr.Head,
+		"target_branch": pr.Base,
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return &PullRequest{Number: resp.IID, URL: resp.WebURL}, nil
+}
+
+func (g *gitlab) CIStatus(sha string) (string, error) {
+	var pipelines []struct {
+		Status string `json:"status"`
+	}
+	if err := g.do(http.MethodGet, "/projects/"+g.project+"/pipelines?per_page=1&sha="+url.QueryEscape(sha), nil, &pipelines); err != nil {
+		return "", err
+	}
+	if len(pipelines) == 0 {
+		return StatusNone, nil
+	}
+	switch pipelines[0].Status {
+	case "success":
+		return StatusSuccess, nil
+	case "failed", "canceled":
+		return StatusFailure, nil
+	case "skipped":
+		return StatusNone, nil
+	default:
+		return StatusPending, nil
+	}
+}
+
+func (g *gitlab) Comment(number int, body string) error {
+	return g.do(http.MethodPost, fmt.Sprintf("/projects/%s/merge_requests/%d/notes", g.project, number), map[string]string{"body": body}, nil)
+}
+
+// bitbucket implements Forge for Bitbucket Cloud.
+type bitbucket struct {
+	*client
+	repo string // workspace/repo
+}
+
+func (b *bitbucket) Kind() string { return Bitbucket }
+
+type bitbucketBranch struct {
+	Branch struct {
+		Name string `json:"name"`
+	} `json:"branch"`
+}
+
+func (b *bitbucket) CreatePR(pr PR) (*PullRequest, error) {
+	req := struct {
+		Title       string          `json:"title"`
+		Description string          `json:"description"`
+		Source      bitbucketBranch `json:"source"`
+		Destination bitbucketBranch `json:"destination"`
+	}{Title: pr.Title, Description: pr.Body}
+	req.Source.Branch.Name = pr.Head
+	req.Destination.Branch.Name = pr.Base
+
+	var resp struct {
+		ID    int `json:"id"`
+		Links struct {
+			HTML struct {
+				Href string `json:"href"`
+			} `json:"html"`
+		} `json:"links"`
+	}
+	if err := b.do(http.MethodPost, "/repositories/"+b.repo+"/pullrequests", req, &resp); err != nil {
+		return nil, err
+	}
+	return &PullRequest{Number: resp.ID, URL: resp.Links.HTML.Href}, nil
+}
+
+func (b *bitbucket) CIStatus(sha string) (string, error) {
+	var resp struct {
+		Values []struct {
+			State string `json:"state"`
+		} `json:"values"`
+	}
+	if err := b.do(http.MethodGet, "/repositories/"+b.repo+"/commit/"+url.PathEscape(sha)+"/statuses", nil, &resp); err != nil {
+		return "", err
+	}
+	if len(resp.Values) == 0 {
+		return StatusNone, nil
+	}
+	status := StatusSuccess
+	for _, v := range resp.Values {
+		switch v.State {
+		case "FAILED", "STOPPED":
+			return StatusFailure, nil
+		case "INPROGRESS":
+			status = StatusPending
+		}
+	}
+	return status, nil
+}
+
+func (b *bitbucket) Comment(number int, body string) error {
+	req := map[string]map[string]string{"content": {"raw": body}}
+	return b.do(http.MethodPost, fmt.Sprintf("/repositories/%s/pullrequests/%d/comments", b.repo, number), req, nil)
+}
@@ -0,0 +1,210 @@
+// Package history reads the full event history of a MACHINATOR_DIR back
+// from disk: orchestrator log lines (logs/main.log) and agent events
+// (transcripts/*.jsonl). The TUI only keeps a window of recent entries in
+// memory; history is how older ones are found.
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/transcript"
+)
+
+// Record is one entry of the history.
+type Record struct {
+	Time   time.Time
+	Source string // Log source ("assign", "agent-2", ...) or "transcript"
+	Agent  int    // 0 when not tied to an agent
+	TaskID string // Set for transcript events
+	Type   string // Event type for transcript events (tool_use, message, ...)
+	Tool   string // Tool name for tool events
+	Text   string
+}
+
+// logTimeFormat matches the timestamp written by tui.FileLogger.
+const logTimeFormat = "2006-01-02 15:04:05"
+
+// Load reads every log line and transcript event, oldest first.
+func Load(machinatorDir string) ([]Record, error) {
+	records, err := loadLog(filepath.Join(machinatorDir, "logs", "main.log"))
+	if err != nil {
+		return nil, err
+	}
+
+	paths, _ := filepath.Glob(filepath.Join(transcript.Dir(machinatorDir), "*.jsonl"))
+	for _, path := range paths {
+		taskID := strings.TrimSuffix(filepath.Base(path), ".jsonl")
+		entries, err := transcript.Load(machinatorDir, taskID)
+		if err != nil && len(entries) == 0 {
+			continue // Skip unreadable transcripts rather than hide everything
+		}
+		for _, e := range entries {
+			records = append(records, fromEntry(taskID, e))
+		}
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Time.Before(records[j].Time)
+	})
+	return records, nil
+}
+
+// loadLog parses lines written by tui.FileLogger:
+// "2006-01-02 15:04:05 [source] message".
+func loadLog(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []Record
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for sc.Scan() {
+		r, ok := ParseLogLine(sc.Text())
+		if !ok {
+			// Continuation of a multi-line message (e.g. a stack trace)
+			if n := len(records); n > 0 {
+				records[n-1].Text += "\n" + sc.Text()
+			}
+			continue
+		}
+		records = append(records, r)
+	}
+	return records, sc.Err()
+}
+
+// ParseLogLine parses one line written by tui.FileLogger. Returns false
+// for lines without a timestamp, such as the rest of a multi-line message.
+func ParseLogLine(line string) (Record, bool) {
+	if len(line) < len(logTimeFormat)+1 {
+		return Record{}, false
+	}
+	t, err := time.ParseInLocation(logTimeFormat, line[:len(logTimeFormat)], time.Local)
+	if err != nil {
+		return Record{}, false
+	}
+	rest := line[len(logTimeFormat)+1:]
+	source, msg := "", rest
+	if strings.HasPrefix(rest, "[") {
+		if end := strings.Index(rest, "] "); end > 0 {
+			source, msg = rest[1:end], rest[end+2:]
+		}
+	}
+	return Record{Time: t, Source: source, Agent: agentOf(source), Text: msg}, true
+}
+
+func fromEntry(taskID string, e transcript.Entry) Record {
+	r := Record{
+		Time:   e.Time,
+		Source: "transcript",
+		Agent:  e.Agent,
+		TaskID: taskID,
+		Text:   transcript.Summary(e),
+	}
+	var v struct {
+		Type     string `json:"type"`
+		ToolName string `json:"tool_name"`
+	}
+	if json.Unmarshal(e.Event, &v) == nil {
+		r.Type, r.Tool = v.Type, v.ToolName
+	} else {
+		r.Type = "output"
+	}
+	return r
+}
+
+// agentOf returns N for an "agent-N" source.
+func agentOf(source string) int {
+	n, err := strconv.Atoi(strings.TrimPrefix(source, "agent-"))
+	if err != nil || !strings.HasPrefix(source, "agent-") {
+		return 0
+	}
+	return n
+}
+
+// Query selects records. Zero fields match everything.
+type Query struct {
+	Text   string // Case-insensitive substring of Text
+	Agent  int
+	Type   string
+	Tool   string
+	Source string
+	TaskID string
+}
+
+// ParseQuery reads a search like "agent:2 type:tool_use failed to build".
+// Recognized filters are agent:, type:, tool:, source: and task:; the
+// remaining words are the text to find.
+func ParseQuery(s string) Query {
+	var q Query
+	var words []string
+	for _, word := range strings.Fields(s) {
+		key, value, ok := strings.Cut(word, ":")
+		if !ok || value == "" {
+			words = append(words, word)
+			continue
+		}
+		switch strings.ToLower(key) {
+		case "agent":
+			if n, err := strconv.Atoi(value); err == nil {
+				q.Agent = n
+				continue
+			}
+		case "type":
+			q.Type = value
+			continue
+		case "tool":
+			q.Tool = value
+			continue
+		case "source":
+			q.Source = value
+			continue
+		case "task":
+			q.TaskID = value
+			continue
+		}
+		words = append(words, word)
+	}
+	q.Text = strings.Join(words, " ")
+	return q
+}
+
+// Match reports whether a record satisfies every part of the query.
+func (q Query) Match(r Record) bool {
+	switch {
+	case q.Agent != 0 && r.Agent != q.Agent:
+		return false
+	case q.Type != "" && !strings.EqualFold(r.Type, q.Type):
+		return false
+	case q.Tool != "" && !strings.EqualFold(r.Tool, q.Tool):
+		return false
+	case q.Source != "" && !strings.EqualFold(r.Source, q.Source):
+		return false
+	case q.TaskID != "" && r.TaskID != q.TaskID:
+		return false
+	}
+	return q.Text == "" || strings.Contains(strings.ToLower(r.Text), strings.ToLower(q.Text))
+}
+
+// Search returns the records matching q, oldest first.
+func Search(records []Record, q Query) []Record {
+	var out []Record
+	for _, r := range records {
+		if q.Match(r) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
@@ -0,0 +1,45 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	q := ParseQuery("agent:2 type:tool_use build failed tool:run_shell_command http://x")
+	want := Query{Text: "build failed http://x", Agent: 2, Type: "tool_use", Tool: "run_shell_command"}
+	if q != want {
+		t.Errorf("ParseQuery = %+v, want %+v", q, want)
+	}
+}
+
+func TestLoadAndSearch(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "logs"), 0755)
+	os.MkdirAll(filepath.Join(dir, "transcripts"), 0755)
+	os.WriteFile(filepath.Join(dir, "logs", "main.log"), []byte(
+		"2026-01-02 10:00:00 [assign] Agent 2: ASSIGNED t-1\n"+
+			"2026-01-02 10:05:00 [agent-2] t-1 exited: Build Failed\n"+
+			"goroutine 1 [running]:\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "transcripts", "t-1.jsonl"), []byte(
+		`{"time":"2026-01-02T10:01:00Z","agent":2,"run":1,"event":{"type":"tool_use","tool_name":"run_shell_command","parameters":{"command":"make"}}}`+"\n"), 0644)
+
+	records, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want 3", len(records))
+	}
+
+	if got := Search(records, ParseQuery("agent:2 build failed")); len(got) != 1 || got[0].Source != "agent-2" {
+		t.Errorf("text search: %+v", got)
+	}
+	if got := Search(records, ParseQuery("tool:run_shell_command")); len(got) != 1 || got[0].TaskID != "t-1" {
+		t.Errorf("tool search: %+v", got)
+	}
+	if got := Search(records, ParseQuery("running")); len(got) != 1 {
+		t.Errorf("continuation lines not searchable: %+v", got)
+	}
+}
@@ -0,0 +1,204 @@
+package mock
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/beads"
+	"github.com/bryantinsley/machinator/backend/internal/project"
+	"github.com/bryantinsley/machinator/backend/internal/setup"
+	"github.com/bryantinsley/machinator/backend/internal/tools"
+)
+
+// StepDelay is how long the mock gemini pauses between events, so a run
+// lasts long enough to watch.
+var StepDelay = 2 * time.Second
+
+// mockTokens is the token count the mock gemini reports for a task.
+const mockTokens = 12000
+
+// publishAttempts bounds how often the mock gemini redoes its work on top
+// of what other agents pushed meanwhile.
+const publishAttempts = 5
+
+// Quota is the fraction of quota the mock gemini reports left per model.
+var Quota = map[string]float64{
+	project.DefaultSimpleModel:  0.9,
+	project.DefaultComplexModel: 0.75,
+}
+
+// taskLine finds the task a directive assigns, e.g. "Your goal is to
+// execute Beads Task: demo-1".
+var taskLine = regexp.MustCompile(`Your goal is to execute .*?: (\S+)`)
+
+// Gemini runs the mock gemini with args and returns its exit code. It
+// answers --version and --dump-quota; given a directive, it streams
+// stream-json events like the real CLI, writes a file for the task,
+// closes it with bd, then commits and pushes. With ScenarioEnv set, it
+// plays that scenario instead.
+func Gemini(args []string, stdout, stderr io.Writer) int {
+	prompt, model := "", ""
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--version":
+			fmt.Fprintln(stdout, "0.0.0-mock")
+			return 0
+		case "--dump-quota":
+			var buckets []map[string]any
+			for model, left := range Quota {
+				buckets = append(buckets, map[string]any{"modelId": model, "remainingFraction": left})
+			}
+			json.NewEncoder(stdout).Encode(map[string]any{"buckets": buckets})
+			return 0
+		case "--model", "--output-format", "--include-directories":
+			if i+1 < len(args) && args[i] == "--model" {
+				model = args[i+1]
+			}
+			i++
+		default:
+			if !strings.HasPrefix(args[i], "--") {
+				prompt = args[i]
+			}
+		}
+	}
+
+	if path := os.Getenv(ScenarioEnv); path != "" {
+		s, err := LoadScenario(path)
+		if err != nil {
+			fmt.Fprintf(stderr, "mock gemini: %v\n", err)
+			return 1
+		}
+		return s.play(prompt, stdout, stderr)
+	}
+
+	emit := func(event map[string]any) {
+		event["timestamp"] = time.Now().UTC().Format(time.RFC3339Nano)
+		line, _ := json.Marshal(event)
+		fmt.Fprintln(stdout, string(line))
+	}
+	emit(map[string]any{"type": "init", "model": model})
+
+	m := taskLine.FindStringSubmatch(prompt)
+	if m == nil {
+		emit(map[string]any{"type": "message", "role": "assistant", "content": "Mock gemini: no task in this prompt, nothing to do."})
+		emit(map[string]any{"type": "result", "status": "success"})
+		return 0
+	}
+	taskID := m[1]
+	title := taskTitle(taskID)
+
+	time.Sleep(StepDelay)
+	emit(map[string]any{"type": "message", "role": "assistant", "content": fmt.Sprintf("Working on %s: %s", taskID, title)})
+	time.Sleep(StepDelay)
+	emit(map[string]any{"type": "tool_use", "tool_name": "read_file", "parameters": map[string]string{"path": "README.md"}})
+	emit(map[string]any{"type": "tool_result", "status": "success", "output": "(mock) read README.md"})
+	time.Sleep(StepDelay)
+
+	file := filepath.Join("work", taskID+".md")
+	emit(map[string]any{"type": "tool_use", "tool_name": "write_file", "parameters": map[string]string{"path": file}})
+	if err := publish(taskID, title, file); err != nil {
+		emit(map[string]any{"type": "tool_result", "status": "error", "output": err.Error()})
+		emit(map[string]any{"type": "result", "status": "error"})
+		fmt.Fprintf(stderr, "mock gemini: %v\n", err)
+		return 1
+	}
+	emit(map[string]any{"type": "tool_result", "status": "success", "output": "(mock) wrote " + file})
+	time.Sleep(StepDelay)
+	emit(map[string]any{"type": "message", "role": "assistant", "content": fmt.Sprintf("Closed %s and pushed the work.", taskID)})
+	emit(map[string]any{"type": "result", "status": "success", "stats": map[string]int{"total_tokens": mockTokens}})
+	return 0
+}
+
+// taskTitle is the title of a task in the worktree, or its ID if it can't
+// be found.
+func taskTitle(taskID string) string {
+	if tasks, err := beads.LoadTasks("."); err == nil {
+		for _, t := range tasks {
+			if t.ID == taskID {
+				return t.Title
+			}
+		}
+	}
+	return taskID
+}
+
+// publish does the task's work, closes it with bd, and commits and pushes
+// both, starting over on top of the latest branch when a push is refused.
+func publish(taskID, title, file string) error {
+	git := func(args ...string) error {
+		out, err := tools.Command(tools.Git, args...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+	branch := currentBranch()
+
+	var err error
+	for attempt := 0; attempt < publishAttempts; attempt++ {
+		if attempt > 0 {
+			if err := git("fetch", "-q", "origin"); err != nil {
+				return err
+			}
+			if err := git("reset", "-q", "--hard", "origin/"+branch); err != nil {
+				return err
+			}
+		}
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return err
+		}
+		body := fmt.Sprintf("# %s\n\n%s\n\nDone by the mock gemini at %s.\n", taskID, title, time.Now().Format(time.RFC3339))
+		if err := os.WriteFile(file, []byte(body), 0644); err != nil {
+			return err
+		}
+		if code := beads.Native(".", []string{"close", taskID, "--reason", "Done (mock)"}, io.Discard, io.Discard); code != 0 {
+			return fmt.Errorf("bd close %s failed", taskID)
+		}
+		if err := git("add", "-A"); err != nil {
+			return err
+		}
+		if err := git("commit", "-q", "-m", fmt.Sprintf("%s: %s", taskID, title)); err != nil {
+			return err
+		}
+		if err = git("push", "-q", "origin", "HEAD:"+branch); err == nil {
+			syncClone(branch)
+			return nil
+		}
+	}
+	return err
+}
+
+// syncClone does what bd's daemon would for the project clone behind the
+// worktree, when it has branch checked out: brings it up to date, so the
+// task the agent closed stops being ready before the agent exits. Best
+// effort, as a sandbox may not let the checkout be written; Daemon catches
+// up then.
+func syncClone(branch string) {
+	out, err := tools.Command(tools.Git, "rev-parse", "--path-format=absolute", "--git-common-dir").Output()
+	if err != nil {
+		return
+	}
+	repoDir := filepath.Dir(strings.TrimSpace(string(out)))
+	if out, err := tools.Command(tools.Git, "-C", repoDir, "symbolic-ref", "-q", "--short", "HEAD").Output(); err != nil || strings.TrimSpace(string(out)) != branch {
+		return
+	}
+	setup.SyncRepo(repoDir, branch)
+}
+
+// currentBranch is the branch the worktree is on or, detached, the
+// remote's default branch.
+func currentBranch() string {
+	if out, err := tools.Command(tools.Git, "symbolic-ref", "-q", "--short", "HEAD").Output(); err == nil {
+		return strings.TrimSpace(string(out))
+	}
+	if out, err := tools.Command(tools.Git, "symbolic-ref", "-q", "--short", "refs/remotes/origin/HEAD").Output(); err == nil {
+		return strings.TrimPrefix(strings.TrimSpace(string(out)), "origin/")
+	}
+	return "main"
+}
@@ -0,0 +1,137 @@
+// Package mock provides stand-ins for gemini and bd, and a fixture project
+// for them to work on, so the orchestrator can run end to end without
+// accounts, quota or a real repository. The machinator binary serves both
+// tools itself, behind wrapper scripts the fixture installs.
+package mock
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/beads"
+	"github.com/bryantinsley/machinator/backend/internal/setup"
+	"github.com/bryantinsley/machinator/backend/internal/tools"
+)
+
+// GeminiCommand is the hidden command the gemini wrapper script runs.
+const GeminiCommand = "mock-gemini"
+
+// ProjectID is the fixture's project, FixtureBranch its branch.
+const (
+	ProjectID     = "1"
+	FixtureBranch = "main"
+)
+
+// SyncInterval is how often Daemon syncs the project clone.
+var SyncInterval = 2 * time.Second
+
+// fixtureTasks are the fixture's beads: a few independent tasks, a chain of
+// dependencies and a complex one, so assignment, blocking and model choice
+// all show.
+var fixtureTasks = []beads.Task{
+	{ID: "demo-1", Title: "Write the project README", Priority: 1},
+	{ID: "demo-2", Title: "Add a greeting module", Priority: 2},
+	{ID: "demo-3", Title: "Test the greeting module", Priority: 2, BlockedBy: []string{"demo-2"}},
+	{ID: "demo-4", Title: "Design the plugin system", Priority: 1, Description: beads.ComplexTag},
+	{ID: "demo-5", Title: "Document the plugin system", Priority: 3, BlockedBy: []string{"demo-4"}},
+	{ID: "demo-6", Title: "Tidy up the changelog", Priority: 3},
+	{ID: "demo-7", Title: "Release 0.1", Priority: 2, BlockedBy: []string{"demo-1", "demo-3", "demo-5"}},
+}
+
+// Fixture makes dir a MACHINATOR_DIR for a mock run: gemini and bin/bd
+// wrappers that run self (the machinator binary) as the mock gemini and
+// the native bd, an account, and project ProjectID whose repo is a local
+// bare repository seeded with fixtureTasks. Put bin first on PATH so
+// agents get that bd.
+func Fixture(dir, self string) error {
+	for _, sub := range []string{"bin", filepath.Join("accounts", "mock"), filepath.Join("projects", ProjectID)} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return fmt.Errorf("create %s: %w", sub, err)
+		}
+	}
+	wrappers := map[string]string{
+		filepath.Join(dir, "gemini"):    GeminiCommand,
+		filepath.Join(dir, "bin", "bd"): beads.NativeCommand,
+	}
+	for path, command := range wrappers {
+		script := fmt.Sprintf("#!/bin/sh\nexec %q %s \"$@\"\n", self, command)
+		if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+			return fmt.Errorf("write %s wrapper: %w", command, err)
+		}
+	}
+
+	// No desktop notifications or sleep inhibition from a demo
+	settings := `{"desktop_notifications": {"enabled": false}, "prevent_sleep": false}` + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(settings), 0644); err != nil {
+		return fmt.Errorf("write config: %w", err)
+	}
+
+	origin := filepath.Join(dir, "fixture.git")
+	if err := seedRepo(origin, filepath.Join(dir, "fixture-seed")); err != nil {
+		return err
+	}
+	projectConfig, _ := json.MarshalIndent(map[string]string{"repo": origin, "branch": FixtureBranch}, "", "  ")
+	if err := os.WriteFile(filepath.Join(dir, "projects", ProjectID, "config.json"), append(projectConfig, '\n'), 0644); err != nil {
+		return fmt.Errorf("write project config: %w", err)
+	}
+	return nil
+}
+
+// Daemon stands in for bd's daemon, which pulls what agents push into the
+// project clone tasks are read from: it keeps the clone at repoDir synced
+// with origin/<branch> until the process exits.
+func Daemon(repoDir, branch string) {
+	for {
+		time.Sleep(SyncInterval)
+		if tools.Command(tools.Git, "-C", repoDir, "fetch", "-q", "origin").Run() == nil {
+			setup.SyncRepo(repoDir, branch)
+		}
+	}
+}
+
+// seedRepo creates a bare repository at origin with one commit holding a
+// README and the fixture's tasks, made in the scratch clone at work.
+func seedRepo(origin, work string) error {
+	defer os.RemoveAll(work)
+	if err := os.MkdirAll(filepath.Join(work, ".beads"), 0755); err != nil {
+		return err
+	}
+	var issues strings.Builder
+	created := time.Now().UTC()
+	for _, t := range fixtureTasks {
+		t.Status, t.IssueType = "open", "task"
+		t.CreatedAt, t.UpdatedAt = created, created
+		line, err := json.Marshal(t)
+		if err != nil {
+			return err
+		}
+		issues.Write(line)
+		issues.WriteByte('\n')
+	}
+	files := map[string]string{
+		beads.JSONLPath: issues.String(),
+		"README.md":     "# Machinator demo\n\nA fixture project worked by the mock gemini.\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(work, name), []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+
+	for _, args := range [][]string{
+		{"init", "-q", "--bare", "--initial-branch=" + FixtureBranch, origin},
+		{"-C", work, "init", "-q", "--initial-branch=" + FixtureBranch},
+		{"-C", work, "add", "-A"},
+		{"-C", work, "-c", "user.name=Machinator", "-c", "user.email=machinator@machinator.local", "commit", "-q", "-m", "Demo project"},
+		{"-C", work, "push", "-q", origin, FixtureBranch},
+	} {
+		if out, err := tools.Command(tools.Git, args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("git %s: %w\nOutput: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package mock
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bryantinsley/machinator/backend/internal/beads"
+)
+
+// cloneFixture makes a fixture and returns a clone of its project repo.
+func cloneFixture(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := Fixture(dir, "/bin/false"); err != nil {
+		t.Fatal(err)
+	}
+	clone := filepath.Join(dir, "clone")
+	if out, err := exec.Command("git", "clone", "-q", filepath.Join(dir, "fixture.git"), clone).CombinedOutput(); err != nil {
+		t.Fatalf("clone: %v: %s", err, out)
+	}
+	return clone
+}
+
+func TestFixtureHasReadyTasks(t *testing.T) {
+	tasks, err := beads.LoadTasks(cloneFixture(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != len(fixtureTasks) {
+		t.Fatalf("got %d tasks, want %d", len(tasks), len(fixtureTasks))
+	}
+	var ready []string
+	for _, task := range beads.ReadyTasks(tasks) {
+		ready = append(ready, task.ID)
+	}
+	if got := strings.Join(ready, " "); got != "demo-1 demo-4 demo-2 demo-6" {
+		t.Errorf("ready = %s", got)
+	}
+}
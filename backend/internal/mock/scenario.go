@@ -0,0 +1,174 @@
+package mock
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ScenarioEnv names a YAML scenario file for the mock gemini to play
+// instead of its usual run.
+const ScenarioEnv = "MACHINATOR_MOCK_SCENARIO"
+
+// Scenario is a scripted mock gemini run:
+//
+//	branches:                      # the first whose when matches the directive
+//	  - when: "demo-4"             # is played instead of steps
+//	    steps:
+//	      - event: {type: message, role: assistant, content: "Stuck on {task}"}
+//	      - exit: 1
+//	steps:
+//	  - delay: 2s
+//	    event: {type: message, role: assistant, content: "Working on {task}: {title}"}
+//	  - tool: read_file
+//	    args: {path: README.md}
+//	    output: "..."
+//	  - raw: '{"type": "message", "content": '
+//	  - work: true                 # write, close, commit and push as usual
+//	  - event: {type: result, status: success, stats: {total_tokens: 12000}}
+//
+// {task} and {title} in a step's text are replaced by the directive's task.
+type Scenario struct {
+	Branches []Branch `yaml:"branches"`
+	Steps    []Step   `yaml:"steps"`
+}
+
+// Branch is steps played when the directive matches When, a regexp.
+type Branch struct {
+	When  string `yaml:"when"`
+	Steps []Step `yaml:"steps"`
+
+	when *regexp.Regexp
+}
+
+// Step is one thing the mock gemini does, after waiting Delay. A step does
+// one of: write an event, write a raw line (malformed JSON, say), call a
+// tool (tool_use then tool_result), print to stderr, do the task's work,
+// or exit with a code, ending the run mid-stream.
+type Step struct {
+	Delay time.Duration `yaml:"delay"`
+
+	Event  map[string]any `yaml:"event"`
+	Raw    *string        `yaml:"raw"`
+	Tool   string         `yaml:"tool"`
+	Args   map[string]any `yaml:"args"`
+	Output string         `yaml:"output"`
+	Failed bool           `yaml:"failed"` // The tool call's result is an error
+	Stderr string         `yaml:"stderr"`
+	Work   bool           `yaml:"work"`
+	Exit   *int           `yaml:"exit"`
+}
+
+// LoadScenario reads and checks a scenario file.
+func LoadScenario(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	var s Scenario
+	if err := dec.Decode(&s); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	for i := range s.Branches {
+		b := &s.Branches[i]
+		if b.when, err = regexp.Compile(b.When); err != nil {
+			return nil, fmt.Errorf("%s: branch %d: %w", filepath.Base(path), i+1, err)
+		}
+	}
+	for i, step := range s.steps() {
+		if n := step.actions(); n != 1 {
+			return nil, fmt.Errorf("%s: step %d does %d things, want 1", filepath.Base(path), i+1, n)
+		}
+	}
+	return &s, nil
+}
+
+// steps are all the scenario's steps, branches' included.
+func (s *Scenario) steps() []Step {
+	steps := append([]Step(nil), s.Steps...)
+	for _, b := range s.Branches {
+		steps = append(steps, b.Steps...)
+	}
+	return steps
+}
+
+// actions counts the things a step is set to do.
+func (st Step) actions() int {
+	n := 0
+	for _, set := range []bool{st.Event != nil, st.Raw != nil, st.Tool != "", st.Stderr != "", st.Work, st.Exit != nil} {
+		if set {
+			n++
+		}
+	}
+	return n
+}
+
+// play plays the scenario for a directive and returns the exit code.
+func (s *Scenario) play(prompt string, stdout, stderr io.Writer) int {
+	steps := s.Steps
+	for _, b := range s.Branches {
+		if b.when.MatchString(prompt) {
+			steps = b.Steps
+			break
+		}
+	}
+
+	taskID, title := "", ""
+	if m := taskLine.FindStringSubmatch(prompt); m != nil {
+		taskID, title = m[1], taskTitle(m[1])
+	}
+	expand := strings.NewReplacer("{task}", taskID, "{title}", title).Replace
+	// In events, the title is escaped as a JSON string's contents
+	quoted, _ := json.Marshal(title)
+	expandJSON := strings.NewReplacer("{task}", taskID, "{title}", string(quoted[1:len(quoted)-1])).Replace
+	emit := func(event map[string]any) {
+		if _, ok := event["timestamp"]; !ok {
+			event["timestamp"] = time.Now().UTC().Format(time.RFC3339Nano)
+		}
+		line, _ := json.Marshal(event)
+		fmt.Fprintln(stdout, expandJSON(string(line)))
+	}
+
+	for _, st := range steps {
+		time.Sleep(st.Delay)
+		switch {
+		case st.Event != nil:
+			emit(st.Event)
+		case st.Raw != nil:
+			fmt.Fprintln(stdout, expand(*st.Raw))
+		case st.Tool != "":
+			emit(map[string]any{"type": "tool_use", "tool_name": st.Tool, "parameters": st.Args})
+			status := "success"
+			if st.Failed {
+				status = "error"
+			}
+			emit(map[string]any{"type": "tool_result", "status": status, "output": st.Output})
+		case st.Stderr != "":
+			fmt.Fprintln(stderr, expand(st.Stderr))
+		case st.Work:
+			if taskID == "" {
+				fmt.Fprintln(stderr, "mock gemini: scenario does work, but the directive has no task")
+				return 1
+			}
+			file := filepath.Join("work", taskID+".md")
+			if err := publish(taskID, title, file); err != nil {
+				fmt.Fprintf(stderr, "mock gemini: %v\n", err)
+				return 1
+			}
+		case st.Exit != nil:
+			return *st.Exit
+		}
+	}
+	return 0
+}
@@ -0,0 +1,100 @@
+package mock
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeScenario writes a scenario file and returns its path.
+func writeScenario(t *testing.T, yaml string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "scenario.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const testScenario = `
+branches:
+  - when: "Task: demo-4"
+    steps:
+      - event: {type: message, role: assistant, content: "Stuck on {task}"}
+      - stderr: "quota exhausted"
+      - exit: 3
+      - event: {type: result, status: success}
+steps:
+  - delay: 10ms
+    event: {type: message, role: assistant, content: "Working on {task}"}
+  - tool: read_file
+    args: {path: README.md}
+    output: "# Demo"
+  - raw: '{"type": "message", "content": '
+  - event: {type: result, status: success, stats: {total_tokens: 500}}
+`
+
+func TestScenarioPlaysSteps(t *testing.T) {
+	s, err := LoadScenario(writeScenario(t, testScenario))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Steps[0].Delay != 10*time.Millisecond {
+		t.Errorf("delay = %v, want 10ms", s.Steps[0].Delay)
+	}
+
+	var stdout, stderr strings.Builder
+	if code := s.play("Your goal is to execute Beads Task: demo-1", &stdout, &stderr); code != 0 {
+		t.Fatalf("exit code %d, stderr %q", code, stderr.String())
+	}
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("got %d lines, want 5:\n%s", len(lines), stdout.String())
+	}
+	var first map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatal(err)
+	}
+	if first["content"] != "Working on demo-1" || first["timestamp"] == nil {
+		t.Errorf("first event = %v", first)
+	}
+	if !strings.Contains(lines[1], `"tool_use"`) || !strings.Contains(lines[2], `"tool_result"`) {
+		t.Errorf("tool call = %s, %s", lines[1], lines[2])
+	}
+	if json.Valid([]byte(lines[3])) {
+		t.Errorf("raw line %s is valid JSON", lines[3])
+	}
+}
+
+func TestScenarioBranchExitsMidStream(t *testing.T) {
+	s, err := LoadScenario(writeScenario(t, testScenario))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stdout, stderr strings.Builder
+	if code := s.play("Your goal is to execute Beads Task: demo-4", &stdout, &stderr); code != 3 {
+		t.Errorf("exit code %d, want 3", code)
+	}
+	if got := strings.Count(stdout.String(), "\n"); got != 1 {
+		t.Errorf("%d events before the exit, want 1:\n%s", got, stdout.String())
+	}
+	if !strings.Contains(stdout.String(), "Stuck on demo-4") || stderr.String() != "quota exhausted\n" {
+		t.Errorf("stdout %q, stderr %q", stdout.String(), stderr.String())
+	}
+}
+
+func TestLoadScenarioRejectsBadSteps(t *testing.T) {
+	for name, yaml := range map[string]string{
+		"two actions":   "steps:\n  - {exit: 1, work: true}\n",
+		"no action":     "steps:\n  - delay: 1s\n",
+		"unknown field": "steps:\n  - evnet: {type: message}\n",
+		"bad when":      "branches:\n  - when: \"(\"\n",
+	} {
+		if _, err := LoadScenario(writeScenario(t, yaml)); err == nil {
+			t.Errorf("%s: loaded", name)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package notify
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/bryantinsley/machinator/backend/internal/config"
+	"github.com/bryantinsley/machinator/backend/internal/events"
+)
+
+// defaultDesktopEvents are the attention-needed events shown when none are configured.
+var defaultDesktopEvents = []string{
+	string(events.TaskFailed),
+	string(events.TaskAbandoned),
+	string(events.MergeFailed),
+	string(events.SetupFailed),
+	string(events.QuotaExhausted),
+	string(events.AllTasksDone),
+	string(events.Stalled),
+	string(events.StaleClone),
+	string(events.LowResources),
+	string(events.OrchestratorCrashed),
+}
+
+// AddDesktop starts native desktop notifications (osascript on macOS,
+// notify-send elsewhere). Does nothing if disabled or no notifier is installed.
+func (d *Dispatcher) AddDesktop(cfg config.DesktopConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	names := cfg.Events
+	if len(names) == 0 {
+		names = defaultDesktopEvents
+	}
+	f, err := parseFilter(names)
+	if err != nil {
+		return fmt.Errorf("desktop_notifications: %w", err)
+	}
+
+	tool := "notify-send"
+	if runtime.GOOS == "darwin" {
+		tool = "osascript"
+	}
+	path, err := exec.LookPath(tool)
+	if err != nil {
+		d.logger.Log("notify", fmt.Sprintf("[yellow]Desktop notifications disabled: %s not found[-]", tool))
+		return nil
+	}
+
+	d.add(f, &desktop{tool: tool, path: path, logger: d.logger})
+	return nil
+}
+
+// desktop shows events as native notifications.
+type desktop struct {
+	tool   string
+	path   string
+	logger Logger
+}
+
+func (n *desktop) String() string {
+	return "desktop (" + n.tool + ")"
+}
+
+func (n *desktop) deliver(e events.Event) {
+	title := "Machinator"
+	body := strings.TrimPrefix(summary(e), "machinator: ")
+
+	var cmd *exec.Cmd
+	if n.tool == "osascript" {
+		script := fmt.Sprintf("display notification %s with title %s", strconv.Quote(body), strconv.Quote(title))
+		cmd = exec.Command(n.path, "-e", script)
+	} else {
+		urgency := "normal"
+		if e.IsFailure() {
+			urgency = "critical"
+		}
+		cmd = exec.Command(n.path, "--app-name=machinator", "--urgency="+urgency, title, body)
+	}
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		n.logger.Log("notify", fmt.Sprintf("[red]Desktop notification failed: %v %s[-]", err, strings.TrimSpace(string(out))))
+	}
+}
@@ -0,0 +1,80 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/bryantinsley/machinator/backend/internal/events"
+)
+
+// Payload formats.
+const (
+	FormatJSON    = "json"
+	FormatSlack   = "slack"
+	FormatDiscord = "discord"
+)
+
+// resolveFormat validates a configured format, detecting chat services from
+// the URL when none is given.
+func resolveFormat(format, rawURL string) (string, error) {
+	switch format = strings.ToLower(strings.TrimSpace(format)); format {
+	case FormatJSON, FormatSlack, FormatDiscord:
+		return format, nil
+	case "":
+	default:
+		return "", fmt.Errorf("unknown format %q (want %q, %q, or %q)", format, FormatJSON, FormatSlack, FormatDiscord)
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("bad url: %w", err)
+	}
+	host := strings.ToLower(u.Hostname())
+	switch {
+	case host == "hooks.slack.com":
+		return FormatSlack, nil
+	case (host == "discord.com" || host == "discordapp.com") && strings.HasPrefix(u.Path, "/api/webhooks/"):
+		return FormatDiscord, nil
+	}
+	return FormatJSON, nil
+}
+
+// payload renders an event in the given format.
+func payload(format string, e events.Event) ([]byte, error) {
+	switch format {
+	case FormatSlack:
+		return json.Marshal(map[string]string{"text": summary(e)})
+	case FormatDiscord:
+		return json.Marshal(map[string]string{"content": summary(e)})
+	default:
+		return json.Marshal(e)
+	}
+}
+
+// summary is a one-line human-readable description of an event.
+func summary(e events.Event) string {
+	var b strings.Builder
+	switch {
+	case e.IsFailure():
+		b.WriteString("🔴 ")
+	case e.IsCompletion():
+		b.WriteString("✅ ")
+	default:
+		b.WriteString("ℹ️ ")
+	}
+
+	b.WriteString("machinator: ")
+	b.WriteString(strings.ReplaceAll(string(e.Type), "_", " "))
+	if e.TaskID != "" {
+		fmt.Fprintf(&b, " %s", e.TaskID)
+	}
+	if e.AgentID != 0 {
+		fmt.Fprintf(&b, " (agent %d)", e.AgentID)
+	}
+	if e.Message != "" {
+		fmt.Fprintf(&b, ": %s", e.Message)
+	}
+	return b.String()
+}
@@ -0,0 +1,50 @@
+package notify
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/bryantinsley/machinator/backend/internal/events"
+)
+
+func TestResolveFormat(t *testing.T) {
+	tests := []struct {
+		format, url, want string
+	}{
+		{"", "https://hooks.slack.com/services/T0/B0/x", FormatSlack},
+		{"", "https://discord.com/api/webhooks/1/abc", FormatDiscord},
+		{"", "https://discordapp.com/api/webhooks/1/abc", FormatDiscord},
+		{"", "https://example.com/hook", FormatJSON},
+		{"json", "https://hooks.slack.com/services/T0/B0/x", FormatJSON},
+		{"Slack", "https://proxy.example.com/slack", FormatSlack},
+	}
+	for _, tt := range tests {
+		got, err := resolveFormat(tt.format, tt.url)
+		if err != nil || got != tt.want {
+			t.Errorf("resolveFormat(%q, %q) = %q, %v; want %q", tt.format, tt.url, got, err, tt.want)
+		}
+	}
+
+	if _, err := resolveFormat("teams", "https://example.com"); err == nil {
+		t.Error("resolveFormat accepted unknown format")
+	}
+}
+
+func TestPayloadChatFormats(t *testing.T) {
+	e := events.New(events.TaskAbandoned, 2, "proj-12", "gave up after 3 failed attempts")
+	want := "🔴 machinator: task abandoned proj-12 (agent 2): gave up after 3 failed attempts"
+
+	for format, key := range map[string]string{FormatSlack: "text", FormatDiscord: "content"} {
+		body, err := payload(format, e)
+		if err != nil {
+			t.Fatalf("payload(%s): %v", format, err)
+		}
+		var got map[string]string
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Fatalf("payload(%s) not JSON: %v", format, err)
+		}
+		if got[key] != want {
+			t.Errorf("payload(%s)[%q] = %q, want %q", format, key, got[key], want)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/chaos"
+	"github.com/bryantinsley/machinator/backend/internal/config"
+	"github.com/bryantinsley/machinator/backend/internal/events"
+	"github.com/bryantinsley/machinator/backend/internal/seed"
+)
+
+const (
+	queueSize          = 256
+	defaultMaxAttempts = 5
+	initialBackoff     = 1 * time.Second
+	maxBackoff         = 1 * time.Minute
+)
+
+// Logger is the interface for reporting delivery problems.
+type Logger interface {
+	Log(source, message string)
+}
+
+// Dispatcher fans events out to all configured sinks.
+type Dispatcher struct {
+	sinks  []*sink
+	logger Logger
+}
+
+// deliverer sends an event to one destination.
+type deliverer interface {
+	deliver(e events.Event)
+	String() string // Destination name for log messages
+}
+
+// sink queues matching events for a deliverer and sends them in order.
+type sink struct {
+	filter  filter
+	out     deliverer
+	queue   chan events.Event
+	pending atomic.Int64 // Queued or in-flight events
+}
+
+func (s *sink) run() {
+	for e := range s.queue {
+		s.out.deliver(e)
+		s.pending.Add(-1)
+	}
+}
+
+// add starts a delivery worker for out.
+func (d *Dispatcher) add(f filter, out deliverer) {
+	s := &sink{
+		filter: f,
+		out:    out,
+		queue:  make(chan events.Event, queueSize),
+	}
+	d.sinks = append(d.sinks, s)
+	go s.run()
+}
+
+// NewDispatcher creates a dispatcher for the configured webhooks and starts
+// one delivery worker per sink. Retry jitter is drawn from the run seed.
+func NewDispatcher(hooks []config.WebhookConfig, logger Logger, runSeed seed.Seed) (*Dispatcher, error) {
+	d := &Dispatcher{logger: logger}
+
+	for i, h := range hooks {
+		if h.URL == "" {
+			return nil, fmt.Errorf("webhooks[%d]: missing url", i)
+		}
+		f, err := parseFilter(h.Events)
+		if err != nil {
+			return nil, fmt.Errorf("webhooks[%d]: %w", i, err)
+		}
+		format, err := resolveFormat(h.Format, h.URL)
+		if err != nil {
+			return nil, fmt.Errorf("webhooks[%d]: %w", i, err)
+		}
+		maxAttempts := h.MaxAttempts
+		if maxAttempts <= 0 {
+			maxAttempts = defaultMaxAttempts
+		}
+
+		d.add(f, &webhook{
+			url:         h.URL,
+			format:      format,
+			maxAttempts: maxAttempts,
+			client:      &http.Client{Timeout: 10 * time.Second},
+			logger:      logger,
+			rng:         runSeed.Stream(fmt.Sprintf("notify.webhooks[%d]", i)),
+			sleep:       time.Sleep,
+		})
+	}
+
+	return d, nil
+}
+
+// Emit queues an event for every sink whose filter matches. Never blocks;
+// if a sink's queue is full the event is dropped for that sink.
+func (d *Dispatcher) Emit(e events.Event) {
+	if chaos.DropEvent() {
+		d.logger.Log("notify", fmt.Sprintf("[fuchsia]chaos: dropped %s[-]", e.Type))
+		return
+	}
+	for _, s := range d.sinks {
+		if !s.filter.match(e) {
+			continue
+		}
+		s.pending.Add(1)
+		select {
+		case s.queue <- e:
+		default:
+			s.pending.Add(-1)
+			d.logger.Log("notify", fmt.Sprintf("[red]Queue full for %s, dropped %s[-]", s.out, e.Type))
+		}
+	}
+}
+
+// Flush waits up to timeout for queued events to be delivered. Used before
+// exiting so final events (like a crash report) are not lost.
+func (d *Dispatcher) Flush(timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		idle := true
+		for _, s := range d.sinks {
+			if s.pending.Load() > 0 {
+				idle = false
+			}
+		}
+		if idle {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// filter selects which events a sink receives.
+type filter struct {
+	all         bool
+	failures    bool
+	completions bool
+	types       map[events.Type]bool
+}
+
+// parseFilter parses filter names: "all", "failures", "completions" or an
+// event type. An unknown name is an error, as a misspelled type would
+// never match.
+func parseFilter(names []string) (filter, error) {
+	f := filter{types: make(map[events.Type]bool)}
+	if len(names) == 0 {
+		f.all = true
+		return f, nil
+	}
+
+	for _, name := range names {
+		switch name = strings.ToLower(strings.TrimSpace(name)); name {
+		case "all", "*":
+			f.all = true
+		case "failures":
+			f.failures = true
+		case "completions":
+			f.completions = true
+		case "":
+			return f, fmt.Errorf("empty event filter")
+		default:
+			if !slices.Contains(events.Types, events.Type(name)) {
+				return f, fmt.Errorf("unknown event %q", name)
+			}
+			f.types[events.Type(name)] = true
+		}
+	}
+	return f, nil
+}
+
+func (f filter) match(e events.Event) bool {
+	switch {
+	case f.all:
+		return true
+	case f.failures && e.IsFailure():
+		return true
+	case f.completions && e.IsCompletion():
+		return true
+	default:
+		return f.types[e.Type]
+	}
+}
+
+// webhook posts events to one URL, retrying with jittered backoff.
+type webhook struct {
+	url         string
+	format      string
+	maxAttempts int
+	client      *http.Client
+	logger      Logger
+	rng         *rand.Rand // Only used from the sink's worker
+	sleep       func(time.Duration)
+}
+
+func (s *webhook) String() string {
+	return s.url
+}
+
+func (s *webhook) deliver(e events.Event) {
+	body, err := payload(s.format, e)
+	if err != nil {
+		s.logger.Log("notify", fmt.Sprintf("[red]Marshal %s: %v[-]", e.Type, err))
+		return
+	}
+
+	backoff := initialBackoff
+	for attempt := 1; attempt <= s.maxAttempts; attempt++ {
+		retry, err := s.post(body)
+		if err == nil {
+			return
+		}
+		if !retry || attempt == s.maxAttempts {
+			s.logger.Log("notify", fmt.Sprintf("[red]Dropped %s for %s after %d attempt(s): %v[-]", e.Type, s.url, attempt, err))
+			return
+		}
+		// Up to 50% jitter so several orchestrators don't retry in lockstep
+		s.sleep(backoff + time.Duration(s.rng.Int63n(int64(backoff/2)+1)))
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// post sends one request. Returns whether a failure is worth retrying.
+func (s *webhook) post(body []byte) (bool, error) {
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("status %s", resp.Status)
+	default:
+		return false, fmt.Errorf("status %s", resp.Status)
+	}
+}
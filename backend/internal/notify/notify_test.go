@@ -0,0 +1,151 @@
+package notify
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/events"
+	"github.com/bryantinsley/machinator/backend/internal/seed"
+)
+
+type testLogger struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (l *testLogger) Log(source, message string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, message)
+}
+
+func TestParseFilter(t *testing.T) {
+	if f, err := parseFilter(nil); err != nil || !f.all {
+		t.Errorf("parseFilter(nil) = %+v, %v; want all", f, err)
+	}
+	for _, names := range [][]string{{"task_faild"}, {"failures", "nope"}, {" "}} {
+		if _, err := parseFilter(names); err == nil {
+			t.Errorf("parseFilter(%q) accepted it", names)
+		}
+	}
+	if _, err := parseFilter([]string{" Task_Failed ", "*"}); err != nil {
+		t.Errorf("parseFilter with case and spacing: %v", err)
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	tests := []struct {
+		names []string
+		typ   events.Type
+		want  bool
+	}{
+		{[]string{"all"}, events.TaskAssigned, true},
+		{[]string{"failures"}, events.TaskFailed, true},
+		{[]string{"failures"}, events.QuotaExhausted, true},
+		{[]string{"failures"}, events.TaskCompleted, false},
+		{[]string{"completions"}, events.TaskCompleted, true},
+		{[]string{"completions"}, events.AllTasksDone, true},
+		{[]string{"completions"}, events.TaskFailed, false},
+		{[]string{"task_assigned"}, events.TaskAssigned, true},
+		{[]string{"task_assigned"}, events.AgentReady, false},
+		{[]string{"completions", "merge_failed"}, events.MergeFailed, true},
+	}
+	for _, tt := range tests {
+		f, err := parseFilter(tt.names)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := f.match(events.New(tt.typ, 1, "t-1", "")); got != tt.want {
+			t.Errorf("filter %v matches %s = %v, want %v", tt.names, tt.typ, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookRetries(t *testing.T) {
+	tests := []struct {
+		name        string
+		failures    int // Responses with status before a 200
+		status      int
+		maxAttempts int
+		wantPosts   int
+		wantDropped bool
+	}{
+		{"succeeds", 0, 0, 5, 1, false},
+		{"recovers", 3, http.StatusServiceUnavailable, 5, 4, false},
+		{"rate limited", 1, http.StatusTooManyRequests, 5, 2, false},
+		{"gives up", 10, http.StatusBadGateway, 4, 4, true},
+		{"client error", 10, http.StatusBadRequest, 5, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var posts atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if int(posts.Add(1)) <= tt.failures {
+					w.WriteHeader(tt.status)
+				}
+			}))
+			defer srv.Close()
+
+			var sleeps []time.Duration
+			logger := &testLogger{}
+			w := &webhook{
+				url:         srv.URL,
+				format:      FormatJSON,
+				maxAttempts: tt.maxAttempts,
+				client:      srv.Client(),
+				logger:      logger,
+				rng:         seed.Seed(1).Stream("test"),
+				sleep:       func(d time.Duration) { sleeps = append(sleeps, d) },
+			}
+			w.deliver(events.New(events.TaskFailed, 1, "t-1", "boom"))
+
+			if got := int(posts.Load()); got != tt.wantPosts {
+				t.Errorf("posted %d times, want %d", got, tt.wantPosts)
+			}
+			if len(sleeps) != tt.wantPosts-1 {
+				t.Errorf("slept %d times between %d posts", len(sleeps), tt.wantPosts)
+			}
+			// Backoff doubles from initialBackoff, plus up to 50% jitter
+			backoff := initialBackoff
+			for i, d := range sleeps {
+				if d < backoff || d > backoff+backoff/2 {
+					t.Errorf("sleep %d = %s, want %s to %s", i+1, d, backoff, backoff+backoff/2)
+				}
+				backoff *= 2
+			}
+			dropped := len(logger.lines) > 0 && strings.Contains(logger.lines[0], "Dropped")
+			if dropped != tt.wantDropped {
+				t.Errorf("dropped = %v, want %v (log %q)", dropped, tt.wantDropped, logger.lines)
+			}
+		})
+	}
+}
+
+func TestWebhookBackoffCapped(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	var sleeps []time.Duration
+	w := &webhook{
+		url:         srv.URL,
+		format:      FormatJSON,
+		maxAttempts: 10,
+		client:      srv.Client(),
+		logger:      &testLogger{},
+		rng:         seed.Seed(1).Stream("test"),
+		sleep:       func(d time.Duration) { sleeps = append(sleeps, d) },
+	}
+	w.deliver(events.New(events.TaskFailed, 1, "t-1", "boom"))
+
+	last := sleeps[len(sleeps)-1]
+	if last < maxBackoff || last > maxBackoff+maxBackoff/2 {
+		t.Errorf("last of %d sleeps = %s, want capped at %s plus jitter", len(sleeps), last, maxBackoff)
+	}
+}
@@ -0,0 +1,51 @@
+// Package procgroup runs subprocesses in process groups of their own, so
+// stopping one stops everything it started: the node behind npm install or
+// gemini, the ssh behind git clone. Killing only the process we started
+// leaves those running after machinator has gone.
+package procgroup
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// waitDelay bounds how long Wait waits for output from a killed group,
+// should something have escaped it.
+const waitDelay = 5 * time.Second
+
+// Command is exec.CommandContext for a command whose whole process group is
+// killed when ctx is done.
+func Command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	Set(cmd)
+	cmd.Cancel = func() error { return Kill(cmd) }
+	cmd.WaitDelay = waitDelay
+	return cmd
+}
+
+// Set makes cmd, once started, the leader of a new process group.
+func Set(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// Kill kills the process group led by cmd, which must have been Set. It
+// returns os.ErrProcessDone if the group is already gone.
+func Kill(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return errors.New("procgroup: not started")
+	}
+	if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil {
+		if errors.Is(err, syscall.ESRCH) {
+			return os.ErrProcessDone
+		}
+		return err
+	}
+	return nil
+}
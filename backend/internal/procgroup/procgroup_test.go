@@ -0,0 +1,22 @@
+package procgroup
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCancelKillsTheGroup(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	// The shell waits on a child of its own, as npm does on node. Were only
+	// the shell killed, the sleep would hold the output open until waitDelay.
+	cmd := Command(ctx, "sh", "-c", "sleep 30 & wait")
+	start := time.Now()
+	if _, err := cmd.CombinedOutput(); err == nil {
+		t.Fatal("command succeeded, want it killed")
+	}
+	if elapsed := time.Since(start); elapsed >= waitDelay {
+		t.Errorf("took %s after cancel, so the sleep outlived its shell", elapsed)
+	}
+}
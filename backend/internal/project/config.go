@@ -4,17 +4,364 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/bryantinsley/machinator/backend/internal/config"
+	"github.com/bryantinsley/machinator/backend/internal/quota"
 )
 
 // Config holds project-specific configuration.
 type Config struct {
-	Repo             string `json:"repo"`
-	Branch           string `json:"branch"`
+	Repo   string `json:"repo" schema:"required"`
+	Branch string `json:"branch"`
+
+	// The models may change mid-run (ApplyLive); read them with Models.
 	SimpleModelName  string `json:"simple_model_name"`
 	ComplexModelName string `json:"complex_model_name"`
+
+	// Repos are more repositories the project's tasks work in, checked
+	// out inside each agent's worktree under .repos/<name>. Tasks (and
+	// their beads) stay in Repo.
+	Repos []RepoConfig `json:"repos,omitempty"`
+
+	// Scope is the directory of Repo the project lives in, e.g.
+	// "services/payments", for projects sharing a monorepo. Agents work
+	// from it and task branches changing files outside it aren't merged.
+	Scope string `json:"scope,omitempty"`
+
+	// Clone makes the project's clone and worktrees smaller, for repos
+	// too big to clone whole.
+	Clone CloneConfig `json:"clone,omitempty"`
+
+	// Worktrees sets what survives in agents' worktrees between tasks.
+	Worktrees WorktreesConfig `json:"worktrees,omitempty"`
+
+	// Docker runs each agent's gemini in a container instead of on the
+	// host.
+	Docker DockerConfig `json:"docker,omitempty"`
+
+	// Remote runs each agent's gemini on another host over SSH. Worktrees
+	// are mirrored there before each run and back once it ends, so
+	// everything else stays local.
+	Remote RemoteConfig `json:"remote,omitempty"`
+
+	// ModelLimits caps how many agents run each model at once, e.g.
+	// {"gemini-3-pro-preview": 2}. Models not listed are unlimited.
+	ModelLimits map[string]int `json:"model_limits,omitempty"`
+
+	// AccountRotation is how agents take turns on accounts with quota:
+	// "most_quota_remaining" (default), "round_robin" or
+	// "least_recently_used".
+	AccountRotation string `json:"account_rotation,omitempty"`
+
+	// EstimateComplexity has the simple model read each open task without
+	// a CHALLENGE tag and tag it simple or complex in the task backend.
+	EstimateComplexity bool `json:"estimate_complexity,omitempty"`
+
+	// Complexity tags open tasks without a CHALLENGE tag complex by rule,
+	// before (or instead of) asking the model.
+	Complexity ComplexityConfig `json:"complexity,omitempty"`
+
+	// ResumeMode controls how a task interrupted by a timeout is retried:
+	// "reset" starts from a clean worktree, "checkpoint" restores the
+	// interrupted attempt's changes and tells the agent about them.
+	ResumeMode string `json:"resume_mode,omitempty"`
+
+	// ContextIndex indexes the repo's code locally and shows each agent the
+	// snippets most relevant to its task.
+	ContextIndex bool `json:"context_index,omitempty"`
+
+	// Merge has agents work on a branch per task, merged into Branch by
+	// the orchestrator once the task is complete.
+	Merge MergeConfig `json:"merge,omitempty"`
+
+	// Staleness keeps tasks from being assigned while the project clone
+	// is too far behind origin/<branch>.
+	Staleness StalenessConfig `json:"staleness,omitempty"`
+
+	// TestCommand is how agents run the tests (exposed to directive
+	// templates as {{testCommand}}). Detected from the repo when empty.
+	TestCommand string `json:"test_command,omitempty"`
+
+	// Hooks are shell commands run in the agent's worktree around each
+	// task, with the task described in their environment.
+	Hooks HooksConfig `json:"hooks,omitempty"`
+
+	// TestGate runs the test command once an agent has closed its task,
+	// and reopens the task if the tests fail.
+	TestGate TestGateConfig `json:"test_gate,omitempty"`
+
+	// IgnoreChanges lists git glob patterns for files that don't count as
+	// work left behind by an agent (generated files, local databases).
+	// They are left out of checkpoints, failure context and the
+	// uncommitted-changes check. Replaces DefaultIgnoreChanges when set.
+	IgnoreChanges []string `json:"ignore_changes,omitempty"`
+
+	// Uncommitted says what happens to changes an agent leaves
+	// uncommitted when it exits, before its worktree is reset.
+	Uncommitted UncommittedConfig `json:"uncommitted,omitempty"`
+
+	// Forge is the code host for pull requests and CI status: "github",
+	// "gitlab" or "bitbucket". Detected from the repo URL when empty.
+	Forge string `json:"forge,omitempty"`
+
+	// ForgeAPIURL overrides the forge's API base, for self-hosted GitLab or
+	// GitHub Enterprise with a non-standard path.
+	ForgeAPIURL string `json:"forge_api_url,omitempty"`
+
+	// Tracker pulls tasks from an issue tracker instead of the repo's beads.
+	Tracker TrackerConfig `json:"tracker,omitempty"`
+
+	// Settings overrides fields of the global config.json while this
+	// project runs. It's checked against that schema by config.LoadFor.
+	Settings map[string]any `json:"settings,omitempty"`
+
+	// Warnings lists non-fatal problems found while loading (e.g. unknown fields).
+	Warnings []config.Issue `json:"-"`
+}
+
+// RepoConfig is an extra repository of a project.
+type RepoConfig struct {
+	// Name identifies the repo in REPO:<name> task tags and is its
+	// directory under .repos/.
+	Name   string `json:"name" schema:"required"`
+	Repo   string `json:"repo" schema:"required"`
+	Branch string `json:"branch,omitempty"` // Default "main"
+	// Description tells agents what the repo holds, e.g. "React frontend".
+	Description string `json:"description,omitempty"`
+	// Clone makes this repo's clone and checkouts smaller.
+	Clone CloneConfig `json:"clone,omitempty"`
+}
+
+// CloneConfig trims a clone and its worktrees. The zero value clones and
+// checks out everything. Depth and Filter only apply to new clones;
+// delete a clone to change them.
+type CloneConfig struct {
+	// Depth clones only this many commits of each branch (git clone
+	// --depth); later fetches add new commits on top. Task branches are
+	// merged as usual as long as they start within the clone's history.
+	Depth int `json:"depth,omitempty"`
+	// Filter leaves objects out of the clone until they're needed (git
+	// clone --filter), e.g. "blob:none" for a blobless clone.
+	Filter string `json:"filter,omitempty"`
+	// Sparse lists the directories checked out (git sparse-checkout, cone
+	// mode), e.g. ["services/payments", "lib"]; files at the top level
+	// always are. For the project's own repo .beads and Scope are added.
+	Sparse []string `json:"sparse,omitempty"`
+}
+
+// DockerConfig is the container agents run in.
+type DockerConfig struct {
+	// Image has node (for gemini), git, bd and the project's toolchain.
+	// Empty runs agents on the host.
+	Image string `json:"image,omitempty"`
+}
+
+// RemoteConfig is the host agents run on.
+type RemoteConfig struct {
+	// Host is the ssh destination, e.g. "buildbox" from ~/.ssh/config.
+	// It needs git, rsync, bd and gemini. Empty runs agents locally.
+	Host string `json:"host,omitempty"`
+	// Dir is where MACHINATOR_DIR is mirrored on the host, relative to
+	// the remote home unless absolute (default ".machinator-remote").
+	Dir string `json:"dir,omitempty"`
+	// Gemini is the gemini command on the host (default "gemini").
+	Gemini string `json:"gemini,omitempty"`
+}
+
+// WorktreesConfig sets what survives in an agent's worktree when it's
+// reset for the next task, on top of ignored files.
+type WorktreesConfig struct {
+	// Keep lists untracked files and directories left in place (git clean
+	// exclude patterns), e.g. ["node_modules", ".venv"], so dependencies
+	// installed for one task serve the next.
+	Keep []string `json:"keep,omitempty"`
+}
+
+// ReposDir is where a worktree's extra repos are checked out, relative to
+// it.
+const ReposDir = ".repos"
+
+// MergeConfig selects how completed task branches are merged.
+type MergeConfig struct {
+	// Mode is "" to have agents push to the branch themselves,
+	// "fast_forward", "squash" or "pull_request".
+	Mode string `json:"mode,omitempty"`
+	// Command checks the merged result in the agent's worktree before it
+	// is pushed, e.g. "make test lint". A failure stops the merge.
+	Command string `json:"command,omitempty"`
+	// ResolveConflicts has the agent that did a task resolve its branch's
+	// merge conflicts before they're left to a person.
+	ResolveConflicts bool `json:"resolve_conflicts,omitempty"`
+	// PruneAfter deletes task branches from origin once their task is
+	// closed and they've been merged and untouched this long, e.g.
+	// "168h". Zero keeps them.
+	PruneAfter config.Duration `json:"prune_after,omitempty"`
+}
+
+// HooksConfig holds a project's task hooks. Empty ones are skipped.
+type HooksConfig struct {
+	// PreTask runs before the agent starts, e.g. "npm install". A failure
+	// fails the attempt.
+	PreTask string `json:"pre_task,omitempty"`
+	// PostTask runs once the agent has completed its task, e.g. "make
+	// test". With task branches a failure fails the attempt and the branch
+	// isn't merged; otherwise the work is already pushed and it's logged.
+	PostTask string `json:"post_task,omitempty"`
+	// OnFailure runs when an attempt fails or times out, before the
+	// worktree is reset, e.g. to collect logs.
+	OnFailure string `json:"on_failure,omitempty"`
+	// Timeout bounds each hook (default 10m).
+	Timeout config.Duration `json:"timeout,omitempty"`
+}
+
+// TestGateConfig is the orchestrator's own check of completed tasks.
+type TestGateConfig struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// Timeout bounds each test run (default 30m).
+	Timeout config.Duration `json:"timeout,omitempty"`
+	// Reruns is how many more times failed tests are run to tell flaky
+	// ones from real failures (default 2, 0 trusts the first run).
+	Reruns int `json:"reruns"`
+}
+
+// UncommittedConfig sets which uncommitted changes may be thrown away.
+// Anything bigger than minor is saved under MACHINATOR_DIR/discarded/<task>/.
+type UncommittedConfig struct {
+	// Policy is "discard" (default) to throw minor changes away, or
+	// "stash" to save those too.
+	Policy string `json:"policy,omitempty"`
+	// MaxFiles and MaxLines bound minor changes: at most MaxFiles files
+	// and MaxLines added or removed lines (default 1 and 20).
+	MaxFiles int `json:"max_files,omitempty"`
+	MaxLines int `json:"max_lines,omitempty"`
+}
+
+// Minor reports whether changes to files files, adding or removing lines
+// lines, are small enough to throw away under the discard policy.
+func (c UncommittedConfig) Minor(files, lines int) bool {
+	return c.Policy == UncommittedDiscard && files <= c.MaxFiles && lines <= c.MaxLines
+}
+
+// StalenessConfig sets how far behind its remote the project clone may be
+// when tasks are assigned. A zero limit is no limit.
+type StalenessConfig struct {
+	// MaxBehind is how many commits on origin/<branch> the clone may lack.
+	MaxBehind int `json:"max_behind,omitempty"`
+	// MaxAge is how long the clone may have lacked a commit, e.g. "24h".
+	MaxAge config.Duration `json:"max_age,omitempty"`
+	// Action is "sync" (default) to reset the clone to origin/<branch>,
+	// or "block" to stop assigning tasks until it's synced by hand.
+	Action string `json:"action,omitempty"`
+}
+
+// Enabled reports whether any limit is set.
+func (c StalenessConfig) Enabled() bool {
+	return c.MaxBehind > 0 || c.MaxAge > 0
+}
+
+// Exceeded reports whether a clone lacking commits, the oldest for age, is
+// past a limit.
+func (c StalenessConfig) Exceeded(commits int, age time.Duration) bool {
+	return (c.MaxBehind > 0 && commits > c.MaxBehind) || (c.MaxAge > 0 && commits > 0 && age > c.MaxAge.Duration())
+}
+
+// ComplexityConfig holds the rules that make an untagged task complex. A
+// zero value is no rule.
+type ComplexityConfig struct {
+	// DescriptionLength is the description length, in characters, from
+	// which a task is complex.
+	DescriptionLength int `json:"description_length,omitempty"`
+	// FileCount is how many distinct files a task must mention (paths
+	// such as internal/tui/tui.go) to be complex.
+	FileCount int `json:"file_count,omitempty"`
+	// Labels make a task that has any of them complex.
+	Labels []string `json:"labels,omitempty"`
+}
+
+// Enabled reports whether any rule is set.
+func (c ComplexityConfig) Enabled() bool {
+	return c.DescriptionLength > 0 || c.FileCount > 0 || len(c.Labels) > 0
+}
+
+// TrackerConfig selects where a project's tasks come from.
+type TrackerConfig struct {
+	// Kind is "" for beads (the default), "jira", "linear" or "file".
+	Kind string `json:"kind,omitempty"`
+	// URL is the tracker's base URL, e.g. "https://acme.atlassian.net".
+	// Linear defaults to its public GraphQL endpoint.
+	URL string `json:"url,omitempty"`
+	// Query selects the issues to work on (JQL for Jira).
+	Query string `json:"query,omitempty"`
+	// Project is the key of the project new issues are created in (Jira).
+	Project string `json:"project,omitempty"`
+	// Label and Team select the issues to work on (Linear): those with the
+	// label, optionally only in the team with this key.
+	Label string `json:"label,omitempty"`
+	Team  string `json:"team,omitempty"`
+	// Path is the task file in the repo (file): a YAML task list, or a
+	// Markdown checklist if it ends in .md. Defaults to tasks.yaml.
+	Path string `json:"path,omitempty"`
+	// Email authenticates with the API token (Jira Cloud). Without it the
+	// token is sent as a bearer token (Jira Server/Data Center).
+	Email string `json:"email,omitempty"`
+
+	// Statuses issues are moved to. Empty picks the transition into the
+	// matching status category.
+	TodoStatus       string `json:"todo_status,omitempty"`
+	InProgressStatus string `json:"in_progress_status,omitempty"`
+	DoneStatus       string `json:"done_status,omitempty"`
+
+	// PollInterval is how long fetched issues are reused (default 1m).
+	PollInterval config.Duration `json:"poll_interval,omitempty"`
+}
+
+// DefaultIgnoreChanges is used when a project doesn't set ignore_changes.
+// .beads is always ignored and needn't be listed.
+var DefaultIgnoreChanges = []string{
+	"**/node_modules/**",
+}
+
+// Models used when a project doesn't name its own.
+const (
+	DefaultSimpleModel  = "gemini-3-flash-preview"
+	DefaultComplexModel = "gemini-3-pro-preview"
+)
+
+// Resume modes.
+const (
+	ResumeReset      = "reset"
+	ResumeCheckpoint = "checkpoint"
+)
+
+// Uncommitted-changes policies.
+const (
+	UncommittedDiscard = "discard"
+	UncommittedStash   = "stash"
+)
+
+// Staleness actions.
+const (
+	StaleSync  = "sync"
+	StaleBlock = "block"
+)
+
+// Merge modes.
+const (
+	MergeFastForward = "fast_forward" // Rebase the task branch, then fast-forward
+	MergeSquash      = "squash"       // One commit per task
+	MergePullRequest = "pull_request" // Open a pull request instead of merging
+)
+
+// TaskBranch is the branch a task is worked on when task branches are merged.
+func TaskBranch(taskID string) string {
+	return "machinator/" + taskID
 }
 
 // Load loads project config from disk.
@@ -29,27 +376,205 @@ func Load(machinatorDir string, projectID string) (*Config, error) {
 		return nil, fmt.Errorf("read config: %w", err)
 	}
 
-	// Strip JSONC comments (// style)
-	data = config.StripJSONComments(data)
-
 	cfg := &Config{
 		// Defaults
 		Branch:           "main",
-		SimpleModelName:  "gemini-3-flash-preview",
-		ComplexModelName: "gemini-3-pro-preview",
+		SimpleModelName:  DefaultSimpleModel,
+		ComplexModelName: DefaultComplexModel,
+		ResumeMode:       ResumeReset,
+		AccountRotation:  quota.MostQuotaRemaining,
+		IgnoreChanges:    append([]string(nil), DefaultIgnoreChanges...),
+		Staleness:        StalenessConfig{Action: StaleSync},
+		Uncommitted:      UncommittedConfig{Policy: UncommittedDiscard, MaxFiles: 1, MaxLines: 20},
+		Hooks:            HooksConfig{Timeout: config.Duration(10 * time.Minute)},
+		TestGate:         TestGateConfig{Timeout: config.Duration(30 * time.Minute), Reruns: 2},
 	}
 
-	if err := json.Unmarshal(data, cfg); err != nil {
-		return nil, fmt.Errorf("parse config: %w", err)
+	warnings, err := config.Decode(configPath, data, cfg)
+	if err != nil {
+		return nil, err
 	}
+	cfg.Warnings = warnings
 
-	if cfg.Repo == "" {
-		return nil, fmt.Errorf("project config missing 'repo'")
+	if cfg.ResumeMode != ResumeReset && cfg.ResumeMode != ResumeCheckpoint {
+		return nil, &config.SchemaError{Issues: []config.Issue{{
+			File:    configPath,
+			Field:   "resume_mode",
+			Message: fmt.Sprintf("must be %q or %q, got %q", ResumeReset, ResumeCheckpoint, cfg.ResumeMode),
+		}}}
+	}
+	if m := cfg.Merge.Mode; m != "" && m != MergeFastForward && m != MergeSquash && m != MergePullRequest {
+		return nil, &config.SchemaError{Issues: []config.Issue{{
+			File:    configPath,
+			Field:   "merge.mode",
+			Message: fmt.Sprintf("must be empty, %q, %q or %q, got %q", MergeFastForward, MergeSquash, MergePullRequest, m),
+		}}}
+	}
+	if p := cfg.Uncommitted.Policy; p != UncommittedDiscard && p != UncommittedStash {
+		return nil, &config.SchemaError{Issues: []config.Issue{{
+			File:    configPath,
+			Field:   "uncommitted.policy",
+			Message: fmt.Sprintf("must be %q or %q, got %q", UncommittedDiscard, UncommittedStash, p),
+		}}}
+	}
+	if a := cfg.Staleness.Action; a != StaleSync && a != StaleBlock {
+		return nil, &config.SchemaError{Issues: []config.Issue{{
+			File:    configPath,
+			Field:   "staleness.action",
+			Message: fmt.Sprintf("must be %q or %q, got %q", StaleSync, StaleBlock, a),
+		}}}
+	}
+	if !slices.Contains(quota.Rotations, cfg.AccountRotation) {
+		return nil, &config.SchemaError{Issues: []config.Issue{{
+			File:    configPath,
+			Field:   "account_rotation",
+			Message: fmt.Sprintf("must be one of %q, got %q", quota.Rotations, cfg.AccountRotation),
+		}}}
+	}
+	for _, rule := range []struct {
+		field string
+		n     int
+	}{
+		{"complexity.description_length", cfg.Complexity.DescriptionLength},
+		{"complexity.file_count", cfg.Complexity.FileCount},
+		{"staleness.max_behind", cfg.Staleness.MaxBehind},
+		{"test_gate.reruns", cfg.TestGate.Reruns},
+		{"uncommitted.max_files", cfg.Uncommitted.MaxFiles},
+		{"uncommitted.max_lines", cfg.Uncommitted.MaxLines},
+	} {
+		if rule.n < 0 {
+			return nil, &config.SchemaError{Issues: []config.Issue{{
+				File:    configPath,
+				Field:   rule.field,
+				Message: fmt.Sprintf("must be 0 or more, got %d", rule.n),
+			}}}
+		}
+	}
+	if cfg.Scope != "" {
+		scope := path.Clean(filepath.ToSlash(cfg.Scope))
+		if path.IsAbs(scope) || scope == ".." || strings.HasPrefix(scope, "../") {
+			return nil, &config.SchemaError{Issues: []config.Issue{{
+				File:    configPath,
+				Field:   "scope",
+				Message: fmt.Sprintf("must be a directory inside the repo, got %q", cfg.Scope),
+			}}}
+		}
+		if scope == "." {
+			scope = ""
+		}
+		cfg.Scope = scope
+	}
+	if cfg.Remote.Host != "" {
+		if cfg.Remote.Dir == "" {
+			cfg.Remote.Dir = ".machinator-remote"
+		}
+		if cfg.Remote.Gemini == "" {
+			cfg.Remote.Gemini = "gemini"
+		}
+		// Docker containers and extra repos' worktrees are local only
+		for _, clash := range []struct {
+			field string
+			set   bool
+		}{
+			{"docker.image", cfg.Docker.Image != ""},
+			{"repos", len(cfg.Repos) > 0},
+		} {
+			if clash.set {
+				return nil, &config.SchemaError{Issues: []config.Issue{{
+					File:    configPath,
+					Field:   "remote.host",
+					Message: fmt.Sprintf("can't be used with %s", clash.field),
+				}}}
+			}
+		}
+	}
+	names := map[string]bool{}
+	for i := range cfg.Repos {
+		r := &cfg.Repos[i]
+		if r.Branch == "" {
+			r.Branch = "main"
+		}
+		field := fmt.Sprintf("repos[%d].name", i)
+		if !repoName.MatchString(r.Name) {
+			return nil, &config.SchemaError{Issues: []config.Issue{{
+				File:    configPath,
+				Field:   field,
+				Message: fmt.Sprintf("must be letters, digits, '.', '_' or '-', got %q", r.Name),
+			}}}
+		}
+		if names[r.Name] {
+			return nil, &config.SchemaError{Issues: []config.Issue{{
+				File:    configPath,
+				Field:   field,
+				Message: fmt.Sprintf("%q is used by another repo", r.Name),
+			}}}
+		}
+		names[r.Name] = true
+		if err := checkClone(configPath, fmt.Sprintf("repos[%d].clone", i), &r.Clone); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkClone(configPath, "clone", &cfg.Clone); err != nil {
+		return nil, err
+	}
+	if len(cfg.Clone.Sparse) > 0 {
+		// Agents need the beads, and a project's scope, whatever else is left out
+		for _, dir := range []string{".beads", cfg.Scope} {
+			if dir != "" && !slices.Contains(cfg.Clone.Sparse, dir) {
+				cfg.Clone.Sparse = append(cfg.Clone.Sparse, dir)
+			}
+		}
+	}
+	for model, limit := range cfg.ModelLimits {
+		if limit < 0 {
+			return nil, &config.SchemaError{Issues: []config.Issue{{
+				File:    configPath,
+				Field:   "model_limits." + model,
+				Message: fmt.Sprintf("must be 0 or more, got %d", limit),
+			}}}
+		}
 	}
 
 	return cfg, nil
 }
 
+// checkClone checks a clone config's depth and cleans its sparse
+// directories, which must be inside the repo.
+func checkClone(configPath, field string, c *CloneConfig) error {
+	if c.Depth < 0 {
+		return &config.SchemaError{Issues: []config.Issue{{
+			File:    configPath,
+			Field:   field + ".depth",
+			Message: fmt.Sprintf("must be 0 or more, got %d", c.Depth),
+		}}}
+	}
+	for i, dir := range c.Sparse {
+		clean := path.Clean(filepath.ToSlash(dir))
+		if path.IsAbs(clean) || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+			return &config.SchemaError{Issues: []config.Issue{{
+				File:    configPath,
+				Field:   fmt.Sprintf("%s.sparse[%d]", field, i),
+				Message: fmt.Sprintf("must be a directory inside the repo, got %q", dir),
+			}}}
+		}
+		c.Sparse[i] = clean
+	}
+	return nil
+}
+
+// repoName is a valid extra repo name: safe as a directory name.
+var repoName = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9._-]*$`)
+
+// ExtraRepo returns the extra repo with the given name, or nil.
+func (c *Config) ExtraRepo(name string) *RepoConfig {
+	for i := range c.Repos {
+		if c.Repos[i].Name == name {
+			return &c.Repos[i]
+		}
+	}
+	return nil
+}
+
 // Save saves project config to disk.
 func Save(machinatorDir string, projectID string, cfg *Config) error {
 	projectDir := filepath.Join(machinatorDir, "projects", projectID)
@@ -70,16 +595,70 @@ func Save(machinatorDir string, projectID string, cfg *Config) error {
 	return nil
 }
 
+// modelsMu guards the models ApplyLive changes while other goroutines run
+// with the config.
+var modelsMu sync.RWMutex
+
+// Models returns the simple and complex models as they are now.
+func (c *Config) Models() (simple, complex string) {
+	modelsMu.RLock()
+	defer modelsMu.RUnlock()
+	return c.SimpleModelName, c.ComplexModelName
+}
+
+// ApplyLive copies the settings that can change mid-run, the models, from
+// a reloaded config, describing each change.
+func (c *Config) ApplyLive(next *Config) []string {
+	modelsMu.Lock()
+	defer modelsMu.Unlock()
+	var changes []string
+	config.LiveSet(&changes, "simple_model_name", &c.SimpleModelName, next.SimpleModelName)
+	config.LiveSet(&changes, "complex_model_name", &c.ComplexModelName, next.ComplexModelName)
+	return changes
+}
+
+// SetModels changes the simple and complex models in a project's
+// config.json, keeping its comments.
+func SetModels(configPath, simple, complex string) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("read config: %w", err)
+	}
+	for _, kv := range [][2]string{{"simple_model_name", simple}, {"complex_model_name", complex}} {
+		value, _ := json.Marshal(kv[1])
+		if data, err = config.SetMember(data, kv[0], string(value)); err != nil {
+			return fmt.Errorf("%s: %w", configPath, err)
+		}
+	}
+	return os.WriteFile(configPath, data, 0644)
+}
+
 // RepoDir returns the path to the cloned repo.
 func RepoDir(machinatorDir, projectID string) string {
 	return filepath.Join(machinatorDir, "projects", projectID, "repo")
 }
 
+// ExtraRepoDir returns the path to the clone of a project's extra repo.
+func ExtraRepoDir(machinatorDir, projectID, name string) string {
+	return filepath.Join(machinatorDir, "projects", projectID, "repos", name)
+}
+
 // AgentDir returns the path to an agent's worktree.
 func AgentDir(machinatorDir, projectID string, agentID int) string {
 	return filepath.Join(machinatorDir, "projects", projectID, "agents", fmt.Sprintf("%d", agentID))
 }
 
+// ScratchDir returns a task's scratch space for temp files and downloads,
+// kept outside the worktree so it never shows up as uncommitted changes.
+func ScratchDir(machinatorDir, projectID, taskID string) string {
+	return filepath.Join(machinatorDir, "projects", projectID, "scratch", taskID)
+}
+
+// Dir returns the project's directory under MACHINATOR_DIR.
+func Dir(machinatorDir, projectID string) string {
+	return filepath.Join(machinatorDir, "projects", projectID)
+}
+
 // ConfigPath returns the path to the project config file.
 func ConfigPath(machinatorDir, projectID string) string {
 	return filepath.Join(machinatorDir, "projects", projectID, "config.json")
@@ -95,13 +674,213 @@ func Template() string {
   // Branch to track (default: "main")
   "branch": "main",
 
+  // More repositories tasks work in, e.g. a frontend next to this backend.
+  // Each agent gets a worktree of each at .repos/<name> inside its own.
+  // Tag a task REPO:<name> in its description (or label it repo:<name>)
+  // to tell the agent which repo it belongs to.
+  // Example: [{"name": "web", "repo": "git@github.com:me/web", "branch": "main",
+  //            "description": "React frontend"}]
+  "repos": [],
+
+  // Directory of the repo this project covers, for a monorepo shared by
+  // several projects, e.g. "services/payments". Agents start there, are
+  // told to change nothing outside it, and with merge.mode set a task
+  // branch that does isn't merged. Empty means the whole repo.
+  "scope": "",
+
+  // Clone big repos partially. "depth" clones only that many commits of
+  // history, "filter" leaves file contents out until they're needed
+  // ("blob:none"), and "sparse" checks out only the listed directories
+  // (plus top-level files, .beads and "scope") in the clone and every
+  // worktree. Extra repos take a "clone" of their own. Depth and filter
+  // apply to new clones.
+  // Example: {"depth": 50, "filter": "blob:none", "sparse": ["services/payments", "lib"]}
+  "clone": {"depth": 0, "filter": "", "sparse": []},
+
+  // Agents keep their worktrees from task to task; between tasks tracked
+  // files are reset and untracked ones removed, except ignored files and
+  // those matching "keep" (in extra repos too). New agents take over
+  // worktrees of agents that no longer exist before cloning fresh ones.
+  // Example: {"keep": ["node_modules", ".venv", "target"]}
+  "worktrees": {"keep": []},
+
+  // Run each agent's gemini in a container of its own, so it can't touch
+  // the host and gets the project's toolchain. The image needs bash, node,
+  // git and bd besides the toolchain; gemini is mounted from the host. The
+  // container sees only the agent's worktree, scratch space and account.
+  // Example: {"image": "ghcr.io/me/payments-agent:latest"}
+  "docker": {"image": ""},
+
+  // Run each agent's gemini on another machine over SSH, e.g. a build box.
+  // Before each run the agent's worktree, scratch space and account are
+  // mirrored to "dir" on the host (git push for commits, rsync for files);
+  // gemini's output streams back over the connection, and the worktree is
+  // mirrored back when it exits. Merging and everything else stay local.
+  // The host needs git, rsync, bd and gemini; agents run there unsandboxed.
+  // Can't be combined with "docker" or "repos".
+  // Example: {"host": "buildbox", "dir": ".machinator-remote", "gemini": "gemini"}
+  "remote": {"host": ""},
+
   // Model for simple/quick tasks (CHALLENGE:simple)
   // Example: "gemini-3-flash-preview", "gemini-2.5-flash"
   "simple_model_name": "gemini-3-flash-preview",
 
   // Model for complex tasks (CHALLENGE:complex)
   // Example: "gemini-3-pro-preview", "gemini-2.5-pro"  
-  "complex_model_name": "gemini-3-pro-preview"
+  "complex_model_name": "gemini-3-pro-preview",
+
+  // Most agents that may run each model at once; unlisted models are
+  // unlimited. When simple tasks' model is full they may upgrade to the
+  // complex model if it has room.
+  // Example: {"gemini-3-pro-preview": 2, "gemini-3-flash-preview": 8}
+  "model_limits": {},
+
+  // How agents take turns on accounts that have quota for their model:
+  //   "most_quota_remaining" - the fullest account (default)
+  //   "round_robin"          - each account in turn, in name order
+  //   "least_recently_used"  - the account idle the longest
+  // The account picked for each task and why is shown in its agent's log.
+  "account_rotation": "most_quota_remaining",
+
+  // Have the simple model judge open tasks without a CHALLENGE:simple or
+  // CHALLENGE:complex tag and write the tag back to the task, so tasks
+  // nobody tagged still reach the right model. Uses a little quota per task.
+  "estimate_complexity": false,
+
+  // Rules that tag untagged tasks complex without using quota; 0 or empty
+  // turns a rule off. Tasks no rule matches go to the model when
+  // estimate_complexity is on, and are tagged simple otherwise. The tag
+  // is written with the reason, e.g. "CHALLENGE:complex (mentions 6 files)".
+  "complexity": {
+    "description_length": 0, // e.g. 2000 characters
+    "file_count": 0,         // e.g. 5 files named in the description
+    "labels": []             // e.g. ["refactor", "architecture"]
+  },
+
+  // How to retry a task whose agent timed out:
+  //   "reset"      - start over from a clean worktree (default)
+  //   "checkpoint" - restore the interrupted attempt's changes and include
+  //                  them in the directive so the agent can continue
+  "resume_mode": "reset",
+
+  // Index the repo's code (locally, updated as it changes) and put the
+  // snippets most relevant to each task in its directive, so agents start
+  // in the right place in large repos. Build it ahead with "machinator index".
+  "context_index": false,
+
+  // Have agents work on a branch per task (machinator/<task ID>) and merge
+  // it into the branch above once the task is complete:
+  //   ""             - no task branches; agents push to the branch (default)
+  //   "fast_forward" - rebase the task branch onto the branch, then push it
+  //   "squash"       - add the task's changes as one commit
+  //   "pull_request" - push the task branch and open a pull request for
+  //                    it on the forge instead; the task is barred "in
+  //                    review" so it isn't redone before the PR merges
+  // The command, if set, runs on the merged result (e.g. "make test lint")
+  // and must pass for it to be pushed. Tasks whose branch conflicts or
+  // fails the command are barred with a "needs human" reason and a
+  // merge_failed event is sent; their branch is left for you to merge.
+  // With resolve_conflicts, the task's agent first gets a directive with
+  // the conflicting hunks to resolve them, and the merge is retried.
+  // prune_after, if set (e.g. "168h"), deletes task branches from origin
+  // once their task is closed and they've been merged and untouched that
+  // long. "machinator prune-branches --dry-run" lists what would go.
+  "merge": {
+    "mode": "",
+    "command": "",
+    "resolve_conflicts": false
+  },
+
+  // Command agents use to run the tests, available in directive templates
+  // as {{testCommand}}. Leave empty to detect (go test, npm test, ...).
+  // A custom directive template can be committed to the repo at
+  // .machinator/directive.tmpl or placed next to this file as directive.tmpl.
+  "test_command": "",
+
+  // Run the test command above (or the detected one) once an agent has
+  // closed its task, instead of trusting the agent ran it. If the tests
+  // fail, the attempt fails: the task is reopened (or its branch isn't
+  // merged) and the retry's directive shows the end of their output.
+  // Failed tests are rerun up to reruns times first. If the results
+  // differ, the failures that came and went are flaky: the task counts as
+  // complete and each gets a "Flaky test: <name>" task.
+  "test_gate": {
+    "enabled": false,
+    "timeout": "30m",
+    "reruns": 2
+  },
+
+  // Shell commands run in the agent's worktree, on this machine:
+  //   pre_task   - before the agent starts, e.g. "npm install"
+  //   post_task  - once it has completed its task, e.g. "make test"
+  //   on_failure - when an attempt fails or times out, e.g. to collect logs
+  // A failing pre_task fails the attempt, and so does a failing post_task
+  // when merge.mode is set (the task branch isn't merged); otherwise the
+  // agent has already pushed and it's only logged. Hooks get MACHINATOR_TASK_ID, MACHINATOR_TASK_TITLE,
+  // MACHINATOR_AGENT_ID, MACHINATOR_PROJECT_ID, MACHINATOR_BRANCH,
+  // MACHINATOR_SCRATCH_DIR and, for on_failure, MACHINATOR_FAILURE_REASON.
+  // Their output goes into the task's transcript.
+  "hooks": {
+    "pre_task": "",
+    "post_task": "",
+    "on_failure": "",
+    "timeout": "10m"
+  },
+
+  // Files an agent may change without it counting as uncommitted work
+  // (git glob patterns). Setting this replaces the defaults below.
+  // .beads is always ignored: task changes are synced separately.
+  // Example: add "package-lock.json" or "**/*.lock" for generated lockfiles
+  "ignore_changes": ["**/node_modules/**"],
+
+  // What happens to changes an agent leaves uncommitted when it exits.
+  // Changes to at most max_files files and max_lines lines are minor:
+  //   "discard" - throw minor changes away (default)
+  //   "stash"   - keep them too
+  // Anything bigger is always saved as a patch under
+  // $MACHINATOR_DIR/discarded/<task>/ before the worktree is reset.
+  "uncommitted": {
+    "policy": "discard",
+    "max_files": 1,
+    "max_lines": 20
+  },
+
+  // Code host for pull requests and CI status: "github", "gitlab" or
+  // "bitbucket". Leave empty to detect from the repo URL. The API token is
+  // read from GITHUB_TOKEN, GITLAB_TOKEN or BITBUCKET_TOKEN.
+  "forge": "",
+
+  // API base URL, only needed for self-hosted forges on unusual paths
+  // Example: "https://git.example.com/api/v4"
+  "forge_api_url": "",
+
+  // Where tasks come from. Leave kind empty to use the repo's beads.
+  // With "jira", issues matching the JQL query are worked like beads:
+  // To Do is ready, In Progress is assigned, Done is closed, and "is
+  // blocked by" links are dependencies. Agents are moved to In Progress
+  // when they start and to Done (with a completion comment) when they
+  // finish. The API token is read from JIRA_TOKEN.
+  // With "linear", issues with the label (in the team, if set) are worked
+  // the same way using the API key in LINEAR_API_KEY; url isn't needed.
+  // With "file", tasks come from a file in the repo: a YAML list of tasks
+  // (title, description, status, priority, complex, blocked_by, id) or a
+  // Markdown checklist such as TODO.md. Finished tasks are checked off and
+  // the change is pushed to the branch.
+  "tracker": {
+    "kind": "",
+    "url": "",       // e.g. "https://acme.atlassian.net"
+    "query": "",     // e.g. "project = ACME AND labels = machinator"
+    "project": "",   // Jira project for tasks added from the UI, e.g. "ACME"
+    "email": "",     // Jira Cloud account for the token
+    "label": "",     // Linear, e.g. "machinator"
+    "team": "",      // Linear team key, e.g. "ENG"
+    "path": ""       // File, e.g. "TODO.md" (default "tasks.yaml")
+  },
+
+  // Global config.json fields overridden while this project runs, e.g.
+  // {"timeouts": {"max_runtime": "1h"}, "max_task_attempts": 5}.
+  // Environment variables and --set still take precedence.
+  "settings": {}
 }
 `
 }
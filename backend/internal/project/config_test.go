@@ -0,0 +1,43 @@
+package project
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestApplyLiveModelsWhileReading(t *testing.T) {
+	cfg := &Config{SimpleModelName: "a", ComplexModelName: "b"}
+
+	stop := make(chan struct{})
+	var wg, started sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		started.Add(1)
+		go func() {
+			defer wg.Done()
+			started.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if simple, complex := cfg.Models(); simple+complex != "ab" && simple+complex != "cd" {
+					t.Errorf("Models() = %s, %s", simple, complex)
+				}
+			}
+		}()
+	}
+	started.Wait()
+	for i := 0; i < 1000; i++ {
+		next := &Config{SimpleModelName: "c", ComplexModelName: "d"}
+		if i%2 == 1 {
+			next = &Config{SimpleModelName: "a", ComplexModelName: "b"}
+		}
+		if changes := cfg.ApplyLive(next); len(changes) != 2 {
+			t.Fatalf("changes = %q", changes)
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
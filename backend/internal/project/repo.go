@@ -0,0 +1,108 @@
+package project
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bryantinsley/machinator/backend/internal/config"
+)
+
+// Files a project can keep in its repository, under RepoConfigDir, so its
+// orchestration settings are versioned with the code. Agents read them from
+// their worktree, so they apply once committed to the project's branch.
+const (
+	RepoConfigDir = ".machinator"
+	DirectiveFile = "directive.tmpl" // Directive template, see directive.LoadTemplate
+	VerifyFile    = "verify.sh"      // The test command, see directive.DetectTestCommand
+	SandboxFile   = "sandbox.json"   // SandboxProfile
+)
+
+// SandboxProfile widens the sandbox agents run in, from
+// .machinator/sandbox.json.
+type SandboxProfile struct {
+	// Hosts agents may connect to besides Gemini's, e.g.
+	// "registry.npmjs.org", or ".golang.org" for it and its subdomains.
+	// Only bubblewrap sandboxes (Linux) restrict hosts.
+	Hosts []string `json:"hosts"`
+}
+
+// LoadSandboxProfile reads the sandbox profile committed to the repo checked
+// out at dir. A missing file is an empty profile.
+func LoadSandboxProfile(dir string) (*SandboxProfile, []config.Issue, error) {
+	profile := &SandboxProfile{}
+	path := filepath.Join(dir, RepoConfigDir, SandboxFile)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return profile, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("read sandbox profile: %w", err)
+	}
+	warnings, err := config.Decode(path, data, profile)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, host := range profile.Hosts {
+		if strings.TrimLeft(host, ".") == "" || strings.ContainsAny(host, "/: ") {
+			return nil, nil, &config.SchemaError{Issues: []config.Issue{{
+				File: path, Field: "hosts", Message: fmt.Sprintf("%q isn't a host name", host),
+			}}}
+		}
+	}
+	return profile, warnings, nil
+}
+
+// Scaffold writes starting versions of the repo's .machinator files into
+// the checkout at repoDir: the directive template given, a verify.sh that
+// runs testCommand, and an empty sandbox profile. Existing files are left
+// alone. Returns the paths written, relative to repoDir; committing them
+// is up to the caller.
+func Scaffold(repoDir, directiveTemplate, testCommand string) ([]string, error) {
+	if testCommand == "" {
+		testCommand = `echo "verify.sh: no test command yet" >&2; exit 1`
+	}
+	files := []struct {
+		name    string
+		content string
+		mode    os.FileMode
+	}{
+		{DirectiveFile, directiveTemplate, 0644},
+		{VerifyFile, fmt.Sprintf(verifyTemplate, testCommand), 0755},
+		{SandboxFile, sandboxTemplate, 0644},
+	}
+
+	dir := filepath.Join(repoDir, RepoConfigDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create %s: %w", RepoConfigDir, err)
+	}
+	var written []string
+	for _, f := range files {
+		path := filepath.Join(dir, f.name)
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+		if err := os.WriteFile(path, []byte(f.content), f.mode); err != nil {
+			return written, fmt.Errorf("write %s: %w", f.name, err)
+		}
+		written = append(written, filepath.Join(RepoConfigDir, f.name))
+	}
+	return written, nil
+}
+
+const verifyTemplate = `#!/bin/sh
+# Checks the work in this repository. Agents are told to run it (it's the
+# project's test command unless test_command is set in the project config).
+# Run from the repository root; exit non-zero on failure.
+set -e
+%s
+`
+
+const sandboxTemplate = `{
+  // Hosts agents may connect to besides Gemini's, e.g. "registry.npmjs.org",
+  // or ".golang.org" for it and its subdomains. Only bubblewrap sandboxes
+  // (Linux) restrict hosts.
+  "hosts": []
+}
+`
@@ -2,12 +2,19 @@ package quota
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"slices"
+	"strings"
 	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/chaos"
+	"github.com/bryantinsley/machinator/backend/internal/config"
+	"github.com/bryantinsley/machinator/backend/internal/procgroup"
+	"github.com/bryantinsley/machinator/backend/internal/tools"
 )
 
 // Quota holds quota information for all accounts.
@@ -15,6 +22,8 @@ type Quota struct {
 	MachinatorDir string
 	Accounts      []AccountQuota
 	UpdatedAt     time.Time
+
+	used *usage // Shared with views for Pick
 }
 
 // AccountQuota holds quota for a single account.
@@ -22,19 +31,51 @@ type AccountQuota struct {
 	Name    string
 	HomeDir string
 	Models  map[string]float64 // model name -> remaining fraction (0.0 to 1.0)
+	Pins
+}
+
+// Pins restricts an account to some agents or projects, read from
+// accounts/<name>/account.json. Empty lists allow all.
+type Pins struct {
+	Agents   []int    `json:"agents,omitempty"`
+	Projects []string `json:"projects,omitempty"`
+}
+
+// Allows reports whether the account may be used by an agent of a project.
+func (p Pins) Allows(projectID string, agentID int) bool {
+	return (len(p.Agents) == 0 || slices.Contains(p.Agents, agentID)) &&
+		(len(p.Projects) == 0 || slices.Contains(p.Projects, projectID))
+}
+
+// accountFile is the name of an account's optional settings file.
+const accountFile = "account.json"
+
+// LoadPins reads an account's pins. A missing file pins nothing.
+func LoadPins(homeDir string) (Pins, error) {
+	var p Pins
+	path := filepath.Join(homeDir, accountFile)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return p, nil
+	} else if err != nil {
+		return p, err
+	}
+	_, err = config.Decode(path, data, &p)
+	return p, err
 }
 
 // New creates a new Quota instance.
 func New(machinatorDir string) *Quota {
 	return &Quota{
 		MachinatorDir: machinatorDir,
+		used:          &usage{},
 	}
 }
 
 // Refresh fetches quota for all discovered accounts.
 // Builds new data, then atomically swaps to avoid visible reload.
-func (q *Quota) Refresh() error {
-	accounts, err := q.discoverAccounts()
+func (q *Quota) Refresh(ctx context.Context) error {
+	accounts, err := q.AccountDirs()
 	if err != nil {
 		return fmt.Errorf("discover accounts: %w", err)
 	}
@@ -43,7 +84,13 @@ func (q *Quota) Refresh() error {
 	var newAccounts []AccountQuota
 	for _, homeDir := range accounts {
 		name := filepath.Base(homeDir)
-		models, err := fetchQuotaForAccount(q.MachinatorDir, homeDir)
+		pins, err := LoadPins(homeDir)
+		if err != nil {
+			// Skip rather than risk handing a pinned account to anyone
+			fmt.Fprintf(os.Stderr, "Warning: skipping account %s: %v\n", name, err)
+			continue
+		}
+		models, err := FetchAccount(ctx, q.MachinatorDir, homeDir)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Warning: quota fetch failed for %s: %v\n", name, err)
 			continue
@@ -53,6 +100,7 @@ func (q *Quota) Refresh() error {
 			Name:    name,
 			HomeDir: homeDir,
 			Models:  models,
+			Pins:    pins,
 		})
 	}
 
@@ -62,6 +110,20 @@ func (q *Quota) Refresh() error {
 	return nil
 }
 
+// For returns the quota of the accounts an agent of a project may use.
+func (q *Quota) For(projectID string, agentID int) *Quota {
+	if q.used == nil {
+		q.used = &usage{}
+	}
+	view := &Quota{MachinatorDir: q.MachinatorDir, UpdatedAt: q.UpdatedAt, used: q.used}
+	for _, acc := range q.Accounts {
+		if acc.Allows(projectID, agentID) {
+			view.Accounts = append(view.Accounts, acc)
+		}
+	}
+	return view
+}
+
 // TotalFor returns aggregate quota across all accounts for a model.
 func (q *Quota) TotalFor(model string) float64 {
 	total := 0.0
@@ -71,6 +133,39 @@ func (q *Quota) TotalFor(model string) float64 {
 	return total
 }
 
+// Models is the catalog of models dump-quota reports for any account, the
+// given ones first (e.g. the project's simple and complex models, in that
+// order) and the rest by name. Given models no account reports are left out.
+func (q *Quota) Models(first ...string) []string {
+	seen := map[string]bool{}
+	var rest []string
+	for _, acc := range q.Accounts {
+		for model := range acc.Models {
+			if !seen[model] {
+				seen[model] = true
+				if !slices.Contains(first, model) {
+					rest = append(rest, model)
+				}
+			}
+		}
+	}
+	slices.Sort(rest)
+	var models []string
+	for _, model := range first {
+		if seen[model] && !slices.Contains(models, model) {
+			models = append(models, model)
+		}
+	}
+	return append(models, rest...)
+}
+
+// ModelLabel shortens a model name for narrow displays:
+// "gemini-3-flash-preview" becomes "3-flash".
+func ModelLabel(model string) string {
+	label := strings.TrimPrefix(model, "gemini-")
+	return strings.TrimSuffix(label, "-preview")
+}
+
 // BestAccountFor returns the account with the most quota for a model.
 func (q *Quota) BestAccountFor(model string) (string, error) {
 	best := ""
@@ -87,7 +182,18 @@ func (q *Quota) BestAccountFor(model string) (string, error) {
 	return best, nil
 }
 
-func (q *Quota) discoverAccounts() ([]string, error) {
+// Account returns the account with the given name.
+func (q *Quota) Account(name string) (AccountQuota, bool) {
+	for _, acc := range q.Accounts {
+		if acc.Name == name {
+			return acc, true
+		}
+	}
+	return AccountQuota{}, false
+}
+
+// AccountDirs returns the home directories of all accounts.
+func (q *Quota) AccountDirs() ([]string, error) {
 	pattern := filepath.Join(q.MachinatorDir, "accounts", "*")
 	dirs, err := filepath.Glob(pattern)
 	if err != nil {
@@ -104,11 +210,14 @@ func (q *Quota) discoverAccounts() ([]string, error) {
 	return accounts, nil
 }
 
-func fetchQuotaForAccount(machinatorDir, homeDir string) (map[string]float64, error) {
+// FetchAccount asks gemini for an account's remaining quota by model. It
+// fails for an account that isn't signed in. gemini is killed, with
+// everything it started, when ctx is done.
+func FetchAccount(ctx context.Context, machinatorDir, homeDir string) (map[string]float64, error) {
 	geminiPath := filepath.Join(machinatorDir, "gemini")
 
-	cmd := exec.Command(geminiPath, "--dump-quota")
-	cmd.Env = append(os.Environ(),
+	cmd := procgroup.Command(ctx, geminiPath, "--dump-quota")
+	cmd.Env = append(tools.Environ(),
 		"HOME="+homeDir,
 		"GEMINI_CLI_HOME="+homeDir,
 		"GEMINI_FORCE_FILE_STORAGE=true",
@@ -120,7 +229,7 @@ func fetchQuotaForAccount(machinatorDir, homeDir string) (map[string]float64, er
 	}
 
 	// Extract JSON block (skip spurious output before/after)
-	jsonBytes := extractJSON(output)
+	jsonBytes := extractJSON(chaos.CorruptQuota(output))
 	if jsonBytes == nil {
 		return nil, fmt.Errorf("no JSON found in quota output")
 	}
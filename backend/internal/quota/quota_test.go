@@ -0,0 +1,70 @@
+package quota
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestForHonorsPins(t *testing.T) {
+	q := &Quota{Accounts: []AccountQuota{
+		{Name: "shared", Models: map[string]float64{"m": 0.5}},
+		{Name: "work", Models: map[string]float64{"m": 1.0}, Pins: Pins{Projects: []string{"2"}}},
+		{Name: "personal", Models: map[string]float64{"m": 0.25}, Pins: Pins{Agents: []int{1}, Projects: []string{"1"}}},
+	}}
+
+	tests := []struct {
+		project string
+		agent   int
+		want    float64
+	}{
+		{"1", 1, 0.75}, // shared + personal
+		{"1", 2, 0.5},  // shared only
+		{"2", 1, 1.5},  // shared + work
+	}
+	for _, tt := range tests {
+		if got := q.For(tt.project, tt.agent).TotalFor("m"); got != tt.want {
+			t.Errorf("For(%s, %d).TotalFor = %v, want %v", tt.project, tt.agent, got, tt.want)
+		}
+	}
+	if best, _ := q.For("1", 2).BestAccountFor("m"); best != "shared" {
+		t.Errorf("agent 2 of project 1 got %s, want shared", best)
+	}
+}
+
+func TestLoadPins(t *testing.T) {
+	dir := t.TempDir()
+	if p, err := LoadPins(dir); err != nil || !p.Allows("any", 9) {
+		t.Errorf("LoadPins without account.json = %+v, %v; want no pins", p, err)
+	}
+
+	os.WriteFile(filepath.Join(dir, accountFile), []byte(`{
+  // Personal account: only my side project
+  "projects": ["3"]
+}`), 0644)
+	p, err := LoadPins(dir)
+	if err != nil || p.Allows("1", 1) || !p.Allows("3", 1) {
+		t.Errorf("LoadPins = %+v, %v; want pinned to project 3", p, err)
+	}
+
+	os.WriteFile(filepath.Join(dir, accountFile), []byte(`{"agents": "one"}`), 0644)
+	if _, err := LoadPins(dir); err == nil {
+		t.Error("LoadPins accepted a malformed account.json")
+	}
+}
+
+func TestModels(t *testing.T) {
+	q := &Quota{Accounts: []AccountQuota{
+		{Name: "a", Models: map[string]float64{"gemini-3-pro-preview": 1, "gemini-embedding-001": 1}},
+		{Name: "b", Models: map[string]float64{"gemini-3-flash-preview": 0.5, "gemini-2.5-pro": 0}},
+	}}
+	got := q.Models("gemini-3-flash-preview", "gemini-3-pro-preview", "gemini-9-ultra")
+	want := []string{"gemini-3-flash-preview", "gemini-3-pro-preview", "gemini-2.5-pro", "gemini-embedding-001"}
+	if !slices.Equal(got, want) {
+		t.Errorf("Models = %v, want %v", got, want)
+	}
+	if got := ModelLabel("gemini-3-flash-preview"); got != "3-flash" {
+		t.Errorf("ModelLabel = %q", got)
+	}
+}
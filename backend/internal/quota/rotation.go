@@ -0,0 +1,112 @@
+package quota
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Account rotation strategies, set per project with account_rotation.
+const (
+	MostQuotaRemaining = "most_quota_remaining" // Default: drain the fullest account
+	RoundRobin         = "round_robin"          // Take turns, in account name order
+	LeastRecentlyUsed  = "least_recently_used"  // The account idle the longest
+)
+
+// Rotations lists the valid strategies.
+var Rotations = []string{MostQuotaRemaining, RoundRobin, LeastRecentlyUsed}
+
+// usage records when each account was last picked. It is shared by a Quota
+// and the views For returns, so every agent rotates through the same history.
+type usage struct {
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+// Pick chooses an account with quota for model using a rotation strategy
+// ("" is MostQuotaRemaining), records the use, and says why it was chosen.
+func (q *Quota) Pick(model, strategy string) (AccountQuota, string, error) {
+	if q.used == nil {
+		q.used = &usage{}
+	}
+	u := q.used
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.last == nil {
+		u.last = make(map[string]time.Time)
+	}
+
+	var candidates []AccountQuota
+	for _, acc := range q.Accounts {
+		if acc.Models[model] > 0 {
+			candidates = append(candidates, acc)
+		}
+	}
+	if len(candidates) == 0 {
+		return AccountQuota{}, "", fmt.Errorf("no account with quota for %s", model)
+	}
+
+	var pick AccountQuota
+	var reason string
+	switch strategy {
+	case RoundRobin:
+		pick, reason = u.roundRobin(q.Accounts, candidates)
+	case LeastRecentlyUsed:
+		pick, reason = u.leastRecentlyUsed(candidates, model)
+	case "", MostQuotaRemaining:
+		pick = candidates[0]
+		for _, acc := range candidates[1:] {
+			if acc.Models[model] > pick.Models[model] {
+				pick = acc
+			}
+		}
+		reason = fmt.Sprintf("most quota remaining (%.0f%%)", pick.Models[model]*100)
+	default:
+		return AccountQuota{}, "", fmt.Errorf("unknown account rotation %q", strategy)
+	}
+
+	u.last[pick.Name] = time.Now()
+	return pick, reason, nil
+}
+
+// roundRobin takes the first candidate after the most recently used
+// account, wrapping around the accounts in order.
+func (u *usage) roundRobin(accounts, candidates []AccountQuota) (AccountQuota, string) {
+	prev := -1
+	var prevAt time.Time
+	for i, acc := range accounts {
+		if at, ok := u.last[acc.Name]; ok && at.After(prevAt) {
+			prev, prevAt = i, at
+		}
+	}
+	if prev < 0 {
+		return candidates[0], "round robin, first turn"
+	}
+
+	for n := 1; n <= len(accounts); n++ {
+		next := accounts[(prev+n)%len(accounts)]
+		for _, c := range candidates {
+			if c.Name == next.Name {
+				return c, fmt.Sprintf("round robin, next after %s", accounts[prev].Name)
+			}
+		}
+	}
+	return candidates[0], "round robin, first turn" // Unreachable: candidates come from accounts
+}
+
+// leastRecentlyUsed takes the candidate idle the longest, preferring one
+// never used and, among equals, the one with more quota.
+func (u *usage) leastRecentlyUsed(candidates []AccountQuota, model string) (AccountQuota, string) {
+	pick := candidates[0]
+	for _, acc := range candidates[1:] {
+		a, b := u.last[acc.Name], u.last[pick.Name]
+		if a.Before(b) || (a.Equal(b) && acc.Models[model] > pick.Models[model]) {
+			pick = acc
+		}
+	}
+	at, ok := u.last[pick.Name]
+	if !ok {
+		return pick, "least recently used, never used"
+	}
+	return pick, fmt.Sprintf("least recently used, idle %s", time.Since(at).Round(time.Second))
+}
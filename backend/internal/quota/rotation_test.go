@@ -0,0 +1,61 @@
+package quota
+
+import (
+	"strings"
+	"testing"
+)
+
+func testQuota() *Quota {
+	q := New("")
+	q.Accounts = []AccountQuota{
+		{Name: "a", Models: map[string]float64{"m": 0.25}},
+		{Name: "b", Models: map[string]float64{"m": 0.75}},
+		{Name: "c", Models: map[string]float64{"m": 0}},
+		{Name: "d", Models: map[string]float64{"m": 0.5}},
+	}
+	return q
+}
+
+// picks returns the accounts n Picks choose, through views as agents would.
+func picks(t *testing.T, q *Quota, strategy string, n int) string {
+	t.Helper()
+	var names []string
+	for i := 0; i < n; i++ {
+		acc, reason, err := q.For("p", i).Pick("m", strategy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reason == "" {
+			t.Errorf("%s pick %d gave no reason", strategy, i)
+		}
+		names = append(names, acc.Name)
+	}
+	return strings.Join(names, " ")
+}
+
+func TestPickStrategies(t *testing.T) {
+	tests := []struct {
+		strategy string
+		want     string
+	}{
+		{MostQuotaRemaining, "b b b b"},
+		{"", "b b b b"},
+		{RoundRobin, "a b d a b"},          // c has no quota
+		{LeastRecentlyUsed, "b d a b d a"}, // Unused by most quota, then oldest
+	}
+	for _, tt := range tests {
+		if got := picks(t, testQuota(), tt.strategy, len(strings.Fields(tt.want))); got != tt.want {
+			t.Errorf("%q picked %s, want %s", tt.strategy, got, tt.want)
+		}
+	}
+}
+
+func TestPickErrors(t *testing.T) {
+	q := testQuota()
+	if _, _, err := q.Pick("other", RoundRobin); err == nil {
+		t.Error("Pick found quota for a model no account has")
+	}
+	if _, _, err := q.Pick("m", "random"); err == nil {
+		t.Error("Pick accepted an unknown strategy")
+	}
+}
@@ -0,0 +1,76 @@
+package rundb
+
+import (
+	"math"
+	"time"
+)
+
+// Forecast projects how long a model's quota lasts at the recent burn rate.
+type Forecast struct {
+	Model     string
+	Remaining float64 // Summed over accounts; 1.0 is one full account
+	Rate      float64 // Quota used per hour, summed over accounts; 0 if idle
+	// ExhaustedIn is how long the remaining quota lasts at Rate; zero
+	// when nothing is being used.
+	ExhaustedIn time.Duration
+	// TasksLeft is how many more runs the remaining quota covers at the
+	// quota used per run, or -1 when no run has used any yet.
+	TasksLeft int
+}
+
+// Forecast estimates a model's burn rate from the quota ledger and the
+// runs started over the window before now.
+func (d *DB) Forecast(model string, window time.Duration) (Forecast, error) {
+	since := time.Now().Add(-window)
+	samples, err := d.QuotaHistory(since)
+	if err != nil {
+		return Forecast{}, err
+	}
+	runs, err := d.queryRuns(`WHERE model = ? AND started_at >= ?`, model, since)
+	if err != nil {
+		return Forecast{}, err
+	}
+	return forecast(model, samples, len(runs)), nil
+}
+
+// forecast works out a Forecast from readings (oldest first) and the number
+// of runs on the model over the same time. Only decreases count as use:
+// quota going up is an account resetting.
+func forecast(model string, samples []QuotaSample, runs int) Forecast {
+	f := Forecast{Model: model, TasksLeft: -1}
+
+	last := make(map[string]float64) // Latest reading per account
+	var used float64
+	var first, latest time.Time
+	for _, s := range samples {
+		if s.Model != model {
+			continue
+		}
+		if prev, ok := last[s.Account]; ok && s.Remaining < prev {
+			used += prev - s.Remaining
+		}
+		last[s.Account] = s.Remaining
+		if first.IsZero() {
+			first = s.Time
+		}
+		latest = s.Time
+	}
+
+	// Accounts no longer in the latest refresh don't count toward what's left
+	for _, s := range samples {
+		if s.Model == model && s.Time.Equal(latest) {
+			f.Remaining += s.Remaining
+		}
+	}
+
+	elapsed := latest.Sub(first)
+	if used <= 0 || elapsed <= 0 {
+		return f
+	}
+	f.Rate = used / elapsed.Hours()
+	f.ExhaustedIn = time.Duration(f.Remaining / f.Rate * float64(time.Hour))
+	if runs > 0 {
+		f.TasksLeft = int(math.Floor(f.Remaining / (used / float64(runs))))
+	}
+	return f
+}
@@ -0,0 +1,36 @@
+package rundb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestForecast(t *testing.T) {
+	start := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	at := func(h float64) time.Time { return start.Add(time.Duration(h * float64(time.Hour))) }
+	samples := []QuotaSample{
+		{at(0), "a", "pro", 0.9},
+		{at(0), "b", "pro", 0.5},
+		{at(0), "a", "flash", 1.0},
+		{at(1), "a", "pro", 0.7},
+		{at(1), "b", "pro", 1.0}, // b reset: not use
+		{at(2), "a", "pro", 0.6},
+		{at(2), "b", "pro", 0.9},
+	}
+
+	f := forecast("pro", samples, 4)
+	// Used 0.2 + 0.1 + 0.1 = 0.4 over 2h; 1.5 left
+	if f.Remaining != 1.5 || f.Rate < 0.199 || f.Rate > 0.201 {
+		t.Errorf("remaining %v, rate %v; want 1.5, 0.2/h", f.Remaining, f.Rate)
+	}
+	if f.ExhaustedIn.Round(time.Minute) != 450*time.Minute {
+		t.Errorf("exhausted in %v, want 7h30m", f.ExhaustedIn)
+	}
+	if f.TasksLeft != 15 {
+		t.Errorf("tasks left %d, want 15 at 0.1 per run", f.TasksLeft)
+	}
+
+	if idle := forecast("flash", samples, 0); idle.Rate != 0 || idle.ExhaustedIn != 0 || idle.TasksLeft != -1 {
+		t.Errorf("idle model forecast = %+v, want no estimate", idle)
+	}
+}
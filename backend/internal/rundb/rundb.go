@@ -0,0 +1,591 @@
+package rundb
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// schema is applied on every open; statements must be idempotent.
+const schema = `
+CREATE TABLE IF NOT EXISTS settings (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS agents (
+	id                 INTEGER PRIMARY KEY,
+	state              TEXT NOT NULL,
+	pid                INTEGER NOT NULL DEFAULT 0,
+	task_id            TEXT NOT NULL DEFAULT '',
+	model              TEXT NOT NULL DEFAULT '',
+	started_at         DATETIME,
+	last_activity      DATETIME,
+	log_offset         INTEGER NOT NULL DEFAULT 0,
+	marked_for_removal INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS barred_tasks (
+	task_id   TEXT PRIMARY KEY,
+	barred_at DATETIME NOT NULL,
+	reason    TEXT NOT NULL DEFAULT ''
+);
+
+-- One row per attempt at a task. A row with no ended_at is an active claim.
+CREATE TABLE IF NOT EXISTS task_runs (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	task_id    TEXT NOT NULL,
+	agent_id   INTEGER NOT NULL,
+	model      TEXT NOT NULL DEFAULT '',
+	account    TEXT NOT NULL DEFAULT '',
+	started_at DATETIME NOT NULL,
+	ended_at   DATETIME,
+	outcome    TEXT NOT NULL DEFAULT '',
+	message    TEXT NOT NULL DEFAULT '',
+	tokens     INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS task_runs_task ON task_runs(task_id);
+
+-- Quota ledger: remaining fraction per account and model at each refresh.
+CREATE TABLE IF NOT EXISTS quota_samples (
+	sampled_at DATETIME NOT NULL,
+	account    TEXT NOT NULL,
+	model      TEXT NOT NULL,
+	remaining  REAL NOT NULL
+);
+CREATE INDEX IF NOT EXISTS quota_samples_time ON quota_samples(sampled_at);
+
+-- Run manifest: one row per orchestrator process, with the seed its
+-- randomized decisions were drawn from.
+CREATE TABLE IF NOT EXISTS sessions (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	started_at DATETIME NOT NULL,
+	ended_at   DATETIME,
+	project_id TEXT NOT NULL,
+	seed       INTEGER NOT NULL,
+	args       TEXT NOT NULL DEFAULT ''
+);
+
+-- Events bookmarked from the TUI for later review.
+CREATE TABLE IF NOT EXISTS pins (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	pinned_at  DATETIME NOT NULL,
+	task_id    TEXT NOT NULL,
+	agent_id   INTEGER NOT NULL,
+	run_id     INTEGER NOT NULL DEFAULT 0,
+	event_time DATETIME NOT NULL,
+	event_num  INTEGER NOT NULL, -- 1-based position in the task's transcript
+	text       TEXT NOT NULL
+);
+`
+
+// addedColumns brings databases created by older versions up to the
+// schema. ALTER TABLE has no IF NOT EXISTS, so duplicate column errors are
+// expected and ignored.
+var addedColumns = []string{
+	`ALTER TABLE barred_tasks ADD COLUMN reason TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE agents ADD COLUMN model TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE task_runs ADD COLUMN tokens INTEGER NOT NULL DEFAULT 0`,
+}
+
+// Run outcomes recorded in task_runs.
+const (
+	OutcomeCompleted = "completed"
+	OutcomeFailed    = "failed"
+	OutcomeTimedOut  = "timed_out"
+	OutcomeStopped   = "stopped" // Stopped by the user; not a failed attempt
+)
+
+// DB is the run database for one MACHINATOR_DIR.
+type DB struct {
+	db *sql.DB
+}
+
+// Path returns the database file location.
+func Path(machinatorDir string) string {
+	return filepath.Join(machinatorDir, "machinator.db")
+}
+
+// Open opens (creating if needed) the run database and applies the schema.
+func Open(machinatorDir string) (*DB, error) {
+	dsn := Path(machinatorDir) + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open run db: %w", err)
+	}
+	// SQLite allows one writer; serialize to avoid SQLITE_BUSY between goroutines
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("apply schema: %w", err)
+	}
+	for _, stmt := range addedColumns {
+		if _, err := db.Exec(stmt); err != nil && !strings.Contains(err.Error(), "duplicate column") {
+			db.Close()
+			return nil, fmt.Errorf("apply schema: %w", err)
+		}
+	}
+	return &DB{db: db}, nil
+}
+
+// Close closes the database.
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+// AgentRecord is the persisted form of an agent slot.
+type AgentRecord struct {
+	ID               int
+	State            string
+	PID              int
+	TaskID           string
+	Model            string
+	StartedAt        time.Time
+	LastActivity     time.Time
+	LogOffset        int64
+	MarkedForRemoval bool
+}
+
+// Snapshot is the full orchestrator state as stored in the database.
+type Snapshot struct {
+	Agents           []AgentRecord
+	AssignmentPaused bool
+	LaunchesPaused   bool
+	BarredTasks      []string
+	BarReasons       map[string]string // Why each barred task was barred, if known
+}
+
+// Empty reports whether nothing has been stored yet.
+func (s *Snapshot) Empty() bool {
+	return len(s.Agents) == 0 && len(s.BarredTasks) == 0 && !s.AssignmentPaused && !s.LaunchesPaused
+}
+
+// SaveSnapshot replaces the stored state in a single transaction.
+func (d *DB) SaveSnapshot(s Snapshot) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM agents`); err != nil {
+		return fmt.Errorf("clear agents: %w", err)
+	}
+	for _, a := range s.Agents {
+		if err := saveAgent(tx, a); err != nil {
+			return err
+		}
+	}
+
+	// Keep the original barred_at for tasks that stay barred
+	if _, err := tx.Exec(`CREATE TEMP TABLE IF NOT EXISTS keep_barred (task_id TEXT PRIMARY KEY)`); err != nil {
+		return fmt.Errorf("barred tasks: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM keep_barred`); err != nil {
+		return fmt.Errorf("barred tasks: %w", err)
+	}
+	for _, id := range s.BarredTasks {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO keep_barred (task_id) VALUES (?)`, id); err != nil {
+			return fmt.Errorf("barred tasks: %w", err)
+		}
+	}
+	if _, err := tx.Exec(`DELETE FROM barred_tasks WHERE task_id NOT IN (SELECT task_id FROM keep_barred)`); err != nil {
+		return fmt.Errorf("clear barred tasks: %w", err)
+	}
+	for _, id := range s.BarredTasks {
+		if _, err := tx.Exec(`INSERT INTO barred_tasks (task_id, barred_at, reason) VALUES (?, ?, ?)
+			ON CONFLICT(task_id) DO UPDATE SET reason = excluded.reason`, id, time.Now(), s.BarReasons[id]); err != nil {
+			return fmt.Errorf("insert barred task %s: %w", id, err)
+		}
+	}
+
+	settings := map[string]bool{
+		"assignment_paused": s.AssignmentPaused,
+		"launches_paused":   s.LaunchesPaused,
+	}
+	for key, v := range settings {
+		if _, err := tx.Exec(`INSERT INTO settings (key, value) VALUES (?, ?)
+			ON CONFLICT(key) DO UPDATE SET value = excluded.value`, key, fmt.Sprintf("%t", v)); err != nil {
+			return fmt.Errorf("save setting %s: %w", key, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// SaveAgent stores one agent slot, leaving the rest of the state as it is.
+func (d *DB) SaveAgent(a AgentRecord) error {
+	return saveAgent(d.db, a)
+}
+
+// execer is a *sql.DB or a *sql.Tx.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// saveAgent inserts or replaces an agent's row.
+func saveAgent(db execer, a AgentRecord) error {
+	_, err := db.Exec(`INSERT INTO agents (id, state, pid, task_id, model, started_at, last_activity, log_offset, marked_for_removal)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET state = excluded.state, pid = excluded.pid, task_id = excluded.task_id,
+			model = excluded.model, started_at = excluded.started_at, last_activity = excluded.last_activity,
+			log_offset = excluded.log_offset, marked_for_removal = excluded.marked_for_removal`,
+		a.ID, a.State, a.PID, a.TaskID, a.Model, a.StartedAt, a.LastActivity, a.LogOffset, a.MarkedForRemoval)
+	if err != nil {
+		return fmt.Errorf("save agent %d: %w", a.ID, err)
+	}
+	return nil
+}
+
+// LoadSnapshot reads the stored state.
+func (d *DB) LoadSnapshot() (Snapshot, error) {
+	var s Snapshot
+
+	rows, err := d.db.Query(`SELECT id, state, pid, task_id, model, started_at, last_activity, log_offset, marked_for_removal
+		FROM agents ORDER BY id`)
+	if err != nil {
+		return s, fmt.Errorf("query agents: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a AgentRecord
+		var started, active sql.NullTime
+		if err := rows.Scan(&a.ID, &a.State, &a.PID, &a.TaskID, &a.Model, &started, &active, &a.LogOffset, &a.MarkedForRemoval); err != nil {
+			return s, fmt.Errorf("scan agent: %w", err)
+		}
+		a.StartedAt = started.Time
+		a.LastActivity = active.Time
+		s.Agents = append(s.Agents, a)
+	}
+	if err := rows.Err(); err != nil {
+		return s, err
+	}
+
+	barred, err := d.db.Query(`SELECT task_id, reason FROM barred_tasks ORDER BY barred_at`)
+	if err != nil {
+		return s, fmt.Errorf("query barred tasks: %w", err)
+	}
+	defer barred.Close()
+	for barred.Next() {
+		var id, reason string
+		if err := barred.Scan(&id, &reason); err != nil {
+			return s, fmt.Errorf("scan barred task: %w", err)
+		}
+		s.BarredTasks = append(s.BarredTasks, id)
+		if reason != "" {
+			if s.BarReasons == nil {
+				s.BarReasons = make(map[string]string)
+			}
+			s.BarReasons[id] = reason
+		}
+	}
+	if err := barred.Err(); err != nil {
+		return s, err
+	}
+
+	s.AssignmentPaused = d.setting("assignment_paused") == "true"
+	s.LaunchesPaused = d.setting("launches_paused") == "true"
+	return s, nil
+}
+
+func (d *DB) setting(key string) string {
+	var v string
+	d.db.QueryRow(`SELECT value FROM settings WHERE key = ?`, key).Scan(&v)
+	return v
+}
+
+// StartRun records a new attempt at a task and returns its run ID.
+func (d *DB) StartRun(taskID string, agentID int, model, account string) (int64, error) {
+	res, err := d.db.Exec(`INSERT INTO task_runs (task_id, agent_id, model, account, started_at) VALUES (?, ?, ?, ?, ?)`,
+		taskID, agentID, model, account, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("start run: %w", err)
+	}
+	return res.LastInsertId()
+}
+
+// FinishRun records how a run ended and the tokens it used.
+func (d *DB) FinishRun(runID int64, outcome, message string, tokens int64) error {
+	_, err := d.db.Exec(`UPDATE task_runs SET ended_at = ?, outcome = ?, message = ?, tokens = ? WHERE id = ?`,
+		time.Now(), outcome, message, tokens, runID)
+	if err != nil {
+		return fmt.Errorf("finish run: %w", err)
+	}
+	return nil
+}
+
+// AbandonOpenRuns closes runs left open by a previous process (e.g. a crash).
+func (d *DB) AbandonOpenRuns() error {
+	_, err := d.db.Exec(`UPDATE task_runs SET ended_at = ?, outcome = ?, message = 'orchestrator exited'
+		WHERE ended_at IS NULL`, time.Now(), OutcomeFailed)
+	return err
+}
+
+// FailedAttempts counts failed or timed-out runs of a task since it last completed.
+func (d *DB) FailedAttempts(taskID string) (int, error) {
+	var n int
+	err := d.db.QueryRow(`SELECT COUNT(*) FROM task_runs
+		WHERE task_id = ? AND outcome IN (?, ?)
+		AND id > COALESCE((SELECT MAX(id) FROM task_runs WHERE task_id = ? AND outcome = ?), 0)`,
+		taskID, OutcomeFailed, OutcomeTimedOut, taskID, OutcomeCompleted).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("count attempts: %w", err)
+	}
+	return n, nil
+}
+
+// LastFailure returns the most recent failed or timed-out run, if any.
+func (d *DB) LastFailure() (Run, bool, error) {
+	runs, err := d.queryRuns(`WHERE outcome IN (?, ?) ORDER BY id DESC LIMIT 1`, OutcomeFailed, OutcomeTimedOut)
+	if err != nil || len(runs) == 0 {
+		return Run{}, false, err
+	}
+	return runs[0], true, nil
+}
+
+// Run is one recorded attempt at a task.
+type Run struct {
+	ID        int64
+	TaskID    string
+	AgentID   int
+	Model     string
+	Account   string
+	StartedAt time.Time
+	EndedAt   time.Time // Zero while running
+	Outcome   string
+	Message   string
+	Tokens    int64 // As reported by gemini; 0 if it didn't say
+}
+
+// OpenRuns returns runs that have started but not finished.
+func (d *DB) OpenRuns() ([]Run, error) {
+	return d.queryRuns(`WHERE ended_at IS NULL ORDER BY id`)
+}
+
+// CompletedRuns returns every run that completed its task, oldest first.
+func (d *DB) CompletedRuns() ([]Run, error) {
+	return d.queryRuns(`WHERE outcome = ? ORDER BY id`, OutcomeCompleted)
+}
+
+// TaskRuns returns every attempt at a task, oldest first.
+func (d *DB) TaskRuns(taskID string) ([]Run, error) {
+	return d.queryRuns(`WHERE task_id = ? ORDER BY id`, taskID)
+}
+
+// RunsSince returns the runs started since a point in time, oldest first.
+func (d *DB) RunsSince(since time.Time) ([]Run, error) {
+	return d.queryRuns(`WHERE started_at >= ? ORDER BY id`, since)
+}
+
+// RecentRuns returns the most recent runs, newest first.
+func (d *DB) RecentRuns(limit int) ([]Run, error) {
+	return d.queryRuns(`ORDER BY id DESC LIMIT ?`, limit)
+}
+
+func (d *DB) queryRuns(clause string, args ...any) ([]Run, error) {
+	rows, err := d.db.Query(`SELECT id, task_id, agent_id, model, account, started_at, ended_at, outcome, message, tokens
+		FROM task_runs `+clause, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []Run
+	for rows.Next() {
+		var r Run
+		var ended sql.NullTime
+		if err := rows.Scan(&r.ID, &r.TaskID, &r.AgentID, &r.Model, &r.Account, &r.StartedAt, &ended, &r.Outcome, &r.Message, &r.Tokens); err != nil {
+			return nil, fmt.Errorf("scan run: %w", err)
+		}
+		r.EndedAt = ended.Time
+		runs = append(runs, r)
+	}
+	return runs, rows.Err()
+}
+
+// RunStats summarizes finished runs since a point in time.
+type RunStats struct {
+	Completed   int
+	Failed      int
+	TimedOut    int
+	AvgDuration time.Duration // Mean duration of completed runs
+}
+
+// Stats returns run counts by outcome since the given time.
+func (d *DB) Stats(since time.Time) (RunStats, error) {
+	var st RunStats
+	runs, err := d.queryRuns(`WHERE ended_at IS NOT NULL AND started_at >= ?`, since)
+	if err != nil {
+		return st, err
+	}
+
+	var total time.Duration
+	for _, r := range runs {
+		switch r.Outcome {
+		case OutcomeCompleted:
+			st.Completed++
+			total += r.EndedAt.Sub(r.StartedAt)
+		case OutcomeFailed:
+			st.Failed++
+		case OutcomeTimedOut:
+			st.TimedOut++
+		}
+	}
+	if st.Completed > 0 {
+		st.AvgDuration = total / time.Duration(st.Completed)
+	}
+	return st, nil
+}
+
+// QuotaSample is one account/model reading from the quota ledger.
+type QuotaSample struct {
+	Time      time.Time
+	Account   string
+	Model     string
+	Remaining float64
+}
+
+// RecordQuota appends a quota reading for every account and model.
+func (d *DB) RecordQuota(at time.Time, accounts map[string]map[string]float64) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	for account, models := range accounts {
+		for model, remaining := range models {
+			if _, err := tx.Exec(`INSERT INTO quota_samples (sampled_at, account, model, remaining) VALUES (?, ?, ?, ?)`,
+				at, account, model, remaining); err != nil {
+				return fmt.Errorf("record quota: %w", err)
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// QuotaHistory returns quota readings since the given time, oldest first.
+func (d *DB) QuotaHistory(since time.Time) ([]QuotaSample, error) {
+	rows, err := d.db.Query(`SELECT sampled_at, account, model, remaining FROM quota_samples
+		WHERE sampled_at >= ? ORDER BY sampled_at`, since)
+	if err != nil {
+		return nil, fmt.Errorf("query quota history: %w", err)
+	}
+	defer rows.Close()
+
+	var samples []QuotaSample
+	for rows.Next() {
+		var q QuotaSample
+		if err := rows.Scan(&q.Time, &q.Account, &q.Model, &q.Remaining); err != nil {
+			return nil, fmt.Errorf("scan quota sample: %w", err)
+		}
+		samples = append(samples, q)
+	}
+	return samples, rows.Err()
+}
+
+// Session is one orchestrator process from the run manifest.
+type Session struct {
+	ID        int64
+	StartedAt time.Time
+	EndedAt   time.Time // Zero if still running or crashed
+	ProjectID string
+	Seed      int64
+	Args      string
+}
+
+// StartSession records the start of an orchestrator run and returns its ID.
+func (d *DB) StartSession(projectID string, seed int64, args string) (int64, error) {
+	res, err := d.db.Exec(`INSERT INTO sessions (started_at, project_id, seed, args) VALUES (?, ?, ?, ?)`,
+		time.Now(), projectID, seed, args)
+	if err != nil {
+		return 0, fmt.Errorf("start session: %w", err)
+	}
+	return res.LastInsertId()
+}
+
+// EndSession records a clean shutdown.
+func (d *DB) EndSession(id int64) error {
+	if _, err := d.db.Exec(`UPDATE sessions SET ended_at = ? WHERE id = ?`, time.Now(), id); err != nil {
+		return fmt.Errorf("end session: %w", err)
+	}
+	return nil
+}
+
+// Sessions returns the most recent sessions, newest first.
+func (d *DB) Sessions(limit int) ([]Session, error) {
+	rows, err := d.db.Query(`SELECT id, started_at, ended_at, project_id, seed, args
+		FROM sessions ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		var s Session
+		var ended sql.NullTime
+		if err := rows.Scan(&s.ID, &s.StartedAt, &ended, &s.ProjectID, &s.Seed, &s.Args); err != nil {
+			return nil, fmt.Errorf("scan session: %w", err)
+		}
+		s.EndedAt = ended.Time
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// Pin is an event bookmarked for later review.
+type Pin struct {
+	ID        int64
+	PinnedAt  time.Time
+	TaskID    string
+	AgentID   int
+	RunID     int64
+	EventTime time.Time
+	EventNum  int // 1-based position in the task's transcript
+	Text      string
+}
+
+// AddPin bookmarks an event and returns the pin's ID.
+func (d *DB) AddPin(p Pin) (int64, error) {
+	res, err := d.db.Exec(`INSERT INTO pins (pinned_at, task_id, agent_id, run_id, event_time, event_num, text)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		time.Now(), p.TaskID, p.AgentID, p.RunID, p.EventTime, p.EventNum, p.Text)
+	if err != nil {
+		return 0, fmt.Errorf("add pin: %w", err)
+	}
+	return res.LastInsertId()
+}
+
+// DeletePin removes a bookmark.
+func (d *DB) DeletePin(id int64) error {
+	if _, err := d.db.Exec(`DELETE FROM pins WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("delete pin: %w", err)
+	}
+	return nil
+}
+
+// Pins returns every bookmark in the order the events happened.
+func (d *DB) Pins() ([]Pin, error) {
+	rows, err := d.db.Query(`SELECT id, pinned_at, task_id, agent_id, run_id, event_time, event_num, text
+		FROM pins ORDER BY event_time, id`)
+	if err != nil {
+		return nil, fmt.Errorf("query pins: %w", err)
+	}
+	defer rows.Close()
+
+	var pins []Pin
+	for rows.Next() {
+		var p Pin
+		if err := rows.Scan(&p.ID, &p.PinnedAt, &p.TaskID, &p.AgentID, &p.RunID, &p.EventTime, &p.EventNum, &p.Text); err != nil {
+			return nil, fmt.Errorf("scan pin: %w", err)
+		}
+		pins = append(pins, p)
+	}
+	return pins, rows.Err()
+}
@@ -0,0 +1,120 @@
+package rundb
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	db, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	empty, err := db.LoadSnapshot()
+	if err != nil || !empty.Empty() {
+		t.Fatalf("new database: snapshot = %+v, err = %v; want empty", empty, err)
+	}
+
+	started := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	want := Snapshot{
+		Agents: []AgentRecord{
+			{ID: 1, State: "assigned", PID: 4242, TaskID: "t-1", Model: "pro", StartedAt: started, LastActivity: started.Add(time.Minute), LogOffset: 512},
+			{ID: 2, State: "ready", MarkedForRemoval: true},
+		},
+		LaunchesPaused: true,
+		BarredTasks:    []string{"t-2", "t-3"},
+		BarReasons:     map[string]string{"t-2": "needs human: conflict"},
+	}
+	if err := db.SaveSnapshot(want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := db.LoadSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range got.Agents {
+		// Compare instants, not locations
+		got.Agents[i].StartedAt = got.Agents[i].StartedAt.UTC()
+		got.Agents[i].LastActivity = got.Agents[i].LastActivity.UTC()
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadSnapshot = %+v\nwant %+v", got, want)
+	}
+
+	// Saving again replaces: an agent removed and a task unbarred are gone
+	want.Agents = want.Agents[:1]
+	want.BarredTasks = []string{"t-2"}
+	want.LaunchesPaused = false
+	if err := db.SaveSnapshot(want); err != nil {
+		t.Fatal(err)
+	}
+	got, _ = db.LoadSnapshot()
+	if len(got.Agents) != 1 || !reflect.DeepEqual(got.BarredTasks, want.BarredTasks) || got.LaunchesPaused {
+		t.Errorf("after second save: %+v", got)
+	}
+}
+
+func TestSaveAgent(t *testing.T) {
+	db, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.SaveSnapshot(Snapshot{
+		Agents:      []AgentRecord{{ID: 1, State: "ready"}, {ID: 2, State: "ready"}},
+		BarredTasks: []string{"t-1"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SaveAgent(AgentRecord{ID: 2, State: "assigned", TaskID: "t-2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SaveAgent(AgentRecord{ID: 3, State: "pending"}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, _ := db.LoadSnapshot()
+	want := []AgentRecord{{ID: 1, State: "ready"}, {ID: 2, State: "assigned", TaskID: "t-2"}, {ID: 3, State: "pending"}}
+	if !reflect.DeepEqual(got.Agents, want) {
+		t.Errorf("agents = %+v, want %+v", got.Agents, want)
+	}
+	if !reflect.DeepEqual(got.BarredTasks, []string{"t-1"}) {
+		t.Errorf("barred tasks = %v, want them untouched", got.BarredTasks)
+	}
+}
+
+func TestAbandonOpenRuns(t *testing.T) {
+	db, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	done, _ := db.StartRun("t-1", 1, "pro", "a")
+	db.FinishRun(done, OutcomeCompleted, "", 100)
+	open, _ := db.StartRun("t-2", 2, "pro", "a")
+	if err := db.AbandonOpenRuns(); err != nil {
+		t.Fatal(err)
+	}
+
+	outcome := func(id int64) (string, string) {
+		var outcome, message string
+		if err := db.db.QueryRow(`SELECT outcome, message FROM task_runs WHERE id = ? AND ended_at IS NOT NULL`, id).Scan(&outcome, &message); err != nil {
+			t.Fatalf("run %d: %v", id, err)
+		}
+		return outcome, message
+	}
+	if got, _ := outcome(done); got != OutcomeCompleted {
+		t.Errorf("finished run outcome = %q, want it kept", got)
+	}
+	if got, msg := outcome(open); got != OutcomeFailed || msg != "orchestrator exited" {
+		t.Errorf("open run = %q %q, want failed, orchestrator exited", got, msg)
+	}
+	if n, _ := db.FailedAttempts("t-2"); n != 1 {
+		t.Errorf("abandoned run counts as %d failed attempts, want 1", n)
+	}
+}
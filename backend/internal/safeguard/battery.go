@@ -0,0 +1,73 @@
+package safeguard
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Battery is the state of the machine's battery.
+type Battery struct {
+	Percent     int  // Charge left, 0-100
+	Discharging bool // Running on battery rather than mains power
+}
+
+// ReadBattery returns the battery state, with ok false on machines without
+// a battery or where it can't be read (pmset on macOS, sysfs on Linux).
+func ReadBattery() (b Battery, ok bool) {
+	switch runtime.GOOS {
+	case "darwin":
+		out, err := exec.Command("pmset", "-g", "batt").Output()
+		if err != nil {
+			return Battery{}, false
+		}
+		return parsePmset(string(out))
+	case "linux":
+		return readSysfs("/sys/class/power_supply")
+	}
+	return Battery{}, false
+}
+
+// pmsetPercent matches the charge in a pmset battery line, e.g.
+// " -InternalBattery-0 (id=1234)	85%; discharging; 3:12 remaining".
+var pmsetPercent = regexp.MustCompile(`(\d+)%;`)
+
+// parsePmset reads `pmset -g batt` output.
+func parsePmset(out string) (Battery, bool) {
+	m := pmsetPercent.FindStringSubmatch(out)
+	if m == nil {
+		return Battery{}, false // Desktop Mac: "Now drawing from 'AC Power'" only
+	}
+	percent, _ := strconv.Atoi(m[1])
+	return Battery{Percent: percent, Discharging: strings.Contains(out, "'Battery Power'")}, true
+}
+
+// readSysfs reads the first battery under root, a power_supply class
+// directory.
+func readSysfs(root string) (Battery, bool) {
+	supplies, _ := filepath.Glob(filepath.Join(root, "*"))
+	for _, dir := range supplies {
+		if read(dir, "type") != "Battery" {
+			continue
+		}
+		percent, err := strconv.Atoi(read(dir, "capacity"))
+		if err != nil {
+			continue
+		}
+		return Battery{Percent: percent, Discharging: read(dir, "status") == "Discharging"}, true
+	}
+	return Battery{}, false
+}
+
+// read returns the trimmed contents of a sysfs attribute, or "".
+func read(dir, name string) string {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
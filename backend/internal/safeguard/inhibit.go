@@ -0,0 +1,70 @@
+package safeguard
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// Inhibitor keeps the machine from going to sleep while held: caffeinate
+// on macOS, systemd-inhibit on Linux. The zero value is ready to use.
+type Inhibitor struct {
+	mu  sync.Mutex
+	cmd *exec.Cmd
+}
+
+// inhibitCommand returns the command that inhibits sleep for as long as it
+// runs, which is until process pid exits, or nil if goos has none. Tying
+// it to machinator's pid means a crash doesn't leave the machine awake.
+func inhibitCommand(goos string, pid int) []string {
+	switch goos {
+	case "darwin":
+		return []string{"caffeinate", "-i", "-w", strconv.Itoa(pid)}
+	case "linux":
+		return []string{"systemd-inhibit", "--what=idle:sleep", "--who=machinator",
+			"--why=Agents are running", "--mode=block",
+			"tail", "--pid=" + strconv.Itoa(pid), "-f", "/dev/null"}
+	}
+	return nil
+}
+
+// Hold starts inhibiting sleep, if it isn't already.
+func (i *Inhibitor) Hold() error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.cmd != nil {
+		return nil
+	}
+	args := inhibitCommand(runtime.GOOS, os.Getpid())
+	if args == nil {
+		return fmt.Errorf("no sleep inhibitor on %s", runtime.GOOS)
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("start %s: %w", args[0], err)
+	}
+	go cmd.Wait()
+	i.cmd = cmd
+	return nil
+}
+
+// Release lets the machine sleep again.
+func (i *Inhibitor) Release() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.cmd == nil {
+		return
+	}
+	i.cmd.Process.Kill()
+	i.cmd = nil
+}
+
+// Held reports whether sleep is being inhibited.
+func (i *Inhibitor) Held() bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.cmd != nil
+}
@@ -0,0 +1,41 @@
+// Package safeguard checks that the machine can keep running agents: that
+// the disk under MACHINATOR_DIR has room for more worktrees and logs and,
+// on a laptop running on battery, that there's charge left. It also keeps
+// the machine awake while they run.
+package safeguard
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// Check returns why new tasks shouldn't be started, or "" if they can. A
+// minimum of 0 turns its check off; a failed check is returned as the
+// reason, except that machines without a battery always pass that one.
+func Check(dir string, minFreeDiskMB, minBattery int) string {
+	if minFreeDiskMB > 0 {
+		free, err := FreeDisk(dir)
+		if err != nil {
+			return fmt.Sprintf("check free disk: %v", err)
+		}
+		if free < uint64(minFreeDiskMB)<<20 {
+			return fmt.Sprintf("only %d MB free under %s (minimum %d MB)", free>>20, dir, minFreeDiskMB)
+		}
+	}
+	if minBattery > 0 {
+		if b, ok := ReadBattery(); ok && b.Discharging && b.Percent < minBattery {
+			return fmt.Sprintf("battery at %d%% and discharging (minimum %d%%); plug in to resume", b.Percent, minBattery)
+		}
+	}
+	return ""
+}
+
+// FreeDisk returns the bytes available to unprivileged users on the
+// filesystem holding dir.
+func FreeDisk(dir string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
@@ -0,0 +1,95 @@
+package safeguard
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParsePmset(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want Battery
+		ok   bool
+	}{
+		{
+			name: "on battery",
+			out:  "Now drawing from 'Battery Power'\n -InternalBattery-0 (id=4653155)\t15%; discharging; 0:41 remaining present: true\n",
+			want: Battery{Percent: 15, Discharging: true},
+			ok:   true,
+		},
+		{
+			name: "charging",
+			out:  "Now drawing from 'AC Power'\n -InternalBattery-0 (id=4653155)\t87%; charging; 0:32 remaining present: true\n",
+			want: Battery{Percent: 87},
+			ok:   true,
+		},
+		{
+			name: "no battery",
+			out:  "Now drawing from 'AC Power'\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parsePmset(tt.out)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("parsePmset = %+v, %v, want %+v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestReadSysfs(t *testing.T) {
+	root := t.TempDir()
+	supply := func(name string, attrs map[string]string) {
+		dir := filepath.Join(root, name)
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		for attr, value := range attrs {
+			if err := os.WriteFile(filepath.Join(dir, attr), []byte(value+"\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if _, ok := readSysfs(root); ok {
+		t.Error("readSysfs with no supplies reported a battery")
+	}
+
+	supply("AC", map[string]string{"type": "Mains", "online": "0"})
+	supply("BAT0", map[string]string{"type": "Battery", "capacity": "12", "status": "Discharging"})
+	got, ok := readSysfs(root)
+	if want := (Battery{Percent: 12, Discharging: true}); !ok || got != want {
+		t.Errorf("readSysfs = %+v, %v, want %+v, true", got, ok, want)
+	}
+}
+
+func TestCheckDisk(t *testing.T) {
+	dir := t.TempDir()
+	if msg := Check(dir, 0, 0); msg != "" {
+		t.Errorf("Check with checks off = %q, want \"\"", msg)
+	}
+	if msg := Check(dir, 1, 0); msg != "" {
+		t.Errorf("Check(1 MB) = %q, want \"\"", msg)
+	}
+	if msg := Check(dir, 1<<30, 0); !strings.Contains(msg, "MB free") {
+		t.Errorf("Check(1 PB) = %q, want a low disk reason", msg)
+	}
+}
+
+func TestInhibitCommand(t *testing.T) {
+	if args := inhibitCommand("darwin", 42); strings.Join(args, " ") != "caffeinate -i -w 42" {
+		t.Errorf("darwin: %q", args)
+	}
+	args := inhibitCommand("linux", 42)
+	if len(args) == 0 || args[0] != "systemd-inhibit" || !slices.Contains(args, "--pid=42") {
+		t.Errorf("linux: %q", args)
+	}
+	if args := inhibitCommand("windows", 42); args != nil {
+		t.Errorf("windows: %q, want nil", args)
+	}
+}
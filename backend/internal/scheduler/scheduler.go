@@ -0,0 +1,164 @@
+// Package scheduler holds the orchestrator's scheduling decisions: which
+// task an agent claims and on which model, when a run has gone on too long,
+// and when a task has failed too often to retry. It does no I/O; the
+// watchers in cmd/machinator feed it state and act on its answers.
+package scheduler
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/beads"
+	"github.com/bryantinsley/machinator/backend/internal/project"
+)
+
+// Claims says which tasks can't be claimed right now. *state.State
+// implements it.
+type Claims interface {
+	IsTaskBarred(taskID string) bool   // Barred by hand or after too many failures
+	IsTaskAssigned(taskID string) bool // Already claimed by an agent
+	InCooldown(taskID string) bool     // Just killed, kept back for a while
+}
+
+// Select picks a claimable task from the most urgent tier that has one.
+// Within the tier, a draw weighted by Weight picks the kind of task
+// (complex or simple), and the oldest task of that kind is taken: tasks
+// come in ReadyTasks order, oldest first, so none starves behind newer
+// ones. Draws come from rng so a run's choices replay exactly under the
+// same seed. Returns nil if no task can be claimed with the quota given.
+func Select(tasks []*beads.Task, simpleQuota, complexQuota float64, claims Claims, rng *rand.Rand) *beads.Task {
+	var candidates []*beads.Task
+	var weights []float64
+	total := 0.0
+	for _, task := range tasks {
+		// A more urgent candidate hides less urgent ones
+		if len(candidates) > 0 && task.Urgency > candidates[0].Urgency {
+			continue
+		}
+		if claims.IsTaskBarred(task.ID) || claims.IsTaskAssigned(task.ID) || claims.InCooldown(task.ID) {
+			continue
+		}
+
+		w := Weight(task, simpleQuota, complexQuota)
+		if w <= 0 {
+			continue // No quota for its model
+		}
+		if len(candidates) > 0 && task.Urgency < candidates[0].Urgency {
+			candidates, weights, total = nil, nil, 0
+		}
+		candidates = append(candidates, task)
+		weights = append(weights, w)
+		total += w
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	picked := weights[len(weights)-1]
+	r := rng.Float64() * total
+	for _, w := range weights {
+		if r < w {
+			picked = w
+			break
+		}
+		r -= w
+	}
+	return candidates[slices.Index(weights, picked)]
+}
+
+// Weight is a task's relative chance of being picked. Complex tasks are
+// favoured so the scarcer complex-model quota is put to use; a task whose
+// model has no quota left gets 0.
+func Weight(task *beads.Task, simpleQuota, complexQuota float64) float64 {
+	switch {
+	case task.IsComplex && complexQuota > 0:
+		return 5.0
+	case task.IsComplex:
+		return 0
+	case simpleQuota > 0 || complexQuota > 0:
+		return 1.0 // Simple tasks upgrade to complex when needed
+	default:
+		return 0
+	}
+}
+
+// Model is the model a task runs on: complex tasks need the complex model,
+// and simple ones upgrade to it when the simple model has no quota (or
+// room) left.
+func Model(projCfg *project.Config, task *beads.Task, simpleQuota, complexQuota float64) string {
+	simple, complex := projCfg.Models()
+	if task.IsComplex || (simpleQuota <= 0 && complexQuota > 0) {
+		return complex
+	}
+	return simple
+}
+
+// AtModelLimit reports whether model already runs on as many agents as the
+// project's model_limits allow.
+func AtModelLimit(projCfg *project.Config, running map[string]int, model string) bool {
+	limit, ok := projCfg.ModelLimits[model]
+	return ok && running[model] >= limit
+}
+
+// Remove returns tasks without the one with id, e.g. once it's claimed.
+func Remove(tasks []*beads.Task, id string) []*beads.Task {
+	var result []*beads.Task
+	for _, t := range tasks {
+		if t.ID != id {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+// TimedOut returns why a run that started at started and last showed
+// activity at lastActivity should be killed at now, or "" if it shouldn't.
+func TimedOut(now, started, lastActivity time.Time, idle, maxRuntime time.Duration) string {
+	switch {
+	case now.Sub(lastActivity) > idle:
+		return fmt.Sprintf("idle timeout (%s)", idle)
+	case now.Sub(started) > maxRuntime:
+		return fmt.Sprintf("max runtime exceeded (%s)", maxRuntime)
+	}
+	return ""
+}
+
+// GiveUp reports whether a task that has failed attempts times should be
+// barred rather than retried. maxAttempts 0 retries forever.
+func GiveUp(attempts, maxAttempts int) bool {
+	return maxAttempts > 0 && attempts >= maxAttempts
+}
+
+// Idle is an agent without a task, and since when, for Autoscale.
+type Idle struct {
+	ID    int
+	Since time.Time
+}
+
+// Autoscale sizes the agent pool to the backlog of claimable tasks. While
+// the backlog outnumbers the idle and pending agents, agents are added up
+// to maxAgents; otherwise agents idle for idleAfter that the backlog
+// doesn't need are removed, highest ID first, down to minAgents. total
+// counts every agent.
+func Autoscale(total, pending, backlog int, idle []Idle, minAgents, maxAgents int, idleAfter time.Duration, now time.Time) (add int, remove []int) {
+	spare := len(idle) + pending
+	if backlog > spare {
+		return max(0, min(backlog-spare, maxAgents-total)), nil
+	}
+
+	var stale []int
+	for _, a := range idle {
+		if now.Sub(a.Since) >= idleAfter {
+			stale = append(stale, a.ID)
+		}
+	}
+	slices.Sort(stale)
+	slices.Reverse(stale)
+	n := min(len(stale), spare-backlog, total-minAgents)
+	if n <= 0 {
+		return 0, nil
+	}
+	return 0, stale[:n]
+}
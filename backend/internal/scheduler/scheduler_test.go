@@ -0,0 +1,182 @@
+package scheduler
+
+import (
+	"math/rand"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/beads"
+	"github.com/bryantinsley/machinator/backend/internal/project"
+)
+
+// claims is a Claims for tests.
+type claims struct {
+	barred, assigned, cooling map[string]bool
+}
+
+func (c claims) IsTaskBarred(id string) bool   { return c.barred[id] }
+func (c claims) IsTaskAssigned(id string) bool { return c.assigned[id] }
+func (c claims) InCooldown(id string) bool     { return c.cooling[id] }
+
+func task(id string, urgency int, complex bool) *beads.Task {
+	return &beads.Task{ID: id, Urgency: urgency, IsComplex: complex}
+}
+
+func TestSelectTakesMostUrgentClaimableTier(t *testing.T) {
+	tasks := []*beads.Task{task("a", 0, false), task("b", 0, false), task("c", 1, false), task("d", 2, false)}
+	c := claims{
+		barred:   map[string]bool{"a": true},
+		assigned: map[string]bool{"b": true},
+	}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		if got := Select(tasks, 1, 1, c, rng); got == nil || got.ID != "c" {
+			t.Fatalf("Select = %v, want c (tier 0 all claimed)", got)
+		}
+	}
+
+	c.cooling = map[string]bool{"c": true}
+	if got := Select(tasks, 1, 1, c, rng); got == nil || got.ID != "d" {
+		t.Errorf("Select = %v, want d (c cooling down)", got)
+	}
+	if got := Select(tasks, 0, 0, claims{}, rng); got != nil {
+		t.Errorf("Select without quota = %v, want nil", got)
+	}
+}
+
+func TestSelectWeightsComplexTasks(t *testing.T) {
+	tasks := []*beads.Task{task("simple", 0, false), task("complex", 0, true)}
+	rng := rand.New(rand.NewSource(7))
+	picked := make(map[string]int)
+	for i := 0; i < 6000; i++ {
+		picked[Select(tasks, 1, 1, claims{}, rng).ID]++
+	}
+	// 5:1, so about 5000:1000
+	if picked["complex"] < 4700 || picked["complex"] > 5300 {
+		t.Errorf("picked %v, want complex about 5 times as often", picked)
+	}
+
+	// Without complex quota the complex task can't be claimed at all
+	for i := 0; i < 20; i++ {
+		if got := Select(tasks, 1, 0, claims{}, rng); got.ID != "simple" {
+			t.Fatalf("Select = %s without complex quota", got.ID)
+		}
+	}
+}
+
+func TestSelectTakesOldestOfKindInTier(t *testing.T) {
+	// In ReadyTasks order: most urgent, then oldest first
+	tasks := []*beads.Task{task("old", 1, false), task("old-complex", 1, true), task("new", 1, false), task("new-complex", 1, true), task("later", 2, false)}
+	rng := rand.New(rand.NewSource(3))
+	picked := make(map[string]int)
+	for i := 0; i < 1200; i++ {
+		picked[Select(tasks, 1, 1, claims{}, rng).ID]++
+	}
+	if picked["new"] > 0 || picked["new-complex"] > 0 || picked["later"] > 0 {
+		t.Errorf("picked %v, want only the oldest task of each kind", picked)
+	}
+	// Still 5:1 per task: 10 of 12 draws complex
+	if picked["old-complex"] < 900 || picked["old-complex"] > 1100 {
+		t.Errorf("picked %v, want old-complex about 5 times as often", picked)
+	}
+
+	// Once the oldest is claimed, the next oldest goes
+	c := claims{assigned: map[string]bool{"old": true}}
+	if got := Select(tasks, 1, 0, c, rng); got == nil || got.ID != "new" {
+		t.Errorf("Select = %v, want new (old claimed, no complex quota)", got)
+	}
+}
+
+func TestSelectReplaysUnderSameSeed(t *testing.T) {
+	tasks := []*beads.Task{task("a", 0, false), task("b", 0, true), task("c", 0, false)}
+	draw := func() []string {
+		rng := rand.New(rand.NewSource(42))
+		var ids []string
+		for i := 0; i < 10; i++ {
+			ids = append(ids, Select(tasks, 1, 1, claims{}, rng).ID)
+		}
+		return ids
+	}
+	first, second := draw(), draw()
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("draws differ: %v vs %v", first, second)
+		}
+	}
+}
+
+func TestModelAndLimits(t *testing.T) {
+	projCfg := &project.Config{
+		SimpleModelName:  "flash",
+		ComplexModelName: "pro",
+		ModelLimits:      map[string]int{"pro": 1},
+	}
+	if got := Model(projCfg, task("a", 0, true), 1, 1); got != "pro" {
+		t.Errorf("complex task on %s", got)
+	}
+	if got := Model(projCfg, task("a", 0, false), 1, 1); got != "flash" {
+		t.Errorf("simple task on %s", got)
+	}
+	if got := Model(projCfg, task("a", 0, false), 0, 1); got != "pro" {
+		t.Errorf("simple task without simple quota on %s, want the upgrade", got)
+	}
+
+	running := map[string]int{"pro": 1}
+	if !AtModelLimit(projCfg, running, "pro") || AtModelLimit(projCfg, running, "flash") {
+		t.Errorf("AtModelLimit wrong for %v under %v", running, projCfg.ModelLimits)
+	}
+}
+
+func TestTimedOut(t *testing.T) {
+	now := time.Now()
+	idle, maxRuntime := 10*time.Minute, 30*time.Minute
+	for _, tt := range []struct {
+		started, active time.Duration // Before now
+		want            string
+	}{
+		{5 * time.Minute, time.Minute, ""},
+		{20 * time.Minute, 11 * time.Minute, "idle timeout (10m0s)"},
+		{31 * time.Minute, time.Minute, "max runtime exceeded (30m0s)"},
+	} {
+		if got := TimedOut(now, now.Add(-tt.started), now.Add(-tt.active), idle, maxRuntime); got != tt.want {
+			t.Errorf("started %s ago, active %s ago: %q, want %q", tt.started, tt.active, got, tt.want)
+		}
+	}
+}
+
+func TestGiveUp(t *testing.T) {
+	if GiveUp(2, 3) || !GiveUp(3, 3) || GiveUp(100, 0) {
+		t.Error("GiveUp should bar at max_task_attempts, and never when it's 0")
+	}
+}
+
+func TestAutoscale(t *testing.T) {
+	now := time.Now()
+	idle := func(ids ...int) []Idle {
+		var agents []Idle
+		for _, id := range ids {
+			agents = append(agents, Idle{ID: id, Since: now.Add(-time.Duration(id) * time.Minute)})
+		}
+		return agents
+	}
+	for _, tt := range []struct {
+		name                  string
+		total, pending, tasks int
+		idle                  []Idle
+		add                   int
+		remove                []int
+	}{
+		{"backlog grows", 3, 0, 6, idle(1), 5, nil},
+		{"capped at max", 8, 0, 10, nil, 2, nil},
+		{"pending agents will take tasks", 4, 2, 2, nil, 0, nil},
+		{"idle long enough, highest first", 5, 0, 0, idle(4, 2, 5, 1), 0, []int{5, 4}},
+		{"idle agents the backlog needs stay", 5, 0, 1, idle(4, 5), 0, []int{5}},
+		{"kept at min", 2, 0, 0, idle(4, 5), 0, []int{5}},
+	} {
+		add, remove := Autoscale(tt.total, tt.pending, tt.tasks, tt.idle, 1, 10, 3*time.Minute, now)
+		if add != tt.add || !slices.Equal(remove, tt.remove) {
+			t.Errorf("%s: Autoscale = %d, %v; want %d, %v", tt.name, add, remove, tt.add, tt.remove)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+// Package seed makes a run's randomized decisions reproducible. One seed is
+// chosen per run (or given with --seed) and every subsystem derives its own
+// independent stream from it, so adding randomness in one place doesn't
+// change the decisions made in another.
+package seed
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	mrand "math/rand"
+	"strconv"
+)
+
+// Seed is the root of all randomness for one run.
+type Seed int64
+
+// New picks a fresh random seed.
+func New() Seed {
+	var b [8]byte
+	rand.Read(b[:])
+	// Keep it positive so it's easy to copy from logs
+	return Seed(binary.LittleEndian.Uint64(b[:]) >> 1)
+}
+
+// Parse reads a seed given on the command line.
+func Parse(s string) (Seed, error) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid seed %q: must be an integer", s)
+	}
+	return Seed(n), nil
+}
+
+// Stream returns a random source for a named decision stream. The same seed
+// and name always produce the same sequence. Sources are not safe for
+// concurrent use; give each goroutine its own stream.
+func (s Seed) Stream(name string) *mrand.Rand {
+	return mrand.New(mrand.NewSource(s.Derive(name)))
+}
+
+// Derive returns a sub-seed for a named stream.
+func (s Seed) Derive(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(s) ^ int64(h.Sum64())
+}
+
+func (s Seed) String() string {
+	return strconv.FormatInt(int64(s), 10)
+}
@@ -0,0 +1,29 @@
+package seed
+
+import "testing"
+
+func TestStreamsAreReproducibleAndIndependent(t *testing.T) {
+	s := Seed(42)
+	a1, a2 := s.Stream("assign"), s.Stream("assign")
+	for i := 0; i < 10; i++ {
+		if x, y := a1.Int63(), a2.Int63(); x != y {
+			t.Fatalf("draw %d: same stream gave %d and %d", i, x, y)
+		}
+	}
+
+	if s.Derive("assign") == s.Derive("chaos") {
+		t.Error("different streams share a seed")
+	}
+	if Seed(43).Derive("assign") == s.Derive("assign") {
+		t.Error("different seeds give the same stream")
+	}
+}
+
+func TestParse(t *testing.T) {
+	if s, err := Parse("1234"); err != nil || s != 1234 {
+		t.Errorf("Parse(1234) = %d, %v", s, err)
+	}
+	if _, err := Parse("abc"); err == nil {
+		t.Error("Parse(abc) accepted")
+	}
+}
@@ -0,0 +1,89 @@
+package setup
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bryantinsley/machinator/backend/internal/beads"
+	"github.com/bryantinsley/machinator/backend/internal/tools"
+)
+
+// hookMarker identifies the pre-commit hook machinator installs.
+const hookMarker = "# Installed by machinator: keep beads databases out of git"
+
+// guardHook rejects commits that stage a beads database file.
+var guardHook = "#!/bin/sh\n" + hookMarker + `
+if git diff --cached --name-only | grep -Eq '^\.beads/[^/]*\.db(-.*)?$'; then
+  echo "machinator: refusing to commit beads database files (.beads/*.db); commit .beads/issues.jsonl instead" >&2
+  exit 1
+fi
+`
+
+// GuardBeadsDB keeps agents from committing beads database binaries in a
+// clone and all its worktrees: the files are excluded from git add, and a
+// pre-commit hook rejects them if they are already tracked. An existing
+// hook that machinator didn't write is left alone.
+func GuardBeadsDB(repoDir string) error {
+	gitDir, err := commonGitDir(repoDir)
+	if err != nil {
+		return err
+	}
+	if err := exclude(gitDir, beads.DBPatterns); err != nil {
+		return err
+	}
+
+	hookPath := filepath.Join(gitDir, "hooks", "pre-commit")
+	if current, err := os.ReadFile(hookPath); err == nil && !bytes.Contains(current, []byte(hookMarker)) {
+		return nil // Someone else's hook
+	}
+	if err := os.MkdirAll(filepath.Dir(hookPath), 0755); err != nil {
+		return fmt.Errorf("create hooks dir: %w", err)
+	}
+	if err := os.WriteFile(hookPath, []byte(guardHook), 0755); err != nil {
+		return fmt.Errorf("write pre-commit hook: %w", err)
+	}
+	return nil
+}
+
+// commonGitDir returns the git directory shared by a clone and all its
+// worktrees.
+func commonGitDir(repoDir string) (string, error) {
+	out, err := tools.Command(tools.Git, "-C", repoDir, "rev-parse", "--git-common-dir").Output()
+	if err != nil {
+		return "", fmt.Errorf("git rev-parse: %w", err)
+	}
+	gitDir := strings.TrimSpace(string(out))
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(repoDir, gitDir)
+	}
+	return gitDir, nil
+}
+
+// exclude adds patterns missing from a git directory's info/exclude.
+func exclude(gitDir string, patterns []string) error {
+	excludePath := filepath.Join(gitDir, "info", "exclude")
+	existing, _ := os.ReadFile(excludePath)
+	var add []string
+	for _, pattern := range patterns {
+		if !bytes.Contains(existing, []byte("\n"+pattern+"\n")) && !bytes.HasPrefix(existing, []byte(pattern+"\n")) {
+			add = append(add, pattern)
+		}
+	}
+	if len(add) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(excludePath), 0755); err != nil {
+		return fmt.Errorf("create info dir: %w", err)
+	}
+	if len(existing) > 0 && !bytes.HasSuffix(existing, []byte("\n")) {
+		existing = append(existing, '\n')
+	}
+	existing = append(existing, strings.Join(add, "\n")+"\n"...)
+	if err := os.WriteFile(excludePath, existing, 0644); err != nil {
+		return fmt.Errorf("write exclude: %w", err)
+	}
+	return nil
+}
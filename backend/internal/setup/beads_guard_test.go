@@ -0,0 +1,44 @@
+package setup
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGuardBeadsDB(t *testing.T) {
+	dir := t.TempDir()
+	git := func(args ...string) (string, error) {
+		out, err := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=t", "-c", "user.email=t@t"}, args...)...).CombinedOutput()
+		return string(out), err
+	}
+	git("init", "-q")
+	os.MkdirAll(filepath.Join(dir, ".beads"), 0755)
+	os.WriteFile(filepath.Join(dir, ".beads", "issues.jsonl"), []byte("{}\n"), 0644)
+	os.WriteFile(filepath.Join(dir, ".beads", "beads.db"), []byte("db"), 0644)
+
+	for i := 0; i < 2; i++ { // Idempotent
+		if err := GuardBeadsDB(dir); err != nil {
+			t.Fatalf("GuardBeadsDB: %v", err)
+		}
+	}
+	exclude, _ := os.ReadFile(filepath.Join(dir, ".git", "info", "exclude"))
+	if n := strings.Count(string(exclude), ".beads/*.db\n"); n != 1 {
+		t.Errorf("exclude has %d entries for .beads/*.db:\n%s", n, exclude)
+	}
+
+	git("add", "-A")
+	if out, _ := git("diff", "--cached", "--name-only"); strings.Contains(out, "beads.db") {
+		t.Errorf("database staged by add -A: %s", out)
+	}
+	if _, err := git("commit", "-qm", "jsonl"); err != nil {
+		t.Fatalf("commit of issues.jsonl rejected: %v", err)
+	}
+
+	git("add", "-f", ".beads/beads.db")
+	if out, err := git("commit", "-qm", "db"); err == nil {
+		t.Errorf("commit of beads.db accepted: %s", out)
+	}
+}
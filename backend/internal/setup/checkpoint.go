@@ -0,0 +1,214 @@
+package setup
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/tools"
+)
+
+// CheckpointPath returns where the saved diff for a task lives.
+func (s *Setup) CheckpointPath(projectID int, taskID string) string {
+	return filepath.Join(s.MachinatorDir, "projects", fmt.Sprintf("%d", projectID), "checkpoints", taskID+".patch")
+}
+
+// beadsPaths are never counted as uncommitted work: task changes are synced
+// through the beads layer and the database is a local cache.
+var beadsPaths = []string{".beads/**"}
+
+// pathspec selects the whole worktree except .beads and files matching
+// ignore (git glob patterns).
+func pathspec(ignore []string) []string {
+	args := []string{"--", "."}
+	for _, pattern := range append(beadsPaths, ignore...) {
+		args = append(args, ":(exclude,glob)"+pattern)
+	}
+	return args
+}
+
+// UncommittedFiles lists files with uncommitted changes (including new
+// files), leaving out those matching ignore.
+func UncommittedFiles(worktreeDir string, ignore []string) ([]string, error) {
+	args := append([]string{"-C", worktreeDir, "status", "--porcelain", "--untracked-files=all"}, pathspec(ignore)...)
+	out, err := tools.Command(tools.Git, args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("git status: %w", err)
+	}
+	var files []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if len(line) > 3 {
+			files = append(files, line[3:])
+		}
+	}
+	return files, nil
+}
+
+// WorktreeDiff returns the worktree's uncommitted changes (including new
+// files) as a binary-safe diff against HEAD, leaving out files matching
+// ignore.
+func WorktreeDiff(worktreeDir string, ignore []string) ([]byte, error) {
+	// Stage everything so untracked files show up in the diff, then unstage
+	cmd := tools.Command(tools.Git, "-C", worktreeDir, "add", "-A")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("git add: %w\nOutput: %s", err, out)
+	}
+	defer tools.Command(tools.Git, "-C", worktreeDir, "reset", "-q").Run()
+
+	args := append([]string{"-C", worktreeDir, "diff", "--cached", "--binary", "HEAD"}, pathspec(ignore)...)
+	cmd = tools.Command(tools.Git, args...)
+	diff, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git diff: %w", err)
+	}
+	return diff, nil
+}
+
+// DiffSize counts the files in a diff and the lines it adds or removes.
+func DiffSize(diff []byte) (files, lines int) {
+	inHunk := false // Past the file header, where ---/+++ name the files
+	for _, line := range strings.Split(string(diff), "\n") {
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			files++
+			inHunk = false
+		case strings.HasPrefix(line, "@@"):
+			inHunk = true
+		case inHunk && (strings.HasPrefix(line, "+") || strings.HasPrefix(line, "-")):
+			lines++
+		}
+	}
+	return files, lines
+}
+
+// DiscardedDir returns where uncommitted changes kept from a task's runs
+// are saved.
+func (s *Setup) DiscardedDir(taskID string) string {
+	return filepath.Join(s.MachinatorDir, "discarded", taskID)
+}
+
+// SaveDiscarded saves a diff of uncommitted changes about to be reset away,
+// named for the time, and returns its path.
+func (s *Setup) SaveDiscarded(taskID string, diff []byte) (string, error) {
+	dir := s.DiscardedDir(taskID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("create discarded dir: %w", err)
+	}
+	path := filepath.Join(dir, time.Now().Format("20060102-150405")+".patch")
+	if err := os.WriteFile(path, diff, 0644); err != nil {
+		return "", fmt.Errorf("write discarded changes: %w", err)
+	}
+	return path, nil
+}
+
+// SaveCheckpoint records the worktree's uncommitted changes for a task,
+// except files matching ignore. Returns false if there were none.
+func (s *Setup) SaveCheckpoint(projectID int, taskID, worktreeDir string, ignore []string) (bool, error) {
+	diff, err := WorktreeDiff(worktreeDir, ignore)
+	if err != nil {
+		return false, err
+	}
+	if len(bytes.TrimSpace(diff)) == 0 {
+		return false, nil
+	}
+
+	path := s.CheckpointPath(projectID, taskID)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return false, fmt.Errorf("create checkpoints dir: %w", err)
+	}
+	if err := os.WriteFile(path, diff, 0644); err != nil {
+		return false, fmt.Errorf("write checkpoint: %w", err)
+	}
+	return true, nil
+}
+
+// LoadCheckpoint returns the saved diff for a task, or "" if there is none.
+func (s *Setup) LoadCheckpoint(projectID int, taskID string) (string, error) {
+	data, err := os.ReadFile(s.CheckpointPath(projectID, taskID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("read checkpoint: %w", err)
+	}
+	return string(data), nil
+}
+
+// RestoreCheckpoint applies a task's saved diff onto a (clean) worktree.
+func (s *Setup) RestoreCheckpoint(projectID int, taskID, worktreeDir string) error {
+	cmd := tools.Command(tools.Git, "-C", worktreeDir, "apply", "--binary", "--whitespace=nowarn", s.CheckpointPath(projectID, taskID))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git apply: %w\nOutput: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// RemoveCheckpoint deletes a task's saved diff, if any.
+func (s *Setup) RemoveCheckpoint(projectID int, taskID string) error {
+	err := os.Remove(s.CheckpointPath(projectID, taskID))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Failure is what a failed or timed-out attempt left behind, kept so the
+// retry's directive can tell the model what went wrong.
+type Failure struct {
+	Time   time.Time `json:"time"`
+	Reason string    `json:"reason"`
+	Events []string  `json:"events,omitempty"` // Last lines of the agent's output
+	Diff   string    `json:"diff,omitempty"`   // Uncommitted changes that were discarded
+	// TestOutput is the end of the test gate's output, when it failed
+	TestOutput string `json:"test_output,omitempty"`
+}
+
+// FailurePath returns where the last failure of a task is recorded.
+func (s *Setup) FailurePath(projectID int, taskID string) string {
+	return filepath.Join(s.MachinatorDir, "projects", fmt.Sprintf("%d", projectID), "checkpoints", taskID+".failure.json")
+}
+
+// SaveFailure records a task's latest failure, replacing any earlier one.
+func (s *Setup) SaveFailure(projectID int, taskID string, f Failure) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal failure: %w", err)
+	}
+	path := s.FailurePath(projectID, taskID)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create checkpoints dir: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("write failure: %w", err)
+	}
+	return nil
+}
+
+// LoadFailure returns a task's latest failure, or nil if there is none.
+func (s *Setup) LoadFailure(projectID int, taskID string) (*Failure, error) {
+	data, err := os.ReadFile(s.FailurePath(projectID, taskID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read failure: %w", err)
+	}
+	var f Failure
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse failure: %w", err)
+	}
+	return &f, nil
+}
+
+// RemoveFailure deletes a task's failure record, if any.
+func (s *Setup) RemoveFailure(projectID int, taskID string) error {
+	err := os.Remove(s.FailurePath(projectID, taskID))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
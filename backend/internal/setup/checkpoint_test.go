@@ -0,0 +1,146 @@
+package setup
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUncommittedChangesSkipIgnored(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(content), 0644)
+	}
+
+	gitT(t, dir, "init", "-q")
+	write("main.go", "package main\n")
+	gitT(t, dir, "add", "-A")
+	gitT(t, dir, "commit", "-qm", "init")
+
+	ignore := []string{"**/node_modules/**"}
+	write(".beads/beads.db", "binary")
+	write("web/node_modules/x/index.js", "junk")
+
+	files, err := UncommittedFiles(dir, ignore)
+	if err != nil || len(files) != 0 {
+		t.Fatalf("only ignored changes: files = %v, err = %v", files, err)
+	}
+	if diff, _ := WorktreeDiff(dir, ignore); len(diff) != 0 {
+		t.Errorf("diff includes ignored files:\n%s", diff)
+	}
+
+	write("main.go", "package main\n\nfunc main() {}\n")
+	write("new.go", "package main\n")
+	files, _ = UncommittedFiles(dir, ignore)
+	if want := []string{"main.go", "new.go"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("files = %v, want %v", files, want)
+	}
+	diff, _ := WorktreeDiff(dir, ignore)
+	if !strings.Contains(string(diff), "new.go") || strings.Contains(string(diff), "beads.db") {
+		t.Errorf("unexpected diff:\n%s", diff)
+	}
+}
+
+func TestDiffSize(t *testing.T) {
+	diff := `diff --git a/main.go b/main.go
+--- a/main.go
++++ b/main.go
+@@ -1 +1,2 @@
+-package main
++package main // edited
++
+--- not a header
+diff --git a/new.go b/new.go
+new file mode 100644
+--- /dev/null
++++ b/new.go
+@@ -0,0 +1 @@
++package main
+`
+	if files, lines := DiffSize([]byte(diff)); files != 2 || lines != 5 {
+		t.Errorf("DiffSize = %d files, %d lines, want 2, 5", files, lines)
+	}
+}
+
+func TestCheckpointRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(content), 0644)
+	}
+	s := New(t.TempDir())
+
+	gitT(t, dir, "init", "-q")
+	write("main.go", "package main\n")
+	gitT(t, dir, "add", "-A")
+	gitT(t, dir, "commit", "-qm", "init")
+
+	if saved, err := s.SaveCheckpoint(1, "t-1", dir, nil); saved || err != nil {
+		t.Fatalf("clean worktree: saved = %v, err = %v", saved, err)
+	}
+	if diff, err := s.LoadCheckpoint(1, "t-1"); diff != "" || err != nil {
+		t.Fatalf("no checkpoint: diff = %q, err = %v", diff, err)
+	}
+
+	write("main.go", "package main\n\nfunc main() {}\n")
+	write("pkg/new.go", "package pkg\n")
+	write("build/out.bin", "\x00\x01")
+	if saved, err := s.SaveCheckpoint(1, "t-1", dir, []string{"build/**"}); !saved || err != nil {
+		t.Fatalf("SaveCheckpoint = %v, %v", saved, err)
+	}
+	if diff, _ := s.LoadCheckpoint(1, "t-1"); !strings.Contains(diff, "pkg/new.go") || strings.Contains(diff, "out.bin") {
+		t.Errorf("checkpoint doesn't hold just the unignored changes:\n%s", diff)
+	}
+
+	// A fresh run starts from a clean worktree
+	gitT(t, dir, "reset", "-q", "--hard")
+	gitT(t, dir, "clean", "-qfdx")
+	if err := s.RestoreCheckpoint(1, "t-1", dir); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "main.go")); string(data) != "package main\n\nfunc main() {}\n" {
+		t.Errorf("main.go = %q after restore", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "pkg/new.go")); err != nil {
+		t.Errorf("new file not restored: %v", err)
+	}
+
+	if err := s.RemoveCheckpoint(1, "t-1"); err != nil {
+		t.Fatal(err)
+	}
+	if diff, _ := s.LoadCheckpoint(1, "t-1"); diff != "" {
+		t.Errorf("checkpoint still there after RemoveCheckpoint")
+	}
+	if err := s.RemoveCheckpoint(1, "t-1"); err != nil {
+		t.Errorf("removing a missing checkpoint: %v", err)
+	}
+}
+
+func TestRestoreCheckpointConflict(t *testing.T) {
+	dir := t.TempDir()
+	s := New(t.TempDir())
+
+	gitT(t, dir, "init", "-q")
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("one\n"), 0644)
+	gitT(t, dir, "add", "-A")
+	gitT(t, dir, "commit", "-qm", "init")
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("two\n"), 0644)
+	if _, err := s.SaveCheckpoint(1, "t-1", dir, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The branch moved on under the checkpoint
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("three\n"), 0644)
+	gitT(t, dir, "commit", "-qam", "moved")
+	if err := s.RestoreCheckpoint(1, "t-1", dir); err == nil {
+		t.Error("RestoreCheckpoint applied a diff that no longer fits")
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "a.txt")); string(data) != "three\n" {
+		t.Errorf("a.txt = %q after a failed restore, want it untouched", data)
+	}
+}
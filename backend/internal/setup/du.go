@@ -0,0 +1,95 @@
+package setup
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// ProjectUsage is the disk space a project's directory takes, by part.
+type ProjectUsage struct {
+	Repo        int64         // Its clone, objects and all
+	ExtraRepos  int64         // Clones of its extra repos
+	Worktrees   map[int]int64 // By agent; they share the clone's objects
+	Scratch     int64         // Tasks' scratch space
+	Checkpoints int64         // Saved attempts and failure records
+	Other       int64         // Config and anything else
+}
+
+// WorktreesTotal is the space all the agents' worktrees take.
+func (u ProjectUsage) WorktreesTotal() int64 {
+	var total int64
+	for _, size := range u.Worktrees {
+		total += size
+	}
+	return total
+}
+
+// Total is the space the whole project takes.
+func (u ProjectUsage) Total() int64 {
+	return u.Repo + u.ExtraRepos + u.WorktreesTotal() + u.Scratch + u.Checkpoints + u.Other
+}
+
+// MeasureProject measures the project directory at projectDir. It walks
+// every file, so it takes a while for big repos.
+func MeasureProject(projectDir string) (ProjectUsage, error) {
+	u := ProjectUsage{Worktrees: make(map[int]int64)}
+	entries, err := os.ReadDir(projectDir)
+	if err != nil {
+		return u, err
+	}
+	for _, e := range entries {
+		path := filepath.Join(projectDir, e.Name())
+		if e.Name() == "agents" && e.IsDir() {
+			agents, err := os.ReadDir(path)
+			if err != nil {
+				return u, err
+			}
+			for _, a := range agents {
+				size, err := DirSize(filepath.Join(path, a.Name()))
+				if err != nil {
+					return u, err
+				}
+				if id, err := strconv.Atoi(a.Name()); err == nil {
+					u.Worktrees[id] = size
+				} else {
+					u.Other += size
+				}
+			}
+			continue
+		}
+
+		size, err := DirSize(path)
+		if err != nil {
+			return u, err
+		}
+		switch e.Name() {
+		case "repo":
+			u.Repo = size
+		case "repos":
+			u.ExtraRepos = size
+		case "scratch":
+			u.Scratch = size
+		case "checkpoints":
+			u.Checkpoints = size
+		default:
+			u.Other += size
+		}
+	}
+	return u, nil
+}
+
+// FormatSize formats a size in bytes for people, e.g. "1.4 GB".
+func FormatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
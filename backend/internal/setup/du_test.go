@@ -0,0 +1,52 @@
+package setup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMeasureProject(t *testing.T) {
+	dir := t.TempDir()
+	write := func(path string, size int) {
+		path = filepath.Join(dir, path)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, make([]byte, size), 0644)
+	}
+	write("repo/.git/objects/pack", 1000)
+	write("repos/frontend/a", 200)
+	write("agents/1/main.go", 30)
+	write("agents/2/main.go", 40)
+	write("agents/2/.repos/frontend/a", 5)
+	write("scratch/bd-1/download", 6)
+	write("checkpoints/bd-1.patch", 7)
+	write("config.json", 8)
+
+	u, err := MeasureProject(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Repo != 1000 || u.ExtraRepos != 200 || u.Scratch != 6 || u.Checkpoints != 7 || u.Other != 8 {
+		t.Errorf("usage = %+v", u)
+	}
+	if u.Worktrees[1] != 30 || u.Worktrees[2] != 45 || u.WorktreesTotal() != 75 {
+		t.Errorf("worktrees = %v", u.Worktrees)
+	}
+	if u.Total() != 1296 {
+		t.Errorf("Total = %d, want 1296", u.Total())
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	for n, want := range map[int64]string{
+		0:             "0 B",
+		1023:          "1023 B",
+		1536:          "1.5 KB",
+		5 << 20:       "5.0 MB",
+		3<<30 + 1<<29: "3.5 GB",
+	} {
+		if got := FormatSize(n); got != want {
+			t.Errorf("FormatSize(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
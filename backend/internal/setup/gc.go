@@ -0,0 +1,96 @@
+package setup
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/tools"
+)
+
+// LocalTaskBranch is a machinator/* branch in a clone.
+type LocalTaskBranch struct {
+	Name       string // e.g. "machinator/bd-12"
+	LastCommit time.Time
+	CheckedOut bool // In one of the clone's worktrees
+}
+
+// LocalTaskBranches lists the clone's own machinator/* branches.
+func LocalTaskBranches(repoDir string) ([]LocalTaskBranch, error) {
+	out, err := tools.Command(tools.Git, "-C", repoDir, "for-each-ref",
+		"--format=%(refname:lstrip=2) %(committerdate:unix) %(worktreepath)", "refs/heads/machinator/").Output()
+	if err != nil {
+		return nil, fmt.Errorf("git for-each-ref: %w", err)
+	}
+	var branches []LocalTaskBranch
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) < 2 {
+			continue
+		}
+		secs, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse commit time of %s: %w", fields[0], err)
+		}
+		branches = append(branches, LocalTaskBranch{
+			Name:       fields[0],
+			LastCommit: time.Unix(secs, 0),
+			CheckedOut: len(fields) == 3 && fields[2] != "",
+		})
+	}
+	return branches, nil
+}
+
+// DeleteLocalBranch deletes a branch from a clone, merged or not.
+func DeleteLocalBranch(repoDir, name string) error {
+	if out, err := tools.Command(tools.Git, "-C", repoDir, "branch", "-q", "-D", name).CombinedOutput(); err != nil {
+		return fmt.Errorf("git branch -D: %w\nOutput: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// RemoveWorktree removes a worktree of repoDir, and its directory whether
+// or not git still knew it.
+func RemoveWorktree(repoDir, dir string) error {
+	tools.Command(tools.Git, "-C", repoDir, "worktree", "remove", "--force", dir).Run() // Fails if git has forgotten it
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	return PruneWorktrees(repoDir)
+}
+
+// DirSize is the total size of the files under path. Missing paths are
+// empty.
+func DirSize(path string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return nil // Removed meanwhile
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// GC repacks a clone and drops objects nothing refers to any more, such as
+// the commits of deleted task branches.
+func GC(repoDir string) error {
+	if out, err := tools.Command(tools.Git, "-C", repoDir, "gc", "-q", "--prune=now").CombinedOutput(); err != nil {
+		return fmt.Errorf("git gc: %w\nOutput: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package setup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalTaskBranchesAndWorktrees(t *testing.T) {
+	root := t.TempDir()
+	repo := filepath.Join(root, "repo")
+	os.MkdirAll(repo, 0755)
+	gitT(t, repo, "init", "-q", "-b", "main")
+	gitT(t, repo, "commit", "-q", "--allow-empty", "-m", "init")
+	gitT(t, repo, "branch", "machinator/done")
+	wt := filepath.Join(root, "agents", "7")
+	gitT(t, repo, "worktree", "add", "-q", "-b", "machinator/working", wt)
+	os.WriteFile(filepath.Join(wt, "big.bin"), make([]byte, 4096), 0644)
+
+	branches, err := LocalTaskBranches(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(branches) != 2 || branches[0].Name != "machinator/done" || branches[0].CheckedOut || !branches[1].CheckedOut {
+		t.Fatalf("LocalTaskBranches = %+v", branches)
+	}
+	if branches[0].LastCommit.IsZero() {
+		t.Error("no commit time")
+	}
+
+	if size, err := DirSize(wt); err != nil || size < 4096 {
+		t.Errorf("DirSize = %d, %v; want at least the 4096-byte file", size, err)
+	}
+	if size, err := DirSize(filepath.Join(root, "missing")); err != nil || size != 0 {
+		t.Errorf("DirSize of a missing dir = %d, %v", size, err)
+	}
+
+	if err := RemoveWorktree(repo, wt); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(wt); !os.IsNotExist(err) {
+		t.Errorf("worktree still there: %v", err)
+	}
+	if err := DeleteLocalBranch(repo, "machinator/working"); err != nil {
+		t.Fatal(err) // Fails while git thinks it's checked out
+	}
+	if branches, _ := LocalTaskBranches(repo); len(branches) != 1 {
+		t.Errorf("after deleting: %+v", branches)
+	}
+	if err := GC(repo); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,27 @@
+package setup
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// gitT runs git in dir as a test identity and returns its trimmed output,
+// failing the test if git fails.
+func gitT(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	return gitEnvT(t, dir, nil, args...)
+}
+
+// gitEnvT is gitT with env added to git's environment.
+func gitEnvT(t *testing.T, dir string, env []string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=t", "-c", "user.email=t@t"}, args...)...)
+	cmd.Env = append(os.Environ(), env...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
@@ -0,0 +1,147 @@
+package setup
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/tools"
+)
+
+// gitLockFiles are the locks git takes in a repository's or worktree's git
+// directory. Left behind by a git killed mid-command, each fails every
+// later command that needs it ("Unable to create 'index.lock': File
+// exists").
+var gitLockFiles = []string{"index.lock", "HEAD.lock", "ORIG_HEAD.lock", "FETCH_HEAD.lock", "config.lock", "packed-refs.lock", "shallow.lock"}
+
+// StaleGitLocks lists the lock files in repoDir's git directory and those
+// of its worktrees. They're only stale if nothing is running git there;
+// RemoveGitLock checks that before removing one.
+func StaleGitLocks(repoDir string) ([]string, error) {
+	gitDir, err := commonGitDir(repoDir)
+	if err != nil {
+		return nil, err
+	}
+	worktrees, err := filepath.Glob(filepath.Join(gitDir, "worktrees", "*"))
+	if err != nil {
+		return nil, err
+	}
+	var locks []string
+	for _, dir := range append([]string{gitDir}, worktrees...) {
+		for _, name := range gitLockFiles {
+			path := filepath.Join(dir, name)
+			if _, err := os.Stat(path); err == nil {
+				locks = append(locks, path)
+			}
+		}
+	}
+	return locks, nil
+}
+
+// PruneWorktrees drops git's records of repoDir's worktrees whose
+// directories are gone, so their branches can be checked out again.
+func PruneWorktrees(repoDir string) error {
+	if out, err := tools.Command(tools.Git, "-C", repoDir, "worktree", "prune").CombinedOutput(); err != nil {
+		return fmt.Errorf("git worktree prune: %w\nOutput: %s", err, out)
+	}
+	return nil
+}
+
+// ErrLockInUse is returned by RemoveGitLock for a lock that may still be
+// held.
+var ErrLockInUse = errors.New("git lock may be in use")
+
+// RemoveGitLock removes a lock StaleGitLocks found if it is at least minAge
+// old and no git is running in the repository or worktree it locks, by
+// working directory or -C. Otherwise it returns an ErrLockInUse error
+// saying why it was kept. A lock already gone is not an error.
+func RemoveGitLock(lock string, minAge time.Duration) error {
+	info, err := os.Stat(lock)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if age := time.Since(info.ModTime()); age < minAge {
+		return fmt.Errorf("%w: %s is only %s old", ErrLockInUse, lock, age.Round(time.Second))
+	}
+	pid, err := gitRunningIn(lockedTree(filepath.Dir(lock)))
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrLockInUse, lock, err)
+	}
+	if pid != 0 {
+		return fmt.Errorf("%w: %s: git (pid %d) is running there", ErrLockInUse, lock, pid)
+	}
+	if err := os.Remove(lock); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// lockedTree returns the working tree a git directory's locks guard: the
+// directory holding .git, or for a linked worktree's git directory the
+// worktree its gitdir file names.
+func lockedTree(gitDir string) string {
+	if data, err := os.ReadFile(filepath.Join(gitDir, "gitdir")); err == nil {
+		return filepath.Dir(strings.TrimSpace(string(data)))
+	}
+	return filepath.Dir(gitDir)
+}
+
+// gitRunningIn returns the pid of a git process working in dir, or 0 if
+// there is none.
+func gitRunningIn(dir string) (int, error) {
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = resolved
+	}
+	out, err := exec.Command("ps", "-A", "-o", "pid=,command=").Output()
+	if err != nil {
+		return 0, fmt.Errorf("list processes: %w", err)
+	}
+	inDir := func(path string) bool {
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			path = resolved
+		}
+		return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || filepath.Base(fields[1]) != "git" {
+			continue
+		}
+		pid, _ := strconv.Atoi(fields[0])
+		for i, arg := range fields[2:] {
+			if arg == "-C" && i+3 < len(fields) && inDir(fields[i+3]) {
+				return pid, nil
+			}
+		}
+		if cwd, err := processDir(pid); err == nil && inDir(cwd) {
+			return pid, nil
+		}
+	}
+	return 0, nil
+}
+
+// processDir returns a process's working directory.
+func processDir(pid int) (string, error) {
+	if cwd, err := os.Readlink(fmt.Sprintf("/proc/%d/cwd", pid)); err == nil {
+		return cwd, nil
+	}
+	// No /proc (macOS)
+	out, err := exec.Command("lsof", "-a", "-p", strconv.Itoa(pid), "-d", "cwd", "-Fn").Output()
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if cwd, ok := strings.CutPrefix(line, "n"); ok {
+			return cwd, nil
+		}
+	}
+	return "", fmt.Errorf("no working directory for pid %d", pid)
+}
@@ -0,0 +1,83 @@
+package setup
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestStaleGitLocks(t *testing.T) {
+	root := t.TempDir()
+	repo, wt := filepath.Join(root, "repo"), filepath.Join(root, "wt")
+	os.MkdirAll(repo, 0755)
+	gitT(t, repo, "init", "-q", "-b", "main")
+	gitT(t, repo, "commit", "-q", "--allow-empty", "-m", "init")
+	gitT(t, repo, "worktree", "add", "-q", "--detach", wt)
+
+	if locks, err := StaleGitLocks(repo); err != nil || len(locks) != 0 {
+		t.Fatalf("StaleGitLocks = %v, %v before any were left", locks, err)
+	}
+
+	// As a git killed mid-commit in the worktree and mid-fetch in the clone leaves them
+	want := []string{
+		filepath.Join(repo, ".git", "FETCH_HEAD.lock"),
+		filepath.Join(repo, ".git", "worktrees", "wt", "index.lock"),
+	}
+	for _, path := range want {
+		os.WriteFile(path, nil, 0644)
+	}
+	locks, err := StaleGitLocks(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(locks, want) {
+		t.Errorf("StaleGitLocks = %v, want %v", locks, want)
+	}
+
+	// A lock newer than the threshold is kept; an older one nothing holds goes
+	fresh := want[0]
+	if err := RemoveGitLock(fresh, time.Hour); !errors.Is(err, ErrLockInUse) {
+		t.Errorf("RemoveGitLock(fresh) = %v, want ErrLockInUse", err)
+	}
+	if _, err := os.Stat(fresh); err != nil {
+		t.Errorf("fresh lock removed: %v", err)
+	}
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(fresh, old, old)
+	if err := RemoveGitLock(fresh, time.Minute); err != nil {
+		t.Errorf("RemoveGitLock(old) = %v", err)
+	}
+	if _, err := os.Stat(fresh); !os.IsNotExist(err) {
+		t.Errorf("old lock kept: %v", err)
+	}
+
+	// An old lock is kept while a git is running in its worktree
+	held := want[1]
+	os.Chtimes(held, old, old)
+	git := exec.Command("git", "-C", wt, "hash-object", "--stdin")
+	stdin, _ := git.StdinPipe()
+	if err := git.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := RemoveGitLock(held, time.Minute); !errors.Is(err, ErrLockInUse) {
+		t.Errorf("RemoveGitLock(held) = %v, want ErrLockInUse", err)
+	}
+	stdin.Close()
+	git.Wait()
+	if err := RemoveGitLock(held, time.Minute); err != nil {
+		t.Errorf("RemoveGitLock once git exited = %v", err)
+	}
+
+	// A worktree whose directory is gone is forgotten
+	os.RemoveAll(wt)
+	if err := PruneWorktrees(repo); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(repo, ".git", "worktrees", "wt")); !os.IsNotExist(err) {
+		t.Errorf("worktree still recorded after prune: %v", err)
+	}
+}
@@ -0,0 +1,323 @@
+package setup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/procgroup"
+	"github.com/bryantinsley/machinator/backend/internal/tools"
+)
+
+// maxConflictHunks caps the hunks kept from a conflict.
+const maxConflictHunks = 20000
+
+// mergeAttempts is how many times a merge is redone when its push is
+// rejected because the branch moved meanwhile.
+const mergeAttempts = 3
+
+// MergeError is a merge that needs a person: the task branch conflicts
+// with the branch, or the merged result fails the check command.
+type MergeError struct {
+	Reason string
+
+	// Set for conflicts
+	Conflict bool
+	Files    []string // Conflicting files
+	Hunks    string   // Their conflicting hunks, as git diff shows them mid-merge
+}
+
+func (e *MergeError) Error() string { return e.Reason }
+
+// MergeOptions says how a task branch is merged.
+type MergeOptions struct {
+	Squash  bool          // One commit with Message, instead of rebasing the branch's commits
+	Message string        // Squash commit message
+	Command string        // Run on the merged result in the worktree; must pass
+	Timeout time.Duration // Bounds each run of Command; 0 for no limit
+	Scope   string        // Directory the branch may change files in; "" for anywhere
+}
+
+// MergeQueue runs merges one at a time in the order they were queued, so
+// each task branch is rebased onto and verified against the branch as the
+// merge before it left it, instead of racing it.
+type MergeQueue struct {
+	mu      sync.Mutex
+	waiting []chan struct{} // One per queued merge, closed when it's its turn
+}
+
+// Run waits for the merges queued before it, then runs merge. queued, if
+// not nil, is told how many are ahead when it has to wait.
+func (q *MergeQueue) Run(merge func() error, queued func(ahead int)) error {
+	turn := make(chan struct{})
+	q.mu.Lock()
+	q.waiting = append(q.waiting, turn)
+	ahead := len(q.waiting) - 1
+	if ahead == 0 {
+		close(turn)
+	}
+	q.mu.Unlock()
+
+	if ahead > 0 && queued != nil {
+		queued(ahead)
+	}
+	<-turn
+	defer func() {
+		q.mu.Lock()
+		q.waiting = q.waiting[1:]
+		if len(q.waiting) > 0 {
+			close(q.waiting[0])
+		}
+		q.mu.Unlock()
+	}()
+	return merge()
+}
+
+// Len returns how many merges are running or queued.
+func (q *MergeQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.waiting)
+}
+
+// StartTaskBranch puts a freshly reset worktree on a task's branch,
+// continuing from what an earlier attempt pushed to it, and sets it up so
+// a plain `git push` pushes to it.
+func StartTaskBranch(worktreeDir, taskBranch string) error {
+	start := "HEAD"
+	if tools.Command(tools.Git, "-C", worktreeDir, "rev-parse", "-q", "--verify", "refs/remotes/origin/"+taskBranch).Run() == nil {
+		start = "origin/" + taskBranch
+	}
+	for _, args := range [][]string{
+		{"checkout", "-q", "-B", taskBranch, start},
+		{"config", "branch." + taskBranch + ".remote", "origin"},
+		{"config", "branch." + taskBranch + ".merge", "refs/heads/" + taskBranch},
+	} {
+		if out, err := tools.Command(tools.Git, append([]string{"-C", worktreeDir}, args...)...).CombinedOutput(); err != nil {
+			return fmt.Errorf("git %s: %w\nOutput: %s", args[0], err, strings.TrimSpace(string(out)))
+		}
+	}
+	return nil
+}
+
+// PushTaskBranch pushes a worktree's HEAD to taskBranch on origin, e.g. to
+// open a pull request from it.
+func PushTaskBranch(worktreeDir, taskBranch string) error {
+	out, err := tools.Command(tools.Git, "-C", worktreeDir, "push", "-q", "origin", "HEAD:refs/heads/"+taskBranch).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("git push: %w\nOutput: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// MergeTaskBranch merges a worktree's task branch into branch and pushes
+// the result. It returns a *MergeError when a person has to merge it; the
+// task branch is left as it was pushed. The local task branch is deleted
+// once merged. The check command is killed, with everything it started,
+// when ctx is done.
+func MergeTaskBranch(ctx context.Context, worktreeDir, branch, taskBranch string, opts MergeOptions) error {
+	git := func(args ...string) error {
+		out, err := tools.Command(tools.Git, append([]string{"-C", worktreeDir}, args...)...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("git %s: %w\nOutput: %s", args[0], err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+	identity := []string{"-c", "user.name=Machinator", "-c", "user.email=machinator@machinator.local"}
+	conflict := func() *MergeError { return conflictError(worktreeDir, branch, taskBranch) }
+	merged := func() error {
+		git("checkout", "-q", "--detach")
+		git("branch", "-q", "-D", taskBranch)
+		return nil
+	}
+
+	for range mergeAttempts {
+		if err := git("fetch", "-q", "origin"); err != nil {
+			return err
+		}
+		if opts.Scope != "" {
+			files, err := outOfScope(worktreeDir, "origin/"+branch, taskBranch, opts.Scope)
+			if err != nil {
+				return err
+			}
+			if len(files) > 0 {
+				return &MergeError{Reason: fmt.Sprintf("%s changes files outside %s: %s", taskBranch, opts.Scope, strings.Join(files, ", "))}
+			}
+		}
+		if opts.Squash {
+			if err := git("checkout", "-q", "--detach", "origin/"+branch); err != nil {
+				return err
+			}
+			if err := git(append(identity, "merge", "-q", "--squash", taskBranch)...); err != nil {
+				mergeErr := conflict()
+				git("reset", "-q", "--hard")
+				if mergeErr != nil {
+					return mergeErr
+				}
+				return err
+			}
+			if git("diff", "--cached", "--quiet") == nil {
+				return merged() // Nothing to merge
+			}
+			if err := git(append(identity, "commit", "-q", "-m", opts.Message)...); err != nil {
+				return err
+			}
+		} else {
+			if err := git("checkout", "-q", taskBranch); err != nil {
+				return err
+			}
+			// A branch with the branch merged in (a resolved conflict) goes as is
+			onTop := git("merge-base", "--is-ancestor", "origin/"+branch, taskBranch) == nil
+			if !onTop {
+				if err := git(append(identity, "rebase", "-q", "origin/"+branch)...); err != nil {
+					mergeErr := conflict()
+					git("rebase", "--abort")
+					if mergeErr != nil {
+						return mergeErr
+					}
+					return err
+				}
+			}
+		}
+
+		if opts.Command != "" {
+			if err := check(ctx, worktreeDir, taskBranch, opts); err != nil {
+				return err
+			}
+		}
+
+		if git("push", "-q", "origin", "HEAD:"+branch) == nil {
+			return merged()
+		}
+		// Rejected: the branch moved, so merge again on top of it
+	}
+	return fmt.Errorf("push to %s rejected %d times", branch, mergeAttempts)
+}
+
+// check runs a merge's check command on the merged result in the worktree.
+// It runs the agent's code, so without machinator's tokens, as hooks do.
+func check(ctx context.Context, worktreeDir, taskBranch string, opts MergeOptions) error {
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	cmd := procgroup.Command(ctx, "sh", "-c", opts.Command)
+	cmd.Dir = worktreeDir
+	cmd.Env = tools.Environ()
+	out, err := cmd.CombinedOutput()
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return &MergeError{Reason: fmt.Sprintf("%q timed out after %s merging %s\n%s", opts.Command, opts.Timeout, taskBranch, tail(string(out), 20))}
+	case ctx.Err() != nil:
+		return ctx.Err()
+	}
+	return &MergeError{Reason: fmt.Sprintf("%q failed after merging %s: %v\n%s", opts.Command, taskBranch, err, tail(string(out), 20))}
+}
+
+// outOfScope lists the files tip changes since it left base that are
+// outside the scope directory, other than task files (.beads).
+func outOfScope(worktreeDir, base, tip, scope string) ([]string, error) {
+	args := []string{"-C", worktreeDir, "diff", "--name-only", base + "..." + tip, "--", ".", ":(exclude)" + scope}
+	for _, pattern := range beadsPaths {
+		args = append(args, ":(exclude,glob)"+pattern)
+	}
+	out, err := tools.Command(tools.Git, args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("git diff: %w", err)
+	}
+	return strings.Fields(string(out)), nil
+}
+
+// conflictError describes the conflicts of a failed merge or rebase in a
+// worktree; nil if it failed for another reason.
+func conflictError(worktreeDir, branch, taskBranch string) *MergeError {
+	out, _ := tools.Command(tools.Git, "-C", worktreeDir, "diff", "--name-only", "--diff-filter=U").Output()
+	files := strings.Fields(string(out))
+	if len(files) == 0 {
+		return nil
+	}
+	hunks, _ := tools.Command(tools.Git, append([]string{"-C", worktreeDir, "diff", "--"}, files...)...).Output()
+	if len(hunks) > maxConflictHunks {
+		hunks = append(hunks[:maxConflictHunks], "\n... (truncated)"...)
+	}
+	return &MergeError{
+		Reason:   fmt.Sprintf("%s conflicts with %s in %s", taskBranch, branch, strings.Join(files, ", ")),
+		Conflict: true,
+		Files:    files,
+		Hunks:    string(hunks),
+	}
+}
+
+// StartConflictMerge merges origin/<branch> into a worktree's task branch
+// and, if that conflicts, leaves the merge in progress for an agent to
+// resolve and returns the conflict. A clean merge is committed and nil
+// returned.
+func StartConflictMerge(worktreeDir, branch, taskBranch string) (*MergeError, error) {
+	git := func(args ...string) error {
+		out, err := tools.Command(tools.Git, append([]string{"-C", worktreeDir}, args...)...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("git %s: %w\nOutput: %s", args[0], err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+	if err := git("fetch", "-q", "origin"); err != nil {
+		return nil, err
+	}
+	if err := git("checkout", "-q", taskBranch); err != nil {
+		return nil, err
+	}
+	err := git("-c", "user.name=Machinator", "-c", "user.email=machinator@machinator.local",
+		"merge", "-q", "--no-edit", "origin/"+branch)
+	if err == nil {
+		return nil, nil
+	}
+	if c := conflictError(worktreeDir, branch, taskBranch); c != nil {
+		return c, nil
+	}
+	git("merge", "--abort")
+	return nil, err
+}
+
+// FinishConflictMerge checks that the merge StartConflictMerge left was
+// resolved and committed, with no conflict markers left in files, and
+// pushes the task branch. Otherwise it abandons the merge and says why.
+func FinishConflictMerge(worktreeDir, branch, taskBranch string, files []string) error {
+	git := func(args ...string) (string, error) {
+		out, err := tools.Command(tools.Git, append([]string{"-C", worktreeDir}, args...)...).CombinedOutput()
+		return strings.TrimSpace(string(out)), err
+	}
+	problem := ""
+	if _, err := git("rev-parse", "-q", "--verify", "MERGE_HEAD"); err == nil {
+		problem = "the merge wasn't committed"
+	} else if head, _ := git("symbolic-ref", "-q", "--short", "HEAD"); head != taskBranch {
+		problem = fmt.Sprintf("left %s instead of %s checked out", head, taskBranch)
+	} else if _, err := git("merge-base", "--is-ancestor", "origin/"+branch, "HEAD"); err != nil {
+		problem = fmt.Sprintf("origin/%s isn't merged", branch)
+	} else if out, _ := git(append([]string{"grep", "-l", "-E", "^(<<<<<<<|>>>>>>>) ", "HEAD", "--"}, files...)...); out != "" {
+		problem = "conflict markers left in " + strings.Join(strings.Fields(out), ", ")
+	}
+	if problem != "" {
+		git("merge", "--abort")
+		git("reset", "-q", "--hard", "origin/"+taskBranch)
+		return errors.New(problem)
+	}
+	if out, err := git("push", "-q", "origin", taskBranch); err != nil {
+		return fmt.Errorf("git push: %w\nOutput: %s", err, out)
+	}
+	return nil
+}
+
+// tail returns the last n lines of s.
+func tail(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
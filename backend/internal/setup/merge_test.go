@@ -0,0 +1,173 @@
+package setup
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMergeTaskBranch(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	origin, repo := filepath.Join(root, "origin.git"), filepath.Join(root, "repo")
+	write := func(dir, name, content string) {
+		os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+	}
+
+	gitT(t, root, "init", "-q", "--bare", "-b", "main", origin)
+	gitT(t, root, "clone", "-q", origin, repo)
+	write(repo, "a.txt", "a\n")
+	gitT(t, repo, "add", "-A")
+	gitT(t, repo, "commit", "-qm", "init")
+	gitT(t, repo, "push", "-q", "origin", "HEAD:main")
+
+	// An agent's work on its task branch, while main moves on
+	work := func(taskBranch, name, content string) string {
+		wt := filepath.Join(root, taskBranch)
+		gitT(t, repo, "worktree", "add", "-q", "--detach", wt, "origin/main")
+		if err := StartTaskBranch(wt, "machinator/"+taskBranch); err != nil {
+			t.Fatal(err)
+		}
+		write(wt, name, content)
+		gitT(t, wt, "add", "-A")
+		gitT(t, wt, "commit", "-qm", taskBranch)
+		gitT(t, wt, "push", "-q") // Set up to push to the task branch
+		return wt
+	}
+	ff := work("t1", "b.txt", "b\n")
+	squash := work("t2", "c.txt", "c\n")
+	conflict := work("t3", "a.txt", "conflicting\n")
+	write(repo, "a.txt", "moved on\n")
+	gitT(t, repo, "commit", "-qam", "main moves")
+	gitT(t, repo, "push", "-q", "origin", "HEAD:main")
+
+	if err := MergeTaskBranch(ctx, ff, "main", "machinator/t1", MergeOptions{Command: "test -f b.txt"}); err != nil {
+		t.Fatalf("fast-forward: %v", err)
+	}
+	if err := MergeTaskBranch(ctx, squash, "main", "machinator/t2", MergeOptions{Squash: true, Message: "t2: add c"}); err != nil {
+		t.Fatalf("squash: %v", err)
+	}
+	gitT(t, repo, "fetch", "-q")
+	if got, want := gitT(t, repo, "log", "--format=%s", "origin/main"), "t2: add c\nt1\nmain moves\ninit"; got != want {
+		t.Errorf("main history:\n%s\nwant:\n%s", got, want)
+	}
+
+	var mergeErr *MergeError
+	if err := MergeTaskBranch(ctx, conflict, "main", "machinator/t3", MergeOptions{}); !errors.As(err, &mergeErr) {
+		t.Errorf("conflict: err = %v, want a MergeError", err)
+	} else if !mergeErr.Conflict || !slices.Equal(mergeErr.Files, []string{"a.txt"}) || !strings.Contains(mergeErr.Hunks, "+>>>>>>>") {
+		t.Errorf("conflict: %+v, want a.txt's conflicting hunks", mergeErr)
+	}
+
+	// Left unresolved, the merge is abandoned; resolved, the branch goes in as is
+	c, err := StartConflictMerge(conflict, "main", "machinator/t3")
+	if err != nil || c == nil || !slices.Equal(c.Files, []string{"a.txt"}) {
+		t.Fatalf("start conflict merge: %+v, %v", c, err)
+	}
+	if err := FinishConflictMerge(conflict, "main", "machinator/t3", c.Files); err == nil {
+		t.Error("unresolved merge finished")
+	}
+	if c, err = StartConflictMerge(conflict, "main", "machinator/t3"); err != nil || c == nil {
+		t.Fatalf("restart conflict merge: %+v, %v", c, err)
+	}
+	write(conflict, "a.txt", "both\n")
+	gitT(t, conflict, "commit", "-qam", "resolve")
+	if err := FinishConflictMerge(conflict, "main", "machinator/t3", c.Files); err != nil {
+		t.Fatalf("finish resolved merge: %v", err)
+	}
+	if err := MergeTaskBranch(ctx, conflict, "main", "machinator/t3", MergeOptions{}); err != nil {
+		t.Fatalf("merge resolved branch: %v", err)
+	}
+	gitT(t, repo, "fetch", "-q")
+	if got := gitT(t, repo, "show", "origin/main:a.txt"); got != "both" {
+		t.Errorf("a.txt on main = %q, want the resolution", got)
+	}
+
+	if exec.Command("git", "-C", repo, "rev-parse", "-q", "--verify", "refs/heads/machinator/t1").Run() == nil {
+		t.Error("merged task branch wasn't deleted")
+	}
+	write(squash, "d.txt", "d\n")
+	if err := StartTaskBranch(squash, "machinator/t4"); err != nil {
+		t.Fatal(err)
+	}
+	gitT(t, squash, "add", "-A")
+	gitT(t, squash, "commit", "-qm", "t4")
+	if err := MergeTaskBranch(ctx, squash, "main", "machinator/t4", MergeOptions{Scope: "sub"}); !errors.As(err, &mergeErr) || !strings.Contains(mergeErr.Reason, "d.txt") {
+		t.Errorf("out of scope: err = %v, want a MergeError naming d.txt", err)
+	}
+	if err := MergeTaskBranch(ctx, squash, "main", "machinator/t4", MergeOptions{Command: "false"}); !errors.As(err, &mergeErr) || mergeErr.Conflict {
+		t.Errorf("failing command: err = %v, want a MergeError that isn't a conflict", err)
+	}
+	start := time.Now()
+	if err := MergeTaskBranch(ctx, squash, "main", "machinator/t4", MergeOptions{Command: "sleep 30", Timeout: 100 * time.Millisecond}); !errors.As(err, &mergeErr) || !strings.Contains(mergeErr.Reason, "timed out") {
+		t.Errorf("slow command: err = %v, want a MergeError saying it timed out", err)
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Errorf("slow command ran %s, want it killed at its timeout", d)
+	}
+}
+
+func TestCheckCommandEnv(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "ghs_secret")
+	t.Setenv("GIT_CONFIG_COUNT", "1")
+	t.Setenv("GIT_CONFIG_KEY_0", "http.extraheader")
+	t.Setenv("GIT_CONFIG_VALUE_0", "AUTHORIZATION: basic c2VjcmV0")
+	opts := MergeOptions{Command: `test -z "$GITHUB_TOKEN$GIT_CONFIG_COUNT$GIT_CONFIG_VALUE_0"`}
+	if err := check(context.Background(), t.TempDir(), "machinator/t1", opts); err != nil {
+		t.Errorf("check command saw machinator's credentials: %v", err)
+	}
+}
+
+func TestMergeQueueOrder(t *testing.T) {
+	var q MergeQueue
+	release := make(chan struct{})
+	var order []int
+	var wg sync.WaitGroup
+
+	// The first merge holds the queue while the rest line up behind it
+	started := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		q.Run(func() error {
+			close(started)
+			<-release
+			order = append(order, 0)
+			return nil
+		}, nil)
+	}()
+	<-started
+	for i := 1; i <= 3; i++ {
+		queued := make(chan int, 1)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.Run(func() error {
+				order = append(order, i)
+				return nil
+			}, func(ahead int) { queued <- ahead })
+		}()
+		if ahead := <-queued; ahead != i {
+			t.Errorf("merge %d: %d ahead, want %d", i, ahead, i)
+		}
+	}
+	if q.Len() != 4 {
+		t.Errorf("Len() = %d, want 4", q.Len())
+	}
+
+	close(release)
+	wg.Wait()
+	if want := []int{0, 1, 2, 3}; !slices.Equal(order, want) {
+		t.Errorf("merged in order %v, want %v", order, want)
+	}
+	if err := q.Run(func() error { return errors.New("conflict") }, func(int) { t.Error("empty queue waited") }); err == nil {
+		t.Error("Run() lost the merge's error")
+	}
+}
@@ -0,0 +1,112 @@
+package setup
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/tools"
+)
+
+// RemoteTaskBranch is a task branch on origin.
+type RemoteTaskBranch struct {
+	Name       string // e.g. "machinator/bd-12"
+	LastCommit time.Time
+	Merged     bool // Its work is in the branch
+}
+
+// MergedTaskBranches fetches origin, dropping branches deleted there, and
+// lists its machinator/* branches whose changes are all in origin/<branch>,
+// whether fast-forwarded, rebased or squashed in.
+func MergedTaskBranches(repoDir, branch string) ([]RemoteTaskBranch, error) {
+	all, err := RemoteTaskBranches(repoDir, branch)
+	if err != nil {
+		return nil, err
+	}
+	var merged []RemoteTaskBranch
+	for _, b := range all {
+		if b.Merged {
+			merged = append(merged, b)
+		}
+	}
+	return merged, nil
+}
+
+// RemoteTaskBranches fetches origin, dropping branches deleted there, and
+// lists all its machinator/* branches, noting which are merged into
+// origin/<branch>.
+func RemoteTaskBranches(repoDir, branch string) ([]RemoteTaskBranch, error) {
+	git := func(args ...string) (string, error) {
+		out, err := tools.Command(tools.Git, append([]string{"-C", repoDir}, args...)...).CombinedOutput()
+		if err != nil {
+			return "", fmt.Errorf("git %s: %w\nOutput: %s", args[0], err, strings.TrimSpace(string(out)))
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+	if _, err := git("fetch", "-q", "--prune", "origin"); err != nil {
+		return nil, err
+	}
+	out, err := git("for-each-ref", "--format=%(refname:lstrip=3) %(committerdate:unix)", "refs/remotes/origin/machinator/")
+	if err != nil || out == "" {
+		return nil, err
+	}
+
+	base := "origin/" + branch
+	var branches []RemoteTaskBranch
+	for _, line := range strings.Split(out, "\n") {
+		name, unix, _ := strings.Cut(line, " ")
+		secs, err := strconv.ParseInt(unix, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse commit time of %s: %w", name, err)
+		}
+		merged, err := branchMerged(repoDir, base, "origin/"+name)
+		if err != nil {
+			return nil, err
+		}
+		branches = append(branches, RemoteTaskBranch{Name: name, LastCommit: time.Unix(secs, 0), Merged: merged})
+	}
+	return branches, nil
+}
+
+// branchMerged reports whether everything on tip is in base: tip is an
+// ancestor, each of its commits has an equivalent in base (rebased), or
+// its changes as one commit do (squashed).
+func branchMerged(repoDir, base, tip string) (bool, error) {
+	git := func(args ...string) (string, error) {
+		out, err := tools.Command(tools.Git, append([]string{"-C", repoDir}, args...)...).Output()
+		return strings.TrimSpace(string(out)), err
+	}
+	if _, err := git("merge-base", "--is-ancestor", tip, base); err == nil {
+		return true, nil
+	}
+	upstreamed := func(commit string) (bool, error) {
+		out, err := git("cherry", base, commit)
+		if err != nil {
+			return false, fmt.Errorf("git cherry: %w", err)
+		}
+		return !strings.Contains("\n"+out, "\n+"), nil
+	}
+	if ok, err := upstreamed(tip); err != nil || ok {
+		return ok, err
+	}
+
+	forkPoint, err := git("merge-base", base, tip)
+	if err != nil {
+		return false, fmt.Errorf("git merge-base: %w", err)
+	}
+	squashed, err := git("-c", "user.name=Machinator", "-c", "user.email=machinator@machinator.local",
+		"commit-tree", tip+"^{tree}", "-p", forkPoint, "-m", "squashed")
+	if err != nil {
+		return false, fmt.Errorf("git commit-tree: %w", err)
+	}
+	return upstreamed(squashed)
+}
+
+// DeleteRemoteBranch deletes a branch on origin.
+func DeleteRemoteBranch(repoDir, name string) error {
+	if out, err := tools.Command(tools.Git, "-C", repoDir, "push", "-q", "origin", "--delete", name).CombinedOutput(); err != nil {
+		return fmt.Errorf("git push --delete: %w\nOutput: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package setup
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMergedTaskBranches(t *testing.T) {
+	root := t.TempDir()
+	origin, repo := filepath.Join(root, "origin.git"), filepath.Join(root, "repo")
+	commit := func(name, content string) {
+		os.WriteFile(filepath.Join(repo, name), []byte(content), 0644)
+		gitT(t, repo, "add", "-A")
+		gitT(t, repo, "commit", "-qm", name)
+	}
+
+	gitT(t, root, "init", "-q", "--bare", "-b", "main", origin)
+	gitT(t, root, "clone", "-q", origin, repo)
+	commit("a.txt", "a\n")
+	gitT(t, repo, "push", "-q", "origin", "HEAD:main")
+
+	// Task branches of two commits each, pushed before main moves on
+	branch := func(name string) {
+		gitT(t, repo, "checkout", "-q", "-b", "machinator/"+name, "main")
+		commit(name+"1.txt", name+"\n")
+		commit(name+"2.txt", name+"\n")
+		gitT(t, repo, "push", "-q", "origin", "machinator/"+name)
+	}
+	for _, name := range []string{"ff", "rebased", "squashed", "open"} {
+		branch(name)
+	}
+	gitT(t, repo, "checkout", "-q", "main")
+	gitT(t, repo, "merge", "-q", "--ff-only", "machinator/ff")
+	commit("b.txt", "main moves on\n")
+	gitT(t, repo, "cherry-pick", "machinator/rebased~1", "machinator/rebased")
+	gitT(t, repo, "merge", "-q", "--squash", "machinator/squashed")
+	gitT(t, repo, "commit", "-qm", "squashed")
+	gitT(t, repo, "push", "-q", "origin", "main")
+
+	merged, err := MergedTaskBranches(repo, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, b := range merged {
+		names = append(names, b.Name)
+		if b.LastCommit.IsZero() {
+			t.Errorf("%s has no commit time", b.Name)
+		}
+	}
+	if got := strings.Join(names, " "); got != "machinator/ff machinator/rebased machinator/squashed" {
+		t.Errorf("merged = %s", got)
+	}
+
+	all, err := RemoteTaskBranches(repo, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 4 || all[1].Name != "machinator/open" || all[1].Merged {
+		t.Errorf("RemoteTaskBranches = %v, want open among them unmerged", all)
+	}
+
+	if err := DeleteRemoteBranch(repo, "machinator/ff"); err != nil {
+		t.Fatal(err)
+	}
+	merged, _ = MergedTaskBranches(repo, "main")
+	if len(merged) != 2 || merged[0].Name != "machinator/rebased" {
+		t.Errorf("after deleting ff: %v", merged)
+	}
+}
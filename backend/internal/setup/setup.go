@@ -1,10 +1,17 @@
 package setup
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bryantinsley/machinator/backend/internal/procgroup"
+	"github.com/bryantinsley/machinator/backend/internal/project"
+	"github.com/bryantinsley/machinator/backend/internal/tools"
 )
 
 // Setup handles environment initialization.
@@ -35,7 +42,7 @@ func (s *Setup) EnsureDirectories() error {
 }
 
 // EnsureGeminiCLI builds the specialized gemini-cli from source if needed.
-func (s *Setup) EnsureGeminiCLI() (string, error) {
+func (s *Setup) EnsureGeminiCLI(ctx context.Context) (string, error) {
 	geminiPath := filepath.Join(s.MachinatorDir, "gemini")
 
 	// Check if already installed
@@ -44,7 +51,7 @@ func (s *Setup) EnsureGeminiCLI() (string, error) {
 	}
 
 	// Build from source
-	if err := s.BuildGeminiCLI(); err != nil {
+	if err := s.BuildGeminiCLI(ctx); err != nil {
 		return "", err
 	}
 
@@ -52,7 +59,8 @@ func (s *Setup) EnsureGeminiCLI() (string, error) {
 }
 
 // BuildGeminiCLI clones and builds the specialized gemini-cli from source.
-func (s *Setup) BuildGeminiCLI() error {
+// Cancelling ctx stops git and npm along with everything they started.
+func (s *Setup) BuildGeminiCLI(ctx context.Context) error {
 	resourcesDir := filepath.Join(s.MachinatorDir, "resources")
 	geminiModsDir := filepath.Join(resourcesDir, "gemini-cli-mods")
 
@@ -60,13 +68,13 @@ func (s *Setup) BuildGeminiCLI() error {
 	if _, err := os.Stat(filepath.Join(geminiModsDir, ".git")); err == nil {
 		// Already cloned, fetch and reset
 		fmt.Println("Updating gemini-cli-mods...")
-		cmd := exec.Command("git", "-C", geminiModsDir, "fetch", "origin")
+		cmd := gitCommand(ctx, "-C", geminiModsDir, "fetch", "origin")
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
 		if err := cmd.Run(); err != nil {
 			return fmt.Errorf("git fetch: %w", err)
 		}
-		cmd = exec.Command("git", "-C", geminiModsDir, "reset", "--hard", "origin/main")
+		cmd = gitCommand(ctx, "-C", geminiModsDir, "reset", "--hard", "origin/main")
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
 		if err := cmd.Run(); err != nil {
@@ -78,7 +86,7 @@ func (s *Setup) BuildGeminiCLI() error {
 			return fmt.Errorf("create resources dir: %w", err)
 		}
 		fmt.Println("Cloning gemini-cli-mods...")
-		cmd := exec.Command("git", "clone",
+		cmd := gitCommand(ctx, "clone",
 			"https://github.com/bryantinsley/gemini-cli-mods.git",
 			geminiModsDir)
 		cmd.Stdout = os.Stdout
@@ -90,7 +98,7 @@ func (s *Setup) BuildGeminiCLI() error {
 
 	// Install dependencies
 	fmt.Println("Installing dependencies...")
-	cmd := exec.Command("npm", "install")
+	cmd := procgroup.Command(ctx, "npm", "install")
 	cmd.Dir = geminiModsDir
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -100,7 +108,7 @@ func (s *Setup) BuildGeminiCLI() error {
 
 	// Build
 	fmt.Println("Building...")
-	cmd = exec.Command("npm", "run", "build")
+	cmd = procgroup.Command(ctx, "npm", "run", "build")
 	cmd.Dir = geminiModsDir
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -121,85 +129,274 @@ func (s *Setup) BuildGeminiCLI() error {
 	return nil
 }
 
-// CloneRepo clones or updates the project repository.
-func (s *Setup) CloneRepo(projectID int, repoURL, branch string) (string, error) {
+// CloneRepo clones or updates the project repository, trimmed as clone
+// says. Cancelling ctx stops git.
+func (s *Setup) CloneRepo(ctx context.Context, projectID int, repoURL, branch string, clone project.CloneConfig) (string, error) {
 	projectDir := filepath.Join(s.MachinatorDir, "projects", fmt.Sprintf("%d", projectID))
 	repoDir := filepath.Join(projectDir, "repo")
+	if err := cloneOrFetch(ctx, repoDir, repoURL, branch, clone); err != nil {
+		return "", err
+	}
+	if err := GuardBeadsDB(repoDir); err != nil {
+		return "", err
+	}
+	return repoDir, nil
+}
 
-	if err := os.MkdirAll(projectDir, 0755); err != nil {
-		return "", fmt.Errorf("create project dir: %w", err)
+// CloneExtraRepo clones or updates one of the project's extra repos.
+func (s *Setup) CloneExtraRepo(ctx context.Context, projectID int, name, repoURL, branch string, clone project.CloneConfig) (string, error) {
+	repoDir := filepath.Join(s.MachinatorDir, "projects", fmt.Sprintf("%d", projectID), "repos", name)
+	if err := cloneOrFetch(ctx, repoDir, repoURL, branch, clone); err != nil {
+		return "", err
+	}
+	return repoDir, nil
+}
+
+// cloneOrFetch clones repoURL to repoDir, or resets an existing clone to
+// the latest origin/<branch>.
+func cloneOrFetch(ctx context.Context, repoDir, repoURL, branch string, clone project.CloneConfig) error {
+	if err := os.MkdirAll(filepath.Dir(repoDir), 0755); err != nil {
+		return fmt.Errorf("create project dir: %w", err)
 	}
 
 	// Check if repo already exists
 	if _, err := os.Stat(filepath.Join(repoDir, ".git")); err == nil {
 		// Already cloned, fetch latest
 		fmt.Printf("Fetching latest from %s...\n", repoURL)
-		cmd := exec.Command("git", "-C", repoDir, "fetch", "origin")
+		cmd := gitCommand(ctx, "-C", repoDir, "fetch", "origin")
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
 		if err := cmd.Run(); err != nil {
-			return "", fmt.Errorf("git fetch: %w", err)
+			return fmt.Errorf("git fetch: %w", err)
 		}
 
-		cmd = exec.Command("git", "-C", repoDir, "checkout", branch)
-		if err := cmd.Run(); err != nil {
-			return "", fmt.Errorf("git checkout: %w", err)
+		// Sparse directories may have changed since the clone
+		if err := sparseCheckout(ctx, repoDir, clone.Sparse); err != nil {
+			return err
 		}
 
-		cmd = exec.Command("git", "-C", repoDir, "reset", "--hard", "origin/"+branch)
+		cmd = gitCommand(ctx, "-C", repoDir, "checkout", branch)
 		if err := cmd.Run(); err != nil {
-			return "", fmt.Errorf("git reset: %w", err)
+			return fmt.Errorf("git checkout: %w", err)
 		}
-	} else {
-		// Clone fresh
-		fmt.Printf("Cloning %s...\n", repoURL)
-		cmd := exec.Command("git", "clone", "-b", branch, repoURL, repoDir)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+
+		cmd = gitCommand(ctx, "-C", repoDir, "reset", "--hard", "origin/"+branch)
 		if err := cmd.Run(); err != nil {
-			return "", fmt.Errorf("git clone: %w", err)
+			return fmt.Errorf("git reset: %w", err)
 		}
+		return nil
 	}
 
-	return repoDir, nil
+	// Clone fresh
+	fmt.Printf("Cloning %s...\n", repoURL)
+	args := []string{"clone", "-b", branch}
+	if clone.Depth > 0 {
+		// Shallow clones take only the branch unless told otherwise, and
+		// task branches are needed too
+		args = append(args, "--depth", strconv.Itoa(clone.Depth), "--no-single-branch")
+	}
+	if clone.Filter != "" {
+		args = append(args, "--filter="+clone.Filter)
+	}
+	if len(clone.Sparse) > 0 {
+		args = append(args, "--sparse") // Top-level files only, until sparseCheckout
+	}
+	cmd := gitCommand(ctx, append(args, repoURL, repoDir)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("git clone: %w", err)
+	}
+	return sparseCheckout(ctx, repoDir, clone.Sparse)
+}
+
+// sparseCheckout checks out only dirs (and top-level files) in the
+// worktree at dir, or everything again if dirs is empty. Each worktree
+// keeps its own setting.
+func sparseCheckout(ctx context.Context, dir string, dirs []string) error {
+	var cmd *exec.Cmd
+	if len(dirs) > 0 {
+		if err := tools.Require(tools.Git, tools.MinGitSparse, "clone.sparse"); err != nil {
+			return err
+		}
+		cmd = gitCommand(ctx, append([]string{"-C", dir, "sparse-checkout", "set", "--cone", "--"}, dirs...)...)
+	} else if out, _ := tools.Command(tools.Git, "-C", dir, "config", "--bool", "core.sparseCheckout").Output(); strings.TrimSpace(string(out)) == "true" {
+		cmd = gitCommand(ctx, "-C", dir, "sparse-checkout", "disable")
+	} else {
+		return nil
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git sparse-checkout: %w\nOutput: %s", err, string(out))
+	}
+	return nil
+}
+
+// gitCommand runs git with args in a process group of its own, killed when
+// ctx is done.
+func gitCommand(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := procgroup.Command(ctx, tools.Git.Path(), args...)
+	cmd.Env = tools.Env(tools.Git)
+	return cmd
+}
+
+// WorktreeOptions shape an agent's worktree.
+type WorktreeOptions struct {
+	Sparse []string // Directories checked out; empty is all
+	Keep   []string // Untracked files kept through resets (git clean exclude patterns)
+	Spare  []string // Worktrees no agent uses any more, taken before making a new one
 }
 
-// CreateWorktree creates an agent worktree for a project.
-func (s *Setup) CreateWorktree(projectID, agentID int, branch string) (string, error) {
+// CreateWorktree sets up an agent's worktree for a project. A worktree
+// already at the agent's directory, or else a spare one, is reused warm:
+// reset as between tasks, so ignored files and those matching opts.Keep
+// (installed dependencies, build caches) survive. Only when there's none,
+// or it can't be reset, is a new one checked out.
+func (s *Setup) CreateWorktree(projectID, agentID int, branch string, opts WorktreeOptions) (string, error) {
 	projectDir := filepath.Join(s.MachinatorDir, "projects", fmt.Sprintf("%d", projectID))
 	repoDir := filepath.Join(projectDir, "repo")
 	agentDir := filepath.Join(projectDir, "agents", fmt.Sprintf("%d", agentID))
 
-	// Remove existing worktree if present
+	if !isWorktreeOf(agentDir, repoDir) {
+		for _, spare := range opts.Spare {
+			if !isWorktreeOf(spare, repoDir) {
+				continue
+			}
+			if tools.Command(tools.Git, "-C", repoDir, "worktree", "move", spare, agentDir).Run() == nil {
+				break
+			}
+		}
+	}
+	if isWorktreeOf(agentDir, repoDir) {
+		err := s.ResetWorktree(agentDir, branch, opts.Keep)
+		if err == nil {
+			err = sparseCheckout(context.Background(), agentDir, opts.Sparse)
+		}
+		if err == nil {
+			return agentDir, GuardBeadsDB(repoDir)
+		}
+	}
+
+	// Remove whatever is left of an existing worktree
 	if _, err := os.Stat(agentDir); err == nil {
-		cmd := exec.Command("git", "-C", repoDir, "worktree", "remove", "--force", agentDir)
+		cmd := tools.Command(tools.Git, "-C", repoDir, "worktree", "remove", "--force", agentDir)
 		cmd.Run() // Ignore errors
 		os.RemoveAll(agentDir)
 	}
 
-	// Create new worktree (detached is expected, suppress the advice)
-	cmd := exec.Command("git", "-c", "advice.detachedHead=false", "-C", repoDir, "worktree", "add", "--detach", agentDir, "origin/"+branch)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return "", fmt.Errorf("git worktree add: %w\nOutput: %s", err, string(output))
+	if err := addWorktree(repoDir, agentDir, branch, opts.Sparse); err != nil {
+		return "", err
 	}
 
+	// Clones made before the guard existed get it here
+	if err := GuardBeadsDB(repoDir); err != nil {
+		return "", err
+	}
 	return agentDir, nil
 }
 
-// ResetWorktree resets a worktree to a clean state.
-func (s *Setup) ResetWorktree(worktreeDir, branch string) error {
-	cmd := exec.Command("git", "-C", worktreeDir, "fetch", "origin")
+// SpareWorktrees lists the worktrees under a project's agents directory
+// that belong to none of agents, e.g. those of agents removed from state.
+func (s *Setup) SpareWorktrees(projectID int, agents map[int]bool) []string {
+	agentsDir := filepath.Join(s.MachinatorDir, "projects", fmt.Sprintf("%d", projectID), "agents")
+	entries, _ := os.ReadDir(agentsDir)
+	var spare []string
+	for _, e := range entries {
+		if id, err := strconv.Atoi(e.Name()); err == nil && e.IsDir() && !agents[id] {
+			spare = append(spare, filepath.Join(agentsDir, e.Name()))
+		}
+	}
+	return spare
+}
+
+// isWorktreeOf reports whether dir is a checkout of the clone at repoDir.
+func isWorktreeOf(dir, repoDir string) bool {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+		return false // Don't let git find a repo further up
+	}
+	gitDir, err := commonGitDir(dir)
+	if err != nil {
+		return false
+	}
+	// git resolves symlinks in the paths it records, e.g. /tmp on macOS
+	got, err1 := filepath.EvalSymlinks(gitDir)
+	want, err2 := filepath.EvalSymlinks(filepath.Join(repoDir, ".git"))
+	return err1 == nil && err2 == nil && got == want
+}
+
+// AddRepoWorktree checks out an extra repo's branch in an agent's worktree
+// at .repos/<name>, replacing any earlier checkout, and keeps .repos out of
+// the agent's own repo. Only the sparse directories are checked out if any
+// are given.
+func AddRepoWorktree(repoDir, agentDir, name, branch string, sparse []string) (string, error) {
+	gitDir, err := commonGitDir(agentDir)
+	if err != nil {
+		return "", err
+	}
+	if err := exclude(gitDir, []string{"/.repos/"}); err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(agentDir, ".repos", name)
+	if _, err := os.Stat(dir); err == nil {
+		tools.Command(tools.Git, "-C", repoDir, "worktree", "remove", "--force", dir).Run() // Ignore errors
+		os.RemoveAll(dir)
+	}
+	tools.Command(tools.Git, "-C", repoDir, "worktree", "prune").Run()
+	if err := addWorktree(repoDir, dir, branch, sparse); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// addWorktree adds a detached worktree of origin/<branch> at dir. With
+// sparse directories it's made empty and checked out once they're set, so
+// the rest of the repo is never written out.
+func addWorktree(repoDir, dir, branch string, sparse []string) error {
+	// Detached is expected, suppress the advice
+	args := []string{"-c", "advice.detachedHead=false", "-C", repoDir, "worktree", "add", "--detach"}
+	if len(sparse) > 0 {
+		args = append(args, "--no-checkout")
+	}
+	if out, err := tools.Command(tools.Git, append(args, dir, "origin/"+branch)...).CombinedOutput(); err != nil {
+		return fmt.Errorf("git worktree add: %w\nOutput: %s", err, string(out))
+	}
+	if len(sparse) == 0 {
+		return nil
+	}
+	if err := sparseCheckout(context.Background(), dir, sparse); err != nil {
+		return err
+	}
+	if out, err := tools.Command(tools.Git, "-C", dir, "reset", "-q", "--hard", "origin/"+branch).CombinedOutput(); err != nil {
+		return fmt.Errorf("git reset: %w\nOutput: %s", err, string(out))
+	}
+	return nil
+}
+
+// ResetWorktree resets a worktree to a clean state: tracked files as on
+// origin/<branch>, untracked ones removed unless ignored or matching keep
+// (git clean exclude patterns, e.g. "node_modules").
+func (s *Setup) ResetWorktree(worktreeDir, branch string, keep []string) error {
+	cmd := tools.Command(tools.Git, "-C", worktreeDir, "fetch", "origin")
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("git fetch: %w", err)
 	}
 
-	cmd = exec.Command("git", "-C", worktreeDir, "reset", "--hard", "origin/"+branch)
+	// Leave any task branch first, so resetting doesn't move it
+	cmd = tools.Command(tools.Git, "-C", worktreeDir, "checkout", "-q", "--detach")
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("git checkout: %w", err)
+	}
+
+	cmd = tools.Command(tools.Git, "-C", worktreeDir, "reset", "--hard", "origin/"+branch)
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("git reset: %w", err)
 	}
 
-	cmd = exec.Command("git", "-C", worktreeDir, "clean", "-fd")
+	args := []string{"-C", worktreeDir, "clean", "-fd"}
+	for _, pattern := range keep {
+		args = append(args, "-e", pattern)
+	}
+	cmd = tools.Command(tools.Git, args...)
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("git clean: %w", err)
 	}
@@ -0,0 +1,125 @@
+package setup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bryantinsley/machinator/backend/internal/project"
+)
+
+func TestAddRepoWorktree(t *testing.T) {
+	root := t.TempDir()
+	clone := func(name string) string {
+		origin, repo := filepath.Join(root, name+".git"), filepath.Join(root, name)
+		gitT(t, root, "init", "-q", "--bare", "-b", "main", origin)
+		gitT(t, root, "clone", "-q", origin, repo)
+		os.WriteFile(filepath.Join(repo, name+".txt"), []byte(name+"\n"), 0644)
+		gitT(t, repo, "add", "-A")
+		gitT(t, repo, "commit", "-qm", "init")
+		gitT(t, repo, "push", "-q", "origin", "HEAD:main")
+		return repo
+	}
+	backend, web := clone("backend"), clone("web")
+	agentDir := filepath.Join(root, "agent")
+	gitT(t, backend, "worktree", "add", "-q", "--detach", agentDir, "origin/main")
+
+	// Twice: setting up an agent again replaces its checkout
+	for range 2 {
+		dir, err := AddRepoWorktree(web, agentDir, "web", "main", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "web.txt")); err != nil {
+			t.Errorf("web not checked out in %s: %v", dir, err)
+		}
+	}
+	if status := gitT(t, agentDir, "status", "--porcelain"); status != "" {
+		t.Errorf("extra repo shows in the agent's own repo:\n%s", status)
+	}
+}
+
+func TestCloneRepoTrimmed(t *testing.T) {
+	root := t.TempDir()
+	origin := filepath.Join(root, "origin")
+	gitT(t, root, "init", "-q", "-b", "main", origin)
+	for _, file := range []string{"README.md", "api/api.go", "web/index.html", ".beads/issues.jsonl"} {
+		os.MkdirAll(filepath.Join(origin, filepath.Dir(file)), 0755)
+		os.WriteFile(filepath.Join(origin, file), []byte(file), 0644)
+		gitT(t, origin, "add", "-A")
+		gitT(t, origin, "commit", "-qm", file)
+	}
+
+	s := New(filepath.Join(root, "machinator"))
+	clone := project.CloneConfig{Depth: 2, Filter: "blob:none", Sparse: []string{"api", ".beads"}}
+	repoDir, err := s.CloneRepo(context.Background(), 1, "file://"+origin, "main", clone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := gitT(t, repoDir, "rev-list", "--count", "HEAD"); n != "2" {
+		t.Errorf("cloned %s commits, want 2", n)
+	}
+	agentDir, err := s.CreateWorktree(1, 1, "main", WorktreeOptions{Sparse: clone.Sparse})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{repoDir, agentDir} {
+		for file, want := range map[string]bool{"README.md": true, "api/api.go": true, ".beads/issues.jsonl": true, "web/index.html": false} {
+			if _, err := os.Stat(filepath.Join(dir, file)); (err == nil) != want {
+				t.Errorf("%s checked out in %s: %v, want %v", file, dir, err == nil, want)
+			}
+		}
+	}
+
+	// Dropping the sparse directories checks everything out again
+	if _, err := s.CloneRepo(context.Background(), 1, "file://"+origin, "main", project.CloneConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(repoDir, "web/index.html")); err != nil {
+		t.Errorf("web not checked out once sparse is dropped: %v", err)
+	}
+}
+
+func TestCreateWorktreeReusesSpare(t *testing.T) {
+	root := t.TempDir()
+	origin := filepath.Join(root, "origin")
+	gitT(t, root, "init", "-q", "-b", "main", origin)
+	os.WriteFile(filepath.Join(origin, "package.json"), []byte("{}"), 0644)
+	gitT(t, origin, "add", "-A")
+	gitT(t, origin, "commit", "-qm", "init")
+
+	s := New(filepath.Join(root, "machinator"))
+	if _, err := s.CloneRepo(context.Background(), 1, origin, "main", project.CloneConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	old, err := s.CreateWorktree(1, 1, "main", WorktreeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.MkdirAll(filepath.Join(old, "node_modules", "left-pad"), 0755)
+	os.WriteFile(filepath.Join(old, "stray.txt"), nil, 0644)
+	os.WriteFile(filepath.Join(old, "package.json"), []byte("changed"), 0644)
+
+	// Agent 1 is gone; agent 2 takes its worktree, dependencies and all
+	spare := s.SpareWorktrees(1, map[int]bool{2: true})
+	if len(spare) != 1 || spare[0] != old {
+		t.Fatalf("SpareWorktrees = %q, want [%s]", spare, old)
+	}
+	dir, err := s.CreateWorktree(1, 2, "main", WorktreeOptions{Keep: []string{"node_modules"}, Spare: spare})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("spare worktree still at %s", old)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "node_modules", "left-pad")); err != nil {
+		t.Errorf("kept dependencies lost: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "stray.txt")); !os.IsNotExist(err) {
+		t.Errorf("untracked file survived the reset")
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "package.json")); string(data) != "{}" {
+		t.Errorf("package.json = %q, want it reset", data)
+	}
+}
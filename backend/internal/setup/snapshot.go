@@ -0,0 +1,201 @@
+package setup
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/bryantinsley/machinator/backend/internal/procgroup"
+	"github.com/bryantinsley/machinator/backend/internal/tools"
+)
+
+// snapshotRef is where the end state of a task's last failed attempt is
+// kept. Refs outside refs/heads are shared by all worktrees of the clone.
+func snapshotRef(taskID string) string {
+	return "refs/machinator/attempts/" + taskID
+}
+
+// SaveSnapshot records a worktree as a failed attempt left it, commits and
+// uncommitted changes (new files included), as a commit under a ref for the
+// task, so a retry can compare it with the branch it starts from.
+func SaveSnapshot(worktreeDir, taskID string) error {
+	index, err := os.CreateTemp("", "machinator-snapshot-index-")
+	if err != nil {
+		return err
+	}
+	index.Close()
+	defer os.Remove(index.Name())
+
+	// A separate index, so the worktree's own staging is left alone
+	git := func(args ...string) (string, error) {
+		cmd := tools.Command(tools.Git, append([]string{"-C", worktreeDir,
+			"-c", "user.name=Machinator", "-c", "user.email=machinator@machinator.local"}, args...)...)
+		cmd.Env = append(cmd.Environ(), "GIT_INDEX_FILE="+index.Name())
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			return "", fmt.Errorf("git %s: %w\nOutput: %s", args[0], err, strings.TrimSpace(string(out)))
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+	os.Remove(index.Name()) // git wants to create it
+	if _, err := git("add", "-A"); err != nil {
+		return err
+	}
+	tree, err := git("write-tree")
+	if err != nil {
+		return err
+	}
+	commit, err := git("commit-tree", tree, "-p", "HEAD", "-m", "End of a failed attempt at "+taskID)
+	if err != nil {
+		return err
+	}
+	_, err = git("update-ref", snapshotRef(taskID), commit)
+	return err
+}
+
+// SnapshotDiff compares the task's last failed attempt with the worktree's
+// HEAD: what the attempt had (committed or not) that HEAD doesn't, as a
+// --stat summary and a diff, leaving out .beads and files matching ignore.
+// Changes made to the branch since the attempt started aren't shown. Both
+// are empty if no attempt was saved or it left nothing behind.
+func SnapshotDiff(worktreeDir, taskID string, ignore []string) (string, string, error) {
+	ref := snapshotRef(taskID)
+	if tools.Command(tools.Git, "-C", worktreeDir, "rev-parse", "-q", "--verify", ref).Run() != nil {
+		return "", "", nil
+	}
+	diff := func(opts ...string) (string, error) {
+		args := append(append([]string{"-C", worktreeDir, "diff"}, opts...), "HEAD..."+ref)
+		out, err := tools.Command(tools.Git, append(args, pathspec(ignore)...)...).Output()
+		if err != nil {
+			return "", fmt.Errorf("git diff: %w", err)
+		}
+		return strings.TrimRight(string(out), "\n"), nil
+	}
+	stat, err := diff("--stat")
+	if err != nil || stat == "" {
+		return "", "", err
+	}
+	patch, err := diff()
+	return stat, patch, err
+}
+
+// RemoveSnapshot deletes a task's saved attempt, if any.
+func RemoveSnapshot(worktreeDir, taskID string) error {
+	ref := snapshotRef(taskID)
+	if tools.Command(tools.Git, "-C", worktreeDir, "rev-parse", "-q", "--verify", ref).Run() != nil {
+		return nil
+	}
+	if out, err := tools.Command(tools.Git, "-C", worktreeDir, "update-ref", "-d", ref).CombinedOutput(); err != nil {
+		return fmt.Errorf("git update-ref: %w\nOutput: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// SnapshotFiles lists the files the task's last failed attempt changed
+// since it left origin/<branch> that origin/<branch> doesn't have as the
+// attempt left them, with a --stat of those changes, leaving out .beads
+// and files matching ignore. Empty if no attempt was saved.
+func SnapshotFiles(repoDir, branch, taskID string, ignore []string) ([]string, string, error) {
+	ref := snapshotRef(taskID)
+	if tools.Command(tools.Git, "-C", repoDir, "rev-parse", "-q", "--verify", ref).Run() != nil {
+		return nil, "", nil
+	}
+	if out, err := tools.Command(tools.Git, "-C", repoDir, "fetch", "-q", "origin").CombinedOutput(); err != nil {
+		return nil, "", fmt.Errorf("git fetch: %w\nOutput: %s", err, strings.TrimSpace(string(out)))
+	}
+	names := func(base string) ([]string, error) {
+		args := append([]string{"-C", repoDir, "diff", "--name-only", base}, pathspec(ignore)...)
+		out, err := tools.Command(tools.Git, args...).Output()
+		if err != nil {
+			return nil, fmt.Errorf("git diff: %w", err)
+		}
+		return strings.Fields(string(out)), nil
+	}
+	changed, err := names("origin/" + branch + "..." + ref)
+	if err != nil {
+		return nil, "", err
+	}
+	differ, err := names("origin/" + branch + ".." + ref)
+	if err != nil {
+		return nil, "", err
+	}
+	var files []string // Changed by the attempt and not (yet) the same on the branch
+	for _, f := range changed {
+		if slices.Contains(differ, f) {
+			files = append(files, f)
+		}
+	}
+	if len(files) == 0 {
+		return nil, "", nil
+	}
+	out, err := tools.Command(tools.Git, append([]string{"-C", repoDir, "diff", "--stat", "origin/" + branch + "..." + ref, "--"}, files...)...).Output()
+	if err != nil {
+		return nil, "", fmt.Errorf("git diff: %w", err)
+	}
+	return files, strings.TrimRight(string(out), "\n"), nil
+}
+
+// CommitSnapshotFiles commits what the task's last failed attempt changed
+// in files on top of origin/<branch>, in a temporary worktree of repoDir,
+// and pushes it. check, if set, runs in the worktree first and must pass.
+// Nothing is pushed if the changes don't apply or the check fails; the
+// check is killed, with everything it started, when ctx is done. Returns
+// the commit.
+func CommitSnapshotFiles(ctx context.Context, repoDir, branch, taskID string, files []string, message, check string) (string, error) {
+	ref := snapshotRef(taskID)
+	wt, err := os.MkdirTemp("", "machinator-split-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(wt)
+	git := func(dir string, args ...string) (string, error) {
+		out, err := tools.Command(tools.Git, append([]string{"-C", dir,
+			"-c", "user.name=Machinator", "-c", "user.email=machinator@machinator.local"}, args...)...).CombinedOutput()
+		if err != nil {
+			return "", fmt.Errorf("git %s: %w\nOutput: %s", args[0], err, strings.TrimSpace(string(out)))
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+
+	if _, err := git(repoDir, "fetch", "-q", "origin"); err != nil {
+		return "", err
+	}
+	if _, err := git(repoDir, "worktree", "add", "-q", "--detach", wt, "origin/"+branch); err != nil {
+		return "", err
+	}
+	defer git(repoDir, "worktree", "remove", "--force", wt)
+
+	// The attempt's changes, not its files, so later changes to them stay
+	patch, err := tools.Command(tools.Git, append([]string{"-C", repoDir, "diff", "--binary", "origin/" + branch + "..." + ref, "--"}, files...)...).Output()
+	if err != nil {
+		return "", fmt.Errorf("git diff: %w", err)
+	}
+	apply := tools.Command(tools.Git, "-C", wt, "apply", "--3way", "--index")
+	apply.Stdin = bytes.NewReader(patch)
+	if out, err := apply.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("the attempt's changes to %s don't apply to %s: %w\nOutput: %s",
+			strings.Join(files, ", "), branch, err, strings.TrimSpace(string(out)))
+	}
+	if tools.Command(tools.Git, "-C", wt, "diff", "--cached", "--quiet").Run() == nil {
+		return "", fmt.Errorf("%s already has the attempt's changes to %s", branch, strings.Join(files, ", "))
+	}
+
+	if check != "" {
+		cmd := procgroup.Command(ctx, "sh", "-c", check)
+		cmd.Dir = wt
+		cmd.Env = tools.Environ() // It runs the attempt's code
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return "", fmt.Errorf("%q failed: %v\n%s", check, err, tail(string(out), 20))
+		}
+	}
+	if _, err := git(wt, "commit", "-q", "-m", message); err != nil {
+		return "", err
+	}
+	if _, err := git(wt, "push", "-q", "origin", "HEAD:"+branch); err != nil {
+		return "", err
+	}
+	return git(wt, "rev-parse", "--short", "HEAD")
+}
@@ -0,0 +1,119 @@
+package setup
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSnapshotDiff(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755)
+		os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+	}
+	gitT(t, dir, "init", "-q")
+	write("main.go", "package main\n")
+	gitT(t, dir, "add", "-A")
+	gitT(t, dir, "commit", "-qm", "init")
+	gitT(t, dir, "tag", "start")
+
+	if stat, diff, err := SnapshotDiff(dir, "t-1", nil); err != nil || stat != "" || diff != "" {
+		t.Fatalf("nothing saved: %q, %q, %v", stat, diff, err)
+	}
+
+	// The attempt commits once, then leaves edits, a new file and staging
+	write("main.go", "package main\n\nfunc tried() {}\n")
+	gitT(t, dir, "commit", "-qam", "attempt")
+	write("main.go", "package main\n\nfunc tried() { panic(1) }\n")
+	write("notes.txt", "new file\n")
+	write(".beads/issues.jsonl", "{}\n")
+	gitT(t, dir, "add", "notes.txt")
+	if err := SaveSnapshot(dir, "t-1"); err != nil {
+		t.Fatal(err)
+	}
+	if out, _ := exec.Command("git", "-C", dir, "diff", "--cached", "--name-only").Output(); strings.TrimSpace(string(out)) != "notes.txt" {
+		t.Errorf("snapshot changed the worktree's staging: %q", out)
+	}
+
+	// The retry starts over from the original commit, which has moved on
+	gitT(t, dir, "reset", "-q", "--hard", "start")
+	gitT(t, dir, "clean", "-fdq")
+	write("other.go", "package main\n")
+	gitT(t, dir, "add", "-A")
+	gitT(t, dir, "commit", "-qm", "someone else")
+
+	stat, diff, err := SnapshotDiff(dir, "t-1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stat, "2 files changed") || !strings.Contains(diff, "+func tried() { panic(1) }") || !strings.Contains(diff, "+new file") {
+		t.Errorf("stat:\n%s\ndiff:\n%s", stat, diff)
+	}
+	if strings.Contains(diff, "other.go") || strings.Contains(diff, ".beads") {
+		t.Errorf("diff shows changes that aren't the attempt's:\n%s", diff)
+	}
+
+	if err := RemoveSnapshot(dir, "t-1"); err != nil {
+		t.Fatal(err)
+	}
+	if stat, _, _ := SnapshotDiff(dir, "t-1", nil); stat != "" {
+		t.Errorf("removed snapshot still diffs: %s", stat)
+	}
+}
+
+func TestCommitSnapshotFiles(t *testing.T) {
+	root := t.TempDir()
+	origin, repo := filepath.Join(root, "origin.git"), filepath.Join(root, "repo")
+	write := func(name, content string) {
+		os.WriteFile(filepath.Join(repo, name), []byte(content), 0644)
+	}
+	gitT(t, root, "init", "-q", "--bare", "-b", "main", origin)
+	gitT(t, root, "clone", "-q", origin, repo)
+	write("a.txt", "a\n")
+	write("b.txt", "b\n")
+	gitT(t, repo, "add", "-A")
+	gitT(t, repo, "commit", "-qm", "init")
+	gitT(t, repo, "push", "-q", "origin", "HEAD:main")
+
+	// A failed attempt finishes a.txt and half of b.txt, then main moves on
+	write("a.txt", "a done\n")
+	write("b.txt", "b half\n")
+	if err := SaveSnapshot(repo, "t-1"); err != nil {
+		t.Fatal(err)
+	}
+	gitT(t, repo, "checkout", "-q", ".")
+	write("c.txt", "c\n")
+	gitT(t, repo, "add", "-A")
+	gitT(t, repo, "commit", "-qm", "main moves")
+	gitT(t, repo, "push", "-q", "origin", "HEAD:main")
+
+	files, stat, err := SnapshotFiles(repo, "main", "t-1", nil)
+	if err != nil || strings.Join(files, " ") != "a.txt b.txt" || !strings.Contains(stat, "2 files changed") {
+		t.Fatalf("snapshot files: %v %q %v", files, stat, err)
+	}
+	if _, err := CommitSnapshotFiles(context.Background(), repo, "main", "t-1", []string{"a.txt"}, "part of t-1", "false"); err == nil {
+		t.Error("committed despite a failing check")
+	}
+	// The check runs the attempt's code, so without machinator's token
+	t.Setenv("GITHUB_TOKEN", "ghs_secret")
+	if _, err := CommitSnapshotFiles(context.Background(), repo, "main", "t-1", []string{"a.txt"}, "part of t-1", `test -f c.txt && test -z "$GITHUB_TOKEN"`); err != nil {
+		t.Fatal(err)
+	}
+	gitT(t, repo, "fetch", "-q")
+	if got := gitT(t, repo, "show", "origin/main:a.txt"); got != "a done" {
+		t.Errorf("a.txt on main = %q", got)
+	}
+	if got := gitT(t, repo, "show", "origin/main:b.txt"); got != "b" {
+		t.Errorf("b.txt on main = %q, want it left alone", got)
+	}
+	if files, _, _ := SnapshotFiles(repo, "main", "t-1", nil); strings.Join(files, " ") != "b.txt" {
+		t.Errorf("left of the attempt: %v, want b.txt", files)
+	}
+	if out := gitT(t, repo, "worktree", "list"); strings.Count(out, "\n") != 0 {
+		t.Errorf("temporary worktree left behind:\n%s", out)
+	}
+}
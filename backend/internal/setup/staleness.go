@@ -0,0 +1,55 @@
+package setup
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/tools"
+)
+
+// Behind is how far a clone's checkout has fallen behind its remote branch.
+type Behind struct {
+	Commits int           // Commits on origin/<branch> that HEAD lacks
+	Age     time.Duration // How long the oldest of them has been missing
+}
+
+// BehindRemote fetches origin and reports how far repoDir's HEAD is behind
+// origin/<branch>.
+func BehindRemote(repoDir, branch string) (Behind, error) {
+	git := func(args ...string) (string, error) {
+		out, err := tools.Command(tools.Git, append([]string{"-C", repoDir}, args...)...).CombinedOutput()
+		if err != nil {
+			return "", fmt.Errorf("git %s: %w\nOutput: %s", args[0], err, strings.TrimSpace(string(out)))
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+	if _, err := git("fetch", "-q", "origin"); err != nil {
+		return Behind{}, err
+	}
+	out, err := git("log", "--format=%ct", "HEAD..origin/"+branch)
+	if err != nil || out == "" {
+		return Behind{}, err
+	}
+	times := strings.Split(out, "\n")
+	oldest, err := strconv.ParseInt(times[len(times)-1], 10, 64)
+	if err != nil {
+		return Behind{}, fmt.Errorf("parse commit time: %w", err)
+	}
+	return Behind{Commits: len(times), Age: time.Since(time.Unix(oldest, 0))}, nil
+}
+
+// SyncRepo resets a clone's checkout to origin/<branch>, as CloneRepo does
+// for an existing clone, without fetching or printing progress.
+func SyncRepo(repoDir, branch string) error {
+	for _, args := range [][]string{
+		{"checkout", "-q", branch},
+		{"reset", "-q", "--hard", "origin/" + branch},
+	} {
+		if out, err := tools.Command(tools.Git, append([]string{"-C", repoDir}, args...)...).CombinedOutput(); err != nil {
+			return fmt.Errorf("git %s: %w\nOutput: %s", args[0], err, strings.TrimSpace(string(out)))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package setup
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBehindRemote(t *testing.T) {
+	root := t.TempDir()
+	origin, repo, other := filepath.Join(root, "origin.git"), filepath.Join(root, "repo"), filepath.Join(root, "other")
+
+	gitT(t, root, "init", "-q", "--bare", "-b", "main", origin)
+	gitT(t, root, "clone", "-q", origin, other)
+	gitT(t, other, "commit", "-q", "--allow-empty", "-m", "init")
+	gitT(t, other, "push", "-q", "origin", "HEAD:main")
+	gitT(t, root, "clone", "-q", "-b", "main", origin, repo)
+
+	if b, err := BehindRemote(repo, "main"); err != nil || b.Commits != 0 || b.Age != 0 {
+		t.Fatalf("fresh clone: %+v, %v", b, err)
+	}
+
+	// Two commits land upstream, the first of them two days ago
+	old := time.Now().Add(-48 * time.Hour).Format(time.RFC3339)
+	gitEnvT(t, other, []string{"GIT_COMMITTER_DATE=" + old}, "commit", "-q", "--allow-empty", "-m", "old")
+	gitT(t, other, "commit", "-q", "--allow-empty", "-m", "new")
+	gitT(t, other, "push", "-q", "origin", "HEAD:main")
+
+	b, err := BehindRemote(repo, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Commits != 2 || b.Age < 47*time.Hour || b.Age > 49*time.Hour {
+		t.Errorf("behind: %+v, want 2 commits about 48h old", b)
+	}
+
+	if err := SyncRepo(repo, "main"); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := BehindRemote(repo, "main"); err != nil || b.Commits != 0 {
+		t.Errorf("after sync: %+v, %v", b, err)
+	}
+}
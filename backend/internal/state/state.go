@@ -7,17 +7,48 @@ import (
 	"path/filepath"
 	"sync"
 	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/rundb"
 )
 
 // State holds the persistent orchestrator state.
 type State struct {
 	mu            sync.RWMutex
-	MachinatorDir string `json:"-"`
+	MachinatorDir string    `json:"-"`
+	db            *rundb.DB // nil for in-memory state
 
 	Agents           []*Agent `json:"agents"`
 	AssignmentPaused bool     `json:"assignment_paused"`
 	LaunchesPaused   bool     `json:"launches_paused"`
 	BarredTasks      []string `json:"barred_tasks"`
+
+	// BarReasons says why a barred task was barred, when a reason was given.
+	BarReasons map[string]string `json:"bar_reasons,omitempty"`
+
+	// Cooldowns holds tasks that may not be assigned until the given time.
+	// Not persisted; a restart clears them.
+	Cooldowns map[string]time.Time `json:"-"`
+
+	// hold says why the assigner is holding back new tasks (low disk or
+	// battery), or is empty. Not persisted.
+	hold string
+
+	// spent says which of the run's budgets is used up, holding back new
+	// tasks for good, and tokens counts what its runs have used. Not
+	// persisted.
+	spent  string
+	tokens int64
+
+	// batch caps how many tasks the assigner may start this run (0 for no
+	// cap) and batched counts those it has. Not persisted.
+	batch, batched int64
+
+	// wake cuts the assigner's sleep short when new tasks may have landed.
+	wake chan struct{}
+
+	// saveErr is the last failure to write the run database, until
+	// TakeSaveError reports it. Not persisted.
+	saveErr error
 }
 
 // Agent represents an agent slot.
@@ -26,60 +57,163 @@ type Agent struct {
 	State            string    `json:"state"` // pending, ready, assigned
 	PID              int       `json:"pid,omitempty"`
 	TaskID           string    `json:"task_id,omitempty"`
+	Model            string    `json:"model,omitempty"` // Chosen by the assigner, or at launch
 	StartedAt        time.Time `json:"started_at,omitempty"`
 	LastActivity     time.Time `json:"last_activity,omitempty"`
 	LogOffset        int64     `json:"log_offset,omitempty"`
 	MarkedForRemoval bool      `json:"marked_for_removal,omitempty"`
+	ReadySince       time.Time `json:"-"` // When it last became ready, for autoscaling
+	StopRequest      string    `json:"-"` // Pending Stop* request for the watcher
+	AssignRequest    string    `json:"-"` // Task to assign by hand, for the assigner
 }
 
+// Stop requests made from the TUI and carried out by the agent's watcher.
+const (
+	StopKill     = "kill"     // Terminate and fail the task
+	StopRestart  = "restart"  // Terminate and relaunch the same task
+	StopReassign = "reassign" // Terminate and return the task to the pool
+)
+
 // New creates a new State instance.
 func New(machinatorDir string) *State {
 	return &State{
 		MachinatorDir: machinatorDir,
 		Agents:        make([]*Agent, 0),
 		BarredTasks:   make([]string, 0),
+		BarReasons:    make(map[string]string),
+		wake:          make(chan struct{}, 1),
 	}
 }
 
-// Load loads state from disk.
+// Load opens the run database and loads state from it. A legacy state.json
+// is imported on first load and renamed to state.json.migrated.
 func Load(machinatorDir string) (*State, error) {
+	db, err := rundb.Open(machinatorDir)
+	if err != nil {
+		return nil, err
+	}
+
+	snap, err := db.LoadSnapshot()
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("load state: %w", err)
+	}
+
 	s := New(machinatorDir)
-	path := filepath.Join(machinatorDir, "state.json")
+	s.db = db
+	if snap.Empty() {
+		migrated, err := s.migrateJSON()
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		if migrated {
+			return s, nil
+		}
+	}
 
+	s.AssignmentPaused = snap.AssignmentPaused
+	s.LaunchesPaused = snap.LaunchesPaused
+	s.BarredTasks = append(s.BarredTasks, snap.BarredTasks...)
+	for id, reason := range snap.BarReasons {
+		s.BarReasons[id] = reason
+	}
+	for _, a := range snap.Agents {
+		s.Agents = append(s.Agents, &Agent{
+			ID:               a.ID,
+			State:            a.State,
+			PID:              a.PID,
+			TaskID:           a.TaskID,
+			Model:            a.Model,
+			StartedAt:        a.StartedAt,
+			LastActivity:     a.LastActivity,
+			LogOffset:        a.LogOffset,
+			MarkedForRemoval: a.MarkedForRemoval,
+			ReadySince:       time.Now(), // Idle time isn't kept across restarts
+		})
+	}
+	return s, nil
+}
+
+// migrateJSON imports state.json into the database if it exists.
+func (s *State) migrateJSON() (bool, error) {
+	path := filepath.Join(s.MachinatorDir, "state.json")
 	data, err := os.ReadFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return s, nil // No state file, start fresh
+			return false, nil // No legacy state, start fresh
 		}
-		return nil, fmt.Errorf("read state: %w", err)
+		return false, fmt.Errorf("read state: %w", err)
 	}
 
 	if err := json.Unmarshal(data, s); err != nil {
-		return nil, fmt.Errorf("parse state: %w", err)
+		return false, fmt.Errorf("parse state: %w", err)
+	}
+	if err := s.db.SaveSnapshot(s.snapshot()); err != nil {
+		return false, fmt.Errorf("migrate state: %w", err)
+	}
+	if err := os.Rename(path, path+".migrated"); err != nil {
+		return false, fmt.Errorf("rename migrated state: %w", err)
 	}
+	return true, nil
+}
 
-	s.MachinatorDir = machinatorDir
-	return s, nil
+// DB returns the run database, or nil for in-memory state.
+func (s *State) DB() *rundb.DB {
+	return s.db
 }
 
-// Save persists state to disk.
+// Close closes the run database.
+func (s *State) Close() error {
+	if s.db == nil {
+		return nil
+	}
+	return s.db.Close()
+}
+
+// Save persists state to the run database.
 func (s *State) Save() error {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	path := filepath.Join(s.MachinatorDir, "state.json")
-	data, err := json.MarshalIndent(s, "", "  ")
-	if err != nil {
-		return fmt.Errorf("marshal state: %w", err)
+	if s.db == nil {
+		return nil
 	}
-
-	if err := os.WriteFile(path, data, 0644); err != nil {
+	if err := s.db.SaveSnapshot(s.snapshot()); err != nil {
 		return fmt.Errorf("write state: %w", err)
 	}
-
 	return nil
 }
 
+// snapshot converts state to its database form. Must be called with the lock held.
+func (s *State) snapshot() rundb.Snapshot {
+	snap := rundb.Snapshot{
+		AssignmentPaused: s.AssignmentPaused,
+		LaunchesPaused:   s.LaunchesPaused,
+		BarredTasks:      s.BarredTasks,
+		BarReasons:       s.BarReasons,
+	}
+	for _, a := range s.Agents {
+		snap.Agents = append(snap.Agents, a.record())
+	}
+	return snap
+}
+
+// record converts an agent to its database form.
+func (a *Agent) record() rundb.AgentRecord {
+	return rundb.AgentRecord{
+		ID:               a.ID,
+		State:            a.State,
+		PID:              a.PID,
+		TaskID:           a.TaskID,
+		Model:            a.Model,
+		StartedAt:        a.StartedAt,
+		LastActivity:     a.LastActivity,
+		LogOffset:        a.LogOffset,
+		MarkedForRemoval: a.MarkedForRemoval,
+	}
+}
+
 // GetAgent returns an agent by ID.
 func (s *State) GetAgent(id int) *Agent {
 	s.mu.RLock()
@@ -93,6 +227,28 @@ func (s *State) GetAgent(id int) *Agent {
 	return nil
 }
 
+// AgentsSnapshot returns copies of all agents, safe to read without the lock.
+func (s *State) AgentsSnapshot() []Agent {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	agents := make([]Agent, len(s.Agents))
+	for i, a := range s.Agents {
+		agents[i] = *a
+	}
+	return agents
+}
+
+// BarredTasksSnapshot returns a copy of the barred task list.
+func (s *State) BarredTasksSnapshot() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	barred := make([]string, len(s.BarredTasks))
+	copy(barred, s.BarredTasks)
+	return barred
+}
+
 // ReadyAgents returns agents in ready state.
 func (s *State) ReadyAgents() []*Agent {
 	s.mu.RLock()
@@ -100,7 +256,7 @@ func (s *State) ReadyAgents() []*Agent {
 
 	var ready []*Agent
 	for _, a := range s.Agents {
-		if a.State == "ready" && !a.MarkedForRemoval {
+		if a.State == "ready" && !a.MarkedForRemoval && a.AssignRequest == "" {
 			ready = append(ready, a)
 		}
 	}
@@ -143,7 +299,8 @@ func (s *State) SetAgentReady(agentID int) {
 	for _, a := range s.Agents {
 		if a.ID == agentID {
 			a.State = "ready"
-			s.save()
+			a.ReadySince = time.Now()
+			s.saveAgent(a)
 			return
 		}
 	}
@@ -167,10 +324,29 @@ func (s *State) AddAgent() *Agent {
 		State: "pending", // Setup watcher will move to ready
 	}
 	s.Agents = append(s.Agents, agent)
-	s.save()
+	s.saveAgent(agent)
 	return agent
 }
 
+// RemoveAgent removes an idle agent and saves. Returns false if the agent
+// isn't ready or has a task waiting for it.
+func (s *State) RemoveAgent(agentID int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, a := range s.Agents {
+		if a.ID == agentID {
+			if a.State != "ready" || a.AssignRequest != "" {
+				return false
+			}
+			s.Agents = append(s.Agents[:i], s.Agents[i+1:]...)
+			s.save()
+			return true
+		}
+	}
+	return false
+}
+
 // IsTaskBarred checks if a task is barred from assignment.
 func (s *State) IsTaskBarred(taskID string) bool {
 	s.mu.RLock()
@@ -197,6 +373,109 @@ func (s *State) BarTask(taskID string) {
 	s.BarredTasks = append(s.BarredTasks, taskID)
 }
 
+// CoolDown keeps a task from being assigned for d.
+func (s *State) CoolDown(taskID string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Cooldowns == nil {
+		s.Cooldowns = make(map[string]time.Time)
+	}
+	s.Cooldowns[taskID] = time.Now().Add(d)
+}
+
+// InCooldown checks if a task is waiting out a cooldown.
+func (s *State) InCooldown(taskID string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return time.Now().Before(s.Cooldowns[taskID])
+}
+
+// SetHold records why new tasks are held back, or "" once they aren't.
+func (s *State) SetHold(reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hold = reason
+}
+
+// Hold returns why new tasks are held back, or "".
+func (s *State) Hold() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.hold != "" {
+		return s.hold
+	}
+	return s.spent
+}
+
+// SetSpent holds back new tasks for the rest of the run, because the budget
+// reason names is used up.
+func (s *State) SetSpent(reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.spent = reason
+}
+
+// AddTokens counts tokens used by a run.
+func (s *State) AddTokens(n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens += n
+}
+
+// Tokens returns the tokens runs have used since the orchestrator started.
+func (s *State) Tokens() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tokens
+}
+
+// SetBatch caps how many tasks the assigner may start for the rest of the
+// run, 0 for no cap.
+func (s *State) SetBatch(n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batch = n
+}
+
+// TakeBatchSlot counts a task the assigner is about to start, reporting
+// false instead if the batch is already full.
+func (s *State) TakeBatchSlot() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.batch > 0 && s.batched >= s.batch {
+		return false
+	}
+	s.batched++
+	return true
+}
+
+// Batched returns how many tasks the assigner has started this run.
+func (s *State) Batched() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.batched
+}
+
+// Wake has the assigner look for tasks now rather than at its next pass.
+func (s *State) Wake() {
+	select {
+	case s.wake <- struct{}{}:
+	default: // Already woken
+	}
+}
+
+// Sleep waits d, or until Wake is called.
+func (s *State) Sleep(d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-s.wake:
+	}
+}
+
 // IsTaskAssigned checks if a task is currently assigned to any agent.
 func (s *State) IsTaskAssigned(taskID string) bool {
 	s.mu.RLock()
@@ -211,13 +490,53 @@ func (s *State) IsTaskAssigned(taskID string) bool {
 }
 
 // --- Auto-save setters ---
-// These methods mutate state and automatically persist to disk.
+// These methods mutate state and automatically persist to the run database.
 
-// save is a helper that must be called with the lock held.
+// save writes the whole state. Must be called with the lock held. A
+// failure is kept for TakeSaveError.
 func (s *State) save() {
-	path := filepath.Join(s.MachinatorDir, "state.json")
-	data, _ := json.MarshalIndent(s, "", "  ")
-	os.WriteFile(path, data, 0644)
+	if s.db == nil {
+		return
+	}
+	if err := s.db.SaveSnapshot(s.snapshot()); err != nil {
+		s.saveErr = fmt.Errorf("write state: %w", err)
+	}
+}
+
+// saveAgent writes one agent, for changes that touch nothing else. Must be
+// called with the lock held.
+func (s *State) saveAgent(a *Agent) {
+	if s.db == nil {
+		return
+	}
+	if err := s.db.SaveAgent(a.record()); err != nil {
+		s.saveErr = fmt.Errorf("write state: %w", err)
+	}
+}
+
+// TakeSaveError returns and clears the last failure to write the state to
+// the run database, or nil.
+func (s *State) TakeSaveError() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.saveErr
+	s.saveErr = nil
+	return err
+}
+
+// AssignmentIsPaused reports whether assigning new tasks is paused.
+func (s *State) AssignmentIsPaused() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.AssignmentPaused
+}
+
+// LaunchesArePaused reports whether launching agents on their tasks is
+// paused.
+func (s *State) LaunchesArePaused() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.LaunchesPaused
 }
 
 // SetPaused sets assignment paused state and saves.
@@ -236,8 +555,9 @@ func (s *State) SetLaunchesPaused(paused bool) {
 	s.save()
 }
 
-// AssignTask assigns a task to an agent and saves.
-func (s *State) AssignTask(agentID int, taskID string) bool {
+// AssignTask assigns a task to an agent and saves. model is the model the
+// task should run on, or empty to choose one at launch.
+func (s *State) AssignTask(agentID int, taskID, model string) bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -245,9 +565,10 @@ func (s *State) AssignTask(agentID int, taskID string) bool {
 		if a.ID == agentID {
 			a.State = "assigned"
 			a.TaskID = taskID
+			a.Model = model
 			a.StartedAt = time.Now()
 			a.LastActivity = time.Now()
-			s.save()
+			s.saveAgent(a)
 			return true
 		}
 	}
@@ -263,15 +584,46 @@ func (s *State) CompleteTask(agentID int) {
 		if a.ID == agentID {
 			a.State = "ready"
 			a.TaskID = ""
+			a.Model = ""
 			a.PID = 0
+			a.StopRequest = ""
 			a.StartedAt = time.Time{}
 			a.LastActivity = time.Time{}
-			s.save()
+			a.ReadySince = time.Now()
+			s.saveAgent(a)
+			return
+		}
+	}
+}
+
+// SetAgentModel records the model an agent's task launched on and saves.
+func (s *State) SetAgentModel(agentID int, model string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, a := range s.Agents {
+		if a.ID == agentID {
+			a.Model = model
+			s.saveAgent(a)
 			return
 		}
 	}
 }
 
+// ModelCounts returns how many assigned agents run each model.
+func (s *State) ModelCounts() map[string]int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, a := range s.Agents {
+		if a.State == "assigned" && a.Model != "" {
+			counts[a.Model]++
+		}
+	}
+	return counts
+}
+
 // SetAgentPID sets the PID for an agent and saves.
 func (s *State) SetAgentPID(agentID, pid int) {
 	s.mu.Lock()
@@ -280,12 +632,86 @@ func (s *State) SetAgentPID(agentID, pid int) {
 	for _, a := range s.Agents {
 		if a.ID == agentID {
 			a.PID = pid
-			s.save()
+			s.saveAgent(a)
 			return
 		}
 	}
 }
 
+// RequestStop asks the watcher of an assigned agent to stop its task.
+// Returns false if the agent isn't running a task.
+func (s *State) RequestStop(agentID int, req string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, a := range s.Agents {
+		if a.ID == agentID && a.State == "assigned" {
+			a.StopRequest = req
+			return true
+		}
+	}
+	return false
+}
+
+// RequestAssign asks the assigner to give a task to a specific ready agent,
+// skipping its normal selection. The task's cooldown is cleared.
+func (s *State) RequestAssign(agentID int, taskID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, a := range s.Agents {
+		if a.TaskID == taskID && a.State == "assigned" {
+			return fmt.Errorf("%s is already assigned to agent %d", taskID, a.ID)
+		}
+	}
+	for _, a := range s.Agents {
+		if a.ID != agentID {
+			continue
+		}
+		if a.State != "ready" || a.MarkedForRemoval || a.AssignRequest != "" {
+			return fmt.Errorf("agent %d is not idle", agentID)
+		}
+		a.AssignRequest = taskID
+		delete(s.Cooldowns, taskID)
+		return nil
+	}
+	return fmt.Errorf("no agent %d", agentID)
+}
+
+// TakeAssignRequests returns and clears pending manual assignments, by agent.
+func (s *State) TakeAssignRequests() map[int]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var reqs map[int]string
+	for _, a := range s.Agents {
+		if a.AssignRequest == "" {
+			continue
+		}
+		if reqs == nil {
+			reqs = make(map[int]string)
+		}
+		reqs[a.ID] = a.AssignRequest
+		a.AssignRequest = ""
+	}
+	return reqs
+}
+
+// TakeStopRequest returns and clears an agent's pending stop request.
+func (s *State) TakeStopRequest(agentID int) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, a := range s.Agents {
+		if a.ID == agentID {
+			req := a.StopRequest
+			a.StopRequest = ""
+			return req
+		}
+	}
+	return ""
+}
+
 // UpdateActivity updates the last activity time for an agent.
 func (s *State) UpdateActivity(agentID int) {
 	s.mu.Lock()
@@ -294,26 +720,42 @@ func (s *State) UpdateActivity(agentID int) {
 	for _, a := range s.Agents {
 		if a.ID == agentID {
 			a.LastActivity = time.Now()
-			s.save()
+			s.saveAgent(a)
 			return
 		}
 	}
 }
 
-// BarTaskAndSave adds a task to the barred list and saves.
-func (s *State) BarTaskAndSave(taskID string) {
+// BarTaskAndSave adds a task to the barred list and saves. A non-empty
+// reason replaces any earlier one.
+func (s *State) BarTaskAndSave(taskID, reason string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if reason != "" {
+		if s.BarReasons == nil {
+			s.BarReasons = make(map[string]string)
+		}
+		s.BarReasons[taskID] = reason
+	}
 	for _, t := range s.BarredTasks {
 		if t == taskID {
-			return // Already barred
+			s.save() // Already barred; keep the new reason
+			return
 		}
 	}
 	s.BarredTasks = append(s.BarredTasks, taskID)
 	s.save()
 }
 
+// BarReason returns why a task was barred, or "" if unknown.
+func (s *State) BarReason(taskID string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.BarReasons[taskID]
+}
+
 // UnbarTask removes a task from the barred list and saves.
 func (s *State) UnbarTask(taskID string) {
 	s.mu.Lock()
@@ -322,6 +764,7 @@ func (s *State) UnbarTask(taskID string) {
 	for i, t := range s.BarredTasks {
 		if t == taskID {
 			s.BarredTasks = append(s.BarredTasks[:i], s.BarredTasks[i+1:]...)
+			delete(s.BarReasons, taskID)
 			s.save()
 			return
 		}
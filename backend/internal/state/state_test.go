@@ -0,0 +1,115 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMigrateStateJSON(t *testing.T) {
+	dir := t.TempDir()
+	legacy := `{
+  "agents": [{"id": 1, "state": "assigned", "task_id": "t-1", "pid": 99}, {"id": 2, "state": "ready"}],
+  "assignment_paused": true,
+  "barred_tasks": ["t-2"],
+  "bar_reasons": {"t-2": "gave up"}
+}`
+	path := filepath.Join(dir, "state.json")
+	if err := os.WriteFile(path, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	st, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st.Agents) != 2 || st.Agents[0].TaskID != "t-1" || !st.AssignmentIsPaused() || st.BarReason("t-2") != "gave up" {
+		t.Errorf("migrated state = %+v", st)
+	}
+	st.Close()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("state.json still there after migrating")
+	}
+	if _, err := os.Stat(path + ".migrated"); err != nil {
+		t.Errorf("state.json.migrated: %v", err)
+	}
+
+	// The next load comes from the database
+	st, err = Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	if len(st.Agents) != 2 || st.Agents[0].PID != 99 || !reflect.DeepEqual(st.BarredTasksSnapshot(), []string{"t-2"}) {
+		t.Errorf("reloaded state = %+v", st)
+	}
+}
+
+func TestMigrateBadStateJSON(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "state.json"), []byte("{not json"), 0644)
+	if _, err := Load(dir); err == nil {
+		t.Error("Load took a state.json that doesn't parse")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "state.json")); err != nil {
+		t.Errorf("unparsable state.json moved aside: %v", err)
+	}
+}
+
+func TestSettersPersist(t *testing.T) {
+	dir := t.TempDir()
+	st, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := st.AddAgent()
+	b := st.AddAgent()
+	st.SetAgentReady(a.ID)
+	st.SetAgentReady(b.ID)
+	st.AssignTask(a.ID, "t-1", "pro")
+	st.SetAgentPID(a.ID, 4242)
+	st.UpdateActivity(a.ID)
+	st.BarTaskAndSave("t-9", "stuck")
+	if err := st.TakeSaveError(); err != nil {
+		t.Fatal(err)
+	}
+	st.Close()
+
+	st, err = Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	agents := st.AgentsSnapshot()
+	if len(agents) != 2 || agents[0].TaskID != "t-1" || agents[0].PID != 4242 || agents[0].LastActivity.IsZero() || agents[1].State != "ready" {
+		t.Errorf("reloaded agents = %+v", agents)
+	}
+	if st.BarReason("t-9") != "stuck" {
+		t.Errorf("bar reason lost")
+	}
+}
+
+func TestSaveErrorReported(t *testing.T) {
+	st, err := Load(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := st.AddAgent()
+	st.Close() // Every write from here on fails
+
+	st.UpdateActivity(a.ID)
+	if err := st.TakeSaveError(); err == nil {
+		t.Error("failed agent write not reported")
+	}
+	st.SetPaused(true)
+	if err := st.TakeSaveError(); err == nil {
+		t.Error("failed snapshot write not reported")
+	}
+	if err := st.TakeSaveError(); err != nil {
+		t.Errorf("error reported twice: %v", err)
+	}
+	if !st.AssignmentIsPaused() {
+		t.Error("in-memory state not changed when the write failed")
+	}
+}
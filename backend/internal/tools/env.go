@@ -0,0 +1,86 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// secretEnv are the credentials in machinator's environment that are for
+// it alone: forge and tracker tokens, and its API token.
+var secretEnv = []string{
+	"GITHUB_TOKEN", "GITLAB_TOKEN", "BITBUCKET_TOKEN",
+	"JIRA_TOKEN", "LINEAR_API_KEY", "MACHINATOR_API_TOKEN",
+}
+
+// hostGitConfig is set for every git machinator runs itself. An agent's
+// sandbox can write the clone's git directory, so hooks and an fsmonitor
+// found there are never run outside it.
+var hostGitConfig = [][2]string{
+	{"core.hooksPath", "/dev/null"},
+	{"core.fsmonitor", "false"},
+}
+
+var (
+	gitConfigMu sync.Mutex
+	gitConfig   [][2]string
+)
+
+// AddGitConfig sets a git config value, e.g. an auth header, for every git
+// run with Command or in Env(Git), and for no other process: unlike
+// GIT_CONFIG_* set in this process's environment, it never reaches agents
+// or hooks.
+func AddGitConfig(key, value string) {
+	gitConfigMu.Lock()
+	defer gitConfigMu.Unlock()
+	gitConfig = append(gitConfig, [2]string{key, value})
+}
+
+// Env returns the environment to run t in: this process's, plus for git
+// hostGitConfig and the config added with AddGitConfig.
+func Env(t Tool) []string {
+	env := os.Environ()
+	if t != Git {
+		return env
+	}
+	gitConfigMu.Lock()
+	defer gitConfigMu.Unlock()
+	config := append(slices.Clip(hostGitConfig), gitConfig...)
+	n, _ := strconv.Atoi(os.Getenv("GIT_CONFIG_COUNT"))
+	for i, kv := range config {
+		env = append(env,
+			fmt.Sprintf("GIT_CONFIG_KEY_%d=%s", n+i, kv[0]),
+			fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", n+i, kv[1]))
+	}
+	return append(env, fmt.Sprintf("GIT_CONFIG_COUNT=%d", n+len(config)))
+}
+
+// Environ returns this process's environment for a program that isn't one
+// of machinator's own tools, such as an agent or a hook: without the
+// tokens in secretEnv or git config passed in GIT_CONFIG_* variables.
+func Environ() []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if isSecretEnv(name) {
+			continue
+		}
+		env = append(env, kv)
+	}
+	return env
+}
+
+func isSecretEnv(name string) bool {
+	if name == "GIT_CONFIG_COUNT" || strings.HasPrefix(name, "GIT_CONFIG_KEY_") || strings.HasPrefix(name, "GIT_CONFIG_VALUE_") {
+		return true
+	}
+	for _, secret := range secretEnv {
+		if name == secret {
+			return true
+		}
+	}
+	return false
+}
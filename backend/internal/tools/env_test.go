@@ -0,0 +1,76 @@
+package tools
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestEnvironDropsSecrets(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "ghs_secret")
+	t.Setenv("GIT_CONFIG_COUNT", "1")
+	t.Setenv("GIT_CONFIG_KEY_0", "http.https://github.com/.extraheader")
+	t.Setenv("GIT_CONFIG_VALUE_0", "AUTHORIZATION: basic c2VjcmV0")
+	t.Setenv("MACHINATOR_TEST_KEPT", "1")
+
+	env := Environ()
+	for _, kv := range env {
+		for _, secret := range []string{"GITHUB_TOKEN=", "GIT_CONFIG_COUNT=", "GIT_CONFIG_KEY_0=", "GIT_CONFIG_VALUE_0="} {
+			if strings.HasPrefix(kv, secret) {
+				t.Errorf("Environ has %s", kv)
+			}
+		}
+	}
+	if !slices.Contains(env, "MACHINATOR_TEST_KEPT=1") {
+		t.Error("Environ dropped MACHINATOR_TEST_KEPT")
+	}
+}
+
+func TestAddGitConfigOnlyReachesGit(t *testing.T) {
+	defer func() { gitConfig = nil }()
+	t.Setenv("GIT_CONFIG_COUNT", "1")
+	AddGitConfig("http.extraheader", "AUTHORIZATION: basic c2VjcmV0")
+
+	env := Command(Git, "status").Env
+	for _, want := range []string{
+		"GIT_CONFIG_KEY_1=core.hooksPath", "GIT_CONFIG_VALUE_1=/dev/null",
+		"GIT_CONFIG_KEY_2=core.fsmonitor", "GIT_CONFIG_VALUE_2=false",
+		"GIT_CONFIG_KEY_3=http.extraheader", "GIT_CONFIG_VALUE_3=AUTHORIZATION: basic c2VjcmV0",
+		"GIT_CONFIG_COUNT=4",
+	} {
+		if !slices.Contains(env, want) {
+			t.Errorf("git's env lacks %s", want)
+		}
+	}
+	// The last GIT_CONFIG_COUNT wins
+	if i, j := slices.Index(env, "GIT_CONFIG_COUNT=1"), slices.Index(env, "GIT_CONFIG_COUNT=4"); i > j {
+		t.Error("GIT_CONFIG_COUNT=4 comes before the inherited count")
+	}
+	for _, kv := range append(Command(Bd, "list").Env, Environ()...) {
+		if kv == "GIT_CONFIG_KEY_3=http.extraheader" || kv == "GIT_CONFIG_KEY_1=core.hooksPath" {
+			t.Errorf("git config reached a non-git environment")
+		}
+	}
+}
+
+func TestGitSkipsRepositoryHooks(t *testing.T) {
+	dir := t.TempDir()
+	run := func(args ...string) {
+		cmd := Command(Git, append([]string{"-C", dir, "-c", "user.name=t", "-c", "user.email=t@t"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	run("init", "-q")
+	// As an agent could leave in the clone's git directory
+	hook := filepath.Join(dir, ".git", "hooks", "pre-commit")
+	if err := os.WriteFile(hook, []byte("#!/bin/sh\ntouch ran\nexit 1\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	run("commit", "-q", "--allow-empty", "-m", "init")
+	if _, err := os.Stat(filepath.Join(dir, "ran")); !os.IsNotExist(err) {
+		t.Error("machinator's git ran the repository's hook")
+	}
+}
@@ -0,0 +1,145 @@
+// Package tools runs the external programs machinator depends on, git and
+// bd, and checks they're new enough for what's asked of them. Call sites
+// run Git and Bd rather than a name on PATH, so tests can swap in a fake.
+package tools
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Tool is an external program machinator runs.
+type Tool interface {
+	// Name is the tool's name in messages, e.g. "git".
+	Name() string
+	// Path is the executable to run; a bare name is looked up on PATH.
+	Path() string
+	// Version is the installed version.
+	Version() (Version, error)
+}
+
+// The tools machinator runs.
+var (
+	Git Tool = New("git")
+	Bd  Tool = New("bd")
+)
+
+// Minimum versions, by what needs them.
+var (
+	MinGit       = Version{2, 17, 0} // git worktree move and remove
+	MinGitSparse = Version{2, 35, 0} // git sparse-checkout set --cone, for clone.sparse
+	MinBd        = Version{0, 9, 0}  // bd --sandbox, which agents claim tasks with
+)
+
+// Binary is a Tool run from an executable. Its version is read from
+// "--version" the first time it's asked for.
+type Binary struct {
+	name, path string
+
+	once    sync.Once
+	version Version
+	err     error
+}
+
+// New returns the tool name found on PATH.
+func New(name string) *Binary {
+	return At(name, name)
+}
+
+// At returns the tool name run from path, e.g. a fake in a test.
+func At(name, path string) *Binary {
+	return &Binary{name: name, path: path}
+}
+
+func (b *Binary) Name() string { return b.name }
+func (b *Binary) Path() string { return b.path }
+
+func (b *Binary) Version() (Version, error) {
+	b.once.Do(func() {
+		out, err := exec.Command(b.path, "--version").CombinedOutput()
+		if err != nil {
+			b.err = fmt.Errorf("%s --version: %w", b.name, err)
+			return
+		}
+		b.version, b.err = ParseVersion(string(out))
+	})
+	return b.version, b.err
+}
+
+// Command returns a command running t with args, in Env(t).
+func Command(t Tool, args ...string) *exec.Cmd {
+	cmd := exec.Command(t.Path(), args...)
+	cmd.Env = Env(t)
+	return cmd
+}
+
+// Installed reports whether t's executable can be found.
+func Installed(t Tool) bool {
+	_, err := exec.LookPath(t.Path())
+	return err == nil
+}
+
+// Require checks that t is installed and at least min, which feature
+// needs. The error says which, e.g. "bd >= 0.9 required for --sandbox
+// (found 0.8.2)".
+func Require(t Tool, min Version, feature string) error {
+	if !Installed(t) {
+		return fmt.Errorf("%s >= %s required for %s (not found in PATH)", t.Name(), min, feature)
+	}
+	v, err := t.Version()
+	if err != nil {
+		return fmt.Errorf("%s >= %s required for %s: %w", t.Name(), min, feature, err)
+	}
+	if !v.AtLeast(min) {
+		return fmt.Errorf("%s >= %s required for %s (found %s)", t.Name(), min, feature, v)
+	}
+	return nil
+}
+
+// Version is a tool's major.minor.patch version.
+type Version struct {
+	Major, Minor, Patch int
+}
+
+// versionPattern finds the version in --version output such as "git
+// version 2.39.3 (Apple Git-146)" or "bd version 0.9.1 (dev)".
+var versionPattern = regexp.MustCompile(`(\d+)\.(\d+)(?:\.(\d+))?`)
+
+// ParseVersion finds the first version number in s.
+func ParseVersion(s string) (Version, error) {
+	m := versionPattern.FindStringSubmatch(s)
+	if m == nil {
+		first, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+		return Version{}, fmt.Errorf("no version in %q", first)
+	}
+	var v Version
+	v.Major, _ = strconv.Atoi(m[1])
+	v.Minor, _ = strconv.Atoi(m[2])
+	if m[3] != "" {
+		v.Patch, _ = strconv.Atoi(m[3])
+	}
+	return v, nil
+}
+
+// AtLeast reports whether v is min or newer.
+func (v Version) AtLeast(min Version) bool {
+	if v.Major != min.Major {
+		return v.Major > min.Major
+	}
+	if v.Minor != min.Minor {
+		return v.Minor > min.Minor
+	}
+	return v.Patch >= min.Patch
+}
+
+// String formats v as major.minor, with .patch unless it's 0.
+func (v Version) String() string {
+	if v.Patch == 0 {
+		return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+	}
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
@@ -0,0 +1,94 @@
+package tools
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		out  string
+		want Version
+	}{
+		{"git version 2.39.3 (Apple Git-146)\n", Version{2, 39, 3}},
+		{"git version 2.45.1.windows.1", Version{2, 45, 1}},
+		{"bd version 0.9.1 (dev)", Version{0, 9, 1}},
+		{"v20.11.0", Version{20, 11, 0}},
+		{"tool 1.2", Version{1, 2, 0}},
+	}
+	for _, tt := range tests {
+		got, err := ParseVersion(tt.out)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseVersion(%q) = %v, %v, want %v", tt.out, got, err, tt.want)
+		}
+	}
+	if _, err := ParseVersion("unknown option --version"); err == nil {
+		t.Error("expected an error for output without a version")
+	}
+}
+
+func TestAtLeast(t *testing.T) {
+	min := Version{2, 17, 0}
+	for v, want := range map[Version]bool{
+		{2, 17, 0}: true,
+		{2, 17, 1}: true,
+		{2, 39, 0}: true,
+		{3, 0, 0}:  true,
+		{2, 16, 9}: false,
+		{1, 99, 0}: false,
+	} {
+		if got := v.AtLeast(min); got != want {
+			t.Errorf("%v.AtLeast(%v) = %v, want %v", v, min, got, want)
+		}
+	}
+}
+
+// fakeTool is a Tool whose version is given, run from the shell so it's
+// always installed.
+type fakeTool struct {
+	version Version
+	err     error
+}
+
+func (f fakeTool) Name() string              { return "bd" }
+func (f fakeTool) Path() string              { return "sh" }
+func (f fakeTool) Version() (Version, error) { return f.version, f.err }
+
+func TestRequire(t *testing.T) {
+	min := Version{0, 9, 0}
+	if err := Require(fakeTool{version: Version{0, 9, 2}}, min, "--sandbox"); err != nil {
+		t.Errorf("0.9.2: %v", err)
+	}
+	err := Require(fakeTool{version: Version{0, 8, 1}}, min, "--sandbox")
+	if err == nil || err.Error() != "bd >= 0.9 required for --sandbox (found 0.8.1)" {
+		t.Errorf("0.8.1: %v", err)
+	}
+	if err := Require(fakeTool{err: errors.New("broken")}, min, "--sandbox"); err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("broken version: %v", err)
+	}
+	if err := Require(At("bd", filepath.Join(t.TempDir(), "bd")), min, "--sandbox"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("missing: %v", err)
+	}
+}
+
+func TestBinaryReadsVersionOnce(t *testing.T) {
+	dir := t.TempDir()
+	count := filepath.Join(dir, "count")
+	path := filepath.Join(dir, "git")
+	script := "#!/bin/sh\necho x >> " + count + "\necho 'git version 2.40.1'\n"
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	b := At("git", path)
+	for i := 0; i < 2; i++ {
+		if v, err := b.Version(); err != nil || v != (Version{2, 40, 1}) {
+			t.Fatalf("Version = %v, %v", v, err)
+		}
+	}
+	if data, _ := os.ReadFile(count); strings.Count(string(data), "x") != 1 {
+		t.Errorf("--version ran %d times, want 1", strings.Count(string(data), "x"))
+	}
+}
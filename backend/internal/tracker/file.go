@@ -0,0 +1,508 @@
+package tracker
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/bryantinsley/machinator/backend/internal/beads"
+	"github.com/bryantinsley/machinator/backend/internal/project"
+)
+
+const defaultTaskFile = "tasks.yaml"
+
+// checklistItem matches a Markdown task list item: indent, mark, title.
+var checklistItem = regexp.MustCompile(`^(\s*)[-*+] \[([ xX])\] (.+?)\s*$`)
+
+// fileStatuses maps the statuses a task file may use to beads statuses.
+var fileStatuses = map[string]string{
+	"":            "open",
+	"open":        "open",
+	"todo":        "open",
+	"in_progress": "in_progress",
+	"doing":       "in_progress",
+	"blocked":     "blocked",
+	"done":        "closed",
+	"closed":      "closed",
+}
+
+// file keeps tasks in the repo, as a YAML task list or a Markdown
+// checklist. Tasks are read from a checkout (the main clone, or an agent's
+// worktree); finishing one checks it off there and pushes the change on the
+// project branch.
+type file struct {
+	path   string // Relative to the checkout
+	branch string
+	dir    string // Checkout bound with In
+}
+
+func newFile(cfg project.TrackerConfig, branch string) *file {
+	path := cfg.Path
+	if path == "" {
+		path = defaultTaskFile
+	}
+	return &file{path: filepath.Clean(path), branch: branch}
+}
+
+func (f *file) Name() string { return filepath.Base(f.path) }
+
+// In returns the tracker reading and writing the task file in dir, pushing
+// changes to branch (the project's if empty).
+func (f *file) In(dir, branch string) Tracker {
+	c := *f
+	c.dir = dir
+	if branch != "" {
+		c.branch = branch
+	}
+	return &c
+}
+
+func (f *file) markdown() bool {
+	ext := strings.ToLower(filepath.Ext(f.path))
+	return ext == ".md" || ext == ".markdown"
+}
+
+func (f *file) read() ([]byte, error) {
+	if f.dir == "" {
+		return nil, fmt.Errorf("%s: no checkout to read tasks from", f.path)
+	}
+	return os.ReadFile(filepath.Join(f.dir, f.path))
+}
+
+// Tasks parses the task file. A missing file has no tasks.
+func (f *file) Tasks() ([]*beads.Task, error) {
+	data, err := f.read()
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if f.markdown() {
+		return parseChecklist(data), nil
+	}
+	tasks, _, _, err := parseTaskList(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", f.path, err)
+	}
+	return tasks, nil
+}
+
+// Start does nothing: machinator's own state records which tasks are being
+// worked on, and the agent's worktree mustn't change under it.
+func (f *file) Start(taskID string) error { return nil }
+
+// Release does nothing; Start changed nothing.
+func (f *file) Release(taskID string) error { return nil }
+
+// Finish checks the task off in the file and pushes the change, with the
+// completion summary as the commit message body.
+func (f *file) Finish(taskID, comment string) error {
+	msg := fmt.Sprintf("Mark %s done", taskID)
+	if comment != "" {
+		msg += "\n\n" + comment
+	}
+	return f.update(msg, func(data []byte) ([]byte, error) {
+		if f.markdown() {
+			return checkOff(data, taskID)
+		}
+		return markDone(data, taskID)
+	})
+}
+
+// Tag adds tag to the task's description in the file and pushes the change.
+func (f *file) Tag(task *beads.Task, tag string) error {
+	if f.dir == "" {
+		return fmt.Errorf("%s: no checkout to tag tasks in", f.path)
+	}
+	if err := beads.Pull(f.dir, f.branch); err != nil {
+		return err
+	}
+	return f.update(fmt.Sprintf("Tag %s %s", task.ID, tag), func(data []byte) ([]byte, error) {
+		if f.markdown() {
+			return tagItem(data, task.ID, tag)
+		}
+		return tagEntry(data, task.ID, tag)
+	})
+}
+
+// update rewrites the task file with change and pushes it, if it changed
+// anything.
+func (f *file) update(message string, change func([]byte) ([]byte, error)) error {
+	data, err := f.read()
+	if err != nil {
+		return err
+	}
+	updated, err := change(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", f.path, err)
+	}
+	if bytes.Equal(updated, data) {
+		return nil // Already done, e.g. an agent checked it off itself
+	}
+	if err := os.WriteFile(filepath.Join(f.dir, f.path), updated, 0644); err != nil {
+		return err
+	}
+	_, err = beads.SyncFile(f.dir, f.branch, f.path, message)
+	return err
+}
+
+// Create appends a task to the file and pushes the change. Markdown
+// checklists can't record dependencies other than by nesting, so tasks with
+// BlockedBy can only be added to YAML files.
+func (f *file) Create(task *beads.Task) (string, error) {
+	if f.dir == "" {
+		return "", fmt.Errorf("%s: no checkout to add tasks to", f.path)
+	}
+	if err := beads.Pull(f.dir, f.branch); err != nil {
+		return "", err
+	}
+	data, err := f.read()
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	var tasks []*beads.Task
+	if f.markdown() {
+		if len(task.BlockedBy) > 0 {
+			return "", fmt.Errorf("%s: a Markdown checklist can't record dependencies; use a YAML task file", f.path)
+		}
+		data = appendChecklistItem(data, task)
+		tasks = parseChecklist(data)
+	} else {
+		if data, err = appendTaskListEntry(data, task); err != nil {
+			return "", fmt.Errorf("%s: %w", f.path, err)
+		}
+		if tasks, _, _, err = parseTaskList(data); err != nil {
+			return "", fmt.Errorf("%s: %w", f.path, err)
+		}
+	}
+	id := tasks[len(tasks)-1].ID
+
+	if err := os.WriteFile(filepath.Join(f.dir, f.path), data, 0644); err != nil {
+		return "", err
+	}
+	if _, err := beads.SyncFile(f.dir, f.branch, f.path, fmt.Sprintf("Add %s: %s", id, task.Title)); err != nil {
+		return id, fmt.Errorf("added %s but couldn't push it: %w", id, err)
+	}
+	return id, nil
+}
+
+// fileTaskIDs gives tasks without an ID of their own one derived from the
+// title, so it stays the same while items around it change.
+type fileTaskIDs map[string]int
+
+func (seen fileTaskIDs) next(id, title string) string {
+	if id == "" {
+		sum := sha1.Sum([]byte(strings.ToLower(strings.TrimSpace(title))))
+		id = "todo-" + hex.EncodeToString(sum[:3])
+	}
+	seen[id]++
+	if n := seen[id]; n > 1 {
+		id = fmt.Sprintf("%s-%d", id, n) // Same title twice
+	}
+	return id
+}
+
+// parseChecklist reads every Markdown task list item as a task. Indented
+// lines under an item are its description, and an item with checklist items
+// nested under it is blocked by them.
+func parseChecklist(data []byte) []*beads.Task {
+	type open struct {
+		indent int
+		task   *beads.Task
+	}
+	var tasks []*beads.Task
+	var stack []open
+	ids := fileTaskIDs{}
+	var last *beads.Task
+	lastIndent := 0
+
+	for _, line := range strings.Split(string(data), "\n") {
+		m := checklistItem.FindStringSubmatch(line)
+		if m == nil {
+			text := strings.TrimSpace(line)
+			indent := len(line) - len(strings.TrimLeft(line, " \t"))
+			if last != nil && text != "" && indent > lastIndent {
+				last.Description = strings.TrimPrefix(last.Description+"\n"+text, "\n")
+			} else if text != "" {
+				last = nil // Prose between items ends the description
+			}
+			continue
+		}
+
+		indent := len(m[1])
+		t := &beads.Task{
+			ID:        ids.next("", m[3]),
+			Title:     m[3],
+			Status:    "open",
+			Priority:  2,
+			IssueType: "task",
+		}
+		if m[2] != " " {
+			t.Status = "closed"
+		}
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) > 0 {
+			parent := stack[len(stack)-1].task
+			parent.BlockedBy = append(parent.BlockedBy, t.ID)
+		}
+		stack = append(stack, open{indent, t})
+		tasks = append(tasks, t)
+		last, lastIndent = t, indent
+	}
+
+	for _, t := range tasks {
+		derive(t)
+	}
+	return tasks
+}
+
+// checkOff marks a Markdown task list item done.
+func checkOff(data []byte, taskID string) ([]byte, error) {
+	lines := strings.Split(string(data), "\n")
+	ids := fileTaskIDs{}
+	for i, line := range lines {
+		m := checklistItem.FindStringSubmatch(line)
+		if m == nil || ids.next("", m[3]) != taskID {
+			continue
+		}
+		lines[i] = strings.Replace(line, "[ ]", "[x]", 1)
+		return []byte(strings.Join(lines, "\n")), nil
+	}
+	return nil, fmt.Errorf("no task %s", taskID)
+}
+
+// appendChecklistItem adds an unchecked item at the end of a Markdown
+// checklist, with its description indented under it.
+func appendChecklistItem(data []byte, task *beads.Task) []byte {
+	var sb strings.Builder
+	sb.Write(data)
+	if len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+		sb.WriteString("\n")
+	}
+	fmt.Fprintf(&sb, "- [ ] %s\n", task.Title)
+	if desc := beads.DescribeComplex(task); desc != "" {
+		for _, line := range strings.Split(desc, "\n") {
+			if strings.TrimSpace(line) != "" {
+				fmt.Fprintf(&sb, "  %s\n", line)
+			}
+		}
+	}
+	return []byte(sb.String())
+}
+
+// tagItem adds tag to a Markdown task list item's description, as a line
+// indented under it.
+func tagItem(data []byte, taskID, tag string) ([]byte, error) {
+	for _, t := range parseChecklist(data) {
+		if t.ID == taskID && strings.Contains(t.Description, tag) {
+			return data, nil
+		}
+	}
+	lines := strings.Split(string(data), "\n")
+	ids := fileTaskIDs{}
+	for i, line := range lines {
+		m := checklistItem.FindStringSubmatch(line)
+		if m == nil || ids.next("", m[3]) != taskID {
+			continue
+		}
+		lines = append(lines[:i+1], append([]string{m[1] + "  " + tag}, lines[i+1:]...)...)
+		return []byte(strings.Join(lines, "\n")), nil
+	}
+	return nil, fmt.Errorf("no task %s", taskID)
+}
+
+// fileTask is an entry of a YAML task list. An entry may also be just a
+// title string.
+type fileTask struct {
+	ID          string   `yaml:"id"`
+	Title       string   `yaml:"title"`
+	Description string   `yaml:"description"`
+	Status      string   `yaml:"status"`
+	Priority    *int     `yaml:"priority"`
+	Complex     bool     `yaml:"complex"`
+	Labels      []string `yaml:"labels"`
+	BlockedBy   []string `yaml:"blocked_by"`
+}
+
+// parseTaskList reads a YAML task list: a sequence of tasks, at the top
+// level or under "tasks". It also returns the parsed document and the
+// sequence node, for markDone.
+func parseTaskList(data []byte) ([]*beads.Task, *yaml.Node, *yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, nil, nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, &doc, nil, nil // Empty file
+	}
+	seq := doc.Content[0]
+	if seq.Kind == yaml.MappingNode {
+		seq = nil
+		for i := 0; i+1 < len(doc.Content[0].Content); i += 2 {
+			if doc.Content[0].Content[i].Value == "tasks" {
+				seq = doc.Content[0].Content[i+1]
+			}
+		}
+	}
+	if seq == nil || seq.Kind != yaml.SequenceNode {
+		return nil, nil, nil, fmt.Errorf("want a list of tasks, at the top or under \"tasks\"")
+	}
+
+	var tasks []*beads.Task
+	ids := fileTaskIDs{}
+	for _, node := range seq.Content {
+		var ft fileTask
+		if node.Kind == yaml.ScalarNode {
+			ft.Title = node.Value
+		} else if err := node.Decode(&ft); err != nil {
+			return nil, nil, nil, err
+		}
+		if ft.Title == "" {
+			return nil, nil, nil, fmt.Errorf("line %d: task has no title", node.Line)
+		}
+
+		t := &beads.Task{
+			ID:          ids.next(ft.ID, ft.Title),
+			Title:       ft.Title,
+			Description: ft.Description,
+			Status:      strings.ToLower(ft.Status),
+			Priority:    2,
+			IssueType:   "task",
+			Labels:      ft.Labels,
+			BlockedBy:   ft.BlockedBy,
+		}
+		if s, ok := fileStatuses[t.Status]; ok {
+			t.Status = s
+		}
+		if ft.Priority != nil {
+			t.Priority = *ft.Priority
+		}
+		derive(t)
+		if ft.Complex {
+			t.IsComplex = true
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, &doc, seq, nil
+}
+
+// markDone sets a YAML task's status to done, keeping the file's comments.
+func markDone(data []byte, taskID string) ([]byte, error) {
+	tasks, doc, seq, err := parseTaskList(data)
+	if err != nil {
+		return nil, err
+	}
+	for i, t := range tasks {
+		if t.ID != taskID {
+			continue
+		}
+		if t.Status == "closed" {
+			return data, nil
+		}
+
+		setMapValue(entryAt(seq, i), "status", "done")
+		return encodeYAML(doc)
+	}
+	return nil, fmt.Errorf("no task %s", taskID)
+}
+
+// tagEntry adds tag to a YAML task's description.
+func tagEntry(data []byte, taskID, tag string) ([]byte, error) {
+	tasks, doc, seq, err := parseTaskList(data)
+	if err != nil {
+		return nil, err
+	}
+	for i, t := range tasks {
+		if t.ID != taskID {
+			continue
+		}
+		if strings.Contains(t.Description, tag) {
+			return data, nil
+		}
+		setMapValue(entryAt(seq, i), "description", beads.WithTag(t.Description, tag))
+		return encodeYAML(doc)
+	}
+	return nil, fmt.Errorf("no task %s", taskID)
+}
+
+// entryAt returns the mapping of a task list entry, turning a bare title
+// into a mapping so it can carry more fields.
+func entryAt(seq *yaml.Node, i int) *yaml.Node {
+	node := seq.Content[i]
+	if node.Kind == yaml.ScalarNode {
+		title := *node
+		*node = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: title.Line}
+		node.Content = []*yaml.Node{{Kind: yaml.ScalarNode, Value: "title"}, &title}
+	}
+	return node
+}
+
+// appendTaskListEntry adds a task at the end of a YAML task list, starting
+// a list if the file is empty.
+func appendTaskListEntry(data []byte, task *beads.Task) ([]byte, error) {
+	entry := &yaml.Node{Kind: yaml.MappingNode}
+	setMapValue(entry, "title", task.Title)
+	if task.Description != "" {
+		setMapValue(entry, "description", task.Description)
+	}
+	if task.IsComplex {
+		entry.Content = append(entry.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: "complex"},
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: "true"})
+	}
+	if len(task.BlockedBy) > 0 {
+		deps := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+		for _, id := range task.BlockedBy {
+			deps.Content = append(deps.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: id})
+		}
+		entry.Content = append(entry.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "blocked_by"}, deps)
+	}
+
+	_, doc, seq, err := parseTaskList(data)
+	if err != nil {
+		return nil, err
+	}
+	if seq == nil {
+		seq = &yaml.Node{Kind: yaml.SequenceNode}
+		doc.Kind = yaml.DocumentNode
+		doc.Content = []*yaml.Node{seq}
+	}
+	seq.Content = append(seq.Content, entry)
+	return encodeYAML(doc)
+}
+
+// encodeYAML writes a document back out in the usual two-space style.
+func encodeYAML(doc *yaml.Node) ([]byte, error) {
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// setMapValue sets key in a mapping node, adding it if missing.
+func setMapValue(node *yaml.Node, key, value string) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			node.Content[i+1].Kind = yaml.ScalarNode
+			node.Content[i+1].Tag = "!!str"
+			node.Content[i+1].Value = value
+			return
+		}
+	}
+	node.Content = append(node.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Value: key},
+		&yaml.Node{Kind: yaml.ScalarNode, Value: value})
+}
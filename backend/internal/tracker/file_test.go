@@ -0,0 +1,156 @@
+package tracker
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bryantinsley/machinator/backend/internal/beads"
+)
+
+func TestParseChecklist(t *testing.T) {
+	md := `# TODO
+
+- [ ] Ship the login page
+  Needs the new auth flow.
+  - [x] Add login
+  - [ ] Style login
+- [X] Old work
+
+Notes that aren't tasks.
+`
+	tasks := parseChecklist([]byte(md))
+	if len(tasks) != 4 {
+		t.Fatalf("got %d tasks, want 4", len(tasks))
+	}
+	ship, add, style, old := tasks[0], tasks[1], tasks[2], tasks[3]
+	if ship.Description != "Needs the new auth flow." {
+		t.Errorf("description = %q", ship.Description)
+	}
+	if strings.Join(ship.BlockedBy, ",") != add.ID+","+style.ID {
+		t.Errorf("parent blocked by %v, want its nested items", ship.BlockedBy)
+	}
+	if add.Status != "closed" || style.Status != "open" || old.Status != "closed" {
+		t.Errorf("statuses = %s %s %s, want closed open closed", add.Status, style.Status, old.Status)
+	}
+	if again := parseChecklist([]byte(md)); again[2].ID != style.ID {
+		t.Error("IDs changed between reads")
+	}
+
+	out, err := checkOff([]byte(md), style.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "  - [x] Style login\n") || !strings.Contains(string(out), "Notes that aren't tasks.") {
+		t.Errorf("checkOff wrote:\n%s", out)
+	}
+	if _, err := checkOff([]byte(md), "todo-nope"); err == nil {
+		t.Error("checkOff accepted an unknown task")
+	}
+}
+
+func TestParseTaskList(t *testing.T) {
+	doc := `# Release work
+tasks:
+  - id: login
+    title: Add login
+    priority: 1
+    complex: true
+  - title: Style login
+    status: doing
+    blocked_by: [login]
+  - Write docs # bare title
+`
+	tasks, _, _, err := parseTaskList([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 3 {
+		t.Fatalf("got %d tasks, want 3", len(tasks))
+	}
+	if l := tasks[0]; l.ID != "login" || l.Priority != 1 || !l.IsComplex {
+		t.Errorf("login = %+v", l)
+	}
+	if s := tasks[1]; s.Status != "in_progress" || len(s.BlockedBy) != 1 || s.BlockedBy[0] != "login" || s.Priority != 2 {
+		t.Errorf("style = %+v", s)
+	}
+	docs := tasks[2]
+	if docs.Title != "Write docs" || docs.Status != "open" || !strings.HasPrefix(docs.ID, "todo-") {
+		t.Errorf("docs = %+v", docs)
+	}
+
+	out, err := markDone([]byte(doc), docs.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "# Release work") {
+		t.Errorf("markDone dropped the comment:\n%s", out)
+	}
+	tasks, _, _, err = parseTaskList(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tasks[2].ID != docs.ID || tasks[2].Status != "closed" || tasks[0].Status != "open" {
+		t.Errorf("after markDone: %+v", tasks[2])
+	}
+
+	if _, _, _, err := parseTaskList([]byte("name: not a task list\n")); err == nil {
+		t.Error("parseTaskList accepted a mapping without tasks")
+	}
+}
+
+func TestAppendTasks(t *testing.T) {
+	task := &beads.Task{Title: "Add logout", Description: "Clear the session.", IsComplex: true}
+
+	md := appendChecklistItem([]byte("- [x] Add login"), task)
+	tasks := parseChecklist(md)
+	if len(tasks) != 2 || tasks[1].Title != "Add logout" || !tasks[1].IsComplex || tasks[1].Status != "open" {
+		t.Errorf("checklist after append:\n%s", md)
+	}
+
+	task.BlockedBy = []string{"login"}
+	for _, doc := range []string{"", "# Work\ntasks:\n  - id: login\n    title: Add login\n"} {
+		out, err := appendTaskListEntry([]byte(doc), task)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tasks, _, _, err := parseTaskList(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		added := tasks[len(tasks)-1]
+		if added.Title != "Add logout" || !added.IsComplex || len(added.BlockedBy) != 1 || added.BlockedBy[0] != "login" {
+			t.Errorf("appended to %q:\n%s", doc, out)
+		}
+		if doc != "" && !strings.Contains(string(out), "# Work") {
+			t.Errorf("append dropped the comment:\n%s", out)
+		}
+	}
+}
+
+func TestTagTasks(t *testing.T) {
+	md := []byte("- [ ] Ship login\n  - [ ] Add login\n")
+	ship := parseChecklist(md)[0]
+	out, err := tagItem(md, ship.ID, beads.ComplexTag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tasks := parseChecklist(out)
+	if len(tasks) != 2 || !tasks[0].IsComplex || tasks[1].IsComplex || len(tasks[0].BlockedBy) != 1 {
+		t.Errorf("checklist after tagging:\n%s", out)
+	}
+	if again, _ := tagItem(out, ship.ID, beads.ComplexTag); string(again) != string(out) {
+		t.Error("tagItem tagged twice")
+	}
+
+	yml := []byte("- Write docs\n- title: Add login\n  description: Needs OAuth.\n")
+	list, _, _, _ := parseTaskList(yml)
+	for _, task := range list {
+		if yml, err = tagEntry(yml, task.ID, beads.ComplexTag); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list, _, _, _ = parseTaskList(yml)
+	if !list[0].IsComplex || !list[1].IsComplex || !strings.HasPrefix(list[1].Description, "Needs OAuth.") {
+		t.Errorf("task list after tagging:\n%s", yml)
+	}
+}
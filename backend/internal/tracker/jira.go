@@ -0,0 +1,331 @@
+package tracker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/beads"
+	"github.com/bryantinsley/machinator/backend/internal/project"
+)
+
+const (
+	jiraPageSize     = 100
+	jiraTimeFormat   = "2006-01-02T15:04:05.000-0700"
+	jiraSearchFields = "summary,description,status,priority,issuetype,labels,assignee,reporter,created,updated,resolutiondate,duedate,issuelinks"
+)
+
+// jiraStatusCategories maps Jira's fixed status categories to beads statuses.
+var jiraStatusCategories = map[string]string{
+	"new":           "open",
+	"indeterminate": "in_progress",
+	"done":          "closed",
+}
+
+// jiraPriorities maps Jira's default priority names to beads priorities.
+var jiraPriorities = map[string]int{
+	"highest": 0,
+	"high":    1,
+	"medium":  2,
+	"low":     3,
+	"lowest":  4,
+}
+
+// jira reads issues with a JQL query over the REST API (v2, which takes
+// plain-text comments) and transitions them as agents work.
+type jira struct {
+	cfg   project.TrackerConfig
+	base  string
+	token string
+	http  *http.Client
+	cache pollCache
+}
+
+func newJira(cfg project.TrackerConfig) (*jira, error) {
+	if cfg.URL == "" || cfg.Query == "" {
+		return nil, fmt.Errorf("jira tracker needs url and query")
+	}
+	return &jira{
+		cfg:   cfg,
+		base:  strings.TrimSuffix(cfg.URL, "/"),
+		token: os.Getenv("JIRA_TOKEN"),
+		http:  &http.Client{Timeout: 30 * time.Second},
+		cache: pollCache{poll: cfg.PollInterval.Duration()},
+	}, nil
+}
+
+func (j *jira) Name() string { return "Jira" }
+
+func (j *jira) refresh() { j.cache.invalidate() }
+
+// Tasks returns the matching issues, fetching at most once per poll interval.
+func (j *jira) Tasks() ([]*beads.Task, error) {
+	return j.cache.get(j.search)
+}
+
+func (j *jira) search() ([]*beads.Task, error) {
+	var tasks []*beads.Task
+	token := ""
+	for {
+		q := url.Values{
+			"jql":        {j.cfg.Query},
+			"fields":     {jiraSearchFields},
+			"maxResults": {fmt.Sprint(jiraPageSize)},
+		}
+		if token != "" {
+			q.Set("nextPageToken", token)
+		}
+		var page struct {
+			Issues        []jiraIssue `json:"issues"`
+			NextPageToken string      `json:"nextPageToken"`
+		}
+		if err := j.do(http.MethodGet, "/rest/api/2/search/jql?"+q.Encode(), nil, &page); err != nil {
+			return nil, err
+		}
+		for _, issue := range page.Issues {
+			tasks = append(tasks, issue.task())
+		}
+		if page.NextPageToken == "" {
+			break
+		}
+		token = page.NextPageToken
+	}
+	return tasks, nil
+}
+
+func (j *jira) Start(taskID string) error {
+	return j.transition(taskID, j.cfg.InProgressStatus, "indeterminate")
+}
+
+func (j *jira) Finish(taskID, comment string) error {
+	if comment != "" {
+		if err := j.do(http.MethodPost, "/rest/api/2/issue/"+url.PathEscape(taskID)+"/comment", map[string]string{"body": comment}, nil); err != nil {
+			return err
+		}
+	}
+	return j.transition(taskID, j.cfg.DoneStatus, "done")
+}
+
+func (j *jira) Release(taskID string) error {
+	return j.transition(taskID, j.cfg.TodoStatus, "new")
+}
+
+// Create adds a Task issue to the configured project, linked as blocked by
+// each of task.BlockedBy. The query must match it for agents to see it.
+func (j *jira) Create(task *beads.Task) (string, error) {
+	if j.cfg.Project == "" {
+		return "", fmt.Errorf("set the tracker's project to create Jira issues")
+	}
+	fields := map[string]any{
+		"project":     map[string]string{"key": j.cfg.Project},
+		"summary":     task.Title,
+		"description": task.Description,
+		"issuetype":   map[string]string{"name": "Task"},
+	}
+	if task.IsComplex {
+		fields["labels"] = []string{"complex"}
+	}
+	var created struct {
+		Key string `json:"key"`
+	}
+	if err := j.do(http.MethodPost, "/rest/api/2/issue", map[string]any{"fields": fields}, &created); err != nil {
+		return "", err
+	}
+	defer j.cache.invalidate()
+
+	for _, blocker := range task.BlockedBy {
+		link := map[string]any{
+			"type":         map[string]string{"name": "Blocks"},
+			"inwardIssue":  map[string]string{"key": blocker},
+			"outwardIssue": map[string]string{"key": created.Key},
+		}
+		if err := j.do(http.MethodPost, "/rest/api/2/issueLink", link, nil); err != nil {
+			return created.Key, fmt.Errorf("created %s but couldn't link it to %s: %w", created.Key, blocker, err)
+		}
+	}
+	return created.Key, nil
+}
+
+// Tag appends tag to the issue's description.
+func (j *jira) Tag(task *beads.Task, tag string) error {
+	fields := map[string]string{"description": beads.WithTag(task.Description, tag)}
+	if err := j.do(http.MethodPut, "/rest/api/2/issue/"+url.PathEscape(task.ID), map[string]any{"fields": fields}, nil); err != nil {
+		return err
+	}
+	j.cache.invalidate()
+	return nil
+}
+
+// transition moves an issue into the named status, or into the first status
+// in category when no name is configured. Already being there is fine.
+func (j *jira) transition(taskID, status, category string) error {
+	path := "/rest/api/2/issue/" + url.PathEscape(taskID) + "/transitions"
+	var resp struct {
+		Transitions []struct {
+			ID string `json:"id"`
+			To struct {
+				Name     string `json:"name"`
+				Category struct {
+					Key string `json:"key"`
+				} `json:"statusCategory"`
+			} `json:"to"`
+		} `json:"transitions"`
+	}
+	if err := j.do(http.MethodGet, path, nil, &resp); err != nil {
+		return err
+	}
+
+	for _, t := range resp.Transitions {
+		if (status != "" && strings.EqualFold(t.To.Name, status)) || (status == "" && t.To.Category.Key == category) {
+			defer j.cache.invalidate()
+			return j.do(http.MethodPost, path, map[string]any{"transition": map[string]string{"id": t.ID}}, nil)
+		}
+	}
+
+	// No transition into the target: fine if the issue is already there
+	if task := j.cache.find(taskID); task != nil && task.Status == jiraStatusCategories[category] {
+		return nil
+	}
+	want := status
+	if want == "" {
+		want = "status category " + category
+	}
+	return fmt.Errorf("%s: no transition to %s", taskID, want)
+}
+
+// do sends in as JSON (if not nil) and decodes the response into out (if not nil).
+func (j *jira) do(method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, j.base+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if j.token != "" {
+		if j.cfg.Email != "" {
+			req.SetBasicAuth(j.cfg.Email, j.token)
+		} else {
+			req.Header.Set("Authorization", "Bearer "+j.token)
+		}
+	}
+
+	resp, err := j.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("jira %s %s: %s: %s", method, strings.SplitN(path, "?", 2)[0], resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// jiraIssue is the part of a Jira issue machinator uses.
+type jiraIssue struct {
+	Key    string `json:"key"`
+	Fields struct {
+		Summary     string `json:"summary"`
+		Description string `json:"description"`
+		Status      struct {
+			Name     string `json:"name"`
+			Category struct {
+				Key string `json:"key"`
+			} `json:"statusCategory"`
+		} `json:"status"`
+		Priority *struct {
+			Name string `json:"name"`
+		} `json:"priority"`
+		IssueType struct {
+			Name string `json:"name"`
+		} `json:"issuetype"`
+		Labels   []string  `json:"labels"`
+		Assignee *jiraUser `json:"assignee"`
+		Reporter *jiraUser `json:"reporter"`
+		Created  string    `json:"created"`
+		Updated  string    `json:"updated"`
+		Resolved string    `json:"resolutiondate"`
+		Due      string    `json:"duedate"`
+		Links    []struct {
+			Type struct {
+				Name string `json:"name"`
+			} `json:"type"`
+			InwardIssue *struct {
+				Key string `json:"key"`
+			} `json:"inwardIssue"`
+		} `json:"issuelinks"`
+	} `json:"fields"`
+}
+
+type jiraUser struct {
+	DisplayName string `json:"displayName"`
+}
+
+// task converts an issue to a beads task.
+func (i jiraIssue) task() *beads.Task {
+	f := i.Fields
+	t := &beads.Task{
+		ID:          i.Key,
+		Title:       f.Summary,
+		Description: f.Description,
+		Status:      jiraStatusCategories[f.Status.Category.Key],
+		Priority:    2,
+		IssueType:   strings.ToLower(f.IssueType.Name),
+		Labels:      f.Labels,
+		CreatedAt:   jiraTime(f.Created),
+		UpdatedAt:   jiraTime(f.Updated),
+	}
+	if t.Status == "" {
+		t.Status = "open"
+	}
+	if f.Priority != nil {
+		if p, ok := jiraPriorities[strings.ToLower(f.Priority.Name)]; ok {
+			t.Priority = p
+		}
+	}
+	if f.Assignee != nil {
+		t.Assignee = f.Assignee.DisplayName
+	}
+	if f.Reporter != nil {
+		t.CreatedBy = f.Reporter.DisplayName
+	}
+	if resolved := jiraTime(f.Resolved); !resolved.IsZero() {
+		t.ClosedAt = &resolved
+	}
+	if due, err := time.Parse("2006-01-02", f.Due); err == nil {
+		t.DueAt = &due
+	}
+	for _, l := range f.Links {
+		// On issue X, a Blocks link with an inward issue Y reads "X is blocked by Y"
+		if l.Type.Name == "Blocks" && l.InwardIssue != nil {
+			t.BlockedBy = append(t.BlockedBy, l.InwardIssue.Key)
+		}
+	}
+	derive(t)
+	return t
+}
+
+// jiraTime parses Jira's timestamp format, returning zero on failure.
+func jiraTime(s string) time.Time {
+	t, _ := time.Parse(jiraTimeFormat, s)
+	return t
+}
@@ -0,0 +1,197 @@
+package tracker
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bryantinsley/machinator/backend/internal/beads"
+	"github.com/bryantinsley/machinator/backend/internal/project"
+)
+
+// fakeJira serves a two-page search and the transition and comment
+// endpoints, recording the transitions and comments it receives.
+type fakeJira struct {
+	transitions []string // "KEY:id"
+	comments    []string
+	searches    int
+	created     []map[string]any // Fields of created issues
+	links       []string         // "blocker>blocked"
+}
+
+func (f *fakeJira) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/rest/api/2/search/jql":
+		f.searches++
+		if r.URL.Query().Get("jql") != "project = ACME" {
+			http.Error(w, "bad jql", http.StatusBadRequest)
+			return
+		}
+		if r.URL.Query().Get("nextPageToken") == "" {
+			w.Write([]byte(`{"nextPageToken": "p2", "issues": [
+				{"key": "ACME-1", "fields": {"summary": "Add login", "status": {"statusCategory": {"key": "new"}},
+					"priority": {"name": "High"}, "labels": ["complex"], "created": "2025-03-01T10:00:00.000+0000"}},
+				{"key": "ACME-2", "fields": {"summary": "Style login", "status": {"statusCategory": {"key": "new"}},
+					"issuelinks": [{"type": {"name": "Blocks"}, "inwardIssue": {"key": "ACME-1"}},
+					               {"type": {"name": "Relates"}, "inwardIssue": {"key": "ACME-9"}}]}}
+			]}`))
+			return
+		}
+		w.Write([]byte(`{"issues": [
+			{"key": "ACME-3", "fields": {"summary": "Old work", "status": {"statusCategory": {"key": "done"}},
+				"resolutiondate": "2025-02-01T10:00:00.000+0000"}}
+		]}`))
+	case strings.HasSuffix(r.URL.Path, "/transitions") && r.Method == http.MethodGet:
+		w.Write([]byte(`{"transitions": [
+			{"id": "11", "to": {"name": "To Do", "statusCategory": {"key": "new"}}},
+			{"id": "21", "to": {"name": "In Progress", "statusCategory": {"key": "indeterminate"}}},
+			{"id": "31", "to": {"name": "Done", "statusCategory": {"key": "done"}}},
+			{"id": "41", "to": {"name": "In Review", "statusCategory": {"key": "indeterminate"}}}
+		]}`))
+	case strings.HasSuffix(r.URL.Path, "/transitions"):
+		var body struct {
+			Transition struct {
+				ID string `json:"id"`
+			} `json:"transition"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		key := strings.Split(r.URL.Path, "/")[5]
+		f.transitions = append(f.transitions, key+":"+body.Transition.ID)
+		w.WriteHeader(http.StatusNoContent)
+	case strings.HasSuffix(r.URL.Path, "/comment"):
+		var body struct {
+			Body string `json:"body"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		f.comments = append(f.comments, body.Body)
+		w.WriteHeader(http.StatusCreated)
+	case r.URL.Path == "/rest/api/2/issue" && r.Method == http.MethodPost:
+		var body struct {
+			Fields map[string]any `json:"fields"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		f.created = append(f.created, body.Fields)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id": "10004", "key": "ACME-4"}`))
+	case r.URL.Path == "/rest/api/2/issueLink":
+		var body struct {
+			Inward  struct{ Key string } `json:"inwardIssue"`
+			Outward struct{ Key string } `json:"outwardIssue"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		f.links = append(f.links, body.Inward.Key+">"+body.Outward.Key)
+		w.WriteHeader(http.StatusCreated)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newTestJira(t *testing.T, cfg project.TrackerConfig) (*jira, *fakeJira) {
+	fake := &fakeJira{}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	cfg.URL = srv.URL
+	cfg.Query = "project = ACME"
+	j, err := newJira(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return j, fake
+}
+
+func TestJiraTasks(t *testing.T) {
+	j, fake := newTestJira(t, project.TrackerConfig{})
+
+	tasks, err := j.Tasks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 3 {
+		t.Fatalf("got %d tasks, want 3 across both pages", len(tasks))
+	}
+
+	login := tasks[0]
+	if login.ID != "ACME-1" || login.Status != "open" || login.Priority != 1 || !login.IsComplex || login.CreatedAt.IsZero() {
+		t.Errorf("ACME-1 = %+v", login)
+	}
+	if style := tasks[1]; len(style.BlockedBy) != 1 || style.BlockedBy[0] != "ACME-1" || style.Priority != 2 {
+		t.Errorf("ACME-2 blocked by %v, priority %d; want [ACME-1], 2", style.BlockedBy, style.Priority)
+	}
+	if old := tasks[2]; old.Status != "closed" || old.ClosedAt == nil {
+		t.Errorf("ACME-3 = %+v, want closed", old)
+	}
+
+	// Served from cache within the poll interval
+	j.Tasks()
+	if fake.searches != 2 {
+		t.Errorf("searched %d pages, want 2 (second Tasks call cached)", fake.searches)
+	}
+}
+
+func TestJiraTransitions(t *testing.T) {
+	j, fake := newTestJira(t, project.TrackerConfig{DoneStatus: "In Review"})
+
+	if err := j.Start("ACME-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Finish("ACME-1", "Completed by Agent 1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Release("ACME-2"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Start picks by category, Finish by the configured name
+	want := []string{"ACME-1:21", "ACME-1:41", "ACME-2:11"}
+	if strings.Join(fake.transitions, ",") != strings.Join(want, ",") {
+		t.Errorf("transitions = %v, want %v", fake.transitions, want)
+	}
+	if len(fake.comments) != 1 || fake.comments[0] != "Completed by Agent 1" {
+		t.Errorf("comments = %v", fake.comments)
+	}
+}
+
+func TestJiraCreate(t *testing.T) {
+	if _, err := (&jira{}).Create(&beads.Task{Title: "x"}); err == nil {
+		t.Error("Create worked without a project")
+	}
+
+	j, fake := newTestJira(t, project.TrackerConfig{Project: "ACME"})
+	id, err := j.Create(&beads.Task{Title: "Add logout", IsComplex: true, BlockedBy: []string{"ACME-1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "ACME-4" {
+		t.Errorf("Create = %s, want ACME-4", id)
+	}
+	if len(fake.created) != 1 || fake.created[0]["summary"] != "Add logout" || fake.created[0]["labels"] == nil {
+		t.Errorf("created %v, want a complex-labeled issue", fake.created)
+	}
+	if strings.Join(fake.links, ",") != "ACME-1>ACME-4" {
+		t.Errorf("links = %v, want ACME-1 blocking ACME-4", fake.links)
+	}
+}
+
+func TestForSharesTrackers(t *testing.T) {
+	if tr, err := For(&project.Config{}); tr != nil || err != nil {
+		t.Errorf("For(beads project) = %v, %v; want nil", tr, err)
+	}
+
+	cfg := &project.Config{Tracker: project.TrackerConfig{Kind: KindJira, URL: "https://acme.atlassian.net", Query: "project = ACME"}}
+	a, err := For(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := For(cfg); a != b {
+		t.Error("For returned a new tracker for the same config")
+	}
+
+	if _, err := For(&project.Config{Tracker: project.TrackerConfig{Kind: KindLinear}}); err == nil {
+		t.Error("For accepted a Linear tracker selecting every issue")
+	}
+	if _, err := For(&project.Config{Tracker: project.TrackerConfig{Kind: "trello"}}); err == nil {
+		t.Error("For accepted an unknown tracker")
+	}
+}
@@ -0,0 +1,413 @@
+package tracker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/beads"
+	"github.com/bryantinsley/machinator/backend/internal/project"
+)
+
+const (
+	linearAPI      = "https://api.linear.app/graphql"
+	linearPageSize = 100
+)
+
+// linearStateTypes maps Linear's fixed workflow state types to beads statuses.
+var linearStateTypes = map[string]string{
+	"triage":    "open",
+	"backlog":   "open",
+	"unstarted": "open",
+	"started":   "in_progress",
+	"completed": "closed",
+	"canceled":  "closed",
+}
+
+// linearPriorities maps Linear priorities (1 urgent … 4 low, 0 none) to
+// beads priorities.
+var linearPriorities = map[int]int{
+	0: 2,
+	1: 0,
+	2: 1,
+	3: 2,
+	4: 3,
+}
+
+const linearIssuesQuery = `query Issues($filter: IssueFilter, $first: Int, $after: String) {
+  issues(filter: $filter, first: $first, after: $after) {
+    nodes {
+      identifier title description priority createdAt updatedAt completedAt canceledAt dueDate
+      state { type }
+      labels { nodes { name } }
+      assignee { name }
+      creator { name }
+      inverseRelations { nodes { type issue { identifier } } }
+    }
+    pageInfo { hasNextPage endCursor }
+  }
+}`
+
+// linear reads issues with a label over the GraphQL API and moves them
+// through the team's workflow as agents work.
+type linear struct {
+	cfg   project.TrackerConfig
+	url   string
+	key   string
+	http  *http.Client
+	cache pollCache
+}
+
+func newLinear(cfg project.TrackerConfig) (*linear, error) {
+	if cfg.Label == "" && cfg.Team == "" {
+		return nil, fmt.Errorf("linear tracker needs a label or team")
+	}
+	url := cfg.URL
+	if url == "" {
+		url = linearAPI
+	}
+	return &linear{
+		cfg:   cfg,
+		url:   url,
+		key:   os.Getenv("LINEAR_API_KEY"),
+		http:  &http.Client{Timeout: 30 * time.Second},
+		cache: pollCache{poll: cfg.PollInterval.Duration()},
+	}, nil
+}
+
+func (l *linear) Name() string { return "Linear" }
+
+func (l *linear) refresh() { l.cache.invalidate() }
+
+// Tasks returns the labeled issues, fetching at most once per poll interval.
+func (l *linear) Tasks() ([]*beads.Task, error) {
+	return l.cache.get(l.search)
+}
+
+func (l *linear) search() ([]*beads.Task, error) {
+	filter := map[string]any{}
+	if l.cfg.Label != "" {
+		filter["labels"] = map[string]any{"name": map[string]string{"eqIgnoreCase": l.cfg.Label}}
+	}
+	if l.cfg.Team != "" {
+		filter["team"] = map[string]any{"key": map[string]string{"eq": l.cfg.Team}}
+	}
+
+	var tasks []*beads.Task
+	var after *string
+	for {
+		var page struct {
+			Issues struct {
+				Nodes    []linearIssue `json:"nodes"`
+				PageInfo struct {
+					HasNextPage bool   `json:"hasNextPage"`
+					EndCursor   string `json:"endCursor"`
+				} `json:"pageInfo"`
+			} `json:"issues"`
+		}
+		if err := l.do(linearIssuesQuery, map[string]any{"filter": filter, "first": linearPageSize, "after": after}, &page); err != nil {
+			return nil, err
+		}
+		for _, issue := range page.Issues.Nodes {
+			tasks = append(tasks, issue.task())
+		}
+		if !page.Issues.PageInfo.HasNextPage {
+			break
+		}
+		cursor := page.Issues.PageInfo.EndCursor
+		after = &cursor
+	}
+	return tasks, nil
+}
+
+func (l *linear) Start(taskID string) error {
+	return l.moveTo(taskID, l.cfg.InProgressStatus, "started")
+}
+
+func (l *linear) Finish(taskID, comment string) error {
+	if comment != "" {
+		issueID, _, err := l.issue(taskID)
+		if err != nil {
+			return err
+		}
+		const mutation = `mutation Comment($input: CommentCreateInput!) { commentCreate(input: $input) { success } }`
+		input := map[string]any{"input": map[string]string{"issueId": issueID, "body": comment}}
+		if err := l.do(mutation, input, nil); err != nil {
+			return err
+		}
+	}
+	return l.moveTo(taskID, l.cfg.DoneStatus, "completed")
+}
+
+func (l *linear) Release(taskID string) error {
+	return l.moveTo(taskID, l.cfg.TodoStatus, "unstarted")
+}
+
+// Create adds an issue to the configured team with the configured label,
+// tagged complex in its description, and relates each of task.BlockedBy
+// as blocking it.
+func (l *linear) Create(task *beads.Task) (string, error) {
+	if l.cfg.Team == "" {
+		return "", fmt.Errorf("set the tracker's team to create Linear issues")
+	}
+	const lookup = `query Target($team: String!, $label: String!) {
+  teams(filter: {key: {eq: $team}}) { nodes { id } }
+  issueLabels(filter: {name: {eqIgnoreCase: $label}}) { nodes { id } }
+}`
+	type ids struct {
+		Nodes []struct {
+			ID string `json:"id"`
+		} `json:"nodes"`
+	}
+	var target struct {
+		Teams  ids `json:"teams"`
+		Labels ids `json:"issueLabels"`
+	}
+	if err := l.do(lookup, map[string]any{"team": l.cfg.Team, "label": l.cfg.Label}, &target); err != nil {
+		return "", err
+	}
+	if len(target.Teams.Nodes) == 0 {
+		return "", fmt.Errorf("linear: no team %s", l.cfg.Team)
+	}
+	input := map[string]any{
+		"teamId":      target.Teams.Nodes[0].ID,
+		"title":       task.Title,
+		"description": beads.DescribeComplex(task),
+	}
+	if l.cfg.Label != "" {
+		if len(target.Labels.Nodes) == 0 {
+			return "", fmt.Errorf("linear: no label %s", l.cfg.Label)
+		}
+		input["labelIds"] = []string{target.Labels.Nodes[0].ID}
+	}
+
+	const create = `mutation Create($input: IssueCreateInput!) { issueCreate(input: $input) { issue { id identifier } } }`
+	var created struct {
+		IssueCreate struct {
+			Issue struct {
+				ID         string `json:"id"`
+				Identifier string `json:"identifier"`
+			} `json:"issue"`
+		} `json:"issueCreate"`
+	}
+	if err := l.do(create, map[string]any{"input": input}, &created); err != nil {
+		return "", err
+	}
+	defer l.cache.invalidate()
+	issue := created.IssueCreate.Issue
+
+	const relate = `mutation Relate($input: IssueRelationCreateInput!) { issueRelationCreate(input: $input) { success } }`
+	for _, blocker := range task.BlockedBy {
+		blockerID, _, err := l.issue(blocker)
+		if err == nil {
+			err = l.do(relate, map[string]any{"input": map[string]string{"issueId": blockerID, "relatedIssueId": issue.ID, "type": "blocks"}}, nil)
+		}
+		if err != nil {
+			return issue.Identifier, fmt.Errorf("created %s but couldn't relate it to %s: %w", issue.Identifier, blocker, err)
+		}
+	}
+	return issue.Identifier, nil
+}
+
+// Tag appends tag to the issue's description.
+func (l *linear) Tag(task *beads.Task, tag string) error {
+	issueID, _, err := l.issue(task.ID)
+	if err != nil {
+		return err
+	}
+	const mutation = `mutation Describe($id: String!, $input: IssueUpdateInput!) { issueUpdate(id: $id, input: $input) { success } }`
+	input := map[string]string{"description": beads.WithTag(task.Description, tag)}
+	if err := l.do(mutation, map[string]any{"id": issueID, "input": input}, nil); err != nil {
+		return err
+	}
+	l.cache.invalidate()
+	return nil
+}
+
+// linearState is a workflow state of a team.
+type linearState struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// issue returns an issue's internal ID and its team's workflow states, the
+// current one first.
+func (l *linear) issue(taskID string) (string, []linearState, error) {
+	const query = `query Issue($id: String!) {
+  issue(id: $id) { id state { id name type } team { states { nodes { id name type } } } }
+}`
+	var resp struct {
+		Issue struct {
+			ID    string      `json:"id"`
+			State linearState `json:"state"`
+			Team  struct {
+				States struct {
+					Nodes []linearState `json:"nodes"`
+				} `json:"states"`
+			} `json:"team"`
+		} `json:"issue"`
+	}
+	if err := l.do(query, map[string]any{"id": taskID}, &resp); err != nil {
+		return "", nil, err
+	}
+	return resp.Issue.ID, append([]linearState{resp.Issue.State}, resp.Issue.Team.States.Nodes...), nil
+}
+
+// moveTo moves an issue into the named state, or into the first state of
+// stateType when no name is configured. Already being there is fine.
+func (l *linear) moveTo(taskID, name, stateType string) error {
+	issueID, states, err := l.issue(taskID)
+	if err != nil {
+		return err
+	}
+	matches := func(s linearState) bool {
+		if name != "" {
+			return strings.EqualFold(s.Name, name)
+		}
+		return s.Type == stateType
+	}
+	if matches(states[0]) {
+		return nil
+	}
+
+	for _, s := range states[1:] {
+		if !matches(s) {
+			continue
+		}
+		const mutation = `mutation Move($id: String!, $input: IssueUpdateInput!) { issueUpdate(id: $id, input: $input) { success } }`
+		defer l.cache.invalidate()
+		return l.do(mutation, map[string]any{"id": issueID, "input": map[string]string{"stateId": s.ID}}, nil)
+	}
+
+	want := name
+	if want == "" {
+		want = "a " + stateType + " state"
+	}
+	return fmt.Errorf("%s: team has no %s", taskID, want)
+}
+
+// do runs a GraphQL request and decodes its data into out (if not nil).
+func (l *linear) do(query string, variables map[string]any, out any) error {
+	data, err := json.Marshal(map[string]any{"query": query, "variables": variables})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, l.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if l.key != "" {
+		req.Header.Set("Authorization", l.key) // Personal API keys go without "Bearer"
+	}
+
+	resp, err := l.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("linear: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var result struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	if len(result.Errors) > 0 {
+		return fmt.Errorf("linear: %s", result.Errors[0].Message)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(result.Data, out)
+}
+
+// linearIssue is the part of a Linear issue machinator uses.
+type linearIssue struct {
+	Identifier  string     `json:"identifier"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Priority    int        `json:"priority"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+	CompletedAt *time.Time `json:"completedAt"`
+	CanceledAt  *time.Time `json:"canceledAt"`
+	DueDate     string     `json:"dueDate"`
+	State       struct {
+		Type string `json:"type"`
+	} `json:"state"`
+	Labels struct {
+		Nodes []struct {
+			Name string `json:"name"`
+		} `json:"nodes"`
+	} `json:"labels"`
+	Assignee *struct {
+		Name string `json:"name"`
+	} `json:"assignee"`
+	Creator *struct {
+		Name string `json:"name"`
+	} `json:"creator"`
+	InverseRelations struct {
+		Nodes []struct {
+			Type  string `json:"type"`
+			Issue struct {
+				Identifier string `json:"identifier"`
+			} `json:"issue"`
+		} `json:"nodes"`
+	} `json:"inverseRelations"`
+}
+
+// task converts an issue to a beads task.
+func (i linearIssue) task() *beads.Task {
+	t := &beads.Task{
+		ID:          i.Identifier,
+		Title:       i.Title,
+		Description: i.Description,
+		Status:      linearStateTypes[i.State.Type],
+		Priority:    linearPriorities[i.Priority],
+		IssueType:   "task",
+		CreatedAt:   i.CreatedAt,
+		UpdatedAt:   i.UpdatedAt,
+	}
+	if t.Status == "" {
+		t.Status = "open"
+	}
+	for _, l := range i.Labels.Nodes {
+		t.Labels = append(t.Labels, l.Name)
+	}
+	if i.Assignee != nil {
+		t.Assignee = i.Assignee.Name
+	}
+	if i.Creator != nil {
+		t.CreatedBy = i.Creator.Name
+	}
+	if i.CompletedAt != nil {
+		t.ClosedAt = i.CompletedAt
+	} else if i.CanceledAt != nil {
+		t.ClosedAt = i.CanceledAt
+	}
+	if due, err := time.Parse("2006-01-02", i.DueDate); err == nil {
+		t.DueAt = &due
+	}
+	for _, r := range i.InverseRelations.Nodes {
+		// An inverse "blocks" relation on X names the issue that blocks X
+		if r.Type == "blocks" {
+			t.BlockedBy = append(t.BlockedBy, r.Issue.Identifier)
+		}
+	}
+	derive(t)
+	return t
+}
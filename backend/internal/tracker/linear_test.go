@@ -0,0 +1,139 @@
+package tracker
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bryantinsley/machinator/backend/internal/project"
+)
+
+// fakeLinear answers the GraphQL operations the tracker sends, serving two
+// pages of issues, and records state changes and comments.
+type fakeLinear struct {
+	auth     string
+	filters  []map[string]any
+	moves    []string // "issueID:stateID"
+	comments []string
+}
+
+func (f *fakeLinear) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.auth = r.Header.Get("Authorization")
+	var req struct {
+		Query     string         `json:"query"`
+		Variables map[string]any `json:"variables"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+
+	switch {
+	case strings.Contains(req.Query, "issues("):
+		f.filters = append(f.filters, req.Variables["filter"].(map[string]any))
+		if req.Variables["after"] == nil {
+			w.Write([]byte(`{"data": {"issues": {"pageInfo": {"hasNextPage": true, "endCursor": "c1"}, "nodes": [
+				{"identifier": "ENG-1", "title": "Add login", "priority": 1, "state": {"type": "unstarted"},
+					"labels": {"nodes": [{"name": "machinator"}, {"name": "complex"}]}, "createdAt": "2025-03-01T10:00:00Z"},
+				{"identifier": "ENG-2", "title": "Style login", "priority": 0, "state": {"type": "backlog"},
+					"inverseRelations": {"nodes": [{"type": "blocks", "issue": {"identifier": "ENG-1"}},
+					                               {"type": "related", "issue": {"identifier": "ENG-9"}}]}}
+			]}}}`))
+			return
+		}
+		w.Write([]byte(`{"data": {"issues": {"pageInfo": {"hasNextPage": false}, "nodes": [
+			{"identifier": "ENG-3", "title": "Old work", "priority": 4, "state": {"type": "canceled"}, "canceledAt": "2025-02-01T10:00:00Z"}
+		]}}}`))
+	case strings.Contains(req.Query, "issue("):
+		current := `{"id": "s-todo", "name": "Todo", "type": "unstarted"}`
+		if req.Variables["id"] == "ENG-2" {
+			current = `{"id": "s-review", "name": "In Review", "type": "started"}`
+		}
+		w.Write([]byte(`{"data": {"issue": {"id": "uuid-` + req.Variables["id"].(string) + `", "state": ` + current + `,
+			"team": {"states": {"nodes": [
+				{"id": "s-todo", "name": "Todo", "type": "unstarted"},
+				{"id": "s-doing", "name": "In Progress", "type": "started"},
+				{"id": "s-review", "name": "In Review", "type": "started"},
+				{"id": "s-done", "name": "Done", "type": "completed"}
+			]}}}}}`))
+	case strings.Contains(req.Query, "issueUpdate"):
+		input := req.Variables["input"].(map[string]any)
+		f.moves = append(f.moves, req.Variables["id"].(string)+":"+input["stateId"].(string))
+		w.Write([]byte(`{"data": {"issueUpdate": {"success": true}}}`))
+	case strings.Contains(req.Query, "commentCreate"):
+		input := req.Variables["input"].(map[string]any)
+		f.comments = append(f.comments, input["issueId"].(string)+": "+input["body"].(string))
+		w.Write([]byte(`{"data": {"commentCreate": {"success": true}}}`))
+	default:
+		w.Write([]byte(`{"errors": [{"message": "unknown operation"}]}`))
+	}
+}
+
+func newTestLinear(t *testing.T, cfg project.TrackerConfig) (*linear, *fakeLinear) {
+	t.Setenv("LINEAR_API_KEY", "lin_key")
+	fake := &fakeLinear{}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	cfg.URL = srv.URL
+	cfg.Label = "machinator"
+	l, err := newLinear(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l, fake
+}
+
+func TestLinearTasks(t *testing.T) {
+	l, fake := newTestLinear(t, project.TrackerConfig{Team: "ENG"})
+
+	tasks, err := l.Tasks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 3 {
+		t.Fatalf("got %d tasks, want 3 across both pages", len(tasks))
+	}
+	if fake.auth != "lin_key" {
+		t.Errorf("Authorization = %q, want the bare API key", fake.auth)
+	}
+	if got, _ := json.Marshal(fake.filters[0]); string(got) != `{"labels":{"name":{"eqIgnoreCase":"machinator"}},"team":{"key":{"eq":"ENG"}}}` {
+		t.Errorf("filter = %s", got)
+	}
+
+	login := tasks[0]
+	if login.ID != "ENG-1" || login.Status != "open" || login.Priority != 0 || !login.IsComplex || login.CreatedAt.IsZero() {
+		t.Errorf("ENG-1 = %+v", login)
+	}
+	if style := tasks[1]; len(style.BlockedBy) != 1 || style.BlockedBy[0] != "ENG-1" || style.Priority != 2 {
+		t.Errorf("ENG-2 blocked by %v, priority %d; want [ENG-1], 2", style.BlockedBy, style.Priority)
+	}
+	if old := tasks[2]; old.Status != "closed" || old.ClosedAt == nil || old.Priority != 3 {
+		t.Errorf("ENG-3 = %+v, want closed P3", old)
+	}
+}
+
+func TestLinearStatusSync(t *testing.T) {
+	l, fake := newTestLinear(t, project.TrackerConfig{DoneStatus: "In Review"})
+
+	if err := l.Start("ENG-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Finish("ENG-1", "Completed by Agent 1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Finish("ENG-2", ""); err != nil {
+		t.Fatal(err) // Already in review: nothing to do
+	}
+
+	// Start picks by state type, Finish by the configured name
+	want := []string{"uuid-ENG-1:s-doing", "uuid-ENG-1:s-review"}
+	if strings.Join(fake.moves, ",") != strings.Join(want, ",") {
+		t.Errorf("moves = %v, want %v", fake.moves, want)
+	}
+	if len(fake.comments) != 1 || fake.comments[0] != "uuid-ENG-1: Completed by Agent 1" {
+		t.Errorf("comments = %v", fake.comments)
+	}
+
+	if err := l.moveTo("ENG-1", "Shipped", ""); err == nil {
+		t.Error("moveTo accepted a state the team doesn't have")
+	}
+}
@@ -0,0 +1,238 @@
+// Package tracker loads a project's tasks, from the repo's beads or from an
+// external issue tracker, and reports progress back to the tracker.
+package tracker
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/beads"
+	"github.com/bryantinsley/machinator/backend/internal/project"
+)
+
+// Tracker kinds.
+const (
+	KindBeads  = ""
+	KindJira   = "jira"
+	KindLinear = "linear"
+	KindFile   = "file"
+)
+
+const defaultPoll = 1 * time.Minute
+
+// Tracker is an external issue tracker. Its issues are returned as beads
+// tasks with beads statuses ("open", "in_progress", "closed") so the
+// assigner and views treat them alike.
+type Tracker interface {
+	// Tasks returns the issues selected by the project's query.
+	Tasks() ([]*beads.Task, error)
+	// Start marks an issue as being worked on.
+	Start(taskID string) error
+	// Finish marks an issue done and leaves comment on it.
+	Finish(taskID, comment string) error
+	// Release puts an issue back to be picked up again after a failed attempt.
+	Release(taskID string) error
+	// Create adds an issue from a task's title, description, complexity
+	// and BlockedBy, returning its ID.
+	Create(task *beads.Task) (string, error)
+	// Tag adds a tag such as CHALLENGE:complex to an issue's description.
+	Tag(task *beads.Task, tag string) error
+	// Name is the tracker's display name, e.g. "Jira".
+	Name() string
+}
+
+var (
+	mu       sync.Mutex
+	trackers = make(map[project.TrackerConfig]Tracker) // Shared so caches are too
+)
+
+// For returns the tracker configured for a project, or nil when its tasks
+// are beads.
+func For(projCfg *project.Config) (Tracker, error) {
+	if projCfg == nil || projCfg.Tracker.Kind == KindBeads {
+		return nil, nil
+	}
+	tc := projCfg.Tracker
+
+	mu.Lock()
+	defer mu.Unlock()
+	if t, ok := trackers[tc]; ok {
+		return t, nil
+	}
+
+	var t Tracker
+	switch tc.Kind {
+	case KindJira:
+		j, err := newJira(tc)
+		if err != nil {
+			return nil, err
+		}
+		t = j
+	case KindFile:
+		t = newFile(tc, projCfg.Branch)
+	case KindLinear:
+		l, err := newLinear(tc)
+		if err != nil {
+			return nil, err
+		}
+		t = l
+	default:
+		return nil, fmt.Errorf("unknown tracker %q (want %q, %q or %q)", tc.Kind, KindJira, KindLinear, KindFile)
+	}
+	trackers[tc] = t
+	return t, nil
+}
+
+// LoadTasks returns a project's tasks: its beads, read from repoDir, or the
+// issues in its tracker.
+func LoadTasks(projCfg *project.Config, repoDir string) ([]*beads.Task, error) {
+	t, err := For(projCfg)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return beads.LoadTasks(repoDir)
+	}
+	return In(t, repoDir).Tasks()
+}
+
+// Create adds a task to a project's beads, pushed from the clone in
+// repoDir, or to its tracker. Returns the new task's ID.
+func Create(projCfg *project.Config, repoDir string, task *beads.Task) (string, error) {
+	t, err := For(projCfg)
+	if err != nil {
+		return "", err
+	}
+	if t == nil {
+		return beads.Create(repoDir, projCfg.Branch, task)
+	}
+	return In(t, repoDir).Create(task)
+}
+
+// Tag adds a tag such as CHALLENGE:complex to a task's description in the
+// project's beads, pushed from the clone in repoDir, or in its tracker.
+func Tag(projCfg *project.Config, repoDir string, task *beads.Task, tag string) error {
+	t, err := For(projCfg)
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		return beads.SetDescription(repoDir, projCfg.Branch, task.ID, beads.WithTag(task.Description, tag))
+	}
+	return In(t, repoDir).Tag(task, tag)
+}
+
+// Close closes a task in the project's beads, pushed from the clone in
+// repoDir, or finishes it in its tracker, with comment as the reason.
+func Close(projCfg *project.Config, repoDir, taskID, comment string) error {
+	t, err := For(projCfg)
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		return beads.Close(repoDir, projCfg.Branch, taskID, comment)
+	}
+	return In(t, repoDir).Finish(taskID, comment)
+}
+
+// refresher is implemented by trackers that cache their issues.
+type refresher interface {
+	refresh()
+}
+
+// Refresh has a project's next LoadTasks see changes made elsewhere, e.g.
+// when a webhook says tasks were added: beads and task files are pulled
+// into the clone in repoDir, and cached issues are dropped.
+func Refresh(projCfg *project.Config, repoDir string) error {
+	t, err := For(projCfg)
+	if err != nil {
+		return err
+	}
+	if r, ok := t.(refresher); ok {
+		r.refresh()
+		return nil
+	}
+	return beads.Pull(repoDir, projCfg.Branch)
+}
+
+// checkout is implemented by trackers whose tasks live in a file in the repo.
+type checkout interface {
+	In(dir, branch string) Tracker
+}
+
+// In returns the tracker reading and writing its tasks in dir, a clone or
+// worktree of the repo, for trackers that keep tasks there. Others are
+// returned as is.
+func In(t Tracker, dir string) Tracker {
+	return InBranch(t, dir, "")
+}
+
+// InBranch is In for a checkout of another branch than the project's, such
+// as a task branch: changes to the task file are pushed there.
+func InBranch(t Tracker, dir, branch string) Tracker {
+	if c, ok := t.(checkout); ok {
+		return c.In(dir, branch)
+	}
+	return t
+}
+
+// derive fills in the fields beads computes from a task's text. A "complex"
+// label also marks it complex, since trackers have labels for that.
+func derive(t *beads.Task) {
+	beads.Derive(t)
+	for _, label := range t.Labels {
+		if strings.EqualFold(label, "complex") {
+			t.IsComplex = true
+		}
+	}
+}
+
+// pollCache reuses fetched tasks for a poll interval (default 1m).
+type pollCache struct {
+	poll time.Duration
+
+	mu      sync.Mutex
+	tasks   []*beads.Task
+	fetched time.Time
+}
+
+// get returns the cached tasks, calling fetch if they are missing or stale.
+func (c *pollCache) get(fetch func() ([]*beads.Task, error)) ([]*beads.Task, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	poll := c.poll
+	if poll <= 0 {
+		poll = defaultPoll
+	}
+	if c.tasks != nil && time.Since(c.fetched) < poll {
+		return c.tasks, nil
+	}
+	tasks, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	c.tasks, c.fetched = tasks, time.Now()
+	return tasks, nil
+}
+
+// invalidate makes the next get fetch again.
+func (c *pollCache) invalidate() {
+	c.mu.Lock()
+	c.tasks = nil
+	c.mu.Unlock()
+}
+
+// find returns a cached task, or nil.
+func (c *pollCache) find(taskID string) *beads.Task {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, t := range c.tasks {
+		if t.ID == taskID {
+			return t
+		}
+	}
+	return nil
+}
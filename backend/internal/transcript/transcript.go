@@ -0,0 +1,298 @@
+// Package transcript keeps the full event stream of every agent run so a
+// task's history can be replayed after the agent's log has been reused.
+// Each task has one JSONL file under MACHINATOR_DIR/transcripts; each line
+// is one gemini stream-json event with when it happened and which run and
+// agent produced it.
+package transcript
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Entry is one recorded agent event.
+type Entry struct {
+	Time  time.Time       `json:"time"`
+	Agent int             `json:"agent"`
+	Run   int64           `json:"run,omitempty"`
+	Event json.RawMessage `json:"event"` // The stream-json line, or a JSON string for plain output
+}
+
+// Dir returns where transcripts are kept.
+func Dir(machinatorDir string) string {
+	return filepath.Join(machinatorDir, "transcripts")
+}
+
+// Path returns the transcript file for a task.
+func Path(machinatorDir, taskID string) string {
+	return filepath.Join(Dir(machinatorDir), taskID+".jsonl")
+}
+
+// Recorder copies new lines from an agent's output log into the task's
+// transcript. Call Poll periodically while the agent runs and Close when
+// it exits.
+type Recorder struct {
+	out     *os.File
+	logPath string
+	offset  int64
+	partial []byte // Incomplete last line, waiting for its newline
+	agentID int
+	runID   int64
+}
+
+// NewRecorder opens a task's transcript for appending.
+func NewRecorder(machinatorDir, taskID, logPath string, agentID int, runID int64) (*Recorder, error) {
+	if err := os.MkdirAll(Dir(machinatorDir), 0755); err != nil {
+		return nil, fmt.Errorf("create transcripts dir: %w", err)
+	}
+	f, err := os.OpenFile(Path(machinatorDir, taskID), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("open transcript: %w", err)
+	}
+	return &Recorder{out: f, logPath: logPath, agentID: agentID, runID: runID}, nil
+}
+
+// Poll records any complete lines written to the log since the last poll.
+func (r *Recorder) Poll() error {
+	f, err := os.Open(r.logPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(r.offset, io.SeekStart); err != nil {
+		return err
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	r.offset += int64(len(data))
+
+	data = append(r.partial, data...)
+	end := bytes.LastIndexByte(data, '\n')
+	if end < 0 {
+		r.partial = data
+		return nil
+	}
+	r.partial = append([]byte(nil), data[end+1:]...)
+	return r.write(data[:end])
+}
+
+// Close records whatever is left in the log, including an unterminated
+// last line, and closes the transcript.
+func (r *Recorder) Close() error {
+	err := r.Poll()
+	if len(r.partial) > 0 && err == nil {
+		err = r.write(r.partial)
+	}
+	if cerr := r.out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (r *Recorder) write(lines []byte) error {
+	now := time.Now()
+	var buf bytes.Buffer
+	for _, line := range bytes.Split(lines, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		e := Entry{Time: now, Agent: r.agentID, Run: r.runID}
+		if json.Valid(line) {
+			e.Event = append(json.RawMessage(nil), line...)
+			if t := eventTime(line); !t.IsZero() {
+				e.Time = t
+			}
+		} else {
+			e.Event, _ = json.Marshal(string(line))
+		}
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	_, err := r.out.Write(buf.Bytes())
+	return err
+}
+
+// Append records an event that didn't come from an agent's log, such as a
+// hook's output, in a task's transcript.
+func Append(machinatorDir, taskID string, agentID int, runID int64, event any) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	e := Entry{Time: time.Now(), Agent: agentID, Run: runID, Event: data}
+	if t := eventTime(data); !t.IsZero() {
+		e.Time = t
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(Dir(machinatorDir), 0755); err != nil {
+		return fmt.Errorf("create transcripts dir: %w", err)
+	}
+	f, err := os.OpenFile(Path(machinatorDir, taskID), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("open transcript: %w", err)
+	}
+	defer f.Close()
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// eventTime returns the event's own timestamp, if it has one.
+func eventTime(event []byte) time.Time {
+	var v struct {
+		Timestamp string `json:"timestamp"`
+	}
+	if json.Unmarshal(event, &v) != nil || v.Timestamp == "" {
+		return time.Time{}
+	}
+	t, _ := time.Parse(time.RFC3339Nano, v.Timestamp)
+	return t
+}
+
+// Load reads a task's transcript. Returns os.ErrNotExist if the task has
+// never run.
+func Load(machinatorDir, taskID string) ([]Entry, error) {
+	f, err := os.Open(Path(machinatorDir, taskID))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		if len(bytes.TrimSpace(sc.Bytes())) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return entries, fmt.Errorf("%s:%d: %w", Path(machinatorDir, taskID), line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, sc.Err()
+}
+
+// PlaybackOffsets returns when each entry should appear during a replay,
+// relative to the start. Real gaps are divided by speed and capped at
+// maxGap so long idle stretches don't stall the replay.
+func PlaybackOffsets(entries []Entry, speed float64, maxGap time.Duration) []time.Duration {
+	if speed <= 0 {
+		speed = 1
+	}
+	offsets := make([]time.Duration, len(entries))
+	var at time.Duration
+	for i := 1; i < len(entries); i++ {
+		gap := time.Duration(float64(entries[i].Time.Sub(entries[i-1].Time)) / speed)
+		if gap < 0 {
+			gap = 0
+		}
+		if gap > maxGap {
+			gap = maxGap
+		}
+		at += gap
+		offsets[i] = at
+	}
+	return offsets
+}
+
+// maxSummary caps the text shown per event.
+const maxSummary = 200
+
+// Summary describes an event in one line, e.g. "tool_use run_shell_command".
+func Summary(e Entry) string {
+	var plain string
+	if json.Unmarshal(e.Event, &plain) == nil {
+		return "output " + clip(plain)
+	}
+
+	var v struct {
+		Type     string          `json:"type"`
+		Role     string          `json:"role"`
+		Hook     string          `json:"hook"`
+		Content  string          `json:"content"`
+		ToolName string          `json:"tool_name"`
+		Params   json.RawMessage `json:"parameters"`
+		Status   string          `json:"status"`
+		Output   string          `json:"output"`
+		Model    string          `json:"model"`
+	}
+	if err := json.Unmarshal(e.Event, &v); err != nil || v.Type == "" {
+		return clip(string(e.Event))
+	}
+
+	parts := []string{v.Type}
+	for _, s := range []string{v.Role, v.Hook, v.ToolName, v.Model, v.Status} {
+		if s != "" {
+			parts = append(parts, s)
+		}
+	}
+	switch {
+	case v.Content != "":
+		parts = append(parts, clip(v.Content))
+	case len(v.Params) > 0:
+		parts = append(parts, clip(string(v.Params)))
+	case v.Output != "":
+		parts = append(parts, clip(v.Output))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Body returns an event's full text (message content, tool parameters or
+// tool output), which Summary cuts to one line. Empty for events without any.
+func Body(e Entry) string {
+	var plain string
+	if json.Unmarshal(e.Event, &plain) == nil {
+		return plain
+	}
+
+	var v struct {
+		Content string          `json:"content"`
+		Params  json.RawMessage `json:"parameters"`
+		Output  string          `json:"output"`
+	}
+	if err := json.Unmarshal(e.Event, &v); err != nil {
+		return string(e.Event)
+	}
+	switch {
+	case v.Content != "":
+		return v.Content
+	case len(v.Params) > 0:
+		var buf bytes.Buffer
+		if json.Indent(&buf, v.Params, "", "  ") != nil {
+			return string(v.Params)
+		}
+		return buf.String()
+	default:
+		return v.Output
+	}
+}
+
+func clip(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) > maxSummary {
+		return s[:maxSummary] + "..."
+	}
+	return s
+}
@@ -0,0 +1,106 @@
+package transcript
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecorderCopiesCompleteLines(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "agent.log")
+
+	r, err := NewRecorder(dir, "t-1", logPath, 2, 7)
+	if err != nil {
+		t.Fatalf("NewRecorder: %v", err)
+	}
+	os.WriteFile(logPath, []byte(`{"type":"init","timestamp":"2026-01-02T03:04:05Z","model":"flash"}`+"\n"+`{"type":"mess`), 0644)
+	if err := r.Poll(); err != nil {
+		t.Fatalf("Poll: %v", err)
+	}
+
+	f, _ := os.OpenFile(logPath, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString(`age","role":"assistant","content":"hi"}` + "\nplain text")
+	f.Close()
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	entries, err := Load(dir, "t-1")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	want := []string{"init flash", "message assistant hi", "output plain text"}
+	if len(entries) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(entries), len(want))
+	}
+	for i, e := range entries {
+		if got := Summary(e); got != want[i] {
+			t.Errorf("entry %d: Summary = %q, want %q", i, got, want[i])
+		}
+		if e.Agent != 2 || e.Run != 7 {
+			t.Errorf("entry %d: agent %d run %d", i, e.Agent, e.Run)
+		}
+	}
+	if !entries[0].Time.Equal(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("event timestamp not used: %v", entries[0].Time)
+	}
+}
+
+func TestAppendRecordsHookEvents(t *testing.T) {
+	dir := t.TempDir()
+	event := map[string]any{"type": "hook", "hook": "pre_task", "status": "error", "output": "npm ERR! missing script"}
+	if err := Append(dir, "t-1", 3, 9, event); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+
+	entries, err := Load(dir, "t-1")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Agent != 3 || entries[0].Run != 9 {
+		t.Fatalf("got %+v", entries)
+	}
+	if got, want := Summary(entries[0]), "hook pre_task error npm ERR! missing script"; got != want {
+		t.Errorf("Summary = %q, want %q", got, want)
+	}
+}
+
+func TestPlaybackOffsetsCapGaps(t *testing.T) {
+	start := time.Now()
+	entries := []Entry{
+		{Time: start},
+		{Time: start.Add(2 * time.Second)},
+		{Time: start.Add(time.Hour)},
+	}
+	got := PlaybackOffsets(entries, 2, 5*time.Second)
+	want := []time.Duration{0, time.Second, 6 * time.Second}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("offset %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestBodyKeepsFullText(t *testing.T) {
+	output := strings.Repeat("line\n", 1000)
+	raw, _ := json.Marshal(map[string]string{"type": "tool_result", "status": "success", "output": output})
+	e := Entry{Event: raw}
+	if got := Body(e); got != output {
+		t.Errorf("Body = %d bytes, want %d", len(got), len(output))
+	}
+	if got := Summary(e); len(got) > maxSummary+50 || strings.Contains(got, "\n") {
+		t.Errorf("Summary not clipped to one line: %q", got)
+	}
+
+	params := Entry{Event: json.RawMessage(`{"type":"tool_use","tool_name":"read_file","parameters":{"path":"a.go"}}`)}
+	if got, want := Body(params), "{\n  \"path\": \"a.go\"\n}"; got != want {
+		t.Errorf("Body(params) = %q, want %q", got, want)
+	}
+	if got := Body(Entry{Event: json.RawMessage(`"plain output"`)}); got != "plain output" {
+		t.Errorf("Body(plain) = %q", got)
+	}
+}
@@ -0,0 +1,84 @@
+package tui
+
+import (
+	"strings"
+
+	"github.com/rivo/tview"
+)
+
+// JSON token colors.
+const (
+	jsonKeyColor     = "[#66CCFF]"
+	jsonStringColor  = "[#99CC66]"
+	jsonNumberColor  = "[#FFCC66]"
+	jsonLiteralColor = "[#CC99FF]" // true, false, null
+)
+
+// colorizeJSONLine adds color tags to one line of (usually indented) JSON.
+// Lines are colored on their own, so callers only pay for the lines they
+// show. Every piece of the input is escaped, so brackets inside strings
+// can't be read as tags, and anything that isn't JSON passes through as
+// plain text.
+func colorizeJSONLine(line string) string {
+	var sb strings.Builder
+	plain := 0 // Start of the pending uncolored run
+	flush := func(end int) {
+		sb.WriteString(tview.Escape(line[plain:end]))
+	}
+	colored := func(color string, start, end int) {
+		flush(start)
+		sb.WriteString(color + tview.Escape(line[start:end]) + "[-]")
+		plain = end
+	}
+
+	for i := 0; i < len(line); {
+		c := line[i]
+		switch {
+		case c == '"':
+			end := stringEnd(line, i)
+			color := jsonStringColor
+			if isKey(line, end) {
+				color = jsonKeyColor
+			}
+			colored(color, i, end)
+			i = end
+		case c == '-' || (c >= '0' && c <= '9'):
+			end := i + 1
+			for end < len(line) && strings.IndexByte("0123456789.eE+-", line[end]) >= 0 {
+				end++
+			}
+			colored(jsonNumberColor, i, end)
+			i = end
+		case strings.HasPrefix(line[i:], "true"), strings.HasPrefix(line[i:], "null"):
+			colored(jsonLiteralColor, i, i+4)
+			i += 4
+		case strings.HasPrefix(line[i:], "false"):
+			colored(jsonLiteralColor, i, i+5)
+			i += 5
+		default:
+			i++
+		}
+	}
+	flush(len(line))
+	return sb.String()
+}
+
+// stringEnd returns the index just past the string starting at line[start],
+// skipping escaped quotes. An unterminated string runs to the end of line.
+func stringEnd(line string, start int) int {
+	for i := start + 1; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return len(line)
+}
+
+// isKey reports whether the string ending at end is an object key.
+func isKey(line string, end int) bool {
+	rest := strings.TrimLeft(line[end:], " \t")
+	return strings.HasPrefix(rest, ":")
+}
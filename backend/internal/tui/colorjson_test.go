@@ -0,0 +1,49 @@
+package tui
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/rivo/tview"
+)
+
+var jsonColorTag = regexp.MustCompile(`\[(#[0-9A-F]{6}|-)\]`)
+
+// plainText undoes colorizeJSONLine: drops its tags and unescapes the rest.
+func plainText(s string) string {
+	return tview.Unescape(jsonColorTag.ReplaceAllString(s, ""))
+}
+
+func TestColorizeJSONLineRoundTrips(t *testing.T) {
+	lines := []string{
+		`{"a": {"b": [1, -2.5e3, true, null, false]}}`,
+		`  "path": "dir/[red]file[-].go",`,
+		`  "cmd": "echo \"[x]\" \\",`,
+		`  "nested": {"k": "v"}, "list": [ ]`,
+		`  "unterminated: [yellow]`,
+		`plain text, not JSON [bold]`,
+		``,
+	}
+	for _, line := range lines {
+		if got := plainText(colorizeJSONLine(line)); got != line {
+			t.Errorf("round trip of %q = %q", line, got)
+		}
+	}
+}
+
+func TestColorizeJSONLineTokens(t *testing.T) {
+	got := colorizeJSONLine(`  "msg": "say \"hi\": ok", "n": 42,`)
+	want := `  ` + jsonKeyColor + `"msg"[-]: ` + jsonStringColor + `"say \"hi\": ok"[-], ` +
+		jsonKeyColor + `"n"[-]: ` + jsonNumberColor + `42[-],`
+	if got != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
+
+func TestColorizeJSONLineEscapesTagsInStrings(t *testing.T) {
+	got := colorizeJSONLine(`"[red]"`)
+	if strings.Contains(got, `"[red]"`) {
+		t.Errorf("tag inside string not escaped: %q", got)
+	}
+}
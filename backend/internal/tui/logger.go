@@ -6,6 +6,8 @@ import (
 	"path/filepath"
 	"sync"
 	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/config"
 )
 
 // Logger is the interface for logging from watchers.
@@ -13,23 +15,33 @@ type Logger interface {
 	Log(source, message string)
 }
 
+// archiveTimeFormat names the generations kept by the archive overflow
+// policy.
+const archiveTimeFormat = "20060102-150405.000000000"
+
 // FileLogger writes to log files and optionally prints to console.
 type FileLogger struct {
-	logsDir string
-	console bool
-	files   map[string]*os.File
-	mu      sync.Mutex
+	logsDir  string
+	console  bool
+	maxBytes int64 // Size a log is rotated to <source>.log.1 at
+	archive  bool  // Keep the generation rotation pushes out of .1
+	files    map[string]*os.File
+	sizes    map[string]int64
+	mu       sync.Mutex
 }
 
-// NewFileLogger creates a file logger.
-func NewFileLogger(logsDir string, console bool) (*FileLogger, error) {
+// NewFileLogger creates a file logger rotating logs as cfg says.
+func NewFileLogger(logsDir string, console bool, cfg config.LogsConfig) (*FileLogger, error) {
 	if err := os.MkdirAll(logsDir, 0755); err != nil {
 		return nil, fmt.Errorf("create logs dir: %w", err)
 	}
 	return &FileLogger{
-		logsDir: logsDir,
-		console: console,
-		files:   make(map[string]*os.File),
+		logsDir:  logsDir,
+		console:  console,
+		maxBytes: int64(cfg.MaxFileMB) << 20,
+		archive:  cfg.Overflow == config.LogOverflowArchive,
+		files:    make(map[string]*os.File),
+		sizes:    make(map[string]int64),
 	}, nil
 }
 
@@ -42,18 +54,10 @@ func (l *FileLogger) Log(source, message string) {
 	clean := stripColorTags(message)
 	line := fmt.Sprintf("%s [%s] %s\n", timestamp, source, clean)
 
-	// Get or create file for this source
-	file, err := l.getFile(source)
-	if err == nil {
-		file.WriteString(line)
-	}
-
-	// Also write to main log
+	// Write to this source's file and to the main log
+	l.write(source, line)
 	if source != "main" {
-		mainFile, err := l.getFile("main")
-		if err == nil {
-			mainFile.WriteString(line)
-		}
+		l.write("main", line)
 	}
 
 	// Console output if enabled
@@ -62,21 +66,51 @@ func (l *FileLogger) Log(source, message string) {
 	}
 }
 
+// write appends a line to a source's log, rotating it when it gets too big.
+func (l *FileLogger) write(source, line string) {
+	file, err := l.getFile(source)
+	if err != nil {
+		return
+	}
+	n, _ := file.WriteString(line)
+	l.sizes[source] += int64(n)
+
+	if l.sizes[source] > l.maxBytes {
+		path := LogFilePath(l.logsDir, source)
+		file.Close()
+		delete(l.files, source)
+		if l.archive {
+			os.Rename(path+".1", path+"."+time.Now().Format(archiveTimeFormat))
+		}
+		os.Rename(path, path+".1")
+	}
+}
+
 func (l *FileLogger) getFile(source string) (*os.File, error) {
 	if f, ok := l.files[source]; ok {
 		return f, nil
 	}
 
-	filename := source + ".log"
-	path := filepath.Join(l.logsDir, filename)
+	path := LogFilePath(l.logsDir, source)
 	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
 	if err != nil {
 		return nil, err
 	}
+	l.sizes[source] = 0
+	if info, err := f.Stat(); err == nil {
+		l.sizes[source] = info.Size()
+	}
 	l.files[source] = f
 	return f, nil
 }
 
+// LogFilePath returns the log file for a source. Its previous generation,
+// if any, is the same path with ".1" appended, and archived ones have the
+// time they were pushed out of ".1" appended instead.
+func LogFilePath(logsDir, source string) string {
+	return filepath.Join(logsDir, source+".log")
+}
+
 // Close closes all open log files.
 func (l *FileLogger) Close() {
 	l.mu.Lock()
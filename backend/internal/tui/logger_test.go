@@ -0,0 +1,55 @@
+package tui
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bryantinsley/machinator/backend/internal/config"
+)
+
+func TestArchivedLogsStayReadable(t *testing.T) {
+	dir := t.TempDir()
+	logger, err := NewFileLogger(dir, false, config.LogsConfig{MaxFileMB: 1, Overflow: config.LogOverflowArchive})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+	logger.maxBytes = 1 << 10 // A few dozen lines per generation
+
+	const n = 500
+	for i := 0; i < n; i++ {
+		logger.Log("main", fmt.Sprintf("line %d", i))
+	}
+
+	archived, _ := filepath.Glob(LogFilePath(dir, "main") + ".????????-??????.?????????")
+	if len(archived) == 0 {
+		t.Fatal("no archived generation")
+	}
+	lines, more := tailLog(dir, "main", n+1)
+	if more || len(lines) != n {
+		t.Fatalf("got %d lines (more %v), want all %d", len(lines), more, n)
+	}
+	if !strings.HasSuffix(lines[0], "line 0") || !strings.HasSuffix(lines[n-1], fmt.Sprintf("line %d", n-1)) {
+		t.Errorf("lines out of order: first %q, last %q", lines[0], lines[n-1])
+	}
+}
+
+func TestDroppedLogsKeepTwoGenerations(t *testing.T) {
+	dir := t.TempDir()
+	logger, err := NewFileLogger(dir, false, config.LogsConfig{MaxFileMB: 1, Overflow: config.LogOverflowDrop})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+	logger.maxBytes = 1 << 10
+
+	for i := 0; i < 500; i++ {
+		logger.Log("main", fmt.Sprintf("line %d", i))
+	}
+
+	if generations := logGenerations(dir, "main"); len(generations) != 2 {
+		t.Errorf("got generations %v, want the log and .1", generations)
+	}
+}
@@ -0,0 +1,90 @@
+package tui
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// tailChunk is how much is read per step when scanning a log backwards.
+const tailChunk = 64 << 10
+
+// readTail returns up to the last n lines of a file, and whether the file
+// has earlier lines. A missing file has no lines.
+func readTail(path string, n int) ([]string, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, false
+	}
+
+	// Read backwards until we have n complete lines or reach the start
+	var buf []byte
+	pos := info.Size()
+	for pos > 0 && bytes.Count(buf, []byte("\n")) <= n {
+		step := int64(tailChunk)
+		if step > pos {
+			step = pos
+		}
+		pos -= step
+		chunk := make([]byte, step)
+		if _, err := f.ReadAt(chunk, pos); err != nil && err != io.EOF {
+			return nil, false
+		}
+		buf = append(chunk, buf...)
+	}
+
+	lines := bytes.Split(bytes.TrimRight(buf, "\n"), []byte("\n"))
+	if pos > 0 {
+		lines = lines[1:] // First line may be partial
+	}
+	more := pos > 0
+	if len(lines) > n {
+		lines, more = lines[len(lines)-n:], true
+	}
+
+	out := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if len(line) > 0 {
+			out = append(out, string(line))
+		}
+	}
+	return out, more
+}
+
+// tailLog returns up to the last n lines logged by a source, reaching back
+// through its earlier generations when the current file is short.
+func tailLog(logsDir, source string, n int) ([]string, bool) {
+	var lines []string
+	generations := logGenerations(logsDir, source)
+	for i, path := range generations {
+		older, more := readTail(path, n-len(lines))
+		lines = append(older, lines...)
+		if more || len(lines) >= n {
+			return lines, more || i < len(generations)-1
+		}
+	}
+	return lines, false
+}
+
+// logGenerations returns a source's log files that exist, newest first: the
+// current one, the previous generation and any archived ones.
+func logGenerations(logsDir, source string) []string {
+	path := LogFilePath(logsDir, source)
+	var files []string
+	for _, f := range []string{path, path + ".1"} {
+		if _, err := os.Stat(f); err == nil {
+			files = append(files, f)
+		}
+	}
+	archived, _ := filepath.Glob(path + ".????????-??????.?????????")
+	slices.Sort(archived)
+	slices.Reverse(archived)
+	return append(files, archived...)
+}
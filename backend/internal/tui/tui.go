@@ -11,49 +11,97 @@ import (
 
 	"github.com/bryantinsley/machinator/backend/internal/beads"
 	"github.com/bryantinsley/machinator/backend/internal/config"
+	"github.com/bryantinsley/machinator/backend/internal/events"
+	"github.com/bryantinsley/machinator/backend/internal/history"
 	"github.com/bryantinsley/machinator/backend/internal/project"
 	"github.com/bryantinsley/machinator/backend/internal/quota"
+	"github.com/bryantinsley/machinator/backend/internal/rundb"
+	"github.com/bryantinsley/machinator/backend/internal/setup"
 	"github.com/bryantinsley/machinator/backend/internal/state"
+	"github.com/bryantinsley/machinator/backend/internal/tracker"
+	"github.com/bryantinsley/machinator/backend/internal/transcript"
 )
 
-const maxLogLines = 500
-
-// LogEntry represents a log line with context.
-type LogEntry struct {
-	Time    time.Time
-	Source  string // "assign", "agent-1", "quota", etc.
-	Message string
-}
-
 // TUI is the terminal user interface.
 type TUI struct {
 	app          *tview.Application
+	root         *tview.Flex
 	leftPane     *tview.TextView
 	rightFlex    *tview.Flex
 	rightHeader  *tview.TextView
 	rightContent *tview.TextView
 	helpBar      *tview.TextView
+	searchInput  *tview.InputField
 
 	state   *state.State
 	quota   *quota.Quota
 	repoDir string
 	paused  bool // Orchestrator paused state
 
-	logs          []LogEntry
-	logMu         sync.Mutex
-	logFilter     string // "assign", "beads", "beads:task-id", "git", "git:hash", "config"
+	logFilter     string // "assign", "beads", "beads:task-id", "git", "git:hash", "config", "graph", "agent:N"
 	selectedIdx   int    // Current selection index in list views
 	beadsListType int    // 0=ready, 1=blocked, 2=assigned, 3=closed
 	confirmQuit   bool
+	confirmStop   string // Stop request awaiting y/n in the agent view
+	pickKill      bool   // Waiting for the number of the agent to kill
+	pickAssign    string // Task waiting for the number of the agent to run it
 
-	// Cached beads (refresh every 15s)
+	// Short-lived message in the help bar, e.g. the result of a request
+	notice      string
+	noticeUntil time.Time
+
+	// Cached beads (refresh every 15s, or as soon as .beads changes)
 	cachedTasks     []*beads.Task
 	cachedTasksTime time.Time
+	beadsChanged    chan struct{}
+
+	// Quota forecasts for the simple and complex models (refresh every 30s)
+	cachedForecasts     []rundb.Forecast
+	cachedForecastsTime time.Time
 
 	// Cached git log (refresh every 30s) - stores raw data for responsive formatting
 	cachedGitLog     []CommitInfo
 	cachedGitLogTime time.Time
 
+	// Project disk usage (measured every 60s, in the background since it
+	// walks the whole clone)
+	cachedUsage     *setup.ProjectUsage
+	cachedUsageTime time.Time
+	measuringUsage  bool
+
+	// Log views read from the log files; logWindow lines are shown and grows
+	// by logs.page_lines as older pages are requested
+	logWindow    int
+	logWindowFor string // Filter logWindow applies to
+	logHasMore   bool   // Older lines exist on disk
+	logPaged     bool   // A page was requested; keep the viewport in place
+
+	// Transcript replay ("replay:task-id"); replayTask is what's loaded
+	replayTask    string
+	replayEntries []transcript.Entry
+	replayOffsets []time.Duration
+	replayStart   time.Time
+	replayOpen    map[int]bool // Events whose folded output is expanded
+	replayExport  int          // Event to export on the next refresh, or -1
+	replayNote    string       // Result of the last export
+	replaySel     int          // Selected event, as an index into replayEntries
+	replayMove    int          // Cursor steps requested since the last refresh
+	replayAgent   int          // Only show this agent's events; 0 shows all
+
+	// Pinned events ("pins"), as of the last refresh
+	pins []rundb.Pin
+
+	// History search ("/"); searchFor is the query searchResults are for
+	searching     bool // Search prompt has focus
+	searchQuery   string
+	searchFor     string
+	searchResults []history.Record
+
+	formOpen bool // A form (new task, models) has the screen
+
+	// Latest orchestrator events, newest last, from HandleEvent
+	recentEvents []events.Event
+
 	// Config for displaying settings
 	cfg               *config.Config
 	projCfg           *project.Config
@@ -80,6 +128,7 @@ func New(st *state.State, q *quota.Quota, repoDir string, cfg *config.Config, pr
 		cfg:               cfg,
 		projCfg:           projCfg,
 		projectConfigPath: projectConfigPath,
+		beadsChanged:      make(chan struct{}, 1),
 	}
 
 	// Don't block on beads - refresh loop will load them
@@ -90,7 +139,7 @@ func New(st *state.State, q *quota.Quota, repoDir string, cfg *config.Config, pr
 	t.leftPane = tview.NewTextView().
 		SetDynamicColors(true).
 		SetScrollable(false)
-	t.leftPane.SetBorder(true).SetTitle(" Status ")
+	t.leftPane.SetBorder(true).SetTitle(" Status " + profileTitle())
 	t.leftPane.SetText("[gray]Loading...[-]")
 
 	// Right pane: split into fixed header and scrollable content
@@ -113,7 +162,13 @@ func New(st *state.State, q *quota.Quota, repoDir string, cfg *config.Config, pr
 	t.helpBar = tview.NewTextView().
 		SetDynamicColors(true).
 		SetTextAlign(tview.AlignCenter)
-	t.helpBar.SetText("(A)ssign (B)eads (G)it (C)onfig  (+)Add (S)tart (Q)uit")
+	t.helpBar.SetText("(A)ssign (B)eads (G)it (C)onfig (/)Search (*)Pins  (+)Add (K)ill (S)tart (Q)uit")
+
+	// Search prompt, shown in place of the help bar
+	t.searchInput = tview.NewInputField().
+		SetLabel("/").
+		SetPlaceholder("text, agent:N, type:tool_use, tool:NAME, source:NAME, task:ID")
+	t.searchInput.SetDoneFunc(t.closeSearchInput)
 
 	// Layout
 	mainFlex := tview.NewFlex().
@@ -123,6 +178,7 @@ func New(st *state.State, q *quota.Quota, repoDir string, cfg *config.Config, pr
 	root := tview.NewFlex().SetDirection(tview.FlexRow).
 		AddItem(mainFlex, 0, 1, true).
 		AddItem(t.helpBar, 1, 0, false)
+	t.root = root
 
 	// Set dark blue-green tinted background on all elements
 	bgColor := tcell.NewRGBColor(22, 26, 28) // #161a1c - very dark with blue-green tint
@@ -131,6 +187,8 @@ func New(st *state.State, q *quota.Quota, repoDir string, cfg *config.Config, pr
 	t.rightContent.SetBackgroundColor(bgColor)
 	t.rightFlex.SetBackgroundColor(bgColor)
 	t.helpBar.SetBackgroundColor(bgColor)
+	t.searchInput.SetBackgroundColor(bgColor)
+	t.searchInput.SetFieldBackgroundColor(bgColor)
 	mainFlex.SetBackgroundColor(bgColor)
 	root.SetBackgroundColor(bgColor)
 
@@ -144,36 +202,51 @@ func New(st *state.State, q *quota.Quota, repoDir string, cfg *config.Config, pr
 func (t *TUI) Run() error {
 	// Start refresh goroutine - it will populate content immediately
 	go t.refreshLoop()
+	if w := t.watchBeads(); w != nil {
+		defer w.Close()
+	}
 	return t.app.Run()
 }
 
+// watchBeads has the beads list reloaded as soon as the clone's .beads
+// files change, e.g. after a bd create, rather than at the next 15s
+// refresh. The assigner is woken to look at them too. Returns nil for
+// other trackers, or if the directory can't be watched.
+func (t *TUI) watchBeads() *beads.Watcher {
+	if t.projCfg == nil || t.projCfg.Tracker.Kind != tracker.KindBeads {
+		return nil
+	}
+	w, err := beads.Watch(t.repoDir, func() {
+		t.mu.Lock()
+		t.cachedTasksTime = time.Time{}
+		t.mu.Unlock()
+		select {
+		case t.beadsChanged <- struct{}{}:
+		default:
+		}
+		t.state.Wake()
+	})
+	if err != nil {
+		return nil // The timed refresh still picks changes up
+	}
+	return w
+}
+
 // Stop stops the TUI.
 func (t *TUI) Stop() {
 	t.app.Stop()
 }
 
-// Log adds a log entry.
-func (t *TUI) Log(source, message string) {
-	t.logMu.Lock()
-	defer t.logMu.Unlock()
-
-	t.logs = append(t.logs, LogEntry{
-		Time:    time.Now(),
-		Source:  source,
-		Message: message,
-	})
-
-	// Trim if too long
-	if len(t.logs) > maxLogLines {
-		t.logs = t.logs[len(t.logs)-maxLogLines:]
-	}
-}
-
 func (t *TUI) handleInput(event *tcell.EventKey) *tcell.EventKey {
 	// CRITICAL: This runs on the main tview goroutine.
 	// Do NOT call any function that acquires a lock or does I/O.
 	// Do NOT use QueueUpdate - we're already on the main goroutine.
 
+	// The search prompt and forms get every key until closed
+	if t.searching || t.formOpen {
+		return event
+	}
+
 	// If in confirm mode, handle y/n
 	if t.confirmQuit {
 		switch event.Rune() {
@@ -187,6 +260,27 @@ func (t *TUI) handleInput(event *tcell.EventKey) *tcell.EventKey {
 		return nil
 	}
 
+	// After k, a digit kills that agent's task; anything else cancels
+	if t.pickKill {
+		t.pickKill = false
+		if r := event.Rune(); r >= '0' && r <= '9' {
+			go t.state.RequestStop(int(r-'0'), state.StopKill)
+		}
+		t.updateHelpBar()
+		return nil
+	}
+
+	// After f on a bead, a digit assigns it to that agent
+	if t.pickAssign != "" {
+		taskID := t.pickAssign
+		t.pickAssign = ""
+		if r := event.Rune(); r >= '0' && r <= '9' {
+			go t.requestAssign(int(r-'0'), taskID)
+		}
+		t.updateHelpBar()
+		return nil
+	}
+
 	// Delegate screen-specific key handling
 	// If handler returns nil, the key was handled - return nil
 	// If handler returns event, key was NOT handled - continue to global handlers
@@ -201,10 +295,45 @@ func (t *TUI) handleInput(event *tcell.EventKey) *tcell.EventKey {
 			return nil // Key was handled
 		}
 		// Key not handled by git, fall through to global handlers
+	case strings.HasPrefix(t.logFilter, "replay"):
+		if handled := t.handleReplayKey(event); handled == nil {
+			return nil // Key was handled
+		}
+	case t.logFilter == "search":
+		if handled := t.handleSearchKey(event); handled == nil {
+			return nil // Key was handled
+		}
+	case t.logFilter == "pins":
+		if handled := t.handlePinsKey(event); handled == nil {
+			return nil // Key was handled
+		}
+	case t.logFilter == "graph":
+		if handled := t.handleGraphKey(event); handled == nil {
+			return nil // Key was handled
+		}
+	case t.logFilter == "stall":
+		if handled := t.handleStallKey(event); handled == nil {
+			return nil // Key was handled
+		}
+	case t.logFilter == "config":
+		if handled := t.handleConfigKey(event); handled == nil {
+			return nil // Key was handled
+		}
+	case strings.HasPrefix(t.logFilter, "agent:"):
+		if handled := t.handleAgentKey(event); handled == nil {
+			return nil // Key was handled
+		}
 	}
 
 	// Default key handling for views without custom handlers
 	switch event.Key() {
+	case tcell.KeyUp, tcell.KeyPgUp:
+		// Scrolling past the top of a log pages in older lines
+		if row, _ := t.rightContent.GetScrollOffset(); row == 0 && t.logHasMore && t.isLogView() {
+			t.logWindow += t.cfg.Logs.PageLines
+			t.logPaged = true
+		}
+		return event
 	case tcell.KeyEnter:
 		t.handleEnter()
 		return nil
@@ -241,13 +370,26 @@ func (t *TUI) handleInput(event *tcell.EventKey) *tcell.EventKey {
 		t.logFilter = "config"
 		t.selectedIdx = 0
 		t.rightFlex.SetTitle(" (C)onfig ")
+	case '/':
+		t.openSearchInput()
+		return nil
+	case '*':
+		t.openPins()
+	case 'd', 'D':
+		t.openGraph()
+	case 'w', 'W':
+		t.openStall()
+	case 'n', 'N':
+		t.openNewTask()
+		return nil
 	case '+', '=':
 		go t.state.AddAgent()
+	case 'k', 'K':
+		t.pickKill = true
+		t.updateHelpBar()
+		return nil
 	case '0', '1', '2', '3', '4', '5', '6', '7', '8', '9':
-		agentNum := int(event.Rune() - '0')
-		t.logFilter = fmt.Sprintf("agent-%d", agentNum)
-		t.selectedIdx = 0
-		t.rightFlex.SetTitle(fmt.Sprintf(" [%d] Agent %d Log ", agentNum, agentNum))
+		t.openAgentDetail(int(event.Rune() - '0'))
 	}
 	return event
 }
@@ -265,6 +407,11 @@ func (t *TUI) handleEnter() {
 
 // handleEscape processes Escape key for back navigation
 func (t *TUI) handleEscape() {
+	// An agent's full log goes back to its agent view
+	if strings.HasPrefix(t.logFilter, "agent-") {
+		t.openAgentDetail(t.agentDetailID())
+		return
+	}
 	// If in a detail view (contains ":"), go back to list
 	if strings.Contains(t.logFilter, ":") {
 		parts := strings.SplitN(t.logFilter, ":", 2)
@@ -285,10 +432,18 @@ func (t *TUI) updateHelpBar() {
 	var text string
 	if t.confirmQuit {
 		text = "[red]Quit? (y/n)[-]"
-	} else if t.state.AssignmentPaused {
-		text = "(A)ssign (B)eads (G)it (C)onfig  (+)Add (S)tart (Q)uit"
+	} else if t.pickAssign != "" {
+		text = fmt.Sprintf("[yellow]Assign %s to which idle agent? (0-9, any other key cancels)[-]", t.pickAssign)
+	} else if time.Now().Before(t.noticeUntil) {
+		text = t.notice
+	} else if t.pickKill {
+		text = "[red]Kill which agent's task? (0-9, any other key cancels)[-]"
+	} else if t.confirmStop != "" {
+		text = fmt.Sprintf("[red]%s agent %d's task? (y/n)[-]", stopVerbs[t.confirmStop], t.agentDetailID())
+	} else if t.state.AssignmentIsPaused() {
+		text = "(A)ssign (B)eads (D)eps (G)it (C)onfig (/)Search (*)Pins  (N)ew task (+)Add (K)ill (S)tart (Q)uit"
 	} else {
-		text = "(A)ssign (B)eads (G)it (C)onfig  (+)Add (P)ause (Q)uit"
+		text = "(A)ssign (B)eads (D)eps (G)it (C)onfig (/)Search (*)Pins  (N)ew task (+)Add (K)ill (P)ause (Q)uit"
 	}
 	t.helpBar.SetText(text)
 }
@@ -300,7 +455,11 @@ func (t *TUI) refreshLoop() {
 	ticker := time.NewTicker(500 * time.Millisecond)
 	defer ticker.Stop()
 
-	for range ticker.C {
+	for {
+		select {
+		case <-ticker.C:
+		case <-t.beadsChanged:
+		}
 		t.doRefresh()
 	}
 }
@@ -318,15 +477,26 @@ func (t *TUI) doRefresh() {
 	})
 
 	// Build content outside of main goroutine using cached widths
+	paged := t.logPaged
 	leftContent := t.buildLeftContent()
+	leftTitle := " Status " + profileTitle() + t.forecastTitle()
 	rightHeader := t.getRightHeader()
 	rightContent := t.buildRightContent()
 
 	// QueueUpdateDraw is non-blocking
 	t.app.QueueUpdateDraw(func() {
 		t.leftPane.SetText(leftContent)
+		t.leftPane.SetTitle(leftTitle)
 		t.rightHeader.SetText(rightHeader)
-		t.rightContent.SetText(rightContent)
+		if paged {
+			// Older lines were added above; keep showing the same ones
+			added := strings.Count(rightContent, "\n") - strings.Count(t.rightContent.GetText(false), "\n")
+			t.rightContent.SetText(rightContent)
+			t.rightContent.ScrollTo(added, 0)
+			t.logPaged = false
+		} else {
+			t.rightContent.SetText(rightContent)
+		}
 		t.updateHelpBar()
 	})
 }
@@ -356,8 +526,8 @@ func (t *TUI) getRightHeader() string {
 
 			title := fmt.Sprintf(" [yellow]%s[-] -- %s", shortID, taskTitle)
 			titleLen := 1 + len(shortID) + 4 + len(taskTitle)
-			hint := "[white]<esc>[gray] back [white]←[gray] prev [white]→[gray] next[-]"
-			hintLen := 27
+			hint := "[white]<esc>[gray] back [white]←[gray] prev [white]→[gray] next [white]r[gray] replay [white]f[gray] assign [white]![gray] bar[-]"
+			hintLen := 51
 			padding := t.rightWidth - titleLen - hintLen
 			if padding < 1 {
 				padding = 1
@@ -423,8 +593,8 @@ func (t *TUI) getRightHeader() string {
 			}
 		}
 
-		hint := "[white]←/→[gray] list [white]↑↓[gray] nav [white]⏎[gray] view[-]"
-		hintLen := 26 // visual length of hint
+		hint := "[white]←/→[gray] list [white]↑↓[gray] nav [white]⏎[gray] view [white]f[gray] assign [white]![gray] bar[-]"
+		hintLen := 41 // visual length of hint
 		padding := t.rightWidth - tabsLen - hintLen
 		if padding < 1 {
 			padding = 1
@@ -434,8 +604,64 @@ func (t *TUI) getRightHeader() string {
 		return "[yellow]Recent Commits[-]"
 	case t.logFilter == "config":
 		return "[yellow]Configuration[-]"
+	case t.logFilter == "graph":
+		hint := "[white]<esc>[gray] back [white]↑↓[gray] select [white]⏎[gray] view[-]"
+		hintLen := 26
+		padding := t.rightWidth - 13 - hintLen
+		if padding < 1 {
+			padding = 1
+		}
+		return " [yellow]Dependencies[-]" + strings.Repeat(" ", padding) + hint + "\n[#333333]" + strings.Repeat("─", t.rightWidth) + "[-]"
+	case t.logFilter == "stall":
+		hint := "[white]<esc>[gray] back [white]↑↓[gray] select [white]⏎[gray] view[-]"
+		hintLen := 26
+		padding := t.rightWidth - 24 - hintLen
+		if padding < 1 {
+			padding = 1
+		}
+		return " [yellow]Why is nothing running?[-]" + strings.Repeat(" ", padding) + hint + "\n[#333333]" + strings.Repeat("─", t.rightWidth) + "[-]"
+	case t.logFilter == "pins":
+		hint := "[white]<esc>[gray] back [white]↑↓[gray] select [white]d[gray] delete[-]"
+		hintLen := 28
+		padding := t.rightWidth - 15 - hintLen
+		if padding < 1 {
+			padding = 1
+		}
+		return " [yellow]Pinned Events[-]" + strings.Repeat(" ", padding) + hint + "\n[#333333]" + strings.Repeat("─", t.rightWidth) + "[-]"
+	case t.logFilter == "search":
+		hint := "[white]<esc>[gray] back [white]/[gray] new search[-]"
+		hintLen := 23
+		padding := t.rightWidth - len(t.searchQuery) - 10 - hintLen
+		if padding < 1 {
+			padding = 1
+		}
+		return " [yellow]Search:[-] " + tview.Escape(t.searchQuery) + strings.Repeat(" ", padding) + hint + "\n[#333333]" + strings.Repeat("─", t.rightWidth) + "[-]"
+	case strings.HasPrefix(t.logFilter, "replay:"):
+		title := "Replay " + strings.TrimPrefix(t.logFilter, "replay:")
+		if t.replayAgent != 0 {
+			title += fmt.Sprintf(" (agent %d)", t.replayAgent)
+		}
+		hint := "[white]<esc>[gray] back [white]↑↓[gray] select [white]o[gray] expand [white]e[gray] export [white]f[gray] agent [white]m[gray] pin [white]r[gray] restart[-]"
+		hintLen := 62
+		padding := t.rightWidth - len(title) - 1 - hintLen
+		if padding < 1 {
+			padding = 1
+		}
+		return " [yellow]" + title + "[-]" + strings.Repeat(" ", padding) + hint + "\n[#333333]" + strings.Repeat("─", t.rightWidth) + "[-]"
+	case strings.HasPrefix(t.logFilter, "agent:"):
+		agentID := strings.TrimPrefix(t.logFilter, "agent:")
+		title := " [yellow]Agent " + agentID + "[-]"
+		titleLen := 7 + len(agentID)
+		hint := "[white]<esc>[gray] back [white]k[gray] kill [white]r[gray] restart [white]n[gray] reassign [white]l[gray] log[-]"
+		hintLen := 44
+		padding := t.rightWidth - titleLen - hintLen
+		if padding < 1 {
+			padding = 1
+		}
+		return title + strings.Repeat(" ", padding) + hint + "\n[#333333]" + strings.Repeat("─", t.rightWidth) + "[-]"
 	case strings.HasPrefix(t.logFilter, "agent-"):
-		return fmt.Sprintf("[yellow]Agent %s Log[-]", strings.TrimPrefix(t.logFilter, "agent-"))
+		hint := "[white]<esc>[gray] back[-]"
+		return fmt.Sprintf("[yellow]Agent %s Log[-]  %s", strings.TrimPrefix(t.logFilter, "agent-"), hint)
 	default:
 		return "[yellow]Assignment Log[-]"
 	}
@@ -449,6 +675,18 @@ func (t *TUI) buildRightContent() string {
 		return t.buildGitView()
 	case t.logFilter == "config":
 		return t.buildConfigView()
+	case strings.HasPrefix(t.logFilter, "replay:"):
+		return t.buildReplayView(strings.TrimPrefix(t.logFilter, "replay:"))
+	case t.logFilter == "search":
+		return t.buildSearchView()
+	case t.logFilter == "pins":
+		return t.buildPinsView()
+	case t.logFilter == "graph":
+		return t.buildGraphView()
+	case t.logFilter == "stall":
+		return t.buildStallView()
+	case strings.HasPrefix(t.logFilter, "agent:"):
+		return t.buildAgentDetailView(t.agentDetailID())
 	default:
 		return t.buildLogsView()
 	}
@@ -463,7 +701,7 @@ func (t *TUI) loadTasksWithTimeout(timeout time.Duration) []*beads.Task {
 	ch := make(chan result, 1)
 
 	go func() {
-		tasks, err := beads.LoadTasks(t.repoDir)
+		tasks, err := tracker.LoadTasks(t.projCfg, t.repoDir)
 		ch <- result{tasks, err}
 	}()
 
@@ -477,3 +715,25 @@ func (t *TUI) loadTasksWithTimeout(timeout time.Duration) []*beads.Task {
 		return nil
 	}
 }
+
+// profileTitle names the active profile in a pane title, if there is one.
+// recentEventCount is how many events the Status pane lists.
+const recentEventCount = 5
+
+// HandleEvent takes an event from the orchestrator's bus, for the Status
+// pane's list of recent events.
+func (t *TUI) HandleEvent(e events.Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.recentEvents = append(t.recentEvents, e)
+	if len(t.recentEvents) > recentEventCount {
+		t.recentEvents = t.recentEvents[len(t.recentEvents)-recentEventCount:]
+	}
+}
+
+func profileTitle() string {
+	if p := config.ActiveProfile(); p != "" {
+		return fmt.Sprintf("─ [aqua]profile %s[-] ", p)
+	}
+	return ""
+}
@@ -0,0 +1,170 @@
+package tui
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+
+	"github.com/bryantinsley/machinator/backend/internal/agent"
+	"github.com/bryantinsley/machinator/backend/internal/history"
+	"github.com/bryantinsley/machinator/backend/internal/state"
+	"github.com/bryantinsley/machinator/backend/internal/transcript"
+)
+
+const (
+	agentOutputLines = 20 // Tail of the gemini log
+	agentEventLines  = 50 // Tail of the agent's orchestrator log
+)
+
+// stopVerbs names each stop request in the confirmation prompt.
+var stopVerbs = map[string]string{
+	state.StopKill:     "Kill",
+	state.StopRestart:  "Restart",
+	state.StopReassign: "Reassign",
+}
+
+// openAgentDetail switches to the per-agent view ("agent:N").
+func (t *TUI) openAgentDetail(agentID int) {
+	t.logFilter = fmt.Sprintf("agent:%d", agentID)
+	t.selectedIdx = 0
+	t.confirmStop = ""
+	t.rightFlex.SetTitle(fmt.Sprintf(" [%d] Agent %d ", agentID, agentID))
+}
+
+// agentDetailID returns the agent shown by the agent view or its log.
+func (t *TUI) agentDetailID() int {
+	s := strings.TrimPrefix(strings.TrimPrefix(t.logFilter, "agent:"), "agent-")
+	id, _ := strconv.Atoi(s)
+	return id
+}
+
+// handleAgentKey handles keys in the agent view. Stopping a task asks for
+// confirmation first; the agent's watcher carries out the request.
+// Returns nil to indicate the key was handled, or returns event to pass through.
+func (t *TUI) handleAgentKey(event *tcell.EventKey) *tcell.EventKey {
+	agentID := t.agentDetailID()
+
+	if t.confirmStop != "" {
+		if r := event.Rune(); r == 'y' || r == 'Y' {
+			req := t.confirmStop
+			go t.state.RequestStop(agentID, req)
+		}
+		t.confirmStop = ""
+		t.updateHelpBar()
+		return nil
+	}
+
+	switch {
+	case event.Key() == tcell.KeyEscape:
+		t.logFilter = "assign"
+		t.rightFlex.SetTitle(" (A)ssignment Log ")
+		return nil
+	case event.Rune() == 'k' || event.Rune() == 'K':
+		t.confirmStop = state.StopKill
+	case event.Rune() == 'r' || event.Rune() == 'R':
+		t.confirmStop = state.StopRestart
+	case event.Rune() == 'n' || event.Rune() == 'N':
+		t.confirmStop = state.StopReassign
+	case event.Rune() == 'l' || event.Rune() == 'L':
+		t.logFilter = fmt.Sprintf("agent-%d", agentID)
+		t.rightFlex.SetTitle(fmt.Sprintf(" [%d] Agent %d Log ", agentID, agentID))
+		return nil
+	default:
+		return event
+	}
+	t.updateHelpBar()
+	return nil
+}
+
+// buildAgentDetailView shows an agent's task, timing, the tail of its gemini
+// output, and its recent orchestrator log lines.
+func (t *TUI) buildAgentDetailView(agentID int) string {
+	var a *state.Agent
+	for _, snap := range t.state.AgentsSnapshot() {
+		if snap.ID == agentID {
+			a = &snap
+			break
+		}
+	}
+	if a == nil {
+		return fmt.Sprintf(" [red]No agent %d[-]", agentID)
+	}
+
+	pad := " "
+	var sb strings.Builder
+	status := a.State
+	if a.PID != 0 {
+		status += fmt.Sprintf(", pid %d", a.PID)
+	}
+	fmt.Fprintf(&sb, "%s[gray]Agent:[-]      %d (%s)\n", pad, a.ID, status)
+
+	if a.TaskID != "" {
+		t.mu.Lock()
+		cachedTasks := t.cachedTasks
+		t.mu.Unlock()
+
+		fmt.Fprintf(&sb, "%s[gray]Task:[-]       %s\n", pad, a.TaskID)
+		for _, task := range cachedTasks {
+			if task.ID != a.TaskID {
+				continue
+			}
+			sb.WriteString(pad + "[gray]Title:[-]      " + wrapText(task.Title, pad+"            ", t.rightWidth)[len(pad)+12:] + "\n")
+			if task.Description != "" {
+				sb.WriteString(pad + "[gray]Description:[-]\n")
+				sb.WriteString(tview.Escape(wrapText(task.Description, pad+"  ", t.rightWidth)) + "\n")
+			}
+			break
+		}
+		if t.projCfg != nil {
+			fmt.Fprintf(&sb, "%s[gray]Branch:[-]     %s\n", pad, t.projCfg.Branch)
+		}
+		if !a.StartedAt.IsZero() {
+			fmt.Fprintf(&sb, "%s[gray]Elapsed:[-]    %s", pad, time.Since(a.StartedAt).Round(time.Second))
+			if !a.LastActivity.IsZero() {
+				fmt.Fprintf(&sb, " (last activity %s ago)", time.Since(a.LastActivity).Round(time.Second))
+			}
+			sb.WriteString("\n")
+		}
+	}
+
+	rule := "[#333333]" + strings.Repeat("─", t.rightWidth) + "[-]\n"
+
+	sb.WriteString("\n" + pad + "[cyan]Output[-]\n" + rule)
+	output, _ := readTail(agent.LogPath(t.cfg.MachinatorDir, agentID), agentOutputLines)
+	if len(output) == 0 {
+		sb.WriteString(pad + "[gray]No output[-]\n")
+	}
+	for _, line := range output {
+		summary := transcript.Summary(transcript.Entry{Event: json.RawMessage(line)})
+		sb.WriteString(pad + tview.Escape(clipWidth(summary, t.rightWidth-len(pad))) + "\n")
+	}
+
+	sb.WriteString("\n" + pad + "[cyan]Events[-]\n" + rule)
+	lines, _ := tailLog(filepath.Join(t.cfg.MachinatorDir, "logs"), fmt.Sprintf("agent-%d", agentID), agentEventLines)
+	if len(lines) == 0 {
+		sb.WriteString(pad + "[gray]No events[-]\n")
+	}
+	for _, line := range lines {
+		if r, ok := history.ParseLogLine(line); ok {
+			fmt.Fprintf(&sb, "%s[gray]%s[-] %s\n", pad, r.Time.Format("15:04:05"), tview.Escape(r.Text))
+		}
+	}
+	return sb.String()
+}
+
+// clipWidth cuts s to at most width characters.
+func clipWidth(s string, width int) string {
+	if width < 10 {
+		width = 10
+	}
+	if r := []rune(s); len(r) > width {
+		return string(r[:width-1]) + "…"
+	}
+	return s
+}
@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/bryantinsley/machinator/backend/internal/beads"
+	"github.com/rivo/tview"
 )
 
 // navigateBeadDetail moves to prev/next bead in detail view
@@ -82,6 +83,13 @@ func (t *TUI) buildBeadDetailView(taskID string) string {
 		complexity = "complex"
 	}
 	content += pad + fmt.Sprintf("[gray]Challenge:[-]  %s\n", complexity)
+	if t.state.IsTaskBarred(task.ID) {
+		reason := t.state.BarReason(task.ID)
+		if reason == "" {
+			reason = "no reason given"
+		}
+		content += pad + "[gray]Barred:[-]     [red]" + tview.Escape(wrapText(reason, pad+"            ", t.rightWidth)[len(pad)+12:]) + "[-]\n"
+	}
 
 	// Assignment
 	if task.Assignee != "" {
@@ -3,9 +3,11 @@ package tui
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/bryantinsley/machinator/backend/internal/beads"
 	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
 )
 
 // handleBeadsKey handles all key events for the beads view.
@@ -69,6 +71,32 @@ func (t *TUI) handleBeadsKey(event *tcell.EventKey) *tcell.EventKey {
 		return nil
 	}
 
+	if inDetailView && (event.Rune() == 'r' || event.Rune() == 'R') {
+		t.openReplay(strings.TrimPrefix(t.logFilter, "beads:"))
+		return nil
+	}
+
+	// f then an agent number assigns the bead by hand
+	if event.Rune() == 'f' || event.Rune() == 'F' {
+		if inDetailView {
+			t.pickAssign = strings.TrimPrefix(t.logFilter, "beads:")
+		} else if tasks := t.getBeadsListTasks(); t.selectedIdx >= 0 && t.selectedIdx < len(tasks) {
+			t.pickAssign = tasks[t.selectedIdx].ID
+		}
+		t.updateHelpBar()
+		return nil
+	}
+
+	// ! bars the bead so it is never assigned, or unbars it (x quits)
+	if event.Rune() == '!' {
+		if inDetailView {
+			go t.toggleBar(strings.TrimPrefix(t.logFilter, "beads:"))
+		} else if tasks := t.getBeadsListTasks(); t.selectedIdx >= 0 && t.selectedIdx < len(tasks) {
+			go t.toggleBar(tasks[t.selectedIdx].ID)
+		}
+		return nil
+	}
+
 	return event // Pass through unhandled keys
 }
 
@@ -150,6 +178,8 @@ func (t *TUI) buildBeadsView() string {
 		shortID    string
 		complexity string
 		title      string
+		barred     bool
+		barReason  string
 	}
 	var tasks []taskEntry
 	maxIDLen := 0
@@ -165,7 +195,8 @@ func (t *TUI) buildBeadsView() string {
 		if task.IsComplex {
 			complexity = "complex"
 		}
-		tasks = append(tasks, taskEntry{task.ID, shortID, complexity, task.Title})
+		barred := t.state.IsTaskBarred(task.ID)
+		tasks = append(tasks, taskEntry{task.ID, shortID, complexity, task.Title, barred, t.state.BarReason(task.ID)})
 	}
 
 	// Clamp selectedIdx
@@ -185,8 +216,15 @@ func (t *TUI) buildBeadsView() string {
 
 	for i, task := range tasks {
 		title := task.title
-		if len(title) > titleWidth {
-			title = title[:titleWidth-1] + "…"
+		width := titleWidth
+		if task.barred {
+			width -= 7 // "barred "
+		}
+		if len(title) > width {
+			title = title[:width-1] + "…"
+		}
+		if task.barred {
+			title = "[red]barred[-] " + title
 		}
 
 		// Highlight selected item
@@ -197,6 +235,9 @@ func (t *TUI) buildBeadsView() string {
 		} else {
 			content += fmt.Sprintf("%s[white]%-*s[-] [gray](%s)[-] %s\n", prefix, maxIDLen, task.shortID, task.complexity, title)
 		}
+		if task.barReason != "" {
+			content += fmt.Sprintf("%s[gray]%s[-]\n", strings.Repeat(" ", overhead), tview.Escape(clipWidth(task.barReason, titleWidth)))
+		}
 	}
 
 	return content
@@ -253,6 +294,38 @@ func (t *TUI) getBeadsListTasks() []*beads.Task {
 	}
 }
 
+// requestAssign asks the assigner to run a task on an agent, bypassing
+// selection, bars and cooldowns, and reports the outcome in the help bar.
+// Runs off the main goroutine.
+func (t *TUI) requestAssign(agentID int, taskID string) {
+	notice := fmt.Sprintf("[green]Assigning %s to agent %d[-]", taskID, agentID)
+	if err := t.state.RequestAssign(agentID, taskID); err != nil {
+		notice = fmt.Sprintf("[red]Can't assign: %v[-]", err)
+	}
+	t.app.QueueUpdateDraw(func() {
+		t.notice = notice
+		t.noticeUntil = time.Now().Add(5 * time.Second)
+		t.updateHelpBar()
+	})
+}
+
+// toggleBar bars a task, or unbars it if it is already barred, and reports
+// the change in the help bar. Runs off the main goroutine.
+func (t *TUI) toggleBar(taskID string) {
+	notice := fmt.Sprintf("[yellow]Barred %s; it won't be assigned[-]", taskID)
+	if t.state.IsTaskBarred(taskID) {
+		t.state.UnbarTask(taskID)
+		notice = fmt.Sprintf("[green]Unbarred %s[-]", taskID)
+	} else {
+		t.state.BarTaskAndSave(taskID, "barred from TUI")
+	}
+	t.app.QueueUpdateDraw(func() {
+		t.notice = notice
+		t.noticeUntil = time.Now().Add(5 * time.Second)
+		t.updateHelpBar()
+	})
+}
+
 // selectBeadItem handles Enter key on beads list
 func (t *TUI) selectBeadItem() {
 	tasks := t.getBeadsListTasks()
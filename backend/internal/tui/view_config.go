@@ -2,10 +2,64 @@ package tui
 
 import (
 	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
 
 	"github.com/bryantinsley/machinator/backend/internal/config"
+	"github.com/bryantinsley/machinator/backend/internal/project"
+	"github.com/bryantinsley/machinator/backend/internal/setup"
 )
 
+// handleConfigKey handles keys in the config view.
+func (t *TUI) handleConfigKey(event *tcell.EventKey) *tcell.EventKey {
+	if event.Rune() == 'm' && t.projCfg != nil && t.projectConfigPath != "" {
+		t.openModels()
+		return nil
+	}
+	return event
+}
+
+// openModels shows a form for the project's simple and complex models.
+func (t *TUI) openModels() {
+	simple, complex := t.projCfg.Models()
+	form := tview.NewForm().
+		AddInputField("Simple model", simple, 0, nil, nil).
+		AddInputField("Complex model", complex, 0, nil, nil)
+	form.AddButton("Save", func() {
+		simple := strings.TrimSpace(form.GetFormItemByLabel("Simple model").(*tview.InputField).GetText())
+		complex := strings.TrimSpace(form.GetFormItemByLabel("Complex model").(*tview.InputField).GetText())
+		if simple == "" || complex == "" {
+			form.SetTitle(" Models [red](both are needed)[-] ")
+			return
+		}
+		t.closeForm()
+		go t.saveModels(simple, complex)
+	})
+	form.AddButton("Cancel", t.closeForm)
+	t.showForm(form, " Models ", 9)
+}
+
+// saveModels writes the models to the project config. The running
+// orchestrator switches to them when it sees the edit, as it does for any
+// (configWatcher). Runs off the main goroutine.
+func (t *TUI) saveModels(simple, complex string) {
+	err := project.SetModels(t.projectConfigPath, simple, complex)
+
+	t.app.QueueUpdateDraw(func() {
+		if err != nil {
+			t.notice = fmt.Sprintf("[red]Can't save models: %v[-]", err)
+		} else {
+			t.notice = fmt.Sprintf("[green]Models set: %s / %s[-]", simple, complex)
+		}
+		t.noticeUntil = time.Now().Add(5 * time.Second)
+		t.updateHelpBar()
+	})
+}
+
 // buildConfigView creates the config display for the right pane.
 func (t *TUI) buildConfigView() string {
 	var content string
@@ -14,12 +68,20 @@ func (t *TUI) buildConfigView() string {
 	content += "[yellow]Global Configuration[-]\n"
 	content += "─────────────────────\n"
 	content += fmt.Sprintf("default_agent_count: [white]%d[-]\n", t.cfg.DefaultAgentCount)
+	if as := t.cfg.Autoscale; t.cfg.FeatureEnabled("autoscaler") {
+		content += fmt.Sprintf("autoscale: [white]%d–%d agents, idle after %s[-]\n", as.MinAgents, as.MaxAgents, as.IdleAfter.Duration())
+	} else {
+		content += "autoscale: [white]off[-]\n"
+	}
 	content += fmt.Sprintf("hide_commit_authors: [white]%v[-]\n", t.cfg.HideCommitAuthors)
 	content += "\n"
 
 	content += "[yellow]Agent Timeouts[-]\n"
-	content += fmt.Sprintf("  idle: [white]%s[-]\n", t.cfg.Timeouts.Idle.Duration())
-	content += fmt.Sprintf("  max_runtime: [white]%s[-]\n", t.cfg.Timeouts.MaxRuntime.Duration())
+	timeouts := t.cfg.LiveTimeouts()
+	content += fmt.Sprintf("  idle: [white]%s[-]\n", timeouts.Idle.Duration())
+	content += fmt.Sprintf("  max_runtime: [white]%s[-]\n", timeouts.MaxRuntime.Duration())
+	content += fmt.Sprintf("  kill_cooldown: [white]%s[-]\n", timeouts.KillCooldown.Duration())
+	content += fmt.Sprintf("  setup: [white]%s[-]\n", timeouts.Setup.Duration())
 	content += "\n"
 
 	content += "[yellow]Intervals[-]\n"
@@ -33,12 +95,29 @@ func (t *TUI) buildConfigView() string {
 	if t.projCfg != nil {
 		content += fmt.Sprintf("repo: [white]%s[-]\n", t.projCfg.Repo)
 		content += fmt.Sprintf("branch: [white]%s[-]\n", t.projCfg.Branch)
-		content += fmt.Sprintf("simple_model: [white]%s[-]\n", t.projCfg.SimpleModelName)
-		content += fmt.Sprintf("complex_model: [white]%s[-]\n", t.projCfg.ComplexModelName)
+		simple, complex := t.projCfg.Models()
+		content += fmt.Sprintf("simple_model: [white]%s[-]\n", simple)
+		content += fmt.Sprintf("complex_model: [white]%s[-]\n", complex)
+		content += "[gray]m to edit models[-]\n"
 	} else {
 		content += "[gray]No project loaded[-]\n"
 	}
 
+	content += "\n[yellow]Disk Usage[-]\n"
+	if u := t.diskUsage(); u == nil {
+		content += "[gray]measuring…[-]\n"
+	} else {
+		content += fmt.Sprintf("  repo: [white]%s[-]\n", setup.FormatSize(u.Repo))
+		if u.ExtraRepos > 0 {
+			content += fmt.Sprintf("  extra repos: [white]%s[-]\n", setup.FormatSize(u.ExtraRepos))
+		}
+		content += fmt.Sprintf("  worktrees: [white]%s[-] [gray](%d)[-]\n", setup.FormatSize(u.WorktreesTotal()), len(u.Worktrees))
+		content += fmt.Sprintf("  scratch: [white]%s[-]\n", setup.FormatSize(u.Scratch))
+		content += fmt.Sprintf("  checkpoints: [white]%s[-]\n", setup.FormatSize(u.Checkpoints))
+		content += fmt.Sprintf("  total: [white]%s[-]\n", setup.FormatSize(u.Total()))
+		content += "[gray]machinator du for logs and transcripts[-]\n"
+	}
+
 	// Paths
 	content += "\n[yellow]Config Paths[-]\n"
 	content += fmt.Sprintf("global:  [gray]%s[-]\n", config.ConfigPath())
@@ -46,3 +125,25 @@ func (t *TUI) buildConfigView() string {
 
 	return content
 }
+
+// diskUsage returns the project's last measured disk usage, starting a new
+// measurement in the background when it is a minute old. nil until the
+// first one finishes.
+func (t *TUI) diskUsage() *setup.ProjectUsage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.measuringUsage && time.Since(t.cachedUsageTime) > time.Minute {
+		t.measuringUsage = true
+		go func() {
+			u, err := setup.MeasureProject(filepath.Dir(t.repoDir))
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.measuringUsage = false
+			t.cachedUsageTime = time.Now() // Don't retry a failure at once either
+			if err == nil {
+				t.cachedUsage = &u
+			}
+		}()
+	}
+	return t.cachedUsage
+}
@@ -0,0 +1,85 @@
+package tui
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bryantinsley/machinator/backend/internal/quota"
+	"github.com/bryantinsley/machinator/backend/internal/rundb"
+)
+
+// forecastWindow is how far back the quota ledger is read for burn rates.
+const forecastWindow = 2 * time.Hour
+
+// buildForecastLines estimates when each model's quota runs out at the
+// recent burn rate, and how many more tasks it covers, for the quota panel.
+// Models not using quota get no line.
+func (t *TUI) buildForecastLines(models []string) string {
+	forecasts := t.forecasts(models)
+
+	var content string
+	for i, f := range forecasts {
+		if f.ExhaustedIn == 0 {
+			continue
+		}
+		line := fmt.Sprintf("[gray]%s[-] out in ~%s", quota.ModelLabel(models[i]), formatAge(f.ExhaustedIn))
+		if f.TasksLeft >= 0 {
+			line += fmt.Sprintf(", ~%d tasks", f.TasksLeft)
+		}
+		content += line + "\n"
+	}
+	return content
+}
+
+// forecastTitle summarizes the model that runs out soonest for the status
+// pane's title, or returns "" while no quota is being used.
+func (t *TUI) forecastTitle() string {
+	t.mu.Lock()
+	forecasts := t.cachedForecasts
+	t.mu.Unlock()
+
+	var soonest *rundb.Forecast
+	for i, f := range forecasts {
+		if f.ExhaustedIn > 0 && (soonest == nil || f.ExhaustedIn < soonest.ExhaustedIn) {
+			soonest = &forecasts[i]
+		}
+	}
+	if soonest == nil {
+		return ""
+	}
+	title := fmt.Sprintf("─ [yellow]quota exhausted in ~%s[-]", formatAge(soonest.ExhaustedIn))
+	if soonest.TasksLeft >= 0 {
+		title += fmt.Sprintf(" [gray](~%d tasks)[-]", soonest.TasksLeft)
+	}
+	return title + " "
+}
+
+// forecasts returns the cached forecasts for models, reading the run
+// database when they are stale. Does I/O; don't call holding t.mu.
+func (t *TUI) forecasts(models []string) []rundb.Forecast {
+	t.mu.Lock()
+	cached, fresh := t.cachedForecasts, time.Since(t.cachedForecastsTime) < 30*time.Second
+	t.mu.Unlock()
+	if fresh && len(cached) == len(models) {
+		return cached
+	}
+
+	db := t.state.DB()
+	if db == nil {
+		return nil
+	}
+	var forecasts []rundb.Forecast
+	for _, model := range models {
+		f, err := db.Forecast(model, forecastWindow)
+		if err != nil {
+			return cached
+		}
+		forecasts = append(forecasts, f)
+	}
+
+	t.mu.Lock()
+	t.cachedForecasts = forecasts
+	t.cachedForecastsTime = time.Now()
+	t.mu.Unlock()
+	return forecasts
+}
@@ -0,0 +1,132 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+
+	"github.com/bryantinsley/machinator/backend/internal/beads"
+)
+
+const graphMaxDepth = 6 // Deeper dependents are summarized
+
+// graphColors colors tasks by beads.GraphStatus.
+var graphColors = map[string]string{
+	"closed":      "gray",
+	"in_progress": "cyan",
+	"blocked":     "yellow",
+	"ready":       "green",
+}
+
+// openGraph switches to the dependency graph screen.
+func (t *TUI) openGraph() {
+	t.logFilter = "graph"
+	t.selectedIdx = 0
+	t.rightFlex.SetTitle(" (D)ependencies ")
+}
+
+// handleGraphKey handles keys in the dependency graph.
+// Returns nil to indicate the key was handled, or returns event to pass through.
+func (t *TUI) handleGraphKey(event *tcell.EventKey) *tcell.EventKey {
+	switch event.Key() {
+	case tcell.KeyEscape:
+		t.logFilter = "assign"
+		t.rightFlex.SetTitle(" (A)ssignment Log ")
+		return nil
+	case tcell.KeyUp:
+		if t.selectedIdx > 0 {
+			t.selectedIdx--
+		}
+		return nil
+	case tcell.KeyDown:
+		t.selectedIdx++ // Clamped when the view is built
+		return nil
+	case tcell.KeyEnter:
+		t.mu.Lock()
+		cachedTasks := t.cachedTasks
+		t.mu.Unlock()
+		if b := beads.Bottlenecks(cachedTasks); t.selectedIdx >= 0 && t.selectedIdx < len(b) {
+			t.logFilter = "beads:" + b[t.selectedIdx].ID
+			t.rightFlex.SetTitle(" Beads! ")
+		}
+		return nil
+	}
+	return event
+}
+
+// buildGraphView lists the tasks holding up the most work, then the tree
+// of work waiting on each of them.
+func (t *TUI) buildGraphView() string {
+	t.mu.Lock()
+	cachedTasks := t.cachedTasks
+	t.mu.Unlock()
+
+	if len(cachedTasks) == 0 {
+		return "[gray]No tasks loaded[-]"
+	}
+
+	bottlenecks := beads.Bottlenecks(cachedTasks)
+	if len(bottlenecks) == 0 {
+		return " [gray]No open task is blocking other work[-]"
+	}
+	if t.selectedIdx >= len(bottlenecks) {
+		t.selectedIdx = len(bottlenecks) - 1
+	}
+
+	closed := beads.ClosedIDs(cachedTasks)
+	counts := beads.Downstream(cachedTasks)
+	deps := beads.Dependents(cachedTasks)
+
+	var sb strings.Builder
+	sb.WriteString(" [cyan]Closing these unblocks the most work[-]\n")
+	for i, task := range bottlenecks {
+		status := beads.GraphStatus(task, closed)
+		line := fmt.Sprintf("%4d  %s %s", counts[task.ID], task.ID, task.Title)
+		line = tview.Escape(clipWidth(line, t.rightWidth-3))
+		if i == t.selectedIdx {
+			fmt.Fprintf(&sb, "[white::r]> %s[-:-:-]\n", line)
+		} else {
+			fmt.Fprintf(&sb, "  [%s]%s[-]\n", graphColors[status], line)
+		}
+	}
+
+	// Trees start from bottlenecks nothing open is waiting on
+	sb.WriteString("\n [cyan]Dependency tree[-]  [green]ready[-] [cyan]in progress[-] [yellow]blocked[-] [gray]closed[-]\n")
+	for _, task := range bottlenecks {
+		if beads.GraphStatus(task, closed) == "blocked" {
+			continue
+		}
+		t.writeGraphTree(&sb, task, deps, closed, counts, 0, map[string]bool{})
+	}
+	return sb.String()
+}
+
+// writeGraphTree writes task and, indented below it, the tasks waiting on it.
+func (t *TUI) writeGraphTree(sb *strings.Builder, task *beads.Task, deps map[string][]*beads.Task, closed map[string]bool, counts map[string]int, depth int, path map[string]bool) {
+	indent := strings.Repeat("  ", depth+1)
+	text := task.ID + " " + task.Title
+	if n := counts[task.ID]; n > 0 {
+		text += fmt.Sprintf(" (unblocks %d)", n)
+	}
+	text = tview.Escape(clipWidth(text, t.rightWidth-len(indent)-2))
+	fmt.Fprintf(sb, "%s[%s]%s[-]\n", indent, graphColors[beads.GraphStatus(task, closed)], text)
+
+	if len(deps[task.ID]) == 0 {
+		return
+	}
+	if depth+1 >= graphMaxDepth {
+		fmt.Fprintf(sb, "%s  [gray]… %d more[-]\n", indent, counts[task.ID])
+		return
+	}
+	path[task.ID] = true
+	for _, d := range deps[task.ID] {
+		if path[d.ID] {
+			fmt.Fprintf(sb, "%s  [red]%s (cycle)[-]\n", indent, tview.Escape(d.ID))
+			continue
+		}
+		t.writeGraphTree(sb, d, deps, closed, counts, depth+1, path)
+	}
+	delete(path, task.ID)
+}
@@ -2,12 +2,12 @@ package tui
 
 import (
 	"fmt"
-	"sort"
 	"strings"
 	"time"
 
 	"github.com/bryantinsley/machinator/backend/internal/beads"
-	"github.com/bryantinsley/machinator/backend/internal/quota"
+	"github.com/bryantinsley/machinator/backend/internal/project"
+	"github.com/rivo/tview"
 )
 
 // buildLeftContent builds the left pane content (status sidebar).
@@ -41,6 +41,7 @@ func (t *TUI) buildLeftContent() string {
 	// Copy data we need while holding lock
 	cachedTasks := t.cachedTasks
 	cachedGitLog := t.cachedGitLog
+	recentEvents := t.recentEvents
 	t.mu.Unlock()
 
 	// Helper for full-width underlines
@@ -53,88 +54,38 @@ func (t *TUI) buildLeftContent() string {
 	}
 
 	// Status indicator at top
-	if t.state.AssignmentPaused {
+	switch {
+	case t.state.AssignmentIsPaused():
 		content += "[yellow]⏸ PAUSED[-]\n"
-	} else {
+	case t.state.Hold() != "":
+		content += "[red]⏸ HELD[-] [gray]" + tview.Escape(t.state.Hold()) + "[-]\n"
+	case len(t.state.AssignedAgents()) == 0 && beads.Stalled(cachedTasks):
+		content += "[yellow]◌ STALLED[-] [gray](W)hy?[-]\n"
+	default:
 		content += "[green]▶ RUNNING[-]\n"
 	}
 	content += "\n"
 
-	// Quota section - video game style hearts
-	// Grid format: columns = models (simple, complex), rows = accounts
+	// Quota section - video game style hearts, a row per model
 	content += "[cyan]Quota[-]\n"
 	content += underline(5) + "\n"
 
-	// Get model names from project config
-	simpleModel := "gemini-3-flash-preview"
-	complexModel := "gemini-3-pro-preview"
-	simpleLabel := "flash"
-	complexLabel := "pro"
+	simpleModel := project.DefaultSimpleModel
+	complexModel := project.DefaultComplexModel
 	if t.projCfg != nil {
-		if t.projCfg.SimpleModelName != "" {
-			simpleModel = t.projCfg.SimpleModelName
-			// Extract recognizable label from model name
-			if strings.Contains(simpleModel, "flash") {
-				simpleLabel = "flash"
-			} else if strings.Contains(simpleModel, "pro") {
-				simpleLabel = "pro"
-			} else {
-				simpleLabel = "simple"
-			}
+		simple, complex := t.projCfg.Models()
+		if simple != "" {
+			simpleModel = simple
 		}
-		if t.projCfg.ComplexModelName != "" {
-			complexModel = t.projCfg.ComplexModelName
-			if strings.Contains(complexModel, "pro") {
-				complexLabel = "pro"
-			} else if strings.Contains(complexModel, "flash") {
-				complexLabel = "flash"
-			} else {
-				complexLabel = "complex"
-			}
+		if complex != "" {
+			complexModel = complex
 		}
 	}
 
 	if t.quota != nil && len(t.quota.Accounts) > 0 {
-		// Sort accounts by name
-		accounts := make([]quota.AccountQuota, len(t.quota.Accounts))
-		copy(accounts, t.quota.Accounts)
-		sort.Slice(accounts, func(i, j int) bool {
-			return accounts[i].Name < accounts[j].Name
-		})
-
-		// Header row with model names - brighter colors
-		content += fmt.Sprintf("%-6s %-12s %-12s\n", "", "[#00CCCC]"+simpleLabel+"[-]", "[#CC66FF]"+complexLabel+"[-]")
-
-		for _, acc := range accounts {
-			// Get quota percentages (0-100)
-			simplePct := -1
-			complexPct := -1
-			if remaining, ok := acc.Models[simpleModel]; ok {
-				simplePct = int(remaining * 100)
-			}
-			if remaining, ok := acc.Models[complexModel]; ok {
-				complexPct = int(remaining * 100)
-			}
-
-			// Render hearts + percentage for each model
-			simpleHearts := renderQuotaHearts(simplePct)
-			complexHearts := renderQuotaHearts(complexPct)
-			simplePctStr := "[gray] --[-]"
-			complexPctStr := "[gray] --[-]"
-			if simplePct >= 0 {
-				simplePctStr = fmt.Sprintf(" %3d%%", simplePct)
-			}
-			if complexPct >= 0 {
-				complexPctStr = fmt.Sprintf(" %3d%%", complexPct)
-			}
-
-			// Truncate account name to fit
-			name := acc.Name
-			if len(name) > 6 {
-				name = name[:5] + "…"
-			}
-			content += fmt.Sprintf("%-6s %s%s %s%s\n", name, simpleHearts, simplePctStr, complexHearts, complexPctStr)
-		}
+		models := t.quota.Models(simpleModel, complexModel)
+		content += quotaTable(t.quota.Accounts, models, simpleModel, complexModel, t.leftWidth)
+		content += t.buildForecastLines(models)
 	} else {
 		content += "[gray]No quota data[-]\n"
 	}
@@ -226,6 +177,30 @@ func (t *TUI) buildLeftContent() string {
 		content += fmt.Sprintf("blocked:[yellow]%d[-] closed:[gray]%d[-]\n", blocked, closed)
 	}
 
+	// Recent events section, from the bus
+	content += "\n[cyan]Events[-]\n"
+	content += underline(6) + "\n"
+	if len(recentEvents) == 0 {
+		content += "[gray]No events yet[-]\n"
+	}
+	for _, e := range recentEvents {
+		color := "white"
+		switch {
+		case e.IsFailure():
+			color = "red"
+		case e.IsCompletion():
+			color = "green"
+		}
+		line := string(e.Type)
+		if e.TaskID != "" {
+			line += " " + e.TaskID
+		}
+		if maxLen := t.leftWidth - 9; maxLen > 5 && len(line) > maxLen {
+			line = line[:maxLen-1] + "…"
+		}
+		content += fmt.Sprintf("[gray]%s[-] [%s]%s[-]\n", e.Time.Format("15:04:05"), color, tview.Escape(line))
+	}
+
 	// Recent commits section
 	content += "\n[#CC99FF]Git Commits[-]\n"
 	content += underline(11) + "\n"
@@ -1,34 +1,76 @@
 package tui
 
-import "fmt"
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
 
-// buildLogsView builds the filtered logs view for the right pane.
-func (t *TUI) buildLogsView() string {
-	var content string
+	"github.com/rivo/tview"
 
-	logFilter := t.logFilter
+	"github.com/bryantinsley/machinator/backend/internal/history"
+)
 
-	t.logMu.Lock()
-	logs := make([]LogEntry, len(t.logs))
-	copy(logs, t.logs)
-	t.logMu.Unlock()
-
-	for _, entry := range logs {
-		match := false
-		switch logFilter {
-		case "all":
-			match = true
-		case "assign":
-			match = entry.Source == "assign" || entry.Source == "quota"
-		default:
-			match = entry.Source == logFilter
-		}
+// isLogView reports whether the right pane shows a log.
+func (t *TUI) isLogView() bool {
+	return t.logFilter == "all" || t.logFilter == "assign" || strings.HasPrefix(t.logFilter, "agent-")
+}
+
+// logSources returns the log files behind a log view.
+func logSources(logFilter string) []string {
+	switch logFilter {
+	case "all":
+		return []string{"main"}
+	case "assign":
+		return []string{"assign", "quota"}
+	default:
+		return []string{logFilter}
+	}
+}
 
-		if match {
-			timeStr := entry.Time.Format("15:04:05")
-			content += fmt.Sprintf("[gray]%s[-] %s\n", timeStr, entry.Message)
+// buildLogsView builds the filtered logs view for the right pane. Lines are
+// read from the log files, so the whole session can be scrolled back
+// through a page at a time.
+func (t *TUI) buildLogsView() string {
+	logFilter := t.logFilter
+	if t.logWindowFor != logFilter {
+		t.logWindow = t.cfg.Logs.PageLines
+		t.logWindowFor = logFilter
+	}
+	window := t.logWindow
+
+	logsDir := filepath.Join(t.cfg.MachinatorDir, "logs")
+	var records []history.Record
+	more := false
+	for _, source := range logSources(logFilter) {
+		lines, older := tailLog(logsDir, source, window)
+		more = more || older
+		for _, line := range lines {
+			r, ok := history.ParseLogLine(line)
+			if !ok {
+				// Rest of a multi-line message
+				if n := len(records); n > 0 {
+					records[n-1].Text += "\n" + line
+				}
+				continue
+			}
+			records = append(records, r)
 		}
 	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Time.Before(records[j].Time)
+	})
+	if len(records) > window {
+		records, more = records[len(records)-window:], true
+	}
+	t.logHasMore = more
 
-	return content
+	var sb strings.Builder
+	if more {
+		sb.WriteString("[gray]↑ scroll up for older lines[-]\n")
+	}
+	for _, r := range records {
+		fmt.Fprintf(&sb, "[gray]%s[-] %s\n", r.Time.Format("15:04:05"), tview.Escape(r.Text))
+	}
+	return sb.String()
 }
@@ -0,0 +1,112 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+
+	"github.com/bryantinsley/machinator/backend/internal/beads"
+	"github.com/bryantinsley/machinator/backend/internal/tracker"
+)
+
+// openNewTask shows the new task form.
+func (t *TUI) openNewTask() {
+	form := tview.NewForm().
+		AddInputField("Title", "", 0, nil, nil).
+		AddTextArea("Description", "", 0, 6, 0, nil).
+		AddCheckbox("Complex", false, nil).
+		AddInputField("Blocked by", "", 0, nil, nil)
+	form.GetFormItemByLabel("Blocked by").(*tview.InputField).SetPlaceholder("task IDs, e.g. bd-12 bd-15")
+	form.AddButton("Create", func() {
+		task := &beads.Task{
+			Title:       strings.TrimSpace(form.GetFormItemByLabel("Title").(*tview.InputField).GetText()),
+			Description: strings.TrimSpace(form.GetFormItemByLabel("Description").(*tview.TextArea).GetText()),
+			IsComplex:   form.GetFormItemByLabel("Complex").(*tview.Checkbox).IsChecked(),
+			BlockedBy: strings.FieldsFunc(form.GetFormItemByLabel("Blocked by").(*tview.InputField).GetText(), func(r rune) bool {
+				return r == ',' || r == ' '
+			}),
+		}
+		if task.Title == "" {
+			form.SetTitle(" New Task [red](needs a title)[-] ")
+			form.SetFocus(0)
+			return
+		}
+		t.closeForm()
+		go t.createTask(task)
+	})
+	form.AddButton("Cancel", t.closeForm)
+	t.showForm(form, " New Task ", 17)
+}
+
+// showForm shows a form in place of the screen. It has the keyboard until
+// it is submitted or cancelled, which must call closeForm.
+func (t *TUI) showForm(form *tview.Form, title string, height int) {
+	t.formOpen = true
+	form.SetCancelFunc(t.closeForm)
+	form.SetBorder(true).SetTitle(title)
+
+	bgColor := tcell.NewRGBColor(22, 26, 28)
+	form.SetBackgroundColor(bgColor)
+	form.SetFieldBackgroundColor(tcell.NewRGBColor(44, 52, 56))
+
+	// Centered over an empty screen
+	column := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(nil, 0, 1, false).
+		AddItem(form, height, 0, true).
+		AddItem(nil, 0, 1, false)
+	layout := tview.NewFlex().
+		AddItem(nil, 0, 1, false).
+		AddItem(column, 72, 0, true).
+		AddItem(nil, 0, 1, false)
+	layout.SetBackgroundColor(bgColor)
+	column.SetBackgroundColor(bgColor)
+	t.app.SetRoot(layout, true)
+}
+
+// closeForm puts the screen back.
+func (t *TUI) closeForm() {
+	t.formOpen = false
+	t.app.SetRoot(t.root, true)
+}
+
+// createTask adds a task through the project's task backend and reports
+// the result in the help bar. Runs off the main goroutine.
+func (t *TUI) createTask(task *beads.Task) {
+	t.mu.Lock()
+	cachedTasks := t.cachedTasks
+	t.mu.Unlock()
+
+	known := make(map[string]bool, len(cachedTasks))
+	for _, ct := range cachedTasks {
+		known[ct.ID] = true
+	}
+	var notice string
+	for _, id := range task.BlockedBy {
+		if !known[id] {
+			notice = fmt.Sprintf("[red]Can't add %q: no task %s to be blocked by[-]", task.Title, id)
+		}
+	}
+	if notice == "" {
+		id, err := tracker.Create(t.projCfg, t.repoDir, task)
+		switch {
+		case err != nil && id != "":
+			notice = fmt.Sprintf("[yellow]Added %s, but: %v[-]", id, err)
+		case err != nil:
+			notice = fmt.Sprintf("[red]Can't add task: %v[-]", err)
+		default:
+			notice = fmt.Sprintf("[green]Added %s: %s[-]", id, task.Title)
+		}
+		t.mu.Lock()
+		t.cachedTasksTime = time.Time{} // Reload on the next refresh
+		t.mu.Unlock()
+	}
+
+	t.app.QueueUpdateDraw(func() {
+		t.notice = notice
+		t.noticeUntil = time.Now().Add(5 * time.Second)
+		t.updateHelpBar()
+	})
+}
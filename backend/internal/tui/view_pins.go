@@ -0,0 +1,102 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+
+	"github.com/bryantinsley/machinator/backend/internal/rundb"
+	"github.com/bryantinsley/machinator/backend/internal/transcript"
+)
+
+// openPins switches to the list of pinned events.
+func (t *TUI) openPins() {
+	t.logFilter = "pins"
+	t.selectedIdx = 0
+	t.rightFlex.SetTitle(" Pinned Events ")
+}
+
+// pinEvent bookmarks transcript event i of a task and reports the outcome
+// in the help bar. Runs off the main goroutine.
+func (t *TUI) pinEvent(taskID string, i int, e transcript.Entry) {
+	notice := fmt.Sprintf("[green]Pinned event %d of %s[-]", i+1, taskID)
+	if db := t.state.DB(); db == nil {
+		notice = "[red]Can't pin: no run database[-]"
+	} else if _, err := db.AddPin(rundb.Pin{
+		TaskID:    taskID,
+		AgentID:   e.Agent,
+		RunID:     e.Run,
+		EventTime: e.Time,
+		EventNum:  i + 1,
+		Text:      transcript.Summary(e),
+	}); err != nil {
+		notice = fmt.Sprintf("[red]Can't pin: %v[-]", err)
+	}
+	t.app.QueueUpdateDraw(func() {
+		t.notice = notice
+		t.noticeUntil = time.Now().Add(5 * time.Second)
+		t.updateHelpBar()
+	})
+}
+
+// handlePinsKey handles keys in the pinned events list.
+// Returns nil to indicate the key was handled, or returns event to pass through.
+func (t *TUI) handlePinsKey(event *tcell.EventKey) *tcell.EventKey {
+	switch event.Key() {
+	case tcell.KeyEscape:
+		t.logFilter = "assign"
+		t.rightFlex.SetTitle(" (A)ssignment Log ")
+		return nil
+	case tcell.KeyUp:
+		if t.selectedIdx > 0 {
+			t.selectedIdx--
+		}
+		return nil
+	case tcell.KeyDown:
+		t.selectedIdx++ // Clamped when the view is built
+		return nil
+	}
+
+	if r := event.Rune(); r == 'd' || r == 'D' {
+		if pins := t.pins; t.selectedIdx < len(pins) {
+			id := pins[t.selectedIdx].ID
+			go t.state.DB().DeletePin(id)
+		}
+		return nil
+	}
+	return event
+}
+
+// buildPinsView lists pinned events in the order they happened.
+func (t *TUI) buildPinsView() string {
+	db := t.state.DB()
+	if db == nil {
+		return " [gray]No run database[-]"
+	}
+	pins, err := db.Pins()
+	if err != nil {
+		return fmt.Sprintf(" [red]%v[-]", err)
+	}
+	t.pins = pins
+	if len(pins) == 0 {
+		return " [gray]No pinned events. Press m on an event in a replay to pin it.[-]"
+	}
+	if t.selectedIdx >= len(pins) {
+		t.selectedIdx = len(pins) - 1
+	}
+
+	var sb strings.Builder
+	for i, p := range pins {
+		prefix := "  "
+		if i == t.selectedIdx {
+			prefix = "[white::r]>[-:-:-] "
+		}
+		fmt.Fprintf(&sb, "%s[gray]%s[-] [blue]%s #%d[-] [gray]agent %d[-]\n", prefix,
+			p.EventTime.Local().Format("01-02 15:04:05"), tview.Escape(p.TaskID), p.EventNum, p.AgentID)
+		sb.WriteString("      " + tview.Escape(clipWidth(p.Text, t.rightWidth-6)) + "\n")
+	}
+	return sb.String()
+}
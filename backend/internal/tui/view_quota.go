@@ -0,0 +1,109 @@
+package tui
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bryantinsley/machinator/backend/internal/quota"
+)
+
+// Quota table column widths, separating space included.
+const (
+	quotaHeartsColumn  = 11 // "♥♥♥♥♥ 100%"
+	quotaPercentColumn = 5  // "100%"
+	maxModelLabel      = 10
+)
+
+// quotaTable renders the quota panel: a row per model in models and a
+// column per account, sorted by name. Columns show hearts and a percentage
+// while they fit in width, then just the percentage; accounts that still
+// don't fit are folded into a last "+N" column with the best of them. A
+// width of 0 (not drawn yet) fits everything.
+func quotaTable(accounts []quota.AccountQuota, models []string, simpleModel, complexModel string, width int) string {
+	accounts = slices.Clone(accounts)
+	slices.SortFunc(accounts, func(a, b quota.AccountQuota) int { return strings.Compare(a.Name, b.Name) })
+
+	labelWidth := 0
+	for _, model := range models {
+		labelWidth = max(labelWidth, min(utf8.RuneCountInString(quota.ModelLabel(model)), maxModelLabel))
+	}
+	labelWidth++ // Space before the first column
+
+	fits := func(columns, columnWidth int) bool {
+		return width <= 0 || labelWidth+columns*columnWidth <= width
+	}
+	hearts, columnWidth := true, quotaHeartsColumn
+	if !fits(len(accounts), columnWidth) {
+		hearts, columnWidth = false, quotaPercentColumn
+	}
+	shown, hidden := accounts, []quota.AccountQuota(nil)
+	if !fits(len(accounts), columnWidth) {
+		n := max((width-labelWidth)/columnWidth-1, 1) // One column left for "+N"
+		shown, hidden = accounts[:n], accounts[n:]
+	}
+
+	percent := func(acc quota.AccountQuota, model string) int {
+		if remaining, ok := acc.Models[model]; ok {
+			return int(remaining * 100)
+		}
+		return -1
+	}
+	cell := func(pct int) string {
+		text := "[gray]  --[-]"
+		if pct >= 0 {
+			text = fmt.Sprintf("%3d%%", pct)
+		}
+		if hearts {
+			return renderQuotaHearts(pct) + " " + text + " "
+		}
+		return text + " "
+	}
+
+	var b strings.Builder
+	b.WriteString(strings.Repeat(" ", labelWidth))
+	for _, acc := range shown {
+		b.WriteString(pad(clip(acc.Name, columnWidth-1), columnWidth))
+	}
+	if len(hidden) > 0 {
+		b.WriteString(fmt.Sprintf("+%d", len(hidden)))
+	}
+	b.WriteString("\n")
+
+	for _, model := range models {
+		color := "white"
+		switch model {
+		case simpleModel:
+			color = "#00CCCC"
+		case complexModel:
+			color = "#CC66FF"
+		}
+		fmt.Fprintf(&b, "[%s]%s[-]", color, pad(clip(quota.ModelLabel(model), maxModelLabel), labelWidth))
+		for _, acc := range shown {
+			b.WriteString(cell(percent(acc, model)))
+		}
+		if len(hidden) > 0 {
+			best := -1
+			for _, acc := range hidden {
+				best = max(best, percent(acc, model))
+			}
+			b.WriteString(cell(best))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// clip cuts s to n characters, ending in "…" if it was longer.
+func clip(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:max(n-1, 0)]) + "…"
+}
+
+// pad pads s with spaces to n characters.
+func pad(s string, n int) string {
+	return s + strings.Repeat(" ", max(n-utf8.RuneCountInString(s), 0))
+}
@@ -0,0 +1,44 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bryantinsley/machinator/backend/internal/quota"
+)
+
+func TestQuotaTable(t *testing.T) {
+	accounts := []quota.AccountQuota{
+		{Name: "work", Models: map[string]float64{"gemini-3-flash-preview": 0.5, "gemini-embedding-001": 1}},
+		{Name: "home", Models: map[string]float64{"gemini-3-flash-preview": 1, "gemini-3-pro-preview": 0.25}},
+	}
+	models := []string{"gemini-3-flash-preview", "gemini-3-pro-preview", "gemini-embedding-001"}
+
+	wide := quotaTable(accounts, models, models[0], models[1], 80)
+	lines := strings.Split(strings.TrimSuffix(wide, "\n"), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("want a header and a row per model:\n%s", wide)
+	}
+	if !strings.HasPrefix(strings.TrimSpace(lines[0]), "home") || !strings.Contains(lines[3], "embedding…") {
+		t.Errorf("accounts not sorted or labels not shortened:\n%s", wide)
+	}
+	if !strings.Contains(lines[1], "♥") || !strings.Contains(lines[2], " 25%") || !strings.Contains(lines[2], "--") {
+		t.Errorf("pro row should show home's 25%% and no quota for work:\n%s", wide)
+	}
+
+	// Too narrow for hearts: percentages only
+	if narrow := quotaTable(accounts, models, models[0], models[1], 22); strings.Contains(narrow, "♥") || !strings.Contains(narrow, "100%") {
+		t.Errorf("narrow table:\n%s", narrow)
+	}
+
+	// Too narrow even for that: the rest fold into "+N" with their best
+	var many []quota.AccountQuota
+	for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		many = append(many, quota.AccountQuota{Name: name, Models: map[string]float64{"m": 0.1}})
+	}
+	many[5].Models["m"] = 0.9
+	folded := quotaTable(many, []string{"m"}, "m", "", 22)
+	if !strings.Contains(folded, "+3") || !strings.HasSuffix(strings.TrimSpace(folded), "90%") {
+		t.Errorf("folded table:\n%s", folded)
+	}
+}
@@ -0,0 +1,48 @@
+package tui
+
+import (
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// ConfirmRecovery shows what an unclean shutdown left behind and what will
+// be done about it, before the main screen starts. Returns true once the
+// user confirms with Enter, false if they quit instead.
+func ConfirmRecovery(report string) bool {
+	app := tview.NewApplication()
+	bgColor := tcell.NewRGBColor(22, 26, 28)
+
+	text := tview.NewTextView().SetScrollable(true)
+	text.SetText(report)
+	text.SetBorder(true).SetTitle(" Recovery " + profileTitle())
+	text.SetBackgroundColor(bgColor)
+
+	help := tview.NewTextView().
+		SetDynamicColors(true).
+		SetTextAlign(tview.AlignCenter)
+	help.SetText("(Enter) Reconcile and start  (Q)uit")
+	help.SetBackgroundColor(bgColor)
+
+	root := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(text, 0, 1, true).
+		AddItem(help, 1, 0, false)
+	root.SetBackgroundColor(bgColor)
+
+	confirmed := false
+	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch {
+		case event.Key() == tcell.KeyEnter:
+			confirmed = true
+			app.Stop()
+		case event.Key() == tcell.KeyEscape, event.Key() == tcell.KeyCtrlC, event.Rune() == 'q', event.Rune() == 'Q':
+			app.Stop()
+		default:
+			return event // Scrolling
+		}
+		return nil
+	})
+	if err := app.SetRoot(root, true).Run(); err != nil {
+		return false
+	}
+	return confirmed
+}
@@ -0,0 +1,234 @@
+package tui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+
+	"github.com/bryantinsley/machinator/backend/internal/transcript"
+)
+
+const (
+	// replayMaxGap caps the pause between events during playback.
+	replayMaxGap = 2 * time.Second
+
+	// foldLines is the longest event output shown inline; longer output is
+	// folded until expanded.
+	foldLines = 8
+
+	// maxBodyLines caps expanded output; the rest is only exported.
+	maxBodyLines = 1000
+)
+
+// openReplay switches to the transcript replay for a task.
+func (t *TUI) openReplay(taskID string) {
+	t.logFilter = "replay:" + taskID
+	t.replayTask = "" // Reload and restart on next refresh
+	t.replayOpen = make(map[int]bool)
+	t.replayExport = -1
+	t.replayNote = ""
+	t.replaySel = 0
+	t.replayMove = 0
+	t.replayAgent = 0
+	t.rightFlex.SetTitle(" Replay ")
+}
+
+// handleReplayKey handles keys in the replay view.
+// Returns nil to indicate the key was handled, or returns event to pass through.
+func (t *TUI) handleReplayKey(event *tcell.EventKey) *tcell.EventKey {
+	taskID := strings.TrimPrefix(t.logFilter, "replay:")
+	switch event.Key() {
+	case tcell.KeyEscape:
+		t.logFilter = "beads:" + taskID
+		t.rightFlex.SetTitle(" Beads! ")
+		return nil
+	case tcell.KeyUp:
+		t.replayMove-- // Resolved against the visible events when the view is built
+		return nil
+	case tcell.KeyDown:
+		t.replayMove++
+		return nil
+	}
+
+	switch event.Rune() {
+	case 'r', 'R':
+		t.replayTask = "" // Restart
+		t.replayOpen = make(map[int]bool)
+		t.replaySel = 0
+	case 'f', 'F':
+		t.replayAgent = nextAgent(t.replayEntries, t.replayAgent)
+	case 'o', 'O':
+		// Replace rather than modify: the refresh goroutine may be reading it
+		open := make(map[int]bool, len(t.replayOpen)+1)
+		for i, v := range t.replayOpen {
+			open[i] = v
+		}
+		open[t.replaySel] = !open[t.replaySel]
+		t.replayOpen = open
+	case 'e', 'E':
+		t.replayExport = t.replaySel // Written by the refresh goroutine
+	case 'm', 'M':
+		if i := t.replaySel; i < len(t.replayEntries) {
+			go t.pinEvent(taskID, i, t.replayEntries[i])
+		}
+	default:
+		return event
+	}
+	return nil
+}
+
+// nextAgent returns the agent after current among those in the transcript,
+// cycling back to 0 (all agents) after the last.
+func nextAgent(entries []transcript.Entry, current int) int {
+	next := 0
+	for _, e := range entries {
+		if e.Agent > current && (next == 0 || e.Agent < next) {
+			next = e.Agent
+		}
+	}
+	return next
+}
+
+// moveCursor moves the selected entry sel by move steps through visible
+// (ascending entry indexes). The cursor is an entry index rather than a
+// position, so it stays on the same event as new ones are revealed; if sel
+// is hidden it first snaps to the nearest visible event before it.
+func moveCursor(visible []int, sel, move int) int {
+	if len(visible) == 0 {
+		return sel
+	}
+	pos := 0
+	for p, i := range visible {
+		if i <= sel {
+			pos = p
+		}
+	}
+	pos += move
+	if pos >= len(visible) {
+		pos = len(visible) - 1
+	}
+	if pos < 0 {
+		pos = 0
+	}
+	return visible[pos]
+}
+
+// buildReplayView plays back a task's transcript, revealing events as
+// their (compressed) time comes. Multi-line output is shown under its event
+// unless it is longer than foldLines, in which case only its size is shown
+// until it is expanded or exported. With an agent filter, the cursor only
+// stops on that agent's events.
+func (t *TUI) buildReplayView(taskID string) string {
+	if t.replayTask != taskID {
+		entries, err := transcript.Load(t.cfg.MachinatorDir, taskID)
+		if os.IsNotExist(err) {
+			return fmt.Sprintf(" [gray]No transcript for %s (the task has not run yet)[-]", taskID)
+		} else if err != nil {
+			return fmt.Sprintf(" [red]%v[-]", err)
+		}
+		t.replayEntries = entries
+		t.replayOffsets = transcript.PlaybackOffsets(entries, 1, replayMaxGap)
+		t.replayStart = time.Now()
+		t.replayTask = taskID
+	}
+
+	if i := t.replayExport; i >= 0 && i < len(t.replayEntries) {
+		t.replayNote = t.exportEvent(taskID, i)
+	}
+	t.replayExport = -1
+
+	elapsed := time.Since(t.replayStart)
+	shown := 0
+	for shown < len(t.replayEntries) && t.replayOffsets[shown] <= elapsed {
+		shown++
+	}
+	var visible []int
+	for i, e := range t.replayEntries[:shown] {
+		if t.replayAgent == 0 || e.Agent == t.replayAgent {
+			visible = append(visible, i)
+		}
+	}
+
+	t.replaySel = moveCursor(visible, t.replaySel, t.replayMove)
+	t.replayMove = 0
+
+	var sb strings.Builder
+	if t.replayNote != "" {
+		sb.WriteString(t.replayNote + "\n")
+	}
+	expanded := t.replayOpen
+	var runStart time.Time
+	lastRun := int64(-1)
+	for _, i := range visible {
+		e := t.replayEntries[i]
+		if e.Run != lastRun {
+			lastRun = e.Run
+			runStart = e.Time
+			fmt.Fprintf(&sb, "[yellow]Run %d, agent %d, %s[-]\n", e.Run, e.Agent, e.Time.Local().Format("2006-01-02 15:04:05"))
+		}
+		prefix := "  "
+		if i == t.replaySel {
+			prefix = "[white::r]>[-:-:-] "
+		}
+		elapsed := e.Time.Sub(runStart).Round(time.Second)
+		fmt.Fprintf(&sb, "%s[gray]+%s[-] %s\n", prefix, elapsed, tview.Escape(transcript.Summary(e)))
+
+		// Count before splitting; folded output is never split or colored
+		body := strings.TrimRight(transcript.Body(e), "\n")
+		n := strings.Count(body, "\n") + 1
+		switch {
+		case n < 2:
+			// The summary already shows it
+		case n > foldLines && !expanded[i]:
+			hint := ""
+			if i == t.replaySel {
+				hint = ", press o to expand / e to export"
+			}
+			fmt.Fprintf(&sb, "      [gray]▸ %d lines%s[-]\n", n, hint)
+		default:
+			writeBody(&sb, body, n)
+		}
+	}
+	if shown < len(t.replayEntries) {
+		fmt.Fprintf(&sb, "[gray]... %d/%d events[-]\n", shown, len(t.replayEntries))
+	}
+	return sb.String()
+}
+
+// writeBody writes the first maxBodyLines lines of an event's output, with
+// JSON colored one line at a time.
+func writeBody(sb *strings.Builder, body string, n int) {
+	isJSON := strings.HasPrefix(body, "{") || strings.HasPrefix(body, "[")
+	for i := 0; i < n && i < maxBodyLines; i++ {
+		line, rest, _ := strings.Cut(body, "\n")
+		body = rest
+		if isJSON {
+			line = colorizeJSONLine(line)
+		} else {
+			line = tview.Escape(line)
+		}
+		sb.WriteString("      [gray]│[-] " + line + "\n")
+	}
+	if n > maxBodyLines {
+		fmt.Fprintf(sb, "      [gray]▸ %d more lines, press e to export[-]\n", n-maxBodyLines)
+	}
+}
+
+// exportEvent writes an event's full output to MACHINATOR_DIR/exports and
+// returns a line describing the result.
+func (t *TUI) exportEvent(taskID string, i int) string {
+	dir := filepath.Join(t.cfg.MachinatorDir, "exports")
+	path := filepath.Join(dir, fmt.Sprintf("%s-event-%d.txt", taskID, i+1))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Sprintf("[red]Export failed: %v[-]", err)
+	}
+	if err := os.WriteFile(path, []byte(transcript.Body(t.replayEntries[i])), 0644); err != nil {
+		return fmt.Sprintf("[red]Export failed: %v[-]", err)
+	}
+	return "[green]Exported event " + fmt.Sprint(i+1) + " to " + tview.Escape(path) + "[-]"
+}
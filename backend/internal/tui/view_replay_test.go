@@ -0,0 +1,44 @@
+package tui
+
+import (
+	"testing"
+
+	"github.com/bryantinsley/machinator/backend/internal/transcript"
+)
+
+func TestMoveCursorStepsThroughVisibleEvents(t *testing.T) {
+	visible := []int{1, 4, 6, 9} // e.g. one agent's events
+
+	tests := []struct {
+		sel, move, want int
+	}{
+		{4, 1, 6},  // Next visible event, skipping 5
+		{4, -1, 1}, // Previous
+		{9, 3, 9},  // Clamped at the end
+		{1, -2, 1}, // Clamped at the start
+		{5, 0, 4},  // Hidden selection snaps back
+		{0, 0, 1},  // Before the first visible event
+		{6, 0, 6},  // No move keeps the event
+	}
+	for _, tt := range tests {
+		if got := moveCursor(visible, tt.sel, tt.move); got != tt.want {
+			t.Errorf("moveCursor(%d, %+d) = %d, want %d", tt.sel, tt.move, got, tt.want)
+		}
+	}
+
+	// Newly revealed events don't move the cursor
+	if got := moveCursor(append(visible, 12, 15), 6, 0); got != 6 {
+		t.Errorf("cursor moved to %d when events were added", got)
+	}
+}
+
+func TestNextAgentCycles(t *testing.T) {
+	entries := []transcript.Entry{{Agent: 3}, {Agent: 1}, {Agent: 3}, {Agent: 2}}
+	got := []int{}
+	for a := nextAgent(entries, 0); a != 0; a = nextAgent(entries, a) {
+		got = append(got, a)
+	}
+	if len(got) != 3 || got[0] != 1 || got[1] != 2 || got[2] != 3 {
+		t.Errorf("agents = %v, want [1 2 3]", got)
+	}
+}
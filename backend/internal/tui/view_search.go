@@ -0,0 +1,104 @@
+package tui
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+
+	"github.com/bryantinsley/machinator/backend/internal/history"
+)
+
+// maxSearchResults caps how many matches are rendered (the newest ones).
+const maxSearchResults = 500
+
+// openSearchInput replaces the help bar with the search prompt.
+func (t *TUI) openSearchInput() {
+	t.searching = true
+	t.searchInput.SetText(t.searchQuery)
+	t.root.RemoveItem(t.helpBar)
+	t.root.AddItem(t.searchInput, 1, 0, true)
+	t.app.SetFocus(t.searchInput)
+}
+
+// closeSearchInput restores the help bar, running the search on Enter.
+func (t *TUI) closeSearchInput(key tcell.Key) {
+	t.searching = false
+	t.root.RemoveItem(t.searchInput)
+	t.root.AddItem(t.helpBar, 1, 0, false)
+	t.app.SetFocus(t.rightFlex)
+
+	if key != tcell.KeyEnter || strings.TrimSpace(t.searchInput.GetText()) == "" {
+		return
+	}
+	t.searchQuery = strings.TrimSpace(t.searchInput.GetText())
+	t.searchFor = "" // Search again on next refresh
+	t.logFilter = "search"
+	t.rightFlex.SetTitle(" Search ")
+}
+
+// handleSearchKey handles keys on the search results screen.
+// Returns nil to indicate the key was handled, or returns event to pass through.
+func (t *TUI) handleSearchKey(event *tcell.EventKey) *tcell.EventKey {
+	if event.Key() == tcell.KeyEscape {
+		t.logFilter = "assign"
+		t.rightFlex.SetTitle(" (A)ssignment Log ")
+		return nil
+	}
+	return event
+}
+
+// buildSearchView lists history records matching the current query, with
+// the matched text highlighted. History is read from disk once per query.
+func (t *TUI) buildSearchView() string {
+	query := t.searchQuery
+	if t.searchFor != query {
+		records, err := history.Load(t.cfg.MachinatorDir)
+		if err != nil {
+			return fmt.Sprintf(" [red]Load history: %v[-]", err)
+		}
+		t.searchResults = history.Search(records, history.ParseQuery(query))
+		t.searchFor = query
+	}
+
+	results := t.searchResults
+	if len(results) == 0 {
+		return " [gray]No matches[-]"
+	}
+
+	var sb strings.Builder
+	if len(results) > maxSearchResults {
+		fmt.Fprintf(&sb, "[gray]%d matches, showing the newest %d[-]\n", len(results), maxSearchResults)
+		results = results[len(results)-maxSearchResults:]
+	}
+
+	text := history.ParseQuery(query).Text
+	for _, r := range results {
+		where := r.Source
+		if r.TaskID != "" {
+			where = fmt.Sprintf("agent-%d %s", r.Agent, r.TaskID)
+		}
+		fmt.Fprintf(&sb, "[gray]%s[-] [blue]%s[-] %s\n",
+			r.Time.Local().Format("01-02 15:04:05"), tview.Escape(where), highlight(r.Text, text))
+	}
+	return sb.String()
+}
+
+// highlight escapes s for tview and marks case-insensitive matches of term.
+func highlight(s, term string) string {
+	if term == "" {
+		return tview.Escape(s)
+	}
+	re := regexp.MustCompile("(?i)" + regexp.QuoteMeta(term))
+	var sb strings.Builder
+	last := 0
+	for _, m := range re.FindAllStringIndex(s, -1) {
+		sb.WriteString(tview.Escape(s[last:m[0]]))
+		sb.WriteString("[black:yellow]" + tview.Escape(s[m[0]:m[1]]) + "[-:-]")
+		last = m[1]
+	}
+	sb.WriteString(tview.Escape(s[last:]))
+	return sb.String()
+}
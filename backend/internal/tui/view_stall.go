@@ -0,0 +1,130 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+
+	"github.com/bryantinsley/machinator/backend/internal/beads"
+)
+
+// stallLabels names and colors each beads.Diagnose problem kind.
+var stallLabels = map[string]string{
+	beads.ProblemCycle:    "[red]cycle   [-]",
+	beads.ProblemMissing:  "[red]missing [-]",
+	beads.ProblemStatus:   "[yellow]status  [-]",
+	beads.ProblemStranded: "[yellow]stranded[-]",
+	beads.ProblemWaiting:  "[cyan]waiting [-]",
+}
+
+// openStall switches to the "why is nothing running?" screen.
+func (t *TUI) openStall() {
+	t.logFilter = "stall"
+	t.selectedIdx = 0
+	t.rightFlex.SetTitle(" (W)hy ")
+}
+
+// handleStallKey handles keys in the stall diagnosis.
+// Returns nil to indicate the key was handled, or returns event to pass through.
+func (t *TUI) handleStallKey(event *tcell.EventKey) *tcell.EventKey {
+	switch event.Key() {
+	case tcell.KeyEscape:
+		t.logFilter = "assign"
+		t.rightFlex.SetTitle(" (A)ssignment Log ")
+		return nil
+	case tcell.KeyUp:
+		if t.selectedIdx > 0 {
+			t.selectedIdx--
+		}
+		return nil
+	case tcell.KeyDown:
+		t.selectedIdx++ // Clamped when the view is built
+		return nil
+	case tcell.KeyEnter:
+		if p := t.stallProblems(); t.selectedIdx >= 0 && t.selectedIdx < len(p) {
+			t.logFilter = "beads:" + p[t.selectedIdx].TaskIDs[0]
+			t.rightFlex.SetTitle(" Beads! ")
+		}
+		return nil
+	}
+	return event
+}
+
+// stallProblems diagnoses the cached tasks against what agents are running.
+func (t *TUI) stallProblems() []beads.Problem {
+	t.mu.Lock()
+	cachedTasks := t.cachedTasks
+	t.mu.Unlock()
+
+	working := make(map[string]bool)
+	for _, a := range t.state.AssignedAgents() {
+		working[a.TaskID] = true
+	}
+	return beads.Diagnose(cachedTasks, working)
+}
+
+// buildStallView explains why no work is being assigned: paused, every
+// ready task barred, or open tasks that can't become ready and what to run
+// to fix them.
+func (t *TUI) buildStallView() string {
+	t.mu.Lock()
+	cachedTasks := t.cachedTasks
+	t.mu.Unlock()
+
+	if len(cachedTasks) == 0 {
+		return "[gray]No tasks loaded[-]"
+	}
+
+	var sb strings.Builder
+	if t.state.AssignmentIsPaused() {
+		sb.WriteString(" [yellow]Assignment is paused.[-] Press S to start.\n\n")
+	}
+
+	if !beads.Stalled(cachedTasks) {
+		ready := beads.ReadyTasks(cachedTasks)
+		barred := 0
+		for _, task := range ready {
+			if t.state.IsTaskBarred(task.ID) {
+				barred++
+			}
+		}
+		switch {
+		case len(ready) == 0:
+			sb.WriteString(" [green]Every task is closed.[-]\n")
+		case barred == len(ready):
+			fmt.Fprintf(&sb, " [yellow]All %d ready tasks are barred.[-] Unbar one with ! in Beads.\n", barred)
+		default:
+			fmt.Fprintf(&sb, " [green]%d tasks are ready;[-] nothing is stuck.\n", len(ready)-barred)
+		}
+		return sb.String()
+	}
+
+	problems := t.stallProblems()
+	if len(problems) == 0 {
+		sb.WriteString(" [yellow]No task is ready,[-] and no cause was found.\n")
+		return sb.String()
+	}
+	if t.selectedIdx >= len(problems) {
+		t.selectedIdx = len(problems) - 1
+	}
+
+	sb.WriteString(" [cyan]No task is ready. Fix these to free the open work:[-]\n\n")
+	for i, p := range problems {
+		line := p.Detail
+		if p.Holds > 0 {
+			line += fmt.Sprintf(" (holds up %d)", p.Holds)
+		}
+		line = tview.Escape(clipWidth(line, t.rightWidth-13))
+		if i == t.selectedIdx {
+			fmt.Fprintf(&sb, "[white::r]> %-8s %s[-:-:-]\n", p.Kind, line)
+		} else {
+			fmt.Fprintf(&sb, "  %s %s\n", stallLabels[p.Kind], line)
+		}
+		if p.Fix != "" {
+			fmt.Fprintf(&sb, "             [gray]%s[-]\n", tview.Escape(p.Fix))
+		}
+	}
+	return sb.String()
+}
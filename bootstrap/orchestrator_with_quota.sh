@@ -15,6 +15,9 @@ GEMINI_PANE="${BD_GEMINI_PANE}"
 GEMINI_CMD_BASE="gemini"
 GEMINI_ARGS="--yolo --output-format=text"
 
+# Builds the directive (bazel build //backend/cmd/machinator, or go build)
+MACHINATOR_BIN="${MACHINATOR_BIN:-backend/machinator}"
+
 # Sandbox Configuration
 SANDBOX_POLICY="/Users/bryantinsley/Code/machinator/.gemini/sandbox-macos-custom.sb"
 if [ -f "$SANDBOX_POLICY" ]; then
@@ -264,19 +267,13 @@ while [ $count -lt $MAX_CYCLES ]; do
     # Use deterministic path in project structure to avoid sandbox issues
     DIRECTIVE_FILE=".gemini/tmp/directive_${TASK_ID}.txt"
     
-    # Get context - escape special characters for sed
-    TASK_CONTEXT=$(echo "$TASK_INFO" | jq -r '.[0].description // "No description"' | tr '\n' ' ' | sed 's/[&/\|]/\\&/g' | sed 's/"/\\"/g')
-    PROJECT_CONTEXT="See AGENTS.md for full project context."
-
-    # Generate directive using envsubst-style replacement to avoid sed issues
-    cp bootstrap/directive_template.txt "$DIRECTIVE_FILE"
-    sed -i '' -e "s/AGENT_NAME_VAR/$AGENT_NAME/g" "$DIRECTIVE_FILE"
-    sed -i '' -e "s/TASK_ID_VAR/$TASK_ID/g" "$DIRECTIVE_FILE"
-    # Use perl for complex substitutions to handle special chars better
-    perl -i -pe "s|TASK_CONTEXT_VAR|$TASK_CONTEXT|g" "$DIRECTIVE_FILE" 2>/dev/null || \
-        sed -i '' -e "s|TASK_CONTEXT_VAR|Task context unavailable - see bd show $TASK_ID|g" "$DIRECTIVE_FILE"
-    perl -i -pe "s|PROJECT_CONTEXT_VAR|$PROJECT_CONTEXT|g" "$DIRECTIVE_FILE" 2>/dev/null || \
-        sed -i '' -e "s|PROJECT_CONTEXT_VAR|$PROJECT_CONTEXT|g" "$DIRECTIVE_FILE"
+    # The same built-in directive the Go orchestrator gives its agents
+    TASK_CONTEXT=$(echo "$TASK_INFO" | jq -r '.[0].description // "No description"')
+    if ! "$MACHINATOR_BIN" directive "$TASK_ID" --agent "$AGENT_NAME" --context "$TASK_CONTEXT" > "$DIRECTIVE_FILE"; then
+        log "❌ Failed to build directive with $MACHINATOR_BIN"
+        sleep 10
+        continue
+    fi
     
     if [ -n "$GEMINI_PANE" ]; then
         # Clear the Gemini pane